@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/aggregator"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/logging"
+	"github.com/bytemare/gonetmon/pkg/output"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// Aggregate implements the aggregate command, receiving the reports and alerts forwarded by agents, raising global
+// alerts on their combined traffic to the configured outputs, and serving a dashboard of all agents
+func Aggregate(args []string) error {
+	params := config.LoadParams()
+
+	flags := flag.NewFlagSet("gonetmon aggregate", flag.ContinueOnError)
+	flags.StringVar(&params.Aggregator.Address, "address", params.Aggregator.Address, "address to receive events from agents and serve the dashboard on")
+	flags.DurationVar(&params.Aggregator.AlertSpan, "alert-span", params.Aggregator.AlertSpan, "time frame over which the hits of all agents are summed")
+	flags.UintVar(&params.Aggregator.AlertThreshold, "alert-threshold", params.Aggregator.AlertThreshold, "hits of all agents over the span raising a global alert, 0 to disable global alerts")
+	flags.StringVar(&params.Aggregator.TLS.CertFile, "tls-cert", params.Aggregator.TLS.CertFile, "certificate served to agents and dashboard clients, enabling TLS")
+	flags.StringVar(&params.Aggregator.TLS.KeyFile, "tls-key", params.Aggregator.TLS.KeyFile, "private key of the served certificate")
+	flags.StringVar(&params.Aggregator.TLS.ClientCAFile, "client-ca", params.Aggregator.TLS.ClientCAFile, "certificate authorities agents must present a certificate signed by")
+	tokens := flags.String("agent-tokens", "", "file of agent tokens, one '<agent> <token>' pair per line, required from agents if set")
+	flags.Var(listValue{&params.Outputs}, "outputs", "comma separated outputs to send global alerts to")
+	flags.StringVar(&params.Log.Level, "log-level", params.Log.Level, "minimum level of logged messages : debug, info, warning or error")
+	flags.StringVar(&params.Log.Destination, "log-destination", params.Log.Destination, "where logs are written : stderr, file, syslog, journald, or auto")
+	flags.StringVar(&params.Log.File, "log-file", params.Log.File, "path of the log file, for the file destination")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments : %s", flags.Args())
+	}
+
+	if *tokens != "" {
+		var err error
+		if params.Aggregator.Tokens, err = readAgentTokens(*tokens); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range params.Outputs {
+		if name == config.AgentOutput {
+			return errors.New("the aggregator can not forward to another aggregator")
+		}
+	}
+
+	sinks, err := output.NewSinks(params)
+	if err != nil {
+		return err
+	}
+
+	if err := logging.Setup(log, params.Log); err != nil {
+		log.Error("Failed to set up logs, using default stderr : ", err)
+	}
+
+	agg, err := aggregator.New(params, sinks)
+	if err != nil {
+		for _, sink := range sinks {
+			_ = sink.Close()
+		}
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	go func() {
+		select {
+		case sig := <-sigs:
+			log.Info("Aggregator received signal :", sig.String())
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return agg.Run(ctx)
+}
+
+// readAgentTokens reads the tokens of agents from a file holding a '<agent> <token>' pair per line. Empty lines and
+// lines starting with # are ignored.
+func readAgentTokens(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open agent tokens : %s", err)
+	}
+	defer file.Close()
+
+	tokens := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d : expected an agent name and a token", path, line)
+		}
+		if _, ok := tokens[fields[0]]; ok {
+			return nil, fmt.Errorf("%s:%d : duplicate agent %s", path, line, fields[0])
+		}
+		tokens[fields[0]] = fields[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read agent tokens : %s", err)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("no agent token in %s", path)
+	}
+
+	return tokens, nil
+}
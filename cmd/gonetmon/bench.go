@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/google/gopacket"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// Bench implements the bench command, replaying the packets of a pcap file from memory through capture, then through
+// capture and analysis, as fast as possible, to tell the throughput achievable on this host
+func Bench(args []string) error {
+	params := config.LoadParams()
+
+	flags := flag.NewFlagSet("gonetmon bench", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: gonetmon bench [flags] <file.pcap>")
+		flags.PrintDefaults()
+	}
+	apply := monitorFlags(flags, params, false)
+	repeat := flags.Int("repeat", 10, "number of times the packets of the file are replayed")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("bench takes exactly one pcap file")
+	}
+	if *repeat <= 0 {
+		return errors.New("--repeat must be positive")
+	}
+	apply()
+
+	// Measure the pipeline alone : nothing is dropped, and nothing is recorded or sent to outputs
+	params.CaptureConfig.Backpressure = config.BlockPolicy
+	log.SetLevel(logrus.WarnLevel)
+
+	packets, err := capture.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if len(packets) == 0 {
+		return fmt.Errorf("no packets in %s", flags.Arg(0))
+	}
+
+	replayed := make([]gopacket.Packet, 0, len(packets)*(*repeat))
+	var bytes uint64
+	for i := 0; i < *repeat; i++ {
+		for _, packet := range packets {
+			replayed = append(replayed, packet)
+			bytes += uint64(packet.Metadata().Length)
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "Packets replayed\t%d (%d times %d)\n", len(replayed), *repeat, len(packets))
+	fmt.Fprintf(w, "Analysis workers\t%d\n", params.AnalysisWorkers)
+
+	stages := []struct {
+		name string
+		run  func(*config.Parameters, []gopacket.Packet) (time.Duration, error)
+	}{
+		{"Capture", benchCapture},
+		{"Capture and analysis", benchPipeline},
+	}
+	for _, stage := range stages {
+		elapsed, err := stage.run(params, replayed)
+		if err != nil {
+			return err
+		}
+
+		seconds := elapsed.Seconds()
+		fmt.Fprintf(w, "%s\t%.0f packets/s, %.1f Mbit/s, %s per packet\n", stage.name, float64(len(replayed))/seconds,
+			float64(bytes)*8/seconds/1e6, elapsed/time.Duration(len(replayed)))
+	}
+
+	return w.Flush()
+}
+
+// benchDevices returns capture devices delivering the packets from memory, and whose reads end once they are all
+// delivered, as a capture file's would
+func benchDevices(params *config.Parameters, packets []gopacket.Packet) (*capture.Devices, error) {
+	devices, err := capture.NewDevices(params.PacketFilter, &params.CaptureConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	source := capture.NewMockSource(packets)
+	_ = source.Close()
+	devices.Add("bench", "", source)
+
+	return devices, nil
+}
+
+// benchCapture collects the packets and discards their batches, and returns the time it took once they are set up
+func benchCapture(params *config.Parameters, packets []gopacket.Packet) (time.Duration, error) {
+	devices, err := benchDevices(params, packets)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	packetChan := make(chan []capture.PacketMsg, packetBacklog/params.CaptureConfig.BatchSize+1)
+	done := make(chan error, 1)
+
+	start := time.Now()
+	go func() {
+		done <- capture.Collector(ctx, devices, packetChan)
+	}()
+
+	// Discard batches until packetChan is closed, once the source is exhausted
+	for {
+		select {
+		case batch, ok := <-packetChan:
+			if ok {
+				capture.Release(batch)
+				continue
+			}
+			elapsed := time.Since(start)
+			cancel()
+			return elapsed, <-done
+
+		case err := <-done:
+			if err == nil {
+				err = errors.New("capture stopped before the packets were collected")
+			}
+			return 0, err
+		}
+	}
+}
+
+// benchPipeline collects and analyses the packets, discarding reports and alerts, and returns the time it took once
+// they are set up
+func benchPipeline(params *config.Parameters, packets []gopacket.Packet) (time.Duration, error) {
+	devices, err := benchDevices(params, packets)
+	if err != nil {
+		return 0, err
+	}
+
+	analyzers := make([][]analysis.Analyzer, 0, params.AnalysisWorkers)
+	for i := 0; i < params.AnalysisWorkers; i++ {
+		set, err := analysis.NewAnalyzers(params)
+		if err != nil {
+			for _, set := range analyzers {
+				analysis.CloseAnalyzers(set)
+			}
+			return 0, err
+		}
+		analyzers = append(analyzers, set)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	group, ctx := errgroup.WithContext(ctx)
+
+	packetChan := make(chan []capture.PacketMsg, packetBacklog/params.CaptureConfig.BatchSize+1)
+	reportChan := make(chan *analysis.Report, 1)
+	alertChan := make(chan alert.Message, 1)
+	watchdog := alert.NewWatchdog(params, nil, alertChan)
+	analysed := make(chan struct{})
+
+	start := time.Now()
+	group.Go(func() error {
+		return capture.Collector(ctx, devices, packetChan)
+	})
+	group.Go(func() error {
+		defer close(analysed)
+		return analysis.Monitor(ctx, params, analyzers, nil, watchdog, packetChan, reportChan)
+	})
+
+	// Discard reports and alerts
+	group.Go(func() error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-reportChan:
+			case <-alertChan:
+			}
+		}
+	})
+
+	// Monitor returns once it analysed all packets collected from the exhausted source
+	<-analysed
+	elapsed := time.Since(start)
+
+	cancel()
+	if err := group.Wait(); err != nil {
+		return 0, err
+	}
+
+	return elapsed, nil
+}
@@ -0,0 +1,616 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/extension"
+	"github.com/bytemare/gonetmon/pkg/inventory"
+	"github.com/bytemare/gonetmon/pkg/kubernetes"
+	"github.com/bytemare/gonetmon/pkg/logging"
+	"github.com/bytemare/gonetmon/pkg/output"
+	"net"
+	"net/url"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Time allowed to resolve the host of an output endpoint
+const resolveTimeout = 5 * time.Second
+
+// checkJSON is the machine-readable result of the check-config command
+type checkJSON struct {
+	Valid    bool     `json:"valid"`
+	Problems []string `json:"problems"`
+}
+
+// CheckConfig implements the check-config command, validating the configuration of a run without capturing traffic,
+// starting sidecars or connecting to outputs. It fails if a problem is found, so that it exits with a non-zero status.
+func CheckConfig(args []string) error {
+	params := config.LoadParams()
+
+	flags := flag.NewFlagSet("gonetmon check-config", flag.ContinueOnError)
+	apply := monitorFlags(flags, params, true)
+	flags.Var(listValue{&params.CaptureConfig.Files}, "file", "comma separated pcap or pcapng files replayed by the file source")
+	format := flags.String("format", config.TextFormat, "output format : text or json")
+	offline := flags.Bool("offline", false, "do not resolve the hosts of output endpoints")
+	if err := flags.Parse(args); err != nil {
+		return usageError(err)
+	}
+	if flags.NArg() != 0 {
+		return usageError(fmt.Errorf("unexpected arguments : %s", flags.Args()))
+	}
+	if *format != config.TextFormat && *format != config.JSONFormat {
+		return usageError(fmt.Errorf("unknown format : %s", *format))
+	}
+	apply()
+
+	problems := checkParameters(params)
+	if !*offline {
+		problems = append(problems, checkEndpoints(params)...)
+	}
+
+	if *format == config.JSONFormat {
+		result := checkJSON{Valid: len(problems) == 0, Problems: problems}
+		if result.Problems == nil {
+			result.Problems = []string{}
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(&result); err != nil {
+			return err
+		}
+	} else {
+		for _, problem := range problems {
+			fmt.Println("-", problem)
+		}
+		if len(problems) == 0 {
+			fmt.Println("Configuration is valid.")
+		}
+	}
+
+	if len(problems) != 0 {
+		return withStatus(exitConfig, fmt.Errorf("found %d problem(s) in the configuration", len(problems)))
+	}
+
+	return nil
+}
+
+// checkFanout returns the problems found in the fanout configuration of the named interface
+func checkFanout(name string, fanout config.FanoutConfig, source string) []string {
+	var problems []string
+
+	if source != config.AFPacketSource {
+		problems = append(problems, fmt.Sprintf("interface %s : fanout requires the %s capture source", name, config.AFPacketSource))
+	}
+	if fanout.Sockets <= 0 {
+		problems = append(problems, fmt.Sprintf("interface %s : the number of fanout sockets must be positive", name))
+	}
+
+	switch fanout.Mode {
+	case config.HashFanout, config.LoadBalanceFanout, config.CPUFanout:
+	default:
+		problems = append(problems, fmt.Sprintf("interface %s : unknown fanout mode : %s", name, fanout.Mode))
+	}
+
+	for _, cpu := range fanout.CPUs {
+		if cpu < 0 {
+			problems = append(problems, fmt.Sprintf("interface %s : invalid CPU %d", name, cpu))
+		}
+	}
+
+	return problems
+}
+
+// checkParameters returns the problems found in the parameters
+func checkParameters(params *config.Parameters) []string {
+	var problems []string
+
+	capt := params.CaptureConfig
+	switch capt.Source {
+	case config.FileSource:
+		if len(capt.Files) == 0 {
+			problems = append(problems, "no capture file to replay")
+		}
+		for _, file := range capt.Files {
+			if _, err := os.Stat(file); err != nil {
+				problems = append(problems, fmt.Sprintf("capture file : %s", err))
+			}
+		}
+		if capt.Namespace != "" {
+			problems = append(problems, "the network namespace only applies to live capture")
+		}
+	case config.PcapSource, config.AFPacketSource:
+		interfaces := append([]string(nil), params.Interfaces...)
+		for _, session := range params.Sessions {
+			interfaces = append(interfaces, session.Interfaces...)
+		}
+
+		// Interfaces are looked up in the namespace they are captured in
+		if err := capture.InNamespace(capt.Namespace, func() error {
+			for _, name := range interfaces {
+				if _, err := net.InterfaceByName(name); err != nil {
+					problems = append(problems, fmt.Sprintf("interface %s : %s", name, err))
+				}
+			}
+			return nil
+		}); err != nil {
+			problems = append(problems, fmt.Sprintf("network namespace : %s", err))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown capture source : %s", capt.Source))
+	}
+
+	switch capt.Backpressure {
+	case config.BlockPolicy, config.DropNewestPolicy, config.DropOldestPolicy:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown backpressure policy : %s", capt.Backpressure))
+	}
+
+	if capt.BatchSize <= 0 {
+		problems = append(problems, "the capture batch size must be positive")
+	}
+	if capt.BatchTimeout <= 0 {
+		problems = append(problems, "the capture batch timeout must be positive")
+	}
+
+	names := make([]string, 0, len(capt.Fanout))
+	for name := range capt.Fanout {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		problems = append(problems, checkFanout(name, capt.Fanout[name], capt.Source)...)
+	}
+
+	if params.AnalysisWorkers <= 0 {
+		problems = append(problems, "the number of analysis workers must be positive")
+	}
+	if params.Inventory.Enabled {
+		if _, err := inventory.ParseNetworks(params.Inventory.Networks); err != nil {
+			problems = append(problems, err.Error())
+		}
+		if _, err := inventory.Load(params.Inventory.File); err != nil && !os.IsNotExist(err) {
+			problems = append(problems, fmt.Sprintf("host inventory : %s", err))
+		}
+	}
+	if params.Storms.Enabled && params.Storms.Broadcast == 0 && params.Storms.Multicast == 0 {
+		problems = append(problems, "storm detection is enabled without broadcast nor multicast threshold")
+	}
+	for _, group := range params.Matrix.Groups {
+		if _, err := analysis.ParseAddresses(group.Networks); err != nil {
+			problems = append(problems, fmt.Sprintf("CIDR group %s : %s", group.Name, err))
+		}
+	}
+	if len(params.Matrix.Groups) > 0 && params.Matrix.Others == "" {
+		problems = append(problems, "the group of addresses in none of the CIDR groups must be named")
+	}
+	if params.Capacity.Enabled {
+		if params.Capacity.File == "" {
+			problems = append(problems, "capacity forecasts need a trends file")
+		}
+		if len(params.Capacity.Links) == 0 {
+			problems = append(problems, "capacity forecasts need the capacity of a link")
+		}
+		if params.Capacity.Horizon <= 0 {
+			problems = append(problems, "the capacity horizon must be positive")
+		}
+		if params.Capacity.MinDays < 2 || params.Capacity.History < params.Capacity.MinDays {
+			problems = append(problems, "capacity forecasts need at least 2 days of trends, and to keep at least those")
+		}
+	}
+	if params.Integrity.Enabled && (params.Integrity.Threshold <= 0 || params.Integrity.Threshold > 1) {
+		problems = append(problems, "the corruption rate threshold must be above 0, and at most 1")
+	}
+	if params.Uploads.Enabled {
+		if params.Uploads.Threshold == 0 {
+			problems = append(problems, "the upload threshold must be positive")
+		}
+		if params.Uploads.Span < params.DisplayRefresh {
+			problems = append(problems, "the upload span must be at least the report interval")
+		}
+		if _, err := analysis.ParseAddresses(params.Uploads.Internal); err != nil {
+			problems = append(problems, fmt.Sprintf("internal hosts of upload detection : %s", err))
+		}
+		if _, err := analysis.ParseAddresses(params.Uploads.Allowed); err != nil {
+			problems = append(problems, fmt.Sprintf("allowed upload destinations : %s", err))
+		}
+	}
+	for _, rule := range params.Changes {
+		problems = append(problems, unknownNames("metric", []string{rule.Metric}, []string{config.HitsMetric, config.BytesMetric, config.PacketsMetric, config.FlowsMetric})...)
+		if rule.Factor <= 0 || rule.Factor == 1 {
+			problems = append(problems, fmt.Sprintf("the factor of the change rule of %s must be positive, and other than 1", rule.Metric))
+		}
+		if rule.Lookback < params.DisplayRefresh {
+			problems = append(problems, fmt.Sprintf("the lookback of the change rule of %s must be at least the report interval", rule.Metric))
+		}
+		if rule.Minimum < 0 {
+			problems = append(problems, fmt.Sprintf("the minimum of the change rule of %s must not be negative", rule.Metric))
+		}
+	}
+	if params.Countries.Enabled {
+		if params.Countries.Database == "" {
+			problems = append(problems, "country alerts need a GeoIP database")
+		} else if _, err := os.Stat(params.Countries.Database); err != nil {
+			problems = append(problems, fmt.Sprintf("GeoIP database : %s", err))
+		}
+		if len(params.Countries.Countries) == 0 {
+			problems = append(problems, "country alerts need the countries to alert of")
+		}
+		for _, country := range params.Countries.Countries {
+			if len(country) != 2 {
+				problems = append(problems, fmt.Sprintf("invalid country code %q, expected an ISO 3166 code, e.g. KP", country))
+			}
+		}
+		if params.Countries.Threshold == 0 {
+			problems = append(problems, "the country alert threshold must be positive")
+		}
+		if _, err := analysis.ParseAddresses(params.Countries.Internal); err != nil {
+			problems = append(problems, fmt.Sprintf("internal hosts of country alerts : %s", err))
+		}
+		if _, err := analysis.ParseAddresses(params.Countries.Allowed); err != nil {
+			problems = append(problems, fmt.Sprintf("allowed addresses of country alerts : %s", err))
+		}
+	}
+	for _, target := range params.Watch.Targets {
+		if host, _, err := config.SplitTarget(target); err != nil {
+			problems = append(problems, err.Error())
+		} else if host == "" && !strings.HasPrefix(target, ":") {
+			problems = append(problems, fmt.Sprintf("invalid watched target %s, expected a host or a port", target))
+		}
+	}
+	if len(params.Watch.Targets) > 0 && params.Watch.Silence < params.DisplayRefresh {
+		problems = append(problems, "the silence of watched targets must be at least the report interval")
+	}
+	if params.Lingering.Enabled {
+		if params.Lingering.LongLived <= 0 || params.Lingering.Stale <= 0 {
+			problems = append(problems, "the long-lived age and the stale time of connections must be positive")
+		}
+		if params.Lingering.Expiry <= params.Lingering.Stale {
+			problems = append(problems, "the expiry of connections must be longer than their stale time")
+		}
+		if params.Lingering.MaxTracked < 0 {
+			problems = append(problems, "the maximum number of followed connections cannot be negative")
+		}
+	}
+	if params.ErrorRates.Enabled && (params.ErrorRates.Threshold <= 0 || params.ErrorRates.Threshold > 1) {
+		problems = append(problems, "the error rate threshold must be above 0, and at most 1")
+	}
+	if params.CallQuality.Enabled {
+		if params.CallQuality.Jitter <= 0 {
+			problems = append(problems, "the jitter of degraded calls must be positive")
+		}
+		if params.CallQuality.Loss <= 0 || params.CallQuality.Loss > 1 {
+			problems = append(problems, "the packet loss of degraded calls must be above 0, and at most 1")
+		}
+	}
+	if params.Mail.Spikes && params.Mail.Threshold == 0 {
+		problems = append(problems, "the number of SMTP messages of outbound spikes must be positive")
+	}
+	if params.SSH.BruteForce && (params.SSH.Attempts == 0 || params.SSH.Short <= 0) {
+		problems = append(problems, "the SSH brute force attempts and the duration of short sessions must be positive")
+	}
+	if _, err := analysis.ParseAddresses(params.SSH.Servers); err != nil {
+		problems = append(problems, fmt.Sprintf("expected SSH destinations : %s", err))
+	}
+	if params.NTP.Amplification && params.NTP.Ratio <= 1 {
+		problems = append(problems, "the NTP amplification ratio must be above 1")
+	}
+	if _, err := analysis.ParseAddresses(params.NTP.Servers); err != nil {
+		problems = append(problems, fmt.Sprintf("expected NTP servers : %s", err))
+	}
+	if _, err := analysis.ParseTLSVersion(params.TLSPolicy.MinVersion); err != nil {
+		problems = append(problems, fmt.Sprintf("TLS policy : %s", err))
+	}
+	if params.Decryption.Enabled {
+		if params.Decryption.KeyLog == "" && params.Decryption.Socket == "" {
+			problems = append(problems, "TLS decryption needs a key log file or socket")
+		}
+		if len(params.Decryption.Servers) == 0 {
+			problems = append(problems, "TLS decryption needs the services whose traffic is decrypted")
+		}
+		if params.Decryption.Refresh <= 0 {
+			problems = append(problems, "the period at which the key log is read must be positive")
+		}
+	}
+	if _, err := analysis.ParseAddresses(params.Decryption.Servers); err != nil {
+		problems = append(problems, fmt.Sprintf("TLS decryption services : %s", err))
+	}
+	if params.Stall.Timeout <= 0 || params.Stall.ZeroWindows == 0 {
+		problems = append(problems, "the TCP stall timeout and the zero windows of reported connections must be positive")
+	}
+	if params.ARP.Enabled && params.ARP.Window <= 0 {
+		problems = append(problems, "the window of ARP conflicts must be positive")
+	}
+	if _, err := analysis.ParseAddresses(params.ARP.Gateways); err != nil {
+		problems = append(problems, fmt.Sprintf("ARP gateways : %s", err))
+	}
+	if params.Docker.Enabled {
+		if _, err := os.Stat(params.Docker.Socket); err != nil {
+			problems = append(problems, fmt.Sprintf("docker socket : %s", err))
+		}
+		if params.Docker.Refresh <= 0 {
+			problems = append(problems, "the period at which docker containers are listed must be positive")
+		}
+		if params.Docker.Timeout <= 0 {
+			problems = append(problems, "the timeout of the docker engine API must be positive")
+		}
+	}
+	if params.Kubernetes.Enabled {
+		if _, err := kubernetes.NewDirectory(&params.Kubernetes); err != nil {
+			problems = append(problems, fmt.Sprintf("kubernetes : %s", err))
+		}
+		if params.Kubernetes.TokenFile != "" {
+			if _, err := os.Stat(params.Kubernetes.TokenFile); err != nil {
+				problems = append(problems, fmt.Sprintf("kubernetes token : %s", err))
+			}
+		}
+		if params.Kubernetes.Resync <= 0 {
+			problems = append(problems, "the period at which kubernetes watches are renewed must be positive")
+		}
+		if params.Kubernetes.Timeout <= 0 {
+			problems = append(problems, "the timeout of kubernetes list requests must be positive")
+		}
+	}
+	if params.Processes.Enabled {
+		if runtime.GOOS != "linux" {
+			problems = append(problems, "attributing traffic to processes is only supported on linux")
+		}
+		if capt.Namespace != "" {
+			problems = append(problems, "processes are only attributed in the network namespace gonetmon runs in")
+		}
+		if params.Processes.Refresh <= 0 {
+			problems = append(problems, "the period at which process sockets are listed must be positive")
+		}
+	}
+	problems = append(problems, logging.CheckConfig(params.Log)...)
+	problems = append(problems, logging.CheckRotation("output files", params.FileRotation)...)
+
+	if params.FlightRecorder.MaxDumps < 0 {
+		problems = append(problems, "the maximum number of flight recorder dumps must not be negative")
+	}
+	switch params.FlightRecorder.Format {
+	case config.PcapFormat, config.PcapNGFormat:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown flight recorder dump format : %s", params.FlightRecorder.Format))
+	}
+
+	if params.FlowTable.MaxFlows < 0 || params.FlowTable.MaxMemory < 0 || params.FlowTable.IdleTimeout < 0 {
+		problems = append(problems, "the limits of the flow table must not be negative")
+	}
+
+	// Make third-party analyzers and outputs known, without starting sidecars
+	if err := extension.Load(params); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	problems = append(problems, checkSessions(params)...)
+	for _, session := range sessionParameters(params) {
+		problems = append(problems, checkSession(session)...)
+	}
+
+	if _, err := analysis.NewRollupAggregator(params); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if params.Control.Enabled {
+		if _, _, err := net.SplitHostPort(params.Control.Address); err != nil {
+			problems = append(problems, fmt.Sprintf("control API address : %s", err))
+		}
+		if params.Control.AlertCache <= 0 {
+			problems = append(problems, "the control API alert cache size must be positive")
+		}
+	}
+
+	if params.GRPC.Enabled {
+		if _, _, err := net.SplitHostPort(params.GRPC.Address); err != nil {
+			problems = append(problems, fmt.Sprintf("gRPC API address : %s", err))
+		}
+		if params.GRPC.ClientBufSize == 0 {
+			problems = append(problems, "the gRPC client buffer size must be positive")
+		}
+	}
+
+	switch params.SelfTest {
+	case config.OffSelfTest, config.WarnSelfTest, config.FailSelfTest:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown output self-test mode : %s", params.SelfTest))
+	}
+	if params.Heartbeat < 0 {
+		problems = append(problems, "the heartbeat period must not be negative")
+	}
+
+	problems = append(problems, unknownNames("report section", params.ReportSections, analysis.ReportSections())...)
+	for section := range params.ReportSizes {
+		problems = append(problems, unknownNames("report section with lists", []string{section}, analysis.ReportListSections())...)
+	}
+
+	for _, name := range sessionOutputs(params) {
+		if name == config.AgentOutput {
+			if _, err := output.NewTLSConfig(&params.Agent.TLS); err != nil {
+				problems = append(problems, fmt.Sprintf("agent TLS : %s", err))
+			}
+		}
+	}
+
+	if params.Aggregator.AlertSpan <= 0 {
+		problems = append(problems, "the aggregator alert span must be positive")
+	}
+	if params.Aggregator.TopTalkers < 0 {
+		problems = append(problems, "the number of top talkers of the aggregator must not be negative")
+	}
+
+	if params.Debug.Enabled {
+		if _, _, err := net.SplitHostPort(params.Debug.Address); err != nil {
+			problems = append(problems, fmt.Sprintf("diagnostics server address : %s", err))
+		}
+	}
+
+	return problems
+}
+
+// checkSession returns the problems found in the filters, analyzers and outputs of a monitoring session, prefixed with
+// its name if it has one
+func checkSession(params *config.Parameters) []string {
+	var problems []string
+
+	if err := capture.CheckFilter(params.PacketFilter.Network, params.CaptureConfig.SnapshotLen); err != nil {
+		problems = append(problems, err.Error())
+	} else if params.Storms.Enabled {
+		if err := capture.CheckFilter(params.Storms.Filter(params.PacketFilter.Network), params.CaptureConfig.SnapshotLen); err != nil {
+			problems = append(problems, fmt.Sprintf("filter widened to broadcast and multicast frames : %s", err))
+		}
+	}
+	if params.ARP.Enabled && params.PacketFilter.Network != "" {
+		if err := capture.CheckFilter(params.ARP.Filter(params.PacketFilter.Network), params.CaptureConfig.SnapshotLen); err != nil {
+			problems = append(problems, fmt.Sprintf("filter widened to ARP packets : %s", err))
+		}
+	}
+
+	if len(params.Watch.Targets) > 0 && params.PacketFilter.Network != "" {
+		if err := capture.CheckFilter(params.Watch.Filter(params.PacketFilter.Network), params.CaptureConfig.SnapshotLen); err != nil {
+			problems = append(problems, fmt.Sprintf("filter widened to watched targets : %s", err))
+		}
+	}
+
+	if len(params.Analyzers) == 0 {
+		problems = append(problems, "no analyzer configured")
+	}
+	problems = append(problems, unknownNames("analyzer", params.Analyzers, analysis.RegisteredAnalyzers())...)
+
+	if len(params.Outputs) == 0 {
+		problems = append(problems, "no output configured")
+	}
+	problems = append(problems, unknownNames("output", params.Outputs, output.RegisteredOutputs())...)
+
+	if params.Session != "" {
+		for i := range problems {
+			problems[i] = fmt.Sprintf("session %s : %s", params.Session, problems[i])
+		}
+	}
+
+	return problems
+}
+
+// outputEndpoints returns the remote endpoints of the configured outputs, as URLs or in the host:port form, indexed by
+// output
+func outputEndpoints(params *config.Parameters) map[string][]string {
+	endpoints := make(map[string][]string)
+
+	for _, name := range sessionOutputs(params) {
+		switch name {
+		case config.StatsdOutput, config.GraphiteOutput:
+			endpoints[name] = []string{params.Metrics.Address}
+		case config.OTLPOutput:
+			endpoints[name] = []string{params.OTLP.Endpoint}
+		case config.KafkaOutput:
+			endpoints[name] = params.Kafka.Brokers
+		case config.MQTTOutput:
+			endpoints[name] = []string{params.MQTT.Broker}
+		case config.NATSOutput:
+			endpoints[name] = []string{params.NATS.URL}
+		case config.ElasticsearchOutput:
+			endpoints[name] = []string{params.Elasticsearch.URL}
+		case config.LokiOutput:
+			endpoints[name] = []string{params.Loki.URL}
+		case config.SplunkOutput:
+			endpoints[name] = []string{params.Splunk.URL}
+		case config.ClickHouseOutput:
+			endpoints[name] = []string{params.ClickHouse.URL}
+		case config.AgentOutput:
+			endpoints[name] = []string{params.Agent.URL}
+		case config.SIEMOutput:
+			// An empty network sends to the local syslog daemon
+			if params.SIEM.Network != "" {
+				endpoints[name] = []string{params.SIEM.Address}
+			}
+		}
+	}
+
+	return endpoints
+}
+
+// endpointHost returns the host of an endpoint given as a URL or in the host:port form
+func endpointHost(endpoint string) (string, error) {
+	if strings.Contains(endpoint, "://") {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return "", err
+		}
+		if u.Hostname() == "" {
+			return "", errors.New("missing host")
+		}
+		return u.Hostname(), nil
+	}
+
+	host, _, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return "", err
+	}
+	if host == "" {
+		return "", errors.New("missing host")
+	}
+
+	return host, nil
+}
+
+// checkEndpoints returns the problems found resolving the hosts of the endpoints of the configured outputs. Nothing
+// is connected to.
+func checkEndpoints(params *config.Parameters) []string {
+	var problems []string
+
+	endpoints := outputEndpoints(params)
+	names := make([]string, 0, len(endpoints))
+	for name := range endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, endpoint := range endpoints[name] {
+			host, err := endpointHost(endpoint)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s output endpoint %s : %s", name, endpoint, err))
+				continue
+			}
+			if net.ParseIP(host) != nil {
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+			_, err = net.DefaultResolver.LookupHost(ctx, host)
+			cancel()
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s output endpoint %s : %s", name, endpoint, err))
+			}
+		}
+	}
+
+	return problems
+}
+
+// unknownNames returns a problem for each name that is not among those known
+func unknownNames(kind string, names, known []string) []string {
+	var problems []string
+
+names:
+	for _, name := range names {
+		for _, k := range known {
+			if name == k {
+				continue names
+			}
+		}
+		problems = append(problems, fmt.Sprintf("unknown %s %s, among : %s", kind, name, known))
+	}
+
+	return problems
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Usage of the flag setting the network namespace live capture happens in
+const netnsUsage = "network namespace to find and capture on interfaces in : a name given with ip netns, pid:<PID> for " +
+	"that of a process such as a container, or a path. Requires the cap_sys_admin capability."
+
+// cliCommand is a command of the command line, either running an action or grouping subcommands
+type cliCommand struct {
+	name     string
+	summary  string                    // One line description, listed in the usage of the parent command
+	run      func(args []string) error // Runs the command with the arguments following its name. Nil for groups.
+	commands []*cliCommand             // Subcommands of a group, or of a command, taking precedence over its arguments
+}
+
+// commands returns the command tree of the application
+func commands() *cliCommand {
+	return &cliCommand{
+		name:    "gonetmon",
+		summary: "Monitor HTTP and other application traffic on network interfaces",
+		run:     nil,
+		commands: []*cliCommand{
+			{name: "run", summary: "Capture and monitor live traffic", run: Run, commands: nil},
+			{name: "replay", summary: "Monitor the traffic recorded in pcap or pcapng files", run: Replay, commands: nil},
+			{name: "bench", summary: "Measure the throughput of capture and analysis by replaying a pcap file", run: Bench, commands: nil},
+			{name: "stop", summary: "Stop the instance running in the background", run: Stop, commands: nil},
+			{name: "status", summary: "Tell whether an instance is running in the background", run: Status, commands: nil},
+			{name: "pause", summary: "Pause the capture of the instance running in the background", run: Pause, commands: nil},
+			{name: "resume", summary: "Resume the capture of the instance running in the background", run: Resume, commands: nil},
+			{name: "aggregate", summary: "Merge the reports and alerts forwarded by agents, and serve a dashboard of them", run: Aggregate, commands: nil},
+			{
+				name:    "filter",
+				summary: "Show or replace the capture filters of a running instance, through its control API",
+				run:     Filter,
+				commands: []*cliCommand{
+					{name: "check", summary: "Compile a BPF filter and print its instructions, or locate its error", run: FilterCheck, commands: nil},
+				},
+			},
+			{
+				name:    "devices",
+				summary: "Inspect the network interfaces available for capture",
+				run:     nil,
+				commands: []*cliCommand{
+					{name: "list", summary: "List network interfaces and whether they can be captured on", run: ListDevices, commands: nil},
+				},
+			},
+			{name: "check-config", summary: "Validate the configuration without capturing", run: CheckConfig, commands: nil},
+			{name: "report", summary: "Render a summary of recorded history", run: Summary, commands: nil},
+			{name: "query", summary: "Query a metric of recorded history", run: Query, commands: nil},
+			{name: "hosts", summary: "List the hosts of the inventory", run: Hosts, commands: nil},
+			{name: "version", summary: "Print version information", run: Version, commands: nil},
+		},
+	}
+}
+
+// usage writes the subcommands of a group to w
+func (c *cliCommand) usage(w io.Writer, path string) {
+	fmt.Fprintf(w, "%s\n\nUsage:\n  %s <command> [flags] [arguments]\n\nCommands:\n", c.summary, path)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, sub := range c.commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", sub.name, sub.summary)
+	}
+	_ = tw.Flush()
+
+	fmt.Fprintf(w, "\nRun '%s <command> -h' for the flags of a command.\n", path)
+}
+
+// execute runs the command designated by args, path being the names of c and its parents
+func (c *cliCommand) execute(path string, args []string) error {
+	if c.run != nil {
+		if len(args) > 0 {
+			for _, sub := range c.commands {
+				if sub.name == args[0] {
+					return sub.execute(path+" "+sub.name, args[1:])
+				}
+			}
+		}
+		return c.run(args)
+	}
+
+	if len(args) == 0 {
+		c.usage(os.Stderr, path)
+		return flag.ErrHelp
+	}
+
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		c.usage(os.Stdout, path)
+		return nil
+	}
+
+	for _, sub := range c.commands {
+		if sub.name == args[0] {
+			return sub.execute(path+" "+sub.name, args[1:])
+		}
+	}
+
+	c.usage(os.Stderr, path)
+	return fmt.Errorf("unknown command : %s %s", path, args[0])
+}
+
+// parseInterspersed parses args with flags, allowing flags to follow positional arguments, which it returns. Arguments
+// following -- are all positional.
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+
+		// Parsing stops at the first positional argument, or after a terminating --
+		parsed := len(args) - flags.NArg()
+		if parsed > 0 && args[parsed-1] == "--" {
+			return append(positional, flags.Args()...), nil
+		}
+
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// listValue is a flag holding a comma separated list
+type listValue struct {
+	list *[]string
+}
+
+func (l listValue) String() string {
+	if l.list == nil {
+		return ""
+	}
+	return strings.Join(*l.list, ",")
+}
+
+func (l listValue) Set(s string) error {
+	*l.list = nil
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			*l.list = append(*l.list, e)
+		}
+	}
+
+	if len(*l.list) == 0 {
+		return errors.New("empty list")
+	}
+
+	return nil
+}
+
+// speedValue is a flag holding a replay speed, as a factor optionally suffixed with x, e.g. 10x
+type speedValue struct {
+	speed *float64
+}
+
+func (s speedValue) String() string {
+	if s.speed == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*s.speed, 'g', -1, 64) + "x"
+}
+
+func (s speedValue) Set(v string) error {
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(v, "x"), 64)
+	if err != nil || speed <= 0 || math.IsInf(speed, 0) {
+		return errors.New("expected a positive factor, e.g. 10x")
+	}
+	*s.speed = speed
+
+	return nil
+}
+
+// zoneValue is a flag holding a time zone, by name, e.g. UTC or Europe/Paris
+type zoneValue struct {
+	zone **time.Location
+}
+
+func (z zoneValue) String() string {
+	if z.zone == nil || *z.zone == nil {
+		return ""
+	}
+	return (*z.zone).String()
+}
+
+func (z zoneValue) Set(name string) error {
+	zone, err := config.LoadTimeZone(name)
+	if err != nil {
+		return err
+	}
+	*z.zone = zone
+
+	return nil
+}
+
+// groupValue is a flag adding a group of networks each time it is set, as <name>=<network>,<network>...
+type groupValue struct {
+	groups *[]config.GroupConfig
+}
+
+func (g groupValue) String() string {
+	if g.groups == nil {
+		return ""
+	}
+
+	names := make([]string, len(*g.groups))
+	for i, group := range *g.groups {
+		names[i] = group.Name
+	}
+
+	return strings.Join(names, ",")
+}
+
+func (g groupValue) Set(spec string) error {
+	i := strings.Index(spec, "=")
+	if i <= 0 {
+		return errors.New("expected <name>=<network>,<network>...")
+	}
+
+	group := config.GroupConfig{Name: strings.TrimSpace(spec[:i]), Networks: nil}
+	if err := (listValue{&group.Networks}).Set(spec[i+1:]); err != nil {
+		return err
+	}
+	*g.groups = append(*g.groups, group)
+
+	return nil
+}
+
+// capacityValue is a flag adding the capacity of a link each time it is set, as <interface>=<bits per second>, the
+// rate optionally suffixed with K, M, G or T, e.g. eth0=1G
+type capacityValue struct {
+	links *map[string]float64
+}
+
+// Multipliers of the suffixes of link capacities
+var capacityUnits = map[string]float64{"K": 1e3, "M": 1e6, "G": 1e9, "T": 1e12}
+
+func (c capacityValue) String() string {
+	if c.links == nil {
+		return ""
+	}
+
+	links := make([]string, 0, len(*c.links))
+	for link, capacity := range *c.links {
+		links = append(links, fmt.Sprintf("%s=%g", link, capacity))
+	}
+	sort.Strings(links)
+
+	return strings.Join(links, ",")
+}
+
+func (c capacityValue) Set(spec string) error {
+	i := strings.Index(spec, "=")
+	if i <= 0 {
+		return errors.New("expected <interface>=<bits per second>, e.g. eth0=1G")
+	}
+
+	rate, multiplier := strings.TrimSpace(spec[i+1:]), 1.0
+	if len(rate) > 0 {
+		if m, ok := capacityUnits[strings.ToUpper(rate[len(rate)-1:])]; ok {
+			rate, multiplier = rate[:len(rate)-1], m
+		}
+	}
+	capacity, err := strconv.ParseFloat(rate, 64)
+	if err != nil || capacity <= 0 || math.IsInf(capacity, 0) {
+		return errors.New("expected a positive capacity in bits per second, e.g. eth0=1G")
+	}
+
+	if *c.links == nil {
+		*c.links = make(map[string]float64)
+	}
+	(*c.links)[strings.TrimSpace(spec[:i])] = capacity * multiplier
+
+	return nil
+}
+
+// sizesValue is a flag holding a comma separated list of sizes by name, as <name>=<size>, e.g. flows=100,paths=5
+type sizesValue struct {
+	sizes *map[string]int
+}
+
+func (v sizesValue) String() string {
+	if v.sizes == nil {
+		return ""
+	}
+
+	sizes := make([]string, 0, len(*v.sizes))
+	for name, size := range *v.sizes {
+		sizes = append(sizes, name+"="+strconv.Itoa(size))
+	}
+	sort.Strings(sizes)
+
+	return strings.Join(sizes, ",")
+}
+
+func (v sizesValue) Set(s string) error {
+	var specs []string
+	if err := (listValue{&specs}).Set(s); err != nil {
+		return err
+	}
+
+	*v.sizes = make(map[string]int, len(specs))
+	for _, spec := range specs {
+		i := strings.Index(spec, "=")
+		if i <= 0 {
+			return errors.New("expected <name>=<size>, e.g. flows=100")
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(spec[i+1:]))
+		if err != nil || size < 0 {
+			return fmt.Errorf("invalid size %q, expected a number", spec[i+1:])
+		}
+		(*v.sizes)[strings.TrimSpace(spec[:i])] = size
+	}
+
+	return nil
+}
+
+// changeValue is a flag adding a rate-of-change rule each time it is set, as <metric>=<factor>x/<lookback>, optionally
+// followed by /<minimum>, e.g. hits=2x/1m
+type changeValue struct {
+	rules *[]config.ChangeRule
+}
+
+func (c changeValue) String() string {
+	if c.rules == nil {
+		return ""
+	}
+
+	rules := make([]string, len(*c.rules))
+	for i, rule := range *c.rules {
+		rules[i] = fmt.Sprintf("%s=%gx/%s", rule.Metric, rule.Factor, rule.Lookback)
+		if rule.Minimum != 0 {
+			rules[i] += fmt.Sprintf("/%g", rule.Minimum)
+		}
+	}
+
+	return strings.Join(rules, ",")
+}
+
+func (c changeValue) Set(spec string) error {
+	i := strings.Index(spec, "=")
+	fields := strings.Split(spec[i+1:], "/")
+	if i <= 0 || len(fields) < 2 || len(fields) > 3 {
+		return errors.New("expected <metric>=<factor>x/<lookback>[/<minimum>], e.g. hits=2x/1m")
+	}
+
+	rule := config.ChangeRule{Metric: strings.TrimSpace(spec[:i]), Factor: 0, Lookback: 0, Minimum: 0}
+	factor, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(fields[0]), "x"), 64)
+	if err != nil || factor <= 0 || math.IsInf(factor, 0) {
+		return errors.New("expected a positive factor, e.g. 2x")
+	}
+	lookback, err := time.ParseDuration(strings.TrimSpace(fields[1]))
+	if err != nil {
+		return fmt.Errorf("invalid lookback : %s", err)
+	}
+	rule.Factor, rule.Lookback = factor, lookback
+	if len(fields) == 3 {
+		if rule.Minimum, err = strconv.ParseFloat(strings.TrimSpace(fields[2]), 64); err != nil {
+			return fmt.Errorf("invalid minimum : %s", err)
+		}
+	}
+	*c.rules = append(*c.rules, rule)
+
+	return nil
+}
+
+// monitorFlags registers on flags the options overriding the parameters of monitoring. If live is true, options
+// selecting the capture backend and interfaces are registered too. The returned function applies the options that
+// are not set directly, once flags are parsed.
+func monitorFlags(flags *flag.FlagSet, params *config.Parameters, live bool) func() {
+	flags.StringVar(&params.PacketFilter.Network, "filter", params.PacketFilter.Network, "BPF filter of captured packets")
+	flags.Var(listValue{&params.Analyzers}, "analyzers", "comma separated analyzers to enable")
+	flags.Var(listValue{&params.Outputs}, "outputs", "comma separated outputs to send reports and alerts to")
+	flags.StringVar(&params.CaptureConfig.Backpressure, "backpressure", params.CaptureConfig.Backpressure, "what capture does when analysis falls behind : block, drop-newest or drop-oldest")
+	flags.IntVar(&params.CaptureConfig.BatchSize, "batch-size", params.CaptureConfig.BatchSize, "maximum number of packets sent to analysis at once")
+	flags.DurationVar(&params.CaptureConfig.BatchTimeout, "batch-timeout", params.CaptureConfig.BatchTimeout, "maximum time a packet waits for its batch to fill")
+	flags.IntVar(&params.AnalysisWorkers, "workers", params.AnalysisWorkers, "number of workers analysing packets in parallel")
+	flags.IntVar(&params.FlowTable.MaxFlows, "max-flows", params.FlowTable.MaxFlows, "maximum number of flows tracked at once, 0 for no limit")
+	flags.DurationVar(&params.FlowTable.IdleTimeout, "flow-idle-timeout", params.FlowTable.IdleTimeout, "time after which idle flows are evicted, 0 to keep them until the end of the report window")
+	flags.BoolVar(&params.Inventory.Enabled, "inventory", params.Inventory.Enabled, "record the hosts of the inventoried networks to the inventory file, listed by gonetmon hosts")
+	flags.StringVar(&params.Inventory.File, "inventory-file", params.Inventory.File, "path of the file the host inventory is kept in")
+	flags.Var(listValue{&params.Inventory.Networks}, "inventory-networks", "comma separated networks whose hosts are inventoried, in CIDR notation, instead of private and link-local ones")
+	flags.StringVar(&params.Inventory.Vendors, "inventory-vendors", params.Inventory.Vendors, "Wireshark manuf or IEEE oui.txt file naming the vendors of hardware addresses")
+	flags.BoolVar(&params.Inventory.AlertNew, "inventory-alerts", params.Inventory.AlertNew, "alert of hosts never seen before")
+	flags.BoolVar(&params.Capacity.Enabled, "capacity", params.Capacity.Enabled, "keep the daily peak bandwidth of interfaces in the trends file, and alert of links forecast to reach their capacity")
+	flags.StringVar(&params.Capacity.File, "capacity-file", params.Capacity.File, "path of the file the bandwidth trends are kept in")
+	flags.Var(capacityValue{&params.Capacity.Links}, "link-capacity", "capacity of a link forecast, as <interface>=<bits per second>, e.g. eth0=1G. Repeat for several links.")
+	flags.IntVar(&params.Capacity.Horizon, "capacity-horizon", params.Capacity.Horizon, "days ahead within which a link forecast to reach its capacity raises an alert")
+	flags.IntVar(&params.Capacity.History, "capacity-history", params.Capacity.History, "days of bandwidth trends kept")
+	flags.IntVar(&params.Capacity.MinDays, "capacity-min-days", params.Capacity.MinDays, "days of bandwidth trends a link must have to be forecast")
+	flags.BoolVar(&params.Storms.Enabled, "storms", params.Storms.Enabled, "let broadcast and multicast frames through the filters, and alert of storms on interfaces")
+	flags.UintVar(&params.Storms.Broadcast, "storm-broadcast", params.Storms.Broadcast, "broadcast frames per second on an interface over a report window that raise an alert, 0 to ignore broadcasts")
+	flags.UintVar(&params.Storms.Multicast, "storm-multicast", params.Storms.Multicast, "multicast frames per second on an interface over a report window that raise an alert, 0 to ignore multicasts")
+	flags.BoolVar(&params.DSCP, "dscp", params.DSCP, "break the traffic of interfaces down by DSCP class, to check QoS markings on the wire against policy")
+	flags.Var(groupValue{&params.Matrix.Groups}, "cidr-group", "group of networks the traffic is accounted between in reports, as <name>=<network>,<network>..., e.g. dmz=10.1.0.0/16. Repeat to define several groups.")
+	flags.StringVar(&params.Matrix.Others, "cidr-others", params.Matrix.Others, "group of the addresses in none of the CIDR groups")
+	flags.BoolVar(&params.Integrity.Checksums, "verify-checksums", params.Integrity.Checksums, "verify the checksums of IPv4 headers and of TCP and UDP segments, which needs checksum offloading and GRO off on the interfaces")
+	flags.BoolVar(&params.Integrity.Enabled, "corruption", params.Integrity.Enabled, "alert of interfaces whose share of corrupt packets, failing checksums, truncated or malformed, suggests a bad NIC or cable")
+	flags.Float64Var(&params.Integrity.Threshold, "corruption-rate", params.Integrity.Threshold, "share of corrupt packets captured on an interface over a report window that raises an alert, between 0 and 1")
+	flags.UintVar(&params.Integrity.MinPackets, "corruption-min", params.Integrity.MinPackets, "packets an interface must have captured over a report window for its corruption rate to be judged")
+	flags.BoolVar(&params.Uploads.Enabled, "uploads", params.Uploads.Enabled, "alert of internal hosts sending large amounts of data to external destinations")
+	flags.Uint64Var(&params.Uploads.Threshold, "upload-threshold", params.Uploads.Threshold, "bytes an internal host sends to an external destination within the upload span that raise an alert")
+	flags.DurationVar(&params.Uploads.Span, "upload-span", params.Uploads.Span, "period over which the bytes sent to each external destination are summed")
+	flags.Var(listValue{&params.Uploads.Internal}, "upload-internal", "comma separated addresses and networks of internal hosts, instead of private and link-local ones")
+	flags.Var(listValue{&params.Uploads.Allowed}, "upload-allowed", "comma separated addresses and networks uploads are allowed to, e.g. backup targets")
+	flags.Var(changeValue{&params.Changes}, "change-alert", "rule alerting of a metric of reports, among hits, bytes, packets and flows, changing by a factor within a lookback, as <metric>=<factor>x/<lookback>[/<minimum>], e.g. hits=2x/1m for hits doubling within a minute, or bytes=0.5x/5m/1e6 for bytes halving from at least 1e6. Repeat to define several rules.")
+	flags.BoolVar(&params.Countries.Enabled, "country-alerts", params.Countries.Enabled, "alert of internal hosts exchanging traffic with addresses of the alert countries, told by the GeoIP database")
+	flags.StringVar(&params.Countries.Database, "geoip-database", params.Countries.Database, "CSV file of the countries of ranges of addresses, as <first>,<last>,<country> or <network>,<country> lines, e.g. the DB-IP country lite database")
+	flags.Var(listValue{&params.Countries.Countries}, "alert-countries", "comma separated ISO 3166 codes of the countries traffic with raises an alert, e.g. KP,IR")
+	flags.Uint64Var(&params.Countries.Threshold, "country-threshold", params.Countries.Threshold, "bytes an internal host exchanges with an address of the alert countries over a report window that raise an alert")
+	flags.Var(listValue{&params.Countries.Internal}, "country-internal", "comma separated addresses and networks of internal hosts, instead of private and link-local ones")
+	flags.Var(listValue{&params.Countries.Allowed}, "country-allowed", "comma separated addresses and networks never alerted of whatever their country, e.g. of CDNs")
+	flags.Var(listValue{&params.Watch.Targets}, "watch", "comma separated critical targets watched closely whatever the filters, as host, host:port, [IPv6]:port or :port, hosts being addresses or hostnames, each with its own counters and handshake latency, and alerts of going silent or unreachable")
+	flags.DurationVar(&params.Watch.Silence, "watch-silence", params.Watch.Silence, "time without traffic of a watched target past which it raises an alert")
+	flags.BoolVar(&params.Lingering.Enabled, "lingering", params.Lingering.Enabled, "follow connections across reports, and report long-lived and stale ones")
+	flags.DurationVar(&params.Lingering.LongLived, "long-lived", params.Lingering.LongLived, "age past which open connections are reported as long-lived")
+	flags.DurationVar(&params.Lingering.Stale, "stale-after", params.Lingering.Stale, "idle time past which TCP connections not closed are reported as stale")
+	flags.DurationVar(&params.Lingering.Expiry, "lingering-expiry", params.Lingering.Expiry, "idle time past which connections are forgotten, stale ones included")
+	flags.IntVar(&params.Lingering.MaxTracked, "max-lingering", params.Lingering.MaxTracked, "maximum number of connections followed at once, 0 for no limit")
+	flags.BoolVar(&params.ErrorRates.Enabled, "error-rates", params.ErrorRates.Enabled, "alert of HTTP hosts whose share of 4xx and 5xx responses spikes")
+	flags.Float64Var(&params.ErrorRates.Threshold, "error-rate", params.ErrorRates.Threshold, "share of 4xx and 5xx responses of a host over a report window that raises an alert, between 0 and 1")
+	flags.UintVar(&params.ErrorRates.MinResponses, "error-rate-min", params.ErrorRates.MinResponses, "responses a host must have sent over a report window for its error rate to be judged")
+	flags.BoolVar(&params.CallQuality.Enabled, "call-quality", params.CallQuality.Enabled, "alert of VoIP calls whose jitter or packet loss degrade, followed by the voip analyzer")
+	flags.DurationVar(&params.CallQuality.Jitter, "call-jitter", params.CallQuality.Jitter, "interarrival jitter of a stream of a call over a report window that raises an alert")
+	flags.Float64Var(&params.CallQuality.Loss, "call-loss", params.CallQuality.Loss, "share of the RTP packets of a call lost over a report window that raises an alert, between 0 and 1")
+	flags.UintVar(&params.CallQuality.MinPackets, "call-min-packets", params.CallQuality.MinPackets, "RTP packets a call must have received over a report window for its quality to be judged")
+	flags.BoolVar(&params.Mail.Spikes, "smtp-spikes", params.Mail.Spikes, "alert of hosts relaying many SMTP messages to external servers, followed by the mail analyzer")
+	flags.UintVar(&params.Mail.Threshold, "smtp-spike", params.Mail.Threshold, "SMTP messages a host relays to external servers over a report window that raise an alert")
+	flags.BoolVar(&params.Mail.Downgrades, "starttls-downgrades", params.Mail.Downgrades, "send a notice of each mail session downgraded from STARTTLS, followed by the mail analyzer")
+	flags.BoolVar(&params.SSH.BruteForce, "ssh-brute-force", params.SSH.BruteForce, "alert of clients opening many short SSH sessions to a server, followed by the ssh analyzer")
+	flags.UintVar(&params.SSH.Attempts, "ssh-attempts", params.SSH.Attempts, "short SSH sessions of a client to a server over a report window that raise an alert")
+	flags.DurationVar(&params.SSH.Short, "ssh-short", params.SSH.Short, "duration under which closed SSH sessions are taken for failed logins")
+	flags.Var(listValue{&params.SSH.Servers}, "ssh-servers", "comma separated addresses and networks of the expected SSH destinations, sessions to others raising an alert")
+	flags.Var(listValue{&params.NTP.Servers}, "ntp-servers", "comma separated addresses and networks of the expected NTP servers, hosts syncing to others raising an alert, followed by the ntp analyzer")
+	flags.BoolVar(&params.NTP.Amplification, "ntp-amplification", params.NTP.Amplification, "alert of NTP servers sending hosts far more bytes than they were queried with, followed by the ntp analyzer")
+	flags.Float64Var(&params.NTP.Ratio, "ntp-ratio", params.NTP.Ratio, "ratio of the bytes an NTP server sends a host to those it was queried with that raises an alert")
+	flags.Uint64Var(&params.NTP.MinBytes, "ntp-min-bytes", params.NTP.MinBytes, "bytes an NTP server must have sent a host over a report window for their ratio to be judged")
+	flags.BoolVar(&params.ARP.Enabled, "arp-watch", params.ARP.Enabled, "let ARP packets through the filters, and raise a critical alert of IP addresses claimed by several hardware addresses, followed by the arp analyzer")
+	flags.DurationVar(&params.ARP.Window, "arp-window", params.ARP.Window, "time frame within which an IP address claimed by another hardware address raises an alert")
+	flags.Var(listValue{&params.ARP.Gateways}, "arp-gateways", "comma separated addresses of the gateways, whose hardware address changing at any time raises a critical alert")
+	flags.BoolVar(&params.TLSPolicy.Enabled, "tls-policy", params.TLSPolicy.Enabled, "alert of TLS handshakes negotiating a version or a cipher suite the policy forbids, followed by the tls analyzer")
+	flags.StringVar(&params.TLSPolicy.MinVersion, "tls-min-version", params.TLSPolicy.MinVersion, "oldest TLS version servers may negotiate, among 1.0, 1.1, 1.2 and 1.3, empty for any")
+	flags.Var(listValue{&params.TLSPolicy.Ciphers}, "tls-forbidden-ciphers", "comma separated parts of the IANA names of the cipher suites servers may not negotiate, e.g. RC4,3DES")
+	flags.BoolVar(&params.Decryption.Enabled, "tls-decrypt", params.Decryption.Enabled, "decrypt in memory the TLS traffic of the services of --tls-decrypt-servers with the secrets of key logs, for analyzers to read the HTTP it carries")
+	flags.StringVar(&params.Decryption.KeyLog, "tls-keylog", params.Decryption.KeyLog, "path of the key log file TLS secrets are read from as it grows, e.g. that of SSLKEYLOGFILE")
+	flags.StringVar(&params.Decryption.Socket, "tls-keylog-socket", params.Decryption.Socket, "path of a Unix socket to receive key log lines on")
+	flags.Var(listValue{&params.Decryption.Servers}, "tls-decrypt-servers", "comma separated addresses and networks of the services whose TLS traffic is decrypted")
+	flags.DurationVar(&params.Decryption.Refresh, "tls-keylog-refresh", params.Decryption.Refresh, "period at which the key log file is read for new secrets")
+	flags.DurationVar(&params.Stall.Timeout, "tcp-stall", params.Stall.Timeout, "time without forward progress of the data in flight of a TCP connection, or of its zero window, past which it is reported as stalled, followed by the stall analyzer")
+	flags.UintVar(&params.Stall.ZeroWindows, "tcp-zero-windows", params.Stall.ZeroWindows, "times a TCP receiver closes its window to zero past which its connection is reported")
+	flags.StringVar(&params.Log.Level, "log-level", params.Log.Level, "minimum level of logged messages : debug, info, warning or error")
+	flags.StringVar(&params.Log.Format, "log-format", params.Log.Format, "layout of log lines : text or json")
+	flags.StringVar(&params.Log.Destination, "log-destination", params.Log.Destination, "where logs are written once capture is set up : stderr, file, syslog, journald, or auto for journald when run by systemd and file otherwise")
+	flags.StringVar(&params.Log.File, "log-file", params.Log.File, "path of the log file, for the file destination")
+	flags.StringVar(&params.Agent.URL, "agent-url", params.Agent.URL, "ingestion endpoint of the aggregator the agent output forwards to")
+	flags.StringVar(&params.Agent.Name, "agent-name", params.Agent.Name, "name of this agent in the aggregator, defaults to the host name")
+	flags.StringVar(&params.Agent.Token, "agent-token", params.Agent.Token, "bearer token identifying this agent to the aggregator")
+	flags.StringVar(&params.Agent.TLS.CAFile, "agent-ca", params.Agent.TLS.CAFile, "certificate authorities to verify the aggregator against, instead of the system's")
+	flags.StringVar(&params.Agent.TLS.CertFile, "agent-cert", params.Agent.TLS.CertFile, "client certificate presented to the aggregator")
+	flags.StringVar(&params.Agent.TLS.KeyFile, "agent-key", params.Agent.TLS.KeyFile, "private key of the client certificate")
+	flags.Var(sessionValue{&params.Sessions}, "session", "monitoring session run in its own pipeline, as <name>:<option>=<value>;... overriding filter, application, interfaces, outputs, analyzers, alert-span or alert-threshold. Repeat to run several sessions.")
+	flags.Var(listValue{&params.ReportSections}, "report-sections", "comma separated sections of reports sent to outputs, among sections, interfaces, flows, events, pipeline, processes, systems, new_hosts, discovery, http, streams, calls, mail, ssh, ntp, arp, tls, mtu, tcp, matrix, diff and watch. Outputs exporting flows need the flows section.")
+	flags.Var(sizesValue{&params.ReportSizes}, "report-sizes", "comma separated maximum numbers of entries of the lists of report sections, as <section>=<size>, e.g. flows=100,http=5")
+	flags.DurationVar(&params.Heartbeat, "heartbeat", params.Heartbeat, "period of the heartbeats sent to the statsd, graphite, otlp, kafka, mqtt and nats outputs whatever the traffic, so that the monitor going away is told from a quiet network, 0 to disable them")
+	flags.StringVar(&params.SelfTest, "self-test", params.SelfTest, "self-test of outputs at start, sending a test message through each of them : off, warn of those failing, or fail to start if one does")
+	flags.Var(zoneValue{&params.TimeZone}, "timezone", "time zone of timestamps in all outputs, e.g. UTC or Europe/Paris")
+	flags.StringVar(&params.TimeLayout, "time-layout", params.TimeLayout, "layout of timestamps printed in the console, alerts and summaries, as defined by Go's time package")
+	noColour := flags.Bool("no-color", false, "disable ANSI colours in the console output, e.g. when piping it")
+
+	if live {
+		flags.StringVar(&params.CaptureConfig.Source, "source", params.CaptureConfig.Source, "capture backend : pcap or afpacket")
+		flags.Var(listValue{&params.Interfaces}, "interfaces", "comma separated interfaces to capture on, instead of all those up")
+		flags.StringVar(&params.CaptureConfig.Namespace, "netns", params.CaptureConfig.Namespace, netnsUsage)
+		flags.BoolVar(&params.Docker.Enabled, "docker", params.Docker.Enabled, "attribute flows and top talkers to the Docker containers owning their addresses and veth interfaces")
+		flags.StringVar(&params.Docker.Socket, "docker-socket", params.Docker.Socket, "unix socket of the Docker Engine API")
+		flags.BoolVar(&params.Kubernetes.Enabled, "kubernetes", params.Kubernetes.Enabled, "attribute flows and top talkers to the Kubernetes pods and services owning their addresses, and alerts to the node")
+		flags.StringVar(&params.Kubernetes.APIServer, "kubernetes-api-server", params.Kubernetes.APIServer, "URL of the Kubernetes API server, defaults to the in-cluster address")
+		flags.StringVar(&params.Kubernetes.Node, "kubernetes-node", params.Kubernetes.Node, "node whose pods are watched, defaults to the NODE_NAME variable, else all pods")
+		flags.BoolVar(&params.Processes.Enabled, "processes", params.Processes.Enabled, "attribute flows to the local processes owning their sockets, and report the top processes (linux only)")
+	}
+
+	return func() {
+		if *noColour {
+			params.Colour = false
+		}
+
+		agentTLS := &params.Agent.TLS
+		if strings.HasPrefix(params.Agent.URL, "https://") || agentTLS.CAFile != "" || agentTLS.CertFile != "" {
+			agentTLS.Enabled = true
+		}
+	}
+}
@@ -0,0 +1,70 @@
+//command is a goroutine that allows an operator to interact with the tool through CLI.
+//
+//Implemented Commands :
+//- stop (SIGINT, SIGTERM)
+//- pause capture (SIGUSR1) and resume it (SIGUSR2)
+//- the commands of the operator console, typed on the terminal (see console.go)
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// command handles CLI interactions, and the commands typed on the console if not nil. A stop signal cancels the
+// monitoring through stop, while pause and resume signals apply to the capture of all sessions.
+func command(ctx context.Context, stop context.CancelFunc, devices []*capture.Devices, console *console) error {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(sigs)
+
+	// Nil channels are never ready, leaving only signals without a console
+	var lines <-chan string
+	if console != nil {
+		lines = readLines(os.Stdin)
+		fmt.Fprintln(console.out, "Type 'help' to list commands.")
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("Command terminating.")
+			return nil
+
+		case line, ok := <-lines:
+			if !ok {
+				// The terminal was closed, keep monitoring on signals only
+				lines = nil
+				continue
+			}
+			console.execute(line)
+
+		case sig := <-sigs:
+			log.Info("Command received signal :", sig.String())
+
+			// Pausing keeps capture sources open, so that resuming is immediate
+			switch sig {
+			case syscall.SIGUSR1:
+				for _, d := range devices {
+					d.Pause()
+				}
+				continue
+			case syscall.SIGUSR2:
+				for _, d := range devices {
+					d.Resume()
+				}
+				continue
+			}
+
+			log.SetOutput(io.MultiWriter(os.Stdout, log.Out))
+			log.Info("Logging to both file and console.")
+
+			stop()
+		}
+	}
+}
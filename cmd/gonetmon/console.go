@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/diagnostics"
+	"github.com/bytemare/gonetmon/pkg/output"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Counters shown by the stats command of the console, in that order
+var consoleCounters = []string{
+	"capture.packets",
+	"capture.forwarded",
+	"capture.non_ip",
+	"capture.undecodable",
+	"analysis.packets",
+	"analysis.events",
+	"analysis.reports",
+	"output.messages",
+	"output.dropped",
+}
+
+// console lets an operator inspect and steer monitoring by typing commands on the terminal. It is also a sink, keeping
+// the last report and alert for the commands showing them.
+type console struct {
+	out      io.Writer
+	stop     context.CancelFunc
+	devices  *capture.Devices
+	recorder *capture.FlightRecorder // Nil if disabled
+	watchdog *alert.Watchdog
+	mutex    sync.Mutex
+	report   *analysis.Report // Last report, nil if none yet
+	alert    *alert.Message   // Last alert or recovery, nil if none yet
+}
+
+// consoleCommand is a command of the console
+type consoleCommand struct {
+	name    string
+	args    string // Arguments, listed in help
+	summary string // One line description, listed in help
+	run     func(c *console, args []string) error
+}
+
+// consoleCommands returns the commands of the console, in the order help lists them
+func consoleCommands() []*consoleCommand {
+	return []*consoleCommand{
+		{name: "help", args: "[command]", summary: "List commands, or describe one", run: (*console).help},
+		{name: "stats", args: "", summary: "Show capture statistics and pipeline counters", run: (*console).stats},
+		{name: "top", args: "", summary: "Show the top host and sections of the last report", run: (*console).top},
+		{name: "filters", args: "[network|application <filter>]", summary: "Show the capture filters, or replace one", run: (*console).filters},
+		{name: "threshold", args: "[<hits>]", summary: "Show the alert threshold, or change it", run: (*console).threshold},
+		{name: "pause", args: "", summary: "Stop analysing captured packets", run: (*console).pause},
+		{name: "resume", args: "", summary: "Analyse captured packets again", run: (*console).resume},
+		{name: "dump", args: "[pcap|pcapng]", summary: "Dump the packets of the flight recorder to a pcap or pcapng file", run: (*console).dump},
+		{name: "stop", args: "", summary: "Stop monitoring", run: (*console).quit},
+	}
+}
+
+// newConsole returns a console writing to out, steering devices, recorder and watchdog, or nil if there is no
+// operator to type commands, i.e. stdin is not a terminal or the process is a daemon
+func newConsole(out io.Writer, stop context.CancelFunc, devices *capture.Devices, recorder *capture.FlightRecorder, watchdog *alert.Watchdog) *console {
+	if isDaemon() {
+		return nil
+	}
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+
+	return &console{
+		out:      out,
+		stop:     stop,
+		devices:  devices,
+		recorder: recorder,
+		watchdog: watchdog,
+		mutex:    sync.Mutex{},
+		report:   nil,
+		alert:    nil,
+	}
+}
+
+// Name names the console in logs
+func (c *console) Name() string {
+	return "operator console"
+}
+
+// SendReport keeps the report for the top command
+func (c *console) SendReport(r *analysis.Report) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.report = r
+	return nil
+}
+
+// SendAlert keeps the alert for the stats command
+func (c *console) SendAlert(a *alert.Message) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.alert = a
+	return nil
+}
+
+// Close has nothing to release for the console
+func (c *console) Close() error {
+	return nil
+}
+
+// readLines sends the lines read from r on the returned channel, which is closed once r is exhausted
+func readLines(r io.Reader) <-chan string {
+	lines := make(chan string)
+
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	return lines
+}
+
+// execute runs the command typed on line. Commands may be abbreviated to any prefix designating a single one.
+func (c *console) execute(line string) {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return
+	}
+
+	cmd, err := lookupCommand(args[0])
+	if err == nil {
+		err = cmd.run(c, args[1:])
+	}
+	if err != nil {
+		fmt.Fprintln(c.out, err)
+	}
+}
+
+// lookupCommand returns the command whose name is, or only starts with, name
+func lookupCommand(name string) (*consoleCommand, error) {
+	var matches []*consoleCommand
+	for _, cmd := range consoleCommands() {
+		if cmd.name == name {
+			return cmd, nil
+		}
+		if strings.HasPrefix(cmd.name, name) {
+			matches = append(matches, cmd)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("unknown command : %s, type 'help' to list commands", name)
+	case 1:
+		return matches[0], nil
+	}
+
+	names := make([]string, len(matches))
+	for i, cmd := range matches {
+		names[i] = cmd.name
+	}
+
+	return nil, fmt.Errorf("ambiguous command : %s, could be %s", name, strings.Join(names, ", "))
+}
+
+// help lists the commands, or describes the one in args
+func (c *console) help(args []string) error {
+	commands := consoleCommands()
+	if len(args) > 0 {
+		cmd, err := lookupCommand(args[0])
+		if err != nil {
+			return err
+		}
+		commands = []*consoleCommand{cmd}
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 8, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s %s\t%s\n", cmd.name, cmd.args, cmd.summary)
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(w, "Commands may be abbreviated, e.g. 'th 50' for 'threshold 50'.")
+	}
+
+	return w.Flush()
+}
+
+// stats shows the statistics of the capture sources, the state of the alert and the counters of the pipeline
+func (c *console) stats(args []string) error {
+	stats := c.devices.Stats()
+
+	w := tabwriter.NewWriter(c.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "Interface\tCapturing\tLast packet\tReceived\tDropped by source\tDropped by backpressure")
+	for _, h := range c.devices.Health() {
+		last := "never"
+		if !h.LastPacket.IsZero() {
+			last = time.Since(h.LastPacket).Round(time.Millisecond).String() + " ago"
+		}
+		received, dropped := "-", "-"
+		if s, ok := stats[h.Name]; ok {
+			received, dropped = strconv.FormatUint(s.Received, 10), strconv.FormatUint(s.Dropped, 10)
+		}
+		fmt.Fprintf(w, "%s\t%t\t%s\t%s\t%s\t%d\n", h.Name, h.Capturing, last, received, dropped, h.Dropped)
+	}
+	fmt.Fprintln(w)
+
+	filter := c.devices.Filter()
+	state := "analysing"
+	if c.devices.Paused() {
+		state = "paused"
+	}
+	fmt.Fprintf(w, "Capture\t%s\n", state)
+	fmt.Fprintf(w, "Network filter\t%s\n", filter.Network)
+	fmt.Fprintf(w, "Application filter\t%s\n", filter.Application)
+	fmt.Fprintf(w, "Alert threshold\t%d hits\n", c.watchdog.Threshold())
+
+	c.mutex.Lock()
+	if c.alert != nil {
+		fmt.Fprintf(w, "Last alert\t%s\n", c.alert.Body)
+	}
+	c.mutex.Unlock()
+	fmt.Fprintln(w)
+
+	for _, name := range consoleCounters {
+		if counter := diagnostics.LookupCounter(name); counter != nil {
+			fmt.Fprintf(w, "%s\t%d\n", name, counter.Value())
+		}
+	}
+
+	return w.Flush()
+}
+
+// top shows the top host and its sections, and the traffic per interface, of the last report
+func (c *console) top(args []string) error {
+	c.mutex.Lock()
+	r := c.report
+	c.mutex.Unlock()
+
+	if r == nil {
+		return errors.New("no report yet")
+	}
+
+	fmt.Fprintf(c.out, "Report of %s - %d hits, %d bytes\n", r.Timestamp.Format(time.RFC3339), r.Hits, r.Bytes)
+	for _, line := range output.ReportLines(r) {
+		fmt.Fprintln(c.out, line)
+	}
+
+	names := make([]string, 0, len(r.Devices))
+	for name := range r.Devices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(c.out, "\t%s\t- %d hits, %d bytes\n", name, r.Devices[name].Hits, r.Devices[name].Bytes)
+	}
+
+	return nil
+}
+
+// filters shows the capture filters, or replaces the network or application one with the rest of args
+func (c *console) filters(args []string) error {
+	filter := c.devices.Filter()
+
+	if len(args) > 0 {
+		value := strings.Join(args[1:], " ")
+		switch args[0] {
+		case "network":
+			filter.Network = value
+		case "application":
+			filter.Application = value
+		default:
+			return fmt.Errorf("unknown filter : %s, expected network or application", args[0])
+		}
+
+		if err := c.devices.SetFilter(filter); err != nil {
+			return fmt.Errorf("filters were not changed : %s", err)
+		}
+	}
+
+	fmt.Fprintf(c.out, "Network filter     : %s\nApplication filter : %s\n", filter.Network, filter.Application)
+
+	return nil
+}
+
+// threshold shows the alert threshold, or changes it to the number of hits in args
+func (c *console) threshold(args []string) error {
+	if len(args) > 0 {
+		hits, err := strconv.ParseUint(args[0], 10, 0)
+		if err != nil || hits == 0 {
+			return fmt.Errorf("invalid threshold : %s, expected a positive number of hits", args[0])
+		}
+
+		c.watchdog.SetThreshold(uint(hits))
+		log.Info("Alert threshold set to ", hits, " hits from the console.")
+	}
+
+	fmt.Fprintf(c.out, "Alert threshold : %d hits\n", c.watchdog.Threshold())
+
+	return nil
+}
+
+// pause stops analysing captured packets
+func (c *console) pause(args []string) error {
+	c.devices.Pause()
+	fmt.Fprintln(c.out, "Capture paused.")
+
+	return nil
+}
+
+// resume analyses captured packets again
+func (c *console) resume(args []string) error {
+	c.devices.Resume()
+	fmt.Fprintln(c.out, "Capture resumed.")
+
+	return nil
+}
+
+// dump writes the packets held by the flight recorder to a file, in the format in args or the configured one
+func (c *console) dump(args []string) error {
+	if c.recorder == nil {
+		return errors.New("flight recorder is disabled, nothing to dump")
+	}
+
+	var path string
+	var err error
+	if len(args) > 0 {
+		path, err = c.recorder.DumpAs(args[0], "manual", "Dump requested from the operator console", nil)
+	} else {
+		path, err = c.recorder.Dump("manual", "Dump requested from the operator console", nil)
+	}
+	if err != nil {
+		return fmt.Errorf("could not dump flight recorder : %s", err)
+	}
+	fmt.Fprintln(c.out, "Flight recorder dumped to", path)
+
+	return nil
+}
+
+// quit stops monitoring
+func (c *console) quit(args []string) error {
+	log.Info("Stop requested from the console.")
+	c.stop()
+
+	return nil
+}
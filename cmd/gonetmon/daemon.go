@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// File the PID of the instance running in the background is written to
+	defPIDFile = "./gonetmon.pid"
+
+	// Environment variable marking the detached process of a daemon, so it does not detach again
+	daemonEnv = "GONETMON_DAEMON"
+
+	// Time a daemon is given to fail on start up before it is considered started
+	daemonStartGrace = time.Second
+
+	// Default time to wait for a stopped instance to exit
+	defStopTimeout = 10 * time.Second
+)
+
+// errNotRunning is returned when no instance is running for a PID file
+var errNotRunning = errors.New("gonetmon is not running")
+
+// isDaemon tells whether the process is the detached process of a daemon
+func isDaemon() bool {
+	return os.Getenv(daemonEnv) != ""
+}
+
+// daemonise runs the command with args again as a detached process in its own session, its output appended to
+// logFile, and writes its PID to pidFile. It fails if an instance is already running for pidFile.
+func daemonise(args []string, pidFile, logFile string) error {
+	if pid, err := runningPID(pidFile); err == nil {
+		return fmt.Errorf("gonetmon is already running with pid %d", pid)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("could not find executable : %s", err)
+	}
+
+	output, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("could not open log file : %s", err)
+	}
+	defer output.Close()
+
+	cmd := exec.Command(executable, args...)
+	cmd.Env = append(os.Environ(), daemonEnv+"=1")
+	cmd.Stdin = nil
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("could not start daemon : %s", err)
+	}
+
+	if err := writePID(pidFile, cmd.Process.Pid); err != nil {
+		_ = cmd.Process.Kill()
+		return err
+	}
+
+	// Report a failure on start up, e.g. missing privileges, instead of leaving the user to find it in the logs
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-exited:
+		removePID(pidFile, cmd.Process.Pid)
+		return fmt.Errorf("daemon exited on start up (%v), see %s", err, logFile)
+	case <-time.After(daemonStartGrace):
+	}
+
+	fmt.Printf("gonetmon started in the background with pid %d, logging to %s\n", cmd.Process.Pid, logFile)
+
+	return nil
+}
+
+// writePID writes pid to pidFile
+func writePID(pidFile string, pid int) error {
+	if err := ioutil.WriteFile(pidFile, []byte(strconv.Itoa(pid)+"\n"), 0644); err != nil {
+		return fmt.Errorf("could not write PID file : %s", err)
+	}
+
+	return nil
+}
+
+// removePID removes pidFile if it holds pid, i.e. if it was not overwritten by another instance
+func removePID(pidFile string, pid int) {
+	if read, err := readPID(pidFile); err == nil && read == pid {
+		if err := os.Remove(pidFile); err != nil {
+			log.Warn("Could not remove PID file : ", err)
+		}
+	}
+}
+
+// readPID returns the PID written in pidFile
+func readPID(pidFile string) (int, error) {
+	content, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return 0, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid PID file %s", pidFile)
+	}
+
+	return pid, nil
+}
+
+// processAlive tells whether a process with pid exists
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// runningPID returns the PID of the instance running for pidFile, or errNotRunning. A stale PID file is removed.
+func runningPID(pidFile string) (int, error) {
+	pid, err := readPID(pidFile)
+	if os.IsNotExist(err) {
+		return 0, errNotRunning
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if !processAlive(pid) {
+		log.Info("Removing stale PID file ", pidFile)
+		_ = os.Remove(pidFile)
+		return 0, errNotRunning
+	}
+
+	return pid, nil
+}
+
+// Stop implements the stop command, asking the instance running in the background to stop and waiting for it to exit
+func Stop(args []string) error {
+	flags := flag.NewFlagSet("gonetmon stop", flag.ContinueOnError)
+	pidFile := flags.String("pid-file", defPIDFile, "PID file written by run --daemon")
+	timeout := flags.Duration("timeout", defStopTimeout, "time to wait for the instance to exit")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	pid, err := runningPID(*pidFile)
+	if err != nil {
+		return err
+	}
+
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		return fmt.Errorf("could not signal pid %d : %s", pid, err)
+	}
+
+	deadline := time.Now().Add(*timeout)
+	for processAlive(pid) {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("gonetmon with pid %d did not exit within %s", pid, *timeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	_ = os.Remove(*pidFile)
+	fmt.Printf("gonetmon with pid %d stopped\n", pid)
+
+	return nil
+}
+
+// Status implements the status command, telling whether an instance is running in the background
+func Status(args []string) error {
+	flags := flag.NewFlagSet("gonetmon status", flag.ContinueOnError)
+	pidFile := flags.String("pid-file", defPIDFile, "PID file written by run --daemon")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	pid, err := runningPID(*pidFile)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("gonetmon is running with pid %d\n", pid)
+
+	return nil
+}
+
+// Pause implements the pause command, pausing the capture of the instance running in the background
+func Pause(args []string) error {
+	return signalDaemon("gonetmon pause", args, syscall.SIGUSR1, "paused")
+}
+
+// Resume implements the resume command, resuming the capture of the instance running in the background
+func Resume(args []string) error {
+	return signalDaemon("gonetmon resume", args, syscall.SIGUSR2, "resumed")
+}
+
+// signalDaemon sends sig to the instance running in the background, for the command named name
+func signalDaemon(name string, args []string, sig syscall.Signal, done string) error {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	pidFile := flags.String("pid-file", defPIDFile, "PID file written by run --daemon")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	pid, err := runningPID(*pidFile)
+	if err != nil {
+		return err
+	}
+
+	if err := syscall.Kill(pid, sig); err != nil {
+		return fmt.Errorf("could not signal pid %d : %s", pid, err)
+	}
+
+	fmt.Printf("capture of gonetmon with pid %d %s\n", pid, done)
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"net"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// ListDevices implements the devices list command, listing the network interfaces of the machine, or of a network
+// namespace, along with their addresses, flags and link type, and whether capture can be opened on them
+func ListDevices(args []string) error {
+	params := config.LoadParams()
+
+	flags := flag.NewFlagSet("gonetmon devices list", flag.ContinueOnError)
+	up := flags.Bool("up", false, "only list interfaces whose state is up, on which run captures by default")
+	flags.StringVar(&params.CaptureConfig.Namespace, "netns", params.CaptureConfig.Namespace, netnsUsage)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	interfaces, err := capture.ListInterfaces(&params.CaptureConfig)
+	if err != nil {
+		return err
+	}
+
+	denied := false
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tFLAGS\tLINK\tADDRESSES\tCAPTURE")
+	for _, i := range interfaces {
+		if *up && i.Flags&net.FlagUp == 0 {
+			continue
+		}
+
+		link, status := i.LinkType, "ok"
+		if i.Err != nil {
+			link, status = "-", i.Err.Error()
+			denied = true
+		}
+
+		addresses := "-"
+		if len(i.Addresses) != 0 {
+			addresses = strings.Join(i.Addresses, ",")
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", i.Name, i.Flags, link, addresses, status)
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if denied && os.Geteuid() != 0 {
+		fmt.Println("\nSome interfaces could not be opened. " + privilegesHint + ".")
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Time to wait for the control API to answer
+const controlTimeout = 10 * time.Second
+
+// filtersJSON is the JSON representation of capture filters exchanged with the control API
+type filtersJSON struct {
+	Network     *string `json:"network,omitempty"`
+	Application *string `json:"application,omitempty"`
+}
+
+// Filter implements the filter command, replacing the capture filters of a running monitor through its control API
+// without restarting capture. Without a filter, it prints the current ones.
+func Filter(args []string) error {
+	params := config.LoadParams()
+
+	flags := flag.NewFlagSet("gonetmon filter", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: gonetmon filter [flags] [<BPF filter>]\n       gonetmon filter check [flags] <BPF filter>")
+		flags.PrintDefaults()
+	}
+	address := flags.String("address", params.Control.Address, "address of the control API of the running monitor")
+	token := flags.String("token", "", "bearer token of the control API")
+	application := flags.String("application", "", "string to look for in the application layer of packets")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return fmt.Errorf("unexpected arguments : %s", flags.Args()[1:])
+	}
+
+	// Filters left out keep their value
+	var request filtersJSON
+	if flags.NArg() == 1 {
+		network := flags.Arg(0)
+		request.Network = &network
+	}
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "application" {
+			request.Application = application
+		}
+	})
+
+	body, err := json.Marshal(&request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "http://"+*address+"/filters", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if *token != "" {
+		req.Header.Set("Authorization", "Bearer "+*token)
+	}
+
+	client := &http.Client{Timeout: controlTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not reach the control API, is it enabled ? %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var answer struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil || answer.Error == "" {
+			return fmt.Errorf("control API answered with status %s", resp.Status)
+		}
+		return fmt.Errorf("filters were not changed : %s", answer.Error)
+	}
+
+	var filters filtersJSON
+	if err := json.NewDecoder(resp.Body).Decode(&filters); err != nil {
+		return fmt.Errorf("malformed answer of the control API : %s", err)
+	}
+
+	network, app := "", ""
+	if filters.Network != nil {
+		network = *filters.Network
+	}
+	if filters.Application != nil {
+		app = *filters.Application
+	}
+	fmt.Printf("Network filter     : %s\nApplication filter : %s\n", network, app)
+
+	return nil
+}
+
+// FilterCheck implements the filter check command, compiling a BPF filter for a link type as capture would, and
+// printing its instructions, or where its error is
+func FilterCheck(args []string) error {
+	params := config.LoadParams()
+
+	flags := flag.NewFlagSet("gonetmon filter check", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: gonetmon filter check [flags] <BPF filter>")
+		flags.PrintDefaults()
+	}
+	linkName := flags.String("link-type", "ethernet", "link type to compile the filter for, among "+
+		strings.Join(capture.LinkTypeNames(), ", "))
+	snapLen := flags.Int("snaplen", int(params.CaptureConfig.SnapshotLen), "maximum size read of each packet")
+	positional, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		flags.Usage()
+		return errors.New("missing BPF filter")
+	}
+
+	linkType, err := capture.ParseLinkType(*linkName)
+	if err != nil {
+		return err
+	}
+	if *snapLen <= 0 {
+		return fmt.Errorf("invalid snaplen %d, must be positive", *snapLen)
+	}
+
+	// Like tcpdump, the words of the filter may be given as separate arguments
+	filter := strings.Join(positional, " ")
+	instructions, err := capture.CompileFilter(filter, linkType, int32(*snapLen))
+	if err != nil {
+		offset := capture.FilterErrorOffset(filter, linkType, int32(*snapLen))
+		fmt.Fprintf(os.Stderr, "%s\n%s^ column %d\n", filter, strings.Repeat(" ", offset), offset+1)
+		return fmt.Errorf("invalid BPF filter : %s", err)
+	}
+
+	fmt.Printf("Filter %q compiles to %d instructions for %s links :\n", filter, len(instructions), *linkName)
+	for _, line := range capture.Disassemble(instructions) {
+		fmt.Println(line)
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/inventory"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Hosts implements the hosts command, listing the hosts recorded to the inventory by monitoring
+func Hosts(args []string) error {
+	flags := flag.NewFlagSet("gonetmon hosts", flag.ContinueOnError)
+	file := flags.String("file", config.DefInventoryFile, "inventory file recorded by monitoring with --inventory")
+	since := flags.Duration("since", 0, "only list hosts seen within this period, e.g. 24h, 0 for all")
+	format := flags.String("format", tableFormat, "output format : table or json")
+	timeZone := flags.String("timezone", "Local", "time zone of timestamps, e.g. UTC or Europe/Paris")
+	timeLayout := flags.String("time-layout", config.DefTimeLayout, "layout of timestamps, as defined by Go's time package")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	zone, err := config.LoadTimeZone(*timeZone)
+	if err != nil {
+		return err
+	}
+
+	hosts, err := inventory.Load(*file)
+	if err != nil {
+		return fmt.Errorf("could not read the host inventory : %s", err)
+	}
+
+	listed := hosts[:0]
+	for _, host := range hosts {
+		if *since == 0 || time.Since(host.LastSeen) <= *since {
+			host.FirstSeen, host.LastSeen = host.FirstSeen.In(zone), host.LastSeen.In(zone)
+			listed = append(listed, host)
+		}
+	}
+
+	switch *format {
+	case tableFormat:
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "IP\tMAC\tVENDOR\tHOSTNAME\tFIRST SEEN\tLAST SEEN\tPROTOCOLS")
+		for _, h := range listed {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", h.IP, orDash(h.MAC), orDash(h.Vendor), orDash(h.Hostname),
+				h.FirstSeen.Format(*timeLayout), h.LastSeen.Format(*timeLayout), orDash(strings.Join(h.Protocols, ",")))
+		}
+		return w.Flush()
+
+	case config.JSONFormat:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(listed)
+	}
+
+	return fmt.Errorf("unknown hosts format : %s", *format)
+}
+
+// orDash returns s, or a dash if it is empty, for table cells
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/control"
+	"github.com/bytemare/gonetmon/pkg/diagnostics"
+	"github.com/bytemare/gonetmon/pkg/extension"
+	"github.com/bytemare/gonetmon/pkg/logging"
+	"github.com/bytemare/gonetmon/pkg/rpc"
+	"github.com/bytemare/gonetmon/pkg/version"
+	"golang.org/x/sync/errgroup"
+	"os"
+	"strings"
+)
+
+const (
+	// Approximate number of packets queued between capture and analysis, in batches
+	packetBacklog = 1000
+
+	// Usage of the flag writing a status line when monitoring ends
+	statusUsage = "write a JSON status line to stdout when monitoring ends, with the name of the exit status, e.g. ok, config_error, permission_error, no_devices or runtime_error, its code and the error, if any"
+
+	// Explains how to be allowed to capture live traffic, when not running as root
+	privilegesHint = "Capturing live traffic requires elevated privileges : try running with sudo, or grant the " +
+		"capabilities with 'sudo setcap cap_net_raw,cap_net_admin=eip <path to gonetmon>'"
+)
+
+var log = config.Logger
+
+// Init initialises Sniffing and Monitoring, capturing as configured in params
+// TODO: Load configuration from file to initialise parameters
+func Init(params *config.Parameters) (*capture.Devices, error) {
+	devices, err := openCapture(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Past this point, log as configured
+	if err := logging.Setup(log, params.Log); err != nil {
+		log.Error("Failed to set up logs, using default stderr : ", err)
+	}
+
+	return devices, nil
+}
+
+// openCapture opens the capture sources configured in params
+func openCapture(params *config.Parameters) (*capture.Devices, error) {
+
+	// Check whether we can capture packets. Capturing live traffic requires root, or the binary to be granted the
+	// cap_net_raw and cap_net_admin capabilities, which is only known by trying to open the interfaces.
+	devices, err := capture.InitialiseCapture(params)
+	switch {
+	case err == nil:
+	case err == capture.ErrNoDevices:
+		return nil, withStatus(exitNoDevices, fmt.Errorf("initialising capture failed : %s", err))
+	case params.CaptureConfig.Source != config.FileSource && os.Geteuid() != 0:
+		return nil, withStatus(exitPermission, fmt.Errorf("initialising capture failed : %s. %s", err, privilegesHint))
+	case err == capture.ErrNoDeviceOpened:
+		return nil, withStatus(exitNoDevices, fmt.Errorf("initialising capture failed : %s", err))
+	default:
+		return nil, withStatus(exitConfig, fmt.Errorf("initialising capture failed : %s", err))
+	}
+
+	return devices, nil
+}
+
+// Run implements the run command, capturing and monitoring live traffic until stopped
+func Run(args []string) error {
+	params := config.LoadParams()
+
+	flags := flag.NewFlagSet("gonetmon run", flag.ContinueOnError)
+	apply := monitorFlags(flags, params, true)
+	daemon := flags.Bool("daemon", false, "detach and run in the background, logging to the log file")
+	pidFile := flags.String("pid-file", defPIDFile, "file the PID is written to when running as a daemon")
+	status := flags.Bool("status-json", false, statusUsage)
+	if err := flags.Parse(args); err != nil {
+		return usageError(err)
+	}
+	if flags.NArg() != 0 {
+		return usageError(fmt.Errorf("unexpected arguments : %s", flags.Args()))
+	}
+	apply()
+
+	if *daemon {
+		if !isDaemon() {
+			return daemonise(append([]string{"run"}, args...), *pidFile, params.Log.File)
+		}
+		defer removePID(*pidFile, os.Getpid())
+	}
+
+	err := monitor(params)
+	if *status {
+		writeStatus(os.Stdout, err)
+	}
+
+	return err
+}
+
+// Replay implements the replay command, monitoring the traffic recorded in pcap or pcapng files at its original pace, sped up,
+// or as fast as possible. Several files are replayed one after another, or merged into a single stream ordered by
+// timestamp. Flags may follow the files.
+func Replay(args []string) error {
+	params := config.LoadParams()
+
+	flags := flag.NewFlagSet("gonetmon replay", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: gonetmon replay [flags] <file.pcap>...")
+		flags.PrintDefaults()
+	}
+	apply := monitorFlags(flags, params, false)
+	flags.Var(speedValue{&params.CaptureConfig.ReplaySpeed}, "speed", "factor by which to speed up the original pace of the capture, e.g. 10x. Reports and alert spans are shortened alike.")
+	fastest := flags.Bool("as-fast-as-possible", false, "replay packets without waiting between them, keeping their original timestamps")
+	flags.BoolVar(&params.CaptureConfig.MergeFiles, "merge-by-timestamp", params.CaptureConfig.MergeFiles, "merge the packets of all files by timestamp, e.g. captures of several interfaces, instead of replaying the files one after another")
+	status := flags.Bool("status-json", false, statusUsage)
+	files, err := parseInterspersed(flags, args)
+	if err != nil {
+		return usageError(err)
+	}
+	if len(files) == 0 {
+		flags.Usage()
+		return usageError(errors.New("replay takes at least one pcap file"))
+	}
+	apply()
+
+	params.CaptureConfig.Source = config.FileSource
+	params.CaptureConfig.Files = files
+	if *fastest {
+		speed := false
+		flags.Visit(func(f *flag.Flag) {
+			speed = speed || f.Name == "speed"
+		})
+		if speed {
+			return usageError(errors.New("--speed and --as-fast-as-possible are mutually exclusive"))
+		}
+		params.CaptureConfig.ReplaySpeed = 0
+	} else if params.CaptureConfig.ReplaySpeed != 1 {
+		params.CompressTime(params.CaptureConfig.ReplaySpeed)
+	}
+
+	err = monitor(params)
+	if *status {
+		writeStatus(os.Stdout, err)
+	}
+
+	return err
+}
+
+// monitor captures as configured in params, and runs analysis and outputs until stopped. Each monitoring session
+// runs its own pipeline, while the control and gRPC APIs and the console steer the first one. Errors tell the exit
+// status of the way monitoring stopped.
+func monitor(params *config.Parameters) error {
+	if problems := checkSessions(params); len(problems) != 0 {
+		return withStatus(exitConfig, errors.New(strings.Join(problems, ", ")))
+	}
+	sessions := sessionParameters(params)
+
+	devices := make([]*capture.Devices, len(sessions))
+	pipelines := make([]*pipeline, len(sessions))
+
+	// Release the devices and pipelines already set up if monitoring fails to start. Once run, capture, analysis and
+	// outputs release them as they stop.
+	started := false
+	defer func() {
+		if started {
+			return
+		}
+		for _, p := range pipelines {
+			if p != nil {
+				p.close()
+			}
+		}
+		for _, d := range devices {
+			if d != nil {
+				d.Close()
+			}
+		}
+	}()
+
+	for i, session := range sessions {
+		var err error
+		if i == 0 {
+			devices[i], err = Init(session)
+		} else {
+			devices[i], err = openCapture(session)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	log.Info("Starting ", version.Get())
+
+	// Load third-party analyzers and outputs
+	if err := extension.Load(params); err != nil {
+		return withStatus(exitConfig, err)
+	}
+
+	for i, session := range sessions {
+		var err error
+		if pipelines[i], err = newPipeline(session, devices[i]); err != nil {
+			return withStatus(exitConfig, err)
+		}
+	}
+	first := pipelines[0]
+
+	// Serve the control API, which receives reports and alerts as an output
+	if params.Control.Enabled {
+		api, err := control.NewAPI(first.params, first.devices, first.recorder)
+		if err != nil {
+			return withStatus(exitConfig, err)
+		}
+		first.sinks = append(first.sinks, api)
+	}
+
+	// Serve the gRPC API, which streams reports and alerts as an output
+	if params.GRPC.Enabled {
+		server, err := rpc.NewServer(first.params, first.devices)
+		if err != nil {
+			return withStatus(exitConfig, err)
+		}
+		first.sinks = append(first.sinks, server)
+	}
+
+	// Cancelling ctx stops all goroutines, as does the failure of any of them
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	group, ctx := errgroup.WithContext(ctx)
+
+	// Take commands from the terminal, if there is an operator at it. The console keeps the last report as an output.
+	console := newConsole(os.Stdout, cancel, first.devices, first.recorder, first.watchdog)
+	if console != nil {
+		first.sinks = append(first.sinks, console)
+	}
+
+	// Serve profiles and counters of the pipeline
+	if params.Debug.Enabled {
+		server, err := diagnostics.NewServer(params)
+		if err != nil {
+			return withStatus(exitConfig, err)
+		}
+		defer server.Close()
+	}
+
+	started = true
+	for _, p := range pipelines {
+		p.run(ctx, group)
+	}
+
+	// Run command
+	group.Go(func() error {
+		return command(ctx, cancel, devices, console)
+	})
+
+	// A replay ends once its files are read, and what they hold went through the pipelines
+	if params.CaptureConfig.Source == config.FileSource {
+		group.Go(func() error {
+			endReplay(ctx, cancel, pipelines)
+			return nil
+		})
+	}
+
+	if len(sessions) > 1 {
+		log.Info("Capturing set up for sessions ", sessionValue{&params.Sessions}.String(), ".")
+	} else {
+		log.Info("Capturing set up.")
+	}
+
+	// Shutdown
+	if err := group.Wait(); err != nil {
+		return withStatus(exitRuntime, fmt.Errorf("monitoring stopped on error : %s", err))
+	}
+	log.Info("Monitoring successfully stopped.")
+
+	return nil
+}
+
+func main() {
+	err := commands().execute("gonetmon", os.Args[1:])
+	if err != nil && err != flag.ErrHelp {
+		log.Error(err)
+	}
+
+	os.Exit(exitStatus(err))
+}
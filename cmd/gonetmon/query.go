@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/output"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// Metrics that can be queried
+	hitsMetric  = "hits"
+	bytesMetric = "bytes"
+	flowsMetric = "flows"
+
+	// Query output formats, in addition to json
+	tableFormat = "table"
+	csvFormat   = "csv"
+)
+
+// Layouts accepted for the bounds of a query, in addition to RFC 3339
+var queryTimeLayouts = []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// queryPoint is the value of a metric in a report
+type queryPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     uint64    `json:"value"`
+}
+
+// parseQueryTime parses a query bound, interpreting it in zone unless it holds its own offset
+func parseQueryTime(s string, zone *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	for _, layout := range queryTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, zone); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("could not parse time %s : use RFC 3339 or YYYY-MM-DD[ HH:MM[:SS]]", s)
+}
+
+// metricValue returns the value of the metric in the report, restricted to an interface if device is not empty.
+// Interfaces without traffic during the report's window are absent from it, and have a value of 0.
+func metricValue(r *output.ReportJSON, metric, device string) uint64 {
+	if device != "" {
+		if metric == hitsMetric {
+			return uint64(r.Interfaces[device].Hits)
+		}
+		return r.Interfaces[device].Bytes
+	}
+
+	switch metric {
+	case hitsMetric:
+		return uint64(r.Hits)
+	case bytesMetric:
+		return r.Bytes
+	default:
+		return uint64(r.Flows)
+	}
+}
+
+// writeQuery writes points to w in the given format, with timestamps in the given zone and layout
+func writeQuery(w io.Writer, points []queryPoint, metric, format string, zone *time.Location, layout string) error {
+	switch format {
+	case tableFormat:
+		table := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(table, "TIMESTAMP\t%s\n", metric)
+		for _, p := range points {
+			fmt.Fprintf(table, "%s\t%d\n", p.Timestamp.In(zone).Format(layout), p.Value)
+		}
+		return table.Flush()
+
+	case csvFormat:
+		records := csv.NewWriter(w)
+		_ = records.Write([]string{"timestamp", metric})
+		for _, p := range points {
+			_ = records.Write([]string{p.Timestamp.In(zone).Format(layout), strconv.FormatUint(p.Value, 10)})
+		}
+		records.Flush()
+		return records.Error()
+
+	case config.JSONFormat:
+		for i := range points {
+			points[i].Timestamp = points[i].Timestamp.In(zone)
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(points)
+	}
+
+	return fmt.Errorf("unknown query format : %s", format)
+}
+
+// Query implements the query command, printing the values of a metric recorded by the sqlite output over a period
+func Query(args []string) error {
+	flags := flag.NewFlagSet("query", flag.ContinueOnError)
+	metric := flags.String("metric", hitsMetric, "metric to query : hits, bytes or flows")
+	since := flags.Duration("since", time.Hour, "period to query, up to now. Ignored if --from is set")
+	from := flags.String("from", "", "start of the period to query, e.g. \"2019-08-11 02:00\"")
+	to := flags.String("to", "", "end of the period to query, defaults to now")
+	device := flags.String("interface", "", "restrict hits and bytes to a network interface")
+	format := flags.String("format", tableFormat, "output format : table, csv or json")
+	database := flags.String("db", config.DefSQLitePath, "database recorded by the sqlite output")
+	timeZone := flags.String("timezone", "Local", "time zone of timestamps, e.g. UTC or Europe/Paris")
+	timeLayout := flags.String("time-layout", config.DefTimeLayout, "layout of timestamps, as defined by Go's time package")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	switch *metric {
+	case hitsMetric, bytesMetric:
+	case flowsMetric:
+		if *device != "" {
+			return errors.New("the flows metric can not be restricted to an interface")
+		}
+	default:
+		return fmt.Errorf("unknown metric : %s", *metric)
+	}
+
+	zone, err := config.LoadTimeZone(*timeZone)
+	if err != nil {
+		return err
+	}
+
+	end := time.Now()
+	if *to != "" {
+		if end, err = parseQueryTime(*to, zone); err != nil {
+			return err
+		}
+	}
+
+	start := end.Add(-*since)
+	if *from != "" {
+		if start, err = parseQueryTime(*from, zone); err != nil {
+			return err
+		}
+	}
+
+	if !start.Before(end) {
+		return errors.New("the queried period must start before it ends")
+	}
+
+	reports, err := output.QueryDatabase(*database, start, end)
+	if err != nil {
+		return err
+	}
+
+	points := make([]queryPoint, 0, len(reports))
+	for i := range reports {
+		points = append(points, queryPoint{Timestamp: reports[i].Timestamp, Value: metricValue(&reports[i], *metric, *device)})
+	}
+
+	return writeQuery(os.Stdout, points, *metric, *format, zone, *timeLayout)
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/diagnostics"
+	"github.com/bytemare/gonetmon/pkg/output"
+	"golang.org/x/sync/errgroup"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Outputs writing to the terminal, a file or a listening address, which two sessions cannot share
+var exclusiveOutputs = []string{
+	config.ConsoleOutput,
+	config.EVEOutput,
+	config.ZeekOutput,
+	config.HistoryOutput,
+	config.SQLiteOutput,
+	config.ServerOutput,
+}
+
+// Period at which the channels of pipelines are checked for being drained, once the files of a replay are analysed
+const drainPoll = 50 * time.Millisecond
+
+// Names of sessions, used in alerts, queue names and dump directories
+var sessionName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// sessionValue is a flag adding a monitoring session each time it is set, from a specification of the form
+// <name>:<option>=<value>;<option>=<value>...
+type sessionValue struct {
+	sessions *[]config.SessionConfig
+}
+
+func (s sessionValue) String() string {
+	if s.sessions == nil {
+		return ""
+	}
+
+	names := make([]string, len(*s.sessions))
+	for i, session := range *s.sessions {
+		names[i] = session.Name
+	}
+
+	return strings.Join(names, ",")
+}
+
+func (s sessionValue) Set(spec string) error {
+	session, err := parseSession(spec)
+	if err != nil {
+		return err
+	}
+	*s.sessions = append(*s.sessions, *session)
+
+	return nil
+}
+
+// parseSession returns the session specified in spec, as <name>:<option>=<value>;<option>=<value>... where options
+// are filter, application, interfaces, outputs, analyzers, alert-span and alert-threshold. Lists are comma separated.
+func parseSession(spec string) (*config.SessionConfig, error) {
+	name, options := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		name, options = spec[:i], spec[i+1:]
+	}
+	if !sessionName.MatchString(name) {
+		return nil, fmt.Errorf("invalid session name %q, expected letters, digits, '-' or '_'", name)
+	}
+
+	session := &config.SessionConfig{
+		Name:           name,
+		Filter:         config.Filter{Network: "", Application: "", Type: ""},
+		Interfaces:     nil,
+		Outputs:        nil,
+		Analyzers:      nil,
+		AlertSpan:      0,
+		AlertThreshold: 0,
+	}
+
+	for _, option := range strings.Split(options, ";") {
+		if option = strings.TrimSpace(option); option == "" {
+			continue
+		}
+
+		kv := strings.SplitN(option, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[1]) == "" {
+			return nil, fmt.Errorf("session %s : expected <option>=<value>, got %q", name, option)
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+
+		var err error
+		switch key {
+		case "filter":
+			session.Filter.Network = value
+		case "application":
+			session.Filter.Application = value
+		case "interfaces":
+			err = listValue{&session.Interfaces}.Set(value)
+		case "outputs":
+			err = listValue{&session.Outputs}.Set(value)
+		case "analyzers":
+			err = listValue{&session.Analyzers}.Set(value)
+		case "alert-span":
+			session.AlertSpan, err = time.ParseDuration(value)
+			if err == nil && session.AlertSpan <= 0 {
+				err = errors.New("must be positive")
+			}
+		case "alert-threshold":
+			var threshold uint64
+			threshold, err = strconv.ParseUint(value, 10, 0)
+			if err == nil && threshold == 0 {
+				err = errors.New("must be positive")
+			}
+			session.AlertThreshold = uint(threshold)
+		default:
+			return nil, fmt.Errorf("session %s : unknown option %s, among filter, application, interfaces, outputs, "+
+				"analyzers, alert-span and alert-threshold", name, key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("session %s : invalid %s %q : %s", name, key, value, err)
+		}
+	}
+
+	return session, nil
+}
+
+// sessionParameters returns the parameters of each monitoring session, or params alone if no session is configured
+func sessionParameters(params *config.Parameters) []*config.Parameters {
+	if len(params.Sessions) == 0 {
+		return []*config.Parameters{params}
+	}
+
+	sessions := make([]*config.Parameters, len(params.Sessions))
+	for i := range params.Sessions {
+		sessions[i] = params.ForSession(&params.Sessions[i])
+	}
+
+	return sessions
+}
+
+// sessionOutputs returns the outputs enabled in any session, in the order they are first configured
+func sessionOutputs(params *config.Parameters) []string {
+	var outputs []string
+	seen := make(map[string]bool)
+
+	for _, session := range sessionParameters(params) {
+		for _, name := range session.Outputs {
+			if !seen[name] {
+				seen[name] = true
+				outputs = append(outputs, name)
+			}
+		}
+	}
+
+	return outputs
+}
+
+// checkSessions returns the problems found in the configuration of monitoring sessions : names must be unique, and
+// outputs writing to the terminal, a file or an address may only be enabled in one session
+func checkSessions(params *config.Parameters) []string {
+	var problems []string
+
+	names := make(map[string]bool)
+	owners := make(map[string]string)
+	for _, session := range sessionParameters(params) {
+		if session.Session == "" {
+			continue
+		}
+		if names[session.Session] {
+			problems = append(problems, fmt.Sprintf("session %s is configured more than once", session.Session))
+			continue
+		}
+		names[session.Session] = true
+
+		for _, name := range session.Outputs {
+			for _, exclusive := range exclusiveOutputs {
+				if name != exclusive {
+					continue
+				}
+				if owner, ok := owners[name]; ok {
+					problems = append(problems, fmt.Sprintf("sessions %s and %s both enable the %s output, which "+
+						"cannot be shared", owner, session.Session, name))
+					continue
+				}
+				owners[name] = session.Session
+			}
+		}
+	}
+
+	return problems
+}
+
+// pipeline is the capture, analysis, alerting and outputs of a monitoring session, isolated from those of other
+// sessions
+type pipeline struct {
+	params     *config.Parameters
+	devices    *capture.Devices
+	sinks      []output.Sink
+	analyzers  [][]analysis.Analyzer
+	recorder   *capture.FlightRecorder // Nil if disabled
+	rollups    *analysis.RollupAggregator
+	watchdog   *alert.Watchdog
+	packetChan chan []capture.PacketMsg
+	reportChan chan *analysis.Report
+	alertChan  chan alert.Message
+	analysed   chan struct{} // Closed once analysis returned, after its last report if capture ended
+}
+
+// newPipeline sets up the analysis and outputs of the session configured in params, fed by devices
+func newPipeline(params *config.Parameters, devices *capture.Devices) (*pipeline, error) {
+	// Set up output destinations
+	sinks, err := output.NewSinks(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each analysis worker has its own analyzers, as they keep state across packets
+	analyzers := make([][]analysis.Analyzer, 0, params.AnalysisWorkers)
+
+	ready := false
+	defer func() {
+		// Release the outputs and analyzers already set up if the pipeline cannot be
+		if ready {
+			return
+		}
+		for _, sink := range sinks {
+			_ = sink.Close()
+		}
+		for _, set := range analyzers {
+			analysis.CloseAnalyzers(set)
+		}
+	}()
+
+	if params.SelfTest != config.OffSelfTest {
+		if err := output.SelfTest(params, sinks); err != nil {
+			if params.SelfTest == config.FailSelfTest {
+				return nil, err
+			}
+			log.Warn("Alerts may not reach all outputs, as ", err)
+		}
+	}
+
+	for i := 0; i < params.AnalysisWorkers; i++ {
+		set, err := analysis.NewAnalyzers(params)
+		if err != nil {
+			return nil, err
+		}
+		analyzers = append(analyzers, set)
+	}
+
+	rollups, err := analysis.NewRollupAggregator(params)
+	if err != nil {
+		return nil, err
+	}
+
+	recorder := capture.NewFlightRecorder(params)
+	alertChan := make(chan alert.Message, 1)
+
+	p := &pipeline{
+		params:     params,
+		devices:    devices,
+		sinks:      sinks,
+		analyzers:  analyzers,
+		recorder:   recorder,
+		rollups:    rollups,
+		watchdog:   alert.NewWatchdog(params, recorder, alertChan),
+		packetChan: make(chan []capture.PacketMsg, packetBacklog/params.CaptureConfig.BatchSize+1),
+		reportChan: make(chan *analysis.Report, 1),
+		alertChan:  alertChan,
+		analysed:   make(chan struct{}),
+	}
+
+	// Measure the occupancy of channels between stages, for diagnostics and reports
+	diagnostics.RegisterQueue(params.Qualify("packet_batches"), func() (int, int) { return len(p.packetChan), cap(p.packetChan) })
+	diagnostics.RegisterQueue(params.Qualify("reports"), func() (int, int) { return len(p.reportChan), cap(p.reportChan) })
+	diagnostics.RegisterQueue(params.Qualify("alerts"), func() (int, int) { return len(p.alertChan), cap(p.alertChan) })
+	ready = true
+
+	return p, nil
+}
+
+// close releases the outputs and analyzers of a pipeline that is not run. Those of a pipeline run are released as it
+// stops.
+func (p *pipeline) close() {
+	for _, sink := range p.sinks {
+		_ = sink.Close()
+	}
+	for _, set := range p.analyzers {
+		analysis.CloseAnalyzers(set)
+	}
+}
+
+// run runs capture, analysis and outputs of the pipeline in group, until ctx is cancelled
+func (p *pipeline) run(ctx context.Context, group *errgroup.Group) {
+	// Report on the state of capture and analysis through the outputs supporting it
+	output.AttachPipeline(p.sinks, &output.Pipeline{
+		Devices:    p.devices,
+		PacketChan: p.packetChan,
+		ReportChan: p.reportChan,
+		AlertChan:  p.alertChan,
+	})
+
+	// Run Sniffer/Collector
+	group.Go(func() error {
+		return capture.Collector(ctx, p.devices, p.packetChan)
+	})
+
+	// Run monitoring
+	group.Go(func() error {
+		defer close(p.analysed)
+		return analysis.Monitor(ctx, p.params, p.analyzers, p.recorder, p.watchdog, p.packetChan, p.reportChan)
+	})
+
+	// Run display to print result
+	group.Go(func() error {
+		return output.Display(ctx, p.params, p.sinks, p.rollups, p.reportChan, p.alertChan)
+	})
+}
+
+// drained tells whether the reports and alerts of the pipeline have all left the channels to its outputs
+func (p *pipeline) drained() bool {
+	return len(p.reportChan) == 0 && len(p.alertChan) == 0
+}
+
+// endReplay cancels monitoring once the files of all pipelines were read to their end or failed, analysis sent the
+// report of the last window, and the channels to outputs have drained. It returns without cancelling if ctx is
+// cancelled before.
+func endReplay(ctx context.Context, cancel context.CancelFunc, pipelines []*pipeline) {
+	for _, p := range pipelines {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.analysed:
+		}
+	}
+
+	ticker := time.NewTicker(drainPoll)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			done := true
+			for _, p := range pipelines {
+				done = done && p.drained()
+			}
+			if done {
+				log.Info("Replay finished.")
+				cancel()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+)
+
+// Exit statuses of commands, for wrapper scripts and orchestrators to react to the way the monitor stopped
+const (
+	exitSuccess    = 0
+	exitRuntime    = 1 // Monitoring failed once started, or the command failed otherwise
+	exitUsage      = 2 // The command line is invalid, or help was asked for
+	exitConfig     = 3 // The configuration is invalid, or names files, outputs or servers that cannot be set up
+	exitPermission = 4 // Capturing live traffic is not permitted, e.g. without root or the capture capabilities
+	exitNoDevices  = 5 // There is no interface to capture on
+)
+
+// Names of exit statuses, in status lines
+var statusNames = map[int]string{
+	exitSuccess:    "ok",
+	exitRuntime:    "runtime_error",
+	exitUsage:      "usage_error",
+	exitConfig:     "config_error",
+	exitPermission: "permission_error",
+	exitNoDevices:  "no_devices",
+}
+
+// exitError is an error ending a command with a specific exit status
+type exitError struct {
+	status int
+	err    error
+}
+
+// Error returns the message of the error ending the command
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+// withStatus returns err ending the command with the exit status, nil if err is nil
+func withStatus(status int, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &exitError{status: status, err: err}
+}
+
+// usageError returns the error of parsing the command line, ending the command with the usage status. Help requests
+// are left as they are, to be told apart.
+func usageError(err error) error {
+	if err == flag.ErrHelp {
+		return err
+	}
+
+	return withStatus(exitUsage, err)
+}
+
+// exitStatus returns the exit status of the error a command returned, the runtime one if it does not tell any
+func exitStatus(err error) int {
+	switch e := err.(type) {
+	case nil:
+		return exitSuccess
+	case *exitError:
+		return e.status
+	}
+	if err == flag.ErrHelp {
+		return exitUsage
+	}
+
+	return exitRuntime
+}
+
+// statusJSON is the machine-readable status line written when a monitoring command ends, with --status-json
+type statusJSON struct {
+	Status string `json:"status"` // Name of the exit status, e.g. ok or config_error
+	Code   int    `json:"code"`   // Exit status of the command
+	Error  string `json:"error,omitempty"`
+}
+
+// writeStatus writes the status line of the error a command ended with, nil for success, as a single line of JSON
+func writeStatus(w io.Writer, err error) {
+	status := exitStatus(err)
+	line := statusJSON{Status: statusNames[status], Code: status, Error: ""}
+	if err != nil {
+		line.Error = err.Error()
+	}
+
+	if err := json.NewEncoder(w).Encode(&line); err != nil {
+		log.Error("Could not write the status line : ", err)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/output"
+	"io"
+	"os"
+	"time"
+)
+
+// Summary implements the report command, rendering recorded history into an HTML or Markdown document
+func Summary(args []string) error {
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	since := flags.Duration("since", 24*time.Hour, "period of history to summarise, up to now")
+	format := flags.String("format", output.HTMLFormat, "summary format : html or markdown")
+	historyFile := flags.String("history", config.DefHistoryFile, "history file recorded by the history output")
+	database := flags.String("db", "", "database recorded by the sqlite output, read instead of the history file")
+	outputFile := flags.String("output", "", "file to write the summary to, instead of the standard output")
+	timeZone := flags.String("timezone", "Local", "time zone of timestamps, e.g. UTC or Europe/Paris")
+	timeLayout := flags.String("time-layout", config.DefTimeLayout, "layout of timestamps, as defined by Go's time package")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *since <= 0 {
+		return errors.New("--since must be a positive duration")
+	}
+
+	zone, err := config.LoadTimeZone(*timeZone)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now().Add(-*since)
+	var history *output.History
+	if *database != "" {
+		history, err = output.ReadDatabase(*database, start)
+	} else {
+		history, err = output.ReadHistory(*historyFile, start)
+	}
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *outputFile != "" {
+		file, err := os.Create(*outputFile)
+		if err != nil {
+			return fmt.Errorf("could not create summary file : %s", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	return output.RenderSummary(w, history, start, *format, zone, *timeLayout)
+}
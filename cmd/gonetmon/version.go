@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/version"
+	"os"
+)
+
+// Version implements the version command, printing the version of the build, the commit and date it was built from,
+// and the Go toolchain it was built with
+func Version(args []string) error {
+	flags := flag.NewFlagSet("gonetmon version", flag.ContinueOnError)
+	short := flags.Bool("short", false, "print the version only")
+	format := flags.String("format", config.TextFormat, "output format : text or json")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	info := version.Get()
+
+	switch {
+	case *short:
+		fmt.Println(info.Version)
+	case *format == config.JSONFormat:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(&info)
+	case *format == config.TextFormat:
+		fmt.Println(info)
+	default:
+		return fmt.Errorf("unknown format : %s", *format)
+	}
+
+	return nil
+}
@@ -0,0 +1,532 @@
+// Package aggregator merges the reports and alerts forwarded by agents on many hosts, raises global alerts on their
+// combined traffic, and serves a dashboard of the whole fleet
+package aggregator
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/output"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Period at which global alerts are evaluated
+	evaluatePeriod = time.Second
+
+	// Maximum size of an event forwarded by an agent
+	maxEventSize = 16 << 20
+
+	// Number of global alerts kept for the dashboard
+	alertHistory = 100
+
+	// Maximum time to wait for pending requests when closing the server
+	shutdownTimeout = 5 * time.Second
+
+	// Format strings of global alert messages
+	globalAlertFormat    = "High traffic across %d agent(s) generated a global alert - hits = %d, triggered at %s"
+	globalRecoveryFormat = "Global alert recovered at %s"
+)
+
+var log = config.Logger
+
+// agentState is what the aggregator knows of an agent, from the events it forwarded
+type agentState struct {
+	name      string
+	firstSeen time.Time
+	lastSeen  time.Time
+	reports   uint64             // Number of reports received
+	hits      uint64             // Hits of all reports received
+	bytes     uint64             // Bytes of all reports received
+	report    *output.ReportJSON // Last report, nil until the first one
+	alert     *output.AlertJSON  // Last alert or recovery, nil until the first one
+	flows     []output.FlowJSON  // Flow records of the last report, if the agent forwards them
+}
+
+// windowHits are the hits of a report, received at a given time
+type windowHits struct {
+	received time.Time
+	hits     int
+}
+
+// Aggregator receives the events of agents, keeps their state, and raises global alerts to its sinks when the hits of
+// all agents over the alert span cross the threshold
+type Aggregator struct {
+	server     *http.Server
+	tokens     map[string]string // Bearer tokens of agents, indexed by agent name
+	sinks      []output.Sink
+	span       time.Duration
+	threshold  uint
+	staleAfter time.Duration
+	topTalkers int
+	timeZone   *time.Location
+	timeLayout string
+	mutex      sync.Mutex
+	agents     map[string]*agentState
+	window     []windowHits // Hits received over the alert span, oldest first
+	alerting   bool
+	alertID    uint64
+	alerts     []output.AlertJSON // Recent global alerts and recoveries, oldest first
+}
+
+// New starts serving the ingestion endpoint and the dashboard on the address configured in parameters, over TLS if
+// configured. Agents are authenticated by certificate and by token if configured. Global alerts are sent to sinks,
+// which the aggregator closes once run.
+func New(parameters *config.Parameters, sinks []output.Sink) (*Aggregator, error) {
+	aggregator := parameters.Aggregator
+
+	if aggregator.AlertSpan <= 0 {
+		return nil, errors.New("the aggregator alert span must be positive")
+	}
+	owners := make(map[string]string, len(aggregator.Tokens))
+	for name, token := range aggregator.Tokens {
+		if token == "" {
+			return nil, fmt.Errorf("empty token for agent %s", name)
+		}
+		if owner, ok := owners[token]; ok {
+			return nil, fmt.Errorf("agents %s and %s share the same token", owner, name)
+		}
+		owners[token] = name
+	}
+
+	tlsConfig, err := output.NewServerTLSConfig(&aggregator.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", aggregator.Address)
+	if err != nil {
+		return nil, fmt.Errorf("could not listen on %s : %s", aggregator.Address, err)
+	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	a := &Aggregator{
+		server:     nil,
+		tokens:     aggregator.Tokens,
+		sinks:      sinks,
+		span:       aggregator.AlertSpan,
+		threshold:  aggregator.AlertThreshold,
+		staleAfter: aggregator.StaleAfter,
+		topTalkers: aggregator.TopTalkers,
+		timeZone:   parameters.TimeZone,
+		timeLayout: parameters.TimeLayout,
+		mutex:      sync.Mutex{},
+		agents:     make(map[string]*agentState),
+		window:     nil,
+		alerting:   false,
+		alertID:    0,
+		alerts:     nil,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ingest", a.serveIngest)
+	mux.HandleFunc("/state", a.serveState)
+	mux.HandleFunc("/", a.serveDashboard)
+	a.server = &http.Server{Handler: mux}
+
+	go func() {
+		if err := a.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Error("Aggregator failed : ", err)
+		}
+	}()
+
+	switch {
+	case tlsConfig != nil && tlsConfig.ClientCAs != nil:
+		log.Info("Aggregating agents on ", listener.Addr(), " over TLS, authenticating them by certificate")
+	case tlsConfig != nil:
+		log.Info("Aggregating agents on ", listener.Addr(), " over TLS")
+	default:
+		log.Info("Aggregating agents on ", listener.Addr())
+	}
+	if len(a.tokens) == 0 {
+		log.Warn("No agent tokens configured, any client reaching the aggregator may forward events.")
+	}
+
+	return a, nil
+}
+
+// writeJSON writes v as the JSON body of a response with the given status code
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Warn("Could not write aggregator response : ", err)
+	}
+}
+
+// writeError writes an error message as the JSON body of a response with the given status code
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
+
+// serveIngest records an event forwarded by an agent
+func (a *Aggregator) serveIngest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	// Authenticate before reading the event, which must then come from the agent the token belongs to
+	agent, ok := a.authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "missing or invalid token")
+		return
+	}
+
+	var event output.AgentEventJSON
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEventSize)).Decode(&event); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("malformed event : %s", err))
+		return
+	}
+	if event.Agent == "" {
+		writeError(w, http.StatusBadRequest, "missing agent name")
+		return
+	}
+	if agent != "" && event.Agent != agent {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("the token does not belong to agent %s", event.Agent))
+		return
+	}
+	if event.Report == nil && event.Alert == nil {
+		writeError(w, http.StatusBadRequest, "the event holds neither a report nor an alert")
+		return
+	}
+
+	a.record(&event, time.Now())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authenticate returns the name of the agent whose token the request bears, and whether it is allowed. Without
+// configured tokens, all requests are allowed, from any agent.
+func (a *Aggregator) authenticate(r *http.Request) (string, bool) {
+	if len(a.tokens) == 0 {
+		return "", true
+	}
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return "", false
+	}
+	token := []byte(strings.TrimPrefix(auth, "Bearer "))
+
+	// Compare with all tokens, so that timing does not tell which agent a token belongs to
+	agent := ""
+	for name, expected := range a.tokens {
+		if subtle.ConstantTimeCompare(token, []byte(expected)) == 1 {
+			agent = name
+		}
+	}
+
+	return agent, agent != ""
+}
+
+// record updates the state of the agent that forwarded the event, received at now
+func (a *Aggregator) record(event *output.AgentEventJSON, now time.Time) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	agent, ok := a.agents[event.Agent]
+	if !ok {
+		agent = &agentState{name: event.Agent, firstSeen: now}
+		a.agents[event.Agent] = agent
+		log.Info("New agent : ", event.Agent)
+	}
+	agent.lastSeen = now
+
+	if event.Report != nil {
+		agent.reports++
+		agent.hits += uint64(event.Report.Hits)
+		agent.bytes += event.Report.Bytes
+		agent.report = event.Report
+		agent.flows = event.Flows
+		a.window = append(a.window, windowHits{received: now, hits: event.Report.Hits})
+	}
+
+	// Notices do not change whether the agent is alerting
+	if event.Alert != nil && !event.Alert.Notice {
+		agent.alert = event.Alert
+	}
+}
+
+// windowTotal evicts the hits received before the alert span, and returns the sum of those left
+func (a *Aggregator) windowTotal(now time.Time) int {
+	evicted := 0
+	for evicted < len(a.window) && now.Sub(a.window[evicted].received) > a.span {
+		evicted++
+	}
+	a.window = a.window[evicted:]
+
+	total := 0
+	for _, h := range a.window {
+		total += h.hits
+	}
+
+	return total
+}
+
+// evaluate raises a global alert if the hits of all agents over the span reached the threshold, or recovers from it if
+// they went back under. It returns the alert or recovery to send, if any.
+func (a *Aggregator) evaluate(now time.Time) *alert.Message {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	total := a.windowTotal(now)
+	if a.threshold == 0 {
+		return nil
+	}
+
+	var msg *alert.Message
+	t := now.In(a.timeZone)
+	switch {
+	case !a.alerting && total >= int(a.threshold):
+		a.alerting = true
+		a.alertID++
+		msg = &alert.Message{
+			ID:        a.alertID,
+			Recovery:  false,
+			Body:      fmt.Sprintf(globalAlertFormat, len(a.agents), total, t.Format(a.timeLayout)),
+			Timestamp: t,
+			Evidence:  "",
+			Notice:    false,
+			Critical:  false,
+		}
+	case a.alerting && total < int(a.threshold):
+		a.alerting = false
+		msg = &alert.Message{
+			ID:        a.alertID,
+			Recovery:  true,
+			Body:      fmt.Sprintf(globalRecoveryFormat, t.Format(a.timeLayout)),
+			Timestamp: t,
+			Evidence:  "",
+			Notice:    false,
+			Critical:  false,
+		}
+	default:
+		return nil
+	}
+
+	a.alerts = append(a.alerts, output.NewAlertJSON(msg))
+	if len(a.alerts) > alertHistory {
+		a.alerts = a.alerts[len(a.alerts)-alertHistory:]
+	}
+
+	return msg
+}
+
+// Run evaluates global alerts and sends them to the sinks, until ctx is cancelled. It then stops the server and
+// closes the sinks.
+func (a *Aggregator) Run(ctx context.Context) error {
+	ticker := time.NewTicker(evaluatePeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("Aggregator terminating.")
+			return a.close()
+
+		case now := <-ticker.C:
+			msg := a.evaluate(now)
+			if msg == nil {
+				continue
+			}
+
+			log.Warn(msg.Body)
+			for _, sink := range a.sinks {
+				if err := sink.SendAlert(msg); err != nil {
+					log.Error("Could not send global alert : ", err)
+				}
+			}
+		}
+	}
+}
+
+// close stops the server and closes the sinks
+func (a *Aggregator) close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := a.server.Shutdown(ctx)
+
+	for _, sink := range a.sinks {
+		if closeErr := sink.Close(); closeErr != nil {
+			log.Error("Could not close output : ", closeErr)
+		}
+	}
+
+	return err
+}
+
+// agentJSON is the JSON representation of the state of an agent
+type agentJSON struct {
+	Name       string             `json:"name"`
+	FirstSeen  time.Time          `json:"first_seen"`
+	LastSeen   time.Time          `json:"last_seen"`
+	Stale      bool               `json:"stale"`    // Whether no event was received for longer than the stale delay
+	Alerting   bool               `json:"alerting"` // Whether the last alert of the agent has not recovered yet
+	Reports    uint64             `json:"reports"`
+	Hits       uint64             `json:"hits"`
+	Bytes      uint64             `json:"bytes"`
+	LastReport *output.ReportJSON `json:"last_report,omitempty"`
+	LastAlert  *output.AlertJSON  `json:"last_alert,omitempty"`
+}
+
+// hostJSON is the JSON representation of a host that topped the last report of one or more agents
+type hostJSON struct {
+	Host   string   `json:"host"`
+	Hits   int      `json:"hits"`   // Sum of the host's hits over the last reports it topped
+	Agents []string `json:"agents"` // Agents whose last report it topped
+}
+
+// stateJSON is the JSON representation of the combined state of all agents
+type stateJSON struct {
+	Agents     []agentJSON         `json:"agents"` // Sorted by name
+	Hits       int                 `json:"hits"`   // Hits of all agents over the alert span
+	Span       string              `json:"span"`
+	Threshold  uint                `json:"threshold"`
+	Alerting   bool                `json:"alerting"`
+	Alerts     []output.AlertJSON  `json:"alerts"`      // Recent global alerts and recoveries, oldest first
+	TopHosts   []hostJSON          `json:"top_hosts"`   // Top hosts of the last report of agents, by decreasing hits
+	TopTalkers []output.TalkerJSON `json:"top_talkers"` // IP addresses sending the most bytes in the last flows of agents
+}
+
+// state returns the combined state of all agents at now
+func (a *Aggregator) state(now time.Time) *stateJSON {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	state := &stateJSON{
+		Agents:     make([]agentJSON, 0, len(a.agents)),
+		Hits:       a.windowTotal(now),
+		Span:       a.span.String(),
+		Threshold:  a.threshold,
+		Alerting:   a.alerting,
+		Alerts:     append([]output.AlertJSON{}, a.alerts...),
+		TopHosts:   []hostJSON{},
+		TopTalkers: []output.TalkerJSON{},
+	}
+
+	hosts := make(map[string]*hostJSON)
+	talkers := make(map[string]uint64)
+	owners := make(map[string]map[string]bool) // Containers owning talker addresses, as agent/container
+	workloads := make(map[string]string)       // Kubernetes workloads owning talker addresses, unique in a cluster
+	names := make(map[string]string)           // Friendly names discovery protocols gave talker addresses
+
+	for _, agent := range a.agents {
+		state.Agents = append(state.Agents, agentJSON{
+			Name:       agent.name,
+			FirstSeen:  agent.firstSeen.In(a.timeZone),
+			LastSeen:   agent.lastSeen.In(a.timeZone),
+			Stale:      a.staleAfter > 0 && now.Sub(agent.lastSeen) > a.staleAfter,
+			Alerting:   agent.alert != nil && !agent.alert.Recovery,
+			Reports:    agent.reports,
+			Hits:       agent.hits,
+			Bytes:      agent.bytes,
+			LastReport: agent.report,
+			LastAlert:  agent.alert,
+		})
+
+		if agent.report != nil && agent.report.TopHost != nil {
+			top := agent.report.TopHost
+			host, ok := hosts[top.Host]
+			if !ok {
+				host = &hostJSON{Host: top.Host, Hits: 0, Agents: nil}
+				hosts[top.Host] = host
+			}
+			host.Hits += top.Hits
+			host.Agents = append(host.Agents, agent.name)
+		}
+
+		for _, f := range agent.flows {
+			talkers[f.SrcIP] += f.SrcBytes
+			talkers[f.DstIP] += f.DstBytes
+			addOwner(owners, f.SrcIP, agent.name, f.SrcContainer)
+			addOwner(owners, f.DstIP, agent.name, f.DstContainer)
+			if f.SrcWorkload != "" {
+				workloads[f.SrcIP] = f.SrcWorkload
+			}
+			if f.DstWorkload != "" {
+				workloads[f.DstIP] = f.DstWorkload
+			}
+			if f.SrcName != "" {
+				names[f.SrcIP] = f.SrcName
+			}
+			if f.DstName != "" {
+				names[f.DstIP] = f.DstName
+			}
+		}
+	}
+
+	sort.Slice(state.Agents, func(i, j int) bool { return state.Agents[i].Name < state.Agents[j].Name })
+
+	for _, host := range hosts {
+		sort.Strings(host.Agents)
+		state.TopHosts = append(state.TopHosts, *host)
+	}
+	sort.Slice(state.TopHosts, func(i, j int) bool {
+		if state.TopHosts[i].Hits == state.TopHosts[j].Hits {
+			return state.TopHosts[i].Host < state.TopHosts[j].Host
+		}
+		return state.TopHosts[i].Hits > state.TopHosts[j].Hits
+	})
+
+	for ip, bytes := range talkers {
+		// Private addresses may belong to different containers on different agents
+		containers := make([]string, 0, len(owners[ip]))
+		for container := range owners[ip] {
+			containers = append(containers, container)
+		}
+		sort.Strings(containers)
+
+		state.TopTalkers = append(state.TopTalkers, output.TalkerJSON{
+			IP:        ip,
+			Bytes:     bytes,
+			Container: strings.Join(containers, ", "),
+			Workload:  workloads[ip],
+			Name:      names[ip],
+		})
+	}
+	sort.Slice(state.TopTalkers, func(i, j int) bool {
+		if state.TopTalkers[i].Bytes == state.TopTalkers[j].Bytes {
+			return state.TopTalkers[i].IP < state.TopTalkers[j].IP
+		}
+		return state.TopTalkers[i].Bytes > state.TopTalkers[j].Bytes
+	})
+	if len(state.TopTalkers) > a.topTalkers {
+		state.TopTalkers = state.TopTalkers[:a.topTalkers]
+	}
+
+	return state
+}
+
+// addOwner records that the container of the agent owns the IP address, if any
+func addOwner(owners map[string]map[string]bool, ip, agent, container string) {
+	if container == "" {
+		return
+	}
+	if owners[ip] == nil {
+		owners[ip] = make(map[string]bool)
+	}
+	owners[ip][agent+"/"+container] = true
+}
+
+// serveState answers the combined state of all agents
+func (a *Aggregator) serveState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a.state(time.Now()))
+}
@@ -0,0 +1,88 @@
+package aggregator
+
+import (
+	"github.com/bytemare/gonetmon/pkg/output"
+	"html/template"
+	"net/http"
+	"time"
+)
+
+// Period at which the dashboard reloads itself, in seconds
+const dashboardRefresh = 5
+
+const dashboardTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>gonetmon aggregator</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; text-align: left; }
+.alert { color: #b00; }
+.recovery { color: #080; }
+.stale { color: #888; }
+</style>
+</head>
+<body>
+<h1>gonetmon aggregator</h1>
+<p>Updated {{time .Now}}</p>
+<table>
+<tr><th>Agents</th><td>{{len .Agents}}</td></tr>
+<tr><th>Hits over {{.Span}}</th><td{{if .Alerting}} class="alert"{{end}}>{{.Hits}} / {{if .Threshold}}{{.Threshold}}{{else}}no threshold{{end}}</td></tr>
+</table>
+<h2>Agents</h2>
+<table>
+<tr><th>Agent</th><th>Last seen</th><th>Reports</th><th>Hits</th><th>Traffic</th><th>Top host</th><th>Last alert</th></tr>
+{{range .Agents}}<tr{{if .Stale}} class="stale"{{end}}><td>{{.Name}}</td><td>{{time .LastSeen}}</td><td>{{.Reports}}</td><td>{{.Hits}}</td><td>{{bytes .Bytes}}</td><td>{{with .LastReport}}{{with .TopHost}}{{.Host}} ({{.Hits}} hits){{end}}{{end}}</td><td{{if .Alerting}} class="alert"{{end}}>{{with .LastAlert}}{{.Message}}{{end}}</td></tr>
+{{end}}</table>
+<h2>Top hosts</h2>
+<table>
+<tr><th>Host</th><th>Hits</th><th>Agents</th></tr>
+{{range .TopHosts}}<tr><td>{{.Host}}</td><td>{{.Hits}}</td><td>{{range $i, $a := .Agents}}{{if $i}}, {{end}}{{$a}}{{end}}</td></tr>
+{{end}}</table>
+<h2>Top talkers</h2>
+<table>
+<tr><th>IP</th><th>Name</th><th>Container</th><th>Workload</th><th>Traffic</th></tr>
+{{range .TopTalkers}}<tr><td>{{.IP}}</td><td>{{.Name}}</td><td>{{.Container}}</td><td>{{.Workload}}</td><td>{{bytes .Bytes}}</td></tr>
+{{end}}</table>
+<h2>Global alerts</h2>
+<table>
+<tr><th>Time</th><th>Message</th></tr>
+{{range .Alerts}}<tr class="{{if .Recovery}}recovery{{else}}alert{{end}}"><td>{{time .Timestamp}}</td><td>{{.Message}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`
+
+// dashboardDocument adds the time of rendering and the refresh period to the state, for the dashboard template
+type dashboardDocument struct {
+	*stateJSON
+	Now     time.Time
+	Refresh int
+}
+
+// serveDashboard renders the combined state of all agents as an HTML page
+func (a *Aggregator) serveDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	funcs := template.FuncMap{
+		"bytes": output.HumanBytes,
+		"time": func(t time.Time) string {
+			return t.In(a.timeZone).Format(a.timeLayout)
+		},
+	}
+	t := template.Must(template.New("dashboard").Funcs(funcs).Parse(dashboardTemplate))
+
+	now := time.Now()
+	document := dashboardDocument{stateJSON: a.state(now), Now: now, Refresh: dashboardRefresh}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := t.Execute(w, document); err != nil {
+		log.Warn("Could not render dashboard : ", err)
+	}
+}
@@ -0,0 +1,26 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Format string of ARP conflict alert messages
+const arpConflictFormat = "ARP conflict generated a critical alert - %s, seen at %s"
+
+// ARPConflict sends a critical notice of an IP address claimed by another hardware address, e.g. ARP spoofing, or of a
+// gateway that changed hardware address, as described
+func (w *Watchdog) ARPConflict(ctx context.Context, conflict string, t time.Time) {
+	t = t.In(w.timeZone)
+	w.send(ctx, Message{
+		ID:        atomic.AddUint64(&w.lastID, 1),
+		Recovery:  false,
+		Body:      w.decorate(fmt.Sprintf(arpConflictFormat, conflict, t.Format(w.timeLayout))),
+		Timestamp: t,
+		Evidence:  "",
+		Notice:    true,
+		Critical:  true,
+	})
+}
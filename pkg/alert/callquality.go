@@ -0,0 +1,42 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Format strings of call quality alert messages
+const (
+	callJitterFormat         = "Jitter of call %s generated an alert - %.1fms, triggered at %s"
+	callJitterRecoveryFormat = "Jitter of call %s recovered at %s"
+	callLossFormat           = "Packet loss of call %s generated an alert - %.1f%% of RTP packets, triggered at %s"
+	callLossRecoveryFormat   = "Packet loss of call %s recovered at %s"
+)
+
+// VerifyCallQuality raises an alert for each VoIP call whose jitter, in milliseconds, or share of RTP packets lost,
+// between 0 and 1, over the last report window reached its threshold, and sends the recovery of those that fell below
+// it. Calls left out, e.g. those hung up, are taken to have recovered. It is to be called from a single goroutine.
+func (w *Watchdog) VerifyCallQuality(ctx context.Context, jitter, loss map[string]float64, t time.Time) {
+	triggered := t.In(w.timeZone).Format(w.timeLayout)
+
+	if w.callLimit.Jitter > 0 {
+		w.verifyLevels(ctx, w.callJitter, jitter, float64(w.callLimit.Jitter)/float64(time.Millisecond),
+			func(call string) string {
+				return fmt.Sprintf(callJitterFormat, call, jitter[call], triggered)
+			},
+			func(call string) string {
+				return fmt.Sprintf(callJitterRecoveryFormat, call, triggered)
+			}, t)
+	}
+
+	if w.callLimit.Loss > 0 {
+		w.verifyLevels(ctx, w.callLoss, loss, w.callLimit.Loss,
+			func(call string) string {
+				return fmt.Sprintf(callLossFormat, call, 100*loss[call], triggered)
+			},
+			func(call string) string {
+				return fmt.Sprintf(callLossRecoveryFormat, call, triggered)
+			}, t)
+	}
+}
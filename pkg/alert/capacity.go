@@ -0,0 +1,33 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Format strings of capacity alert messages
+const (
+	capacityFormat         = "Capacity of link %s generated an alert - forecast to reach %.0f Mbit/s in %d days, by %s, triggered at %s"
+	capacityRecoveryFormat = "Capacity of link %s recovered at %s"
+)
+
+// VerifyCapacity raises an alert for each link whose bandwidth is forecast to reach its capacity within the horizon,
+// and sends the recovery of those no longer forecast to. Forecasts are the days from t until links reach their
+// capacity, by interface, and links left out are not forecast to. It is to be called from a single goroutine.
+func (w *Watchdog) VerifyCapacity(ctx context.Context, forecasts map[string]int, t time.Time) {
+	levels := make(map[string]float64, len(forecasts))
+	for link := range forecasts {
+		levels[link] = 1
+	}
+
+	triggered := t.In(w.timeZone).Format(w.timeLayout)
+	w.verifyLevels(ctx, w.saturation, levels, 1,
+		func(link string) string {
+			by := t.In(w.timeZone).AddDate(0, 0, forecasts[link]).Format("2006-01-02")
+			return fmt.Sprintf(capacityFormat, link, w.capacity.Links[link]/1e6, forecasts[link], by, triggered)
+		},
+		func(link string) string {
+			return fmt.Sprintf(capacityRecoveryFormat, link, triggered)
+		}, t)
+}
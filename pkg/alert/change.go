@@ -0,0 +1,93 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"math"
+	"time"
+)
+
+// Format strings of rate-of-change alert messages
+const (
+	changeFormat         = "Change of %s generated an alert - from %g to %g within %s, triggered at %s"
+	changeRecoveryFormat = "Change of %s recovered at %s"
+	changeRuleFormat     = "%s %gx within %s"
+)
+
+// metricSample holds the metrics of a report, by name
+type metricSample struct {
+	t       time.Time
+	metrics map[string]float64
+}
+
+// VerifyChanges raises an alert for each rate-of-change rule whose metric, compared to its value the lookback of the
+// rule before, changed by the factor of the rule or more, and sends the recovery of those whose change fell below it.
+// Metrics are those of the report ending at t, by name, and rules are judged once the reports cover their lookback.
+// Rules are keyed as "<metric> <factor>x within <lookback>". It is to be called from a single goroutine, once per
+// report.
+func (w *Watchdog) VerifyChanges(ctx context.Context, metrics map[string]float64, t time.Time) {
+	if len(w.changeRules) == 0 {
+		return
+	}
+
+	// Only the newest of the samples older than the longest lookback is needed
+	var longest time.Duration
+	for _, rule := range w.changeRules {
+		if rule.Lookback > longest {
+			longest = rule.Lookback
+		}
+	}
+	w.samples = append(w.samples, metricSample{t: t, metrics: metrics})
+	for len(w.samples) > 1 && t.Sub(w.samples[1].t) >= longest {
+		w.samples = w.samples[1:]
+	}
+
+	// Levels are the changes relative to the factors of rules, so that rules share the threshold of 1
+	levels := make(map[string]float64, len(w.changeRules))
+	pasts := make(map[string]metricSample, len(w.changeRules))
+	rules := make(map[string]config.ChangeRule, len(w.changeRules))
+	for _, rule := range w.changeRules {
+		key := fmt.Sprintf(changeRuleFormat, rule.Metric, rule.Factor, rule.Lookback)
+		past, ok := w.pastSample(t, rule.Lookback)
+		if !ok {
+			continue
+		}
+
+		from, to := past.metrics[rule.Metric], metrics[rule.Metric]
+		pasts[key], rules[key] = past, rule
+		if math.Max(from, to) < rule.Minimum || from == to {
+			continue
+		}
+
+		switch {
+		case rule.Factor >= 1 && from == 0, rule.Factor < 1 && to == 0:
+			levels[key] = math.Inf(1)
+		case rule.Factor >= 1:
+			levels[key] = to / from / rule.Factor
+		default:
+			levels[key] = from / to * rule.Factor
+		}
+	}
+
+	triggered := t.In(w.timeZone).Format(w.timeLayout)
+	w.verifyLevels(ctx, w.changes, levels, 1,
+		func(key string) string {
+			metric := rules[key].Metric
+			return fmt.Sprintf(changeFormat, key, pasts[key].metrics[metric], metrics[metric], t.Sub(pasts[key].t), triggered)
+		},
+		func(key string) string {
+			return fmt.Sprintf(changeRecoveryFormat, key, triggered)
+		}, t)
+}
+
+// pastSample returns the newest sample at least lookback older than t, false if the samples do not cover the lookback
+func (w *Watchdog) pastSample(t time.Time, lookback time.Duration) (metricSample, bool) {
+	for i := len(w.samples) - 1; i >= 0; i-- {
+		if t.Sub(w.samples[i].t) >= lookback {
+			return w.samples[i], true
+		}
+	}
+
+	return metricSample{}, false
+}
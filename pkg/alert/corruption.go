@@ -0,0 +1,32 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Format strings of corruption alert messages
+const (
+	corruptionFormat         = "Corrupt packets on %s generated an alert - %.2f%% of packets, triggered at %s"
+	corruptionRecoveryFormat = "Corrupt packets on %s recovered at %s"
+)
+
+// VerifyCorruption raises an alert for each interface whose share of corrupt packets over the last report window
+// reached the threshold, as a bad NIC or cable makes it, and sends the recovery of those whose rate fell below it.
+// Rates are between 0 and 1, by interface, and interfaces left out are taken to be sound. It is to be called from a
+// single goroutine.
+func (w *Watchdog) VerifyCorruption(ctx context.Context, rates map[string]float64, t time.Time) {
+	if w.integrity.Threshold <= 0 {
+		return
+	}
+
+	triggered := t.In(w.timeZone).Format(w.timeLayout)
+	w.verifyLevels(ctx, w.corrupt, rates, w.integrity.Threshold,
+		func(device string) string {
+			return fmt.Sprintf(corruptionFormat, device, 100*rates[device], triggered)
+		},
+		func(device string) string {
+			return fmt.Sprintf(corruptionRecoveryFormat, device, triggered)
+		}, t)
+}
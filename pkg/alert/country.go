@@ -0,0 +1,37 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Format strings of country alert messages
+const (
+	countryFormat         = "Traffic between %s generated an alert - %d bytes, triggered at %s"
+	countryRecoveryFormat = "Traffic between %s recovered at %s"
+)
+
+// VerifyCountries raises an alert for each internal host and address of the countries alerted of, keyed as
+// "<host> -> <address> (<country>)", whose bytes exchanged over the last report window reached the threshold, and sends
+// the recovery of those that fell below it. Pairs missing from traffic are taken to have exchanged nothing. It is to be
+// called from a single goroutine.
+func (w *Watchdog) VerifyCountries(ctx context.Context, traffic map[string]uint64, t time.Time) {
+	if w.geoLimit.Threshold == 0 {
+		return
+	}
+
+	levels := make(map[string]float64, len(traffic))
+	for pair, bytes := range traffic {
+		levels[pair] = float64(bytes)
+	}
+
+	triggered := t.In(w.timeZone).Format(w.timeLayout)
+	w.verifyLevels(ctx, w.geoTraffic, levels, float64(w.geoLimit.Threshold),
+		func(pair string) string {
+			return fmt.Sprintf(countryFormat, pair, traffic[pair], triggered)
+		},
+		func(pair string) string {
+			return fmt.Sprintf(countryRecoveryFormat, pair, triggered)
+		}, t)
+}
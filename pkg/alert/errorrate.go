@@ -0,0 +1,31 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Format strings of error rate alert messages
+const (
+	errorRateFormat         = "Error rate of %s generated an alert - %.0f%% of responses, triggered at %s"
+	errorRateRecoveryFormat = "Error rate of %s recovered at %s"
+)
+
+// VerifyErrorRates raises an alert for each HTTP host whose share of 4xx and 5xx responses over the last report window
+// reached the threshold, and sends the recovery of those whose rate fell below it. Rates are between 0 and 1, by
+// host, and hosts left out are taken to have answered without errors. It is to be called from a single goroutine.
+func (w *Watchdog) VerifyErrorRates(ctx context.Context, rates map[string]float64, t time.Time) {
+	if w.errorLimit.Threshold <= 0 {
+		return
+	}
+
+	triggered := t.In(w.timeZone).Format(w.timeLayout)
+	w.verifyLevels(ctx, w.errorRates, rates, w.errorLimit.Threshold,
+		func(host string) string {
+			return fmt.Sprintf(errorRateFormat, host, 100*rates[host], triggered)
+		},
+		func(host string) string {
+			return fmt.Sprintf(errorRateRecoveryFormat, host, triggered)
+		}, t)
+}
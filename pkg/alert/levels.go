@@ -0,0 +1,56 @@
+package alert
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// verifyLevels raises an alert for each key whose level reached the threshold, and sends the recovery of those in
+// alert whose level fell below it. Keys missing from levels are taken to be at 0. Alerts in progress are kept in
+// raised, by key, with their identifiers. Keys are visited in order, for messages sent at once to come in a stable
+// one.
+func (w *Watchdog) verifyLevels(ctx context.Context, raised map[string]uint64, levels map[string]float64, threshold float64, alertBody, recoveryBody func(key string) string, t time.Time) {
+	t = t.In(w.timeZone)
+
+	var up, down []string
+	for key, level := range levels {
+		if _, ok := raised[key]; !ok && level >= threshold {
+			up = append(up, key)
+		}
+	}
+	for key := range raised {
+		if levels[key] < threshold {
+			down = append(down, key)
+		}
+	}
+	sort.Strings(up)
+	sort.Strings(down)
+
+	for _, key := range up {
+		raised[key] = atomic.AddUint64(&w.lastID, 1)
+		w.send(ctx, Message{
+			ID:        raised[key],
+			Recovery:  false,
+			Body:      w.decorate(alertBody(key)),
+			Timestamp: t,
+			Evidence:  "",
+			Notice:    false,
+			Critical:  false,
+		})
+	}
+
+	for _, key := range down {
+		w.send(ctx, Message{
+			ID:        raised[key],
+			Recovery:  true,
+			Body:      w.decorate(recoveryBody(key)),
+			Timestamp: t,
+			Evidence:  "",
+			Notice:    false,
+			Critical:  false,
+		})
+		delete(raised, key)
+	}
+}
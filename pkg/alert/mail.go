@@ -0,0 +1,52 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Format strings of mail alert messages
+const (
+	mailSpikeFormat         = "Outbound SMTP from %s generated an alert - %d messages to external servers, triggered at %s"
+	mailSpikeRecoveryFormat = "Outbound SMTP from %s recovered at %s"
+	mailDowngradeFormat     = "STARTTLS downgrade of %s seen at %s"
+)
+
+// VerifyMailSpikes raises an alert for each host whose SMTP messages relayed to external servers over the last report
+// window reached the threshold, e.g. a compromised host sending spam, and sends the recovery of those that fell below
+// it. Hosts missing from messages are taken to have sent none. It is to be called from a single goroutine.
+func (w *Watchdog) VerifyMailSpikes(ctx context.Context, messages map[string]int, t time.Time) {
+	if w.mailLimit.Threshold == 0 {
+		return
+	}
+
+	levels := make(map[string]float64, len(messages))
+	for host, nb := range messages {
+		levels[host] = float64(nb)
+	}
+
+	triggered := t.In(w.timeZone).Format(w.timeLayout)
+	w.verifyLevels(ctx, w.mailSpikes, levels, float64(w.mailLimit.Threshold),
+		func(host string) string {
+			return fmt.Sprintf(mailSpikeFormat, host, messages[host], triggered)
+		},
+		func(host string) string {
+			return fmt.Sprintf(mailSpikeRecoveryFormat, host, triggered)
+		}, t)
+}
+
+// MailDowngrade sends a notice of a mail session downgraded from STARTTLS, as described
+func (w *Watchdog) MailDowngrade(ctx context.Context, session string, t time.Time) {
+	t = t.In(w.timeZone)
+	w.send(ctx, Message{
+		ID:        atomic.AddUint64(&w.lastID, 1),
+		Recovery:  false,
+		Body:      w.decorate(fmt.Sprintf(mailDowngradeFormat, session, t.Format(w.timeLayout))),
+		Timestamp: t,
+		Evidence:  "",
+		Notice:    true,
+		Critical:  false,
+	})
+}
@@ -0,0 +1,48 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Format strings of NTP alert messages
+const (
+	ntpAmplificationFormat         = "NTP amplification %s generated an alert - %.0f times the bytes queried, triggered at %s"
+	ntpAmplificationRecoveryFormat = "NTP amplification %s recovered at %s"
+	ntpUnexpectedFormat            = "NTP sync to unexpected server %s generated an alert - %.0f queries, triggered at %s"
+	ntpUnexpectedRecoveryFormat    = "NTP sync to unexpected server %s recovered at %s"
+)
+
+// VerifyNTPAmplification raises an alert for each NTP server and host, keyed as "<server> -> <host>", whose ratio of
+// the bytes sent to the host to those it was queried with over the last report window reached the threshold, and sends
+// the recovery of those that fell below it. Pairs left out are taken to have recovered. It is to be called from a
+// single goroutine.
+func (w *Watchdog) VerifyNTPAmplification(ctx context.Context, ratios map[string]float64, t time.Time) {
+	if w.ntpLimit.Ratio <= 0 {
+		return
+	}
+
+	triggered := t.In(w.timeZone).Format(w.timeLayout)
+	w.verifyLevels(ctx, w.ntpAmplify, ratios, w.ntpLimit.Ratio,
+		func(pair string) string {
+			return fmt.Sprintf(ntpAmplificationFormat, pair, ratios[pair], triggered)
+		},
+		func(pair string) string {
+			return fmt.Sprintf(ntpAmplificationRecoveryFormat, pair, triggered)
+		}, t)
+}
+
+// VerifyNTPServers raises an alert for each host and unexpected NTP server, keyed as "<host> -> <server>", that the
+// host queried for the time over the last report window, and sends the recovery of those it did not query. It is to be
+// called from a single goroutine.
+func (w *Watchdog) VerifyNTPServers(ctx context.Context, queries map[string]float64, t time.Time) {
+	triggered := t.In(w.timeZone).Format(w.timeLayout)
+	w.verifyLevels(ctx, w.ntpUnknown, queries, 1,
+		func(pair string) string {
+			return fmt.Sprintf(ntpUnexpectedFormat, pair, queries[pair], triggered)
+		},
+		func(pair string) string {
+			return fmt.Sprintf(ntpUnexpectedRecoveryFormat, pair, triggered)
+		}, t)
+}
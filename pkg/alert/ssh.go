@@ -0,0 +1,47 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Format strings of SSH alert messages
+const (
+	sshBruteForceFormat         = "SSH brute force from %s generated an alert - %.0f short sessions, triggered at %s"
+	sshBruteForceRecoveryFormat = "SSH brute force from %s recovered at %s"
+	sshUnexpectedFormat         = "SSH to unexpected destination %s generated an alert - %.0f sessions, triggered at %s"
+	sshUnexpectedRecoveryFormat = "SSH to unexpected destination %s recovered at %s"
+)
+
+// VerifySSHBruteForce raises an alert for each SSH client and server, keyed as "<client> -> <server>", whose short
+// sessions over the last report window reached the threshold, and sends the recovery of those that fell below it.
+// Pairs left out are taken to have opened none. It is to be called from a single goroutine.
+func (w *Watchdog) VerifySSHBruteForce(ctx context.Context, attempts map[string]float64, t time.Time) {
+	if w.sshLimit.Attempts == 0 {
+		return
+	}
+
+	triggered := t.In(w.timeZone).Format(w.timeLayout)
+	w.verifyLevels(ctx, w.sshAttempts, attempts, float64(w.sshLimit.Attempts),
+		func(pair string) string {
+			return fmt.Sprintf(sshBruteForceFormat, pair, attempts[pair], triggered)
+		},
+		func(pair string) string {
+			return fmt.Sprintf(sshBruteForceRecoveryFormat, pair, triggered)
+		}, t)
+}
+
+// VerifySSHDestinations raises an alert for each SSH client and unexpected server, keyed as "<client> -> <server>",
+// that started sessions over the last report window, and sends the recovery of those that started none. It is to be
+// called from a single goroutine.
+func (w *Watchdog) VerifySSHDestinations(ctx context.Context, sessions map[string]float64, t time.Time) {
+	triggered := t.In(w.timeZone).Format(w.timeLayout)
+	w.verifyLevels(ctx, w.sshUnknown, sessions, 1,
+		func(pair string) string {
+			return fmt.Sprintf(sshUnexpectedFormat, pair, sessions[pair], triggered)
+		},
+		func(pair string) string {
+			return fmt.Sprintf(sshUnexpectedRecoveryFormat, pair, triggered)
+		}, t)
+}
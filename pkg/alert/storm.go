@@ -0,0 +1,44 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Kinds of storms, by the destination of their frames
+const (
+	broadcastStorm = "broadcast"
+	multicastStorm = "multicast"
+)
+
+// Format strings of storm alert messages
+const (
+	stormFormat         = "Storm of %s frames on %s generated an alert - %.0f frames/s, triggered at %s"
+	stormRecoveryFormat = "Storm of %s frames on %s recovered at %s"
+)
+
+// VerifyStorms raises an alert for each interface whose rate of broadcast or multicast frames over the last report
+// window reached its threshold, and sends the recovery of those whose storm subsided. Rates are in frames per second,
+// by interface, and interfaces without any are taken as quiet. It is to be called from a single goroutine.
+func (w *Watchdog) VerifyStorms(ctx context.Context, broadcast, multicast map[string]float64, t time.Time) {
+	w.verifyStorms(ctx, broadcastStorm, broadcast, w.stormLimits.Broadcast, t)
+	w.verifyStorms(ctx, multicastStorm, multicast, w.stormLimits.Multicast, t)
+}
+
+// verifyStorms raises and recovers the storms of a kind, given the rates of the interfaces and the threshold. A
+// threshold of 0 disables the kind.
+func (w *Watchdog) verifyStorms(ctx context.Context, kind string, rates map[string]float64, threshold uint, t time.Time) {
+	if threshold == 0 {
+		return
+	}
+
+	triggered := t.In(w.timeZone).Format(w.timeLayout)
+	w.verifyLevels(ctx, w.storms[kind], rates, float64(threshold),
+		func(device string) string {
+			return fmt.Sprintf(stormFormat, kind, device, rates[device], triggered)
+		},
+		func(device string) string {
+			return fmt.Sprintf(stormRecoveryFormat, kind, device, triggered)
+		}, t)
+}
@@ -0,0 +1,26 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Format string of TLS policy alert messages
+const tlsViolationFormat = "TLS policy violation of %s seen at %s"
+
+// TLSViolation sends a notice of a TLS handshake that negotiated a version or a cipher suite the policy forbids, as
+// described
+func (w *Watchdog) TLSViolation(ctx context.Context, handshake string, t time.Time) {
+	t = t.In(w.timeZone)
+	w.send(ctx, Message{
+		ID:        atomic.AddUint64(&w.lastID, 1),
+		Recovery:  false,
+		Body:      w.decorate(fmt.Sprintf(tlsViolationFormat, handshake, t.Format(w.timeLayout))),
+		Timestamp: t,
+		Evidence:  "",
+		Notice:    true,
+		Critical:  false,
+	})
+}
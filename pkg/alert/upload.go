@@ -0,0 +1,36 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Format strings of upload alert messages
+const (
+	uploadFormat         = "Upload from %s generated an alert - %d bytes within %s, triggered at %s"
+	uploadRecoveryFormat = "Upload from %s recovered at %s"
+)
+
+// VerifyUploads raises an alert for each internal host and external destination, keyed as "<host> -> <destination>",
+// whose bytes sent over the upload span reached the threshold, and sends the recovery of those that fell below it.
+// Pairs missing from uploads are taken to have sent nothing. It is to be called from a single goroutine.
+func (w *Watchdog) VerifyUploads(ctx context.Context, uploads map[string]uint64, t time.Time) {
+	if w.uploadLimit.Threshold == 0 {
+		return
+	}
+
+	levels := make(map[string]float64, len(uploads))
+	for pair, bytes := range uploads {
+		levels[pair] = float64(bytes)
+	}
+
+	triggered := t.In(w.timeZone).Format(w.timeLayout)
+	w.verifyLevels(ctx, w.uploads, levels, float64(w.uploadLimit.Threshold),
+		func(pair string) string {
+			return fmt.Sprintf(uploadFormat, pair, uploads[pair], w.uploadLimit.Span, triggered)
+		},
+		func(pair string) string {
+			return fmt.Sprintf(uploadRecoveryFormat, pair, triggered)
+		}, t)
+}
@@ -0,0 +1,49 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Format strings of watched target alert messages
+const (
+	silentFormat              = "Watched target %s generated an alert - silent for %s, triggered at %s"
+	silentRecoveryFormat      = "Watched target %s recovered from silence at %s"
+	unreachableFormat         = "Watched target %s generated an alert - unreachable, connections refused or unanswered, triggered at %s"
+	unreachableRecoveryFormat = "Watched target %s recovered from being unreachable at %s"
+)
+
+// VerifyWatched raises an alert for each watched target silent for the configured silence or more, and for each one
+// unreachable, and sends the recovery of those seen again or answering connections again. Silences are the times
+// since traffic of targets was last seen, by target, and targets left out of unreachable answer connections. It is to
+// be called from a single goroutine.
+func (w *Watchdog) VerifyWatched(ctx context.Context, silent map[string]time.Duration, unreachable map[string]bool, t time.Time) {
+	triggered := t.In(w.timeZone).Format(w.timeLayout)
+
+	silences := make(map[string]float64, len(silent))
+	for target, silence := range silent {
+		silences[target] = silence.Seconds()
+	}
+	w.verifyLevels(ctx, w.watchSilent, silences, w.watchLimit.Silence.Seconds(),
+		func(target string) string {
+			return fmt.Sprintf(silentFormat, target, silent[target], triggered)
+		},
+		func(target string) string {
+			return fmt.Sprintf(silentRecoveryFormat, target, triggered)
+		}, t)
+
+	levels := make(map[string]float64, len(unreachable))
+	for target, down := range unreachable {
+		if down {
+			levels[target] = 1
+		}
+	}
+	w.verifyLevels(ctx, w.watchDown, levels, 1,
+		func(target string) string {
+			return fmt.Sprintf(unreachableFormat, target, triggered)
+		},
+		func(target string) string {
+			return fmt.Sprintf(unreachableRecoveryFormat, target, triggered)
+		}, t)
+}
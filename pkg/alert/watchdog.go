@@ -0,0 +1,415 @@
+// Package alert watches the rate of hits and raises alerts when it crosses a threshold
+package alert
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"sync/atomic"
+	"time"
+)
+
+// Format strings of alert messages
+const (
+	alertFormat    = "High traffic generated an alert - hits = %d, triggered at %s"
+	recoveryFormat = "Alert recovered at %s"
+	evidenceFormat = " - evidence : %s"
+	sessionFormat  = "[%s] %s"
+	nodeFormat     = "%s on node %s"
+	ruleFormat     = "gonetmon alert %d : %d hits or more over %s raise an alert. %s"
+	newHostFormat  = "New host %s first seen at %s"
+)
+
+var log = config.Logger
+
+// Message is an alert, or the recovery from one, sent to outputs
+type Message struct {
+	ID        uint64 // Identifier of the alert, shared by its recovery
+	Recovery  bool   // True if we recover from alert to no alert, false if not
+	Body      string // Message to display
+	Timestamp time.Time
+	Evidence  string // Path of the pcap file holding the packets that made the alert's hits, if any
+	Notice    bool   // Whether the message is a one-off notice, e.g. of a new host, that no recovery follows
+	Critical  bool   // Whether the alert is critical, e.g. of a spoofed gateway, for outputs to escalate
+}
+
+type hitCache struct {
+
+	// Channels to send operations on
+	push    chan time.Time
+	bufSize uint // size of channel
+
+	// Doubly linked list to hold values
+	list list.List
+
+	// Number of elements in current list
+	size uint
+}
+
+// Watchdog struct holds fifo LRU time-based cache and information necessary to watch for traffic spike
+type Watchdog struct {
+
+	// Cache to store timely identified hits and time window to keep them
+	cache     hitCache
+	timeFrame time.Duration
+	tick      time.Duration
+
+	// Threshold above which an alert will be raised, which may be changed while running
+	threshold uint64
+
+	// Channel to send alerts to
+	alertChan chan<- Message
+
+	// Current state of alert, and identifier of the last alert raised
+	alert   bool
+	alertID uint64
+
+	// Identifier of the last alert or notice raised, incremented atomically as notices are raised outside of Run
+	lastID uint64
+
+	// Rates of broadcast and multicast frames on an interface that raise a storm alert, and the identifiers of the
+	// storms in progress, by kind and interface
+	stormLimits config.StormConfig
+	storms      map[string]map[string]uint64
+
+	// Capacity of links and days ahead their saturation is alerted of, and the identifiers of the saturations forecast,
+	// by interface
+	capacity   config.CapacityConfig
+	saturation map[string]uint64
+
+	// Rules on how fast metrics of reports change, the metrics of the reports within the longest lookback, oldest
+	// first, and the identifiers of the changes in progress, by rule
+	changeRules []config.ChangeRule
+	samples     []metricSample
+	changes     map[string]uint64
+
+	// Share of corrupt packets on an interface that raises an alert, and the identifiers of the corruptions in
+	// progress, by interface
+	integrity config.IntegrityConfig
+	corrupt   map[string]uint64
+
+	// Bytes internal hosts may send to an external destination over a span, and the identifiers of the uploads
+	// past them, by host and destination
+	uploadLimit config.UploadConfig
+	uploads     map[string]uint64
+
+	// Bytes internal hosts may exchange with addresses of the countries alerted of over a report window, and the
+	// identifiers of the traffic past them, by host, address and country
+	geoLimit   config.CountryConfig
+	geoTraffic map[string]uint64
+
+	// Time without traffic past which a watched target is alerted of, and the identifiers of the silent and of the
+	// unreachable targets, by target
+	watchLimit  config.WatchConfig
+	watchSilent map[string]uint64
+	watchDown   map[string]uint64
+
+	// Share of error responses of an HTTP host that raises an alert, and the identifiers of the spikes in progress, by
+	// host
+	errorLimit config.ErrorRateConfig
+	errorRates map[string]uint64
+
+	// Jitter and loss of VoIP calls that raise an alert, and the identifiers of the degradations in progress, by call
+	callLimit  config.CallQualityConfig
+	callJitter map[string]uint64
+	callLoss   map[string]uint64
+
+	// SMTP messages a host may relay to external servers over a report window, and the identifiers of the spikes in
+	// progress, by host
+	mailLimit  config.MailConfig
+	mailSpikes map[string]uint64
+
+	// Short SSH sessions a client may open to a server over a report window, and the identifiers of the brute force
+	// attempts and of the sessions to unexpected destinations in progress, by client and server
+	sshLimit    config.SSHConfig
+	sshAttempts map[string]uint64
+	sshUnknown  map[string]uint64
+
+	// Ratio of the bytes an NTP server may send a host to those it was queried with, and the identifiers of the
+	// amplifications and of the syncs to unexpected servers in progress, by server and host
+	ntpLimit   config.NTPConfig
+	ntpAmplify map[string]uint64
+	ntpUnknown map[string]uint64
+
+	// Time zone and layout of alert timestamps
+	timeZone   *time.Location
+	timeLayout string
+
+	// Name of the monitoring session whose hits are watched, prefixed to messages. Empty for the default session.
+	session string
+
+	// Kubernetes node whose traffic is watched, appended to messages. Empty if not attributing traffic to workloads.
+	node string
+
+	// Flight recorder to dump when an alert is raised. Nil if disabled.
+	recorder    *capture.FlightRecorder
+	dumpOnAlert bool // Whether to dump all recorded packets when an alert is raised
+	evidence    bool // Whether to dump the packets that made the alert's hits, and reference them in the alert
+}
+
+// Hits returns the current number of elements in the cache
+func (w *Watchdog) Hits() int {
+	return int(w.cache.size)
+}
+
+// Threshold returns the number of hits within the alert span above which an alert is raised
+func (w *Watchdog) Threshold() uint {
+	return uint(atomic.LoadUint64(&w.threshold))
+}
+
+// SetThreshold changes the number of hits above which an alert is raised, taking effect on the next verification
+func (w *Watchdog) SetThreshold(threshold uint) {
+	atomic.StoreUint64(&w.threshold, uint64(threshold))
+}
+
+func buildAlertMsg(w *Watchdog, recovery bool, t time.Time) Message {
+
+	var message string
+
+	t = t.In(w.timeZone)
+	if recovery {
+		message = fmt.Sprintf(recoveryFormat, t.Format(w.timeLayout))
+	} else {
+		message = fmt.Sprintf(alertFormat, w.Hits(), t.Format(w.timeLayout))
+	}
+
+	return Message{
+		ID:        w.alertID,
+		Recovery:  recovery,
+		Body:      w.decorate(message),
+		Timestamp: t,
+		Evidence:  "",
+		Notice:    false,
+		Critical:  false,
+	}
+}
+
+// decorate appends the node to a message, and prefixes it with the session
+func (w *Watchdog) decorate(message string) string {
+	if w.node != "" {
+		message = fmt.Sprintf(nodeFormat, message, w.node)
+	}
+	if w.session != "" {
+		message = fmt.Sprintf(sessionFormat, w.session, message)
+	}
+
+	return message
+}
+
+// NewHost sends a notice of a host never seen before, described by host, unless ctx is cancelled first
+func (w *Watchdog) NewHost(ctx context.Context, host string, t time.Time) {
+	t = t.In(w.timeZone)
+	w.send(ctx, Message{
+		ID:        atomic.AddUint64(&w.lastID, 1),
+		Recovery:  false,
+		Body:      w.decorate(fmt.Sprintf(newHostFormat, host, t.Format(w.timeLayout))),
+		Timestamp: t,
+		Evidence:  "",
+		Notice:    true,
+		Critical:  false,
+	})
+}
+
+// hitTimes returns the capture timestamps of the hits in the cache
+func (w *Watchdog) hitTimes() []time.Time {
+	times := make([]time.Time, 0, w.cache.list.Len())
+	for e := w.cache.list.Front(); e != nil; e = e.Next() {
+		times = append(times, e.Value.(time.Time))
+	}
+	return times
+}
+
+// describeRule returns the description of the rule that raised the alert, commenting its pcapng dumps
+func (w *Watchdog) describeRule(alert Message) string {
+	return fmt.Sprintf(ruleFormat, alert.ID, w.Threshold(), w.timeFrame, alert.Body)
+}
+
+// attachEvidence dumps the recorded packets of the hits that raised the alert, and references the dump in the alert
+func (w *Watchdog) attachEvidence(alert Message) Message {
+	if w.recorder == nil || !w.evidence {
+		return alert
+	}
+
+	path, err := w.recorder.Dump("evidence", w.describeRule(alert), capture.CapturedAt(w.hitTimes()))
+	if err != nil {
+		log.Error("Could not dump alert evidence : ", err)
+		return alert
+	}
+
+	alert.Evidence = path
+	alert.Body += fmt.Sprintf(evidenceFormat, path)
+
+	return alert
+}
+
+// AddHit adds an element to the cache by sending a push request to the goroutine, unless ctx is cancelled
+func (w *Watchdog) AddHit(ctx context.Context, t time.Time) {
+	select {
+	case w.cache.push <- t:
+	case <-ctx.Done():
+	}
+}
+
+// send sends the message on the alert channel, giving up if ctx is cancelled before it is received
+func (w *Watchdog) send(ctx context.Context, msg Message) {
+	select {
+	case w.alertChan <- msg:
+	case <-ctx.Done():
+	}
+}
+
+// Verify checks the cache, raising or lowering the alert and sending a message if necessary
+func (w *Watchdog) verify(ctx context.Context) {
+
+	// If the cache is empty, no need to go further
+	if w.cache.list.Len() <= 0 {
+		// If we were previously in alert, deescalate and send recovery message
+		if w.alert {
+			w.alert = false
+			w.send(ctx, buildAlertMsg(w, true, time.Now()))
+		}
+		return
+	}
+
+	// Threshold reached
+	if uint64(w.cache.size) >= atomic.LoadUint64(&w.threshold) {
+		// New Alert
+		if !w.alert {
+			w.alert = true
+			w.alertID = atomic.AddUint64(&w.lastID, 1)
+			msg := buildAlertMsg(w, false, time.Now())
+			rule := w.describeRule(msg)
+			w.send(ctx, w.attachEvidence(msg))
+
+			// Preserve the packets surrounding the alert, without holding back the watchdog
+			if w.recorder != nil && w.dumpOnAlert {
+				go func() {
+					if _, err := w.recorder.Dump("alert", rule, nil); err != nil {
+						log.Error("Could not dump flight recorder on alert : ", err)
+					}
+				}()
+			}
+		}
+	} else {
+		// Recovery
+		if w.alert {
+			w.alert = false
+			w.send(ctx, buildAlertMsg(w, true, time.Now()))
+		}
+	}
+
+	return
+}
+
+// Evict pops all values from the cache that have passed the authorised window
+func (w *Watchdog) evict(now time.Time) {
+	for {
+
+		if w.cache.list.Len() <= 0 {
+			break
+		}
+
+		e := w.cache.list.Front()
+
+		// If the element is older than allowed window
+		if now.Sub(e.Value.(time.Time)) > w.timeFrame {
+			w.cache.list.Remove(e)
+			w.cache.size--
+		} else {
+			// Since we store timed values incrementally, following values are all still valid
+			break
+		}
+	}
+}
+
+// NewWatchdog returns a watchdog struct, whose Run method observes its cache to detect alert triggering
+func NewWatchdog(parameters *config.Parameters, recorder *capture.FlightRecorder, c chan<- Message) *Watchdog {
+	node := ""
+	if parameters.Kubernetes.Enabled {
+		node = parameters.Kubernetes.NodeName()
+	}
+
+	return &Watchdog{
+		cache: hitCache{
+			push:    make(chan time.Time, parameters.WatchdogBufSize),
+			bufSize: parameters.WatchdogBufSize,
+			list:    list.List{},
+			size:    0,
+		},
+		timeFrame:   parameters.AlertSpan,
+		tick:        parameters.WatchdogTick,
+		threshold:   uint64(parameters.AlertThreshold),
+		alertChan:   c,
+		alert:       false,
+		alertID:     0,
+		lastID:      0,
+		stormLimits: parameters.Storms,
+		storms: map[string]map[string]uint64{
+			broadcastStorm: make(map[string]uint64),
+			multicastStorm: make(map[string]uint64),
+		},
+		capacity:    parameters.Capacity,
+		saturation:  make(map[string]uint64),
+		changeRules: parameters.Changes,
+		samples:     nil,
+		changes:     make(map[string]uint64),
+		integrity:   parameters.Integrity,
+		corrupt:     make(map[string]uint64),
+		uploadLimit: parameters.Uploads,
+		uploads:     make(map[string]uint64),
+		geoLimit:    parameters.Countries,
+		geoTraffic:  make(map[string]uint64),
+		watchLimit:  parameters.Watch,
+		watchSilent: make(map[string]uint64),
+		watchDown:   make(map[string]uint64),
+		errorLimit:  parameters.ErrorRates,
+		errorRates:  make(map[string]uint64),
+		callLimit:   parameters.CallQuality,
+		callJitter:  make(map[string]uint64),
+		callLoss:    make(map[string]uint64),
+		mailLimit:   parameters.Mail,
+		mailSpikes:  make(map[string]uint64),
+		sshLimit:    parameters.SSH,
+		sshAttempts: make(map[string]uint64),
+		sshUnknown:  make(map[string]uint64),
+		ntpLimit:    parameters.NTP,
+		ntpAmplify:  make(map[string]uint64),
+		ntpUnknown:  make(map[string]uint64),
+		timeZone:    parameters.TimeZone,
+		timeLayout:  parameters.TimeLayout,
+		session:     parameters.Session,
+		node:        node,
+		recorder:    recorder,
+		dumpOnAlert: parameters.FlightRecorder.OnAlert,
+		evidence:    parameters.FlightRecorder.Evidence,
+	}
+}
+
+// Run continuously verifies the cache and informs about alert status, until ctx is cancelled
+func (w *Watchdog) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+
+		// Exit trigger
+		case <-ctx.Done():
+			log.Info("Watchdog terminating.")
+			return nil
+
+		// Continuously evict old elements
+		case t := <-ticker.C:
+			w.evict(t)
+			w.verify(ctx)
+
+		// Push request
+		case p := <-w.cache.push:
+			w.cache.list.PushBack(p)
+			w.cache.size++
+			w.verify(ctx)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package analysis
+
+import (
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Event is a piece of application traffic recognised by an analyzer in a captured packet
+type Event struct {
+	Analyzer   string            // Name of the analyzer that produced the event
+	Type       string            // Kind of event, specific to the analyzer, e.g. request or query
+	Device     string            // Interface on which the packet was captured
+	RemoteIP   string            // IP address of the remote peer
+	Host       string            // Domain name the event relates to, if known
+	Hit        bool              // Whether the event is a hit, accounted in reports and towards the alert threshold
+	Timestamp  time.Time         // Capture timestamp of the packet
+	Attributes map[string]string // Analyzer specific details, e.g. the method of an HTTP request
+	Length     int               // Length on the wire of the packet the event was extracted from
+}
+
+// Analyzer interprets captured packets of an application protocol into events. Analyzers implementing io.Closer
+// are closed once monitoring stops.
+type Analyzer interface {
+	// Name returns the name the analyzer is registered and enabled under
+	Name() string
+
+	// Match tells whether the packet is of interest to the analyzer
+	Match(data *capture.PacketMsg) bool
+
+	// Process extracts events from a matching packet. The packet's payload is recycled once processed, and must not be
+	// referenced by the events.
+	Process(data *capture.PacketMsg) ([]*Event, error)
+}
+
+// AnalyzerFactory returns a new analyzer configured from parameters
+type AnalyzerFactory func(parameters *config.Parameters) (Analyzer, error)
+
+// Analyzers available to be enabled in parameters, indexed by name
+var (
+	registryMutex sync.Mutex
+	registry      = map[string]AnalyzerFactory{
+		config.HTTPAnalyzer:      newHTTPAnalyzer,
+		config.DNSAnalyzer:       newDNSAnalyzer,
+		config.TLSAnalyzer:       newTLSAnalyzer,
+		config.OSAnalyzer:        newOSAnalyzer,
+		config.DiscoveryAnalyzer: newDiscoveryAnalyzer,
+		config.VoIPAnalyzer:      newVoIPAnalyzer,
+		config.MailAnalyzer:      newMailAnalyzer,
+		config.SSHAnalyzer:       newSSHAnalyzer,
+		config.NTPAnalyzer:       newNTPAnalyzer,
+		config.ARPAnalyzer:       newARPAnalyzer,
+		config.MTUAnalyzer:       newMTUAnalyzer,
+		config.StallAnalyzer:     newStallAnalyzer,
+	}
+)
+
+// RegisterAnalyzer makes an analyzer available under name, to be enabled in parameters.
+// It panics if the name is already registered, and is meant to be called at start up, e.g. from init functions.
+func RegisterAnalyzer(name string, factory AnalyzerFactory) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if factory == nil {
+		panic("analysis: RegisterAnalyzer factory is nil")
+	}
+	if _, ok := registry[name]; ok {
+		panic("analysis: RegisterAnalyzer called twice for analyzer " + name)
+	}
+
+	registry[name] = factory
+}
+
+// RegisteredAnalyzers returns the sorted names of the analyzers available to be enabled
+func RegisteredAnalyzers() []string {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// NewAnalyzers returns the analyzers enabled in parameters, in the configured order
+func NewAnalyzers(parameters *config.Parameters) ([]Analyzer, error) {
+	if len(parameters.Analyzers) == 0 {
+		return nil, fmt.Errorf("no analyzer configured, among : %s", RegisteredAnalyzers())
+	}
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	analyzers := make([]Analyzer, 0, len(parameters.Analyzers))
+	ready := false
+	defer func() {
+		// Release the analyzers already set up if one of them fails
+		if !ready {
+			CloseAnalyzers(analyzers)
+		}
+	}()
+
+	for _, name := range parameters.Analyzers {
+		factory, ok := registry[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown analyzer : %s", name)
+		}
+
+		analyzer, err := factory(parameters)
+		if err != nil {
+			return nil, fmt.Errorf("could not set up %s analyzer : %s", name, err)
+		}
+
+		analyzers = append(analyzers, analyzer)
+	}
+	ready = true
+
+	return analyzers, nil
+}
+
+// CloseAnalyzers releases the analyzers holding resources, e.g. external processes, which implement io.Closer
+func CloseAnalyzers(analyzers []Analyzer) {
+	for _, analyzer := range analyzers {
+		if closer, ok := analyzer.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.Error("Could not close analyzer ", analyzer.Name(), " : ", err)
+			}
+		}
+	}
+}
+
+// newEvent returns an event of the given analyzer and type for the captured packet, with empty attributes
+func newEvent(analyzer, eventType string, data *capture.PacketMsg, hit bool) *Event {
+	return &Event{
+		Analyzer:   analyzer,
+		Type:       eventType,
+		Device:     data.Device,
+		RemoteIP:   data.RemoteIP,
+		Host:       "",
+		Hit:        hit,
+		Timestamp:  data.Timestamp,
+		Attributes: make(map[string]string),
+		Length:     data.Length,
+	}
+}
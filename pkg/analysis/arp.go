@@ -0,0 +1,133 @@
+package analysis
+
+import (
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/inventory"
+	"net"
+	"time"
+)
+
+const (
+	// Types of ARP events
+	arpConflict = "conflict" // An IP address is claimed by another hardware address within the window, e.g. ARP spoofing
+	arpGateway  = "gateway"  // The hardware address of a gateway changes
+
+	// Attributes of ARP events
+	arpIP             = "ip"              // IP address claimed
+	arpMAC            = "mac"             // Hardware address now claiming it
+	arpVendor         = "vendor"          // Vendor of the hardware address now claiming it, empty if unknown
+	arpPrevious       = "previous"        // Hardware address that claimed it before
+	arpPreviousVendor = "previous_vendor" // Vendor of the hardware address that claimed it before, empty if unknown
+
+	// Bound of the IP addresses followed, past which those not claimed within the window are forgotten, but for
+	// gateways, and new ones are ignored if none is
+	maxARPBindings = 65536
+)
+
+// arpAnalyzer follows the hardware addresses ARP senders claim their IP addresses for, telling of an address claimed by
+// another within the window, as ARP spoofing or a duplicate address make it, and of a gateway changing hardware address
+type arpAnalyzer struct {
+	bindings map[string]*arpBinding // Last hardware address claiming each IP address
+	window   time.Duration          // Time frame within which another hardware address claiming an IP address conflicts
+	gateways []*net.IPNet           // Gateways, whose hardware address changing at any time is reported
+	vendors  map[string]string      // Vendors of hardware address prefixes. Nil if they could not be loaded.
+}
+
+// arpBinding is the hardware address that last claimed an IP address
+type arpBinding struct {
+	mac  [6]byte
+	seen time.Time
+}
+
+// newARPAnalyzer returns an ARP analyzer, naming vendors from the file of the inventory
+func newARPAnalyzer(parameters *config.Parameters) (Analyzer, error) {
+	gateways, err := ParseAddresses(parameters.ARP.Gateways)
+	if err != nil {
+		return nil, err
+	}
+
+	// Conflicts are reported without vendors if they cannot be named
+	var vendors map[string]string
+	if parameters.Inventory.Vendors != "" {
+		if vendors, err = inventory.LoadVendors(parameters.Inventory.Vendors); err != nil {
+			log.Warn("Could not load the vendors of hardware addresses, ARP conflicts are reported without them : ", err)
+		}
+	}
+
+	return &arpAnalyzer{
+		bindings: make(map[string]*arpBinding),
+		window:   parameters.ARP.Window,
+		gateways: gateways,
+		vendors:  vendors,
+	}, nil
+}
+
+// Name returns the name of the ARP analyzer
+func (a *arpAnalyzer) Name() string {
+	return config.ARPAnalyzer
+}
+
+// Match tells whether the packet is an ARP request or reply whose sender claims an IP address, leaving out probes
+func (a *arpAnalyzer) Match(data *capture.PacketMsg) bool {
+	return data.ARP != nil && data.ARP.SenderIP != "0.0.0.0" && data.ARP.SenderMAC != [6]byte{}
+}
+
+// Process binds the IP address of the sender to its hardware address, returning the event of a conflict or of a gateway
+// changing hardware address if it was bound to another
+func (a *arpAnalyzer) Process(data *capture.PacketMsg) ([]*Event, error) {
+	ip, mac := data.ARP.SenderIP, data.ARP.SenderMAC
+
+	binding, ok := a.bindings[ip]
+	if !ok {
+		if len(a.bindings) >= maxARPBindings {
+			a.expire(data.Timestamp)
+			if len(a.bindings) >= maxARPBindings {
+				return nil, nil
+			}
+		}
+		a.bindings[ip] = &arpBinding{mac: mac, seen: data.Timestamp}
+		return nil, nil
+	}
+
+	previous, since := binding.mac, data.Timestamp.Sub(binding.seen)
+	binding.mac, binding.seen = mac, data.Timestamp
+	if previous == mac {
+		return nil, nil
+	}
+
+	eventType := arpConflict
+	if containsIP(a.gateways, net.ParseIP(ip)) {
+		eventType = arpGateway
+	} else if since > a.window {
+		// The address was handed over, e.g. by DHCP
+		return nil, nil
+	}
+
+	event := newEvent(config.ARPAnalyzer, eventType, data, false)
+	event.Attributes[arpIP] = ip
+	event.Attributes[arpMAC] = net.HardwareAddr(mac[:]).String()
+	event.Attributes[arpVendor] = a.vendor(event.Attributes[arpMAC])
+	event.Attributes[arpPrevious] = net.HardwareAddr(previous[:]).String()
+	event.Attributes[arpPreviousVendor] = a.vendor(event.Attributes[arpPrevious])
+
+	return []*Event{event}, nil
+}
+
+// vendor returns the vendor the hardware address was assigned to, empty if unknown
+func (a *arpAnalyzer) vendor(mac string) string {
+	if len(mac) < 8 {
+		return ""
+	}
+
+	return a.vendors[mac[:8]]
+}
+
+// expire forgets the IP addresses not claimed within the window at t, but for those of gateways
+func (a *arpAnalyzer) expire(t time.Time) {
+	for ip, binding := range a.bindings {
+		if t.Sub(binding.seen) > a.window && !containsIP(a.gateways, net.ParseIP(ip)) {
+			delete(a.bindings, ip)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package analysis
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Categories of the content of HTTP responses
+const (
+	contentJSON     = "json"
+	contentHTML     = "html"
+	contentScript   = "javascript"
+	contentStyle    = "css"
+	contentXML      = "xml"
+	contentText     = "text"
+	contentImage    = "image"
+	contentVideo    = "video"
+	contentAudio    = "audio"
+	contentFont     = "font"
+	contentDownload = "download"
+	contentOther    = "other"
+	contentUnknown  = "none"
+)
+
+// Media types of downloads, besides those of attachments
+var downloadTypes = map[string]bool{
+	"application/octet-stream":              true,
+	"application/zip":                       true,
+	"application/gzip":                      true,
+	"application/x-gzip":                    true,
+	"application/x-tar":                     true,
+	"application/x-7z-compressed":           true,
+	"application/x-rar-compressed":          true,
+	"application/vnd.rar":                   true,
+	"application/x-bzip2":                   true,
+	"application/x-xz":                      true,
+	"application/pdf":                       true,
+	"application/java-archive":              true,
+	"application/x-msdownload":              true,
+	"application/x-apple-diskimage":         true,
+	"application/x-iso9660-image":           true,
+	"application/vnd.debian.binary-package": true,
+}
+
+// contentCategory returns the category of the content of an HTTP response, from its Content-Type and
+// Content-Disposition headers, e.g. json, video or download
+func contentCategory(header http.Header) string {
+	if strings.HasPrefix(strings.ToLower(strings.TrimSpace(header.Get("Content-Disposition"))), "attachment") {
+		return contentDownload
+	}
+
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		return contentUnknown
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentOther
+	}
+
+	// Structured syntax suffixes, e.g. application/problem+json, tell the format of specific types
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return contentJSON
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		return contentHTML
+	case mediaType == "text/javascript" || mediaType == "application/javascript" ||
+		mediaType == "application/x-javascript" || mediaType == "application/ecmascript":
+		return contentScript
+	case mediaType == "text/css":
+		return contentStyle
+	case strings.HasSuffix(mediaType, "mpegurl") || mediaType == "application/dash+xml":
+		// Playlists of HLS and DASH streams
+		return contentVideo
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return contentXML
+	case downloadTypes[mediaType]:
+		return contentDownload
+	}
+
+	top := mediaType
+	if i := strings.IndexByte(mediaType, '/'); i >= 0 {
+		top = mediaType[:i]
+	}
+	switch top {
+	case "text":
+		return contentText
+	case "image":
+		return contentImage
+	case "video":
+		return contentVideo
+	case "audio":
+		return contentAudio
+	case "font":
+		return contentFont
+	}
+
+	return contentOther
+}
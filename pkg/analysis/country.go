@@ -0,0 +1,107 @@
+package analysis
+
+import (
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/geoip"
+	"github.com/bytemare/gonetmon/pkg/inventory"
+	"net"
+	"strings"
+)
+
+// Bounds the cache of the countries of addresses, past which it is emptied
+const maxCountryAddresses = 65536
+
+// countryTracker sums the bytes internal hosts exchange with addresses of the countries alerted of over each report
+// window, from the flows of reports
+type countryTracker struct {
+	database  *geoip.Database
+	countries map[string]bool   // ISO 3166 codes of the countries alerted of
+	internal  []*net.IPNet      // Networks of internal hosts
+	allowed   []*net.IPNet      // Addresses left out, e.g. of CDNs
+	parsed    map[string]string // Countries of external addresses alerted of, empty for others, cached across windows
+}
+
+// newCountryTracker returns a tracker of the countries configured, whose networks are checked and whose GeoIP database
+// is loaded
+func newCountryTracker(countries *config.CountryConfig) (*countryTracker, error) {
+	// Internal hosts are those of private and link-local networks unless told otherwise, as for uploads
+	internal, err := inventory.ParseNetworks(nil)
+	if len(countries.Internal) > 0 {
+		internal, err = ParseAddresses(countries.Internal)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := ParseAddresses(countries.Allowed)
+	if err != nil {
+		return nil, err
+	}
+
+	database, err := geoip.Load(countries.Database)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Loaded ", database.Len(), " ranges of addresses from the GeoIP database ", countries.Database)
+
+	c := &countryTracker{
+		database:  database,
+		countries: make(map[string]bool, len(countries.Countries)),
+		internal:  internal,
+		allowed:   allowed,
+		parsed:    make(map[string]string),
+	}
+	for _, country := range countries.Countries {
+		c.countries[strings.ToUpper(country)] = true
+	}
+
+	return c, nil
+}
+
+// add returns the bytes internal hosts exchanged with addresses of the countries alerted of in the flows of the
+// report, keyed as "<host> -> <address> (<country>)". Traffic with allowed addresses is left out.
+func (c *countryTracker) add(report *Report) map[string]uint64 {
+	traffic := make(map[string]uint64)
+	for _, flow := range report.Flows {
+		host, remote := flow.SrcIP, flow.DstIP
+		if c.isInternal(remote) {
+			host, remote = remote, host
+		}
+		if !c.isInternal(host) {
+			continue
+		}
+
+		if country := c.country(remote); country != "" {
+			traffic[host+" -> "+remote+" ("+country+")"] += flow.SrcBytes + flow.DstBytes
+		}
+	}
+
+	return traffic
+}
+
+// isInternal tells whether the address belongs to an internal network
+func (c *countryTracker) isInternal(address string) bool {
+	return containsIP(c.internal, net.ParseIP(address))
+}
+
+// country returns the country of the external address if it is alerted of and the address is not allowed, and an
+// empty string otherwise
+func (c *countryTracker) country(address string) string {
+	country, ok := c.parsed[address]
+	if ok {
+		return country
+	}
+
+	if len(c.parsed) >= maxCountryAddresses {
+		c.parsed = make(map[string]string)
+	}
+	country = ""
+	if ip := net.ParseIP(address); ip != nil && !containsIP(c.allowed, ip) {
+		if code := c.database.Country(ip); c.countries[code] {
+			country = code
+		}
+	}
+	c.parsed[address] = country
+
+	return country
+}
@@ -0,0 +1,388 @@
+package analysis
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/diagnostics"
+	"github.com/bytemare/gonetmon/pkg/keylog"
+	"hash"
+	"net"
+	"time"
+)
+
+// Activity of TLS decryption, published by the diagnostics server
+var (
+	decryptedRecords       = diagnostics.NewCounter("analysis.tls.decrypted")   // Application data records decrypted
+	undecryptedConnections = diagnostics.NewCounter("analysis.tls.undecrypted") // Connections given up, e.g. for lack of secrets or captured segments
+)
+
+const (
+	// TLS record types
+	tlsRecordChangeCipherSpec = 0x14
+	tlsRecordApplicationData  = 0x17
+
+	// Lengths of the parts of AES-GCM records
+	gcmExplicitNonceLength = 8  // Explicit part of the nonce of TLS 1.2 records
+	gcmFixedIVLength       = 4  // Implicit part of the nonce of TLS 1.2 records
+	gcmIVLength            = 12 // Nonce of TLS 1.3 records
+	gcmTagLength           = 16
+
+	// Longest TLS record, with its header and the expansion of encryption
+	maxTLSRecord = tlsRecordHeaderLength + 1<<14 + 2048
+
+	// Bounds of the connections decrypted, past which those idle for the timeout are forgotten, and new ones are
+	// ignored if none is
+	maxDecryptedConnections = 4096
+	decryptionTimeout       = 10 * time.Minute
+)
+
+var errTLSDecryption = errors.New("could not decrypt TLS record")
+
+// AES-GCM cipher suites that can be decrypted, by value on the wire
+var decryptableSuites = map[uint16]struct {
+	keyLength int
+	hash      func() hash.Hash
+}{
+	tls.TLS_RSA_WITH_AES_128_GCM_SHA256:         {keyLength: 16, hash: sha256.New},
+	tls.TLS_RSA_WITH_AES_256_GCM_SHA384:         {keyLength: 32, hash: sha512.New384},
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:   {keyLength: 16, hash: sha256.New},
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384:   {keyLength: 32, hash: sha512.New384},
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256: {keyLength: 16, hash: sha256.New},
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384: {keyLength: 32, hash: sha512.New384},
+	tls.TLS_AES_128_GCM_SHA256:                  {keyLength: 16, hash: sha256.New},
+	tls.TLS_AES_256_GCM_SHA384:                  {keyLength: 32, hash: sha512.New384},
+}
+
+// tlsDecrypter follows the TLS connections of the services whose traffic is decrypted, and decrypts their application
+// data records with the secrets of the key log, for analyzers to read the plaintext. Segments are expected in order:
+// a connection missing some, or whose records cannot be decrypted, is given up.
+type tlsDecrypter struct {
+	keys        *keylog.Log
+	servers     []*net.IPNet              // Services whose traffic is decrypted
+	connections map[string]*tlsConnection // Connections followed, by stream
+}
+
+// tlsConnection is a TLS connection followed since its ClientHello
+type tlsConnection struct {
+	server       string // Endpoint of the server, as <ip>:<port>
+	clientRandom []byte
+	serverRandom []byte
+	version      uint16 // Version negotiated, 0 until the ServerHello
+	suite        uint16 // Cipher suite negotiated
+	keyed        bool   // Whether the keys of both directions were derived
+	directions   [2]tlsDirection
+	seen         time.Time
+}
+
+// Directions of the traffic of a connection
+const (
+	fromClient = 0
+	fromServer = 1
+)
+
+// tlsDirection is the traffic of a TLS connection in one direction
+type tlsDirection struct {
+	next      uint32 // Sequence number of the next byte expected
+	started   bool   // Whether a segment with a payload was seen
+	buffer    []byte // Bytes of the record not yet complete
+	encrypted bool   // Whether records are encrypted. TLS 1.2 only, from ChangeCipherSpec on.
+	aead      cipher.AEAD
+	iv        []byte
+	sequence  uint64 // Sequence number of the next record, in the nonce or the additional data
+	opened    bool   // Whether a record was decrypted. TLS 1.3 only, as records of the handshake are skipped.
+}
+
+// newTLSDecrypter returns a decrypter of the TLS traffic of the services of decryption, with the secrets of the log
+func newTLSDecrypter(decryption *config.DecryptionConfig, keys *keylog.Log) (*tlsDecrypter, error) {
+	servers, err := ParseAddresses(decryption.Servers)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tlsDecrypter{
+		keys:        keys,
+		servers:     servers,
+		connections: make(map[string]*tlsConnection),
+	}, nil
+}
+
+// decrypt follows the TLS connection of the packet and returns the plaintext of the application data records it
+// completes, nil if none
+func (d *tlsDecrypter) decrypt(data *capture.PacketMsg) []byte {
+	payload := tcpPayload(data)
+	key := streamKey(data)
+	conn, ok := d.connections[key]
+	if !ok {
+		if len(payload) <= tlsRecordHeaderLength || payload[0] != tlsRecordHandshake ||
+			payload[tlsRecordHeaderLength] != tlsClientHelloType || !containsIP(d.servers, net.ParseIP(data.DstIP)) {
+			return nil
+		}
+		if len(d.connections) >= maxDecryptedConnections {
+			d.expire(data.Timestamp)
+			if len(d.connections) >= maxDecryptedConnections {
+				return nil
+			}
+		}
+		conn = &tlsConnection{server: endpoint(data.DstIP, data.DstPort)}
+		d.connections[key] = conn
+	}
+	conn.seen = data.Timestamp
+
+	if data.FIN || data.RST {
+		defer delete(d.connections, key)
+	}
+	if len(payload) == 0 {
+		return nil
+	}
+
+	direction := &conn.directions[fromClient]
+	if endpoint(data.SrcIP, data.SrcPort) == conn.server {
+		direction = &conn.directions[fromServer]
+	}
+
+	// Retransmitted bytes are left out, and a gap in the stream ends its decryption
+	if !direction.started {
+		direction.started, direction.next = true, data.Seq
+	}
+	if offset := direction.next - data.Seq; offset != 0 {
+		if int32(offset) < 0 {
+			d.giveUp(key)
+			return nil
+		}
+		if int(offset) >= len(payload) {
+			return nil
+		}
+		payload = payload[offset:]
+	}
+	direction.next += uint32(len(payload))
+
+	direction.buffer = append(direction.buffer, payload...)
+	plaintext, err := conn.records(direction, d.keys)
+	if err != nil || len(direction.buffer) > maxTLSRecord {
+		d.giveUp(key)
+		return nil
+	}
+
+	return plaintext
+}
+
+// giveUp stops following the connection
+func (d *tlsDecrypter) giveUp(key string) {
+	delete(d.connections, key)
+	undecryptedConnections.Inc()
+}
+
+// records reads the complete records of the buffer of the direction, returning the plaintext of those of application
+// data. Handshake records in clear tell the randoms and the cipher suite, with which keys are derived.
+func (c *tlsConnection) records(direction *tlsDirection, keys *keylog.Log) ([]byte, error) {
+	var plaintext []byte
+	for len(direction.buffer) >= tlsRecordHeaderLength {
+		length := int(binary.BigEndian.Uint16(direction.buffer[3:]))
+		if len(direction.buffer) < tlsRecordHeaderLength+length {
+			break
+		}
+		header := direction.buffer[:tlsRecordHeaderLength]
+		body := direction.buffer[tlsRecordHeaderLength : tlsRecordHeaderLength+length]
+
+		switch {
+		case direction.encrypted || (c.version == tls.VersionTLS13 && header[0] == tlsRecordApplicationData):
+			if !c.keyed {
+				if err := c.deriveKeys(keys); err != nil {
+					return nil, err
+				}
+			}
+			recordType, data, err := direction.open(c.version, header, body)
+			if err != nil {
+				return nil, err
+			}
+			if recordType == tlsRecordApplicationData {
+				plaintext = append(plaintext, data...)
+				decryptedRecords.Inc()
+			}
+		case header[0] == tlsRecordChangeCipherSpec && c.version != tls.VersionTLS13:
+			direction.encrypted = true
+		case header[0] == tlsRecordHandshake:
+			c.handshake(body)
+		}
+
+		direction.buffer = direction.buffer[tlsRecordHeaderLength+length:]
+	}
+
+	// The buffer is reused for the rest of the next record
+	direction.buffer = append(direction.buffer[:0:0], direction.buffer...)
+
+	return plaintext, nil
+}
+
+// handshake reads the randoms of the hellos of a handshake record in clear, and the version and the cipher suite the
+// server negotiated
+func (c *tlsConnection) handshake(body []byte) {
+	// Handshake type (1), length (3), version (2) and random (32)
+	if len(body) < 6+32 {
+		return
+	}
+
+	switch body[0] {
+	case tlsClientHelloType:
+		c.clientRandom = append([]byte(nil), body[6:38]...)
+	case tlsServerHelloType:
+		c.serverRandom = append([]byte(nil), body[6:38]...)
+		c.version, c.suite, _ = parseServerHello(body)
+	}
+}
+
+// deriveKeys derives the keys of both directions from the secrets the key log holds for the connection
+func (c *tlsConnection) deriveKeys(keys *keylog.Log) error {
+	suite, ok := decryptableSuites[c.suite]
+	if !ok || c.clientRandom == nil || c.serverRandom == nil {
+		return errTLSDecryption
+	}
+	secrets, ok := keys.Lookup(c.clientRandom)
+	if !ok {
+		return errTLSDecryption
+	}
+
+	var clientKey, serverKey, clientIV, serverIV []byte
+	switch {
+	case c.version == tls.VersionTLS13 && secrets.Client != nil && secrets.Server != nil:
+		clientKey = hkdfExpandLabel(suite.hash, secrets.Client, "key", suite.keyLength)
+		clientIV = hkdfExpandLabel(suite.hash, secrets.Client, "iv", gcmIVLength)
+		serverKey = hkdfExpandLabel(suite.hash, secrets.Server, "key", suite.keyLength)
+		serverIV = hkdfExpandLabel(suite.hash, secrets.Server, "iv", gcmIVLength)
+	case c.version == tls.VersionTLS12 && secrets.Master != nil:
+		// Keys, then implicit nonces, client first. AEAD suites have no MAC keys.
+		seed := append(append([]byte(nil), c.serverRandom...), c.clientRandom...)
+		block := prf12(suite.hash, secrets.Master, "key expansion", seed, 2*suite.keyLength+2*gcmFixedIVLength)
+		clientKey, block = block[:suite.keyLength], block[suite.keyLength:]
+		serverKey, block = block[:suite.keyLength], block[suite.keyLength:]
+		clientIV, serverIV = block[:gcmFixedIVLength], block[gcmFixedIVLength:]
+	default:
+		return errTLSDecryption
+	}
+
+	for i, key := range [][]byte{clientKey, serverKey} {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return err
+		}
+		if c.directions[i].aead, err = cipher.NewGCM(block); err != nil {
+			return err
+		}
+	}
+	c.directions[fromClient].iv, c.directions[fromServer].iv = clientIV, serverIV
+	c.keyed = true
+
+	return nil
+}
+
+// open decrypts the record, returning its type and its plaintext. TLS 1.3 records failing to decrypt before any was
+// are taken for those of the handshake, which application traffic keys do not protect, and left out.
+func (d *tlsDirection) open(version uint16, header, body []byte) (byte, []byte, error) {
+	var sequence [8]byte
+	binary.BigEndian.PutUint64(sequence[:], d.sequence)
+
+	if version == tls.VersionTLS13 {
+		nonce := append([]byte(nil), d.iv...)
+		for i := range sequence {
+			nonce[len(nonce)-8+i] ^= sequence[i]
+		}
+		plaintext, err := d.aead.Open(nil, nonce, body, header)
+		if err != nil {
+			if !d.opened {
+				return 0, nil, nil
+			}
+			return 0, nil, errTLSDecryption
+		}
+		d.opened = true
+		d.sequence++
+
+		// The type follows the content, then padding
+		end := len(plaintext) - 1
+		for end >= 0 && plaintext[end] == 0 {
+			end--
+		}
+		if end < 0 {
+			return 0, nil, errTLSDecryption
+		}
+		return plaintext[end], plaintext[:end], nil
+	}
+
+	if len(body) < gcmExplicitNonceLength+gcmTagLength {
+		return 0, nil, errTLSDecryption
+	}
+	nonce := append(append([]byte(nil), d.iv...), body[:gcmExplicitNonceLength]...)
+	additional := make([]byte, 0, 13)
+	additional = append(additional, sequence[:]...)
+	additional = append(additional, header[:3]...)
+	additional = append(additional, byte((len(body)-gcmExplicitNonceLength-gcmTagLength)>>8),
+		byte(len(body)-gcmExplicitNonceLength-gcmTagLength))
+
+	plaintext, err := d.aead.Open(nil, nonce, body[gcmExplicitNonceLength:], additional)
+	if err != nil {
+		return 0, nil, errTLSDecryption
+	}
+	d.sequence++
+
+	return header[0], plaintext, nil
+}
+
+// expire forgets the connections idle for the timeout at t
+func (d *tlsDecrypter) expire(t time.Time) {
+	for key, conn := range d.connections {
+		if t.Sub(conn.seen) >= decryptionTimeout {
+			delete(d.connections, key)
+		}
+	}
+}
+
+// prf12 is the pseudorandom function of TLS 1.2, of RFC 5246, returning length bytes
+func prf12(h func() hash.Hash, secret []byte, label string, seed []byte, length int) []byte {
+	seed = append([]byte(label), seed...)
+	mac := hmac.New(h, secret)
+
+	var result []byte
+	a := seed
+	for len(result) < length {
+		mac.Reset()
+		mac.Write(a)
+		a = mac.Sum(nil)
+
+		mac.Reset()
+		mac.Write(a)
+		mac.Write(seed)
+		result = mac.Sum(result)
+	}
+
+	return result[:length]
+}
+
+// hkdfExpandLabel is the HKDF-Expand-Label function of TLS 1.3, of RFC 8446, with an empty context
+func hkdfExpandLabel(h func() hash.Hash, secret []byte, label string, length int) []byte {
+	label = "tls13 " + label
+	info := make([]byte, 0, 4+len(label))
+	info = append(info, byte(length>>8), byte(length), byte(len(label)))
+	info = append(info, label...)
+	info = append(info, 0)
+
+	// HKDF-Expand of RFC 5869
+	mac := hmac.New(h, secret)
+	var result, t []byte
+	for counter := byte(1); len(result) < length; counter++ {
+		mac.Reset()
+		mac.Write(t)
+		mac.Write(info)
+		mac.Write([]byte{counter})
+		t = mac.Sum(nil)
+		result = append(result, t...)
+	}
+
+	return result[:length]
+}
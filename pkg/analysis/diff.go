@@ -0,0 +1,143 @@
+package analysis
+
+import (
+	"sort"
+)
+
+// Number of hosts listed under each change of a report's diff, and of top talkers compared between reports
+const diffHosts = 5
+
+// ReportDiff holds what changed in a report since the previous one
+type ReportDiff struct {
+	Hits   int         // Hits of the report less those of the previous one
+	Bytes  int64       // Bytes of the report less those of the previous one
+	Flows  int         // Flows of the report less those of the previous one
+	New    []HostDelta // Top talkers of the report that were not among those of the previous one, the most bytes first
+	Gone   []HostDelta // Top talkers of the previous report that sent nothing during this one, the most bytes first
+	Rising []HostDelta // Hosts whose bytes sent grew the most since the previous report, the largest increase first
+}
+
+// HostDelta holds the bytes a host sent during a report window and the previous one
+type HostDelta struct {
+	IP     string
+	Name   string // Friendly name a discovery protocol gave the host, empty if none
+	Before uint64 // Bytes sent during the previous window
+	After  uint64 // Bytes sent during the window
+}
+
+// reportDiffer tells what changed in each report since the previous one, from their totals and flows
+type reportDiffer struct {
+	previous *diffWindow // Previous report's window. Nil until a report is added.
+}
+
+// diffWindow holds the totals and the bytes sent by each host of a report window
+type diffWindow struct {
+	hits    int
+	bytes   uint64
+	flows   int
+	talkers map[string]uint64 // Bytes sent, by IP address
+	names   map[string]string // Friendly names of hosts, by IP address
+	top     []string          // Top talkers, the most bytes first
+}
+
+// newReportDiffer returns a differ of reports, which has not seen any yet
+func newReportDiffer() *reportDiffer {
+	return &reportDiffer{previous: nil}
+}
+
+// add returns what changed in the report since the one added before it, nil for the first one
+func (d *reportDiffer) add(report *Report) *ReportDiff {
+	window := &diffWindow{
+		hits:    report.Hits,
+		bytes:   report.Bytes,
+		flows:   len(report.Flows),
+		talkers: make(map[string]uint64),
+		names:   make(map[string]string),
+		top:     nil,
+	}
+	for _, flow := range report.Flows {
+		window.talkers[flow.SrcIP] += flow.SrcBytes
+		window.talkers[flow.DstIP] += flow.DstBytes
+		if flow.SrcName != "" {
+			window.names[flow.SrcIP] = flow.SrcName
+		}
+		if flow.DstName != "" {
+			window.names[flow.DstIP] = flow.DstName
+		}
+	}
+	window.top = topTalkers(window.talkers)
+
+	previous := d.previous
+	d.previous = window
+	if previous == nil {
+		return nil
+	}
+
+	diff := &ReportDiff{
+		Hits:   window.hits - previous.hits,
+		Bytes:  int64(window.bytes) - int64(previous.bytes),
+		Flows:  window.flows - previous.flows,
+		New:    nil,
+		Gone:   nil,
+		Rising: nil,
+	}
+	delta := func(ip string) HostDelta {
+		name := window.names[ip]
+		if name == "" {
+			name = previous.names[ip]
+		}
+		return HostDelta{IP: ip, Name: name, Before: previous.talkers[ip], After: window.talkers[ip]}
+	}
+
+	wasTop := make(map[string]bool, len(previous.top))
+	for _, ip := range previous.top {
+		wasTop[ip] = true
+		if window.talkers[ip] == 0 {
+			diff.Gone = append(diff.Gone, delta(ip))
+		}
+	}
+	for _, ip := range window.top {
+		if !wasTop[ip] {
+			diff.New = append(diff.New, delta(ip))
+		}
+	}
+
+	for ip, bytes := range window.talkers {
+		if bytes > previous.talkers[ip] {
+			diff.Rising = append(diff.Rising, delta(ip))
+		}
+	}
+	sort.Slice(diff.Rising, func(i, j int) bool {
+		gi, gj := diff.Rising[i].After-diff.Rising[i].Before, diff.Rising[j].After-diff.Rising[j].Before
+		if gi != gj {
+			return gi > gj
+		}
+		return diff.Rising[i].IP < diff.Rising[j].IP
+	})
+	if len(diff.Rising) > diffHosts {
+		diff.Rising = diff.Rising[:diffHosts]
+	}
+
+	return diff
+}
+
+// topTalkers returns the addresses that sent the most bytes, the most first, leaving out those that sent nothing
+func topTalkers(talkers map[string]uint64) []string {
+	top := make([]string, 0, len(talkers))
+	for ip, bytes := range talkers {
+		if bytes > 0 {
+			top = append(top, ip)
+		}
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if talkers[top[i]] != talkers[top[j]] {
+			return talkers[top[i]] > talkers[top[j]]
+		}
+		return top[i] < top[j]
+	})
+	if len(top) > diffHosts {
+		top = top[:diffHosts]
+	}
+
+	return top
+}
@@ -0,0 +1,270 @@
+package analysis
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	// Types of discovery events, by protocol
+	discoveryMDNS    = "mdns"
+	discoverySSDP    = "ssdp"
+	discoveryNetBIOS = "netbios"
+
+	// Attributes of discovery events
+	discoveryServices = "services"
+	discoveryServer   = "server"
+
+	// Ports discovery protocols are exchanged on over UDP
+	mdnsPort    = 5353
+	ssdpPort    = 1900
+	netbiosPort = 137
+
+	// NetBIOS name service values
+	netbiosHeaderLength  = 12
+	netbiosEncodedLength = 32
+	netbiosResponse      = 0x80
+	netbiosOpcodeMask    = 0x78
+	netbiosQuery         = 0x00
+	netbiosRegistration  = 0x28
+	netbiosRefresh       = 0x40
+	netbiosRefreshAlt    = 0x48
+	netbiosGroupFlag     = 0x80
+)
+
+// Suffixes of the NetBIOS names of hosts, that of the workstation and file server services
+var netbiosHostSuffixes = map[byte]bool{0x00: true, 0x20: true}
+
+var errNetBIOSTruncated = errors.New("truncated NetBIOS name service message")
+
+// discoveryAnalyzer interprets the discovery protocols hosts of local networks advertise themselves with, mDNS, SSDP
+// and the NetBIOS name service, reporting their names and the services they offer
+type discoveryAnalyzer struct{}
+
+// newDiscoveryAnalyzer returns a discovery analyzer
+func newDiscoveryAnalyzer(parameters *config.Parameters) (Analyzer, error) {
+	return &discoveryAnalyzer{}, nil
+}
+
+// Name returns the name of the discovery analyzer
+func (d *discoveryAnalyzer) Name() string {
+	return config.DiscoveryAnalyzer
+}
+
+// Match tells whether the packet is a UDP datagram sent from the port of a discovery protocol
+func (d *discoveryAnalyzer) Match(data *capture.PacketMsg) bool {
+	if data.Protocol != "udp" || len(data.Payload) == 0 {
+		return false
+	}
+
+	if data.SrcPort == mdnsPort || data.SrcPort == ssdpPort || data.SrcPort == netbiosPort {
+		return true
+	}
+
+	// Answers to SSDP searches are sent from any port, to that of the search
+	return data.DstPort != ssdpPort && bytes.HasPrefix(data.Payload, []byte("HTTP/1.1 200"))
+}
+
+// Process returns an event for each host the message names or advertises services of, whose host is the name of the
+// host if any
+func (d *discoveryAnalyzer) Process(data *capture.PacketMsg) ([]*Event, error) {
+	switch data.SrcPort {
+	case mdnsPort:
+		return processMDNS(data)
+	case netbiosPort:
+		return processNetBIOS(data)
+	default:
+		return processSSDP(data)
+	}
+}
+
+// processMDNS returns an event for the sender of an mDNS response, named after its address records and advertising
+// the service types of its pointer records. Queries are left out, as they name no one.
+func processMDNS(data *capture.PacketMsg) ([]*Event, error) {
+	dns := &layers.DNS{}
+	if err := dns.DecodeFromBytes(data.Payload, gopacket.NilDecodeFeedback); err != nil {
+		return nil, err
+	}
+	if !dns.QR {
+		return nil, nil
+	}
+
+	var name string
+	services := make(map[string]bool)
+	for _, record := range append(dns.Answers, dns.Additionals...) {
+		switch record.Type {
+		case layers.DNSTypeA, layers.DNSTypeAAAA:
+			// Hosts may answer for others, e.g. sleep proxies, so the sender's own address names it first
+			if name == "" || record.IP.Equal(net.ParseIP(data.SrcIP)) {
+				name = strings.TrimSuffix(strings.TrimSuffix(string(record.Name), "."), ".local")
+			}
+		case layers.DNSTypePTR:
+			// Service types, e.g. _airplay._tcp.local, point to the instances the host advertises
+			if service := strings.TrimSuffix(string(record.Name), ".local"); strings.HasPrefix(service, "_") &&
+				!strings.HasPrefix(service, "_services.") {
+				services[service] = true
+			}
+		}
+	}
+
+	if name == "" && len(services) == 0 {
+		return nil, nil
+	}
+
+	event := newEvent(config.DiscoveryAnalyzer, discoveryMDNS, data, false)
+	event.RemoteIP = data.SrcIP
+	event.Host = name
+	if len(services) > 0 {
+		event.Attributes[discoveryServices] = joinSet(services)
+	}
+	return []*Event{event}, nil
+}
+
+// processSSDP returns an event for the sender of an SSDP announcement or answer to a search, advertising the device
+// or service type it announces, and describing it with its server header. Searches are left out.
+func processSSDP(data *capture.PacketMsg) ([]*Event, error) {
+	reader := bufio.NewReader(bytes.NewReader(data.Payload))
+
+	var header http.Header
+	if bytes.HasPrefix(data.Payload, []byte("NOTIFY ")) {
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			return nil, err
+		}
+		header = req.Header
+	} else if bytes.HasPrefix(data.Payload, []byte("HTTP/")) {
+		resp, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		header = resp.Header
+	} else {
+		return nil, nil
+	}
+
+	// Announcements tell their type in NT, answers in ST
+	service := header.Get("NT")
+	if service == "" {
+		service = header.Get("ST")
+	}
+	if service == "" || header.Get("NTS") == "ssdp:byebye" {
+		return nil, nil
+	}
+
+	event := newEvent(config.DiscoveryAnalyzer, discoverySSDP, data, false)
+	event.RemoteIP = data.SrcIP
+	event.Attributes[discoveryServices] = service
+	if server := header.Get("Server"); server != "" {
+		event.Attributes[discoveryServer] = server
+	}
+	return []*Event{event}, nil
+}
+
+// processNetBIOS returns an event for a host named by a NetBIOS name service message : the sender of a registration
+// or refresh, or the addresses of a positive answer to a query. Group names, and those of services other than the
+// workstation and file server, are left out.
+func processNetBIOS(data *capture.PacketMsg) ([]*Event, error) {
+	message := data.Payload
+	if len(message) < netbiosHeaderLength {
+		return nil, errNetBIOSTruncated
+	}
+
+	flags := message[2]
+	opcode := flags & netbiosOpcodeMask
+	response := flags&netbiosResponse != 0
+	answers := binary.BigEndian.Uint16(message[6:])
+
+	name, suffix, rest, err := decodeNetBIOSName(message[netbiosHeaderLength:])
+	if err != nil {
+		return nil, err
+	}
+	if !netbiosHostSuffixes[suffix] || name == "" {
+		return nil, nil
+	}
+
+	switch {
+	case !response && (opcode == netbiosRegistration || opcode == netbiosRefresh || opcode == netbiosRefreshAlt):
+		event := newEvent(config.DiscoveryAnalyzer, discoveryNetBIOS, data, false)
+		event.RemoteIP = data.SrcIP
+		event.Host = name
+		return []*Event{event}, nil
+
+	case response && opcode == netbiosQuery && message[3]&0x0f == 0 && answers > 0:
+		// Answer type (2), class (2), TTL (4) and data length (2), then entries of flags (2) and IPv4 address (4)
+		if len(rest) < 10 {
+			return nil, errNetBIOSTruncated
+		}
+		entries := rest[10:]
+		if length := int(binary.BigEndian.Uint16(rest[8:])); length < len(entries) {
+			entries = entries[:length]
+		}
+
+		var events []*Event
+		for ; len(entries) >= 6; entries = entries[6:] {
+			if entries[0]&netbiosGroupFlag != 0 {
+				continue
+			}
+			event := newEvent(config.DiscoveryAnalyzer, discoveryNetBIOS, data, false)
+			event.RemoteIP = net.IP(entries[2:6]).String()
+			event.Host = name
+			events = append(events, event)
+		}
+		return events, nil
+	}
+
+	return nil, nil
+}
+
+// decodeNetBIOSName decodes the first level encoding of the NetBIOS name at the start of b, returning the name without
+// its padding, its suffix, and what follows it
+func decodeNetBIOSName(b []byte) (string, byte, []byte, error) {
+	if len(b) < 1+netbiosEncodedLength || int(b[0]) != netbiosEncodedLength {
+		return "", 0, nil, errNetBIOSTruncated
+	}
+
+	decoded := make([]byte, netbiosEncodedLength/2)
+	for i := range decoded {
+		high, low := b[1+2*i]-'A', b[2+2*i]-'A'
+		if high > 0x0f || low > 0x0f {
+			return "", 0, nil, errors.New("malformed NetBIOS name")
+		}
+		decoded[i] = high<<4 | low
+	}
+
+	// Labels of the scope follow, up to an empty one
+	rest := b[1+netbiosEncodedLength:]
+	for len(rest) > 0 && rest[0] != 0 {
+		if len(rest) < 1+int(rest[0]) {
+			return "", 0, nil, errNetBIOSTruncated
+		}
+		rest = rest[1+int(rest[0]):]
+	}
+	if len(rest) == 0 {
+		return "", 0, nil, errNetBIOSTruncated
+	}
+
+	name := strings.TrimRight(string(decoded[:len(decoded)-1]), " ")
+	return name, decoded[len(decoded)-1], rest[1:], nil
+}
+
+// joinSet returns the elements of the set, sorted and separated by commas
+func joinSet(set map[string]bool) string {
+	elements := make([]string, 0, len(set))
+	for element := range set {
+		elements = append(elements, element)
+	}
+	sort.Strings(elements)
+
+	return strings.Join(elements, ",")
+}
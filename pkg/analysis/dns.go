@@ -0,0 +1,94 @@
+package analysis
+
+import (
+	"errors"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"strings"
+)
+
+const (
+	// Types of DNS events
+	dnsQuery  = "query"
+	dnsAnswer = "answer"
+
+	// Attributes of DNS events
+	dnsRecordType = "type"
+	dnsRcode      = "rcode"
+	dnsAddresses  = "addresses"
+
+	// Port DNS messages are exchanged on over UDP
+	dnsPort = 53
+)
+
+// dnsAnalyzer interprets DNS queries and answers, reporting the names looked up
+type dnsAnalyzer struct{}
+
+// newDNSAnalyzer returns a DNS analyzer
+func newDNSAnalyzer(parameters *config.Parameters) (Analyzer, error) {
+	return &dnsAnalyzer{}, nil
+}
+
+// Name returns the name of the DNS analyzer
+func (d *dnsAnalyzer) Name() string {
+	return config.DNSAnalyzer
+}
+
+// decodeDNS decodes the DNS message carried by a UDP datagram from or to the DNS port, or returns nil if there is none
+func decodeDNS(data *capture.PacketMsg) *layers.DNS {
+	if data.Protocol != "udp" || (data.SrcPort != dnsPort && data.DstPort != dnsPort) {
+		return nil
+	}
+
+	dns := &layers.DNS{}
+	if err := dns.DecodeFromBytes(data.Payload, gopacket.NilDecodeFeedback); err != nil {
+		return nil
+	}
+
+	return dns
+}
+
+// Match tells whether the packet carries a DNS message
+func (d *dnsAnalyzer) Match(data *capture.PacketMsg) bool {
+	return decodeDNS(data) != nil
+}
+
+// Process returns an event per question of the message, with the addresses of the answers for responses
+func (d *dnsAnalyzer) Process(data *capture.PacketMsg) ([]*Event, error) {
+	dns := decodeDNS(data)
+	if dns == nil {
+		return nil, errors.New("no DNS message in packet")
+	}
+
+	eventType := dnsQuery
+	if dns.QR {
+		eventType = dnsAnswer
+	}
+
+	events := make([]*Event, 0, len(dns.Questions))
+	for _, question := range dns.Questions {
+		event := newEvent(config.DNSAnalyzer, eventType, data, false)
+		event.Host = string(question.Name)
+		event.Attributes[dnsRecordType] = question.Type.String()
+
+		if dns.QR {
+			event.Attributes[dnsRcode] = dns.ResponseCode.String()
+
+			var addresses []string
+			for _, answer := range dns.Answers {
+				if answer.IP != nil {
+					addresses = append(addresses, answer.IP.String())
+				}
+			}
+			if len(addresses) > 0 {
+				event.Attributes[dnsAddresses] = strings.Join(addresses, ",")
+			}
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
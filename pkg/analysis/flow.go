@@ -0,0 +1,184 @@
+package analysis
+
+import (
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"net"
+	"strconv"
+	"time"
+)
+
+// FlowRecord holds the accounting of a bidirectional connection between two endpoints over a report window.
+// The originator of a flow is the source of the first packet seen for it.
+type FlowRecord struct {
+	Device    string    // Interface on which the flow was recorded
+	Protocol  string    // Transport protocol, either tcp or udp
+	SrcIP     string    // IP address of the originator
+	SrcPort   uint16    // Port of the originator
+	DstIP     string    // IP address of the responder
+	DstPort   uint16    // Port of the responder
+	SrcPkts   uint      // Number of packets sent by the originator
+	DstPkts   uint      // Number of packets sent by the responder
+	SrcBytes  uint64    // Number of bytes sent by the originator
+	DstBytes  uint64    // Number of bytes sent by the responder
+	SrcData   uint64    // Number of transport payload bytes sent by the originator
+	DstData   uint64    // Number of transport payload bytes sent by the responder
+	SrcFlags  TCPFlags  // TCP flags sent by the originator
+	DstFlags  TCPFlags  // TCP flags sent by the responder
+	FirstSeen time.Time // Capture timestamp of the first packet of the flow
+	LastSeen  time.Time // Capture timestamp of the last packet of the flow
+
+	// Time from the SYN of the originator to the SYN-ACK of the responder, 0 if not both seen during the window
+	Handshake time.Duration
+
+	// Docker containers owning the addresses of the originator and the responder, empty if none or not attributed
+	SrcContainer string
+	DstContainer string
+
+	// Kubernetes pods or services owning the addresses of the originator and the responder, as <kind>/<namespace>/<name>
+	SrcWorkload string
+	DstWorkload string
+
+	// Local processes owning the sockets of the originator and the responder, as <name>[<pid>], empty if none or not
+	// attributed
+	SrcProcess string
+	DstProcess string
+
+	// Friendly names discovery protocols gave the originator and the responder, empty if none
+	SrcName string
+	DstName string
+}
+
+// TCPFlags is a set of the TCP flags relevant to connection states
+type TCPFlags uint8
+
+// TCP flags tracked in flow records
+const (
+	FlagSYN TCPFlags = 1 << iota
+	FlagFIN
+	FlagRST
+)
+
+// Has tells whether all flags in mask are set
+func (f TCPFlags) Has(mask TCPFlags) bool {
+	return f&mask == mask
+}
+
+// packetFlags returns the connection state relevant flags of a TCP segment
+func packetFlags(data *capture.PacketMsg) TCPFlags {
+	var flags TCPFlags
+	if data.SYN {
+		flags |= FlagSYN
+	}
+	if data.FIN {
+		flags |= FlagFIN
+	}
+	if data.RST {
+		flags |= FlagRST
+	}
+	return flags
+}
+
+// Duration returns the time elapsed between the first and last packets of the flow
+func (f *FlowRecord) Duration() time.Duration {
+	return f.LastSeen.Sub(f.FirstSeen)
+}
+
+// Key returns an identifier of the flow's connection, that is the same in both directions
+func (f *FlowRecord) Key() string {
+	return flowKey(f.Protocol, f.SrcIP, f.SrcPort, f.DstIP, f.DstPort)
+}
+
+// flowKey returns an identifier for the connection between both endpoints, that is the same in both directions
+func flowKey(protocol string, srcIP string, srcPort uint16, dstIP string, dstPort uint16) string {
+	src := net.JoinHostPort(srcIP, strconv.Itoa(int(srcPort)))
+	dst := net.JoinHostPort(dstIP, strconv.Itoa(int(dstPort)))
+
+	if src > dst {
+		src, dst = dst, src
+	}
+
+	return protocol + "/" + src + "-" + dst
+}
+
+// accountFlow updates the flow table with the packet, creating a new flow record if it belongs to an unknown connection,
+// which may evict others.
+// Packets without an IP network layer and a TCP or UDP transport layer are ignored.
+func (a *Analysis) accountFlow(data *capture.PacketMsg) {
+	if data.Protocol == "" || data.SrcIP == "" {
+		return
+	}
+
+	protocol, srcIP, srcPort, dstIP, dstPort := data.Protocol, data.SrcIP, data.SrcPort, data.DstIP, data.DstPort
+	key := flowKey(protocol, srcIP, srcPort, dstIP, dstPort)
+
+	flow := a.flows.get(key)
+	if flow == nil {
+		flow = &FlowRecord{
+			Device:    data.Device,
+			Protocol:  protocol,
+			SrcIP:     srcIP,
+			SrcPort:   srcPort,
+			DstIP:     dstIP,
+			DstPort:   dstPort,
+			FirstSeen: data.Timestamp,
+		}
+		a.flows.add(key, flow, data.Timestamp)
+	}
+
+	flow.LastSeen = data.Timestamp
+
+	payload := uint64(len(data.Payload))
+	flags := packetFlags(data)
+
+	// Account packet in the direction it was sent
+	if flow.SrcIP == srcIP && flow.SrcPort == srcPort {
+		flow.SrcPkts++
+		flow.SrcBytes += uint64(data.Length)
+		flow.SrcData += payload
+		flow.SrcFlags |= flags
+	} else {
+		flow.DstPkts++
+		flow.DstBytes += uint64(data.Length)
+		flow.DstData += payload
+		flow.DstFlags |= flags
+
+		// The handshake is timed from the first packet of the flow, the SYN of the originator
+		if data.SYN && data.ACK && flow.Handshake == 0 && flow.SrcFlags.Has(FlagSYN) {
+			flow.Handshake = data.Timestamp.Sub(flow.FirstSeen)
+		}
+	}
+}
+
+// merge adds the accounting of g, a record of the same connection made by another worker, to the flow
+func (f *FlowRecord) merge(g *FlowRecord) {
+	// Orientations may differ if each worker saw a different first packet
+	if f.SrcIP == g.SrcIP && f.SrcPort == g.SrcPort {
+		f.SrcPkts += g.SrcPkts
+		f.DstPkts += g.DstPkts
+		f.SrcBytes += g.SrcBytes
+		f.DstBytes += g.DstBytes
+		f.SrcData += g.SrcData
+		f.DstData += g.DstData
+		f.SrcFlags |= g.SrcFlags
+		f.DstFlags |= g.DstFlags
+	} else {
+		f.SrcPkts += g.DstPkts
+		f.DstPkts += g.SrcPkts
+		f.SrcBytes += g.DstBytes
+		f.DstBytes += g.SrcBytes
+		f.SrcData += g.DstData
+		f.DstData += g.SrcData
+		f.SrcFlags |= g.DstFlags
+		f.DstFlags |= g.SrcFlags
+	}
+
+	if f.Handshake == 0 {
+		f.Handshake = g.Handshake
+	}
+	if g.FirstSeen.Before(f.FirstSeen) {
+		f.FirstSeen = g.FirstSeen
+	}
+	if g.LastSeen.After(f.LastSeen) {
+		f.LastSeen = g.LastSeen
+	}
+}
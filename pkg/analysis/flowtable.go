@@ -0,0 +1,121 @@
+package analysis
+
+import (
+	"container/list"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/diagnostics"
+	"time"
+)
+
+// Estimated memory used by a flow besides its strings : the record, its list element and its map entry
+const flowOverhead = 256
+
+// Flows evicted from flow tables before the end of their window, by cause
+var (
+	evictedIdleFlows   = diagnostics.NewCounter("analysis.flows.evicted.idle")   // Flows idle for longer than the idle timeout
+	evictedCountFlows  = diagnostics.NewCounter("analysis.flows.evicted.count")  // Least recently seen flows, past the maximum number of flows
+	evictedMemoryFlows = diagnostics.NewCounter("analysis.flows.evicted.memory") // Least recently seen flows, past the maximum memory
+)
+
+// flowEntry is a flow of the table, along with its key and estimated memory
+type flowEntry struct {
+	key    string
+	record *FlowRecord
+	size   int64
+}
+
+// flowTable holds the flows seen during a report window, by least recently seen order. Flows are evicted when idle,
+// and the least recently seen when the table exceeds its limits. Evicted flows are not reported.
+type flowTable struct {
+	limits config.FlowTableConfig
+	flows  map[string]*list.Element // Elements of lru, indexed by flowKey()
+	lru    *list.List               // Flow entries, from the most to the least recently seen
+	memory int64                    // Estimated memory of all flows
+}
+
+// newFlowTable returns an empty flow table bounded by limits
+func newFlowTable(limits config.FlowTableConfig) *flowTable {
+	return &flowTable{
+		limits: limits,
+		flows:  make(map[string]*list.Element),
+		lru:    list.New(),
+		memory: 0,
+	}
+}
+
+// get returns the flow of key, marked as the most recently seen, or nil if it is not tracked
+func (t *flowTable) get(key string) *FlowRecord {
+	element, ok := t.flows[key]
+	if !ok {
+		return nil
+	}
+
+	t.lru.MoveToFront(element)
+
+	return element.Value.(*flowEntry).record
+}
+
+// add tracks the new flow of key, first evicting flows idle at now and those exceeding the limits of the table
+func (t *flowTable) add(key string, record *FlowRecord, now time.Time) {
+	entry := &flowEntry{
+		key:    key,
+		record: record,
+		size:   flowOverhead + int64(len(key)+len(record.Device)+len(record.Protocol)+len(record.SrcIP)+len(record.DstIP)),
+	}
+
+	// Least recently seen flows are at the back, so idle flows are evicted from there
+	if t.limits.IdleTimeout > 0 {
+		for back := t.lru.Back(); back != nil; back = t.lru.Back() {
+			if now.Sub(back.Value.(*flowEntry).record.LastSeen) <= t.limits.IdleTimeout {
+				break
+			}
+			t.remove(back)
+			evictedIdleFlows.Inc()
+		}
+	}
+
+	for t.limits.MaxFlows > 0 && t.lru.Len() >= t.limits.MaxFlows {
+		t.remove(t.lru.Back())
+		evictedCountFlows.Inc()
+	}
+
+	for t.limits.MaxMemory > 0 && t.lru.Len() > 0 && t.memory+entry.size > t.limits.MaxMemory {
+		t.remove(t.lru.Back())
+		evictedMemoryFlows.Inc()
+	}
+
+	t.flows[key] = t.lru.PushFront(entry)
+	t.memory += entry.size
+}
+
+// remove stops tracking the flow of element
+func (t *flowTable) remove(element *list.Element) {
+	entry := t.lru.Remove(element).(*flowEntry)
+	delete(t.flows, entry.key)
+	t.memory -= entry.size
+}
+
+// merge adds the flows of u, the table of another worker over the same window, without evicting any. As each table is
+// bounded, so is the result.
+func (t *flowTable) merge(u *flowTable) {
+	for element := u.lru.Back(); element != nil; element = element.Prev() {
+		entry := element.Value.(*flowEntry)
+		if e, ok := t.flows[entry.key]; ok {
+			e.Value.(*flowEntry).record.merge(entry.record)
+			continue
+		}
+
+		t.flows[entry.key] = t.lru.PushFront(entry)
+		t.memory += entry.size
+	}
+}
+
+// records returns the tracked flows
+func (t *flowTable) records() []*FlowRecord {
+	records := make([]*FlowRecord, 0, t.lru.Len())
+	for element := t.lru.Front(); element != nil; element = element.Next() {
+		records = append(records, element.Value.(*flowEntry).record)
+	}
+
+	return records
+}
@@ -0,0 +1,128 @@
+package analysis
+
+import (
+	"github.com/bytemare/gonetmon/pkg/config"
+	"net"
+	"sort"
+)
+
+// Bounds the cache of the groups of addresses, past which it is emptied
+const maxGroupAddresses = 65536
+
+// GroupTraffic holds the traffic sent from a group of networks to another during a report window
+type GroupTraffic struct {
+	From    string
+	To      string
+	Packets uint64
+	Bytes   uint64
+}
+
+// groupMatrix accounts the traffic between groups of networks, from the flows of reports
+type groupMatrix struct {
+	networks []*net.IPNet      // Networks of all groups, the most specific first
+	names    []string          // Group of each network
+	others   string            // Group of addresses in none of the networks
+	parsed   map[string]string // Groups of addresses, cached across windows
+}
+
+// newGroupMatrix returns a matrix of the traffic between the groups configured, whose networks are checked
+func newGroupMatrix(matrix *config.MatrixConfig) (*groupMatrix, error) {
+	g := &groupMatrix{
+		networks: nil,
+		names:    nil,
+		others:   matrix.Others,
+		parsed:   make(map[string]string),
+	}
+
+	for _, group := range matrix.Groups {
+		networks, err := ParseAddresses(group.Networks)
+		if err != nil {
+			return nil, err
+		}
+		for _, network := range networks {
+			g.networks = append(g.networks, network)
+			g.names = append(g.names, group.Name)
+		}
+	}
+
+	// Addresses belong to the group of the most specific network holding them
+	sort.Stable(g)
+
+	return g, nil
+}
+
+func (g *groupMatrix) Len() int {
+	return len(g.networks)
+}
+
+func (g *groupMatrix) Less(i, j int) bool {
+	oi, _ := g.networks[i].Mask.Size()
+	oj, _ := g.networks[j].Mask.Size()
+	return oi > oj
+}
+
+func (g *groupMatrix) Swap(i, j int) {
+	g.networks[i], g.networks[j] = g.networks[j], g.networks[i]
+	g.names[i], g.names[j] = g.names[j], g.names[i]
+}
+
+// add returns the traffic sent between groups in the flows of the report, the most bytes first
+func (g *groupMatrix) add(report *Report) []GroupTraffic {
+	type pair struct{ from, to string }
+	traffic := make(map[pair]*GroupTraffic)
+	account := func(from, to string, packets uint, bytes uint64) {
+		if packets == 0 {
+			return
+		}
+		t, ok := traffic[pair{from, to}]
+		if !ok {
+			t = &GroupTraffic{From: from, To: to, Packets: 0, Bytes: 0}
+			traffic[pair{from, to}] = t
+		}
+		t.Packets += uint64(packets)
+		t.Bytes += bytes
+	}
+
+	for _, flow := range report.Flows {
+		src, dst := g.group(flow.SrcIP), g.group(flow.DstIP)
+		account(src, dst, flow.SrcPkts, flow.SrcBytes)
+		account(dst, src, flow.DstPkts, flow.DstBytes)
+	}
+
+	matrix := make([]GroupTraffic, 0, len(traffic))
+	for _, t := range traffic {
+		matrix = append(matrix, *t)
+	}
+	sort.Slice(matrix, func(i, j int) bool {
+		if matrix[i].Bytes != matrix[j].Bytes {
+			return matrix[i].Bytes > matrix[j].Bytes
+		}
+		return matrix[i].From+matrix[i].To < matrix[j].From+matrix[j].To
+	})
+
+	return matrix
+}
+
+// group returns the group of the address
+func (g *groupMatrix) group(address string) string {
+	group, ok := g.parsed[address]
+	if ok {
+		return group
+	}
+
+	if len(g.parsed) >= maxGroupAddresses {
+		g.parsed = make(map[string]string)
+	}
+	group = g.others
+	if ip := net.ParseIP(address); ip != nil {
+		for i, network := range g.networks {
+			if network.Contains(ip) {
+				group = g.names[i]
+				break
+			}
+		}
+	}
+	g.parsed[address] = group
+
+	return group
+}
@@ -0,0 +1,245 @@
+package analysis
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"golang.org/x/net/http2/hpack"
+	"strings"
+	"time"
+)
+
+// HTTP/2 values
+const (
+	h2Preface       = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+	h2FrameHeader   = 9
+	h2MaxFrame      = 1 << 16 // Largest frame followed. Peers may allow larger ones, which are then not followed.
+	h2TableSize     = 4096    // Initial size of the dynamic table of header compression
+	h2MaxTableSize  = 1 << 16 // Largest dynamic table of header compression peers may resize theirs to
+	h2MaxGRPCCalls  = 1024    // gRPC calls followed at once on a connection
+	h2FrameData     = 0x0
+	h2FrameHeaders  = 0x1
+	h2FrameReset    = 0x3
+	h2FrameContinue = 0x9
+	h2FlagEndStream = 0x1
+	h2FlagEndHeader = 0x4
+	h2FlagPadded    = 0x8
+	h2FlagPriority  = 0x20
+	h2StreamMask    = 0x7fffffff
+
+	// gRPC messages are prefixed with a compression flag and their length
+	grpcPrefix      = 5
+	grpcContentType = "application/grpc"
+)
+
+var errH2Malformed = errors.New("malformed HTTP/2 frame")
+
+// h2Conn is an HTTP/2 connection over cleartext TCP, whose frames are followed in both directions to tell its gRPC
+// calls and count their messages. Header blocks are decompressed in order, so that a lost segment ends the following
+// of the connection.
+type h2Conn struct {
+	client   string               // Endpoint of the client, as <ip>:<port>
+	buffers  [2][]byte            // Bytes of frames still incomplete, from the client and from the server
+	decoders [2]*hpack.Decoder    // Decompressors of the header blocks, from the client and from the server
+	blocks   [2][]byte            // Header blocks awaiting their continuations, from the client and from the server
+	calls    map[uint32]*grpcCall // gRPC calls in progress, by HTTP/2 stream
+	seen     time.Time            // Capture timestamp of the last packet of the connection
+
+	// Host of the latest gRPC call, its messages are attributed to
+	authority string
+}
+
+// grpcCall is a gRPC call in progress, whose messages are told apart by their length prefixes
+type grpcCall struct {
+	remaining [2]uint32 // Bytes of the current message still to come, from the client and from the server
+	prefix    [2][]byte // Beginning of the prefix of the next message, when split across frames
+}
+
+// newH2Conn returns an HTTP/2 connection opened by the client
+func newH2Conn(client string) *h2Conn {
+	c := &h2Conn{
+		client:   client,
+		buffers:  [2][]byte{},
+		decoders: [2]*hpack.Decoder{hpack.NewDecoder(h2TableSize, nil), hpack.NewDecoder(h2TableSize, nil)},
+		blocks:   [2][]byte{},
+		calls:    make(map[uint32]*grpcCall),
+		seen:     time.Time{},
+
+		authority: "",
+	}
+	for _, decoder := range c.decoders {
+		decoder.SetAllowedMaxDynamicTableSize(h2MaxTableSize)
+	}
+
+	return c
+}
+
+// grpcActivity holds what the frames of a packet tell of the gRPC calls of a connection
+type grpcActivity struct {
+	calls    []grpcRequest // Calls started
+	messages int           // Messages whose prefix completed
+}
+
+// grpcRequest is a gRPC call started by the client
+type grpcRequest struct {
+	authority string // Host the call is made to
+	path      string // Method called, as /<package>.<service>/<method>
+}
+
+// frames follows the frames the packet completes, returning the gRPC calls they start and the messages they carry. An
+// error means the connection can no longer be followed.
+func (c *h2Conn) frames(data *capture.PacketMsg, payload []byte) (grpcActivity, error) {
+	c.seen = data.Timestamp
+	dir := direction(c.client, data)
+
+	// Frames are processed once complete, so the payload is copied if one is left incomplete
+	buffer := payload
+	if len(c.buffers[dir]) > 0 {
+		buffer = append(c.buffers[dir], payload...)
+	}
+
+	var activity grpcActivity
+	for len(buffer) >= h2FrameHeader {
+		length := int(buffer[0])<<16 | int(buffer[1])<<8 | int(buffer[2])
+		if length > h2MaxFrame {
+			return activity, errH2Malformed
+		}
+		if len(buffer) < h2FrameHeader+length {
+			break
+		}
+
+		frameType, flags := buffer[3], buffer[4]
+		stream := binary.BigEndian.Uint32(buffer[5:]) & h2StreamMask
+		if err := c.frame(dir, frameType, flags, stream, buffer[h2FrameHeader:h2FrameHeader+length], &activity); err != nil {
+			return activity, err
+		}
+		buffer = buffer[h2FrameHeader+length:]
+	}
+
+	c.buffers[dir] = append(c.buffers[dir][:0], buffer...)
+	return activity, nil
+}
+
+// frame follows a complete frame sent in the direction
+func (c *h2Conn) frame(dir int, frameType, flags byte, stream uint32, payload []byte, activity *grpcActivity) error {
+	switch frameType {
+	case h2FrameHeaders:
+		fragment, err := unpad(flags, payload)
+		if err != nil {
+			return err
+		}
+		if flags&h2FlagPriority != 0 {
+			if len(fragment) < 5 {
+				return errH2Malformed
+			}
+			fragment = fragment[5:]
+		}
+		c.blocks[dir] = append(c.blocks[dir][:0], fragment...)
+		if flags&h2FlagEndHeader != 0 {
+			return c.headers(dir, flags, stream, activity)
+		}
+
+	case h2FrameContinue:
+		c.blocks[dir] = append(c.blocks[dir], payload...)
+		if flags&h2FlagEndHeader != 0 {
+			return c.headers(dir, flags, stream, activity)
+		}
+
+	case h2FrameData:
+		call, ok := c.calls[stream]
+		if !ok {
+			return nil
+		}
+		body, err := unpad(flags, payload)
+		if err != nil {
+			return err
+		}
+		activity.messages += call.messages(dir, body)
+		if dir == 1 && flags&h2FlagEndStream != 0 {
+			delete(c.calls, stream)
+		}
+
+	case h2FrameReset:
+		delete(c.calls, stream)
+	}
+
+	return nil
+}
+
+// headers decodes the complete header block sent in the direction on the stream. Requests of the client with the gRPC
+// content type start calls, which end with the trailers of the server.
+func (c *h2Conn) headers(dir int, flags byte, stream uint32, activity *grpcActivity) error {
+	fields, err := c.decoders[dir].DecodeFull(c.blocks[dir])
+	c.blocks[dir] = c.blocks[dir][:0]
+	if err != nil {
+		return err
+	}
+
+	if dir == 1 {
+		if flags&h2FlagEndStream != 0 {
+			delete(c.calls, stream)
+		}
+		return nil
+	}
+
+	var request grpcRequest
+	grpc := false
+	for _, field := range fields {
+		switch field.Name {
+		case ":authority":
+			request.authority = field.Value
+		case ":path":
+			request.path = field.Value
+		case "content-type":
+			grpc = strings.HasPrefix(field.Value, grpcContentType)
+		}
+	}
+	if grpc && len(c.calls) < h2MaxGRPCCalls {
+		c.calls[stream] = &grpcCall{remaining: [2]uint32{}, prefix: [2][]byte{}}
+		activity.calls = append(activity.calls, request)
+	}
+
+	return nil
+}
+
+// messages returns the number of messages whose prefix completes in the body of a data frame sent in the direction
+func (g *grpcCall) messages(dir int, body []byte) int {
+	messages := 0
+	for len(body) > 0 {
+		if g.remaining[dir] > 0 {
+			n := g.remaining[dir]
+			if n > uint32(len(body)) {
+				n = uint32(len(body))
+			}
+			body = body[n:]
+			g.remaining[dir] -= n
+			continue
+		}
+
+		n := grpcPrefix - len(g.prefix[dir])
+		if n > len(body) {
+			n = len(body)
+		}
+		g.prefix[dir] = append(g.prefix[dir], body[:n]...)
+		body = body[n:]
+		if len(g.prefix[dir]) == grpcPrefix {
+			messages++
+			g.remaining[dir] = binary.BigEndian.Uint32(g.prefix[dir][1:])
+			g.prefix[dir] = g.prefix[dir][:0]
+		}
+	}
+
+	return messages
+}
+
+// unpad returns the payload of a frame without its padding, if it is padded
+func unpad(flags byte, payload []byte) ([]byte, error) {
+	if flags&h2FlagPadded == 0 {
+		return payload, nil
+	}
+	if len(payload) < 1 || int(payload[0]) >= len(payload) {
+		return nil, errH2Malformed
+	}
+
+	return payload[1 : len(payload)-int(payload[0])], nil
+}
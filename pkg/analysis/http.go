@@ -0,0 +1,363 @@
+package analysis
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Types of HTTP events
+	httpResponse = "response"
+	httpRequest  = "request"
+	httpStream   = "stream"  // Start of a gRPC call or of a WebSocket connection
+	httpMessage  = "message" // Messages of gRPC calls or WebSocket connections
+
+	// Attributes of HTTP events
+	httpMethod  = "method"
+	httpSection = "section"
+	httpStatus  = "status"
+	httpLatency = "latency" // Nanoseconds between the request a response answers and the response
+	httpPath    = "path"    // Full path of the URI of a request, without its query
+	httpAgent   = "agent"   // Family of the User-Agent header of a request, e.g. Firefox or curl
+	httpContent = "content" // Category of the content of a response, e.g. json or video
+	httpSize    = "size"    // Length of the body of a response, as told by its Content-Length header, if any
+
+	// Bounds of the requests awaiting their responses, past which the oldest are forgotten
+	maxPendingStreams  = 4096        // TCP streams with requests awaiting responses
+	maxPendingRequests = 16          // Pipelined requests of a stream
+	httpPairingTimeout = time.Minute // Time after which requests are no longer awaiting their responses
+
+	// Attributes of stream and message events
+	streamProtocol = "protocol" // Protocol of the stream, grpc or websocket
+	streamMessages = "messages" // Number of messages
+
+	// Protocols of streams
+	protocolGRPC      = "grpc"
+	protocolWebSocket = "websocket"
+
+	// Bounds of the WebSocket streams and HTTP/2 connections followed, past which those idle for the timeout are
+	// forgotten, and new ones are ignored if none is
+	maxFollowedStreams = 4096
+	streamIdleTimeout  = 10 * time.Minute
+)
+
+// httpAnalyzer interprets HTTP/1.x requests and responses, which make the hits of reports and alerts. Responses are
+// paired with the requests they answer on their TCP stream, to time them and name the host they come from.
+// Streams upgraded to the WebSocket protocol, and HTTP/2 connections over cleartext, are followed to count their
+// connections or gRPC calls and their messages apart from requests.
+type httpAnalyzer struct {
+	pending    map[string][]pendingRequest // Requests awaiting their responses, oldest first, by TCP stream
+	websockets map[string]*wsStream        // Streams upgraded to the WebSocket protocol, by TCP stream
+	h2c        map[string]*h2Conn          // HTTP/2 connections over cleartext, by TCP stream
+}
+
+// pendingRequest is an HTTP request awaiting its response
+type pendingRequest struct {
+	host      string    // Host header of the request
+	sent      time.Time // Capture timestamp of the request
+	websocket bool      // Whether the request asks to upgrade the stream to the WebSocket protocol
+}
+
+// newHTTPAnalyzer returns an HTTP analyzer
+func newHTTPAnalyzer(parameters *config.Parameters) (Analyzer, error) {
+	return &httpAnalyzer{
+		pending:    make(map[string][]pendingRequest),
+		websockets: make(map[string]*wsStream),
+		h2c:        make(map[string]*h2Conn),
+	}, nil
+}
+
+// Name returns the name of the HTTP analyzer
+func (h *httpAnalyzer) Name() string {
+	return config.HTTPAnalyzer
+}
+
+// Match tells whether the packet's payload starts like an HTTP response, or holds an HTTP request line
+func (h *httpAnalyzer) Match(data *capture.PacketMsg) bool {
+	if h.followed(data) {
+		return true
+	}
+
+	payload := data.Payload
+	if bytes.HasPrefix(payload, []byte("HTTP/")) {
+		return true
+	}
+
+	line := payload
+	if idx := bytes.IndexByte(payload, '\n'); idx >= 0 {
+		line = payload[:idx]
+	}
+
+	return bytes.Contains(line, []byte(" HTTP/"))
+}
+
+// readRequest is a wrapper around http.ReadRequest
+func readRequest(b *bufio.Reader) (*http.Request, error) {
+	req, err := http.ReadRequest(b)
+	if err == io.EOF {
+		log.Error("HTTP Request reading hit EOF : ", err)
+		return nil, err
+	}
+	if err != nil {
+		log.Error("HTTP Request reading error : ", err)
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// readResponse is a wrapper around http.ReadResponse
+func readResponse(b *bufio.Reader) (*http.Response, error) {
+
+	resp, err := http.ReadResponse(b, nil)
+
+	if err == io.EOF {
+		log.Error("HTTP Response reading hit EOF : ", err)
+		return nil, err
+	}
+
+	if err != nil {
+		log.Error("HTTP Response reading error : ", err)
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// getSection extracts the section from a HTTP Request's URI
+func getSection(req *http.Request) string {
+	uri := req.RequestURI
+	if idx := strings.IndexByte(uri[1:], '/'); idx >= 0 {
+		uri = uri[:idx+1]
+	}
+	return uri
+}
+
+// Process interprets the raw payload into a request or response event.
+// Returns nil with an error if data does not contain a valid http payload
+func (h *httpAnalyzer) Process(data *capture.PacketMsg) ([]*Event, error) {
+
+	// Streams upgraded to other protocols, and HTTP/2 connections, hold no HTTP/1.x messages
+	if h.followed(data) || bytes.HasPrefix(data.Payload, []byte(h2Preface)) {
+		return h.follow(data), nil
+	}
+
+	appPayload := data.Payload
+	// In order to use the /net/http functions to interpret http packets,
+	// we have to present *bufio.Reader containing the payload
+	bufReader := bufio.NewReader(bytes.NewReader(appPayload))
+
+	// If it is a Response, it starts with 'HTTP/'
+	if bytes.HasPrefix(appPayload, []byte("HTTP/")) {
+
+		response, err := readResponse(bufReader)
+
+		if err != nil {
+			return nil, err
+		}
+
+		event := newEvent(config.HTTPAnalyzer, httpResponse, data, true)
+		event.Attributes[httpStatus] = strconv.Itoa(response.StatusCode)
+		event.Attributes[httpContent] = contentCategory(response.Header)
+		if response.ContentLength >= 0 {
+			event.Attributes[httpSize] = strconv.FormatInt(response.ContentLength, 10)
+		}
+
+		// Interim responses precede that of the request, but for switching protocols which ends it
+		if response.StatusCode >= 200 || response.StatusCode == http.StatusSwitchingProtocols {
+			if request, ok := h.answer(streamKey(data), data.Timestamp); ok {
+				event.Host = request.host
+				event.Attributes[httpLatency] = strconv.FormatInt(int64(data.Timestamp.Sub(request.sent)), 10)
+
+				if response.StatusCode == http.StatusSwitchingProtocols && request.websocket {
+					if opened := h.upgrade(data, request.host); opened != nil {
+						return []*Event{event, opened}, nil
+					}
+				}
+			}
+		}
+		return []*Event{event}, nil
+	}
+
+	// If not, it may be a Request
+	request, err := readRequest(bufReader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	event := newEvent(config.HTTPAnalyzer, httpRequest, data, true)
+	event.Host = request.Host
+	event.Attributes[httpMethod] = request.Method
+	event.Attributes[httpSection] = getSection(request)
+	event.Attributes[httpPath] = request.URL.Path
+	event.Attributes[httpAgent] = agentFamily(request.UserAgent())
+	h.await(streamKey(data), pendingRequest{
+		host:      request.Host,
+		sent:      data.Timestamp,
+		websocket: strings.EqualFold(request.Header.Get("Upgrade"), protocolWebSocket),
+	})
+	return []*Event{event}, nil
+}
+
+// streamKey returns the identifier of the TCP stream of the packet, that is the same in both directions
+func streamKey(data *capture.PacketMsg) string {
+	return flowKey(data.Protocol, data.SrcIP, data.SrcPort, data.DstIP, data.DstPort)
+}
+
+// await records the request as awaiting its response on the stream. If too many streams await responses, those
+// whose requests timed out are forgotten, and the request is ignored if none did.
+func (h *httpAnalyzer) await(stream string, request pendingRequest) {
+	queue, ok := h.pending[stream]
+	if !ok && len(h.pending) >= maxPendingStreams {
+		for key, q := range h.pending {
+			if request.sent.Sub(q[len(q)-1].sent) >= httpPairingTimeout {
+				delete(h.pending, key)
+			}
+		}
+		if len(h.pending) >= maxPendingStreams {
+			return
+		}
+	}
+
+	if len(queue) >= maxPendingRequests {
+		queue = queue[1:]
+	}
+	h.pending[stream] = append(queue, request)
+}
+
+// answer returns the oldest request awaiting its response on the stream, if any did not time out, and no longer
+// awaits it. HTTP/1.x responses come in the order of their requests.
+func (h *httpAnalyzer) answer(stream string, t time.Time) (pendingRequest, bool) {
+	queue := h.pending[stream]
+	for len(queue) > 0 && t.Sub(queue[0].sent) >= httpPairingTimeout {
+		queue = queue[1:]
+	}
+	if len(queue) == 0 {
+		delete(h.pending, stream)
+		return pendingRequest{}, false
+	}
+
+	request := queue[0]
+	if len(queue) == 1 {
+		delete(h.pending, stream)
+	} else {
+		h.pending[stream] = queue[1:]
+	}
+
+	return request, true
+}
+
+// followed tells whether the packet belongs to a stream upgraded to the WebSocket protocol, or to an HTTP/2 connection
+func (h *httpAnalyzer) followed(data *capture.PacketMsg) bool {
+	if data.Protocol != "tcp" || len(h.websockets)+len(h.h2c) == 0 {
+		return false
+	}
+
+	key := streamKey(data)
+	return h.websockets[key] != nil || h.h2c[key] != nil
+}
+
+// upgrade follows the stream of the response as upgraded to the WebSocket protocol, returning the event of its start,
+// or nil if too many streams are followed
+func (h *httpAnalyzer) upgrade(data *capture.PacketMsg, host string) *Event {
+	if len(h.websockets) >= maxFollowedStreams {
+		h.expire(data.Timestamp)
+		if len(h.websockets) >= maxFollowedStreams {
+			return nil
+		}
+	}
+
+	// Responses are sent to the client
+	h.websockets[streamKey(data)] = &wsStream{
+		host:   host,
+		client: endpoint(data.DstIP, data.DstPort),
+		skip:   [2]uint64{},
+		seen:   data.Timestamp,
+	}
+
+	return streamEvent(data, httpStream, protocolWebSocket, host, 0)
+}
+
+// follow returns the events of a packet of a stream upgraded to the WebSocket protocol or of an HTTP/2 connection, the
+// preface of the client starting the latter. Connections whose frames can no longer be followed are forgotten.
+func (h *httpAnalyzer) follow(data *capture.PacketMsg) []*Event {
+	key := streamKey(data)
+
+	if s, ok := h.websockets[key]; ok {
+		messages, closed := s.frames(data)
+		if closed {
+			delete(h.websockets, key)
+		}
+		if messages == 0 {
+			return nil
+		}
+		return []*Event{streamEvent(data, httpMessage, protocolWebSocket, s.host, messages)}
+	}
+
+	payload := data.Payload
+	c, ok := h.h2c[key]
+	if !ok {
+		if len(h.h2c) >= maxFollowedStreams {
+			h.expire(data.Timestamp)
+			if len(h.h2c) >= maxFollowedStreams {
+				return nil
+			}
+		}
+		c = newH2Conn(endpoint(data.SrcIP, data.SrcPort))
+		h.h2c[key] = c
+		payload = payload[len(h2Preface):]
+	}
+
+	activity, err := c.frames(data, payload)
+	if err != nil {
+		log.Debug("Could not follow HTTP/2 connection ", key, " : ", err)
+		delete(h.h2c, key)
+	}
+
+	events := make([]*Event, 0, len(activity.calls)+1)
+	for _, call := range activity.calls {
+		event := streamEvent(data, httpStream, protocolGRPC, call.authority, 0)
+		event.Attributes[httpPath] = call.path
+		events = append(events, event)
+		c.authority = call.authority
+	}
+	if activity.messages > 0 {
+		events = append(events, streamEvent(data, httpMessage, protocolGRPC, c.authority, activity.messages))
+	}
+
+	return events
+}
+
+// expire forgets the WebSocket streams and HTTP/2 connections idle for the timeout at t
+func (h *httpAnalyzer) expire(t time.Time) {
+	for key, s := range h.websockets {
+		if t.Sub(s.seen) >= streamIdleTimeout {
+			delete(h.websockets, key)
+		}
+	}
+	for key, c := range h.h2c {
+		if t.Sub(c.seen) >= streamIdleTimeout {
+			delete(h.h2c, key)
+		}
+	}
+}
+
+// streamEvent returns an event of the start of a stream, or of the messages of a stream, of the protocol
+func streamEvent(data *capture.PacketMsg, eventType, protocol, host string, messages int) *Event {
+	event := newEvent(config.HTTPAnalyzer, eventType, data, false)
+	event.Host = host
+	event.Attributes[streamProtocol] = protocol
+	if eventType == httpMessage {
+		event.Attributes[streamMessages] = strconv.Itoa(messages)
+	}
+
+	return event
+}
@@ -0,0 +1,160 @@
+package analysis
+
+import (
+	"github.com/bytemare/gonetmon/pkg/config"
+	"sort"
+	"time"
+)
+
+// Number of long-lived, and of stale, connections kept in reports, the oldest
+const maxLingering = 20
+
+// Connection is a connection followed across report windows, from the flows recorded for it
+type Connection struct {
+	Device    string    // Interface on which the connection was first recorded
+	Protocol  string    // Transport protocol, either tcp or udp
+	SrcIP     string    // IP address of the originator, as first recorded
+	SrcPort   uint16    // Port of the originator
+	DstIP     string    // IP address of the responder
+	DstPort   uint16    // Port of the responder
+	FirstSeen time.Time // Capture timestamp of the first packet of the connection
+	LastSeen  time.Time // Capture timestamp of the last packet of the connection
+	Bytes     uint64    // Number of bytes sent in both directions since the first packet
+
+	// Time elapsed since the first and the last packets of the connection, at the time of the report
+	Age  time.Duration
+	Idle time.Duration
+
+	// Local processes owning the sockets of the originator and the responder, as <name>[<pid>], empty if none or not
+	// attributed
+	SrcProcess string
+	DstProcess string
+}
+
+// lingerTracker follows the connections of the flows of successive reports, to tell those open for long and those
+// gone idle without being closed. Connections are forgotten once closed or reset, or idle for the expiry.
+type lingerTracker struct {
+	limits      config.LingerConfig
+	connections map[string]*Connection // Connections still open, by flow key
+	now         time.Time              // Capture time of the latest packet, advanced by the time between reports without any
+	reported    time.Time              // Time of the latest report
+}
+
+// newLingerTracker returns a tracker of the long-lived and stale connections configured
+func newLingerTracker(limits *config.LingerConfig) *lingerTracker {
+	return &lingerTracker{
+		limits:      *limits,
+		connections: make(map[string]*Connection),
+		now:         time.Time{},
+		reported:    time.Time{},
+	}
+}
+
+// add follows the connections of the flows of the report, and returns those still open for at least the long-lived
+// age, oldest first, and the TCP connections neither closed nor reset but idle for at least the stale time, idle for
+// the longest first. Ages are told against capture timestamps, for replays to be judged on their own time.
+func (l *lingerTracker) add(report *Report) (longLived, stale []Connection) {
+	var latest time.Time
+	for _, flow := range report.Flows {
+		if flow.LastSeen.After(latest) {
+			latest = flow.LastSeen
+		}
+
+		key := flow.Key()
+		if (flow.SrcFlags|flow.DstFlags)&(FlagFIN|FlagRST) != 0 {
+			delete(l.connections, key)
+			continue
+		}
+
+		c, ok := l.connections[key]
+		if !ok {
+			if l.limits.MaxTracked > 0 && len(l.connections) >= l.limits.MaxTracked {
+				continue
+			}
+			c = &Connection{
+				Device:     flow.Device,
+				Protocol:   flow.Protocol,
+				SrcIP:      flow.SrcIP,
+				SrcPort:    flow.SrcPort,
+				DstIP:      flow.DstIP,
+				DstPort:    flow.DstPort,
+				FirstSeen:  flow.FirstSeen,
+				LastSeen:   flow.LastSeen,
+				Bytes:      0,
+				Age:        0,
+				Idle:       0,
+				SrcProcess: "",
+				DstProcess: "",
+			}
+			l.connections[key] = c
+		}
+
+		if flow.LastSeen.After(c.LastSeen) {
+			c.LastSeen = flow.LastSeen
+		}
+		c.Bytes += flow.SrcBytes + flow.DstBytes
+
+		// Orientations may differ between windows if a window saw the responder first
+		srcProcess, dstProcess := flow.SrcProcess, flow.DstProcess
+		if flow.SrcIP != c.SrcIP || flow.SrcPort != c.SrcPort {
+			srcProcess, dstProcess = dstProcess, srcProcess
+		}
+		if srcProcess != "" {
+			c.SrcProcess = srcProcess
+		}
+		if dstProcess != "" {
+			c.DstProcess = dstProcess
+		}
+	}
+
+	if latest.After(l.now) {
+		l.now = latest
+	} else if !l.reported.IsZero() {
+		l.now = l.now.Add(report.Timestamp.Sub(l.reported))
+	}
+	l.reported = report.Timestamp
+
+	for key, c := range l.connections {
+		c.Age, c.Idle = l.now.Sub(c.FirstSeen), l.now.Sub(c.LastSeen)
+		switch {
+		case c.Idle >= l.limits.Expiry:
+			delete(l.connections, key)
+		case c.Idle >= l.limits.Stale:
+			// UDP has no closing, its idle flows are over
+			if c.Protocol != "tcp" {
+				delete(l.connections, key)
+				continue
+			}
+			stale = append(stale, *c)
+		case c.Age >= l.limits.LongLived:
+			longLived = append(longLived, *c)
+		}
+	}
+
+	sortConnections(longLived, func(c *Connection) time.Time { return c.FirstSeen })
+	sortConnections(stale, func(c *Connection) time.Time { return c.LastSeen })
+
+	return oldest(longLived), oldest(stale)
+}
+
+// sortConnections sorts connections by increasing time, as told by since, and by flow key for equal times
+func sortConnections(connections []Connection, since func(c *Connection) time.Time) {
+	sort.Slice(connections, func(i, j int) bool {
+		ti, tj := since(&connections[i]), since(&connections[j])
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		ci, cj := &connections[i], &connections[j]
+		return flowKey(ci.Protocol, ci.SrcIP, ci.SrcPort, ci.DstIP, ci.DstPort) <
+			flowKey(cj.Protocol, cj.SrcIP, cj.SrcPort, cj.DstIP, cj.DstPort)
+	})
+}
+
+// oldest returns the first connections, up to the number kept in reports
+func oldest(connections []Connection) []Connection {
+	if len(connections) > maxLingering {
+		return connections[:maxLingering]
+	}
+
+	return connections
+}
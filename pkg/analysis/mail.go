@@ -0,0 +1,366 @@
+package analysis
+
+import (
+	"bytes"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/inventory"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// Types of mail events
+	mailMessage   = "message"   // A message is sent over SMTP, or retrieved over IMAP or POP3
+	mailUpgrade   = "starttls"  // A session is upgraded to TLS
+	mailDowngrade = "downgrade" // A session that could have been upgraded to TLS carries credentials or messages in clear
+
+	// Attributes of mail events
+	mailProtocol   = "protocol"   // smtp, imap or pop3
+	mailServer     = "server"     // Endpoint of the server, as <ip>:<port>
+	mailClient     = "client"     // Address of the client
+	mailSender     = "sender"     // Domain of the sender of an SMTP message
+	mailRecipients = "recipients" // Domains of the recipients of an SMTP message, comma separated and sorted
+	mailOutbound   = "outbound"   // Whether an SMTP message is relayed to a server outside of private networks
+	mailReason     = "reason"     // Why a session is downgraded : stripped, refused or cleartext
+
+	// Mail protocols
+	smtpProtocol = "smtp"
+	imapProtocol = "imap"
+	pop3Protocol = "pop3"
+
+	// Reasons of downgrades
+	downgradeStripped  = "stripped"  // The STARTTLS capability of the server was overwritten on its way to the client
+	downgradeRefused   = "refused"   // The server refused the STARTTLS command of the client
+	downgradeCleartext = "cleartext" // The client went on in clear, though the server offered STARTTLS
+
+	// Port SMTP servers relay messages on
+	smtpRelayPort = 25
+
+	// Bounds of the sessions followed, past which those idle for the timeout are forgotten, and new ones are ignored if
+	// none is
+	maxMailSessions    = 4096
+	mailSessionTimeout = 5 * time.Minute
+)
+
+// Protocols of the ports mail is exchanged on in clear, or upgraded to TLS with STARTTLS
+var mailPorts = map[uint16]string{
+	25:  smtpProtocol,
+	587: smtpProtocol,
+	143: imapProtocol,
+	110: pop3Protocol,
+}
+
+// mailAnalyzer interprets the commands and replies of SMTP, IMAP and POP3 sessions, to count messages, tell the domains
+// of the senders and the recipients of those sent, and detect sessions downgraded from STARTTLS. Only the envelope of
+// messages is read, never their content.
+type mailAnalyzer struct {
+	sessions map[string]*mailSession // Sessions followed, by stream
+	private  []*net.IPNet            // Private and link-local networks, outside of which SMTP servers are external
+}
+
+// mailSession is a mail session followed until it is upgraded to TLS or closed
+type mailSession struct {
+	protocol  string
+	server    string // Endpoint of the server, as <ip>:<port>
+	offered   bool   // Whether the server advertised STARTTLS
+	requested bool   // Whether the client sent STARTTLS, and awaits the reply of the server
+	degraded  bool   // Whether the session was reported downgraded
+	data      bool   // Whether the client is sending the content of an SMTP message
+	sender    string
+	rcpts     []string // Domains of the recipients of the SMTP message in progress, sorted
+	seen      time.Time
+}
+
+// newMailAnalyzer returns a mail analyzer
+func newMailAnalyzer(parameters *config.Parameters) (Analyzer, error) {
+	private, err := inventory.ParseNetworks(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mailAnalyzer{
+		sessions: make(map[string]*mailSession),
+		private:  private,
+	}, nil
+}
+
+// Name returns the name of the mail analyzer
+func (m *mailAnalyzer) Name() string {
+	return config.MailAnalyzer
+}
+
+// Match tells whether the TCP payload is exchanged with a mail port
+func (m *mailAnalyzer) Match(data *capture.PacketMsg) bool {
+	if len(tcpPayload(data)) == 0 {
+		return false
+	}
+	_, src := mailPorts[data.SrcPort]
+	_, dst := mailPorts[data.DstPort]
+
+	return src || dst
+}
+
+// Process returns the events of the commands or replies of the packet, following its session
+func (m *mailAnalyzer) Process(data *capture.PacketMsg) ([]*Event, error) {
+	key := streamKey(data)
+	session, ok := m.sessions[key]
+	if !ok {
+		if len(m.sessions) >= maxMailSessions {
+			m.expire(data.Timestamp)
+			if len(m.sessions) >= maxMailSessions {
+				return nil, nil
+			}
+		}
+
+		// The server is the endpoint on the mail port, the destination if both are
+		protocol, server := mailPorts[data.DstPort], endpoint(data.DstIP, data.DstPort)
+		if protocol == "" {
+			protocol, server = mailPorts[data.SrcPort], endpoint(data.SrcIP, data.SrcPort)
+		}
+		session = &mailSession{protocol: protocol, server: server}
+		m.sessions[key] = session
+	}
+	session.seen = data.Timestamp
+
+	var events []*Event
+	fromServer := endpoint(data.SrcIP, data.SrcPort) == session.server
+	for _, line := range mailLines(data.Payload, session, fromServer) {
+		var eventType, reason string
+		if fromServer {
+			eventType, reason = session.reply(line)
+		} else {
+			eventType, reason = session.command(line)
+		}
+
+		switch eventType {
+		case "":
+			continue
+		case mailUpgrade:
+			// Nothing more can be read once encrypted
+			delete(m.sessions, key)
+		case mailDowngrade:
+			if session.degraded {
+				continue
+			}
+			session.degraded = true
+		}
+
+		event := newEvent(config.MailAnalyzer, eventType, data, false)
+		event.Attributes[mailProtocol] = session.protocol
+		event.Attributes[mailServer] = session.server
+		event.Attributes[mailClient] = data.SrcIP
+		if fromServer {
+			event.Attributes[mailClient] = data.DstIP
+		}
+		if reason != "" {
+			event.Attributes[mailReason] = reason
+		}
+		if eventType == mailMessage && session.protocol == smtpProtocol {
+			event.Attributes[mailSender] = session.sender
+			event.Attributes[mailRecipients] = strings.Join(session.rcpts, ",")
+			event.Attributes[mailOutbound] = "false"
+			if data.DstPort == smtpRelayPort && !containsIP(m.private, net.ParseIP(data.DstIP)) {
+				event.Attributes[mailOutbound] = "true"
+			}
+			session.sender, session.rcpts = "", nil
+		}
+		events = append(events, event)
+
+		if eventType == mailUpgrade {
+			break
+		}
+	}
+
+	if data.FIN || data.RST {
+		delete(m.sessions, key)
+	}
+
+	return events, nil
+}
+
+// mailLines splits the payload into its lines. While the client sends the content of an SMTP message, only the line
+// ending it is returned, as "."
+func mailLines(payload []byte, session *mailSession, fromServer bool) []string {
+	if !fromServer && session.data {
+		if bytes.HasPrefix(payload, []byte(".\r\n")) || bytes.Contains(payload, []byte("\r\n.\r\n")) {
+			return []string{"."}
+		}
+		return nil
+	}
+
+	lines := strings.Split(string(payload), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], "\r")
+	}
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// command interprets a command line of the client, returning the type of its event if it makes one, and the reason
+// of downgrades
+func (s *mailSession) command(line string) (string, string) {
+	if s.protocol == smtpProtocol && s.data {
+		// The end of the content of the message
+		s.data = false
+		return mailMessage, ""
+	}
+
+	verb, argument := line, ""
+	if space := strings.IndexByte(line, ' '); space >= 0 {
+		verb, argument = line[:space], line[space+1:]
+	}
+	if s.protocol == imapProtocol {
+		// Commands are tagged
+		verb, argument = argument, ""
+		if space := strings.IndexByte(verb, ' '); space >= 0 {
+			verb, argument = verb[:space], verb[space+1:]
+		}
+	}
+	verb = strings.ToUpper(verb)
+
+	switch verb {
+	case "STARTTLS", "STLS":
+		s.requested = true
+		return "", ""
+	case "AUTH", "AUTHENTICATE", "LOGIN", "USER", "APOP":
+		if s.offered {
+			return mailDowngrade, downgradeCleartext
+		}
+	}
+
+	switch s.protocol {
+	case smtpProtocol:
+		switch verb {
+		case "MAIL":
+			s.sender = mailDomain(argument)
+			s.rcpts = nil
+			if s.offered {
+				return mailDowngrade, downgradeCleartext
+			}
+		case "RCPT":
+			if domain := mailDomain(argument); domain != "" {
+				s.rcpts = addSorted(s.rcpts, domain)
+			}
+		case "DATA":
+			s.data = true
+		}
+	case pop3Protocol:
+		if verb == "RETR" {
+			return mailMessage, ""
+		}
+	}
+
+	return "", ""
+}
+
+// reply interprets a reply line of the server, returning the type of its event if it makes one, and the reason of
+// downgrades
+func (s *mailSession) reply(line string) (string, string) {
+	upper := strings.ToUpper(line)
+
+	// Replies to STARTTLS tell whether the session is upgraded
+	if s.requested {
+		switch s.protocol {
+		case smtpProtocol:
+			if strings.HasPrefix(line, "220") {
+				return mailUpgrade, ""
+			}
+			if len(line) > 0 && (line[0] == '4' || line[0] == '5') {
+				s.requested = false
+				return mailDowngrade, downgradeRefused
+			}
+		case pop3Protocol:
+			if strings.HasPrefix(upper, "+OK") {
+				return mailUpgrade, ""
+			}
+			if strings.HasPrefix(upper, "-ERR") {
+				s.requested = false
+				return mailDowngrade, downgradeRefused
+			}
+		case imapProtocol:
+			if fields := strings.Fields(upper); len(fields) >= 2 && fields[0] != "*" {
+				if fields[1] == "OK" {
+					return mailUpgrade, ""
+				}
+				s.requested = false
+				return mailDowngrade, downgradeRefused
+			}
+		}
+	}
+
+	switch s.protocol {
+	case smtpProtocol:
+		// EHLO replies list a capability per line, e.g. 250-STARTTLS
+		if len(line) > 4 && strings.HasPrefix(line, "250") {
+			capability := strings.ToUpper(strings.TrimSpace(line[4:]))
+			if capability == "STARTTLS" {
+				s.offered = true
+			} else if isStrippedCapability(capability) {
+				return mailDowngrade, downgradeStripped
+			}
+		}
+	case pop3Protocol:
+		if upper == "STLS" {
+			s.offered = true
+		}
+	case imapProtocol:
+		if strings.Contains(upper, "CAPABILITY") {
+			if strings.Contains(upper, " STARTTLS") {
+				s.offered = true
+			} else if strings.Contains(upper, " XXXXXXXX") {
+				return mailDowngrade, downgradeStripped
+			}
+		}
+		// Messages retrieved, e.g. * 12 FETCH (BODY[] {3456}
+		if fields := strings.Fields(upper); len(fields) >= 4 && fields[0] == "*" && fields[2] == "FETCH" &&
+			(strings.Contains(upper, "BODY[") || strings.Contains(upper, "RFC822 ")) {
+			return mailMessage, ""
+		}
+	}
+
+	return "", ""
+}
+
+// isStrippedCapability tells whether an EHLO capability looks like STARTTLS overwritten by a middlebox, which keeps its
+// length, e.g. XXXXXXXA
+func isStrippedCapability(capability string) bool {
+	return len(capability) == len("STARTTLS") && strings.HasPrefix(capability, "XXXX")
+}
+
+// mailDomain returns the lowercased domain of the address of a MAIL FROM or RCPT TO argument, e.g. example.com for
+// FROM:<alice@Example.com> SIZE=1024. It is empty for the null sender.
+func mailDomain(argument string) string {
+	address := argument
+	if start := strings.IndexByte(address, '<'); start >= 0 {
+		address = address[start+1:]
+		if end := strings.IndexByte(address, '>'); end >= 0 {
+			address = address[:end]
+		}
+	} else if colon := strings.IndexByte(address, ':'); colon >= 0 {
+		address = address[colon+1:]
+		if fields := strings.Fields(address); len(fields) > 0 {
+			address = fields[0]
+		}
+	}
+
+	at := strings.LastIndexByte(address, '@')
+	if at < 0 {
+		return ""
+	}
+
+	return strings.ToLower(address[at+1:])
+}
+
+// expire forgets the sessions idle for the timeout at t
+func (m *mailAnalyzer) expire(t time.Time) {
+	for key, session := range m.sessions {
+		if t.Sub(session.seen) >= mailSessionTimeout {
+			delete(m.sessions, key)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package analysis
+
+import (
+	"context"
+	"errors"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/diagnostics"
+	"golang.org/x/sync/errgroup"
+	"sync"
+	"time"
+)
+
+// Throughput of analysis, published by the diagnostics server
+var (
+	analysedPackets = diagnostics.NewCounter("analysis.packets") // Packets received from capture
+	builtReports    = diagnostics.NewCounter("analysis.reports") // Reports sent to outputs
+	producedEvents  = diagnostics.NewCounter("analysis.events")  // Events extracted by analyzers
+
+	queuedLatency   = diagnostics.NewLatency("capture.queued")    // Time packets wait between capture and analysis
+	dispatchLatency = diagnostics.NewLatency("analysis.dispatch") // Time analyzers take to process a packet
+)
+
+// Monitor is a goroutine that listen on the dataChan channel to pull data packets and dispatch them to analyzers,
+// until ctx is cancelled. Packets are analysed in parallel by a worker for each set of analyzers, and hits are handed
+// to the watchdog, which Monitor runs. If packetChan is closed, once capture ended, Monitor returns after workers
+// analysed the batches they were handed and a last report was sent.
+func Monitor(ctx context.Context, parameters *config.Parameters, analyzers [][]Analyzer, recorder *capture.FlightRecorder, watchdog *alert.Watchdog, packetChan <-chan []capture.PacketMsg, reportChan chan<- *Report) error {
+	if len(analyzers) == 0 {
+		return errors.New("no analysis worker")
+	}
+
+	// Start a new monitoring session, and its watchdog and workers alongside
+	session, err := NewSession(parameters, analyzers, recorder, watchdog)
+	if err != nil {
+		return err
+	}
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	group, ctx := errgroup.WithContext(ctx)
+	group.Go(func() error {
+		return session.watchdog.Run(ctx)
+	})
+	if session.containers != nil {
+		group.Go(func() error {
+			session.containers.Run(ctx)
+			return nil
+		})
+	}
+	if session.workloads != nil {
+		group.Go(func() error {
+			session.workloads.Run(ctx)
+			return nil
+		})
+	}
+	if session.processes != nil {
+		group.Go(func() error {
+			session.processes.Run(ctx)
+			return nil
+		})
+	}
+	if session.keys != nil {
+		group.Go(func() error {
+			return session.keys.Run(ctx)
+		})
+	}
+	var workers sync.WaitGroup
+	for _, w := range session.workers {
+		w := w
+		workers.Add(1)
+		group.Go(func() error {
+			defer workers.Done()
+			w.run(ctx)
+			return nil
+		})
+	}
+
+	// Set up ticker to regularly send reports to display
+	tickerReport := time.NewTicker(parameters.DisplayRefresh)
+
+	// Measures the activity of the pipeline over the window of each report
+	sampler := diagnostics.NewSampler()
+
+	// Build report and send to display, which flushes session analysis. Returns false if ctx is cancelled before.
+	sendReport := func(tr time.Time) bool {
+		log.Info("Preparing report.")
+
+		report := session.BuildReport(tr)
+		report.Pipeline = sampler.Sample()
+
+		if session.trends != nil {
+			session.trends.Add(report.TrafficRates(parameters.DisplayRefresh), report.Timestamp)
+			if err := session.trends.Save(); err != nil {
+				log.Error("Could not save the bandwidth trends : ", err)
+			}
+			session.watchdog.VerifyCapacity(ctx, session.trends.Forecast(parameters.Capacity.Links, parameters.Capacity.Horizon, report.Timestamp), tr)
+		}
+		if parameters.Storms.Enabled {
+			broadcast, multicast := report.CastRates(parameters.DisplayRefresh)
+			session.watchdog.VerifyStorms(ctx, broadcast, multicast, tr)
+		}
+		if parameters.Integrity.Enabled {
+			session.watchdog.VerifyCorruption(ctx, report.CorruptionRates(parameters.Integrity.MinPackets), tr)
+		}
+		if session.uploads != nil {
+			session.watchdog.VerifyUploads(ctx, session.uploads.add(report), tr)
+		}
+		if len(parameters.Changes) > 0 {
+			session.watchdog.VerifyChanges(ctx, report.Metrics(), tr)
+		}
+		if session.countries != nil {
+			session.watchdog.VerifyCountries(ctx, session.countries.add(report), tr)
+		}
+		if session.watch != nil {
+			silent, unreachable := report.WatchLevels()
+			session.watchdog.VerifyWatched(ctx, silent, unreachable, tr)
+		}
+		if parameters.ErrorRates.Enabled {
+			session.watchdog.VerifyErrorRates(ctx, report.ErrorRates(parameters.ErrorRates.MinResponses), tr)
+		}
+		if parameters.CallQuality.Enabled {
+			jitter, loss := report.CallQuality(parameters.CallQuality.MinPackets)
+			session.watchdog.VerifyCallQuality(ctx, jitter, loss, tr)
+		}
+		if parameters.Mail.Spikes {
+			session.watchdog.VerifyMailSpikes(ctx, report.Outbound, tr)
+		}
+		if parameters.SSH.BruteForce {
+			session.watchdog.VerifySSHBruteForce(ctx, report.SSHBruteForce(), tr)
+		}
+		if len(parameters.SSH.Servers) > 0 {
+			session.watchdog.VerifySSHDestinations(ctx, report.SSHUnexpected(), tr)
+		}
+		if parameters.NTP.Amplification {
+			session.watchdog.VerifyNTPAmplification(ctx, report.NTPAmplification(parameters.NTP.MinBytes), tr)
+		}
+		if len(parameters.NTP.Servers) > 0 {
+			session.watchdog.VerifyNTPServers(ctx, report.NTPUnexpected(), tr)
+		}
+		if parameters.ARP.Enabled {
+			for _, c := range report.Spoofing {
+				session.watchdog.ARPConflict(ctx, c.String(), c.Seen)
+			}
+		}
+		if parameters.TLSPolicy.Enabled {
+			for _, v := range report.Policy {
+				session.watchdog.TLSViolation(ctx, v.String(), v.Seen)
+			}
+		}
+		if parameters.Mail.Downgrades {
+			for _, d := range report.Cleartext {
+				session.watchdog.MailDowngrade(ctx, d.String(), d.Seen)
+			}
+		}
+		if parameters.Inventory.AlertNew {
+			for i := range report.NewHosts {
+				session.watchdog.NewHost(ctx, report.NewHosts[i].String(), report.NewHosts[i].FirstSeen)
+			}
+		}
+
+		select {
+		case reportChan <- report:
+			builtReports.Inc()
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+monitorLoop:
+	for {
+		select {
+
+		case <-ctx.Done():
+			log.Info("Monitor received stop signal")
+			break monitorLoop
+
+		case tr := <-tickerReport.C:
+			if !sendReport(tr) {
+				break monitorLoop
+			}
+
+		case batch, ok := <-packetChan:
+			// Capture ended, e.g. with the files of a replay : the last window is reported once workers are done
+			if !ok {
+				log.Info("Capture ended, finishing analysis.")
+				for _, w := range session.workers {
+					close(w.batches)
+				}
+				workers.Wait()
+				sendReport(time.Now())
+				break monitorLoop
+			}
+
+			// Hand batch over to its worker
+			select {
+			case session.worker(batch).batches <- batch:
+			case <-ctx.Done():
+				capture.Release(batch)
+				break monitorLoop
+			}
+		}
+
+	}
+
+	tickerReport.Stop()
+
+	log.Info("Monitor terminating")
+
+	// Wait for the watchdog and workers to stop
+	stop()
+	err = group.Wait()
+
+	// Release analyzers holding resources, e.g. external processes
+	for _, set := range analyzers {
+		CloseAnalyzers(set)
+	}
+
+	return err
+}
@@ -0,0 +1,84 @@
+package analysis
+
+import (
+	"context"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/internal/packettest"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+	"testing"
+)
+
+// BenchmarkMonitor measures the throughput of capture and analysis, from a MockSource of HTTP exchanges
+func BenchmarkMonitor(b *testing.B) {
+	log.SetLevel(logrus.WarnLevel)
+	parameters := config.LoadParams()
+
+	packets, err := packettest.HTTPExchanges(1000)
+	if err != nil {
+		b.Fatal(err)
+	}
+	devices, err := capture.NewDevices(parameters.PacketFilter, &parameters.CaptureConfig)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	// The source is closed for reads to end once its packets are delivered, as a capture file's would
+	source := capture.NewMockSource(packettest.Cycle(packets, b.N))
+	_ = source.Close()
+	devices.Add("bench", "", source)
+
+	analyzers := make([][]Analyzer, 0, parameters.AnalysisWorkers)
+	for i := 0; i < parameters.AnalysisWorkers; i++ {
+		set, err := NewAnalyzers(parameters)
+		if err != nil {
+			b.Fatal(err)
+		}
+		analyzers = append(analyzers, set)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	group, ctx := errgroup.WithContext(ctx)
+
+	packetChan := make(chan []capture.PacketMsg, 16)
+	reportChan := make(chan *Report, 1)
+	alertChan := make(chan alert.Message, 1)
+	watchdog := alert.NewWatchdog(parameters, nil, alertChan)
+	analysed := make(chan struct{})
+
+	b.SetBytes(int64(packettest.Bytes(packets) / len(packets)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	group.Go(func() error {
+		return capture.Collector(ctx, devices, packetChan)
+	})
+	group.Go(func() error {
+		defer close(analysed)
+		return Monitor(ctx, parameters, analyzers, nil, watchdog, packetChan, reportChan)
+	})
+
+	// Discard reports and alerts
+	group.Go(func() error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-reportChan:
+			case <-alertChan:
+			}
+		}
+	})
+
+	// Monitor returns once it analysed all packets collected from the exhausted source
+	<-analysed
+
+	b.StopTimer()
+	cancel()
+	if err := group.Wait(); err != nil {
+		b.Fatal(err)
+	}
+}
@@ -0,0 +1,132 @@
+package analysis
+
+import (
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"strconv"
+	"time"
+)
+
+const (
+	// Types of MTU events
+	mtuReassembled = "reassembled" // All the fragments of a datagram were seen
+	mtuIncomplete  = "incomplete"  // Fragments of a datagram were missing after the reassembly timeout
+	mtuTooBig      = "too_big"     // A router told a datagram was too big for the MTU of its next hop
+
+	// Attributes of MTU events
+	mtuSource      = "source"      // Source of the datagram
+	mtuDestination = "destination" // Destination of the datagram
+	mtuSize        = "size"        // Length of the data of a reassembled datagram, in bytes
+	mtuNextHop     = "mtu"         // MTU of the next hop a datagram was too big for, 0 if not told
+	mtuRouter      = "router"      // Address of the router that told a datagram was too big
+
+	// Bounds of the datagrams reassembled, past which those past the timeout are forgotten, and new ones are ignored
+	// if none is
+	maxDatagrams = 4096
+
+	// Time after the first fragment of a datagram past which it is taken to have failed reassembly, as hosts give up
+	mtuReassemblyTimeout = 30 * time.Second
+)
+
+// mtuAnalyzer follows the fragments of IP datagrams to tell those reassembled from those missing some, and reads the
+// ICMP messages routers send back for datagrams too big for the next hop, whose loss makes connections hang when
+// path MTU discovery is broken
+type mtuAnalyzer struct {
+	datagrams map[datagramKey]*datagram // Datagrams whose fragments are being seen
+	swept     time.Time                 // Capture time datagrams were last checked for the timeout
+}
+
+// datagramKey identifies a fragmented datagram
+type datagramKey struct {
+	src string
+	dst string
+	id  uint32
+}
+
+// datagram is a fragmented datagram, whose fragments are being seen
+type datagram struct {
+	received int       // Bytes of data of the fragments seen
+	total    int       // Length of the data of the datagram, 0 until its last fragment is seen
+	first    time.Time // Capture time of the first fragment seen
+}
+
+// newMTUAnalyzer returns an MTU analyzer
+func newMTUAnalyzer(parameters *config.Parameters) (Analyzer, error) {
+	return &mtuAnalyzer{datagrams: make(map[datagramKey]*datagram)}, nil
+}
+
+// Name returns the name of the MTU analyzer
+func (m *mtuAnalyzer) Name() string {
+	return config.MTUAnalyzer
+}
+
+// Match tells whether the packet is a fragment, or an ICMP message telling a datagram was too big
+func (m *mtuAnalyzer) Match(data *capture.PacketMsg) bool {
+	return data.Fragment != nil || data.TooBig != nil
+}
+
+// Process returns the event of a datagram too big, or of a datagram whose last missing fragment the packet is, along
+// with those of the datagrams that failed reassembly since the last check
+func (m *mtuAnalyzer) Process(data *capture.PacketMsg) ([]*Event, error) {
+	events := m.expire(data)
+
+	if data.TooBig != nil {
+		event := newEvent(config.MTUAnalyzer, mtuTooBig, data, false)
+		event.Attributes[mtuSource] = data.TooBig.SrcIP
+		event.Attributes[mtuDestination] = data.TooBig.DstIP
+		event.Attributes[mtuNextHop] = strconv.Itoa(data.TooBig.MTU)
+		event.Attributes[mtuRouter] = data.SrcIP
+		return append(events, event), nil
+	}
+
+	key := datagramKey{src: data.SrcIP, dst: data.DstIP, id: data.Fragment.ID}
+	d, ok := m.datagrams[key]
+	if !ok {
+		if len(m.datagrams) >= maxDatagrams {
+			return events, nil
+		}
+		d = &datagram{received: 0, total: 0, first: data.Timestamp}
+		m.datagrams[key] = d
+	}
+
+	// Duplicated fragments are not told apart, so that a datagram may be taken for complete early
+	d.received += data.Fragment.Length
+	if !data.Fragment.More {
+		d.total = data.Fragment.Offset + data.Fragment.Length
+	}
+	if d.total == 0 || d.received < d.total {
+		return events, nil
+	}
+	delete(m.datagrams, key)
+
+	event := newEvent(config.MTUAnalyzer, mtuReassembled, data, false)
+	event.Attributes[mtuSource] = key.src
+	event.Attributes[mtuDestination] = key.dst
+	event.Attributes[mtuSize] = strconv.Itoa(d.total)
+
+	return append(events, event), nil
+}
+
+// expire forgets the datagrams past the reassembly timeout at the capture time of the packet, returning the events of
+// their failure. Datagrams are checked at most once per second.
+func (m *mtuAnalyzer) expire(data *capture.PacketMsg) []*Event {
+	if data.Timestamp.Sub(m.swept) < time.Second && len(m.datagrams) < maxDatagrams {
+		return nil
+	}
+	m.swept = data.Timestamp
+
+	var events []*Event
+	for key, d := range m.datagrams {
+		if data.Timestamp.Sub(d.first) < mtuReassemblyTimeout {
+			continue
+		}
+		delete(m.datagrams, key)
+
+		event := newEvent(config.MTUAnalyzer, mtuIncomplete, data, false)
+		event.Attributes[mtuSource] = key.src
+		event.Attributes[mtuDestination] = key.dst
+		events = append(events, event)
+	}
+
+	return events
+}
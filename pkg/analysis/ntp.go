@@ -0,0 +1,116 @@
+package analysis
+
+import (
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"net"
+	"strconv"
+)
+
+const (
+	// Types of NTP events
+	ntpQuery    = "query"    // A client queries a server, for the time or with a control or private command
+	ntpResponse = "response" // A server answers a client
+
+	// Attributes of NTP events
+	ntpServer   = "server"   // Address of the server
+	ntpClient   = "client"   // Address of the client
+	ntpMode     = "mode"     // Mode of the message, e.g. client, control or private
+	ntpBytes    = "bytes"    // Length of the NTP message
+	ntpStratum  = "stratum"  // Stratum of the server, as told by its time responses
+	ntpExpected = "expected" // Whether the server is among the expected NTP servers
+
+	// Port NTP messages are exchanged on
+	ntpPort = 123
+
+	// NTP header values
+	ntpHeaderLength = 4 // Minimum length read, from the mode to the stratum, or to the flags of control and private modes
+	ntpModeMask     = 0x07
+	ntpResponseBit  = 0x80 // Response bit, of the first byte of private messages and of the second of control messages
+	ntpClientMode   = 3
+	ntpServerMode   = 4
+	ntpControlMode  = 6
+	ntpPrivateMode  = 7
+
+	// Length of the smallest queries, private mode requests without data
+	ntpSmallestQuery = 8
+)
+
+// Names of the modes of NTP messages that are queries or responses
+var ntpModes = map[uint8]string{
+	ntpClientMode:  "client",
+	ntpServerMode:  "server",
+	ntpControlMode: "control",
+	ntpPrivateMode: "private",
+}
+
+// ntpAnalyzer interprets the NTP messages clients exchange with servers, telling the servers hosts sync to, and the
+// bytes of queries and responses, whose ratio tells of amplification, e.g. by monlist commands of the private mode
+type ntpAnalyzer struct {
+	servers []*net.IPNet // Expected NTP servers. If empty, any is expected.
+}
+
+// newNTPAnalyzer returns an NTP analyzer, whose expected servers are checked
+func newNTPAnalyzer(parameters *config.Parameters) (Analyzer, error) {
+	servers, err := ParseAddresses(parameters.NTP.Servers)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ntpAnalyzer{servers: servers}, nil
+}
+
+// Name returns the name of the NTP analyzer
+func (n *ntpAnalyzer) Name() string {
+	return config.NTPAnalyzer
+}
+
+// ntpQueryOrResponse tells whether the packet carries an NTP query or response, and which
+func ntpQueryOrResponse(data *capture.PacketMsg) (mode uint8, response bool, ok bool) {
+	if data.Protocol != "udp" || (data.SrcPort != ntpPort && data.DstPort != ntpPort) ||
+		len(data.Payload) < ntpHeaderLength {
+		return 0, false, false
+	}
+
+	mode = data.Payload[0] & ntpModeMask
+	switch mode {
+	case ntpClientMode:
+		return mode, false, true
+	case ntpServerMode:
+		return mode, true, true
+	case ntpControlMode:
+		return mode, data.Payload[1]&ntpResponseBit != 0, true
+	case ntpPrivateMode:
+		return mode, data.Payload[0]&ntpResponseBit != 0, true
+	}
+
+	return 0, false, false
+}
+
+// Match tells whether the packet carries an NTP query or response, leaving out symmetric and broadcast modes
+func (n *ntpAnalyzer) Match(data *capture.PacketMsg) bool {
+	_, _, ok := ntpQueryOrResponse(data)
+	return ok
+}
+
+// Process returns the event of the query or the response, with its length
+func (n *ntpAnalyzer) Process(data *capture.PacketMsg) ([]*Event, error) {
+	mode, response, _ := ntpQueryOrResponse(data)
+
+	eventType, server, client := ntpQuery, data.DstIP, data.SrcIP
+	if response {
+		eventType, server, client = ntpResponse, data.SrcIP, data.DstIP
+	}
+
+	event := newEvent(config.NTPAnalyzer, eventType, data, false)
+	event.Attributes[ntpServer] = server
+	event.Attributes[ntpClient] = client
+	event.Attributes[ntpMode] = ntpModes[mode]
+	event.Attributes[ntpBytes] = strconv.Itoa(len(data.Payload))
+	event.Attributes[ntpExpected] = strconv.FormatBool(len(n.servers) == 0 || containsIP(n.servers, net.ParseIP(server)))
+	if mode == ntpServerMode {
+		event.Attributes[ntpStratum] = strconv.Itoa(int(data.Payload[1]))
+	}
+
+	return []*Event{event}, nil
+}
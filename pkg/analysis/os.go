@@ -0,0 +1,130 @@
+package analysis
+
+import (
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Types of OS fingerprinting events
+	osFingerprint = "fingerprint"
+
+	// Attributes of OS fingerprinting events
+	osName     = "os"
+	osDistance = "distance"
+	osExact    = "exact"
+	osOptions  = "options"
+)
+
+// osSignature is the SYN signature of an operating system, in the manner of p0f
+type osSignature struct {
+	os      string
+	ttl     uint8  // Initial TTL
+	window  string // Receive window, either *, a number of bytes, or a multiple of the MSS as mss*N
+	options string // Layout of the TCP options, trailing end of list options aside
+}
+
+// Known SYN signatures, of common operating systems. SYN+ACK segments echo the options of the SYN they answer, so
+// that servers mostly match them on their initial TTL only.
+var osSignatures = []osSignature{
+	{os: "Linux", ttl: 64, window: "*", options: "mss,sok,ts,nop,ws"},
+	{os: "Linux", ttl: 64, window: "*", options: "mss,nop,nop,sok,nop,ws"},
+	{os: "Windows", ttl: 128, window: "*", options: "mss,nop,ws,nop,nop,sok"},
+	{os: "Windows", ttl: 128, window: "*", options: "mss,nop,ws,sok,ts"},
+	{os: "Windows XP", ttl: 128, window: "*", options: "mss,nop,nop,sok"},
+	{os: "macOS or iOS", ttl: 64, window: "65535", options: "mss,nop,ws,nop,nop,ts,sok"},
+	{os: "FreeBSD", ttl: 64, window: "65535", options: "mss,nop,ws,sok,ts"},
+	{os: "OpenBSD", ttl: 64, window: "16384", options: "mss,nop,nop,sok,nop,ws,nop,nop,ts"},
+}
+
+// Operating systems guessed from the initial TTL alone, when no signature matches
+var osFamilies = map[uint8]string{
+	64:  "Linux or Unix",
+	128: "Windows",
+	255: "Network device or Solaris",
+}
+
+// Initial TTLs operating systems use, in increasing order
+var initialTTLs = []uint8{32, 64, 128, 255}
+
+// osAnalyzer guesses the operating systems of remote hosts from the TCP SYN and SYN+ACK segments they send, reporting
+// them for the host inventory of reports
+type osAnalyzer struct{}
+
+// newOSAnalyzer returns an OS fingerprinting analyzer
+func newOSAnalyzer(parameters *config.Parameters) (Analyzer, error) {
+	return &osAnalyzer{}, nil
+}
+
+// Name returns the name of the OS fingerprinting analyzer
+func (o *osAnalyzer) Name() string {
+	return config.OSAnalyzer
+}
+
+// Match tells whether the packet is a TCP SYN or SYN+ACK segment sent by the remote peer
+func (o *osAnalyzer) Match(data *capture.PacketMsg) bool {
+	return data.Signature != nil && data.TTL != 0 && data.SrcIP == data.RemoteIP
+}
+
+// Process returns a fingerprint event, whose attributes are the guessed operating system, whether it matched a
+// known signature or only a TTL, the number of hops to the host, and the layout of the segment's options
+func (o *osAnalyzer) Process(data *capture.PacketMsg) ([]*Event, error) {
+	ttl := initialTTL(data.TTL)
+	guess, exact := guessOS(data.Signature, ttl)
+
+	event := newEvent(config.OSAnalyzer, osFingerprint, data, false)
+	event.Attributes[osName] = guess
+	event.Attributes[osExact] = strconv.FormatBool(exact)
+	event.Attributes[osDistance] = strconv.Itoa(int(ttl - data.TTL))
+	event.Attributes[osOptions] = data.Signature.Options
+	return []*Event{event}, nil
+}
+
+// initialTTL returns the initial TTL the sender of a packet received with ttl most likely set
+func initialTTL(ttl uint8) uint8 {
+	for _, initial := range initialTTLs {
+		if ttl <= initial {
+			return initial
+		}
+	}
+
+	return initialTTLs[len(initialTTLs)-1]
+}
+
+// guessOS returns the operating system of the known signature the segment matches, or else the one that uses its
+// initial TTL, and whether a signature matched
+func guessOS(s *capture.SYNSignature, ttl uint8) (string, bool) {
+	// Options are padded with end of list options, whose number depends on the others
+	options := s.Options
+	for strings.HasSuffix(options, ",eol") {
+		options = strings.TrimSuffix(options, ",eol")
+	}
+
+	for _, signature := range osSignatures {
+		if signature.ttl == ttl && signature.options == options && matchWindow(signature.window, s) {
+			return signature.os, true
+		}
+	}
+
+	if family, ok := osFamilies[ttl]; ok {
+		return family, false
+	}
+
+	return "unknown", false
+}
+
+// matchWindow tells whether the receive window of the segment matches the pattern of a signature
+func matchWindow(pattern string, s *capture.SYNSignature) bool {
+	if pattern == "*" {
+		return true
+	}
+
+	if strings.HasPrefix(pattern, "mss*") {
+		n, err := strconv.Atoi(strings.TrimPrefix(pattern, "mss*"))
+		return err == nil && s.MSS != 0 && int(s.Window) == n*int(s.MSS)
+	}
+
+	return pattern == strconv.Itoa(int(s.Window))
+}
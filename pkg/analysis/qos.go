@@ -0,0 +1,66 @@
+package analysis
+
+import (
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"strconv"
+)
+
+// Names of the standard DSCP classes, by code point
+var dscpClasses = map[uint8]string{
+	0:  "CS0",
+	1:  "LE",
+	8:  "CS1",
+	10: "AF11",
+	12: "AF12",
+	14: "AF13",
+	16: "CS2",
+	18: "AF21",
+	20: "AF22",
+	22: "AF23",
+	24: "CS3",
+	26: "AF31",
+	28: "AF32",
+	30: "AF33",
+	32: "CS4",
+	34: "AF41",
+	36: "AF42",
+	38: "AF43",
+	40: "CS5",
+	44: "VA",
+	46: "EF",
+	48: "CS6",
+	56: "CS7",
+}
+
+// DSCPClass returns the name of the DSCP class of the code point, e.g. EF or AF41, or DSCP <n> for a code point
+// outside of the standard classes
+func DSCPClass(dscp uint8) string {
+	if class, ok := dscpClasses[dscp]; ok {
+		return class
+	}
+
+	return "DSCP " + strconv.Itoa(int(dscp))
+}
+
+// ClassStats holds the traffic of a DSCP class on an interface during a report window
+type ClassStats struct {
+	Packets uint64
+	Bytes   uint64
+}
+
+// AccountDSCP counts the IP packet in the traffic of the DSCP class of its marking, on its interface
+func (a *Analysis) AccountDSCP(data *capture.PacketMsg) {
+	if data.SrcIP == "" {
+		return
+	}
+
+	device := a.device(data.Device)
+	if device.DSCP == nil {
+		device.DSCP = make(map[string]ClassStats)
+	}
+	class := DSCPClass(data.DSCP)
+	stats := device.DSCP[class]
+	stats.Packets++
+	stats.Bytes += uint64(data.Length)
+	device.DSCP[class] = stats
+}
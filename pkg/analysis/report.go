@@ -0,0 +1,1853 @@
+// Package analysis dispatches captured packets to protocol analyzers, and aggregates their events and network flows into periodic reports
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/diagnostics"
+	"github.com/bytemare/gonetmon/pkg/inventory"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var log = config.Logger
+
+// RequestStats holds the requests made for a section
+type RequestStats struct {
+	Total   uint            // Sum of all the elements
+	Methods map[string]uint // Map request methods to the number of times they were encountered
+}
+
+// ResponseStats holds the responses received from a host
+type ResponseStats struct {
+	Total  uint         // Sum of all registered elements
+	Status map[int]uint // Map status codes to the number of times they were encountered
+}
+
+// SectionStats holds information about traffic with a section of a host
+type SectionStats struct {
+	Section  string       // Section of a website
+	Hits     int          // Number of requests that were made for that section
+	Requests RequestStats // Associated statistics
+}
+
+// SortedSections implements sort.Interface based on the hit field
+type SortedSections []*SectionStats
+
+func (s SortedSections) Len() int           { return len(s) }
+func (s SortedSections) Less(i, j int) bool { return s[i].Hits < s[j].Hits }
+func (s SortedSections) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// HostStats holds information about traffic with a host
+type HostStats struct {
+	Host     string                   // Domain name
+	IPs      []string                 // IP addresses that were encountered for that host (sort of a local DNS cache)
+	Hits     int                      // Number of successfully recognised packets associated with that host
+	Sections map[string]*SectionStats // Statistics about requested sections of that host
+	// Statistics about responses on that host
+	Responses ResponseStats // Statistics about responses from that hosts
+}
+
+// DeviceStats holds the traffic analysed on a network interface
+type DeviceStats struct {
+	Hits      int
+	Bytes     uint64
+	Container string // Docker container on the other end of the interface, if it is the host side of a veth pair
+	Broadcast uint64 // Number of broadcast frames captured on the interface, only counted if storms are detected
+	Multicast uint64 // Number of multicast frames captured on the interface, only counted if storms are detected
+	Packets   uint64 // Number of packets captured on the interface, those filters dropped included
+	Traffic   uint64 // Number of bytes of the packets analysed on the interface, hits or not
+	Checksum  uint64 // Number of packets failing their checksums, only counted if checksums are verified
+	Truncated uint64 // Number of packets shorter than their headers tell
+	Malformed uint64 // Number of packets whose headers cannot be decoded
+
+	// Packets and bytes by DSCP class, only counted if traffic is broken down by QoS marking
+	DSCP map[string]ClassStats
+}
+
+// Corrupt returns the number of packets captured on the interface that failed an integrity check
+func (s DeviceStats) Corrupt() uint64 {
+	return s.Checksum + s.Truncated + s.Malformed
+}
+
+// ProcessStats holds the traffic of a local process during a report window
+type ProcessStats struct {
+	PID   int
+	Name  string
+	Bytes uint64 // Bytes of the flows of the process, in both directions
+	Flows int    // Number of flows of the process
+}
+
+// HTTPStats holds the responses of an HTTP host paired with the requests they answer during a report window
+type HTTPStats struct {
+	Responses    uint          // Number of responses
+	ClientErrors uint          // Number of 4xx responses
+	ServerErrors uint          // Number of 5xx responses
+	P50          time.Duration // Median of the response times
+	P90          time.Duration // 90th percentile of the response times
+	P99          time.Duration // 99th percentile of the response times
+}
+
+// ErrorRate returns the share of 4xx and 5xx responses, between 0 and 1
+func (s HTTPStats) ErrorRate() float64 {
+	if s.Responses == 0 {
+		return 0
+	}
+
+	return float64(s.ClientErrors+s.ServerErrors) / float64(s.Responses)
+}
+
+// PathStats holds the requests made for the full path of an HTTP host during a report window
+type PathStats struct {
+	Host     string
+	Path     string
+	Requests int
+}
+
+// MediaStats holds the HTTP responses of a category of content during a report window
+type MediaStats struct {
+	Responses int
+	Bytes     uint64 // Sum of the lengths of the bodies of the responses, as told by their Content-Length headers
+}
+
+// StreamStats holds the streams of a protocol carried over HTTP, gRPC calls or WebSocket connections, started during
+// a report window, and the messages they exchanged
+type StreamStats struct {
+	Streams  int
+	Messages int
+}
+
+// CallStats holds the signalling and the media of a VoIP call during a report window
+type CallStats struct {
+	From     string
+	To       string
+	Codecs   []string      // Codecs of the RTP packets of the call, sorted
+	Answered bool          // Whether the call was answered during the window
+	Ended    bool          // Whether the call was hung up during the window
+	Received uint64        // RTP packets received
+	Lost     uint64        // RTP packets estimated lost, as missing from the sequence numbers of those received
+	Jitter   time.Duration // Highest interarrival jitter of the streams of the call
+}
+
+// Loss returns the share of the RTP packets of the call estimated lost, between 0 and 1
+func (c CallStats) Loss() float64 {
+	if c.Received+c.Lost == 0 {
+		return 0
+	}
+
+	return float64(c.Lost) / float64(c.Received+c.Lost)
+}
+
+// MailStats holds the messages and the sessions of a mail protocol during a report window
+type MailStats struct {
+	Messages   int // Messages sent over SMTP, or retrieved over IMAP or POP3
+	Upgrades   int // Sessions upgraded to TLS with STARTTLS
+	Downgrades int // Sessions that could have been upgraded to TLS but went on in clear
+}
+
+// MailDomainStats holds the SMTP messages sent from and to a domain during a report window
+type MailDomainStats struct {
+	Sent     int
+	Received int
+}
+
+// MailDowngrade is a mail session that could have been upgraded to TLS but went on in clear
+type MailDowngrade struct {
+	Protocol string
+	Client   string    // Address of the client
+	Server   string    // Endpoint of the server, as <ip>:<port>
+	Reason   string    // stripped if the STARTTLS capability was overwritten, refused if the server refused STARTTLS, or cleartext
+	Seen     time.Time // Capture timestamp of the downgrade
+}
+
+// String describes the downgrade, e.g. smtp session of 10.0.0.2 with 203.0.113.9:25 (stripped)
+func (d MailDowngrade) String() string {
+	return fmt.Sprintf("%s session of %s with %s (%s)", d.Protocol, d.Client, d.Server, d.Reason)
+}
+
+// SSHStats holds the SSH sessions of a server during a report window
+type SSHStats struct {
+	Software string         // Software of the server, as told by its banner
+	Expected bool           // Whether the server is among the expected SSH destinations, or any is
+	Sessions map[string]int // Sessions started, by client address
+	Short    map[string]int // Sessions closed shortly after their start, e.g. failed logins, by client address
+	Clients  map[string]int // Banners of clients, by software, e.g. OpenSSH_8.9p1 or PuTTY_Release_0.78
+	Longest  time.Duration  // Longest session closed
+}
+
+// NTPStats holds the NTP queries and responses a server exchanged during a report window
+type NTPStats struct {
+	Expected bool              // Whether the server is among the expected NTP servers, or any is
+	Stratum  int               // Stratum of the server, as told by its last time response. 0 if unknown.
+	Clients  map[string]int    // Time queries, by client address
+	Commands int               // Control and private queries, e.g. monlist, which amplification abuses
+	Queried  map[string]uint64 // Bytes of the queries of all modes, by client address
+	Answered map[string]uint64 // Bytes of the responses of all modes, by client address
+}
+
+// MTUStats holds the fragmented datagrams sent over a path during a report window, and the datagrams routers told
+// were too big for it
+type MTUStats struct {
+	Source      string
+	Destination string
+	Reassembled int // Fragmented datagrams whose fragments were all seen
+	Incomplete  int // Fragmented datagrams missing fragments after the reassembly timeout
+	TooBig      int // ICMP messages telling a datagram was too big for the next hop
+	MTU         int // Smallest MTU of a next hop routers told, 0 if none did
+	Largest     int // Length of the data of the largest datagram reassembled, in bytes
+}
+
+// Troubled tells whether datagrams of the path were lost to fragmentation or were too big, which hangs connections if
+// path MTU discovery is broken
+func (s MTUStats) Troubled() bool {
+	return s.Incomplete > 0 || s.TooBig > 0
+}
+
+// StallStats holds the stalls of the data a sender sent a receiver over a TCP connection during a report window, and
+// the times the receiver closed its window to zero
+type StallStats struct {
+	Sender      string        // Endpoint of the sender, as <ip>:<port>
+	Receiver    string        // Endpoint of the receiver, as <ip>:<port>
+	Stalls      int           // Times the data made no forward progress for the stall timeout
+	Reason      string        // Why the data last stalled, unacknowledged or zero_window
+	Longest     time.Duration // Longest time the data made no progress, as far as seen when the window ended
+	ZeroWindows int           // Times the receiver closed its window to zero since the connection was followed
+}
+
+// TLSViolation is a TLS handshake whose server negotiated a version or a cipher suite the policy forbids
+type TLSViolation struct {
+	Client  string // Address of the client
+	Server  string // Endpoint of the server, as <ip>:<port>
+	Version string // Version negotiated, e.g. TLS 1.0
+	Cipher  string // Cipher suite negotiated, e.g. TLS_RSA_WITH_RC4_128_SHA
+	Reason  string // What violates the policy, version, cipher or both comma separated
+	Seen    time.Time
+}
+
+// String describes the violation, e.g. TLS 1.0 with TLS_RSA_WITH_RC4_128_SHA between 10.0.0.2 and 203.0.113.9:443
+// (version,cipher)
+func (v TLSViolation) String() string {
+	return fmt.Sprintf("%s with %s between %s and %s (%s)", v.Version, v.Cipher, v.Client, v.Server, v.Reason)
+}
+
+// ARPConflict is an IP address claimed by another hardware address than the one that claimed it before, within the
+// window or, for gateways, at any time
+type ARPConflict struct {
+	IP             string
+	MAC            string // Hardware address now claiming the IP address
+	Vendor         string // Vendor of the hardware address now claiming the IP address, empty if unknown
+	Previous       string // Hardware address that claimed the IP address before
+	PreviousVendor string // Vendor of the hardware address that claimed the IP address before, empty if unknown
+	Gateway        bool   // Whether the IP address is that of a gateway
+	Seen           time.Time
+}
+
+// String describes the conflict, e.g. gateway 192.168.1.1 claimed by 00:11:22:33:44:55 (Acme) instead of
+// 66:77:88:99:aa:bb (Cisco)
+func (c ARPConflict) String() string {
+	kind := "IP address"
+	if c.Gateway {
+		kind = "gateway"
+	}
+
+	return fmt.Sprintf("%s %s claimed by %s instead of %s", kind, c.IP, describeMAC(c.MAC, c.Vendor),
+		describeMAC(c.Previous, c.PreviousVendor))
+}
+
+// describeMAC returns the hardware address followed by its vendor, if known
+func describeMAC(mac, vendor string) string {
+	if vendor == "" {
+		return mac
+	}
+
+	return mac + " (" + vendor + ")"
+}
+
+// responseTimes holds the statuses and the times of the responses of an HTTP host, paired with their requests
+type responseTimes struct {
+	responses    uint
+	clientErrors uint
+	serverErrors uint
+	latencies    []time.Duration // Response times, up to maxLatencies of them
+}
+
+// Number of response times of a host kept over a report window to tell its percentiles, per worker
+const maxLatencies = 10000
+
+// Number of distinct HTTP paths counted over a report window, per worker, past which new ones are left out
+const maxPaths = 10000
+
+// Number of sender and recipient domains counted over a report window, per worker, past which new ones are left out
+const maxMailDomains = 10000
+
+// Number of mail downgrades kept over a report window, per worker
+const maxMailDowngrades = 1000
+
+// Number of ARP conflicts kept over a report window, per worker
+const maxARPConflicts = 1000
+
+// Number of TLS policy violations kept over a report window, per worker
+const maxTLSViolations = 1000
+
+// Number of paths whose fragmented datagrams are counted over a report window, per worker, past which new ones are
+// left out
+const maxMTUPaths = 10000
+
+// Number of directions of TCP connections whose stalls and zero windows are kept over a report window, per worker, past
+// which new ones are left out
+const maxStalledConnections = 1000
+
+// Number of SSH servers, and of clients of each, counted over a report window, per worker, past which new ones are
+// left out
+const maxSSHServers = 1000
+const maxSSHClients = 1000
+
+// Number of NTP servers, and of clients of each, counted over a report window, per worker, past which new ones are
+// left out
+const maxNTPServers = 1000
+const maxNTPClients = 1000
+
+// Number of most requested HTTP paths kept in reports
+const topPaths = 10
+
+// Neighbour is a host that named itself or advertised services through a discovery protocol, mDNS, SSDP or NetBIOS
+type Neighbour struct {
+	Name     string   // Friendly name of the host, empty if it only advertised services
+	Services []string // Types of the services the host advertised, sorted
+}
+
+// Analysis holds the packets and the result of a recording window
+type Analysis struct {
+	nbHits       int // Number of hit events analysed
+	nbHosts      int
+	nbBytes      uint64                  // Sum of the captured lengths of all packets
+	devices      map[string]*DeviceStats // Per interface breakdown of hits and bytes
+	hosts        map[string]*HostStats
+	lastSeenHost *HostStats
+	flows        *flowTable         // Connections seen during the window
+	events       map[string]int     // Number of events, per analyzer
+	systems      map[string]osGuess // Operating systems guessed for remote hosts, by IP address
+
+	// Hosts named or advertised by discovery protocols, by IP address
+	discovery map[string]*Neighbour
+
+	// Responses of HTTP hosts paired with their requests, by Host header of the requests
+	responses map[string]*responseTimes
+
+	// Requests of HTTP hosts, by host and full path, and by family of User-Agent
+	paths  map[pathKey]int
+	agents map[string]int
+
+	// Responses of HTTP hosts, by category of content
+	contents map[string]MediaStats
+
+	// Streams of protocols carried over HTTP, by protocol
+	streams map[string]StreamStats
+
+	// VoIP calls signalled or carrying media, by Call-ID
+	calls map[string]*CallStats
+
+	// Mail messages and sessions, by protocol, the domains of SMTP messages, the sessions downgraded from STARTTLS,
+	// and the SMTP messages relayed to external servers, by client address
+	mail        map[string]MailStats
+	mailDomains map[string]MailDomainStats
+	downgrades  []MailDowngrade
+	outbound    map[string]int
+
+	// SSH sessions, by server endpoint
+	ssh map[string]*SSHStats
+
+	// NTP queries and responses, by server address
+	ntp map[string]*NTPStats
+
+	// IP addresses claimed by another hardware address, and gateways that changed hardware address
+	conflicts []ARPConflict
+
+	// TLS handshakes violating the policy
+	violations []TLSViolation
+
+	// Fragmented datagrams and datagrams too big, by path
+	mtu map[ipPath]*MTUStats
+
+	// Stalls and zero windows of TCP connections, by path from the sender to the receiver endpoint
+	stalls map[ipPath]*StallStats
+
+	// Hosts of the inventoried networks, and names of addresses, seen during the window. Nil if not inventoried.
+	sightings map[string]*inventory.Sighting // Activity of hosts, by IP address
+	names     map[string]string              // Host names of addresses, as given by DNS answers
+	outside   map[string]bool                // Addresses found outside of the inventoried networks
+}
+
+// pathKey identifies the full path of an HTTP host
+type pathKey struct {
+	host string
+	path string
+}
+
+// ipPath is the path of datagrams from a source to a destination, addresses or endpoints
+type ipPath struct {
+	src string
+	dst string
+}
+
+// osGuess is the operating system guessed for a host, and whether it matched a known signature or only a TTL
+type osGuess struct {
+	os    string
+	exact bool
+}
+
+// Report holds the final result of an analysis, to be sent out to display()
+type Report struct {
+	TopHost   *HostStats
+	Sections  []*SectionStats        // Sections of the top host, sorted by increasing hits
+	Hits      int                    // Number of hits analysed during the window
+	Bytes     uint64                 // Number of bytes of the packets holding hits
+	Devices   map[string]DeviceStats // Hits and bytes analysed during the window, per interface
+	Flows     []*FlowRecord          // Connections seen during the window
+	Events    map[string]int         // Number of events extracted during the window, per analyzer
+	Pipeline  *diagnostics.Sample    // Activity of the pipeline itself during the window. Nil if not measured.
+	Processes []ProcessStats         // Local processes with the most traffic, by decreasing bytes. Nil if not attributed.
+	Systems   map[string]string      // Operating systems guessed for the remote hosts that sent SYN segments, by IP address
+	NewHosts  []inventory.Host       // Hosts of the inventoried networks seen for the first time. Nil if not inventoried.
+	Discovery map[string]Neighbour   // Hosts named or advertised by discovery protocols during the window, by IP address
+	Responses map[string]HTTPStats   // Response times and errors of HTTP hosts, by Host header of the requests answered
+	Paths     []PathStats            // Most requested HTTP paths, by decreasing requests
+	Agents    map[string]int         // Number of HTTP requests, by family of User-Agent, e.g. Firefox or curl
+	Contents  map[string]MediaStats  // HTTP responses and the sizes of their bodies, by category of content, e.g. json or video
+	Streams   map[string]StreamStats // gRPC calls and WebSocket connections, and their messages, by protocol
+	Calls     map[string]CallStats   // VoIP calls signalled or carrying media during the window, by Call-ID
+
+	Mail      map[string]MailStats       // Mail messages and sessions, by protocol
+	Domains   map[string]MailDomainStats // SMTP messages sent from and to domains, by domain
+	Cleartext []MailDowngrade            // Mail sessions downgraded from STARTTLS, by capture time
+	Outbound  map[string]int             // SMTP messages relayed to servers outside of private networks, by client address
+	SSH       map[string]SSHStats        // SSH sessions, by server endpoint as <ip>:<port>
+	NTP       map[string]NTPStats        // NTP queries and responses, by server address
+	Spoofing  []ARPConflict              // IP addresses claimed by another hardware address, by capture time
+	Policy    []TLSViolation             // TLS handshakes violating the policy, by capture time
+	MTU       []MTUStats                 // Paths of fragmented datagrams and datagrams too big, those in trouble first
+	Stalled   []StallStats               // Directions of TCP connections stalled or closing their window, longest stall first
+	Matrix    []GroupTraffic             // Traffic between groups of networks, the most bytes first. Nil if no group is configured.
+	Diff      *ReportDiff                // What changed since the previous report. Nil for the first one.
+	Watched   []WatchStats               // Traffic of the watched targets, in the order they were configured. Nil if none is watched.
+
+	LongLived []Connection // Connections open for the long-lived age or more, oldest first. Nil if not followed.
+	Stale     []Connection // TCP connections idle for the stale time but not closed, longest idle first
+	Timestamp time.Time
+}
+
+// Update statistics of a section with new data
+func (a *Analysis) updateSectionStats(hostname string, sectionName string, method string) {
+
+	host := a.hosts[hostname]
+	host.Hits++
+	a.lastSeenHost = host
+	section := host.Sections[sectionName]
+
+	// Update Hits
+	section.Hits++
+	section.Requests.Total++
+
+	// If method was not yet registered, do it
+	if _, ok := section.Requests.Methods[method]; !ok {
+		section.Requests.Methods[method] = 0
+	}
+	section.Requests.Methods[method]++
+}
+
+// updateResponseStats updates data for hostname with relevant data
+func (a *Analysis) updateResponseStats(hostname string, status int) {
+
+	host := a.hosts[hostname]
+	host.Hits++
+	a.lastSeenHost = host
+	host.Responses.Total++
+
+	// If status code has not yet been encountered, add it
+	if _, ok := host.Responses.Status[status]; !ok {
+		host.Responses.Status[status] = 0
+	}
+	host.Responses.Status[status]++
+}
+
+// newSectionStats returns an empty set of statistics about a section
+func newSectionStats(section string) *SectionStats {
+	return &SectionStats{
+		Section: section,
+		Hits:    0,
+		Requests: RequestStats{
+			Total:   0,
+			Methods: make(map[string]uint),
+		},
+	}
+}
+
+// newHostStats returns an empty set of statistics about a host
+func newHostStats(host string) *HostStats {
+	return &HostStats{
+		Host:     host,
+		IPs:      []string{},
+		Hits:     0,
+		Sections: make(map[string]*SectionStats),
+		Responses: ResponseStats{
+			Total:  0,
+			Status: make(map[int]uint),
+		},
+	}
+}
+
+// getHost returns the domain name from a http request event, and attempts to do so for a http response.
+// There's no standard trace of the remote host in the Response header, so unless the response was paired with its
+// request, the only way that's left is to see if we can match the remote address with a host's address we've already
+// seen before with a request
+func getHost(e *Event, a *Analysis) (string, error) {
+
+	// If it's a request, it's in the header, and a paired response holds that of its request
+	if e.Type == httpRequest || e.Host != "" {
+		return e.Host, nil
+	}
+
+	// Verify if the ip corresponds to the last encountered host
+	if a.lastSeenHost != nil {
+		for _, ip := range a.lastSeenHost.IPs {
+			if strings.Compare(ip, e.RemoteIP) == 0 {
+				return a.lastSeenHost.Host, nil
+			}
+		}
+	}
+
+	// Iterate over all encountered hosts
+	for host, stat := range a.hosts {
+		for _, ip := range stat.IPs {
+			if strings.Compare(ip, e.RemoteIP) == 0 {
+				return host, nil
+			}
+		}
+	}
+
+	// If no previous host was found, we don't yet have a way to reliably return a host
+	return "nil", errors.New("error : http response remote IP matches no known host")
+}
+
+// registerHostElements adds new remote IP and section to a host if they were not present
+func (a *Analysis) registerHostElements(host string, section string, remoteIP string) {
+
+	hosts := a.hosts
+
+	// Verify if remote IP was registered for this host
+	b := false
+	for _, ip := range hosts[host].IPs {
+		if strings.Compare(ip, remoteIP) == 0 {
+			b = true
+		}
+	}
+	if !b {
+		hosts[host].IPs = append(hosts[host].IPs, remoteIP)
+	}
+
+	// If the section is not registered, create new
+	if _, ok := hosts[host].Sections[section]; !ok {
+		// Register new section
+		hosts[host].Sections[section] = newSectionStats(section)
+	}
+}
+
+// updateAnalysis update's the report's current analysis with the new incoming http event
+func (a *Analysis) updateAnalysis(e *Event) {
+
+	// If it is a response, it must be paired with its request or we must have seen the corresponding host before,
+	// or we cannot work with it
+	if e.Type == httpResponse {
+		host, err := getHost(e, a)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"remote IP": e.RemoteIP,
+			}).Debug(err)
+			return
+		}
+
+		// The request of a paired response may have been seen in a previous window
+		if _, ok := a.hosts[host]; !ok {
+			a.hosts[host] = newHostStats(host)
+			a.hosts[host].IPs = append(a.hosts[host].IPs, e.RemoteIP)
+		}
+
+		status, _ := strconv.Atoi(e.Attributes[httpStatus])
+		a.updateResponseStats(host, status)
+	} else {
+
+		// Here, it is a request
+		host, _ := getHost(e, a)
+		section := e.Attributes[httpSection]
+
+		hosts := a.hosts
+
+		// If host not registered, create new
+		if _, ok := a.hosts[host]; !ok {
+			// Register new host and section
+			hosts[host] = newHostStats(host)
+			hosts[host].IPs = append(hosts[host].IPs, e.RemoteIP)
+			hosts[host].Sections[section] = newSectionStats(section)
+		} else {
+			a.registerHostElements(host, section, e.RemoteIP)
+		}
+
+		// Update statistics
+		a.updateSectionStats(host, section, e.Attributes[httpMethod])
+	}
+}
+
+// AddEvent adds an event to the analysis. Hits are accounted per interface, and http events make host statistics.
+func (a *Analysis) AddEvent(e *Event) {
+	a.events[e.Analyzer]++
+
+	if e.Analyzer == config.OSAnalyzer {
+		a.addOSGuess(e.RemoteIP, osGuess{os: e.Attributes[osName], exact: e.Attributes[osExact] == "true"})
+	}
+	if e.Analyzer == config.DiscoveryAnalyzer {
+		a.addNeighbour(e.RemoteIP, e.Host, e.Attributes[discoveryServices])
+	}
+	if e.Analyzer == config.HTTPAnalyzer && (e.Type == httpStream || e.Type == httpMessage) {
+		a.addStream(e)
+	}
+	if e.Analyzer == config.VoIPAnalyzer {
+		a.addCall(e)
+	}
+	if e.Analyzer == config.MailAnalyzer {
+		a.addMail(e)
+	}
+	if e.Analyzer == config.SSHAnalyzer {
+		a.addSSH(e)
+	}
+	if e.Analyzer == config.NTPAnalyzer {
+		a.addNTP(e)
+	}
+	if e.Analyzer == config.ARPAnalyzer {
+		a.addConflict(e)
+	}
+	if e.Analyzer == config.TLSAnalyzer && e.Attributes[tlsViolation] != "" {
+		a.addViolation(e)
+	}
+	if e.Analyzer == config.MTUAnalyzer {
+		a.addMTU(e)
+	}
+	if e.Analyzer == config.StallAnalyzer {
+		a.addStall(e)
+	}
+	if a.sightings != nil {
+		a.sightProtocol(e)
+	}
+
+	if !e.Hit {
+		return
+	}
+
+	a.nbHits++
+	a.nbBytes += uint64(e.Length)
+
+	device := a.device(e.Device)
+	device.Hits++
+	device.Bytes += uint64(e.Length)
+
+	if e.Analyzer == config.HTTPAnalyzer {
+		// Responses paired with their requests are timed, and known to come from the host the requests were sent to
+		if e.Type == httpResponse && e.Host != "" {
+			status, _ := strconv.Atoi(e.Attributes[httpStatus])
+			latency, _ := strconv.ParseInt(e.Attributes[httpLatency], 10, 64)
+			a.addResponse(e.Host, status, time.Duration(latency))
+		}
+		if e.Type == httpRequest {
+			a.addRequest(e.Host, e.Attributes[httpPath], e.Attributes[httpAgent])
+		}
+		if e.Type == httpResponse {
+			size, _ := strconv.ParseUint(e.Attributes[httpSize], 10, 64)
+			a.addContent(e.Attributes[httpContent], size)
+		}
+		a.updateAnalysis(e)
+	}
+}
+
+// addRequest counts the request for the path of the host and for the family of its User-Agent
+func (a *Analysis) addRequest(host, path, agent string) {
+	key := pathKey{host: host, path: path}
+	if _, ok := a.paths[key]; ok || len(a.paths) < maxPaths {
+		a.paths[key]++
+	}
+	a.agents[agent]++
+}
+
+// addContent counts the response in its category of content, with the size of its body
+func (a *Analysis) addContent(category string, size uint64) {
+	stats := a.contents[category]
+	stats.Responses++
+	stats.Bytes += size
+	a.contents[category] = stats
+}
+
+// addStream counts the start of a stream, or its messages, in those of its protocol
+func (a *Analysis) addStream(e *Event) {
+	stats := a.streams[e.Attributes[streamProtocol]]
+	if e.Type == httpStream {
+		stats.Streams++
+	} else {
+		messages, _ := strconv.Atoi(e.Attributes[streamMessages])
+		stats.Messages += messages
+	}
+	a.streams[e.Attributes[streamProtocol]] = stats
+}
+
+// addCall accounts the signalling or the media sample of a call. Calls past maxVoIPCalls are left out.
+func (a *Analysis) addCall(e *Event) {
+	id := e.Attributes[voipCall]
+	call, ok := a.calls[id]
+	if !ok {
+		if len(a.calls) >= maxVoIPCalls {
+			return
+		}
+		call = &CallStats{From: e.Attributes[voipFrom], To: e.Attributes[voipTo]}
+		a.calls[id] = call
+	}
+
+	switch e.Type {
+	case voipAnswer:
+		call.Answered = true
+	case voipBye:
+		call.Ended = true
+	case voipMedia:
+		call.Codecs = addSorted(call.Codecs, e.Attributes[voipCodec])
+		expected, _ := strconv.ParseUint(e.Attributes[voipExpected], 10, 64)
+		received, _ := strconv.ParseUint(e.Attributes[voipReceived], 10, 64)
+		call.Received += received
+		if expected > received {
+			call.Lost += expected - received
+		}
+		jitter, _ := strconv.ParseInt(e.Attributes[voipJitter], 10, 64)
+		if time.Duration(jitter) > call.Jitter {
+			call.Jitter = time.Duration(jitter)
+		}
+	}
+}
+
+// addMail accounts a mail message, upgrade or downgrade in the stats of its protocol. SMTP messages count for the
+// domains of their sender and recipients, and for their client if relayed to an external server.
+func (a *Analysis) addMail(e *Event) {
+	protocol := e.Attributes[mailProtocol]
+	stats := a.mail[protocol]
+	switch e.Type {
+	case mailMessage:
+		stats.Messages++
+	case mailUpgrade:
+		stats.Upgrades++
+	case mailDowngrade:
+		stats.Downgrades++
+		if len(a.downgrades) < maxMailDowngrades {
+			a.downgrades = append(a.downgrades, MailDowngrade{
+				Protocol: protocol,
+				Client:   e.Attributes[mailClient],
+				Server:   e.Attributes[mailServer],
+				Reason:   e.Attributes[mailReason],
+				Seen:     e.Timestamp,
+			})
+		}
+	}
+	a.mail[protocol] = stats
+
+	if e.Type != mailMessage || protocol != smtpProtocol {
+		return
+	}
+	if sender := e.Attributes[mailSender]; sender != "" {
+		a.addMailDomain(sender, 1, 0)
+	}
+	if recipients := e.Attributes[mailRecipients]; recipients != "" {
+		for _, domain := range strings.Split(recipients, ",") {
+			a.addMailDomain(domain, 0, 1)
+		}
+	}
+	if e.Attributes[mailOutbound] == "true" {
+		a.outbound[e.Attributes[mailClient]]++
+	}
+}
+
+// addMailDomain counts the messages sent from and to the domain
+func (a *Analysis) addMailDomain(domain string, sent, received int) {
+	stats, ok := a.mailDomains[domain]
+	if !ok && len(a.mailDomains) >= maxMailDomains {
+		return
+	}
+	stats.Sent += sent
+	stats.Received += received
+	a.mailDomains[domain] = stats
+}
+
+// addSSH accounts an SSH banner or the end of a session in the stats of its server. Sessions are counted from the
+// banners of their servers.
+func (a *Analysis) addSSH(e *Event) {
+	server := e.Attributes[sshServer]
+	stats, ok := a.ssh[server]
+	if !ok {
+		if len(a.ssh) >= maxSSHServers {
+			return
+		}
+		stats = &SSHStats{
+			Software: "",
+			Expected: e.Attributes[sshExpected] == "true",
+			Sessions: make(map[string]int),
+			Short:    make(map[string]int),
+			Clients:  make(map[string]int),
+			Longest:  0,
+		}
+		a.ssh[server] = stats
+	}
+
+	client := e.Attributes[sshClient]
+	switch {
+	case e.Type == sshBanner && e.Attributes[sshRole] == sshServerRole:
+		stats.Software = e.Attributes[sshSoftware]
+		if _, ok := stats.Sessions[client]; ok || len(stats.Sessions) < maxSSHClients {
+			stats.Sessions[client]++
+		}
+	case e.Type == sshBanner:
+		if _, ok := stats.Clients[e.Attributes[sshSoftware]]; ok || len(stats.Clients) < maxSSHClients {
+			stats.Clients[e.Attributes[sshSoftware]]++
+		}
+	case e.Type == sshClose:
+		duration, _ := strconv.ParseInt(e.Attributes[sshDuration], 10, 64)
+		if time.Duration(duration) > stats.Longest {
+			stats.Longest = time.Duration(duration)
+		}
+		if _, ok := stats.Short[client]; e.Attributes[sshShort] == "true" && (ok || len(stats.Short) < maxSSHClients) {
+			stats.Short[client]++
+		}
+	}
+}
+
+// addNTP accounts an NTP query or response in the stats of its server
+func (a *Analysis) addNTP(e *Event) {
+	server := e.Attributes[ntpServer]
+	stats, ok := a.ntp[server]
+	if !ok {
+		if len(a.ntp) >= maxNTPServers {
+			return
+		}
+		stats = &NTPStats{
+			Expected: e.Attributes[ntpExpected] == "true",
+			Stratum:  0,
+			Clients:  make(map[string]int),
+			Commands: 0,
+			Queried:  make(map[string]uint64),
+			Answered: make(map[string]uint64),
+		}
+		a.ntp[server] = stats
+	}
+
+	client := e.Attributes[ntpClient]
+	bytes, _ := strconv.ParseUint(e.Attributes[ntpBytes], 10, 64)
+	if _, ok := stats.Queried[client]; !ok && len(stats.Queried) >= maxNTPClients {
+		return
+	}
+
+	if e.Type == ntpResponse {
+		stats.Answered[client] += bytes
+		if stratum, err := strconv.Atoi(e.Attributes[ntpStratum]); err == nil {
+			stats.Stratum = stratum
+		}
+		return
+	}
+
+	stats.Queried[client] += bytes
+	if e.Attributes[ntpMode] == ntpModes[ntpClientMode] {
+		stats.Clients[client]++
+	} else {
+		stats.Commands++
+	}
+}
+
+// addConflict records an ARP conflict, unless the same hardware addresses already conflicted over the IP address
+// during the window, so that flapping is reported once
+func (a *Analysis) addConflict(e *Event) {
+	conflict := ARPConflict{
+		IP:             e.Attributes[arpIP],
+		MAC:            e.Attributes[arpMAC],
+		Vendor:         e.Attributes[arpVendor],
+		Previous:       e.Attributes[arpPrevious],
+		PreviousVendor: e.Attributes[arpPreviousVendor],
+		Gateway:        e.Type == arpGateway,
+		Seen:           e.Timestamp,
+	}
+
+	for _, c := range a.conflicts {
+		if c.IP == conflict.IP && c.MAC == conflict.MAC && c.Previous == conflict.Previous {
+			return
+		}
+	}
+	if len(a.conflicts) < maxARPConflicts {
+		a.conflicts = append(a.conflicts, conflict)
+	}
+}
+
+// addViolation records a TLS handshake violating the policy, unless the client already negotiated the same version and
+// cipher suite with the server during the window
+func (a *Analysis) addViolation(e *Event) {
+	violation := TLSViolation{
+		Client:  e.Attributes[tlsClient],
+		Server:  e.Attributes[tlsServer],
+		Version: e.Attributes[tlsVersion],
+		Cipher:  e.Attributes[tlsCipher],
+		Reason:  e.Attributes[tlsViolation],
+		Seen:    e.Timestamp,
+	}
+
+	for _, v := range a.violations {
+		if v.Client == violation.Client && v.Server == violation.Server && v.Version == violation.Version &&
+			v.Cipher == violation.Cipher {
+			return
+		}
+	}
+	if len(a.violations) < maxTLSViolations {
+		a.violations = append(a.violations, violation)
+	}
+}
+
+// addMTU accounts a datagram reassembled, missing fragments or too big in the stats of its path
+func (a *Analysis) addMTU(e *Event) {
+	path := ipPath{src: e.Attributes[mtuSource], dst: e.Attributes[mtuDestination]}
+	stats, ok := a.mtu[path]
+	if !ok {
+		if len(a.mtu) >= maxMTUPaths {
+			return
+		}
+		stats = &MTUStats{
+			Source:      path.src,
+			Destination: path.dst,
+			Reassembled: 0,
+			Incomplete:  0,
+			TooBig:      0,
+			MTU:         0,
+			Largest:     0,
+		}
+		a.mtu[path] = stats
+	}
+
+	switch e.Type {
+	case mtuReassembled:
+		stats.Reassembled++
+		if size, err := strconv.Atoi(e.Attributes[mtuSize]); err == nil && size > stats.Largest {
+			stats.Largest = size
+		}
+	case mtuIncomplete:
+		stats.Incomplete++
+	case mtuTooBig:
+		stats.TooBig++
+		if mtu, err := strconv.Atoi(e.Attributes[mtuNextHop]); err == nil && mtu != 0 && (stats.MTU == 0 || mtu < stats.MTU) {
+			stats.MTU = mtu
+		}
+	}
+}
+
+// addStall accounts a stall, a resumption or a zero window in the stats of the direction of its TCP connection
+func (a *Analysis) addStall(e *Event) {
+	path := ipPath{src: e.Attributes[stallSender], dst: e.Attributes[stallReceiver]}
+	stats, ok := a.stalls[path]
+	if !ok {
+		if len(a.stalls) >= maxStalledConnections {
+			return
+		}
+		stats = &StallStats{
+			Sender:      path.src,
+			Receiver:    path.dst,
+			Stalls:      0,
+			Reason:      "",
+			Longest:     0,
+			ZeroWindows: 0,
+		}
+		a.stalls[path] = stats
+	}
+
+	switch e.Type {
+	case stallStalled:
+		stats.Stalls++
+		stats.Reason = e.Attributes[stallReason]
+	case stallZeroWindow:
+		if zeroWindows, err := strconv.Atoi(e.Attributes[stallZeroWindows]); err == nil && zeroWindows > stats.ZeroWindows {
+			stats.ZeroWindows = zeroWindows
+		}
+	}
+	if duration, err := strconv.ParseInt(e.Attributes[stallDuration], 10, 64); err == nil &&
+		time.Duration(duration) > stats.Longest {
+		stats.Longest = time.Duration(duration)
+	}
+}
+
+// topPathStats returns the most requested paths, by decreasing requests, then by host and path
+func (a *Analysis) topPathStats() []PathStats {
+	paths := make([]PathStats, 0, len(a.paths))
+	for key, requests := range a.paths {
+		paths = append(paths, PathStats{Host: key.host, Path: key.path, Requests: requests})
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if paths[i].Requests != paths[j].Requests {
+			return paths[i].Requests > paths[j].Requests
+		}
+		if paths[i].Host != paths[j].Host {
+			return paths[i].Host < paths[j].Host
+		}
+		return paths[i].Path < paths[j].Path
+	})
+	if len(paths) > topPaths {
+		paths = paths[:topPaths]
+	}
+
+	return paths
+}
+
+// addResponse accounts the response of the host, with its status and the time it took
+func (a *Analysis) addResponse(host string, status int, latency time.Duration) {
+	times, ok := a.responses[host]
+	if !ok {
+		times = &responseTimes{responses: 0, clientErrors: 0, serverErrors: 0, latencies: nil}
+		a.responses[host] = times
+	}
+
+	times.responses++
+	switch {
+	case status >= 500 && status < 600:
+		times.serverErrors++
+	case status >= 400 && status < 500:
+		times.clientErrors++
+	}
+	if len(times.latencies) < maxLatencies {
+		times.latencies = append(times.latencies, latency)
+	}
+}
+
+// httpStats returns the statistics of the responses of each host, with the percentiles of their times
+func (a *Analysis) httpStats() map[string]HTTPStats {
+	stats := make(map[string]HTTPStats, len(a.responses))
+	for host, times := range a.responses {
+		latencies := times.latencies
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		stats[host] = HTTPStats{
+			Responses:    times.responses,
+			ClientErrors: times.clientErrors,
+			ServerErrors: times.serverErrors,
+			P50:          percentile(latencies, 50),
+			P90:          percentile(latencies, 90),
+			P99:          percentile(latencies, 99),
+		}
+	}
+
+	return stats
+}
+
+// percentile returns the p-th percentile of the sorted durations, by nearest rank, or 0 if there are none
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
+
+// device returns the statistics of the interface, created empty if it has none yet
+func (a *Analysis) device(name string) *DeviceStats {
+	device, ok := a.devices[name]
+	if !ok {
+		device = &DeviceStats{
+			Hits:      0,
+			Bytes:     0,
+			Container: "",
+			Broadcast: 0,
+			Multicast: 0,
+			Packets:   0,
+			Traffic:   0,
+			Checksum:  0,
+			Truncated: 0,
+			Malformed: 0,
+			DSCP:      nil,
+		}
+		a.devices[name] = device
+	}
+
+	return device
+}
+
+// AccountCast counts the captured packet in the broadcast or multicast frames of its interface, if it is either
+func (a *Analysis) AccountCast(data *capture.PacketMsg) {
+	if data.Broadcast() {
+		a.device(data.Device).Broadcast++
+	} else if data.Multicast() {
+		a.device(data.Device).Multicast++
+	}
+}
+
+// AccountIntegrity counts the packets captured on the interface of the packet since the previous one, and the packet
+// if it failed an integrity check
+func (a *Analysis) AccountIntegrity(data *capture.PacketMsg) {
+	device := a.device(data.Device)
+	device.Packets += data.Captured
+	switch data.Corrupt {
+	case capture.Checksum:
+		device.Checksum++
+	case capture.Truncated:
+		device.Truncated++
+	case capture.Malformed:
+		device.Malformed++
+	}
+}
+
+// AccountTraffic counts the bytes of the packet in the traffic of its interface
+func (a *Analysis) AccountTraffic(data *capture.PacketMsg) {
+	a.device(data.Device).Traffic += uint64(data.Length)
+}
+
+// addOSGuess records the operating system guessed for the host, unless one matching a known signature was already
+// recorded and this one does not
+func (a *Analysis) addOSGuess(ip string, guess osGuess) {
+	if known, ok := a.systems[ip]; ok && known.exact && !guess.exact {
+		return
+	}
+	a.systems[ip] = guess
+}
+
+// addNeighbour records the name and the comma separated services a discovery protocol gave the host. Names replace
+// those previously given, services add up.
+func (a *Analysis) addNeighbour(ip, name, services string) {
+	n, ok := a.discovery[ip]
+	if !ok {
+		n = &Neighbour{Name: "", Services: nil}
+		a.discovery[ip] = n
+	}
+
+	if name != "" {
+		n.Name = name
+	}
+	if services != "" {
+		for _, service := range strings.Split(services, ",") {
+			n.Services = addSorted(n.Services, service)
+		}
+	}
+}
+
+// addSorted adds the element to the sorted set, unless it already holds it
+func addSorted(set []string, element string) []string {
+	n := sort.SearchStrings(set, element)
+	if n < len(set) && set[n] == element {
+		return set
+	}
+
+	set = append(set, "")
+	copy(set[n+1:], set[n:])
+	set[n] = element
+	return set
+}
+
+// NewAnalysis returns a new and empty Analysis struct, whose flow table is bounded by limits
+func NewAnalysis(limits config.FlowTableConfig) *Analysis {
+	return &Analysis{
+		nbHits:       0,
+		nbHosts:      0,
+		nbBytes:      0,
+		devices:      make(map[string]*DeviceStats),
+		hosts:        make(map[string]*HostStats),
+		lastSeenHost: nil,
+		flows:        newFlowTable(limits),
+		events:       make(map[string]int),
+		systems:      make(map[string]osGuess),
+		discovery:    make(map[string]*Neighbour),
+		responses:    make(map[string]*responseTimes),
+		paths:        make(map[pathKey]int),
+		agents:       make(map[string]int),
+		contents:     make(map[string]MediaStats),
+		streams:      make(map[string]StreamStats),
+		calls:        make(map[string]*CallStats),
+		mail:         make(map[string]MailStats),
+		mailDomains:  make(map[string]MailDomainStats),
+		downgrades:   nil,
+		outbound:     make(map[string]int),
+		ssh:          make(map[string]*SSHStats),
+		ntp:          make(map[string]*NTPStats),
+		conflicts:    nil,
+		violations:   nil,
+		mtu:          make(map[ipPath]*MTUStats),
+		stalls:       make(map[ipPath]*StallStats),
+		sightings:    nil,
+		names:        nil,
+		outside:      nil,
+	}
+}
+
+// AccountFlow adds a captured packet to the flow table, whether or not it could be interpreted
+func (a *Analysis) AccountFlow(data *capture.PacketMsg) {
+	a.accountFlow(data)
+}
+
+// merge adds the hits, hosts, flows and events of b, the analysis of another worker over the same window, to the analysis
+func (a *Analysis) merge(b *Analysis) {
+	a.nbHits += b.nbHits
+	a.nbBytes += b.nbBytes
+
+	for name, stats := range b.devices {
+		device, ok := a.devices[name]
+		if !ok {
+			a.devices[name] = stats
+			continue
+		}
+		device.Hits += stats.Hits
+		device.Bytes += stats.Bytes
+		device.Broadcast += stats.Broadcast
+		device.Multicast += stats.Multicast
+		device.Packets += stats.Packets
+		device.Traffic += stats.Traffic
+		device.Checksum += stats.Checksum
+		device.Truncated += stats.Truncated
+		device.Malformed += stats.Malformed
+		for class, s := range stats.DSCP {
+			if device.DSCP == nil {
+				device.DSCP = make(map[string]ClassStats)
+			}
+			c := device.DSCP[class]
+			c.Packets += s.Packets
+			c.Bytes += s.Bytes
+			device.DSCP[class] = c
+		}
+	}
+
+	for name, stats := range b.hosts {
+		host, ok := a.hosts[name]
+		if !ok {
+			a.hosts[name] = stats
+			continue
+		}
+
+		for _, ip := range stats.IPs {
+			known := false
+			for _, i := range host.IPs {
+				if i == ip {
+					known = true
+					break
+				}
+			}
+			if !known {
+				host.IPs = append(host.IPs, ip)
+			}
+		}
+
+		host.Hits += stats.Hits
+		for sectionName, s := range stats.Sections {
+			section, ok := host.Sections[sectionName]
+			if !ok {
+				host.Sections[sectionName] = s
+				continue
+			}
+			section.Hits += s.Hits
+			section.Requests.Total += s.Requests.Total
+			for method, nb := range s.Requests.Methods {
+				section.Requests.Methods[method] += nb
+			}
+		}
+
+		host.Responses.Total += stats.Responses.Total
+		for status, nb := range stats.Responses.Status {
+			host.Responses.Status[status] += nb
+		}
+	}
+
+	a.flows.merge(b.flows)
+
+	for analyzer, nb := range b.events {
+		a.events[analyzer] += nb
+	}
+
+	for ip, guess := range b.systems {
+		a.addOSGuess(ip, guess)
+	}
+
+	for ip, n := range b.discovery {
+		a.addNeighbour(ip, n.Name, strings.Join(n.Services, ","))
+	}
+
+	for host, times := range b.responses {
+		known, ok := a.responses[host]
+		if !ok {
+			a.responses[host] = times
+			continue
+		}
+		known.responses += times.responses
+		known.clientErrors += times.clientErrors
+		known.serverErrors += times.serverErrors
+		known.latencies = append(known.latencies, times.latencies...)
+	}
+
+	for key, requests := range b.paths {
+		a.paths[key] += requests
+	}
+	for agent, requests := range b.agents {
+		a.agents[agent] += requests
+	}
+	for category, stats := range b.contents {
+		known := a.contents[category]
+		known.Responses += stats.Responses
+		known.Bytes += stats.Bytes
+		a.contents[category] = known
+	}
+	for protocol, stats := range b.streams {
+		known := a.streams[protocol]
+		known.Streams += stats.Streams
+		known.Messages += stats.Messages
+		a.streams[protocol] = known
+	}
+	for id, c := range b.calls {
+		call, ok := a.calls[id]
+		if !ok {
+			a.calls[id] = c
+			continue
+		}
+		for _, codec := range c.Codecs {
+			call.Codecs = addSorted(call.Codecs, codec)
+		}
+		call.Answered = call.Answered || c.Answered
+		call.Ended = call.Ended || c.Ended
+		call.Received += c.Received
+		call.Lost += c.Lost
+		if c.Jitter > call.Jitter {
+			call.Jitter = c.Jitter
+		}
+	}
+	for protocol, stats := range b.mail {
+		known := a.mail[protocol]
+		known.Messages += stats.Messages
+		known.Upgrades += stats.Upgrades
+		known.Downgrades += stats.Downgrades
+		a.mail[protocol] = known
+	}
+	for domain, stats := range b.mailDomains {
+		a.addMailDomain(domain, stats.Sent, stats.Received)
+	}
+	a.downgrades = append(a.downgrades, b.downgrades...)
+	for client, messages := range b.outbound {
+		a.outbound[client] += messages
+	}
+	for server, s := range b.ssh {
+		stats, ok := a.ssh[server]
+		if !ok {
+			a.ssh[server] = s
+			continue
+		}
+		if stats.Software == "" {
+			stats.Software = s.Software
+		}
+		for client, sessions := range s.Sessions {
+			stats.Sessions[client] += sessions
+		}
+		for client, sessions := range s.Short {
+			stats.Short[client] += sessions
+		}
+		for software, sessions := range s.Clients {
+			stats.Clients[software] += sessions
+		}
+		if s.Longest > stats.Longest {
+			stats.Longest = s.Longest
+		}
+	}
+	for server, n := range b.ntp {
+		stats, ok := a.ntp[server]
+		if !ok {
+			a.ntp[server] = n
+			continue
+		}
+		if n.Stratum != 0 {
+			stats.Stratum = n.Stratum
+		}
+		for client, queries := range n.Clients {
+			stats.Clients[client] += queries
+		}
+		stats.Commands += n.Commands
+		for client, bytes := range n.Queried {
+			stats.Queried[client] += bytes
+		}
+		for client, bytes := range n.Answered {
+			stats.Answered[client] += bytes
+		}
+	}
+	a.conflicts = append(a.conflicts, b.conflicts...)
+	a.violations = append(a.violations, b.violations...)
+	for path, s := range b.mtu {
+		stats, ok := a.mtu[path]
+		if !ok {
+			a.mtu[path] = s
+			continue
+		}
+		stats.Reassembled += s.Reassembled
+		stats.Incomplete += s.Incomplete
+		stats.TooBig += s.TooBig
+		if s.MTU != 0 && (stats.MTU == 0 || s.MTU < stats.MTU) {
+			stats.MTU = s.MTU
+		}
+		if s.Largest > stats.Largest {
+			stats.Largest = s.Largest
+		}
+	}
+	for path, s := range b.stalls {
+		stats, ok := a.stalls[path]
+		if !ok {
+			a.stalls[path] = s
+			continue
+		}
+		stats.Stalls += s.Stalls
+		if s.Reason != "" {
+			stats.Reason = s.Reason
+		}
+		if s.Longest > stats.Longest {
+			stats.Longest = s.Longest
+		}
+		if s.ZeroWindows > stats.ZeroWindows {
+			stats.ZeroWindows = s.ZeroWindows
+		}
+	}
+
+	if b.sightings != nil {
+		a.mergeSightings(b)
+	}
+}
+
+// CastRates returns the rates of broadcast and multicast frames of each interface over the report's window, in frames
+// per second. Interfaces without any are left out.
+func (r *Report) CastRates(window time.Duration) (map[string]float64, map[string]float64) {
+	broadcast := make(map[string]float64)
+	multicast := make(map[string]float64)
+	for name, stats := range r.Devices {
+		if stats.Broadcast > 0 {
+			broadcast[name] = float64(stats.Broadcast) / window.Seconds()
+		}
+		if stats.Multicast > 0 {
+			multicast[name] = float64(stats.Multicast) / window.Seconds()
+		}
+	}
+
+	return broadcast, multicast
+}
+
+// TrafficRates returns the rates of the traffic of each interface over the report's window, in bits per second
+func (r *Report) TrafficRates(window time.Duration) map[string]float64 {
+	rates := make(map[string]float64, len(r.Devices))
+	for name, stats := range r.Devices {
+		rates[name] = float64(8*stats.Traffic) / window.Seconds()
+	}
+
+	return rates
+}
+
+// Metrics returns the metrics of the report rate-of-change rules watch, by name : hits, bytes of the packets holding
+// them, packets captured on all interfaces and flows
+func (r *Report) Metrics() map[string]float64 {
+	var packets uint64
+	for _, stats := range r.Devices {
+		packets += stats.Packets
+	}
+
+	return map[string]float64{
+		config.HitsMetric:    float64(r.Hits),
+		config.BytesMetric:   float64(r.Bytes),
+		config.PacketsMetric: float64(packets),
+		config.FlowsMetric:   float64(len(r.Flows)),
+	}
+}
+
+// CorruptionRates returns the share of corrupt packets of each interface over the report's window, between 0 and 1.
+// Interfaces that captured less than minimum packets are left out.
+func (r *Report) CorruptionRates(minimum uint) map[string]float64 {
+	rates := make(map[string]float64)
+	for name, stats := range r.Devices {
+		if stats.Packets >= uint64(minimum) && stats.Packets > 0 {
+			rates[name] = float64(stats.Corrupt()) / float64(stats.Packets)
+		}
+	}
+
+	return rates
+}
+
+// ErrorRates returns the share of 4xx and 5xx responses of each HTTP host over the report's window, between 0 and 1.
+// Hosts that sent less than minimum responses are left out.
+func (r *Report) ErrorRates(minimum uint) map[string]float64 {
+	rates := make(map[string]float64)
+	for host, stats := range r.Responses {
+		if stats.Responses >= minimum && stats.Responses > 0 {
+			rates[host] = stats.ErrorRate()
+		}
+	}
+
+	return rates
+}
+
+// CallQuality returns the highest jitter, in milliseconds, and the share of RTP packets lost, between 0 and 1, of each
+// call over the report's window, keyed by its parties and Call-ID. Calls that received less than minimum packets are
+// left out.
+func (r *Report) CallQuality(minimum uint) (map[string]float64, map[string]float64) {
+	jitter := make(map[string]float64)
+	loss := make(map[string]float64)
+	for id, call := range r.Calls {
+		if call.Received < uint64(minimum) || call.Received == 0 {
+			continue
+		}
+		key := call.From + " -> " + call.To + " [" + id + "]"
+		jitter[key] = float64(call.Jitter) / float64(time.Millisecond)
+		loss[key] = call.Loss()
+	}
+
+	return jitter, loss
+}
+
+// SSHBruteForce returns the number of short sessions, e.g. failed logins, of each SSH client to each server over the
+// report's window, keyed as "<client> -> <server>"
+func (r *Report) SSHBruteForce() map[string]float64 {
+	attempts := make(map[string]float64)
+	for server, stats := range r.SSH {
+		for client, short := range stats.Short {
+			attempts[client+" -> "+server] = float64(short)
+		}
+	}
+
+	return attempts
+}
+
+// SSHUnexpected returns the number of sessions of each SSH client to each server that is not among the expected SSH
+// destinations over the report's window, keyed as "<client> -> <server>"
+func (r *Report) SSHUnexpected() map[string]float64 {
+	sessions := make(map[string]float64)
+	for server, stats := range r.SSH {
+		if stats.Expected {
+			continue
+		}
+		for client, nb := range stats.Sessions {
+			sessions[client+" -> "+server] = float64(nb)
+		}
+	}
+
+	return sessions
+}
+
+// NTPUnexpected returns the number of time queries of each host to each NTP server that is not among the expected NTP
+// servers over the report's window, keyed as "<client> -> <server>"
+func (r *Report) NTPUnexpected() map[string]float64 {
+	queries := make(map[string]float64)
+	for server, stats := range r.NTP {
+		if stats.Expected {
+			continue
+		}
+		for client, nb := range stats.Clients {
+			queries[client+" -> "+server] = float64(nb)
+		}
+	}
+
+	return queries
+}
+
+// NTPAmplification returns the ratio of the bytes each NTP server sent each client over the report's window to those
+// it received from it, keyed as "<server> -> <client>". Responses to forged queries, whose client is the target of the
+// amplification, are large and many for small queries. Pairs whose responses total less than minimum bytes are left
+// out.
+func (r *Report) NTPAmplification(minimum uint64) map[string]float64 {
+	ratios := make(map[string]float64)
+	for server, stats := range r.NTP {
+		for client, answered := range stats.Answered {
+			if answered < minimum || answered == 0 {
+				continue
+			}
+			queried := stats.Queried[client]
+			if queried == 0 {
+				// Queries were not captured, e.g. forged upstream, and are taken to be a single one of the smallest length
+				queried = ntpSmallestQuery
+			}
+			ratios[server+" -> "+client] = float64(answered) / float64(queried)
+		}
+	}
+
+	return ratios
+}
+
+// SystemBreakdown returns the number of remote hosts of each guessed operating system
+func (r *Report) SystemBreakdown() map[string]int {
+	breakdown := make(map[string]int)
+	for _, os := range r.Systems {
+		breakdown[os]++
+	}
+
+	return breakdown
+}
+
+// NewReport build a new report, containing the host with the most hits
+func NewReport(a *Analysis, t time.Time) *Report {
+
+	// Copy flows into a slice, with timestamps in the same time zone as the report
+	flows := a.flows.records()
+	for _, flow := range flows {
+		flow.FirstSeen = flow.FirstSeen.In(t.Location())
+		flow.LastSeen = flow.LastSeen.In(t.Location())
+	}
+
+	// Copy interface statistics
+	devices := make(map[string]DeviceStats, len(a.devices))
+	for name, stats := range a.devices {
+		devices[name] = *stats
+	}
+
+	// Copy event counts
+	events := make(map[string]int, len(a.events))
+	for analyzer, nb := range a.events {
+		events[analyzer] = nb
+	}
+
+	// Copy guessed operating systems
+	systems := make(map[string]string, len(a.systems))
+	for ip, guess := range a.systems {
+		systems[ip] = guess.os
+	}
+
+	// Copy discovered hosts
+	discovery := make(map[string]Neighbour, len(a.discovery))
+	for ip, n := range a.discovery {
+		discovery[ip] = *n
+	}
+
+	// Summarise the requests and the responses of HTTP hosts
+	responses := a.httpStats()
+	paths := a.topPathStats()
+	agents := make(map[string]int, len(a.agents))
+	for agent, requests := range a.agents {
+		agents[agent] = requests
+	}
+	contents := make(map[string]MediaStats, len(a.contents))
+	for category, stats := range a.contents {
+		contents[category] = stats
+	}
+	streams := make(map[string]StreamStats, len(a.streams))
+	for protocol, stats := range a.streams {
+		streams[protocol] = stats
+	}
+
+	// Copy mail stats, downgrades ordered by capture time
+	mail := make(map[string]MailStats, len(a.mail))
+	for protocol, stats := range a.mail {
+		mail[protocol] = stats
+	}
+	mailDomains := make(map[string]MailDomainStats, len(a.mailDomains))
+	for domain, stats := range a.mailDomains {
+		mailDomains[domain] = stats
+	}
+	downgrades := append([]MailDowngrade(nil), a.downgrades...)
+	sort.SliceStable(downgrades, func(i, j int) bool { return downgrades[i].Seen.Before(downgrades[j].Seen) })
+	outbound := make(map[string]int, len(a.outbound))
+	for client, messages := range a.outbound {
+		outbound[client] = messages
+	}
+
+	// Copy SSH sessions
+	ssh := make(map[string]SSHStats, len(a.ssh))
+	for server, stats := range a.ssh {
+		ssh[server] = *stats
+	}
+
+	// Copy NTP servers
+	ntp := make(map[string]NTPStats, len(a.ntp))
+	for server, stats := range a.ntp {
+		ntp[server] = *stats
+	}
+
+	// Copy ARP conflicts, ordered by capture time
+	conflicts := append([]ARPConflict(nil), a.conflicts...)
+	sort.SliceStable(conflicts, func(i, j int) bool { return conflicts[i].Seen.Before(conflicts[j].Seen) })
+
+	// Copy TLS policy violations, ordered by capture time
+	violations := append([]TLSViolation(nil), a.violations...)
+	sort.SliceStable(violations, func(i, j int) bool { return violations[i].Seen.Before(violations[j].Seen) })
+
+	// Copy MTU stats, paths in trouble first, then by decreasing datagrams
+	mtu := make([]MTUStats, 0, len(a.mtu))
+	for _, stats := range a.mtu {
+		mtu = append(mtu, *stats)
+	}
+	sort.Slice(mtu, func(i, j int) bool {
+		if mtu[i].Troubled() != mtu[j].Troubled() {
+			return mtu[i].Troubled()
+		}
+		troubleI, troubleJ := mtu[i].Incomplete+mtu[i].TooBig, mtu[j].Incomplete+mtu[j].TooBig
+		if troubleI != troubleJ {
+			return troubleI > troubleJ
+		}
+		if mtu[i].Reassembled != mtu[j].Reassembled {
+			return mtu[i].Reassembled > mtu[j].Reassembled
+		}
+		return mtu[i].Source+mtu[i].Destination < mtu[j].Source+mtu[j].Destination
+	})
+
+	// Copy stalls, the longest first, then by decreasing zero windows
+	stalled := make([]StallStats, 0, len(a.stalls))
+	for _, stats := range a.stalls {
+		stalled = append(stalled, *stats)
+	}
+	sort.Slice(stalled, func(i, j int) bool {
+		if stalled[i].Longest != stalled[j].Longest {
+			return stalled[i].Longest > stalled[j].Longest
+		}
+		if stalled[i].ZeroWindows != stalled[j].ZeroWindows {
+			return stalled[i].ZeroWindows > stalled[j].ZeroWindows
+		}
+		return stalled[i].Sender+stalled[i].Receiver < stalled[j].Sender+stalled[j].Receiver
+	})
+
+	// Copy VoIP calls
+	calls := make(map[string]CallStats, len(a.calls))
+	for id, call := range a.calls {
+		calls[id] = *call
+	}
+
+	// If no hosts were registered, we have nothing to report
+	if len(a.hosts) == 0 {
+		log.Info("No hosts in analysis to build report on.")
+		return &Report{
+			TopHost:   nil,
+			Sections:  nil,
+			Hits:      a.nbHits,
+			Bytes:     a.nbBytes,
+			Devices:   devices,
+			Flows:     flows,
+			Events:    events,
+			Pipeline:  nil,
+			Processes: nil,
+			Systems:   systems,
+			NewHosts:  nil,
+			Discovery: discovery,
+			Responses: responses,
+			Paths:     paths,
+			Agents:    agents,
+			Contents:  contents,
+			Streams:   streams,
+			Calls:     calls,
+			Mail:      mail,
+			Domains:   mailDomains,
+			Cleartext: downgrades,
+			Outbound:  outbound,
+			SSH:       ssh,
+			NTP:       ntp,
+			Spoofing:  conflicts,
+			Policy:    violations,
+			MTU:       mtu,
+			Stalled:   stalled,
+			Matrix:    nil,
+			Diff:      nil,
+			Watched:   nil,
+			LongLived: nil,
+			Stale:     nil,
+			Timestamp: t,
+		}
+	}
+
+	// Loop through all encountered hosts and find the first one with most hits
+	var topHost *HostStats
+	topHits := 0
+	for _, stats := range a.hosts {
+		if stats.Hits > topHits {
+			topHits = stats.Hits
+			topHost = stats
+		}
+	}
+
+	// This should not happen, as we avoid the case above, but for the sake of it
+	if topHost == nil {
+		log.Error("Could not find a topHost on a non-empty set of Hosts. THIS SHOULD NOT HAPPEN.")
+		return &Report{
+			TopHost:   nil,
+			Sections:  nil,
+			Hits:      a.nbHits,
+			Bytes:     a.nbBytes,
+			Devices:   devices,
+			Flows:     flows,
+			Events:    events,
+			Pipeline:  nil,
+			Processes: nil,
+			Systems:   systems,
+			NewHosts:  nil,
+			Discovery: discovery,
+			Responses: responses,
+			Paths:     paths,
+			Agents:    agents,
+			Contents:  contents,
+			Streams:   streams,
+			Calls:     calls,
+			Mail:      mail,
+			Domains:   mailDomains,
+			Cleartext: downgrades,
+			Outbound:  outbound,
+			SSH:       ssh,
+			NTP:       ntp,
+			Spoofing:  conflicts,
+			Policy:    violations,
+			MTU:       mtu,
+			Stalled:   stalled,
+			Matrix:    nil,
+			Diff:      nil,
+			Watched:   nil,
+			LongLived: nil,
+			Stale:     nil,
+			Timestamp: t,
+		}
+	}
+
+	// Copy sections of host into a slice
+	sortedSections := make([]*SectionStats, len(topHost.Sections))
+	i := 0
+	for _, stats := range topHost.Sections {
+		sortedSections[i] = stats
+		i++
+	}
+	sort.Sort(SortedSections(sortedSections))
+
+	log.Info("sections ", sortedSections)
+
+	return &Report{
+		TopHost:   topHost,
+		Sections:  sortedSections,
+		Hits:      a.nbHits,
+		Bytes:     a.nbBytes,
+		Devices:   devices,
+		Flows:     flows,
+		Events:    events,
+		Pipeline:  nil,
+		Processes: nil,
+		Systems:   systems,
+		NewHosts:  nil,
+		Discovery: discovery,
+		Responses: responses,
+		Paths:     paths,
+		Agents:    agents,
+		Contents:  contents,
+		Streams:   streams,
+		Calls:     calls,
+		Mail:      mail,
+		Domains:   mailDomains,
+		Cleartext: downgrades,
+		Outbound:  outbound,
+		SSH:       ssh,
+		NTP:       ntp,
+		Spoofing:  conflicts,
+		Policy:    violations,
+		MTU:       mtu,
+		Stalled:   stalled,
+		Matrix:    nil,
+		Diff:      nil,
+		Watched:   nil,
+		LongLived: nil,
+		Stale:     nil,
+		Timestamp: t,
+	}
+}
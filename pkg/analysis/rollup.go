@@ -0,0 +1,162 @@
+package analysis
+
+import (
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"sort"
+	"time"
+)
+
+// Number of top talkers listed in a rollup
+const rollupTopTalkers = 5
+
+// Rollup aggregates the reports and alerts of an hour or a day
+type Rollup struct {
+	Period     string // Either hourly or daily
+	Start      time.Time
+	End        time.Time
+	Reports    int
+	Hits       int
+	Bytes      uint64
+	PeakRate   float64           // Highest byte rate of a single report window, in bytes per second
+	Alerts     int               // Number of alerts raised, recoveries excluded
+	Talkers    map[string]uint64 // IP addresses mapped to the number of bytes they sent
+	Containers map[string]string // IP addresses mapped to the Docker container owning them, if attributed
+	Workloads  map[string]string // IP addresses mapped to the Kubernetes pod or service owning them, if attributed
+	Names      map[string]string // IP addresses mapped to the friendly names discovery protocols gave them, if any
+}
+
+// Talker is an IP address with the number of bytes it sent
+type Talker struct {
+	IP        string
+	Bytes     uint64
+	Container string // Docker container owning the address, empty if none or not attributed
+	Workload  string // Kubernetes pod or service owning the address, empty if none or not attributed
+	Name      string // Friendly name a discovery protocol gave the address, empty if none
+}
+
+// TopTalkers returns the IP addresses that sent the most bytes over the period, in decreasing order
+func (r *Rollup) TopTalkers() []Talker {
+	talkers := make([]Talker, 0, len(r.Talkers))
+	for ip, bytes := range r.Talkers {
+		talkers = append(talkers, Talker{
+			IP:        ip,
+			Bytes:     bytes,
+			Container: r.Containers[ip],
+			Workload:  r.Workloads[ip],
+			Name:      r.Names[ip],
+		})
+	}
+
+	sort.Slice(talkers, func(i, j int) bool { return talkers[i].Bytes > talkers[j].Bytes })
+	if len(talkers) > rollupTopTalkers {
+		talkers = talkers[:rollupTopTalkers]
+	}
+
+	return talkers
+}
+
+// periodBounds returns the start and end of the hour or day t belongs to
+func periodBounds(period string, t time.Time) (time.Time, time.Time) {
+	if period == config.HourlyRollup {
+		start := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+		return start, start.Add(time.Hour)
+	}
+
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return start, start.AddDate(0, 0, 1)
+}
+
+// RollupAggregator accumulates reports and alerts into rollups for the enabled periods
+type RollupAggregator struct {
+	window  time.Duration      // Duration covered by a report, used to compute rates
+	current map[string]*Rollup // Rollups being accumulated, indexed by period
+}
+
+// NewRollupAggregator returns an aggregator for the periods enabled in parameters
+func NewRollupAggregator(parameters *config.Parameters) (*RollupAggregator, error) {
+	a := &RollupAggregator{
+		window:  parameters.DisplayRefresh,
+		current: make(map[string]*Rollup),
+	}
+
+	for _, period := range parameters.Rollups {
+		if period != config.HourlyRollup && period != config.DailyRollup {
+			return nil, fmt.Errorf("unknown rollup period : %s", period)
+		}
+		a.current[period] = nil
+	}
+
+	return a, nil
+}
+
+// AddReport accumulates the report, and returns the rollups of the periods that ended before it
+func (a *RollupAggregator) AddReport(r *Report) []*Rollup {
+	var done []*Rollup
+
+	for period, rollup := range a.current {
+		if rollup != nil && !r.Timestamp.Before(rollup.End) {
+			done = append(done, rollup)
+			rollup = nil
+		}
+
+		if rollup == nil {
+			start, end := periodBounds(period, r.Timestamp)
+			rollup = &Rollup{
+				Period:     period,
+				Start:      start,
+				End:        end,
+				Talkers:    make(map[string]uint64),
+				Containers: make(map[string]string),
+				Workloads:  make(map[string]string),
+				Names:      make(map[string]string),
+			}
+			a.current[period] = rollup
+		}
+
+		rollup.Reports++
+		rollup.Hits += r.Hits
+		rollup.Bytes += r.Bytes
+		if rate := float64(r.Bytes) / a.window.Seconds(); rate > rollup.PeakRate {
+			rollup.PeakRate = rate
+		}
+		for _, flow := range r.Flows {
+			rollup.Talkers[flow.SrcIP] += flow.SrcBytes
+			rollup.Talkers[flow.DstIP] += flow.DstBytes
+			if flow.SrcContainer != "" {
+				rollup.Containers[flow.SrcIP] = flow.SrcContainer
+			}
+			if flow.DstContainer != "" {
+				rollup.Containers[flow.DstIP] = flow.DstContainer
+			}
+			if flow.SrcWorkload != "" {
+				rollup.Workloads[flow.SrcIP] = flow.SrcWorkload
+			}
+			if flow.DstWorkload != "" {
+				rollup.Workloads[flow.DstIP] = flow.DstWorkload
+			}
+			if flow.SrcName != "" {
+				rollup.Names[flow.SrcIP] = flow.SrcName
+			}
+			if flow.DstName != "" {
+				rollup.Names[flow.DstIP] = flow.DstName
+			}
+		}
+	}
+
+	return done
+}
+
+// AddAlert accounts the alert in the rollups being accumulated
+func (a *RollupAggregator) AddAlert(msg *alert.Message) {
+	if msg.Recovery || msg.Notice {
+		return
+	}
+
+	for _, rollup := range a.current {
+		if rollup != nil {
+			rollup.Alerts++
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package analysis
+
+import (
+	"sort"
+)
+
+// reportSection is a part of reports outputs may leave out, or whose lists they may shorten
+type reportSection struct {
+	clear func(r *Report)           // Leaves the section out of the report
+	limit func(r *Report, size int) // Keeps the first size entries of the lists of the section. Nil if it has none.
+}
+
+// reportSections are the sections of reports, by name. The top host, totals and timestamp are always kept.
+var reportSections = map[string]reportSection{
+	"sections": {
+		clear: func(r *Report) { r.Sections = nil },
+		limit: func(r *Report, size int) {
+			// Sections are sorted by increasing hits
+			if len(r.Sections) > size {
+				r.Sections = r.Sections[len(r.Sections)-size:]
+			}
+		},
+	},
+	"interfaces": {
+		clear: func(r *Report) { r.Devices = nil },
+		limit: nil,
+	},
+	"flows": {
+		clear: func(r *Report) { r.Flows = nil },
+		limit: func(r *Report, size int) {
+			if len(r.Flows) <= size {
+				return
+			}
+			flows := append([]*FlowRecord(nil), r.Flows...)
+			sort.SliceStable(flows, func(i, j int) bool {
+				return flows[i].SrcBytes+flows[i].DstBytes > flows[j].SrcBytes+flows[j].DstBytes
+			})
+			r.Flows = flows[:size]
+		},
+	},
+	"events": {
+		clear: func(r *Report) { r.Events = nil },
+		limit: nil,
+	},
+	"pipeline": {
+		clear: func(r *Report) { r.Pipeline = nil },
+		limit: nil,
+	},
+	"processes": {
+		clear: func(r *Report) { r.Processes = nil },
+		limit: func(r *Report, size int) { r.Processes = r.Processes[:minSize(len(r.Processes), size)] },
+	},
+	"systems": {
+		clear: func(r *Report) { r.Systems = nil },
+		limit: nil,
+	},
+	"new_hosts": {
+		clear: func(r *Report) { r.NewHosts = nil },
+		limit: func(r *Report, size int) { r.NewHosts = r.NewHosts[:minSize(len(r.NewHosts), size)] },
+	},
+	"discovery": {
+		clear: func(r *Report) { r.Discovery = nil },
+		limit: nil,
+	},
+	"http": {
+		clear: func(r *Report) { r.Responses, r.Paths, r.Agents, r.Contents = nil, nil, nil, nil },
+		limit: func(r *Report, size int) { r.Paths = r.Paths[:minSize(len(r.Paths), size)] },
+	},
+	"streams": {
+		clear: func(r *Report) { r.Streams = nil },
+		limit: nil,
+	},
+	"calls": {
+		clear: func(r *Report) { r.Calls = nil },
+		limit: nil,
+	},
+	"mail": {
+		clear: func(r *Report) { r.Mail, r.Domains, r.Cleartext, r.Outbound = nil, nil, nil, nil },
+		limit: func(r *Report, size int) { r.Cleartext = r.Cleartext[:minSize(len(r.Cleartext), size)] },
+	},
+	"ssh": {
+		clear: func(r *Report) { r.SSH = nil },
+		limit: nil,
+	},
+	"ntp": {
+		clear: func(r *Report) { r.NTP = nil },
+		limit: nil,
+	},
+	"arp": {
+		clear: func(r *Report) { r.Spoofing = nil },
+		limit: func(r *Report, size int) { r.Spoofing = r.Spoofing[:minSize(len(r.Spoofing), size)] },
+	},
+	"tls": {
+		clear: func(r *Report) { r.Policy = nil },
+		limit: func(r *Report, size int) { r.Policy = r.Policy[:minSize(len(r.Policy), size)] },
+	},
+	"mtu": {
+		clear: func(r *Report) { r.MTU = nil },
+		limit: func(r *Report, size int) { r.MTU = r.MTU[:minSize(len(r.MTU), size)] },
+	},
+	"tcp": {
+		clear: func(r *Report) { r.Stalled, r.LongLived, r.Stale = nil, nil, nil },
+		limit: func(r *Report, size int) {
+			r.Stalled = r.Stalled[:minSize(len(r.Stalled), size)]
+			r.LongLived = r.LongLived[:minSize(len(r.LongLived), size)]
+			r.Stale = r.Stale[:minSize(len(r.Stale), size)]
+		},
+	},
+	"matrix": {
+		clear: func(r *Report) { r.Matrix = nil },
+		limit: func(r *Report, size int) { r.Matrix = r.Matrix[:minSize(len(r.Matrix), size)] },
+	},
+	"diff": {
+		clear: func(r *Report) { r.Diff = nil },
+		limit: func(r *Report, size int) {
+			if r.Diff == nil {
+				return
+			}
+			diff := *r.Diff
+			diff.New = diff.New[:minSize(len(diff.New), size)]
+			diff.Gone = diff.Gone[:minSize(len(diff.Gone), size)]
+			diff.Rising = diff.Rising[:minSize(len(diff.Rising), size)]
+			r.Diff = &diff
+		},
+	},
+	"watch": {
+		clear: func(r *Report) { r.Watched = nil },
+		limit: nil,
+	},
+}
+
+// minSize returns the smaller of the length of a list and the size it is limited to
+func minSize(length, size int) int {
+	if size < length {
+		return size
+	}
+
+	return length
+}
+
+// ReportSections returns the names of the sections of reports outputs may select, sorted
+func ReportSections() []string {
+	names := make([]string, 0, len(reportSections))
+	for name := range reportSections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// ReportListSections returns the names of the sections of reports whose lists may be shortened, sorted
+func ReportListSections() []string {
+	var names []string
+	for name, section := range reportSections {
+		if section.limit != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Select returns a copy of the report holding only the sections named, all of them if none is, with the lists of
+// sections cut to their sizes, by section name. The report itself is left untouched, and shares the data kept.
+func (r *Report) Select(sections []string, sizes map[string]int) *Report {
+	selected := *r
+
+	if len(sections) > 0 {
+		keep := make(map[string]bool, len(sections))
+		for _, name := range sections {
+			keep[name] = true
+		}
+		for name, section := range reportSections {
+			if !keep[name] {
+				section.clear(&selected)
+			}
+		}
+	}
+
+	for name, size := range sizes {
+		if section, ok := reportSections[name]; ok && section.limit != nil {
+			section.limit(&selected, size)
+		}
+	}
+
+	return &selected
+}
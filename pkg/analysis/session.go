@@ -0,0 +1,448 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/diagnostics"
+	"github.com/bytemare/gonetmon/pkg/docker"
+	"github.com/bytemare/gonetmon/pkg/inventory"
+	"github.com/bytemare/gonetmon/pkg/keylog"
+	"github.com/bytemare/gonetmon/pkg/kubernetes"
+	"github.com/bytemare/gonetmon/pkg/process"
+	"github.com/bytemare/gonetmon/pkg/trend"
+	"github.com/sirupsen/logrus"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Number of batches queued for a worker before the Monitor waits for it
+const workerBacklog = 4
+
+// Number of local processes with the most traffic kept in reports
+const topProcesses = 10
+
+// Number of friendly names of discovered hosts kept across reports
+const maxNames = 4096
+
+// Session is a placeholder for current analysis and report, and Watchdog reference
+type Session struct {
+	workers    []*worker               // Workers analysing packets in parallel
+	watchdog   *alert.Watchdog         // Surveil traffic behaviour and raise alert if need
+	recorder   *capture.FlightRecorder // Keeps recent packets for dumps. Nil if disabled.
+	timeZone   *time.Location          // Time zone of report timestamps
+	limits     config.FlowTableConfig  // Limits of the flow table of each worker
+	containers *docker.Directory       // Docker containers flows are attributed to. Nil if disabled.
+	workloads  *kubernetes.Directory   // Kubernetes pods and services flows are attributed to. Nil if disabled.
+	processes  *process.Directory      // Local processes flows are attributed to. Nil if disabled.
+	inventory  *inventory.Inventory    // Hosts of the inventoried networks. Nil if disabled.
+	trends     *trend.Trends           // Long-term bandwidth trends of interfaces. Nil if disabled.
+	names      map[string]string       // Friendly names discovery protocols gave hosts, by IP address
+	storms     bool                    // Whether broadcast and multicast frames are counted, to detect storms
+	dscp       bool                    // Whether traffic is broken down by DSCP class
+	uploads    *uploadTracker          // Bytes internal hosts sent to external destinations. Nil if disabled.
+	groups     *groupMatrix            // Traffic between groups of networks. Nil if no group is configured.
+	differ     *reportDiffer           // Previous report, to tell what changed in each one
+	countries  *countryTracker         // Bytes internal hosts exchanged with addresses of the countries alerted of. Nil if disabled.
+	watch      *watchTracker           // Traffic of the watched targets. Nil if none is watched.
+	lingering  *lingerTracker          // Connections followed across reports, to tell long-lived and stale ones. Nil if disabled.
+	keys       *keylog.Log             // Secrets TLS traffic is decrypted with. Nil if disabled.
+}
+
+// worker analyses the batches of packets it is handed with its own analyzers, into its own analysis
+type worker struct {
+	session   *Session
+	mutex     sync.Mutex    // Guards the analysis, between batches and reports
+	analysis  *Analysis     // Current ongoing analysis
+	analyzers []Analyzer    // Analyzers captured packets are dispatched to
+	decrypter *tlsDecrypter // Decrypter of the TLS traffic of owned services, whose plaintext is dispatched too. Nil if disabled.
+	batches   chan []capture.PacketMsg
+}
+
+// NewSession initialises a new monitoring session with a worker for each set of analyzers, whose Watchdog and workload
+// directories are to be run by the caller
+func NewSession(parameters *config.Parameters, analyzers [][]Analyzer, recorder *capture.FlightRecorder, watchdog *alert.Watchdog) (*Session, error) {
+	s := &Session{
+		workers:    make([]*worker, 0, len(analyzers)),
+		watchdog:   watchdog,
+		recorder:   recorder,
+		timeZone:   parameters.TimeZone,
+		limits:     workerLimits(parameters.FlowTable, len(analyzers)),
+		containers: nil,
+		workloads:  nil,
+		processes:  nil,
+		inventory:  nil,
+		trends:     nil,
+		names:      make(map[string]string),
+		storms:     parameters.Storms.Enabled,
+		dscp:       parameters.DSCP,
+		uploads:    nil,
+		groups:     nil,
+		differ:     newReportDiffer(),
+		countries:  nil,
+		watch:      nil,
+		lingering:  nil,
+		keys:       nil,
+	}
+
+	if parameters.Docker.Enabled {
+		s.containers = docker.NewDirectory(&parameters.Docker)
+	}
+	if parameters.Kubernetes.Enabled {
+		workloads, err := kubernetes.NewDirectory(&parameters.Kubernetes)
+		if err != nil {
+			return nil, fmt.Errorf("could not watch Kubernetes workloads : %s", err)
+		}
+		s.workloads = workloads
+	}
+	if parameters.Processes.Enabled {
+		s.processes = process.NewDirectory(&parameters.Processes)
+	}
+	if parameters.Inventory.Enabled {
+		hosts, err := inventory.New(&parameters.Inventory)
+		if err != nil {
+			return nil, fmt.Errorf("could not load the host inventory : %s", err)
+		}
+		s.inventory = hosts
+	}
+	if parameters.Capacity.Enabled {
+		trends, err := trend.New(&parameters.Capacity)
+		if err != nil {
+			return nil, fmt.Errorf("could not load the bandwidth trends : %s", err)
+		}
+		s.trends = trends
+	}
+	if parameters.Uploads.Enabled {
+		uploads, err := newUploadTracker(&parameters.Uploads)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upload detection networks : %s", err)
+		}
+		s.uploads = uploads
+	}
+	if len(parameters.Matrix.Groups) > 0 {
+		groups, err := newGroupMatrix(&parameters.Matrix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR groups : %s", err)
+		}
+		s.groups = groups
+	}
+	if parameters.Countries.Enabled {
+		countries, err := newCountryTracker(&parameters.Countries)
+		if err != nil {
+			return nil, fmt.Errorf("could not set up country alerts : %s", err)
+		}
+		s.countries = countries
+	}
+	if len(parameters.Watch.Targets) > 0 {
+		watch, err := newWatchTracker(&parameters.Watch)
+		if err != nil {
+			return nil, fmt.Errorf("invalid watched targets : %s", err)
+		}
+		s.watch = watch
+	}
+	if parameters.Lingering.Enabled {
+		s.lingering = newLingerTracker(&parameters.Lingering)
+	}
+	if parameters.Decryption.Enabled {
+		s.keys = keylog.New(&parameters.Decryption)
+	}
+
+	for i, set := range analyzers {
+		w := &worker{
+			session:   s,
+			mutex:     sync.Mutex{},
+			analysis:  s.newAnalysis(),
+			analyzers: set,
+			decrypter: nil,
+			batches:   make(chan []capture.PacketMsg, workerBacklog),
+		}
+		if s.keys != nil {
+			decrypter, err := newTLSDecrypter(&parameters.Decryption, s.keys)
+			if err != nil {
+				return nil, fmt.Errorf("invalid TLS decryption services : %s", err)
+			}
+			w.decrypter = decrypter
+		}
+		s.workers = append(s.workers, w)
+
+		diagnostics.RegisterQueue(parameters.Qualify(fmt.Sprintf("worker.%d", i)), func() (int, int) {
+			return len(w.batches), cap(w.batches)
+		})
+	}
+
+	return s, nil
+}
+
+// newAnalysis returns an empty analysis for a worker, which accounts hosts if they are inventoried
+func (s *Session) newAnalysis() *Analysis {
+	a := NewAnalysis(s.limits)
+	if s.inventory != nil {
+		a.trackHosts()
+	}
+
+	return a
+}
+
+// workerLimits returns the share of each of the workers in the limits of the flow table
+func workerLimits(limits config.FlowTableConfig, workers int) config.FlowTableConfig {
+	if workers <= 1 {
+		return limits
+	}
+
+	return config.FlowTableConfig{
+		MaxFlows:    (limits.MaxFlows + workers - 1) / workers,
+		MaxMemory:   (limits.MaxMemory + int64(workers) - 1) / int64(workers),
+		IdleTimeout: limits.IdleTimeout,
+	}
+}
+
+// BuildReport collects the analyses of all workers into a report, timestamped in the session's time zone, and starts
+// a new analysis window
+func (s *Session) BuildReport(t time.Time) *Report {
+	var analysis *Analysis
+	for _, w := range s.workers {
+		w.mutex.Lock()
+		a := w.analysis
+		w.analysis = s.newAnalysis()
+		w.mutex.Unlock()
+
+		if analysis == nil {
+			analysis = a
+		} else {
+			analysis.merge(a)
+		}
+	}
+
+	report := NewReport(analysis, t.In(s.timeZone))
+	if s.containers != nil {
+		labelContainers(report, s.containers)
+	}
+	if s.workloads != nil {
+		labelWorkloads(report, s.workloads)
+	}
+	if s.processes != nil {
+		labelProcesses(report, s.processes)
+	}
+	s.labelNames(report)
+	if s.lingering != nil {
+		report.LongLived, report.Stale = s.lingering.add(report)
+	}
+	if s.groups != nil {
+		report.Matrix = s.groups.add(report)
+	}
+	report.Diff = s.differ.add(report)
+	if s.watch != nil {
+		report.Watched = s.watch.add(report)
+	}
+	if s.inventory != nil {
+		// Hosts are rather called by the names they give themselves than by those of DNS answers
+		for ip, n := range report.Discovery {
+			if n.Name != "" {
+				analysis.names[ip] = n.Name
+			}
+		}
+		report.NewHosts = s.inventory.Update(analysis.sightings, analysis.names)
+		if err := s.inventory.Save(); err != nil {
+			log.Error("Could not save the host inventory : ", err)
+		}
+	}
+
+	return report
+}
+
+// labelContainers attributes the flows of the report to the containers owning their addresses, and its interfaces to
+// the containers on the other end of their veth pairs
+func labelContainers(report *Report, containers *docker.Directory) {
+	for _, flow := range report.Flows {
+		flow.SrcContainer = containers.ByIP(flow.SrcIP)
+		flow.DstContainer = containers.ByIP(flow.DstIP)
+	}
+
+	for name, stats := range report.Devices {
+		stats.Container = containers.ByInterface(name)
+		report.Devices[name] = stats
+	}
+}
+
+// labelWorkloads attributes the flows of the report to the Kubernetes pods and services owning their addresses
+func labelWorkloads(report *Report, workloads *kubernetes.Directory) {
+	for _, flow := range report.Flows {
+		flow.SrcWorkload = workloads.ByIP(flow.SrcIP)
+		flow.DstWorkload = workloads.ByIP(flow.DstIP)
+	}
+}
+
+// labelProcesses attributes the flows of the report to the local processes owning their sockets, and lists the
+// processes with the most traffic. A flow between two local processes counts for both.
+func labelProcesses(report *Report, processes *process.Directory) {
+	stats := make(map[process.Process]*ProcessStats)
+	account := func(p process.Process, flow *FlowRecord) {
+		if _, ok := stats[p]; !ok {
+			stats[p] = &ProcessStats{PID: p.PID, Name: p.Name, Bytes: 0, Flows: 0}
+		}
+		stats[p].Bytes += flow.SrcBytes + flow.DstBytes
+		stats[p].Flows++
+	}
+
+	for _, flow := range report.Flows {
+		src, srcFound := processes.Lookup(flow.Protocol, flow.SrcIP, flow.SrcPort, flow.DstIP, flow.DstPort)
+		if srcFound {
+			flow.SrcProcess = src.String()
+			account(src, flow)
+		}
+		dst, dstFound := processes.Lookup(flow.Protocol, flow.DstIP, flow.DstPort, flow.SrcIP, flow.SrcPort)
+		if dstFound {
+			flow.DstProcess = dst.String()
+			if !srcFound || dst != src {
+				account(dst, flow)
+			}
+		}
+	}
+
+	report.Processes = make([]ProcessStats, 0, len(stats))
+	for _, p := range stats {
+		report.Processes = append(report.Processes, *p)
+	}
+	sort.Slice(report.Processes, func(i, j int) bool {
+		if report.Processes[i].Bytes != report.Processes[j].Bytes {
+			return report.Processes[i].Bytes > report.Processes[j].Bytes
+		}
+		return report.Processes[i].PID < report.Processes[j].PID
+	})
+	if len(report.Processes) > topProcesses {
+		report.Processes = report.Processes[:topProcesses]
+	}
+}
+
+// labelNames learns the friendly names of the hosts discovered during the report's window, and gives them to the
+// endpoints of its flows. Hosts announce themselves seldom, so that names are kept across reports, up to maxNames.
+func (s *Session) labelNames(report *Report) {
+	for ip, n := range report.Discovery {
+		if _, ok := s.names[ip]; n.Name != "" && (ok || len(s.names) < maxNames) {
+			s.names[ip] = n.Name
+		}
+	}
+
+	for _, flow := range report.Flows {
+		flow.SrcName = s.names[flow.SrcIP]
+		flow.DstName = s.names[flow.DstIP]
+	}
+}
+
+// worker returns the worker analysing the batches of the capture socket the batch was read on. A flow read on a
+// single socket is thus analysed by a single worker.
+func (s *Session) worker(batch []capture.PacketMsg) *worker {
+	if len(s.workers) == 1 || len(batch) == 0 {
+		return s.workers[0]
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(batch[0].Device))
+
+	return s.workers[(h.Sum32()+uint32(batch[0].Socket))%uint32(len(s.workers))]
+}
+
+// run analyses the batches handed to the worker, until ctx is cancelled or batches is closed
+func (w *worker) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case batch, ok := <-w.batches:
+			if !ok {
+				return
+			}
+			w.process(ctx, batch)
+		}
+	}
+}
+
+// process accounts the packets of the batch in flows, records them, and dispatches them to analyzers
+func (w *worker) process(ctx context.Context, batch []capture.PacketMsg) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for i := range batch {
+		data := &batch[i]
+		analysedPackets.Inc()
+		queuedLatency.Since(data.Read)
+
+		// Frames let through filters to detect storms, and corrupt packets, are only counted
+		if w.session.storms {
+			w.analysis.AccountCast(data)
+		}
+		w.analysis.AccountIntegrity(data)
+		if data.CountOnly {
+			continue
+		}
+		w.analysis.AccountTraffic(data)
+		if w.session.dscp {
+			w.analysis.AccountDSCP(data)
+		}
+
+		// Account all captured traffic in flows, and senders in the inventory
+		w.analysis.AccountFlow(data)
+		if w.session.inventory != nil {
+			w.analysis.accountHost(data, w.session.inventory)
+		}
+
+		if w.session.recorder != nil {
+			w.session.recorder.Record(data)
+		}
+
+		// Hand packet over to analyzers
+		dispatched := time.Now()
+		w.dispatch(ctx, data)
+		if w.decrypter != nil {
+			if plaintext := w.decrypter.decrypt(data); len(plaintext) > 0 {
+				decrypted := *data
+				decrypted.Payload = plaintext
+				w.dispatch(ctx, &decrypted)
+			}
+		}
+		dispatchLatency.Since(dispatched)
+	}
+
+	// Analyzers do not keep payloads beyond processing, and the recorder only keeps packet data
+	capture.Release(batch)
+}
+
+// dispatch hands the packet to all analyzers matching it, adds their events to the analysis and notifies the
+// Watchdog of hits
+func (w *worker) dispatch(ctx context.Context, data *capture.PacketMsg) {
+	for _, analyzer := range w.analyzers {
+		if !analyzer.Match(data) {
+			continue
+		}
+
+		events, err := analyzer.Process(data)
+		if err != nil {
+			fields := logrus.Fields{
+				"analyzer":          analyzer.Name(),
+				"interface":         data.Device,
+				"capture timestamp": data.Timestamp,
+				"error":             err,
+			}
+			if len(data.Payload) > 0 {
+				fields["payload"] = strings.Replace(string(data.Payload), "\n", "{newline}", -1) // Flatten to a single line to avoid breaking log file
+			}
+			log.WithFields(fields).Error("Could not interpret packet.")
+			continue
+		}
+
+		producedEvents.Add(uint64(len(events)))
+		for _, event := range events {
+			w.analysis.AddEvent(event)
+
+			// Update Watchdog
+			if event.Hit {
+				w.session.watchdog.AddHit(ctx, event.Timestamp)
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package analysis
+
+import (
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/inventory"
+	"net"
+	"strings"
+)
+
+// trackHosts has the analysis account the hosts of the inventoried networks and the names of addresses
+func (a *Analysis) trackHosts() {
+	a.sightings = make(map[string]*inventory.Sighting)
+	a.names = make(map[string]string)
+	a.outside = make(map[string]bool)
+}
+
+// accountHost adds the sender of a captured packet to the hosts seen during the window, if it belongs to an
+// inventoried network
+func (a *Analysis) accountHost(data *capture.PacketMsg, hosts *inventory.Inventory) {
+	if data.SrcIP == "" || a.outside[data.SrcIP] {
+		return
+	}
+
+	sighting, ok := a.sightings[data.SrcIP]
+	if !ok {
+		if !hosts.Contains(data.SrcIP) {
+			a.outside[data.SrcIP] = true
+			return
+		}
+
+		sighting = &inventory.Sighting{
+			MAC:       "",
+			FirstSeen: data.Timestamp,
+			LastSeen:  data.Timestamp,
+			Protocols: make(map[string]bool),
+			Services:  make(map[string]bool),
+		}
+		a.sightings[data.SrcIP] = sighting
+	}
+
+	if data.SrcMAC != [6]byte{} {
+		sighting.MAC = net.HardwareAddr(data.SrcMAC[:]).String()
+	}
+	if data.Timestamp.Before(sighting.FirstSeen) {
+		sighting.FirstSeen = data.Timestamp
+	}
+	if data.Timestamp.After(sighting.LastSeen) {
+		sighting.LastSeen = data.Timestamp
+	}
+	if data.Protocol != "" {
+		sighting.Protocols[data.Protocol] = true
+	}
+}
+
+// sightProtocol adds the application protocol of the event to those of its remote host, if it was seen during the
+// window, along with the services it advertised through discovery protocols, and names the addresses of DNS answers
+func (a *Analysis) sightProtocol(e *Event) {
+	if sighting, ok := a.sightings[e.RemoteIP]; ok {
+		sighting.Protocols[e.Analyzer] = true
+		if e.Analyzer == config.DiscoveryAnalyzer && e.Attributes[discoveryServices] != "" {
+			for _, service := range strings.Split(e.Attributes[discoveryServices], ",") {
+				sighting.Services[service] = true
+			}
+		}
+	}
+
+	if e.Analyzer == config.DNSAnalyzer && e.Type == dnsAnswer && e.Attributes[dnsAddresses] != "" {
+		for _, ip := range strings.Split(e.Attributes[dnsAddresses], ",") {
+			a.names[ip] = strings.TrimSuffix(e.Host, ".")
+		}
+	}
+}
+
+// mergeSightings adds the hosts and names seen by b, the analysis of another worker over the same window
+func (a *Analysis) mergeSightings(b *Analysis) {
+	for ip, s := range b.sightings {
+		sighting, ok := a.sightings[ip]
+		if !ok {
+			a.sightings[ip] = s
+			continue
+		}
+
+		if s.MAC != "" {
+			sighting.MAC = s.MAC
+		}
+		if s.FirstSeen.Before(sighting.FirstSeen) {
+			sighting.FirstSeen = s.FirstSeen
+		}
+		if s.LastSeen.After(sighting.LastSeen) {
+			sighting.LastSeen = s.LastSeen
+		}
+		for protocol := range s.Protocols {
+			sighting.Protocols[protocol] = true
+		}
+		for service := range s.Services {
+			sighting.Services[service] = true
+		}
+	}
+
+	for ip, name := range b.names {
+		a.names[ip] = name
+	}
+}
@@ -0,0 +1,189 @@
+package analysis
+
+import (
+	"bytes"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	// Types of SSH events
+	sshBanner = "banner" // A client or a server sends its version banner, which starts a session
+	sshClose  = "close"  // A session is closed
+
+	// Attributes of SSH events
+	sshRole     = "role"     // Sender of a banner, client or server
+	sshSoftware = "software" // Software of the sender of a banner, e.g. OpenSSH_8.9p1
+	sshServer   = "server"   // Endpoint of the server, as <ip>:<port>
+	sshClient   = "client"   // Address of the client
+	sshExpected = "expected" // Whether the server is among the expected SSH destinations
+	sshDuration = "duration" // Duration of a closed session, in nanoseconds
+	sshShort    = "short"    // Whether a closed session lasted less than the short duration, e.g. a failed login
+
+	// Roles of the senders of banners
+	sshClientRole = "client"
+	sshServerRole = "server"
+
+	// Longest software name kept from a banner
+	maxSSHSoftware = 64
+
+	// Bounds of the sessions followed, past which those idle for the timeout are forgotten, and new ones are ignored if
+	// none is
+	maxSSHSessions    = 4096
+	sshSessionTimeout = 2 * time.Hour
+)
+
+// sshAnalyzer reads the version banners of SSH sessions, and follows the sessions until they are closed to tell their
+// durations. Sessions closed shortly after their start are told apart, as failed logins make them.
+type sshAnalyzer struct {
+	sessions map[string]*sshSession // Sessions followed, by stream
+	short    time.Duration          // Duration under which closed sessions are short
+	servers  []*net.IPNet           // Expected SSH destinations. If empty, any is expected.
+}
+
+// sshSession is an SSH session followed since its first banner
+type sshSession struct {
+	server string // Endpoint of the server, as <ip>:<port>
+	client string // Address of the client
+	start  time.Time
+	seen   time.Time
+}
+
+// newSSHAnalyzer returns an SSH analyzer, whose expected destinations are checked
+func newSSHAnalyzer(parameters *config.Parameters) (Analyzer, error) {
+	servers, err := ParseAddresses(parameters.SSH.Servers)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sshAnalyzer{
+		sessions: make(map[string]*sshSession),
+		short:    parameters.SSH.Short,
+		servers:  servers,
+	}, nil
+}
+
+// Name returns the name of the SSH analyzer
+func (s *sshAnalyzer) Name() string {
+	return config.SSHAnalyzer
+}
+
+// Match tells whether the TCP payload starts with an SSH banner, or the packet closes a followed session
+func (s *sshAnalyzer) Match(data *capture.PacketMsg) bool {
+	if data.Protocol != "tcp" {
+		return false
+	}
+	if bytes.HasPrefix(data.Payload, []byte("SSH-")) {
+		return true
+	}
+	if !data.FIN && !data.RST {
+		return false
+	}
+	_, ok := s.sessions[streamKey(data)]
+
+	return ok
+}
+
+// Process returns the event of a banner, starting to follow its session, or the event of the end of a session
+func (s *sshAnalyzer) Process(data *capture.PacketMsg) ([]*Event, error) {
+	key := streamKey(data)
+	session, ok := s.sessions[key]
+
+	if !bytes.HasPrefix(data.Payload, []byte("SSH-")) {
+		if !ok {
+			return nil, nil
+		}
+		delete(s.sessions, key)
+
+		duration := data.Timestamp.Sub(session.start)
+		event := s.newSSHEvent(sshClose, data, session)
+		event.Attributes[sshDuration] = strconv.FormatInt(int64(duration), 10)
+		event.Attributes[sshShort] = strconv.FormatBool(duration < s.short)
+		return []*Event{event}, nil
+	}
+
+	if !ok {
+		if len(s.sessions) >= maxSSHSessions {
+			s.expire(data.Timestamp)
+			if len(s.sessions) >= maxSSHSessions {
+				return nil, nil
+			}
+		}
+
+		// Servers listen on well-known ports, below the ephemeral ports of clients
+		session = &sshSession{
+			server: endpoint(data.DstIP, data.DstPort),
+			client: data.SrcIP,
+			start:  data.Timestamp,
+			seen:   data.Timestamp,
+		}
+		if data.SrcPort < data.DstPort {
+			session.server, session.client = endpoint(data.SrcIP, data.SrcPort), data.DstIP
+		}
+		s.sessions[key] = session
+	}
+	session.seen = data.Timestamp
+
+	role := sshClientRole
+	if endpoint(data.SrcIP, data.SrcPort) == session.server {
+		role = sshServerRole
+	}
+
+	event := s.newSSHEvent(sshBanner, data, session)
+	event.Attributes[sshRole] = role
+	event.Attributes[sshSoftware] = sshBannerSoftware(data.Payload)
+
+	return []*Event{event}, nil
+}
+
+// newSSHEvent returns an event of the session, telling whether its server is expected
+func (s *sshAnalyzer) newSSHEvent(eventType string, data *capture.PacketMsg, session *sshSession) *Event {
+	event := newEvent(config.SSHAnalyzer, eventType, data, false)
+	event.Attributes[sshServer] = session.server
+	event.Attributes[sshClient] = session.client
+
+	expected := len(s.servers) == 0
+	if !expected {
+		host, _, _ := net.SplitHostPort(session.server)
+		expected = containsIP(s.servers, net.ParseIP(host))
+	}
+	event.Attributes[sshExpected] = strconv.FormatBool(expected)
+
+	return event
+}
+
+// sshBannerSoftware returns the software of a version banner, e.g. OpenSSH_8.9p1 for
+// SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.1, or unknown if the banner is malformed
+func sshBannerSoftware(payload []byte) string {
+	line := payload
+	if end := bytes.IndexAny(line, "\r\n"); end >= 0 {
+		line = line[:end]
+	}
+
+	// SSH-protoversion-softwareversion SP comments
+	fields := bytes.SplitN(line, []byte("-"), 3)
+	if len(fields) != 3 || len(fields[2]) == 0 {
+		return "unknown"
+	}
+	software := fields[2]
+	if space := bytes.IndexByte(software, ' '); space >= 0 {
+		software = software[:space]
+	}
+	if len(software) > maxSSHSoftware {
+		software = software[:maxSSHSoftware]
+	}
+
+	return string(software)
+}
+
+// expire forgets the sessions idle for the timeout at t
+func (s *sshAnalyzer) expire(t time.Time) {
+	for key, session := range s.sessions {
+		if t.Sub(session.seen) >= sshSessionTimeout {
+			delete(s.sessions, key)
+		}
+	}
+}
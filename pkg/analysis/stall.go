@@ -0,0 +1,220 @@
+package analysis
+
+import (
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"strconv"
+	"time"
+)
+
+const (
+	// Types of stall events
+	stallZeroWindow = "zero_window" // A receiver closes its window to zero, having done so the zero windows reported
+	stallStalled    = "stalled"     // The data of a sender makes no forward progress for the stall timeout
+	stallResumed    = "resumed"     // The data of a stalled sender makes progress again
+
+	// Attributes of stall events
+	stallSender      = "sender"       // Endpoint of the sender whose data is held up, as <ip>:<port>
+	stallReceiver    = "receiver"     // Endpoint of the receiver, as <ip>:<port>
+	stallZeroWindows = "zero_windows" // Times the receiver closed its window to zero so far
+	stallReason      = "reason"       // Why a sender is stalled, its data going unacknowledged or the window being zero
+	stallDuration    = "duration"     // Time without progress of a stalled or resumed sender, in nanoseconds
+
+	// Reasons of stalls
+	stallUnacknowledged = "unacknowledged"
+	stallClosedWindow   = "zero_window"
+
+	// Bounds of the connections followed, past which those idle for the timeout are forgotten, and new ones are ignored
+	// if none is
+	maxStallConnections = 65536
+	stallIdleTimeout    = 10 * time.Minute
+)
+
+// stallAnalyzer follows the sequence and acknowledgment numbers and the windows of TCP connections, telling of the
+// senders whose data makes no forward progress for long, and of the receivers closing their window over and over
+type stallAnalyzer struct {
+	connections map[string]*tcpConnection // Connections followed, by stream
+	timeout     time.Duration             // Time without progress past which a sender is stalled
+	zeroWindows uint                      // Times a receiver closes its window past which it is reported
+	swept       time.Time                 // Capture time connections were last checked for stalls
+}
+
+// tcpConnection holds both directions of a TCP connection, indexed by the endpoint of their sender
+type tcpConnection struct {
+	senders map[string]*tcpSender
+	seen    time.Time // Capture time of the last segment
+}
+
+// tcpSender is a direction of a TCP connection, the data a sender has in flight and what its receiver tells of it
+type tcpSender struct {
+	receiver    string    // Endpoint of the receiver, as <ip>:<port>
+	next        uint32    // Sequence number following the last byte sent
+	acked       uint32    // Sequence number the receiver last acknowledged
+	progress    time.Time // Capture time the data last moved forward, or since which data is in flight
+	closed      time.Time // Capture time the receiver closed its window to zero, zero while it is open
+	zeroWindows uint      // Times the receiver closed its window to zero
+	stalled     time.Time // Capture time since which the sender is stalled, zero if it is not
+}
+
+// newStallAnalyzer returns a stall analyzer, with the stall timeout and the zero windows reported
+func newStallAnalyzer(parameters *config.Parameters) (Analyzer, error) {
+	return &stallAnalyzer{
+		connections: make(map[string]*tcpConnection),
+		timeout:     parameters.Stall.Timeout,
+		zeroWindows: parameters.Stall.ZeroWindows,
+	}, nil
+}
+
+// Name returns the name of the stall analyzer
+func (s *stallAnalyzer) Name() string {
+	return config.StallAnalyzer
+}
+
+// Match tells whether the packet is a TCP segment
+func (s *stallAnalyzer) Match(data *capture.PacketMsg) bool {
+	return data.Protocol == "tcp"
+}
+
+// seqAfter tells whether the sequence number a follows b, sequence numbers wrapping around
+func seqAfter(a, b uint32) bool {
+	return int32(a-b) > 0
+}
+
+// Process accounts the data the segment sends, and what it acknowledges and advertises of the data of the other
+// direction, returning the events of a receiver closing its window again or of a sender resuming, along with those of
+// the senders stalled since the last check
+func (s *stallAnalyzer) Process(data *capture.PacketMsg) ([]*Event, error) {
+	events := s.sweep(data)
+
+	key := streamKey(data)
+	if data.RST {
+		delete(s.connections, key)
+		return events, nil
+	}
+
+	conn, ok := s.connections[key]
+	if !ok {
+		if len(s.connections) >= maxStallConnections {
+			return events, nil
+		}
+		conn = &tcpConnection{senders: make(map[string]*tcpSender, 2), seen: data.Timestamp}
+		s.connections[key] = conn
+	}
+	conn.seen = data.Timestamp
+
+	src, dst := endpoint(data.SrcIP, data.SrcPort), endpoint(data.DstIP, data.DstPort)
+
+	// The sequence numbers the segment takes, SYN and FIN included
+	end := data.Seq + uint32(len(data.Payload))
+	if data.SYN {
+		end++
+	}
+	if data.FIN {
+		end++
+	}
+	sender, ok := conn.senders[src]
+	if !ok {
+		sender = &tcpSender{receiver: dst, next: end, acked: data.Seq, progress: data.Timestamp}
+		conn.senders[src] = sender
+	} else if seqAfter(end, sender.next) {
+		if sender.next == sender.acked {
+			// Data was not in flight until now, so that the wait for its acknowledgment starts
+			sender.progress = data.Timestamp
+		}
+		sender.next = end
+	}
+
+	if !data.ACK {
+		return events, nil
+	}
+
+	// The segment acknowledges the data of the other direction, and advertises the window it may send
+	receiver, ok := conn.senders[dst]
+	if !ok {
+		receiver = &tcpSender{receiver: src, next: data.Ack, acked: data.Ack, progress: data.Timestamp}
+		conn.senders[dst] = receiver
+	}
+	moved := false
+	if seqAfter(data.Ack, receiver.acked) {
+		receiver.acked, moved = data.Ack, true
+		if seqAfter(data.Ack, receiver.next) {
+			// Segments of the sender were not captured
+			receiver.next = data.Ack
+		}
+	}
+
+	switch {
+	case data.Window == 0 && !data.SYN && receiver.closed.IsZero():
+		receiver.closed = data.Timestamp
+		receiver.zeroWindows++
+		if receiver.zeroWindows >= s.zeroWindows {
+			event := newEvent(config.StallAnalyzer, stallZeroWindow, data, false)
+			event.Attributes[stallSender] = dst
+			event.Attributes[stallReceiver] = src
+			event.Attributes[stallZeroWindows] = strconv.FormatUint(uint64(receiver.zeroWindows), 10)
+			events = append(events, event)
+		}
+	case data.Window != 0 && !receiver.closed.IsZero():
+		receiver.closed, moved = time.Time{}, true
+	}
+
+	if !moved {
+		return events, nil
+	}
+	receiver.progress = data.Timestamp
+
+	// A sender held up by a zero window resumes once it opens
+	if receiver.stalled.IsZero() || !receiver.closed.IsZero() {
+		return events, nil
+	}
+
+	event := newEvent(config.StallAnalyzer, stallResumed, data, false)
+	event.Attributes[stallSender] = dst
+	event.Attributes[stallReceiver] = src
+	event.Attributes[stallDuration] = strconv.FormatInt(int64(data.Timestamp.Sub(receiver.stalled)), 10)
+	receiver.stalled = time.Time{}
+
+	return append(events, event), nil
+}
+
+// sweep returns the events of the senders without progress for the stall timeout at the capture time of the packet,
+// and forgets the connections idle for long. Connections are checked at most once per second.
+func (s *stallAnalyzer) sweep(data *capture.PacketMsg) []*Event {
+	if data.Timestamp.Sub(s.swept) < time.Second {
+		return nil
+	}
+	s.swept = data.Timestamp
+
+	var events []*Event
+	for key, conn := range s.connections {
+		for src, sender := range conn.senders {
+			if !sender.stalled.IsZero() {
+				continue
+			}
+
+			since, reason := sender.progress, stallUnacknowledged
+			if !sender.closed.IsZero() {
+				since, reason = sender.closed, stallClosedWindow
+			} else if sender.next == sender.acked {
+				continue
+			}
+			if data.Timestamp.Sub(since) < s.timeout {
+				continue
+			}
+			sender.stalled = since
+
+			event := newEvent(config.StallAnalyzer, stallStalled, data, false)
+			event.Attributes[stallSender] = src
+			event.Attributes[stallReceiver] = sender.receiver
+			event.Attributes[stallReason] = reason
+			event.Attributes[stallDuration] = strconv.FormatInt(int64(data.Timestamp.Sub(since)), 10)
+			events = append(events, event)
+		}
+
+		if data.Timestamp.Sub(conn.seen) >= stallIdleTimeout {
+			delete(s.connections, key)
+		}
+	}
+
+	return events
+}
@@ -0,0 +1,290 @@
+package analysis
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"strings"
+)
+
+const (
+	// Types of TLS events
+	tlsClientHello = "client_hello"
+	tlsServerHello = "server_hello"
+
+	// Attributes of ServerHello events
+	tlsVersion   = "version"   // Version the server negotiated, e.g. TLS 1.2
+	tlsCipher    = "cipher"    // Cipher suite the server negotiated, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+	tlsServer    = "server"    // Endpoint of the server, as <ip>:<port>
+	tlsClient    = "client"    // Address of the client
+	tlsViolation = "violation" // What of the handshake violates the policy, version, cipher or both comma separated. Absent if it complies.
+
+	// Parts of a handshake a policy may forbid
+	tlsVersionViolation = "version"
+	tlsCipherViolation  = "cipher"
+
+	// TLS protocol values
+	tlsRecordHandshake    = 0x16
+	tlsClientHelloType    = 0x01
+	tlsServerHelloType    = 0x02
+	tlsServerNameExt      = 0x0000
+	tlsSupportedVersions  = 0x002b
+	tlsHostNameType       = 0x00
+	tlsRecordHeaderLength = 5
+)
+
+var errTLSTruncated = errors.New("truncated TLS handshake message")
+
+// Names of the versions of SSL and TLS, by value on the wire
+var tlsVersions = map[uint16]string{
+	0x0300: "SSL 3.0",
+	0x0301: "TLS 1.0",
+	0x0302: "TLS 1.1",
+	0x0303: "TLS 1.2",
+	0x0304: "TLS 1.3",
+}
+
+// tlsAnalyzer interprets TLS ClientHello messages, reporting the server name clients indicate, and ServerHello
+// messages, reporting the version and cipher suite servers negotiate and whether they violate the policy
+type tlsAnalyzer struct {
+	policy     bool     // Whether handshakes are checked against the policy
+	minVersion uint16   // Oldest version servers may negotiate
+	ciphers    []string // Forbidden cipher suites, as parts of their names, upper cased
+}
+
+// newTLSAnalyzer returns a TLS analyzer, checking handshakes against the policy if enabled
+func newTLSAnalyzer(parameters *config.Parameters) (Analyzer, error) {
+	t := &tlsAnalyzer{
+		policy:     parameters.TLSPolicy.Enabled,
+		minVersion: 0,
+		ciphers:    make([]string, 0, len(parameters.TLSPolicy.Ciphers)),
+	}
+	if !t.policy {
+		return t, nil
+	}
+
+	var err error
+	if t.minVersion, err = ParseTLSVersion(parameters.TLSPolicy.MinVersion); err != nil {
+		return nil, err
+	}
+	for _, cipher := range parameters.TLSPolicy.Ciphers {
+		t.ciphers = append(t.ciphers, strings.ToUpper(cipher))
+	}
+
+	return t, nil
+}
+
+// ParseTLSVersion returns the value on the wire of a TLS version given as 1.0, 1.1, 1.2 or 1.3, 0 if empty
+func ParseTLSVersion(version string) (uint16, error) {
+	if version == "" {
+		return 0, nil
+	}
+	for value, name := range tlsVersions {
+		if name == "TLS "+version {
+			return value, nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid TLS version %q", version)
+}
+
+// Name returns the name of the TLS analyzer
+func (t *tlsAnalyzer) Name() string {
+	return config.TLSAnalyzer
+}
+
+// tcpPayload returns the payload of the packet's TCP segment, or nil if it has none
+func tcpPayload(data *capture.PacketMsg) []byte {
+	if data.Protocol != "tcp" {
+		return nil
+	}
+	return data.Payload
+}
+
+// Match tells whether the TCP payload starts with a handshake record holding a ClientHello or a ServerHello
+func (t *tlsAnalyzer) Match(data *capture.PacketMsg) bool {
+	payload := tcpPayload(data)
+	return len(payload) > tlsRecordHeaderLength &&
+		payload[0] == tlsRecordHandshake &&
+		(payload[tlsRecordHeaderLength] == tlsClientHelloType || payload[tlsRecordHeaderLength] == tlsServerHelloType)
+}
+
+// Process returns a ClientHello event, whose host is the indicated server name if any, or a ServerHello event
+func (t *tlsAnalyzer) Process(data *capture.PacketMsg) ([]*Event, error) {
+	hello := tcpPayload(data)[tlsRecordHeaderLength:]
+	if hello[0] == tlsServerHelloType {
+		return t.processServerHello(data, hello)
+	}
+
+	serverName, err := parseServerName(hello)
+	if err != nil {
+		return nil, err
+	}
+
+	event := newEvent(config.TLSAnalyzer, tlsClientHello, data, false)
+	event.Host = serverName
+	return []*Event{event}, nil
+}
+
+// processServerHello returns a ServerHello event, telling the version and cipher suite the server negotiated, and what
+// of them violates the policy
+func (t *tlsAnalyzer) processServerHello(data *capture.PacketMsg, hello []byte) ([]*Event, error) {
+	version, cipher, err := parseServerHello(hello)
+	if err != nil {
+		return nil, err
+	}
+
+	event := newEvent(config.TLSAnalyzer, tlsServerHello, data, false)
+	event.Attributes[tlsVersion] = tlsVersions[version]
+	if event.Attributes[tlsVersion] == "" {
+		event.Attributes[tlsVersion] = fmt.Sprintf("0x%04X", version)
+	}
+	event.Attributes[tlsCipher] = tls.CipherSuiteName(cipher)
+	event.Attributes[tlsServer] = endpoint(data.SrcIP, data.SrcPort)
+	event.Attributes[tlsClient] = data.DstIP
+
+	if t.policy {
+		var violations []string
+		if version < t.minVersion {
+			violations = append(violations, tlsVersionViolation)
+		}
+		for _, forbidden := range t.ciphers {
+			if strings.Contains(strings.ToUpper(event.Attributes[tlsCipher]), forbidden) {
+				violations = append(violations, tlsCipherViolation)
+				break
+			}
+		}
+		if len(violations) > 0 {
+			event.Attributes[tlsViolation] = strings.Join(violations, ",")
+		}
+	}
+
+	return []*Event{event}, nil
+}
+
+// skipVector skips a vector whose length is encoded on lengthSize bytes at the start of b, and returns what follows it
+func skipVector(b []byte, lengthSize int) ([]byte, error) {
+	if len(b) < lengthSize {
+		return nil, errTLSTruncated
+	}
+
+	var length int
+	for _, c := range b[:lengthSize] {
+		length = length<<8 | int(c)
+	}
+
+	if len(b) < lengthSize+length {
+		return nil, errTLSTruncated
+	}
+
+	return b[lengthSize+length:], nil
+}
+
+// parseServerName extracts the host name of the Server Name Indication extension from a ClientHello handshake message.
+// It returns an empty string if the extension is absent, and an error if the message is truncated, e.g. when it
+// spans multiple segments.
+func parseServerName(hello []byte) (string, error) {
+	// Handshake type (1), length (3), client version (2) and random (32)
+	const fixedLength = 1 + 3 + 2 + 32
+	if len(hello) < fixedLength {
+		return "", errTLSTruncated
+	}
+	b := hello[fixedLength:]
+
+	// Session ID, cipher suites and compression methods
+	var err error
+	for _, lengthSize := range []int{1, 2, 1} {
+		if b, err = skipVector(b, lengthSize); err != nil {
+			return "", err
+		}
+	}
+
+	// No extensions
+	if len(b) < 2 {
+		return "", nil
+	}
+	extensions := b[2:]
+	if length := int(binary.BigEndian.Uint16(b)); length < len(extensions) {
+		extensions = extensions[:length]
+	}
+
+	for len(extensions) >= 4 {
+		extType := binary.BigEndian.Uint16(extensions)
+		extLength := int(binary.BigEndian.Uint16(extensions[2:]))
+		if len(extensions) < 4+extLength {
+			return "", errTLSTruncated
+		}
+		ext := extensions[4 : 4+extLength]
+		extensions = extensions[4+extLength:]
+
+		if extType != tlsServerNameExt {
+			continue
+		}
+
+		// Server name list length (2), then entries of name type (1) and name length (2)
+		if len(ext) < 2 {
+			return "", errTLSTruncated
+		}
+		for list := ext[2:]; len(list) >= 3; {
+			nameType := list[0]
+			nameLength := int(binary.BigEndian.Uint16(list[1:]))
+			if len(list) < 3+nameLength {
+				return "", errTLSTruncated
+			}
+			if nameType == tlsHostNameType {
+				return string(list[3 : 3+nameLength]), nil
+			}
+			list = list[3+nameLength:]
+		}
+	}
+
+	return "", nil
+}
+
+// parseServerHello extracts the version and the cipher suite the server negotiated from a ServerHello handshake message.
+// The version is that of the Supported Versions extension if present, as TLS 1.3 servers tell it there.
+func parseServerHello(hello []byte) (version uint16, cipher uint16, err error) {
+	// Handshake type (1), length (3), server version (2) and random (32)
+	const fixedLength = 1 + 3 + 2 + 32
+	if len(hello) < fixedLength {
+		return 0, 0, errTLSTruncated
+	}
+	version = binary.BigEndian.Uint16(hello[4:])
+
+	// Session ID, then cipher suite (2) and compression method (1)
+	b, err := skipVector(hello[fixedLength:], 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(b) < 3 {
+		return 0, 0, errTLSTruncated
+	}
+	cipher = binary.BigEndian.Uint16(b)
+	b = b[3:]
+
+	// No extensions
+	if len(b) < 2 {
+		return version, cipher, nil
+	}
+	extensions := b[2:]
+	if length := int(binary.BigEndian.Uint16(b)); length < len(extensions) {
+		extensions = extensions[:length]
+	}
+
+	for len(extensions) >= 4 {
+		extType := binary.BigEndian.Uint16(extensions)
+		extLength := int(binary.BigEndian.Uint16(extensions[2:]))
+		if len(extensions) < 4+extLength {
+			return version, cipher, nil
+		}
+		if extType == tlsSupportedVersions && extLength == 2 {
+			return binary.BigEndian.Uint16(extensions[4:]), cipher, nil
+		}
+		extensions = extensions[4+extLength:]
+	}
+
+	return version, cipher, nil
+}
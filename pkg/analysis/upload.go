@@ -0,0 +1,147 @@
+package analysis
+
+import (
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/inventory"
+	"net"
+	"strings"
+	"time"
+)
+
+// uploadTracker sums the bytes internal hosts send to each external destination over the last report windows of the
+// upload span, from the flows of reports
+type uploadTracker struct {
+	span     time.Duration
+	internal []*net.IPNet    // Networks of internal hosts
+	allowed  []*net.IPNet    // Destinations left out, e.g. backup targets
+	windows  []uploadWindow  // Uploads of the report windows within the span, oldest first
+	parsed   map[string]bool // Whether addresses are internal, cached across windows
+}
+
+// uploadWindow holds the bytes internal hosts sent to external destinations during a report window
+type uploadWindow struct {
+	end   time.Time
+	bytes map[string]uint64 // Bytes sent, keyed as "<host> -> <destination>"
+}
+
+// Bounds the cache of addresses known to be internal or not, past which it is emptied
+const maxUploadAddresses = 65536
+
+// newUploadTracker returns a tracker of the uploads configured, whose networks are checked
+func newUploadTracker(uploads *config.UploadConfig) (*uploadTracker, error) {
+	// Internal hosts are those of private and link-local networks unless told otherwise, as for the inventory
+	internal, err := inventory.ParseNetworks(nil)
+	if len(uploads.Internal) > 0 {
+		internal, err = ParseAddresses(uploads.Internal)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := ParseAddresses(uploads.Allowed)
+	if err != nil {
+		return nil, err
+	}
+
+	return &uploadTracker{
+		span:     uploads.Span,
+		internal: internal,
+		allowed:  allowed,
+		windows:  nil,
+		parsed:   make(map[string]bool),
+	}, nil
+}
+
+// ParseAddresses parses IP addresses and networks in CIDR notation, addresses being returned as networks of their own
+func ParseAddresses(addresses []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(addresses))
+	for _, address := range addresses {
+		if !strings.Contains(address, "/") {
+			ip := net.ParseIP(address)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", address)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network : %s", err)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// add accounts the bytes internal hosts sent to external destinations in the flows of the report, and returns those
+// sent over the span up to it, by host and destination. Traffic to allowed destinations is left out.
+func (u *uploadTracker) add(report *Report) map[string]uint64 {
+	window := uploadWindow{end: report.Timestamp, bytes: make(map[string]uint64)}
+	for _, flow := range report.Flows {
+		srcInternal, dstInternal := u.isInternal(flow.SrcIP), u.isInternal(flow.DstIP)
+		switch {
+		case srcInternal && !dstInternal && !u.isAllowed(flow.DstIP):
+			window.bytes[flow.SrcIP+" -> "+flow.DstIP] += flow.SrcBytes
+		case dstInternal && !srcInternal && !u.isAllowed(flow.SrcIP):
+			window.bytes[flow.DstIP+" -> "+flow.SrcIP] += flow.DstBytes
+		}
+	}
+
+	// Windows that ended a span or more before this one are out of it
+	u.windows = append(u.windows, window)
+	for len(u.windows) > 0 && window.end.Sub(u.windows[0].end) >= u.span {
+		u.windows = u.windows[1:]
+	}
+
+	uploads := make(map[string]uint64)
+	for _, w := range u.windows {
+		for pair, bytes := range w.bytes {
+			uploads[pair] += bytes
+		}
+	}
+
+	return uploads
+}
+
+// isInternal tells whether the address belongs to an internal network
+func (u *uploadTracker) isInternal(address string) bool {
+	internal, ok := u.parsed[address]
+	if ok {
+		return internal
+	}
+
+	if len(u.parsed) >= maxUploadAddresses {
+		u.parsed = make(map[string]bool)
+	}
+	internal = containsIP(u.internal, net.ParseIP(address))
+	u.parsed[address] = internal
+
+	return internal
+}
+
+// isAllowed tells whether uploads to the address are allowed
+func (u *uploadTracker) isAllowed(address string) bool {
+	return containsIP(u.allowed, net.ParseIP(address))
+}
+
+// containsIP tells whether the address belongs to one of the networks
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,63 @@
+package analysis
+
+import (
+	"strings"
+)
+
+// Families of User-Agent headers that match none of the known ones, and of requests without any
+const (
+	agentOther = "other"
+	agentNone  = "none"
+)
+
+// userAgentFamily is a family of User-Agent headers, told by a token they contain
+type userAgentFamily struct {
+	token  string // Lower case token the headers of the family contain
+	family string
+}
+
+// Known families of User-Agent headers, in the order they are looked for : crawlers and tools first, as they often
+// mimic browsers, then browsers, whose headers name those they derive from after their own.
+var userAgentFamilies = []userAgentFamily{
+	{token: "googlebot", family: "Googlebot"},
+	{token: "bingbot", family: "Bingbot"},
+	{token: "bot", family: "Bot"},
+	{token: "spider", family: "Bot"},
+	{token: "crawler", family: "Bot"},
+	{token: "curl/", family: "curl"},
+	{token: "wget/", family: "Wget"},
+	{token: "python-requests/", family: "Python"},
+	{token: "python-urllib/", family: "Python"},
+	{token: "aiohttp/", family: "Python"},
+	{token: "go-http-client/", family: "Go"},
+	{token: "okhttp/", family: "OkHttp"},
+	{token: "apache-httpclient/", family: "Java"},
+	{token: "java/", family: "Java"},
+	{token: "libwww-perl/", family: "Perl"},
+	{token: "postmanruntime/", family: "Postman"},
+	{token: "edg/", family: "Edge"},
+	{token: "edge/", family: "Edge"},
+	{token: "opr/", family: "Opera"},
+	{token: "firefox/", family: "Firefox"},
+	{token: "chrome/", family: "Chrome"},
+	{token: "chromium/", family: "Chrome"},
+	{token: "safari/", family: "Safari"},
+	{token: "msie ", family: "Internet Explorer"},
+	{token: "trident/", family: "Internet Explorer"},
+}
+
+// agentFamily returns the family of the User-Agent header, e.g. Firefox or curl
+func agentFamily(userAgent string) string {
+	if userAgent == "" {
+		return agentNone
+	}
+
+	lower := strings.ToLower(userAgent)
+	for _, f := range userAgentFamilies {
+		if strings.Contains(lower, f.token) {
+			return f.family
+		}
+	}
+
+	return agentOther
+}
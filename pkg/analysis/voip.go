@@ -0,0 +1,469 @@
+package analysis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Types of VoIP events
+	voipInvite = "invite" // A call is offered
+	voipAnswer = "answer" // A call is answered
+	voipBye    = "bye"    // A call is hung up
+	voipMedia  = "media"  // RTP packets of a call received since the last sample of its stream
+
+	// Attributes of VoIP events
+	voipCall     = "call"     // Call-ID of the call
+	voipFrom     = "from"     // Address of the caller, as user@domain
+	voipTo       = "to"       // Address of the callee, as user@domain
+	voipCodec    = "codec"    // Codec of the RTP packets, e.g. PCMU or opus
+	voipExpected = "expected" // RTP packets expected since the last sample, as told by their sequence numbers
+	voipReceived = "received" // RTP packets received since the last sample
+	voipJitter   = "jitter"   // Interarrival jitter of the stream, in nanoseconds
+
+	// Port SIP messages are exchanged on
+	sipPort = 5060
+
+	// RTP values
+	rtpHeaderLength = 12
+	rtpVersion      = 2
+	rtpCSRCMask     = 0x0f
+	rtpExtension    = 0x10
+	rtpTypeMask     = 0x7f
+	rtcpFirstType   = 72 // Payload types from 72 to 76 are those of RTCP packets, sent on the port above that of RTP
+	rtcpLastType    = 76
+	rtpSeqMod       = 1 << 16
+
+	// Bounds of the calls followed, past which those idle for the timeout are forgotten, and new ones are ignored if
+	// none is. Media samples are sent at most once per interval for each stream.
+	maxVoIPCalls        = 1024
+	voipIdleTimeout     = 2 * time.Minute
+	voipSampleInterval  = time.Second
+	rtpDefaultClockRate = 8000
+)
+
+// Codecs of static RTP payload types, with their clock rates
+var rtpStaticTypes = map[uint8]rtpCodec{
+	0:  {name: "PCMU", rate: 8000},
+	3:  {name: "GSM", rate: 8000},
+	4:  {name: "G723", rate: 8000},
+	8:  {name: "PCMA", rate: 8000},
+	9:  {name: "G722", rate: 8000},
+	18: {name: "G729", rate: 8000},
+}
+
+// Methods SIP requests may start with
+var sipMethods = []string{"INVITE ", "ACK ", "BYE ", "CANCEL ", "OPTIONS ", "REGISTER ", "PRACK ", "UPDATE ",
+	"INFO ", "SUBSCRIBE ", "NOTIFY ", "REFER ", "MESSAGE "}
+
+var errSIPMalformed = errors.New("malformed SIP message")
+
+// voipAnalyzer interprets SIP signalling, to follow calls and the RTP streams their session descriptions announce.
+// RTP packets of followed streams are sampled into the packets received and lost, and the interarrival jitter, of
+// their call.
+type voipAnalyzer struct {
+	calls map[string]*sipCall   // Calls followed, by Call-ID
+	media map[string]*rtpStream // Streams announced by session descriptions, by receiving endpoint as <ip>:<port>
+}
+
+// sipCall is a call followed from its signalling
+type sipCall struct {
+	id     string
+	from   string
+	to     string
+	codecs map[uint8]rtpCodec // Codecs offered and answered, by RTP payload type
+	seen   time.Time          // Capture timestamp of the last packet of the call
+}
+
+// rtpCodec is a codec carried over RTP, with the clock rate of its timestamps
+type rtpCodec struct {
+	name string
+	rate uint32
+}
+
+// rtpStream is the RTP stream received on an endpoint of a call, whose sequence numbers and timestamps estimate losses
+// and jitter as RFC 3550 does
+type rtpStream struct {
+	call     *sipCall
+	started  bool
+	ssrc     uint32
+	maxSeq   uint16
+	cycles   uint32    // Wraps of the sequence numbers, times 2^16
+	baseSeq  uint32    // First sequence number of the stream
+	received uint32    // Packets received since the start of the stream
+	transit  float64   // Relative transit time of the last packet, in timestamp units
+	jitter   float64   // Interarrival jitter, in timestamp units
+	rate     uint32    // Clock rate of the last packet
+	codec    string    // Codec of the last packet
+	sampled  time.Time // Capture timestamp of the last sample
+	expected uint32    // Packets expected at the last sample
+	counted  uint32    // Packets received at the last sample
+}
+
+// newVoIPAnalyzer returns a VoIP analyzer
+func newVoIPAnalyzer(parameters *config.Parameters) (Analyzer, error) {
+	return &voipAnalyzer{
+		calls: make(map[string]*sipCall),
+		media: make(map[string]*rtpStream),
+	}, nil
+}
+
+// Name returns the name of the VoIP analyzer
+func (v *voipAnalyzer) Name() string {
+	return config.VoIPAnalyzer
+}
+
+// isSIP tells whether the packet is exchanged with the SIP port and its payload starts like a SIP message
+func isSIP(data *capture.PacketMsg) bool {
+	if data.SrcPort != sipPort && data.DstPort != sipPort {
+		return false
+	}
+
+	payload := data.Payload
+	if bytes.HasPrefix(payload, []byte("SIP/2.0 ")) {
+		return true
+	}
+	for _, method := range sipMethods {
+		if bytes.HasPrefix(payload, []byte(method)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Match tells whether the packet carries a SIP message, or is a UDP datagram sent to the endpoint of a followed stream
+func (v *voipAnalyzer) Match(data *capture.PacketMsg) bool {
+	if data.Protocol == "" || len(data.Payload) == 0 {
+		return false
+	}
+	if isSIP(data) {
+		return true
+	}
+
+	return data.Protocol == "udp" && len(v.media) > 0 && v.media[endpoint(data.DstIP, data.DstPort)] != nil
+}
+
+// Process returns the events of a SIP message, or the media sample of an RTP packet if one is due
+func (v *voipAnalyzer) Process(data *capture.PacketMsg) ([]*Event, error) {
+	if isSIP(data) {
+		return v.signal(data)
+	}
+
+	stream := v.media[endpoint(data.DstIP, data.DstPort)]
+	if stream == nil {
+		return nil, nil
+	}
+
+	return stream.packet(data), nil
+}
+
+// sipMessage is a SIP request or response, of which only what follows calls is kept
+type sipMessage struct {
+	method string // Method of a request, or of the request a response answers, as told by its CSeq header
+	status int    // Status code of a response, 0 for requests
+	callID string
+	from   string
+	to     string
+	body   []byte // Session description, if any
+}
+
+// parseSIP parses the start line, the headers following calls and the body of a SIP message. Compact header names are
+// understood.
+func parseSIP(payload []byte) (*sipMessage, error) {
+	head, body := payload, []byte(nil)
+	if idx := bytes.Index(payload, []byte("\r\n\r\n")); idx >= 0 {
+		head, body = payload[:idx], payload[idx+4:]
+	}
+
+	lines := strings.Split(string(head), "\r\n")
+	msg := &sipMessage{}
+
+	start := strings.Fields(lines[0])
+	if len(start) < 2 {
+		return nil, errSIPMalformed
+	}
+	if start[0] == "SIP/2.0" {
+		status, err := strconv.Atoi(start[1])
+		if err != nil {
+			return nil, errSIPMalformed
+		}
+		msg.status = status
+	} else {
+		msg.method = start[0]
+	}
+
+	for _, line := range lines[1:] {
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 {
+			continue
+		}
+		value := strings.TrimSpace(line[colon+1:])
+		switch strings.ToLower(strings.TrimSpace(line[:colon])) {
+		case "call-id", "i":
+			msg.callID = value
+		case "from", "f":
+			msg.from = sipAddress(value)
+		case "to", "t":
+			msg.to = sipAddress(value)
+		case "cseq":
+			if fields := strings.Fields(value); len(fields) == 2 && msg.status != 0 {
+				msg.method = fields[1]
+			}
+		}
+	}
+	if msg.callID == "" {
+		return nil, errSIPMalformed
+	}
+
+	if len(body) > 0 {
+		msg.body = body
+	}
+
+	return msg, nil
+}
+
+// sipAddress returns the user@domain of the URI of a From or To header, e.g. alice@example.com for
+// "Alice" <sip:alice@example.com>;tag=1928301774
+func sipAddress(value string) string {
+	if start := strings.IndexByte(value, '<'); start >= 0 {
+		if end := strings.IndexByte(value[start:], '>'); end >= 0 {
+			value = value[start+1 : start+end]
+		}
+	} else if semicolon := strings.IndexByte(value, ';'); semicolon >= 0 {
+		value = value[:semicolon]
+	}
+	if semicolon := strings.IndexByte(value, ';'); semicolon >= 0 {
+		value = value[:semicolon]
+	}
+
+	value = strings.TrimPrefix(strings.TrimPrefix(value, "sips:"), "sip:")
+	return strings.TrimSpace(value)
+}
+
+// signal follows the call of a SIP message, returning the events of invitations, answers and hang ups. Session
+// descriptions of invitations and answers announce the endpoints of the streams of the call.
+func (v *voipAnalyzer) signal(data *capture.PacketMsg) ([]*Event, error) {
+	msg, err := parseSIP(data.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	call, ok := v.calls[msg.callID]
+	if !ok {
+		// Only invitations start following calls
+		if msg.method != "INVITE" || msg.status != 0 {
+			return nil, nil
+		}
+		if len(v.calls) >= maxVoIPCalls {
+			v.expire(data.Timestamp)
+			if len(v.calls) >= maxVoIPCalls {
+				return nil, nil
+			}
+		}
+		call = &sipCall{id: msg.callID, from: msg.from, to: msg.to, codecs: make(map[uint8]rtpCodec), seen: data.Timestamp}
+		v.calls[msg.callID] = call
+	}
+	call.seen = data.Timestamp
+
+	if msg.body != nil {
+		v.describe(call, msg.body, data.SrcIP)
+	}
+
+	switch {
+	case msg.method == "INVITE" && msg.status == 0:
+		return []*Event{callEvent(data, voipInvite, call)}, nil
+	case msg.method == "INVITE" && msg.status >= 200 && msg.status < 300:
+		return []*Event{callEvent(data, voipAnswer, call)}, nil
+	case msg.method == "BYE" && msg.status == 0:
+		v.hangUp(call)
+		return []*Event{callEvent(data, voipBye, call)}, nil
+	case msg.method == "INVITE" && msg.status >= 300:
+		// Calls rejected or unanswered end without media
+		v.hangUp(call)
+	}
+
+	return nil, nil
+}
+
+// describe learns the codecs and the receiving endpoints of the streams of the session description of the call. The
+// address of the connection data defaults to that of the sender.
+func (v *voipAnalyzer) describe(call *sipCall, sdp []byte, sender string) {
+	session := sender
+	media := ""
+	for _, line := range strings.Split(string(sdp), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "c="):
+			// c=IN IP4 192.0.2.10
+			if fields := strings.Fields(line[2:]); len(fields) == 3 {
+				if media == "" {
+					session = fields[2]
+				} else {
+					v.follow(call, fields[2], media)
+				}
+			}
+		case strings.HasPrefix(line, "m="):
+			// m=audio 49170 RTP/AVP 0 8 101
+			fields := strings.Fields(line[2:])
+			if len(fields) < 3 || !strings.HasPrefix(fields[2], "RTP/") {
+				media = ""
+				continue
+			}
+			media = fields[1]
+			v.follow(call, session, media)
+			for _, pt := range fields[3:] {
+				if t, err := strconv.Atoi(pt); err == nil {
+					if codec, ok := rtpStaticTypes[uint8(t)]; ok {
+						call.codecs[uint8(t)] = codec
+					}
+				}
+			}
+		case strings.HasPrefix(line, "a=rtpmap:"):
+			// a=rtpmap:111 opus/48000/2
+			fields := strings.Fields(line[len("a=rtpmap:"):])
+			if len(fields) != 2 {
+				continue
+			}
+			t, err := strconv.Atoi(fields[0])
+			encoding := strings.Split(fields[1], "/")
+			if err != nil || t < 0 || t > rtpTypeMask || len(encoding) < 2 {
+				continue
+			}
+			rate, err := strconv.ParseUint(encoding[1], 10, 32)
+			if err != nil || rate == 0 {
+				continue
+			}
+			call.codecs[uint8(t)] = rtpCodec{name: encoding[0], rate: uint32(rate)}
+		}
+	}
+}
+
+// follow attributes the RTP stream received on the endpoint to the call. Port 0 declines a stream.
+func (v *voipAnalyzer) follow(call *sipCall, ip, port string) {
+	if port == "0" {
+		return
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return
+	}
+
+	key := endpoint(ip, uint16(p))
+	if stream, ok := v.media[key]; ok && stream.call == call {
+		return
+	}
+	v.media[key] = &rtpStream{call: call}
+}
+
+// hangUp stops following the call and its streams
+func (v *voipAnalyzer) hangUp(call *sipCall) {
+	delete(v.calls, call.id)
+	for key, stream := range v.media {
+		if stream.call == call {
+			delete(v.media, key)
+		}
+	}
+}
+
+// expire forgets the calls idle for the timeout at t, and their streams
+func (v *voipAnalyzer) expire(t time.Time) {
+	for _, call := range v.calls {
+		if t.Sub(call.seen) >= voipIdleTimeout {
+			v.hangUp(call)
+		}
+	}
+}
+
+// callEvent returns an event of the signalling of the call
+func callEvent(data *capture.PacketMsg, eventType string, call *sipCall) *Event {
+	event := newEvent(config.VoIPAnalyzer, eventType, data, false)
+	if at := strings.LastIndexByte(call.to, '@'); at >= 0 {
+		event.Host = call.to[at+1:]
+	}
+	event.Attributes[voipCall] = call.id
+	event.Attributes[voipFrom] = call.from
+	event.Attributes[voipTo] = call.to
+
+	return event
+}
+
+// packet accounts an RTP packet of the stream, returning the media sample of the stream if one is due
+func (s *rtpStream) packet(data *capture.PacketMsg) []*Event {
+	payload := data.Payload
+	if len(payload) < rtpHeaderLength || payload[0]>>6 != rtpVersion {
+		return nil
+	}
+	pt := payload[1] & rtpTypeMask
+	if pt >= rtcpFirstType && pt <= rtcpLastType {
+		return nil
+	}
+	seq := binary.BigEndian.Uint16(payload[2:])
+	timestamp := binary.BigEndian.Uint32(payload[4:])
+	ssrc := binary.BigEndian.Uint32(payload[8:])
+
+	codec, ok := s.call.codecs[pt]
+	if !ok {
+		codec = rtpCodec{name: strconv.Itoa(int(pt)), rate: rtpDefaultClockRate}
+	}
+	s.call.seen = data.Timestamp
+
+	// A new source restarts the stream
+	if !s.started || ssrc != s.ssrc {
+		*s = rtpStream{call: s.call, started: true, ssrc: ssrc, maxSeq: seq, baseSeq: uint32(seq), sampled: data.Timestamp}
+	} else if delta := seq - s.maxSeq; delta < rtpSeqMod/2 {
+		// In order, possibly with a gap. Older packets are late or duplicated, and only counted.
+		if seq < s.maxSeq {
+			s.cycles += rtpSeqMod
+		}
+		s.maxSeq = seq
+	}
+	s.received++
+
+	// Jitter as of RFC 3550, from the difference of relative transit times of consecutive packets. The clock rate
+	// changing with the codec resets it.
+	arrival := float64(data.Timestamp.UnixNano()) * float64(codec.rate) / float64(time.Second)
+	transit := arrival - float64(timestamp)
+	if s.received > 1 && s.rate == codec.rate {
+		d := transit - s.transit
+		if d < 0 {
+			d = -d
+		}
+		s.jitter += (d - s.jitter) / 16
+	} else if s.rate != codec.rate {
+		s.jitter = 0
+	}
+	s.transit, s.rate, s.codec = transit, codec.rate, codec.name
+
+	if data.Timestamp.Sub(s.sampled) < voipSampleInterval {
+		return nil
+	}
+
+	return []*Event{s.sample(data)}
+}
+
+// sample returns the event of the packets expected and received since the last sample of the stream, with its current
+// jitter
+func (s *rtpStream) sample(data *capture.PacketMsg) *Event {
+	expected := s.cycles + uint32(s.maxSeq) - s.baseSeq + 1
+
+	event := newEvent(config.VoIPAnalyzer, voipMedia, data, false)
+	event.Attributes[voipCall] = s.call.id
+	event.Attributes[voipFrom] = s.call.from
+	event.Attributes[voipTo] = s.call.to
+	event.Attributes[voipCodec] = s.codec
+	event.Attributes[voipExpected] = strconv.FormatUint(uint64(expected-s.expected), 10)
+	event.Attributes[voipReceived] = strconv.FormatUint(uint64(s.received-s.counted), 10)
+	jitter := time.Duration(s.jitter * float64(time.Second) / float64(s.rate))
+	event.Attributes[voipJitter] = strconv.FormatInt(int64(jitter), 10)
+
+	s.sampled, s.expected, s.counted = data.Timestamp, expected, s.received
+
+	return event
+}
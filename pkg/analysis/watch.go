@@ -0,0 +1,201 @@
+package analysis
+
+import (
+	"github.com/bytemare/gonetmon/pkg/config"
+	"net"
+	"sync"
+	"time"
+)
+
+// Period after which the addresses of watched hostnames are resolved again
+const watchResolveInterval = 5 * time.Minute
+
+// WatchStats holds the traffic of a watched target over a report window
+type WatchStats struct {
+	Target       string        // Target as configured, as host, host:port or :port
+	Packets      uint          // Packets sent to and by the target
+	Bytes        uint64        // Bytes sent to and by the target
+	Flows        int           // Flows of the target
+	Connections  int           // TCP connections opened to the target
+	Established  int           // Connections to the target it answered with a SYN-ACK
+	Refused      int           // Connections to the target it reset without a SYN-ACK
+	Unanswered   int           // Connections to the target it sent nothing back to
+	Handshake    time.Duration // Mean time the target took to answer connections with a SYN-ACK, 0 if none was timed
+	MaxHandshake time.Duration // Longest time the target took to answer a connection with a SYN-ACK
+	Silent       time.Duration // Time since traffic of the target was last seen, or since the first report, 0 if seen during the window
+	Unreachable  bool          // Whether connections to the target failed since it last answered one
+}
+
+// watchTracker accounts the traffic of the watched targets in the flows of reports, and follows their silence and
+// reachability across reports
+type watchTracker struct {
+	targets []*watchTarget
+
+	// Guards the addresses of targets, resolved again in the background
+	mutex     sync.Mutex
+	resolved  time.Time // Time hostnames were last resolved
+	resolving bool      // Whether hostnames are being resolved
+}
+
+// watchTarget is a watched host or service, and its state across reports
+type watchTarget struct {
+	name        string          // Target as configured
+	host        string          // Address or hostname, empty for a port on any host
+	port        uint16          // Port, 0 for any port of the host
+	addresses   map[string]bool // Addresses of the host
+	active      time.Time       // Timestamp of the last report with traffic of the target, or of the first report
+	unreachable bool
+}
+
+// newWatchTracker returns a tracker of the watched targets, whose hostnames are resolved
+func newWatchTracker(watch *config.WatchConfig) (*watchTracker, error) {
+	w := &watchTracker{
+		targets:   make([]*watchTarget, 0, len(watch.Targets)),
+		mutex:     sync.Mutex{},
+		resolved:  time.Time{},
+		resolving: false,
+	}
+	for _, name := range watch.Targets {
+		host, port, err := config.SplitTarget(name)
+		if err != nil {
+			return nil, err
+		}
+		w.targets = append(w.targets, &watchTarget{
+			name:        name,
+			host:        host,
+			port:        port,
+			addresses:   nil,
+			active:      time.Time{},
+			unreachable: false,
+		})
+	}
+	w.resolve()
+
+	return w, nil
+}
+
+// resolve looks the addresses of the hosts of targets up. Hosts that cannot be resolved keep their previous addresses.
+func (w *watchTracker) resolve() {
+	addresses := make([]map[string]bool, len(w.targets))
+	for i, target := range w.targets {
+		if target.host == "" {
+			continue
+		}
+		if ip := net.ParseIP(target.host); ip != nil {
+			addresses[i] = map[string]bool{ip.String(): true}
+			continue
+		}
+
+		resolved, err := net.LookupHost(target.host)
+		if err != nil {
+			log.Warn("Could not resolve watched host ", target.host, " : ", err)
+			continue
+		}
+		addresses[i] = make(map[string]bool, len(resolved))
+		for _, address := range resolved {
+			addresses[i][address] = true
+		}
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for i, target := range w.targets {
+		if addresses[i] != nil {
+			target.addresses = addresses[i]
+		}
+	}
+	w.resolved = time.Now()
+	w.resolving = false
+}
+
+// add returns the traffic of each watched target in the flows of the report, in the order they were configured.
+// Hostnames are resolved again in the background once their addresses are old.
+func (w *watchTracker) add(report *Report) []WatchStats {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if !w.resolving && time.Since(w.resolved) >= watchResolveInterval {
+		w.resolving = true
+		go w.resolve()
+	}
+
+	stats := make([]WatchStats, 0, len(w.targets))
+	for _, target := range w.targets {
+		s := WatchStats{Target: target.name}
+		var timed time.Duration
+		var handshakes int
+		for _, flow := range report.Flows {
+			src, dst := target.matches(flow.SrcIP, flow.SrcPort), target.matches(flow.DstIP, flow.DstPort)
+			if !src && !dst {
+				continue
+			}
+			s.Flows++
+			s.Packets += flow.SrcPkts + flow.DstPkts
+			s.Bytes += flow.SrcBytes + flow.DstBytes
+
+			// Connections are those opened to the target during the window
+			if !dst || flow.Protocol != "tcp" || !flow.SrcFlags.Has(FlagSYN) {
+				continue
+			}
+			s.Connections++
+			switch {
+			case flow.DstFlags.Has(FlagSYN):
+				s.Established++
+			case flow.DstFlags.Has(FlagRST):
+				s.Refused++
+			case flow.DstPkts == 0:
+				s.Unanswered++
+			}
+			if flow.Handshake > 0 {
+				timed += flow.Handshake
+				handshakes++
+				if flow.Handshake > s.MaxHandshake {
+					s.MaxHandshake = flow.Handshake
+				}
+			}
+		}
+		if handshakes > 0 {
+			s.Handshake = timed / time.Duration(handshakes)
+		}
+
+		if s.Flows > 0 || target.active.IsZero() {
+			target.active = report.Timestamp
+		}
+		s.Silent = report.Timestamp.Sub(target.active)
+
+		// Targets stay unreachable until they answer a connection, whatever the windows without any
+		switch {
+		case s.Established > 0:
+			target.unreachable = false
+		case s.Refused+s.Unanswered > 0:
+			target.unreachable = true
+		}
+		s.Unreachable = target.unreachable
+
+		stats = append(stats, s)
+	}
+
+	return stats
+}
+
+// matches tells whether the endpoint is the target's
+func (t *watchTarget) matches(address string, port uint16) bool {
+	if t.port != 0 && port != t.port {
+		return false
+	}
+
+	return t.host == "" || t.addresses[address]
+}
+
+// WatchLevels returns the times since traffic of the watched targets was last seen, and whether they are unreachable,
+// by target
+func (r *Report) WatchLevels() (map[string]time.Duration, map[string]bool) {
+	silent := make(map[string]time.Duration, len(r.Watched))
+	unreachable := make(map[string]bool, len(r.Watched))
+	for _, s := range r.Watched {
+		silent[s.Target] = s.Silent
+		unreachable[s.Target] = s.Unreachable
+	}
+
+	return silent, unreachable
+}
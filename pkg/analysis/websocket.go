@@ -0,0 +1,98 @@
+package analysis
+
+import (
+	"encoding/binary"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"net"
+	"strconv"
+	"time"
+)
+
+// WebSocket frame values
+const (
+	wsFinal         = 0x80
+	wsOpcodeMask    = 0x0f
+	wsClose         = 0x8
+	wsMasked        = 0x80
+	wsLengthMask    = 0x7f
+	wsLength16      = 126
+	wsLength64      = 127
+	wsMaskLength    = 4
+	wsMaxDataOpcode = 0x2 // Continuation, text and binary frames carry messages, others control the connection
+)
+
+// wsStream is a TCP stream upgraded to the WebSocket protocol, whose frames are followed in both directions to count
+// the messages they carry. Frames are told apart by their lengths, so a lost segment may leave a direction out of sync
+// until the end of the stream.
+type wsStream struct {
+	host   string    // Host header of the request that opened the stream
+	client string    // Endpoint of the client, as <ip>:<port>
+	skip   [2]uint64 // Bytes of frames still to come, from the client and from the server
+	seen   time.Time // Capture timestamp of the last packet of the stream
+}
+
+// endpoint returns the source endpoint of the packet, as <ip>:<port>
+func endpoint(ip string, port uint16) string {
+	return net.JoinHostPort(ip, strconv.Itoa(int(port)))
+}
+
+// direction returns 0 for packets of the client of the stream, and 1 for those of the server
+func direction(client string, data *capture.PacketMsg) int {
+	if endpoint(data.SrcIP, data.SrcPort) == client {
+		return 0
+	}
+	return 1
+}
+
+// frames returns the number of messages whose final frame starts in the payload of the packet, and whether a frame
+// closes the stream
+func (s *wsStream) frames(data *capture.PacketMsg) (messages int, closed bool) {
+	s.seen = data.Timestamp
+	dir := direction(s.client, data)
+
+	payload := data.Payload
+	for len(payload) > 0 {
+		if s.skip[dir] > 0 {
+			n := s.skip[dir]
+			if n > uint64(len(payload)) {
+				n = uint64(len(payload))
+			}
+			payload = payload[n:]
+			s.skip[dir] -= n
+			continue
+		}
+
+		// Headers split across segments are not followed
+		if len(payload) < 2 {
+			break
+		}
+		header, length := 2, uint64(payload[1]&wsLengthMask)
+		switch length {
+		case wsLength16:
+			if len(payload) < 4 {
+				return messages, closed
+			}
+			header, length = 4, uint64(binary.BigEndian.Uint16(payload[2:]))
+		case wsLength64:
+			if len(payload) < 10 {
+				return messages, closed
+			}
+			header, length = 10, binary.BigEndian.Uint64(payload[2:])
+		}
+		if payload[1]&wsMasked != 0 {
+			header += wsMaskLength
+		}
+
+		opcode := payload[0] & wsOpcodeMask
+		if opcode == wsClose {
+			closed = true
+		}
+		if payload[0]&wsFinal != 0 && opcode <= wsMaxDataOpcode {
+			messages++
+		}
+
+		s.skip[dir] = uint64(header) + length
+	}
+
+	return messages, closed
+}
@@ -0,0 +1,13 @@
+package capture
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// pinToCPU restricts the calling thread to the given CPU
+func pinToCPU(cpu int) error {
+	var set unix.CPUSet
+	set.Set(cpu)
+
+	return unix.SchedSetaffinity(0, &set)
+}
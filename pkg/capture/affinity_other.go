@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package capture
+
+import (
+	"errors"
+)
+
+// pinToCPU fails, as pinning threads to CPUs is only supported on Linux
+func pinToCPU(cpu int) error {
+	return errors.New("pinning capture to CPUs is only supported on linux")
+}
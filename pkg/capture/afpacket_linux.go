@@ -0,0 +1,161 @@
+package capture
+
+import (
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/afpacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"golang.org/x/net/bpf"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Period after which a blocked read returns, for the source to be closed without waiting for traffic
+const afpacketPollTimeout = 500 * time.Millisecond
+
+// afpacketSource is a CaptureSource reading from a memory mapped AF_PACKET socket, avoiding libpcap's copies
+type afpacketSource struct {
+	handle  *afpacket.TPacket
+	snapLen int32      // Capture length BPF filters are compiled for
+	mutex   sync.Mutex // Held while reading, for the socket not to be closed under a read
+	closed  bool
+}
+
+// openAFPacketSource opens an AF_PACKET socket on the named interface, filtered by the BPF filter
+func openAFPacketSource(device string, capture *config.CaptureConfig, filter string) (CaptureSource, error) {
+	handle, err := afpacket.NewTPacket(afpacket.OptInterface(device), afpacket.OptPollTimeout(afpacketPollTimeout))
+	if err != nil {
+		return nil, err
+	}
+
+	if filter != "" {
+		if err := setAFPacketFilter(handle, capture.SnapshotLen, filter); err != nil {
+			handle.Close()
+			return nil, err
+		}
+	}
+
+	s := &afpacketSource{
+		handle:  handle,
+		snapLen: capture.SnapshotLen,
+		mutex:   sync.Mutex{},
+		closed:  false,
+	}
+
+	return s, nil
+}
+
+// setAFPacketFilter compiles the BPF filter with libpcap and attaches it to the socket
+func setAFPacketFilter(handle *afpacket.TPacket, snapLen int32, filter string) error {
+	instructions, err := pcap.CompileBPFFilter(layers.LinkTypeEthernet, int(snapLen), filter)
+	if err != nil {
+		return err
+	}
+
+	raw := make([]bpf.RawInstruction, len(instructions))
+	for i, ins := range instructions {
+		raw[i] = bpf.RawInstruction{Op: ins.Code, Jt: ins.Jt, Jf: ins.Jf, K: ins.K}
+	}
+
+	return handle.SetBPF(raw)
+}
+
+// ZeroCopyReadPacketData reads the next packet from the socket, whose data is a frame of the memory mapped ring
+func (s *afpacketSource) ZeroCopyReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return nil, gopacket.CaptureInfo{}, io.EOF
+	}
+
+	data, ci, err := s.handle.ZeroCopyReadPacketData()
+	if err == afpacket.ErrTimeout {
+		err = ErrReadTimeout
+	}
+
+	return data, ci, err
+}
+
+// LinkType returns the link type of the socket, which captures Ethernet frames
+func (s *afpacketSource) LinkType() layers.LinkType {
+	return layers.LinkTypeEthernet
+}
+
+// Stats returns the counters of the socket
+func (s *afpacketSource) Stats() (CaptureStats, error) {
+	stats, _, err := s.handle.SocketStats()
+	if err != nil {
+		return CaptureStats{}, err
+	}
+
+	return CaptureStats{
+		Received: uint64(stats.Packets()),
+		Dropped:  uint64(stats.Drops()),
+	}, nil
+}
+
+// SetFilter compiles the BPF filter and replaces the one attached to the socket
+func (s *afpacketSource) SetFilter(filter string) error {
+	return setAFPacketFilter(s.handle, s.snapLen, filter)
+}
+
+// Close closes the socket once the pending read returns, after which reads return io.EOF
+func (s *afpacketSource) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		s.handle.Close()
+	}
+
+	return nil
+}
+
+// Modes of fanout groups, by name
+var fanoutModes = map[string]afpacket.FanoutType{
+	config.HashFanout:        afpacket.FanoutHash,
+	config.LoadBalanceFanout: afpacket.FanoutLoadBalance,
+	config.CPUFanout:         afpacket.FanoutCPU,
+}
+
+// openAFPacketFanout opens the sockets of a fanout group sharing the traffic of the interface. If one of them cannot
+// be opened, those already opened are closed.
+func openAFPacketFanout(device net.Interface, capture *config.CaptureConfig, fanout config.FanoutConfig, filter string) ([]CaptureSource, error) {
+	mode, ok := fanoutModes[fanout.Mode]
+	if !ok {
+		return nil, fmt.Errorf("unknown fanout mode : %s", fanout.Mode)
+	}
+
+	// Group identifiers are shared by all processes in the network namespace
+	id := uint16(os.Getpid()) + uint16(device.Index)
+
+	sources := make([]CaptureSource, 0, fanout.Sockets)
+	closeAll := func() {
+		for _, source := range sources {
+			_ = source.Close()
+		}
+	}
+
+	for i := 0; i < fanout.Sockets; i++ {
+		source, err := openAFPacketSource(device.Name, capture, filter)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		sources = append(sources, source)
+
+		if err := source.(*afpacketSource).handle.SetFanout(mode, id); err != nil {
+			closeAll()
+			return nil, fmt.Errorf("could not join fanout group : %s", err)
+		}
+	}
+
+	return sources, nil
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package capture
+
+import (
+	"errors"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"net"
+)
+
+// openAFPacketSource fails, as AF_PACKET sockets only exist on Linux
+func openAFPacketSource(device string, capture *config.CaptureConfig, filter string) (CaptureSource, error) {
+	return nil, errors.New("the afpacket capture source is only supported on linux")
+}
+
+// openAFPacketFanout fails, as AF_PACKET sockets only exist on Linux
+func openAFPacketFanout(device net.Interface, capture *config.CaptureConfig, fanout config.FanoutConfig, filter string) ([]CaptureSource, error) {
+	return nil, errors.New("the afpacket capture source is only supported on linux")
+}
@@ -0,0 +1,240 @@
+package capture
+
+import (
+	"fmt"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"sort"
+	"strings"
+)
+
+// Link types BPF filters can be compiled for, by name
+var linkTypes = map[string]layers.LinkType{
+	"ethernet":  layers.LinkTypeEthernet,
+	"raw":       layers.LinkTypeRaw,
+	"linux-sll": layers.LinkTypeLinuxSLL,
+	"null":      layers.LinkTypeNull,
+}
+
+// Operators of BPF filter expressions, which cannot end a complete expression
+var filterOperators = map[string]bool{
+	"and": true, "or": true, "not": true, "&&": true, "||": true, "!": true, "(": true,
+}
+
+// LinkTypeNames returns the names of the link types filters can be compiled for, sorted
+func LinkTypeNames() []string {
+	names := make([]string, 0, len(linkTypes))
+	for name := range linkTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// ParseLinkType returns the link type called name
+func ParseLinkType(name string) (layers.LinkType, error) {
+	linkType, ok := linkTypes[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown link type %q, expected one of %s", name, strings.Join(LinkTypeNames(), ", "))
+	}
+
+	return linkType, nil
+}
+
+// CompileFilter compiles the BPF filter for the link type, returning its instructions
+func CompileFilter(filter string, linkType layers.LinkType, snapLen int32) ([]pcap.BPFInstruction, error) {
+	return pcap.CompileBPFFilter(linkType, int(snapLen), filter)
+}
+
+// filterToken is a word of a BPF filter expression, and its offset in the expression
+type filterToken struct {
+	text   string
+	offset int
+}
+
+// tokenizeFilter splits a BPF filter expression on white space and parentheses
+func tokenizeFilter(filter string) []filterToken {
+	var tokens []filterToken
+
+	start := -1
+	for i, r := range filter {
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '(' || r == ')':
+			if start >= 0 {
+				tokens = append(tokens, filterToken{text: filter[start:i], offset: start})
+				start = -1
+			}
+			if r == '(' || r == ')' {
+				tokens = append(tokens, filterToken{text: string(r), offset: i})
+			}
+		case start < 0:
+			start = i
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, filterToken{text: filter[start:], offset: start})
+	}
+
+	return tokens
+}
+
+// FilterErrorOffset locates the error of a BPF filter that does not compile, as libpcap does not tell where it is.
+// It returns the offset of the first word following the longest beginning of the expression that compiles, operators
+// aside, or the length of the expression if it is only incomplete.
+func FilterErrorOffset(filter string, linkType layers.LinkType, snapLen int32) int {
+	tokens := tokenizeFilter(filter)
+
+	valid := 0 // Number of tokens of the longest prefix that compiles
+	for n := 1; n <= len(tokens); n++ {
+		if filterOperators[tokens[n-1].text] {
+			continue
+		}
+		end := tokens[n-1].offset + len(tokens[n-1].text)
+		if _, err := CompileFilter(filter[:end], linkType, snapLen); err == nil {
+			valid = n
+		}
+	}
+
+	// Operators are only wrong if nothing follows them
+	for i := valid; i < len(tokens); i++ {
+		if !filterOperators[tokens[i].text] {
+			return tokens[i].offset
+		}
+	}
+
+	return len(filter)
+}
+
+// BPF instruction classes, sizes, modes and operations, as in linux/filter.h
+const (
+	bpfLD   = 0x00
+	bpfLDX  = 0x01
+	bpfST   = 0x02
+	bpfSTX  = 0x03
+	bpfALU  = 0x04
+	bpfJMP  = 0x05
+	bpfRET  = 0x06
+	bpfMISC = 0x07
+
+	bpfW = 0x00
+	bpfH = 0x08
+	bpfB = 0x10
+
+	bpfIMM = 0x00
+	bpfABS = 0x20
+	bpfIND = 0x40
+	bpfMEM = 0x60
+	bpfLEN = 0x80
+	bpfMSH = 0xa0
+
+	bpfK = 0x00
+	bpfX = 0x08
+	bpfA = 0x10
+
+	bpfNEG = 0x80
+	bpfJA  = 0x00
+	bpfTXA = 0x80
+)
+
+// Suffixes of load mnemonics, and mnemonics of ALU and jump operations, by code
+var (
+	loadSizes     = map[uint16]string{bpfW: "", bpfH: "h", bpfB: "b"}
+	aluOperations = map[uint16]string{
+		0x00: "add", 0x10: "sub", 0x20: "mul", 0x30: "div", 0x40: "or", 0x50: "and", 0x60: "lsh", 0x70: "rsh",
+		0x80: "neg", 0x90: "mod", 0xa0: "xor",
+	}
+	jumpOperations = map[uint16]string{
+		0x00: "ja", 0x10: "jeq", 0x20: "jgt", 0x30: "jge", 0x40: "jset",
+	}
+)
+
+// Disassemble returns the instructions of a compiled BPF filter, one per line, in the format of tcpdump -d
+func Disassemble(instructions []pcap.BPFInstruction) []string {
+	lines := make([]string, len(instructions))
+	for pc, ins := range instructions {
+		op, operand, jumps := disassemble(pc, ins)
+		line := fmt.Sprintf("(%03d) %-8s %-16s %s", pc, op, operand, jumps)
+		lines[pc] = strings.TrimRight(line, " ")
+	}
+
+	return lines
+}
+
+// disassemble returns the mnemonic, operand and jump targets of the instruction at pc
+func disassemble(pc int, ins pcap.BPFInstruction) (string, string, string) {
+	code := ins.Code
+
+	switch code & 0x07 {
+	case bpfLD:
+		op := "ld" + loadSizes[code&0x18]
+		switch code & 0xe0 {
+		case bpfIMM:
+			return op, fmt.Sprintf("#0x%x", ins.K), ""
+		case bpfABS:
+			return op, fmt.Sprintf("[%d]", ins.K), ""
+		case bpfIND:
+			return op, fmt.Sprintf("[x + %d]", ins.K), ""
+		case bpfMEM:
+			return op, fmt.Sprintf("M[%d]", ins.K), ""
+		case bpfLEN:
+			return op, "#pktlen", ""
+		}
+	case bpfLDX:
+		switch code & 0xe0 {
+		case bpfIMM:
+			return "ldx", fmt.Sprintf("#0x%x", ins.K), ""
+		case bpfMEM:
+			return "ldx", fmt.Sprintf("M[%d]", ins.K), ""
+		case bpfLEN:
+			return "ldx", "#pktlen", ""
+		case bpfMSH:
+			return "ldxb", fmt.Sprintf("4*([%d]&0xf)", ins.K), ""
+		}
+	case bpfST:
+		return "st", fmt.Sprintf("M[%d]", ins.K), ""
+	case bpfSTX:
+		return "stx", fmt.Sprintf("M[%d]", ins.K), ""
+	case bpfALU:
+		op, ok := aluOperations[code&0xf0]
+		if !ok {
+			break
+		}
+		if code&0xf0 == bpfNEG {
+			return op, "", ""
+		}
+		if code&0x08 == bpfX {
+			return op, "x", ""
+		}
+		return op, fmt.Sprintf("#0x%x", ins.K), ""
+	case bpfJMP:
+		op, ok := jumpOperations[code&0xf0]
+		if !ok {
+			break
+		}
+		if code&0xf0 == bpfJA {
+			return op, fmt.Sprintf("%d", pc+1+int(ins.K)), ""
+		}
+		jumps := fmt.Sprintf("jt %d\tjf %d", pc+1+int(ins.Jt), pc+1+int(ins.Jf))
+		if code&0x08 == bpfX {
+			return op, "x", jumps
+		}
+		return op, fmt.Sprintf("#0x%x", ins.K), jumps
+	case bpfRET:
+		switch code & 0x18 {
+		case bpfK:
+			return "ret", fmt.Sprintf("#%d", ins.K), ""
+		case bpfX:
+			return "ret", "x", ""
+		case bpfA:
+			return "ret", "a", ""
+		}
+	case bpfMISC:
+		if code&0xf8 == bpfTXA {
+			return "txa", "", ""
+		}
+		return "tax", "", ""
+	}
+
+	return "unimp", fmt.Sprintf("0x%x", code), ""
+}
@@ -0,0 +1,953 @@
+// Package capture reads packets from capture sources, such as network interfaces, and sends the relevant ones to analysis
+package capture
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/diagnostics"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var log = config.Logger
+
+// Throughput of capture, published by the diagnostics server
+var (
+	capturedPackets  = diagnostics.NewCounter("capture.packets")   // Packets read from capture sources
+	forwardedPackets = diagnostics.NewCounter("capture.forwarded") // Packets sent to analysis
+)
+
+// Packets analysis cannot use, published by the diagnostics server
+var (
+	nonIPPackets       = diagnostics.NewCounter("capture.non_ip")      // Packets without an IP layer, e.g. ARP or LLDP
+	undecodablePackets = diagnostics.NewCounter("capture.undecodable") // Truncated or malformed packets
+)
+
+// device is a capture source along with the name and local IP address of the interface it captures on
+type device struct {
+	name     string
+	socket   int // Index of the source in the fanout group of the interface, 0 without fanout
+	cpu      int // CPU the source is read on, -1 if reads are not pinned
+	ip       string
+	source   CaptureSource
+	liveness *liveness
+	access   *access
+	decoder  *decoder             // Decodes the packets read from the source, under access
+	dropped  *diagnostics.Counter // Packets of the interface dropped by the backpressure policy
+	intf     *pcapgo.NgInterface  // Description of the interface, for sources not describing that of each packet
+}
+
+// access serialises the reads of a capture source with its closing, as the data of a zero-copy read is only valid
+// until the source is closed
+type access struct {
+	mutex  sync.Mutex
+	closed bool
+	unsent uint64 // Packets read since the last one sent to analysis
+}
+
+// liveness tracks whether a capture source is read from, updated atomically by its capture goroutine
+type liveness struct {
+	capturing  int32 // 1 while packets are read from the source, i.e. it is open and not exhausted
+	lastPacket int64 // Time the last packet was read at, in nanoseconds since the epoch. 0 if none yet.
+}
+
+// DeviceHealth is the liveness of a capture source
+type DeviceHealth struct {
+	Name       string
+	Capturing  bool      // Whether packets are read from the source, i.e. it is open and not exhausted
+	LastPacket time.Time // Time the last packet was read at, zero if none yet
+	Dropped    uint64    // Number of packets dropped by the backpressure policy
+}
+
+// Devices holds the capture sources to collect packets from, and the filters and state of the collection.
+// Filters and state may be changed while collecting.
+type Devices struct {
+	devices []device
+	mutex   sync.RWMutex
+	filter  config.Filter // Filters of captured packets
+	paused  bool          // Whether captured packets are dropped instead of sent to analysis
+
+	policy       string        // Backpressure policy applied when analysis falls behind
+	batchSize    int           // Maximum number of packets sent to analysis at once
+	batchTimeout time.Duration // Maximum time a packet waits for its batch to fill
+	keepData     bool          // Whether packets are sent to analysis along with a copy of their data
+	snapLen      int32         // Snapshot length of sources, to compile network filters
+
+	// Detection of broadcast and multicast storms, whose frames sources let through the network filter if enabled.
+	// Those the network filter would have dropped are told by matching them against it, compiled by link type.
+	storms   config.StormConfig
+	matchers map[layers.LinkType]*pcap.BPF
+
+	// Watch of ARP packets, which sources let through the network filter, and analysis receives whatever their payload,
+	// if enabled
+	arp config.ARPConfig
+
+	// Watched targets, whose traffic sources let through the network filter, and analysis receives whatever its
+	// payload. Packets are told to be of targets by matching them against their filter, compiled by link type.
+	watch    config.WatchConfig
+	watchers map[layers.LinkType]*pcap.BPF
+
+	// Integrity checks of packets, corrupt ones being counted by analysis whatever their payload
+	integrity config.IntegrityConfig
+
+	// Sources read to their end, e.g. capture files, closing exhausted once all of them are
+	ended     int32
+	exhausted chan struct{}
+}
+
+// NewDevices returns an empty set of capture sources, to be filled with Add. Sources are expected to apply the
+// network filter themselves, and the application filter is applied to the packets they capture.
+// Packets are sent to analysis in batches, with the backpressure policy set in capture.
+func NewDevices(filter config.Filter, capture *config.CaptureConfig) (*Devices, error) {
+	switch capture.Backpressure {
+	case config.BlockPolicy, config.DropNewestPolicy, config.DropOldestPolicy:
+	default:
+		return nil, fmt.Errorf("unknown backpressure policy : %s", capture.Backpressure)
+	}
+
+	if capture.BatchSize <= 0 {
+		return nil, errors.New("the capture batch size must be positive")
+	}
+	if capture.BatchTimeout <= 0 {
+		return nil, errors.New("the capture batch timeout must be positive")
+	}
+
+	return &Devices{
+		devices:      []device{},
+		mutex:        sync.RWMutex{},
+		filter:       filter,
+		paused:       false,
+		policy:       capture.Backpressure,
+		batchSize:    capture.BatchSize,
+		batchTimeout: capture.BatchTimeout,
+		keepData:     false,
+		snapLen:      capture.SnapshotLen,
+		storms:       config.StormConfig{},
+		matchers:     make(map[layers.LinkType]*pcap.BPF),
+		arp:          config.ARPConfig{},
+		watch:        config.WatchConfig{},
+		watchers:     make(map[layers.LinkType]*pcap.BPF),
+		integrity:    config.IntegrityConfig{},
+		ended:        0,
+		exhausted:    make(chan struct{}),
+	}, nil
+}
+
+// Exhausted returns a channel closed once all sources were read to their end, e.g. the files of a replay, or stopped on
+// a read error, and their last packets were sent to analysis. Live sources are only exhausted if they all failed.
+func (d *Devices) Exhausted() <-chan struct{} {
+	return d.exhausted
+}
+
+// exhaust records that a source was read to its end or stopped on an error, and closes exhausted once all of them did
+func (d *Devices) exhaust() {
+	if int(atomic.AddInt32(&d.ended, 1)) == len(d.devices) {
+		close(d.exhausted)
+	}
+}
+
+// Add registers a capture source under the given interface name. ip is the local address of the interface,
+// used to tell the remote peer of captured packets, and may be empty for sources not bound to an interface.
+func (d *Devices) Add(name, ip string, source CaptureSource) {
+	d.add(name, 0, -1, ip, source)
+}
+
+// add registers a capture source of the interface's fanout group, read on the given CPU if not negative
+func (d *Devices) add(name string, socket, cpu int, ip string, source CaptureSource) {
+	dev := device{
+		name:     name,
+		socket:   socket,
+		cpu:      cpu,
+		ip:       ip,
+		source:   source,
+		liveness: &liveness{capturing: 0, lastPacket: 0},
+		access:   &access{mutex: sync.Mutex{}, closed: false, unsent: 0},
+		decoder:  newDecoder(d.integrity.Checksums),
+		dropped:  nil,
+		intf:     nil,
+	}
+	dev.dropped = diagnostics.LookupCounter("capture.dropped." + dev.label())
+	dev.intf = describeDevice(name, ip, source.LinkType())
+
+	d.devices = append(d.devices, dev)
+}
+
+// label returns the name of the interface, suffixed with the index of the source in its fanout group after the first
+func (dev device) label() string {
+	if dev.socket == 0 {
+		return dev.name
+	}
+
+	return fmt.Sprintf("%s#%d", dev.name, dev.socket)
+}
+
+// Filter returns the filters of captured packets
+func (d *Devices) Filter() config.Filter {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return d.filter
+}
+
+// SetFilter replaces the filters of captured packets. A new network filter is first compiled for the link type of each
+// source, which must implement FilterSetter, then set on all of them. If that still fails on one of them, those
+// already changed are set back to the previous filter.
+func (d *Devices) SetFilter(filter config.Filter) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if filter.Network != d.filter.Network {
+		if err := d.checkFilter(d.widen(filter.Network)); err != nil {
+			return err
+		}
+
+		for index, dev := range d.devices {
+			err := setFilter(dev, d.widen(filter.Network))
+			if err == nil {
+				continue
+			}
+
+			for _, changed := range d.devices[:index] {
+				if err := setFilter(changed, d.widen(d.filter.Network)); err != nil {
+					log.WithFields(logrus.Fields{
+						"interface": changed.label(),
+						"error":     err,
+					}).Error("Could not restore previous filter.")
+				}
+			}
+
+			return err
+		}
+	}
+
+	log.WithFields(logrus.Fields{
+		"network":     filter.Network,
+		"application": filter.Application,
+	}).Info("Changed capture filters.")
+
+	d.filter = filter
+	d.matchers = make(map[layers.LinkType]*pcap.BPF)
+
+	return nil
+}
+
+// widen returns the network filter widened to the broadcast and multicast frames of storms, and to ARP packets, if
+// they are detected, and to the traffic of watched targets
+func (d *Devices) widen(network string) string {
+	return d.watch.Filter(d.arp.Filter(d.storms.Filter(network)))
+}
+
+// checkFilter tells whether the network filter can be set on all sources, without changing their filter
+func (d *Devices) checkFilter(filter string) error {
+	checked := make(map[layers.LinkType]bool)
+	for _, dev := range d.devices {
+		if _, ok := dev.source.(FilterSetter); !ok {
+			return fmt.Errorf("the capture source of %s does not support changing filters", dev.label())
+		}
+
+		linkType := dev.source.LinkType()
+		if checked[linkType] {
+			continue
+		}
+		if err := compileFilter(filter, linkType, d.snapLen); err != nil {
+			return fmt.Errorf("%s on %s", err, dev.label())
+		}
+		checked[linkType] = true
+	}
+
+	return nil
+}
+
+// setFilter sets the network filter on the device's source
+func setFilter(dev device, filter string) error {
+	setter, ok := dev.source.(FilterSetter)
+	if !ok {
+		return fmt.Errorf("the capture source of %s does not support changing filters", dev.label())
+	}
+
+	if err := setter.SetFilter(filter); err != nil {
+		return fmt.Errorf("could not set filter on %s : %s", dev.label(), err)
+	}
+
+	return nil
+}
+
+// Pause drops captured packets until Resume is called, instead of sending them to analysis
+func (d *Devices) Pause() {
+	d.mutex.Lock()
+	d.paused = true
+	d.mutex.Unlock()
+
+	log.Info("Capture paused.")
+}
+
+// Resume sends captured packets to analysis again
+func (d *Devices) Resume() {
+	d.mutex.Lock()
+	d.paused = false
+	d.mutex.Unlock()
+
+	log.Info("Capture resumed.")
+}
+
+// Paused tells whether captured packets are dropped
+func (d *Devices) Paused() bool {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return d.paused
+}
+
+// Stats returns the counters of the sources keeping any, indexed by interface name
+func (d *Devices) Stats() map[string]CaptureStats {
+	stats := make(map[string]CaptureStats, len(d.devices))
+	for _, dev := range d.devices {
+		if s, err := dev.source.Stats(); err == nil {
+			stats[dev.label()] = s
+		}
+	}
+
+	return stats
+}
+
+// Health returns the liveness of the capture sources, in the order they were added
+func (d *Devices) Health() []DeviceHealth {
+	health := make([]DeviceHealth, 0, len(d.devices))
+	for _, dev := range d.devices {
+		h := DeviceHealth{
+			Name:       dev.label(),
+			Capturing:  atomic.LoadInt32(&dev.liveness.capturing) == 1,
+			LastPacket: time.Time{},
+			Dropped:    dev.dropped.Value(),
+		}
+		if last := atomic.LoadInt64(&dev.liveness.lastPacket); last != 0 {
+			h.LastPacket = time.Unix(0, last)
+		}
+		health = append(health, h)
+	}
+
+	return health
+}
+
+// state returns the filters of captured packets, and whether they are dropped
+func (d *Devices) state() (config.Filter, bool) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return d.filter, d.paused
+}
+
+// InitialiseCapture opens the capture sources configured in parameters, filtered by the network filter.
+// For live sources, if the interfaces parameter is not nil, only open those specified.
+func InitialiseCapture(parameters *config.Parameters) (*Devices, error) {
+	capture := &parameters.CaptureConfig
+	filter := parameters.Watch.Filter(parameters.ARP.Filter(parameters.Storms.Filter(parameters.PacketFilter.Network)))
+	devs, err := NewDevices(parameters.PacketFilter, capture)
+	if err != nil {
+		return nil, err
+	}
+
+	// The flight recorder keeps the data of packets received by analysis
+	devs.keepData = parameters.FlightRecorder.Enabled
+
+	// Broadcast and multicast frames are counted by analysis whatever their payload, and ARP packets and the traffic of
+	// targets watched
+	devs.storms = parameters.Storms
+	devs.arp = parameters.ARP
+	devs.watch = parameters.Watch
+	devs.integrity = parameters.Integrity
+
+	switch capture.Source {
+	case config.FileSource:
+		source, err := openFileSource(capture.Files, filter, capture.MergeFiles, capture.ReplaySpeed)
+		if err != nil {
+			return nil, fmt.Errorf("could not open capture file : %s", err)
+		}
+
+		files := strings.Join(capture.Files, ", ")
+		if len(capture.Files) > 1 && capture.MergeFiles {
+			files += " merged by timestamp"
+		}
+		if capture.ReplaySpeed > 0 {
+			log.Info("Replaying capture files ", files, " at ", capture.ReplaySpeed, "x their original pace")
+		} else {
+			log.Info("Replaying capture files ", files, " as fast as possible")
+		}
+		devs.Add(strings.Join(capture.Files, "+"), "", source)
+		return devs, nil
+
+	case config.PcapSource, config.AFPacketSource:
+	default:
+		return nil, fmt.Errorf("unknown capture source : %s", capture.Source)
+	}
+
+	// Interfaces are found and their sockets opened in the configured namespace, where they keep capturing
+	if capture.Namespace != "" {
+		log.Info("Capturing in network namespace ", capture.Namespace)
+	}
+	if err := InNamespace(capture.Namespace, func() error {
+		return openDevices(devs, parameters.Interfaces, capture, filter)
+	}); err != nil {
+		return nil, err
+	}
+
+	return devs, nil
+}
+
+// Errors of opening live capture, telling there is nothing to capture on apart from other failures
+var (
+	ErrNoDevices      = errors.New("could not find any devices")          // No interface is up, or none of those requested exists
+	ErrNoDeviceOpened = errors.New("could not open any device interface") // Capture could not be opened on any interface found
+)
+
+// openDevices opens capture on the interfaces that are up, or on the requested ones if not nil, and adds them to devs
+func openDevices(devs *Devices, requestedInterfaces []string, capture *config.CaptureConfig, filter string) error {
+	devices := findDevices(requestedInterfaces)
+
+	if devices == nil {
+		return ErrNoDevices
+	}
+
+	for _, d := range devices {
+		// Busy interfaces may be read through several sockets
+		if fanout, ok := capture.Fanout[d.Name]; ok {
+			if err := openFanout(devs, d, capture, fanout, filter); err != nil {
+				log.WithFields(logrus.Fields{
+					"interface": d.Name,
+					"error":     err,
+				}).Error("Could not open fanout group for capture.")
+			}
+			continue
+		}
+
+		// Try to open all devices for capture
+		if source, err := openDevice(d, capture, filter); err != nil {
+			log.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("Could not open device for capture.")
+		} else {
+			devs.Add(d.Name, getDeviceIP(&d), source)
+		}
+	}
+
+	if len(devs.devices) == 0 {
+		log.Error("Could not open any device interface.")
+		return ErrNoDeviceOpened
+	}
+
+	return nil
+}
+
+// selectDevices returns an array of requested interfaces among those available in the devices argument
+func selectDevices(requestedInterfaces []string, devices []net.Interface) ([]net.Interface, error) {
+	var tailoredList []net.Interface
+interfacesLoop:
+	for _, i := range requestedInterfaces {
+
+		for index, d := range devices {
+
+			if d.Name == i {
+				tailoredList = append(tailoredList, d)
+
+				// Remove the found element from array to avoid it on next iteration
+				// Won't affect current loop since Go uses a copy
+				devices[index] = devices[len(devices)-1]
+				devices = devices[:len(devices)-1]
+
+				log.Info("Found requested interface ", i)
+
+				continue interfacesLoop
+			}
+		}
+
+		// Here, the requested interface is not in the found set
+		log.Error("Could not find requested interface among activated interfaces : ", i)
+	}
+
+	if len(tailoredList) == 0 {
+		return nil, fmt.Errorf("could not find any requested network devices among : %s", requestedInterfaces)
+	}
+
+	return tailoredList, nil
+}
+
+// findDevices gathers the list of interfaces of the machine that have their state flage UP.
+// If the interfaces parameter is not nil, only list those specified if present.
+func findDevices(requestedInterfaces []string) []net.Interface {
+	devices, err := net.Interfaces()
+
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Error in finding network devices.")
+		return nil
+	}
+
+	if len(devices) == 0 {
+		log.Error("Could not find any network devices (but no error occurred).")
+		return nil
+	}
+
+	// Purge interfaces that don't have their state flag UP
+	for index, d := range devices {
+		if d.Flags&(net.FlagUp) == 0 {
+			// Flag is down, Interface is deactivated, purge element
+			devices[index] = devices[len(devices)-1]
+			devices = devices[:len(devices)-1]
+		}
+	}
+
+	// If we want a custom list of interfaces
+	if requestedInterfaces != nil {
+		devices, err = selectDevices(requestedInterfaces, devices)
+		if err != nil {
+			log.Error(err)
+			return nil
+		}
+	}
+
+	return devices
+}
+
+// openDevice opens a live capture source on the interface designated by the device parameter, with the configured backend
+func openDevice(device net.Interface, capture *config.CaptureConfig, filter string) (CaptureSource, error) {
+	var source CaptureSource
+	var err error
+	if capture.Source == config.AFPacketSource {
+		source, err = openAFPacketSource(device.Name, capture, filter)
+	} else {
+		source, err = openLiveSource(device.Name, capture, filter)
+	}
+
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"interface": device.Name,
+			"error":     err,
+		}).Error("Could not open device.")
+
+		return nil, err
+	}
+
+	log.WithFields(logrus.Fields{
+		"interface": device.Name,
+		"source":    capture.Source,
+	}).Info("Opened device interface.")
+
+	return source, nil
+}
+
+// openFanout opens the sockets of the fanout group of the interface, and adds them to devs. If one of them cannot be
+// opened, those already opened are closed.
+func openFanout(devs *Devices, device net.Interface, capture *config.CaptureConfig, fanout config.FanoutConfig, filter string) error {
+	if capture.Source != config.AFPacketSource {
+		return fmt.Errorf("fanout requires the %s capture source", config.AFPacketSource)
+	}
+	if fanout.Sockets <= 0 {
+		return errors.New("the number of fanout sockets must be positive")
+	}
+
+	sources, err := openAFPacketFanout(device, capture, fanout, filter)
+	if err != nil {
+		return err
+	}
+
+	ip := getDeviceIP(&device)
+	for socket, source := range sources {
+		cpu := -1
+		if len(fanout.CPUs) > 0 {
+			cpu = fanout.CPUs[socket%len(fanout.CPUs)]
+		}
+		devs.add(device.Name, socket, cpu, ip, source)
+	}
+
+	log.WithFields(logrus.Fields{
+		"interface": device.Name,
+		"sockets":   fanout.Sockets,
+		"mode":      fanout.Mode,
+	}).Info("Opened fanout group.")
+
+	return nil
+}
+
+// Close closes all capture sources of devices that are not run by a Collector, which closes them once cancelled
+func (d *Devices) Close() {
+	closeDevices(d)
+}
+
+// closeDevices closes all capture sources, logging their statistics beforehand
+func closeDevices(devices *Devices) {
+	for _, dev := range devices.devices {
+		if stats, err := dev.source.Stats(); err == nil {
+			log.WithFields(logrus.Fields{
+				"interface": dev.label(),
+				"received":  stats.Received,
+				"dropped":   stats.Dropped,
+			}).Info("Capture statistics.")
+		}
+
+		log.Info("Closing device on interface ", dev.label())
+
+		// Wait for the pending read to be handled, as closing invalidates its data
+		dev.access.mutex.Lock()
+		dev.access.closed = true
+		err := dev.source.Close()
+		dev.access.mutex.Unlock()
+
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"interface": dev.label(),
+				"error":     err,
+			}).Error("Could not close device.")
+		}
+	}
+}
+
+// sniffPayload tells whether the packet has a transport payload containing the filter string
+func sniffPayload(payload []byte, filter string) bool {
+	return len(payload) > 0 && bytes.Contains(payload, []byte(filter))
+}
+
+// getRemoteIP returns the IP address of the remote peer among the source and destination addresses of a packet
+func getRemoteIP(src, dst string, deviceIP string) string {
+	var rip string
+
+	// The deviceIP is among these two, so we return the other
+	if strings.Compare(deviceIP, src) == 0 {
+		rip = dst
+	} else {
+		rip = src
+	}
+
+	return rip
+}
+
+// getDeviceIP extracts the interface's local IP address, or returns an empty string if it has none
+func getDeviceIP(device *net.Interface) string {
+	add, err := device.Addrs()
+	if err != nil || len(add) == 0 {
+		log.WithFields(logrus.Fields{
+			"interface": device.Name,
+			"error":     err,
+		}).Error("Could not extract IP from local network interface")
+		return ""
+	}
+
+	// Addresses are usually networks in the CIDR notation, but may be bare IP addresses
+	address := add[0].String()
+	if i := strings.IndexByte(address, '/'); i >= 0 {
+		address = address[:i]
+	}
+
+	return address
+}
+
+// capturePacket continuously reads packets from a device's capture source, and extracts relevant packets from traffic
+// to send them to packetChan in batches, until the source is closed or exhausted. A batch is sent once it is full, or
+// once the batch timeout expires.
+func capturePackets(ctx context.Context, dev device, devices *Devices, wg *sync.WaitGroup, packetChan chan []PacketMsg) {
+	defer wg.Done()
+
+	// A source read to its end or stopped on an error before cancellation is exhausted, once its last batch is sent
+	exhausted := false
+	defer func() {
+		if exhausted {
+			devices.exhaust()
+		}
+	}()
+
+	log.Info("Capturing packets on ", dev.label())
+
+	if dev.cpu >= 0 {
+		// Keep the goroutine on its thread, which is left pinned and ends along with the goroutine
+		runtime.LockOSThread()
+		if err := pinToCPU(dev.cpu); err != nil {
+			log.WithFields(logrus.Fields{
+				"interface": dev.label(),
+				"cpu":       dev.cpu,
+				"error":     err,
+			}).Warn("Could not pin capture to CPU.")
+		}
+	}
+
+	atomic.StoreInt32(&dev.liveness.capturing, 1)
+	defer atomic.StoreInt32(&dev.liveness.capturing, 0)
+
+	// Reads block until a packet arrives or the source times out, so batches are also flushed on a timer
+	var mutex sync.Mutex
+	batch := newBatch(devices.batchSize)
+	flush := func() {
+		if len(batch) != 0 {
+			devices.forward(ctx, dev, batch, packetChan)
+			batch = newBatch(devices.batchSize)
+		}
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(devices.batchTimeout)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				mutex.Lock()
+				flush()
+				mutex.Unlock()
+			}
+		}
+	}()
+
+	defer func() {
+		mutex.Lock()
+		flush()
+		mutex.Unlock()
+	}()
+
+	for {
+		msg, ok, err := devices.read(dev)
+		switch {
+		case err == ErrReadTimeout:
+			continue
+		case err == io.EOF:
+			log.Info("Stopping capture on ", dev.label())
+			exhausted = ctx.Err() == nil
+			return
+		case err != nil:
+			log.WithFields(logrus.Fields{
+				"interface": dev.label(),
+				"error":     err,
+			}).Error("Could not read packet, stopping capture.")
+			exhausted = ctx.Err() == nil
+			return
+		}
+
+		if ok {
+			mutex.Lock()
+			batch = append(batch, msg)
+			if len(batch) == devices.batchSize {
+				flush()
+			}
+			mutex.Unlock()
+		}
+	}
+}
+
+// read reads the next packet of dev and returns its message, with ok set to false if it is not to be sent to analysis.
+// Only the layers analysis uses are decoded, and only what the message holds is copied out of the source's buffer.
+func (d *Devices) read(dev device) (msg PacketMsg, ok bool, err error) {
+	dev.access.mutex.Lock()
+	defer dev.access.mutex.Unlock()
+
+	if dev.access.closed {
+		return PacketMsg{}, false, io.EOF
+	}
+
+	data, ci, err := dev.source.ZeroCopyReadPacketData()
+	if err != nil {
+		return PacketMsg{}, false, err
+	}
+
+	read := time.Now()
+	atomic.StoreInt64(&dev.liveness.lastPacket, read.UnixNano())
+	capturedPackets.Inc()
+	dev.access.unsent++
+
+	filter, paused := d.state()
+	if paused {
+		return PacketMsg{}, false, nil
+	}
+
+	intf := dev.intf
+	if describer, ok := dev.source.(InterfaceDescriber); ok {
+		if i := describer.Interface(ci); i != nil {
+			intf = i
+		}
+	}
+
+	msg = newPacketMsg(ci, dev.source.LinkType(), dev, intf, filter.Type, read)
+	dev.decoder.decode(&msg, data)
+	watched := (d.arp.Enabled && msg.ARP != nil) || d.matchWatch(msg.LinkType, ci, data)
+	if msg.Corrupt != "" || (d.storms.Enabled && (msg.Broadcast() || msg.Multicast())) {
+		msg.CountOnly = !watched && (!sniffPayload(msg.Payload, filter.Application) || !d.matchFilter(msg.LinkType, ci, data))
+	} else if !watched && !sniffPayload(msg.Payload, filter.Application) {
+		return PacketMsg{}, false, nil
+	}
+
+	if msg.SrcIP != "" {
+		msg.RemoteIP = getRemoteIP(msg.SrcIP, msg.DstIP, msg.DeviceIP)
+	}
+
+	// The source may reuse its buffer for the next read
+	msg.Payload = copyPayload(msg.Payload)
+	if d.keepData && !msg.CountOnly {
+		msg.Data = copyBytes(data)
+	}
+	msg.Captured, dev.access.unsent = dev.access.unsent, 0
+
+	return msg, true, nil
+}
+
+// matchFilter tells whether the packet matches the network filter, before it was widened to broadcast and multicast
+// frames. Packets are taken to match if it cannot be compiled for their link type.
+func (d *Devices) matchFilter(linkType layers.LinkType, ci gopacket.CaptureInfo, data []byte) bool {
+	d.mutex.RLock()
+	network := d.filter.Network
+	matcher, ok := d.matchers[linkType]
+	d.mutex.RUnlock()
+
+	if network == "" {
+		return true
+	}
+
+	if !ok {
+		var err error
+		if matcher, err = pcap.NewBPF(linkType, int(d.snapLen), network); err != nil {
+			log.WithFields(logrus.Fields{
+				"filter": network,
+				"error":  err,
+			}).Warn("Could not compile the network filter to tell broadcast and multicast frames it lets through.")
+			matcher = nil
+		}
+
+		d.mutex.Lock()
+		if d.filter.Network == network {
+			d.matchers[linkType] = matcher
+		}
+		d.mutex.Unlock()
+	}
+
+	return matcher == nil || matcher.Matches(ci, data)
+}
+
+// matchWatch tells whether the packet is of a watched target. Packets are taken not to be if the filter of targets
+// cannot be compiled for their link type.
+func (d *Devices) matchWatch(linkType layers.LinkType, ci gopacket.CaptureInfo, data []byte) bool {
+	if len(d.watch.Targets) == 0 {
+		return false
+	}
+
+	d.mutex.RLock()
+	matcher, ok := d.watchers[linkType]
+	d.mutex.RUnlock()
+
+	if !ok {
+		var err error
+		expression := d.watch.Expression()
+		if matcher, err = pcap.NewBPF(linkType, int(d.snapLen), expression); err != nil {
+			log.WithFields(logrus.Fields{
+				"filter": expression,
+				"error":  err,
+			}).Warn("Could not compile the filter of watched targets to tell their packets.")
+			matcher = nil
+		}
+
+		d.mutex.Lock()
+		d.watchers[linkType] = matcher
+		d.mutex.Unlock()
+	}
+
+	return matcher != nil && matcher.Matches(ci, data)
+}
+
+// forward sends a batch of packets captured on dev to analysis, applying the backpressure policy if it falls behind.
+// Batches that are not sent are released.
+func (d *Devices) forward(ctx context.Context, dev device, batch []PacketMsg, packetChan chan []PacketMsg) {
+	switch d.policy {
+	case config.DropNewestPolicy:
+		select {
+		case packetChan <- batch:
+			forwardedPackets.Add(uint64(len(batch)))
+		default:
+			dev.dropped.Add(uint64(len(batch)))
+			Release(batch)
+		}
+
+	case config.DropOldestPolicy:
+		for {
+			select {
+			case packetChan <- batch:
+				forwardedPackets.Add(uint64(len(batch)))
+				return
+			default:
+			}
+
+			// Make room by dropping the oldest batch, unless analysis just took it
+			select {
+			case oldest := <-packetChan:
+				for _, msg := range oldest {
+					d.countDrop(msg.Device, msg.Socket)
+				}
+				Release(oldest)
+			default:
+			}
+		}
+
+	default:
+		// Do not block on a stopped analysis, the source is about to be closed
+		select {
+		case packetChan <- batch:
+			forwardedPackets.Add(uint64(len(batch)))
+		case <-ctx.Done():
+			Release(batch)
+		}
+	}
+}
+
+// countDrop accounts a packet dropped by the backpressure policy on the given socket of the named interface
+func (d *Devices) countDrop(name string, socket int) {
+	for _, dev := range d.devices {
+		if dev.name == name && dev.socket == socket {
+			dev.dropped.Inc()
+			return
+		}
+	}
+}
+
+// Collector reads packets from all capture sources for relevant traffic and sends them to packetChan in batches, until
+// ctx is cancelled. If analysis falls behind, the backpressure policy of devices applies, which may receive from
+// packetChan to drop the oldest batches. packetChan is closed once all sources are exhausted.
+func Collector(ctx context.Context, devices *Devices, packetChan chan []PacketMsg) error {
+	collWG := sync.WaitGroup{}
+
+	for _, dev := range devices.devices {
+		collWG.Add(1)
+		go capturePackets(ctx, dev, devices, &collWG, packetChan)
+	}
+
+	// Wait until cancellation to stop. Once all sources are exhausted nothing more is sent, so packetChan is closed for
+	// analysis to finish with what it was sent.
+	select {
+	case <-ctx.Done():
+	case <-devices.Exhausted():
+		collWG.Wait()
+		close(packetChan)
+		<-ctx.Done()
+	}
+
+	// Inform goroutines to stop by closing their sources
+	closeDevices(devices)
+
+	// Wait for goroutines to stop
+	log.Info("Collector waiting for subs...")
+	collWG.Wait()
+	log.Info("Collector terminating")
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package capture
+
+import (
+	"context"
+	"errors"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/internal/packettest"
+	"github.com/sirupsen/logrus"
+	"testing"
+)
+
+// BenchmarkCollector measures the throughput of capture, from a MockSource of HTTP exchanges
+func BenchmarkCollector(b *testing.B) {
+	log.SetLevel(logrus.WarnLevel)
+	parameters := config.LoadParams()
+
+	packets, err := packettest.HTTPExchanges(1000)
+	if err != nil {
+		b.Fatal(err)
+	}
+	devices, err := NewDevices(parameters.PacketFilter, &parameters.CaptureConfig)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	// The source is closed for reads to end once its packets are delivered, as a capture file's would
+	source := NewMockSource(packettest.Cycle(packets, b.N))
+	_ = source.Close()
+	devices.Add("bench", "", source)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	packetChan := make(chan []PacketMsg, 16)
+	done := make(chan error, 1)
+
+	b.SetBytes(int64(packettest.Bytes(packets) / len(packets)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	go func() {
+		done <- Collector(ctx, devices, packetChan)
+	}()
+
+	// Discard batches until packetChan is closed, once the source is exhausted
+	for collected := false; !collected; {
+		select {
+		case batch, ok := <-packetChan:
+			if ok {
+				Release(batch)
+			}
+			collected = !ok
+		case err := <-done:
+			if err == nil {
+				err = errors.New("collector stopped before the source was exhausted")
+			}
+			b.Fatal(err)
+		}
+	}
+
+	b.StopTimer()
+	cancel()
+	if err := <-done; err != nil {
+		b.Fatal(err)
+	}
+}
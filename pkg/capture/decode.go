@@ -0,0 +1,191 @@
+package capture
+
+import (
+	"encoding/binary"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/sirupsen/logrus"
+)
+
+// decoder decodes the layers of captured packets analysis uses. Ethernet frames are decoded with a DecodingLayerParser
+// into preallocated layers, up to TCP or UDP over IPv4 or IPv6, which avoids allocating for each packet. Packets the
+// parser cannot take to a transport layer are fully decoded instead, unless they cannot hold traffic analyzers use.
+// A decoder is not safe for concurrent use, each capture source has its own.
+type decoder struct {
+	parser    *gopacket.DecodingLayerParser
+	decoded   []gopacket.LayerType
+	eth       layers.Ethernet
+	ip4       layers.IPv4
+	ip6       layers.IPv6
+	tcp       layers.TCP
+	udp       layers.UDP
+	checksums bool // Whether the checksums of the packets the parser decodes are verified
+}
+
+// newDecoder returns a decoder with its own layers, verifying checksums if told to
+func newDecoder(checksums bool) *decoder {
+	d := &decoder{
+		parser:    nil,
+		decoded:   make([]gopacket.LayerType, 0, 4),
+		eth:       layers.Ethernet{},
+		ip4:       layers.IPv4{},
+		ip6:       layers.IPv6{},
+		tcp:       layers.TCP{},
+		udp:       layers.UDP{},
+		checksums: checksums,
+	}
+
+	d.parser = gopacket.NewDecodingLayerParser(layers.LayerTypeEthernet, &d.eth, &d.ip4, &d.ip6, &d.tcp, &d.udp)
+
+	// Stop at the application layer, or at layers analysis does not use
+	d.parser.IgnoreUnsupported = true
+
+	return d
+}
+
+// decode sets the addresses, ports, flags and payload of the packet in data on msg. The payload is a view of data,
+// which must be copied before data is reused. Packets without an IP layer, and those that cannot be fully decoded, are
+// counted. Only the layers decoded before an error are set, if any.
+// Packets captured whole are told corrupt if they are truncated or malformed, or fail their checksums if verified.
+func (d *decoder) decode(msg *PacketMsg, data []byte) {
+	whole := len(data) >= msg.Length
+
+	// Decoders of gopacket may panic on malformed packets, which must not stop capture
+	defer func() {
+		if r := recover(); r != nil {
+			undecodablePackets.Inc()
+			msg.clearLayers()
+			if whole {
+				msg.Corrupt = Malformed
+			}
+			log.WithFields(logrus.Fields{
+				"interface": msg.Device,
+				"error":     r,
+			}).Debug("Could not decode packet.")
+		}
+	}()
+
+	if msg.LinkType == layers.LinkTypeEthernet {
+		err := d.parser.DecodeLayers(data, &d.decoded)
+
+		ipv4 := false
+		for _, layerType := range d.decoded {
+			switch layerType {
+			case layers.LayerTypeEthernet:
+				copy(msg.SrcMAC[:], d.eth.SrcMAC)
+				copy(msg.DstMAC[:], d.eth.DstMAC)
+			case layers.LayerTypeIPv4:
+				msg.setAddresses(d.ip4.SrcIP.String(), d.ip4.DstIP.String())
+				msg.TTL, msg.DSCP = d.ip4.TTL, d.ip4.TOS>>2
+				msg.setFragment4(&d.ip4)
+				ipv4 = true
+			case layers.LayerTypeIPv6:
+				msg.setAddresses(d.ip6.SrcIP.String(), d.ip6.DstIP.String())
+				msg.TTL, msg.DSCP = d.ip6.HopLimit, d.ip6.TrafficClass>>2
+			case layers.LayerTypeTCP:
+				msg.setTCP(&d.tcp)
+				if whole {
+					msg.Corrupt = d.check(msg, layers.IPProtocolTCP, d.tcp.Contents, d.tcp.Payload)
+				}
+				return
+			case layers.LayerTypeUDP:
+				msg.setUDP(&d.udp)
+				if whole {
+					// A zero checksum tells the sender did not compute it
+					header, payload := d.udp.Contents, d.udp.Payload
+					if d.udp.Checksum == 0 {
+						header, payload = nil, nil
+					}
+					msg.Corrupt = d.check(msg, layers.IPProtocolUDP, header, payload)
+				}
+				return
+			}
+		}
+
+		// IPv4 has no extension headers, so a valid IPv4 packet without TCP or UDP carries nothing analyzers use, but
+		// for ICMP. Other link and network layers, e.g. VLAN tags or IPv6 extension headers, are left to the full decode.
+		if ipv4 && err == nil && d.ip4.Protocol != layers.IPProtocolICMPv4 {
+			if whole {
+				msg.Corrupt = d.check(msg, d.ip4.Protocol, nil, nil)
+			}
+			return
+		}
+	}
+
+	msg.clearLayers()
+	packet := gopacket.NewPacket(data, msg.LinkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	msg.setPacket(packet)
+
+	switch {
+	case packet.ErrorLayer() != nil:
+		// Layers decoded before the error may still be used, e.g. the headers of a truncated segment
+		undecodablePackets.Inc()
+		if whole {
+			msg.Corrupt = Malformed
+		}
+	case msg.SrcIP == "":
+		nonIPPackets.Inc()
+	}
+	if whole && packet.Metadata().Truncated {
+		msg.Corrupt = Truncated
+	}
+}
+
+// check returns the integrity check failed by the packet the parser decoded, empty if none. The checksums of the IPv4
+// header, and of the transport header and payload if given, are verified if the decoder is told to. They are not for
+// packets sent from the interface, which checksum offloading leaves for the hardware to fill in, nor for the
+// transport of fragments.
+func (d *decoder) check(msg *PacketMsg, protocol layers.IPProtocol, header, payload []byte) string {
+	if d.parser.Truncated {
+		return Truncated
+	}
+	if !d.checksums || msg.SrcIP == msg.DeviceIP {
+		return ""
+	}
+
+	var pseudo uint32
+	if d.decoded[1] == layers.LayerTypeIPv4 {
+		if fold(sum(0, d.ip4.Contents)) != 0 {
+			return Checksum
+		}
+		if msg.Fragment != nil {
+			return ""
+		}
+		pseudo = sum(sum(0, d.ip4.SrcIP.To4()), d.ip4.DstIP.To4())
+	} else {
+		pseudo = sum(sum(0, d.ip6.SrcIP.To16()), d.ip6.DstIP.To16())
+	}
+	if header == nil {
+		return ""
+	}
+
+	length := len(header) + len(payload)
+	pseudo += uint32(protocol) + uint32(length>>16) + uint32(length&0xffff)
+	if fold(sum(sum(pseudo, header), payload)) != 0 {
+		return Checksum
+	}
+
+	return ""
+}
+
+// sum adds the 16 bits words of data to the ones' complement sum s, an odd last byte being padded with zero. Data but
+// the last given to a sum must have an even length.
+func sum(s uint32, data []byte) uint32 {
+	for ; len(data) > 1; data = data[2:] {
+		s += uint32(binary.BigEndian.Uint16(data))
+	}
+	if len(data) == 1 {
+		s += uint32(data[0]) << 8
+	}
+
+	return s
+}
+
+// fold returns the ones' complement of the ones' complement sum s, 0 for data whose checksum is right
+func fold(s uint32) uint16 {
+	for s>>16 != 0 {
+		s = s&0xffff + s>>16
+	}
+
+	return ^uint16(s)
+}
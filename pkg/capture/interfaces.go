@@ -0,0 +1,68 @@
+package capture
+
+import (
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/google/gopacket/pcap"
+	"net"
+)
+
+// Interface describes a network interface of the machine, and whether capture can be opened on it
+type Interface struct {
+	Name      string
+	Addresses []string  // Addresses of the interface, in CIDR notation
+	Flags     net.Flags // State and capabilities of the interface, e.g. up or loopback
+	LinkType  string    // Link layer type reported by libpcap, empty if capture could not be opened
+	Err       error     // Why capture could not be opened on the interface, e.g. missing privileges. Nil if it could.
+}
+
+// ListInterfaces returns the network interfaces of the machine, or of the configured network namespace, probing
+// whether capture can be opened on each of them with the configured snapshot length. Interfaces are not put in
+// promiscuous mode while probing.
+func ListInterfaces(capture *config.CaptureConfig) ([]Interface, error) {
+	var list []Interface
+	err := InNamespace(capture.Namespace, func() error {
+		var err error
+		list, err = listInterfaces(capture)
+		return err
+	})
+
+	return list, err
+}
+
+// listInterfaces returns the network interfaces of the current network namespace, probing capture on each of them
+func listInterfaces(capture *config.CaptureConfig) ([]Interface, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("could not list network interfaces : %s", err)
+	}
+
+	list := make([]Interface, 0, len(interfaces))
+	for _, i := range interfaces {
+		info := Interface{
+			Name:      i.Name,
+			Addresses: nil,
+			Flags:     i.Flags,
+			LinkType:  "",
+			Err:       nil,
+		}
+
+		if addrs, err := i.Addrs(); err == nil {
+			for _, addr := range addrs {
+				info.Addresses = append(info.Addresses, addr.String())
+			}
+		}
+
+		handle, err := pcap.OpenLive(i.Name, capture.SnapshotLen, false, capture.CaptureTimeout)
+		if err != nil {
+			info.Err = err
+		} else {
+			info.LinkType = handle.LinkType().String()
+			handle.Close()
+		}
+
+		list = append(list, info)
+	}
+
+	return list, nil
+}
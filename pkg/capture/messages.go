@@ -0,0 +1,330 @@
+package capture
+
+import (
+	"encoding/binary"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PacketMsg is a captured packet sent to analysis. Rather than the decoded packet, it holds its metadata and copies of
+// the parts analyzers use, so that queued packets retain little memory and capture buffers can be reused.
+type PacketMsg struct {
+	DataType  string          // Kind of data, for now just http packet
+	Device    string          // Interface on which the traffic was recorded
+	Socket    int             // Index of the socket the packet was read on in the fanout group of the interface, 0 without fanout
+	DeviceIP  string          // IP address of local network device interface
+	RemoteIP  string          // IP address or remote peer
+	Timestamp time.Time       // Capture timestamp of the packet
+	Length    int             // Length of the packet on the wire
+	Protocol  string          // Transport protocol, either tcp or udp, empty for other packets
+	SrcMAC    [6]byte         // Hardware address of the sender of an Ethernet frame, zero for other link types
+	DstMAC    [6]byte         // Hardware address of the destination of an Ethernet frame, zero for other link types
+	SrcIP     string          // Source IP address, empty if the packet has no network layer
+	SrcPort   uint16          // Source port, for tcp and udp
+	DstIP     string          // Destination IP address, empty if the packet has no network layer
+	DstPort   uint16          // Destination port, for tcp and udp
+	SYN       bool            // Whether the SYN flag of a TCP segment is set
+	FIN       bool            // Whether the FIN flag of a TCP segment is set
+	RST       bool            // Whether the RST flag of a TCP segment is set
+	ACK       bool            // Whether the ACK flag of a TCP segment is set
+	Seq       uint32          // Sequence number of a TCP segment, that of the first byte of its payload
+	Ack       uint32          // Acknowledgment number of a TCP segment, that of the next byte its sender expects
+	Window    uint16          // Receive window a TCP segment advertises, not scaled
+	TTL       uint8           // Time to live, or hop limit, of the IP packet, 0 without network layer
+	DSCP      uint8           // Differentiated services code point of the IP packet, its QoS marking, 0 without network layer
+	Signature *SYNSignature   // Window and options of a TCP segment with the SYN flag set, nil for other packets
+	ARP       *ARP            // Sender and target of an ARP packet, nil for other packets
+	Fragment  *Fragment       // Position of the fragment in its IP datagram, nil for unfragmented packets
+	TooBig    *TooBig         // Datagram an ICMP message tells was too big for the next hop, nil for other packets
+	Payload   []byte          // Copy of the transport layer payload, nil if empty
+	Data      []byte          // Copy of the whole packet, only kept when the flight recorder needs it
+	LinkType  layers.LinkType // Link type of the packet, to decode Data
+	Read      time.Time       // Time the packet was read from its capture source, to measure the latency of analysis
+	CountOnly bool            // Whether the packet is only counted by analysis, as a broadcast or multicast frame outside of filters
+	Corrupt   string          // Integrity check the packet failed, among Checksum, Truncated and Malformed. Empty if none.
+	Captured  uint64          // Packets read from the interface since the previous one sent to analysis, this one included
+
+	// Interface the packet was captured on, as described in pcapng dumps
+	Interface *pcapgo.NgInterface
+}
+
+// Integrity checks packets may fail
+const (
+	Checksum  = "checksum"  // The checksum of the IPv4 header, or of the TCP or UDP segment, is wrong
+	Truncated = "truncated" // The packet is shorter than its headers tell, though it was captured whole
+	Malformed = "malformed" // The headers of the packet cannot be decoded
+)
+
+// ARP holds the addresses of an ARP request or reply, for IPv4 over Ethernet
+type ARP struct {
+	Reply     bool    // Whether the packet is a reply, rather than a request
+	SenderMAC [6]byte // Hardware address the sender claims its IP address for
+	SenderIP  string
+	TargetIP  string
+}
+
+// Fragment holds the position of a fragment in its IP datagram
+type Fragment struct {
+	ID     uint32 // Identification of the datagram
+	Offset int    // Offset of the data of the fragment in the datagram, in bytes
+	Length int    // Length of the data of the fragment, in bytes
+	More   bool   // Whether fragments follow
+}
+
+// TooBig holds an ICMP fragmentation needed or ICMPv6 packet too big message, which a router sends back to the sender
+// of a datagram larger than the MTU of its next hop
+type TooBig struct {
+	MTU   int    // MTU of the next hop, 0 if the router did not tell it
+	SrcIP string // Source of the datagram that was too big
+	DstIP string // Destination of the datagram that was too big
+}
+
+// SYNSignature holds the parts of a TCP SYN segment that depend on the operating system that sent it
+type SYNSignature struct {
+	Window  uint16 // Receive window
+	MSS     uint16 // Maximum segment size option, 0 if absent
+	WScale  int    // Window scale option, -1 if absent
+	Options string // Kinds of the options, in order and separated by commas, e.g. mss,nop,ws,nop,nop,sok
+}
+
+// Names of TCP option kinds in SYN signatures, as p0f writes them. Others are written ?<kind>.
+var optionNames = map[layers.TCPOptionKind]string{
+	layers.TCPOptionKindEndList:       "eol",
+	layers.TCPOptionKindNop:           "nop",
+	layers.TCPOptionKindMSS:           "mss",
+	layers.TCPOptionKindWindowScale:   "ws",
+	layers.TCPOptionKindSACKPermitted: "sok",
+	layers.TCPOptionKindSACK:          "sack",
+	layers.TCPOptionKindTimestamps:    "ts",
+}
+
+// newSYNSignature returns the signature of a TCP SYN segment
+func newSYNSignature(tcp *layers.TCP) *SYNSignature {
+	signature := &SYNSignature{
+		Window:  tcp.Window,
+		MSS:     0,
+		WScale:  -1,
+		Options: "",
+	}
+
+	options := make([]string, len(tcp.Options))
+	for i, option := range tcp.Options {
+		name, ok := optionNames[option.OptionType]
+		if !ok {
+			name = "?" + strconv.Itoa(int(option.OptionType))
+		}
+		options[i] = name
+
+		switch {
+		case option.OptionType == layers.TCPOptionKindMSS && len(option.OptionData) == 2:
+			signature.MSS = binary.BigEndian.Uint16(option.OptionData)
+		case option.OptionType == layers.TCPOptionKindWindowScale && len(option.OptionData) == 1:
+			signature.WScale = int(option.OptionData[0])
+		}
+	}
+	signature.Options = strings.Join(options, ",")
+
+	return signature
+}
+
+// newPacketMsg returns the message of a packet captured on dev through intf, without the information of its layers yet
+func newPacketMsg(ci gopacket.CaptureInfo, linkType layers.LinkType, dev device, intf *pcapgo.NgInterface, dataType string, read time.Time) PacketMsg {
+	return PacketMsg{
+		DataType:  dataType,
+		Device:    dev.name,
+		Socket:    dev.socket,
+		DeviceIP:  dev.ip,
+		RemoteIP:  "",
+		Timestamp: ci.Timestamp,
+		Length:    ci.Length,
+		Protocol:  "",
+		SrcMAC:    [6]byte{},
+		DstMAC:    [6]byte{},
+		SrcIP:     "",
+		SrcPort:   0,
+		DstIP:     "",
+		DstPort:   0,
+		SYN:       false,
+		FIN:       false,
+		RST:       false,
+		ACK:       false,
+		Seq:       0,
+		Ack:       0,
+		Window:    0,
+		TTL:       0,
+		DSCP:      0,
+		Signature: nil,
+		ARP:       nil,
+		Fragment:  nil,
+		TooBig:    nil,
+		Payload:   nil,
+		Data:      nil,
+		LinkType:  linkType,
+		Read:      read,
+		CountOnly: false,
+		Corrupt:   "",
+		Captured:  0,
+		Interface: intf,
+	}
+}
+
+// setAddresses sets the source and destination IP addresses of the packet. The remote peer among them is only told
+// once the packet is to be sent to analysis.
+func (m *PacketMsg) setAddresses(src, dst string) {
+	m.SrcIP, m.DstIP = src, dst
+}
+
+// Broadcast tells whether the packet was sent to all hosts of its segment, by its hardware address, or by its IPv4
+// address for link types without one
+func (m *PacketMsg) Broadcast() bool {
+	if m.DstMAC != [6]byte{} {
+		return m.DstMAC == [6]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	}
+
+	return m.DstIP == net.IPv4bcast.String()
+}
+
+// Multicast tells whether the packet was sent to a group of hosts, by its hardware address, or by its IP address for
+// link types without one. Broadcasts are not multicasts.
+func (m *PacketMsg) Multicast() bool {
+	if m.DstMAC != [6]byte{} {
+		return m.DstMAC[0]&0x01 != 0 && !m.Broadcast()
+	}
+
+	ip := net.ParseIP(m.DstIP)
+	return ip != nil && ip.IsMulticast()
+}
+
+// clearLayers removes the addresses, ports, flags and payload set on the packet
+func (m *PacketMsg) clearLayers() {
+	m.RemoteIP, m.Protocol = "", ""
+	m.SrcMAC, m.DstMAC = [6]byte{}, [6]byte{}
+	m.SrcIP, m.SrcPort, m.DstIP, m.DstPort = "", 0, "", 0
+	m.SYN, m.FIN, m.RST, m.Seq = false, false, false, 0
+	m.ACK, m.Ack, m.Window = false, 0, 0
+	m.TTL, m.DSCP, m.Signature, m.ARP = 0, 0, nil, nil
+	m.Fragment, m.TooBig = nil, nil
+	m.Payload = nil
+}
+
+// setTCP sets the ports, flags and payload of the packet's TCP segment. The payload is not copied.
+func (m *PacketMsg) setTCP(tcp *layers.TCP) {
+	m.Protocol, m.SrcPort, m.DstPort = "tcp", uint16(tcp.SrcPort), uint16(tcp.DstPort)
+	m.SYN, m.FIN, m.RST, m.Seq = tcp.SYN, tcp.FIN, tcp.RST, tcp.Seq
+	m.ACK, m.Ack, m.Window = tcp.ACK, tcp.Ack, tcp.Window
+	if tcp.SYN {
+		m.Signature = newSYNSignature(tcp)
+	}
+	m.Payload = tcp.LayerPayload()
+}
+
+// setFragment4 sets the position of the fragment, if the IPv4 packet is one
+func (m *PacketMsg) setFragment4(ip *layers.IPv4) {
+	if ip.Flags&layers.IPv4MoreFragments == 0 && ip.FragOffset == 0 {
+		return
+	}
+
+	m.Fragment = &Fragment{
+		ID:     uint32(ip.Id),
+		Offset: 8 * int(ip.FragOffset),
+		Length: len(ip.LayerPayload()),
+		More:   ip.Flags&layers.IPv4MoreFragments != 0,
+	}
+}
+
+// setUDP sets the ports and payload of the packet's UDP datagram. The payload is not copied.
+func (m *PacketMsg) setUDP(udp *layers.UDP) {
+	m.Protocol, m.SrcPort, m.DstPort = "udp", uint16(udp.SrcPort), uint16(udp.DstPort)
+	m.Payload = udp.LayerPayload()
+}
+
+// setPacket sets the addresses, ports, flags and payload of a fully decoded packet. The payload is not copied.
+func (m *PacketMsg) setPacket(packet gopacket.Packet) {
+	if eth, ok := packet.LinkLayer().(*layers.Ethernet); ok {
+		copy(m.SrcMAC[:], eth.SrcMAC)
+		copy(m.DstMAC[:], eth.DstMAC)
+	}
+
+	if network := packet.NetworkLayer(); network != nil {
+		src, dst := network.NetworkFlow().Endpoints()
+		m.setAddresses(src.String(), dst.String())
+
+		switch ip := network.(type) {
+		case *layers.IPv4:
+			m.TTL, m.DSCP = ip.TTL, ip.TOS>>2
+			m.setFragment4(ip)
+		case *layers.IPv6:
+			m.TTL, m.DSCP = ip.HopLimit, ip.TrafficClass>>2
+		}
+	}
+
+	if fragment, ok := packet.Layer(layers.LayerTypeIPv6Fragment).(*layers.IPv6Fragment); ok {
+		m.Fragment = &Fragment{
+			ID:     fragment.Identification,
+			Offset: 8 * int(fragment.FragmentOffset),
+			Length: len(fragment.LayerPayload()),
+			More:   fragment.MoreFragments,
+		}
+	}
+	if icmp, ok := packet.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4); ok &&
+		icmp.TypeCode == layers.CreateICMPv4TypeCode(layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4CodeFragmentationNeeded) {
+		// The header of the datagram is quoted
+		if quoted := icmp.LayerPayload(); len(quoted) >= 20 {
+			m.TooBig = &TooBig{
+				MTU:   int(icmp.Seq),
+				SrcIP: net.IP(quoted[12:16]).String(),
+				DstIP: net.IP(quoted[16:20]).String(),
+			}
+		}
+	}
+	if icmp, ok := packet.Layer(layers.LayerTypeICMPv6).(*layers.ICMPv6); ok &&
+		icmp.TypeCode.Type() == layers.ICMPv6TypePacketTooBig {
+		// The MTU, then the header of the datagram is quoted
+		if body := icmp.LayerPayload(); len(body) >= 4+40 {
+			m.TooBig = &TooBig{
+				MTU:   int(binary.BigEndian.Uint32(body)),
+				SrcIP: net.IP(body[4+8 : 4+24]).String(),
+				DstIP: net.IP(body[4+24 : 4+40]).String(),
+			}
+		}
+	}
+
+	if arp, ok := packet.Layer(layers.LayerTypeARP).(*layers.ARP); ok && arp.Protocol == layers.EthernetTypeIPv4 &&
+		len(arp.SourceHwAddress) == 6 && len(arp.SourceProtAddress) == net.IPv4len &&
+		len(arp.DstProtAddress) == net.IPv4len {
+		m.ARP = &ARP{
+			Reply:     arp.Operation == layers.ARPReply,
+			SenderMAC: [6]byte{},
+			SenderIP:  net.IP(arp.SourceProtAddress).String(),
+			TargetIP:  net.IP(arp.DstProtAddress).String(),
+		}
+		copy(m.ARP.SenderMAC[:], arp.SourceHwAddress)
+	}
+
+	switch transport := packet.TransportLayer().(type) {
+	case *layers.TCP:
+		m.setTCP(transport)
+	case *layers.UDP:
+		m.setUDP(transport)
+	case nil:
+	default:
+		m.Payload = transport.LayerPayload()
+	}
+}
+
+// copyBytes returns a copy of b, or nil if it is empty
+func copyBytes(b []byte) []byte {
+	if len(b) == 0 {
+		return nil
+	}
+
+	c := make([]byte, len(b))
+	copy(c, b)
+
+	return c
+}
@@ -0,0 +1,33 @@
+package capture
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Directory of the network namespaces named with ip netns
+const netnsDirectory = "/var/run/netns"
+
+// Prefix designating the network namespace of a process, e.g. of a container, by its PID
+const netnsPIDPrefix = "pid:"
+
+// NamespacePath returns the path of the network namespace designated by namespace : a name given with ip netns, the
+// namespace of a process as pid:<PID>, or a path to a namespace file
+func NamespacePath(namespace string) (string, error) {
+	switch {
+	case filepath.IsAbs(namespace):
+		return namespace, nil
+	case strings.HasPrefix(namespace, netnsPIDPrefix):
+		pid, err := strconv.ParseUint(strings.TrimPrefix(namespace, netnsPIDPrefix), 10, 32)
+		if err != nil || pid == 0 {
+			return "", fmt.Errorf("invalid network namespace %q, expected pid:<PID>", namespace)
+		}
+		return fmt.Sprintf("/proc/%d/ns/net", pid), nil
+	case namespace == "" || strings.ContainsRune(namespace, '/'):
+		return "", fmt.Errorf("invalid network namespace name %q", namespace)
+	default:
+		return filepath.Join(netnsDirectory, namespace), nil
+	}
+}
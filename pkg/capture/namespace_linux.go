@@ -0,0 +1,53 @@
+package capture
+
+import (
+	"fmt"
+	"golang.org/x/sys/unix"
+	"runtime"
+)
+
+// InNamespace runs fn in the network namespace, if not empty, so that the interfaces it lists and the sockets it opens
+// are those of the namespace. Sockets stay in the namespace they were opened in once fn returns. As namespaces are
+// entered per thread, fn runs on a thread locked to the goroutine, switched back to its own namespace afterwards.
+func InNamespace(namespace string, fn func() error) error {
+	if namespace == "" {
+		return fn()
+	}
+
+	path, err := NamespacePath(namespace)
+	if err != nil {
+		return err
+	}
+
+	target, err := unix.Open(path, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("could not open network namespace %s : %s", namespace, err)
+	}
+	defer unix.Close(target)
+
+	runtime.LockOSThread()
+
+	origin, err := unix.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()), unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("could not open the current network namespace : %s", err)
+	}
+	defer unix.Close(origin)
+
+	if err := unix.Setns(target, unix.CLONE_NEWNET); err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("could not enter network namespace %s, which requires the cap_sys_admin capability : %s",
+			namespace, err)
+	}
+
+	defer func() {
+		if err := unix.Setns(origin, unix.CLONE_NEWNET); err != nil {
+			// The thread stays locked, for it to exit with the goroutine rather than run others in the namespace
+			log.Error("Could not leave network namespace ", namespace, " : ", err)
+			return
+		}
+		runtime.UnlockOSThread()
+	}()
+
+	return fn()
+}
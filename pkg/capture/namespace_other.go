@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package capture
+
+import (
+	"errors"
+)
+
+// InNamespace runs fn, and fails if a network namespace is set, as they only exist on Linux
+func InNamespace(namespace string, fn func() error) error {
+	if namespace != "" {
+		return errors.New("network namespaces are only supported on linux")
+	}
+
+	return fn()
+}
@@ -0,0 +1,248 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/version"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"github.com/google/gopacket/pcapgo"
+	"io"
+	"os"
+	"runtime"
+)
+
+// Maximum size of packets the BPF filters of pcapng files are compiled for
+const ngSnapLen = 262144
+
+// Block type of the section header starting pcapng files, the same in either byte order
+var ngMagic = []byte{0x0a, 0x0d, 0x0d, 0x0a}
+
+// isPcapNG tells whether the file at path is in the pcapng format, rather than pcap
+func isPcapNG(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	magic := make([]byte, len(ngMagic))
+	if _, err := io.ReadFull(file, magic); err != nil {
+		// Too short to be either, leave it to libpcap to tell
+		return false, nil
+	}
+
+	return bytes.Equal(magic, ngMagic), nil
+}
+
+// describeDevice returns the description of an interface captured on, as written in pcapng dumps
+func describeDevice(name, ip string, linkType layers.LinkType) *pcapgo.NgInterface {
+	description := ""
+	if ip != "" {
+		description = "Interface with address " + ip
+	}
+
+	return &pcapgo.NgInterface{
+		Name:                name,
+		Comment:             "",
+		Description:         description,
+		Filter:              "",
+		OS:                  runtime.GOOS,
+		LinkType:            linkType,
+		TimestampResolution: 9,
+		TimestampOffset:     0,
+		SnapLength:          0,
+		Statistics:          pcapgo.NgInterfaceStatistics{},
+	}
+}
+
+// ngSource is a CaptureSource reading a pcapng file, knowing the interface each packet was captured on. Unlike libpcap
+// handles, BPF filters are applied to packets as they are read.
+type ngSource struct {
+	path       string
+	file       *os.File
+	reader     *pcapgo.NgReader
+	filter     *pcap.BPF             // Nil if packets are not filtered
+	interfaces []*pcapgo.NgInterface // Interfaces of the file met so far, by index
+}
+
+// openNgSource opens the pcapng file at path for replay, filtered by the BPF filter
+func openNgSource(path, filter string) (*ngSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := pcapgo.NewNgReader(file, pcapgo.DefaultNgReaderOptions)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	s := &ngSource{
+		path:       path,
+		file:       file,
+		reader:     reader,
+		filter:     nil,
+		interfaces: nil,
+	}
+
+	if err := s.SetFilter(filter); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// ZeroCopyReadPacketData reads the next packet matching the filter, whose data is a buffer of the reader
+func (s *ngSource) ZeroCopyReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	for {
+		data, ci, err := s.reader.ZeroCopyReadPacketData()
+		if err != nil || s.filter == nil || s.filter.Matches(ci, data) {
+			return data, ci, err
+		}
+	}
+}
+
+// ReadPacketData reads a copy of the next packet matching the filter
+func (s *ngSource) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	for {
+		data, ci, err := s.reader.ReadPacketData()
+		if err != nil || s.filter == nil || s.filter.Matches(ci, data) {
+			return data, ci, err
+		}
+	}
+}
+
+// Interface returns the description of the interface the packet was captured on, as recorded in the file
+func (s *ngSource) Interface(ci gopacket.CaptureInfo) *pcapgo.NgInterface {
+	// Interfaces are described before the packets captured on them
+	for len(s.interfaces) <= ci.InterfaceIndex && len(s.interfaces) < s.reader.NInterfaces() {
+		intf, err := s.reader.Interface(len(s.interfaces))
+		if err != nil {
+			break
+		}
+		log.Info("Capture file ", s.path, " records interface ", len(s.interfaces), " : ", describeInterface(&intf))
+		s.interfaces = append(s.interfaces, &intf)
+	}
+
+	if ci.InterfaceIndex < 0 || ci.InterfaceIndex >= len(s.interfaces) {
+		return nil
+	}
+
+	return s.interfaces[ci.InterfaceIndex]
+}
+
+// LinkType returns the link type of the packets of the file
+func (s *ngSource) LinkType() layers.LinkType {
+	return s.reader.LinkType()
+}
+
+// Stats are not kept for capture files
+func (s *ngSource) Stats() (CaptureStats, error) {
+	return CaptureStats{}, errors.New("no statistics for capture files")
+}
+
+// SetFilter replaces the BPF filter packets are matched against, or removes it if filter is empty
+func (s *ngSource) SetFilter(filter string) error {
+	if filter == "" {
+		s.filter = nil
+		return nil
+	}
+
+	bpf, err := pcap.NewBPF(s.reader.LinkType(), ngSnapLen, filter)
+	if err != nil {
+		return fmt.Errorf("invalid BPF filter %q : %s", filter, err)
+	}
+	s.filter = bpf
+
+	return nil
+}
+
+// Close closes the file
+func (s *ngSource) Close() error {
+	return s.file.Close()
+}
+
+// describeInterface returns a line describing an interface recorded in a pcapng file
+func describeInterface(intf *pcapgo.NgInterface) string {
+	line := intf.Name
+	if line == "" {
+		line = "unnamed"
+	}
+	if intf.Description != "" {
+		line += " (" + intf.Description + ")"
+	}
+	line += ", link type " + intf.LinkType.String()
+	if intf.Comment != "" {
+		line += " - " + intf.Comment
+	}
+
+	return line
+}
+
+// writePcapng writes packets to a new pcapng file at path, describing the interfaces they were captured on, with
+// comment in the section header
+func (f *FlightRecorder) writePcapng(path, comment string, packets []RecordedPacket) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	options := pcapgo.NgWriterOptions{
+		SectionInfo: pcapgo.NgSectionInfo{
+			Hardware:    runtime.GOARCH,
+			OS:          runtime.GOOS,
+			Application: "gonetmon " + version.Version,
+			Comment:     comment,
+		},
+	}
+
+	var writer *pcapgo.NgWriter
+	ids := make(map[*pcapgo.NgInterface]int)
+	unknown := make(map[layers.LinkType]*pcapgo.NgInterface) // Interfaces of packets recorded without one
+	for _, p := range packets {
+		intf := p.intf
+		if intf == nil {
+			if intf = unknown[p.linkType]; intf == nil {
+				intf = describeDevice("", "", p.linkType)
+				unknown[p.linkType] = intf
+			}
+		}
+
+		id, ok := ids[intf]
+		if !ok {
+			description := *intf
+			if description.SnapLength == 0 {
+				description.SnapLength = f.snapLen
+			}
+			if writer == nil {
+				writer, err = pcapgo.NewNgWriterInterface(file, description, options)
+			} else {
+				id, err = writer.AddInterface(description)
+			}
+			if err != nil {
+				_ = file.Close()
+				return err
+			}
+			ids[intf] = id
+		}
+
+		info := p.info
+		info.InterfaceIndex = id
+		if err := writer.WritePacket(info, p.data); err != nil {
+			_ = file.Close()
+			return err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
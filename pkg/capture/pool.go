@@ -0,0 +1,54 @@
+package capture
+
+import (
+	"sync"
+)
+
+// Capacity of pooled payload buffers. Larger payloads, e.g. of jumbo frames, are allocated and left to the GC.
+const payloadBufferSize = 2048
+
+// Pools of the batches and payload buffers sent to analysis, recycled once analysis released them
+var (
+	batchPool   = sync.Pool{New: func() interface{} { return new([]PacketMsg) }}
+	payloadPool = sync.Pool{New: func() interface{} { b := make([]byte, 0, payloadBufferSize); return &b }}
+)
+
+// newBatch returns an empty batch able to hold size packets, recycled if possible
+func newBatch(size int) []PacketMsg {
+	batch := *batchPool.Get().(*[]PacketMsg)
+	if cap(batch) < size {
+		return make([]PacketMsg, 0, size)
+	}
+
+	return batch[:0]
+}
+
+// copyPayload returns a copy of payload, in a recycled buffer if it fits, or nil if it is empty
+func copyPayload(payload []byte) []byte {
+	if len(payload) == 0 {
+		return nil
+	}
+	if len(payload) > payloadBufferSize {
+		return copyBytes(payload)
+	}
+
+	buffer := *payloadPool.Get().(*[]byte)
+	return append(buffer[:0], payload...)
+}
+
+// Release recycles a batch received from the Collector, along with the payloads of its packets, once analysis is done
+// with them. Neither the batch nor the payloads may be used afterwards, whereas the data of packets may be kept.
+func Release(batch []PacketMsg) {
+	for i := range batch {
+		if payload := batch[i].Payload; cap(payload) == payloadBufferSize {
+			payload = payload[:0]
+			payloadPool.Put(&payload)
+		}
+
+		// Drop references for the GC
+		batch[i] = PacketMsg{}
+	}
+
+	batch = batch[:0]
+	batchPool.Put(&batch)
+}
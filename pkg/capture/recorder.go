@@ -0,0 +1,225 @@
+package capture
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Layout of timestamps in dump file names
+const dumpTimeLayout = "20060102-150405.000"
+
+// RecordedPacket is a packet kept by the flight recorder
+type RecordedPacket struct {
+	info     gopacket.CaptureInfo
+	data     []byte
+	linkType layers.LinkType
+	intf     *pcapgo.NgInterface // Interface the packet was captured on, nil if unknown
+}
+
+// FlightRecorder keeps the packets captured over the last span in memory, so they can be dumped to a pcap or pcapng file
+// on demand
+type FlightRecorder struct {
+	mutex      sync.Mutex
+	packets    list.List // Recorded packets, oldest first
+	span       time.Duration
+	maxPackets uint
+	snapLen    uint32
+	directory  string
+	maxDumps   int    // Number of dumps kept in the directory. 0 keeps them all.
+	format     string // Format of dumps, pcap or pcapng
+}
+
+// NewFlightRecorder returns a flight recorder configured by parameters, or nil if it is disabled
+func NewFlightRecorder(parameters *config.Parameters) *FlightRecorder {
+	recorder := parameters.FlightRecorder
+	if !recorder.Enabled {
+		return nil
+	}
+
+	return &FlightRecorder{
+		mutex:      sync.Mutex{},
+		packets:    list.List{},
+		span:       recorder.Span,
+		maxPackets: recorder.MaxPackets,
+		snapLen:    uint32(parameters.CaptureConfig.SnapshotLen),
+		directory:  recorder.Directory,
+		maxDumps:   recorder.MaxDumps,
+		format:     recorder.Format,
+	}
+}
+
+// Record adds the packet to the recorder, and forgets packets older than the span or beyond the maximum number of packets.
+// Packets sent to analysis without their data are ignored.
+func (f *FlightRecorder) Record(packet *PacketMsg) {
+	if packet.Data == nil {
+		return
+	}
+
+	info := gopacket.CaptureInfo{
+		Timestamp:      packet.Timestamp,
+		CaptureLength:  len(packet.Data),
+		Length:         packet.Length,
+		InterfaceIndex: 0,
+		AncillaryData:  nil,
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.packets.PushBack(RecordedPacket{
+		info:     info,
+		data:     packet.Data,
+		linkType: packet.LinkType,
+		intf:     packet.Interface,
+	})
+
+	for f.packets.Len() > 0 {
+		oldest := f.packets.Front()
+		if uint(f.packets.Len()) <= f.maxPackets && info.Timestamp.Sub(oldest.Value.(RecordedPacket).info.Timestamp) <= f.span {
+			break
+		}
+		f.packets.Remove(oldest)
+	}
+}
+
+// snapshot returns a copy of the recorded packets selected by keep, or of all of them if keep is nil
+func (f *FlightRecorder) snapshot(keep func(p *RecordedPacket) bool) []RecordedPacket {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	packets := make([]RecordedPacket, 0, f.packets.Len())
+	for e := f.packets.Front(); e != nil; e = e.Next() {
+		if p := e.Value.(RecordedPacket); keep == nil || keep(&p) {
+			packets = append(packets, p)
+		}
+	}
+
+	return packets
+}
+
+// CapturedAt returns a filter selecting the packets captured at one of the given times
+func CapturedAt(timestamps []time.Time) func(p *RecordedPacket) bool {
+	set := make(map[int64]struct{}, len(timestamps))
+	for _, t := range timestamps {
+		set[t.UnixNano()] = struct{}{}
+	}
+
+	return func(p *RecordedPacket) bool {
+		_, ok := set[p.info.Timestamp.UnixNano()]
+		return ok
+	}
+}
+
+// writePcap writes packets to a new pcap file at path. A pcap file has a single link type :
+// that of the first packet is used, and packets of other link types are skipped.
+func (f *FlightRecorder) writePcap(path string, packets []RecordedPacket) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	writer := pcapgo.NewWriter(file)
+	if err := writer.WriteFileHeader(f.snapLen, packets[0].linkType); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	skipped := 0
+	for _, p := range packets {
+		if p.linkType != packets[0].linkType {
+			skipped++
+			continue
+		}
+		if err := writer.WritePacket(p.info, p.data); err != nil {
+			_ = file.Close()
+			return err
+		}
+	}
+
+	if skipped > 0 {
+		log.Warn("Skipped ", skipped, " packets of a different link type in ", path)
+	}
+
+	return file.Close()
+}
+
+// Dump writes the recorded packets selected by keep, or all of them if keep is nil, to a new file in the configured
+// format whose name includes reason, and returns its path. Comment describes the dump in pcapng files.
+func (f *FlightRecorder) Dump(reason, comment string, keep func(p *RecordedPacket) bool) (string, error) {
+	return f.DumpAs(f.format, reason, comment, keep)
+}
+
+// DumpAs writes the recorded packets selected by keep, or all of them if keep is nil, to a new file in the given format,
+// pcap or pcapng, whose name includes reason, and returns its path. Comment describes the dump in pcapng files.
+func (f *FlightRecorder) DumpAs(format, reason, comment string, keep func(p *RecordedPacket) bool) (string, error) {
+	if format != config.PcapFormat && format != config.PcapNGFormat {
+		return "", fmt.Errorf("unknown dump format : %s, expected %s or %s", format, config.PcapFormat, config.PcapNGFormat)
+	}
+
+	packets := f.snapshot(keep)
+	if len(packets) == 0 {
+		return "", errors.New("no packets recorded")
+	}
+
+	if err := os.MkdirAll(f.directory, 0755); err != nil {
+		return "", fmt.Errorf("could not create dump directory : %s", err)
+	}
+
+	path := filepath.Join(f.directory, fmt.Sprintf("gonetmon-%s-%s.%s", reason, time.Now().Format(dumpTimeLayout), format))
+	write := func() error { return f.writePcap(path, packets) }
+	if format == config.PcapNGFormat {
+		write = func() error { return f.writePcapng(path, comment, packets) }
+	}
+	if err := write(); err != nil {
+		return "", fmt.Errorf("could not write dump : %s", err)
+	}
+
+	log.Info("Dumped ", len(packets), " recorded packets to ", path)
+
+	if f.maxDumps > 0 {
+		f.pruneDumps()
+	}
+
+	return path, nil
+}
+
+// pruneDumps removes the oldest dumps of the directory past the maximum number of dumps. Alerts may still reference
+// the evidence removed.
+func (f *FlightRecorder) pruneDumps() {
+	dumps, err := filepath.Glob(filepath.Join(f.directory, "gonetmon-*.pcap"))
+	if err != nil {
+		log.Error("Could not list dumps : ", err)
+		return
+	}
+	ngDumps, _ := filepath.Glob(filepath.Join(f.directory, "gonetmon-*.pcapng"))
+	dumps = append(dumps, ngDumps...)
+	if len(dumps) <= f.maxDumps {
+		return
+	}
+
+	modified := make(map[string]time.Time, len(dumps))
+	for _, dump := range dumps {
+		if info, err := os.Stat(dump); err == nil {
+			modified[dump] = info.ModTime()
+		}
+	}
+	sort.Slice(dumps, func(i, j int) bool {
+		return modified[dumps[i]].Before(modified[dumps[j]])
+	})
+
+	for _, dump := range dumps[:len(dumps)-f.maxDumps] {
+		if err := os.Remove(dump); err != nil {
+			log.Error("Could not remove dump ", dump, " : ", err)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package capture
+
+import (
+	"errors"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"io"
+	"time"
+)
+
+// Longest a read of a paced source waits for the next packet to be due, before timing out as a live interface would
+const replayReadTimeout = 100 * time.Millisecond
+
+// pacedSource replays the packets of a capture file at their original pace, sped up by a factor. Packets are stamped
+// with the time they are replayed at, so that analysis and alerts see them as if they were captured live.
+type pacedSource struct {
+	source  CaptureSource
+	speed   float64
+	start   time.Time // Time the first packet was replayed at
+	origin  time.Time // Capture timestamp of the first packet
+	pending bool      // Whether a packet was read from the source but is not due yet
+	data    []byte
+	ci      gopacket.CaptureInfo
+}
+
+// newPacedSource returns a CaptureSource delivering the packets of source speed times faster than they were captured
+func newPacedSource(source CaptureSource, speed float64) *pacedSource {
+	return &pacedSource{
+		source:  source,
+		speed:   speed,
+		start:   time.Time{},
+		origin:  time.Time{},
+		pending: false,
+		data:    nil,
+		ci:      gopacket.CaptureInfo{},
+	}
+}
+
+// ZeroCopyReadPacketData returns the next packet of the source once it is due, or ErrReadTimeout if it is not due
+// within the read timeout. A packet captured before the previous one is delivered right away.
+func (p *pacedSource) ZeroCopyReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	if !p.pending {
+		data, ci, err := p.source.ZeroCopyReadPacketData()
+		if err != nil {
+			return nil, ci, err
+		}
+
+		// The data stays valid until the next read of the source, which only happens once this packet is delivered
+		p.data, p.ci, p.pending = data, ci, true
+		if p.start.IsZero() {
+			p.start, p.origin = time.Now(), ci.Timestamp
+		}
+	}
+
+	due := p.start.Add(time.Duration(float64(p.ci.Timestamp.Sub(p.origin)) / p.speed))
+	if wait := time.Until(due); wait > 0 {
+		if wait > replayReadTimeout {
+			time.Sleep(replayReadTimeout)
+			return nil, gopacket.CaptureInfo{}, ErrReadTimeout
+		}
+		time.Sleep(wait)
+	}
+
+	p.pending = false
+	ci := p.ci
+	ci.Timestamp = due
+
+	return p.data, ci, nil
+}
+
+// LinkType returns the link type of the source
+func (p *pacedSource) LinkType() layers.LinkType {
+	return p.source.LinkType()
+}
+
+// Stats returns the counters of the source
+func (p *pacedSource) Stats() (CaptureStats, error) {
+	return p.source.Stats()
+}
+
+// SetFilter replaces the BPF filter of the source, if it supports it
+func (p *pacedSource) SetFilter(filter string) error {
+	setter, ok := p.source.(FilterSetter)
+	if !ok {
+		return errors.New("the capture source does not support changing filters")
+	}
+
+	return setter.SetFilter(filter)
+}
+
+// Interface returns the description of the interface the packet was captured on, if the source knows it
+func (p *pacedSource) Interface(ci gopacket.CaptureInfo) *pcapgo.NgInterface {
+	if describer, ok := p.source.(InterfaceDescriber); ok {
+		return describer.Interface(ci)
+	}
+
+	return nil
+}
+
+// Close closes the source
+func (p *pacedSource) Close() error {
+	return p.source.Close()
+}
+
+// filePacket is a packet read ahead from a capture file
+type filePacket struct {
+	data  []byte
+	ci    gopacket.CaptureInfo
+	valid bool // Whether the packet was read and not delivered yet
+}
+
+// fileSet reads several capture files as a single source, either one after another, or merged into a single stream
+// ordered by timestamp, e.g. captures of several interfaces. The files share the same link type.
+type fileSet struct {
+	sources   []fileSource
+	merge     bool
+	current   int          // Index of the file read, when not merging, or of the file of the last packet when merging
+	heads     []filePacket // Next packet of each file, when merging
+	exhausted []bool       // Whether all packets of each file were read, when merging
+}
+
+// newFileSet returns a CaptureSource reading sources in turn, or merged by timestamp if merge is true
+func newFileSet(sources []fileSource, merge bool) *fileSet {
+	return &fileSet{
+		sources:   sources,
+		merge:     merge,
+		current:   0,
+		heads:     make([]filePacket, len(sources)),
+		exhausted: make([]bool, len(sources)),
+	}
+}
+
+// ZeroCopyReadPacketData returns the next packet of the current file, moving to the next file once exhausted, or
+// the earliest of the next packets of all files when merging. Merged packets are copied, as several are held at once.
+func (f *fileSet) ZeroCopyReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	if !f.merge {
+		for {
+			data, ci, err := f.sources[f.current].ZeroCopyReadPacketData()
+			if err == io.EOF && f.current < len(f.sources)-1 {
+				f.current++
+				continue
+			}
+			return data, ci, err
+		}
+	}
+
+	next := -1
+	for i, s := range f.sources {
+		if !f.heads[i].valid && !f.exhausted[i] {
+			data, ci, err := s.ReadPacketData()
+			switch {
+			case err == io.EOF:
+				f.exhausted[i] = true
+			case err != nil:
+				return nil, ci, err
+			default:
+				f.heads[i] = filePacket{data: data, ci: ci, valid: true}
+			}
+		}
+
+		if f.heads[i].valid && (next < 0 || f.heads[i].ci.Timestamp.Before(f.heads[next].ci.Timestamp)) {
+			next = i
+		}
+	}
+
+	if next < 0 {
+		return nil, gopacket.CaptureInfo{}, io.EOF
+	}
+
+	head := f.heads[next]
+	f.heads[next] = filePacket{data: nil, ci: gopacket.CaptureInfo{}, valid: false}
+	f.current = next
+
+	return head.data, head.ci, nil
+}
+
+// LinkType returns the link type shared by the files
+func (f *fileSet) LinkType() layers.LinkType {
+	return f.sources[0].LinkType()
+}
+
+// Stats returns the counters of the first file, which libpcap does not keep for capture files
+func (f *fileSet) Stats() (CaptureStats, error) {
+	return f.sources[0].Stats()
+}
+
+// SetFilter replaces the BPF filter of all files
+func (f *fileSet) SetFilter(filter string) error {
+	for _, s := range f.sources {
+		if err := s.SetFilter(filter); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Interface returns the description of the interface the packet was captured on, if its file records it
+func (f *fileSet) Interface(ci gopacket.CaptureInfo) *pcapgo.NgInterface {
+	if describer, ok := f.sources[f.current].(InterfaceDescriber); ok {
+		return describer.Interface(ci)
+	}
+
+	return nil
+}
+
+// Close closes all files
+func (f *fileSet) Close() error {
+	for _, s := range f.sources {
+		_ = s.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,338 @@
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"github.com/google/gopacket/pcapgo"
+	"io"
+	"sync"
+	"time"
+)
+
+// CaptureStats holds the packet counters of a capture source
+type CaptureStats struct {
+	Received uint64 // Number of packets received by the source
+	Dropped  uint64 // Number of packets dropped by the source or the kernel, e.g. because buffers were full
+}
+
+// ErrReadTimeout is returned by capture sources when no packet arrived within their read timeout
+var ErrReadTimeout = errors.New("capture read timeout")
+
+// CaptureSource is a backend delivering captured packets, e.g. a live interface or a capture file
+type CaptureSource interface {
+	// ZeroCopyReadPacketData reads the next packet. Its data may be a buffer of the source, only valid until the next
+	// read or until the source is closed. It returns ErrReadTimeout if no packet arrived in time, and io.EOF once the
+	// source is closed or exhausted.
+	ZeroCopyReadPacketData() (data []byte, ci gopacket.CaptureInfo, err error)
+
+	// LinkType returns the link type of the packets read, telling how to decode them
+	LinkType() layers.LinkType
+
+	// Stats returns the packet counters of the source, if it keeps any
+	Stats() (CaptureStats, error)
+
+	// Close stops the capture and releases the source's resources
+	Close() error
+}
+
+// FilterSetter is implemented by capture sources whose BPF filter can be replaced while capturing
+type FilterSetter interface {
+	SetFilter(filter string) error
+}
+
+// InterfaceDescriber is implemented by capture sources knowing the interface each packet was captured on, e.g. pcapng
+// files recording several interfaces
+type InterfaceDescriber interface {
+	// Interface returns the description of the interface the packet just read was captured on, nil if unknown
+	Interface(ci gopacket.CaptureInfo) *pcapgo.NgInterface
+}
+
+// CheckFilter tells whether the BPF filter compiles for Ethernet links, without opening a capture
+func CheckFilter(filter string, snapLen int32) error {
+	return compileFilter(filter, layers.LinkTypeEthernet, snapLen)
+}
+
+// compileFilter tells whether the BPF filter compiles for the link type
+func compileFilter(filter string, linkType layers.LinkType, snapLen int32) error {
+	if filter == "" {
+		return nil
+	}
+
+	if _, err := pcap.CompileBPFFilter(linkType, int(snapLen), filter); err != nil {
+		return fmt.Errorf("invalid BPF filter %q : %s", filter, err)
+	}
+
+	return nil
+}
+
+// pcapSource is a CaptureSource reading from a libpcap handle, either on a live interface or on a pcap file
+type pcapSource struct {
+	handle *pcap.Handle
+}
+
+// newPcapSource sets the BPF filter on handle, if any, and returns a CaptureSource reading from it
+func newPcapSource(handle *pcap.Handle, filter string) (*pcapSource, error) {
+	s := &pcapSource{
+		handle: handle,
+	}
+
+	if filter != "" {
+		if err := s.SetFilter(filter); err != nil {
+			handle.Close()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// openLiveSource opens a live capture on the named interface, filtered by the BPF filter
+func openLiveSource(device string, capture *config.CaptureConfig, filter string) (CaptureSource, error) {
+	handle, err := pcap.OpenLive(device, capture.SnapshotLen, capture.PromiscuousMode, capture.CaptureTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPcapSource(handle, filter)
+}
+
+// openFileSource opens the pcap files at paths for replay as a single source, filtered by the BPF filter. Packets are
+// replayed speed times faster than they were captured, or as fast as possible if speed is 0.
+func openFileSource(paths []string, filter string, merge bool, speed float64) (CaptureSource, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no capture file")
+	}
+
+	sources := make([]fileSource, 0, len(paths))
+	closeAll := func() {
+		for _, s := range sources {
+			_ = s.Close()
+		}
+	}
+
+	for _, path := range paths {
+		source, err := openFile(path, filter)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("%s : %s", path, err)
+		}
+		if len(sources) > 0 && source.LinkType() != sources[0].LinkType() {
+			_ = source.Close()
+			closeAll()
+			return nil, fmt.Errorf("%s has link type %s, unlike %s of %s", path, source.LinkType(), sources[0].LinkType(), paths[0])
+		}
+		sources = append(sources, source)
+	}
+
+	var source CaptureSource = sources[0]
+	if len(sources) > 1 {
+		source = newFileSet(sources, merge)
+	}
+	if speed > 0 {
+		source = newPacedSource(source, speed)
+	}
+
+	return source, nil
+}
+
+// fileSource is a CaptureSource reading a capture file, whose packets can also be read as copies
+type fileSource interface {
+	CaptureSource
+	FilterSetter
+
+	// ReadPacketData reads the next packet, whose data is a copy
+	ReadPacketData() (data []byte, ci gopacket.CaptureInfo, err error)
+}
+
+// openFile opens the pcap or pcapng file at path, filtered by the BPF filter
+func openFile(path, filter string) (fileSource, error) {
+	ng, err := isPcapNG(path)
+	if err != nil {
+		return nil, err
+	}
+	if ng {
+		return openNgSource(path, filter)
+	}
+
+	handle, err := pcap.OpenOffline(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPcapSource(handle, filter)
+}
+
+// ReadFile returns the packets recorded in the pcap or pcapng file at path, e.g. to replay them from memory with a
+// MockSource
+func ReadFile(path string) ([]gopacket.Packet, error) {
+	source, err := openFile(path, "")
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	var packets []gopacket.Packet
+	for {
+		data, ci, err := source.ReadPacketData()
+		if err == io.EOF {
+			return packets, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read packet %d of %s : %s", len(packets)+1, path, err)
+		}
+
+		// Interfaces of pcapng files may each have their own link type
+		linkType := source.LinkType()
+		if describer, ok := source.(InterfaceDescriber); ok {
+			if intf := describer.Interface(ci); intf != nil {
+				linkType = intf.LinkType
+			}
+		}
+
+		packet := gopacket.NewPacket(data, linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+		packet.Metadata().CaptureInfo = ci
+		packets = append(packets, packet)
+	}
+}
+
+// ZeroCopyReadPacketData reads the next packet from the handle, whose data is libpcap's buffer
+func (s *pcapSource) ZeroCopyReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	data, ci, err := s.handle.ZeroCopyReadPacketData()
+	if err == pcap.NextErrorTimeoutExpired {
+		err = ErrReadTimeout
+	}
+
+	return data, ci, err
+}
+
+// ReadPacketData reads a copy of the next packet from the handle
+func (s *pcapSource) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	return s.handle.ReadPacketData()
+}
+
+// LinkType returns the link type of the handle
+func (s *pcapSource) LinkType() layers.LinkType {
+	return s.handle.LinkType()
+}
+
+// Stats returns the counters of libpcap. They are not available for pcap files.
+func (s *pcapSource) Stats() (CaptureStats, error) {
+	stats, err := s.handle.Stats()
+	if err != nil {
+		return CaptureStats{}, err
+	}
+
+	return CaptureStats{
+		Received: uint64(stats.PacketsReceived),
+		Dropped:  uint64(stats.PacketsDropped + stats.PacketsIfDropped),
+	}, nil
+}
+
+// SetFilter replaces the BPF filter of the handle
+func (s *pcapSource) SetFilter(filter string) error {
+	return s.handle.SetBPFFilter(filter)
+}
+
+// Close closes the handle, after which reads return io.EOF
+func (s *pcapSource) Close() error {
+	s.handle.Close()
+	return nil
+}
+
+// linkType returns the link type of the packet's first layer, as written in pcap headers
+func linkType(packet gopacket.Packet) layers.LinkType {
+	if len(packet.Layers()) > 0 {
+		switch packet.Layers()[0].LayerType() {
+		case layers.LayerTypeLinuxSLL:
+			return layers.LinkTypeLinuxSLL
+		case layers.LayerTypeLoopback:
+			return layers.LinkTypeNull
+		case layers.LayerTypeIPv4, layers.LayerTypeIPv6:
+			return layers.LinkTypeRaw
+		}
+	}
+
+	return layers.LinkTypeEthernet
+}
+
+// MockSource is an in-memory CaptureSource delivering a fixed set of packets, e.g. to run the Collector in tests
+// without capture privileges
+type MockSource struct {
+	packets  chan gopacket.Packet
+	total    int
+	linkType layers.LinkType
+	filter   string
+	once     sync.Once
+}
+
+// Period after which a read returns ErrReadTimeout once all packets of a MockSource were delivered
+const mockReadTimeout = 100 * time.Millisecond
+
+// NewMockSource returns a MockSource delivering packets in order. Reads time out once they are all delivered, until
+// the source is closed, as a live interface's would. The link type is that of the first packet.
+func NewMockSource(packets []gopacket.Packet) *MockSource {
+	m := &MockSource{
+		packets:  make(chan gopacket.Packet, len(packets)),
+		total:    len(packets),
+		linkType: layers.LinkTypeEthernet,
+		filter:   "",
+		once:     sync.Once{},
+	}
+
+	if len(packets) > 0 {
+		m.linkType = linkType(packets[0])
+	}
+
+	for _, packet := range packets {
+		m.packets <- packet
+	}
+
+	return m
+}
+
+// ZeroCopyReadPacketData returns the next packet the source was created with
+func (m *MockSource) ZeroCopyReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	select {
+	case packet, ok := <-m.packets:
+		if !ok {
+			return nil, gopacket.CaptureInfo{}, io.EOF
+		}
+		return packet.Data(), packet.Metadata().CaptureInfo, nil
+
+	case <-time.After(mockReadTimeout):
+		return nil, gopacket.CaptureInfo{}, ErrReadTimeout
+	}
+}
+
+// LinkType returns the link type of the packets the source was created with
+func (m *MockSource) LinkType() layers.LinkType {
+	return m.linkType
+}
+
+// Stats reports all packets the source was created with as received
+func (m *MockSource) Stats() (CaptureStats, error) {
+	return CaptureStats{Received: uint64(m.total), Dropped: 0}, nil
+}
+
+// SetFilter records the filter, without applying it to the packets the source was created with
+func (m *MockSource) SetFilter(filter string) error {
+	m.filter = filter
+	return nil
+}
+
+// Filter returns the last filter set on the source
+func (m *MockSource) Filter() string {
+	return m.filter
+}
+
+// Close stops delivering packets. Packets not delivered yet can still be read, after which reads return io.EOF.
+func (m *MockSource) Close() error {
+	m.once.Do(func() {
+		close(m.packets)
+	})
+	return nil
+}
@@ -0,0 +1,1511 @@
+// Package config loads and holds configuration for runtime
+package config
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// dataTypes
+	DataHTTP = "http"
+
+	// output
+	ConsoleOutput       = "console"
+	StatsdOutput        = "statsd"
+	GraphiteOutput      = "graphite"
+	OTLPOutput          = "otlp"
+	KafkaOutput         = "kafka"
+	MQTTOutput          = "mqtt"
+	NATSOutput          = "nats"
+	ElasticsearchOutput = "elasticsearch"
+	LokiOutput          = "loki"
+	SplunkOutput        = "splunk"
+	SIEMOutput          = "siem"
+	EVEOutput           = "eve"
+	ZeekOutput          = "zeek"
+	HistoryOutput       = "history"
+	DesktopOutput       = "desktop"
+	ServerOutput        = "server"
+	SQLiteOutput        = "sqlite"
+	ClickHouseOutput    = "clickhouse"
+	AgentOutput         = "agent"
+	FileOutput          = ""
+
+	// Rollup periods
+	HourlyRollup = "hourly"
+	DailyRollup  = "daily"
+
+	// SIEM formats
+	CEFFormat  = "cef"
+	LEEFFormat = "leef"
+
+	// Zeek log formats
+	TSVFormat  = "tsv"
+	JSONFormat = "json"
+
+	// Log formats, along with JSONFormat
+	TextFormat = "text"
+
+	// Packet dump formats
+	PcapFormat   = "pcap"
+	PcapNGFormat = "pcapng"
+
+	// Log destinations
+	StderrLog   = "stderr"
+	FileLog     = "file"
+	SyslogLog   = "syslog"
+	JournaldLog = "journald"
+	AutoLog     = "auto" // Journald when run by systemd, file otherwise
+
+	// Capture sources
+	PcapSource     = "pcap"
+	AFPacketSource = "afpacket"
+	FileSource     = "file"
+
+	// Backpressure policies of capture when analysis falls behind
+	BlockPolicy      = "block"       // Wait for analysis, letting the kernel drop packets once its buffers are full
+	DropNewestPolicy = "drop-newest" // Drop the packet just captured
+	DropOldestPolicy = "drop-oldest" // Drop the oldest packet waiting for analysis, to make room for the new one
+
+	// Self-tests of outputs at start
+	OffSelfTest  = "off"  // Outputs are not tested
+	WarnSelfTest = "warn" // A test message is sent through each output, and those failing are warned of
+	FailSelfTest = "fail" // A test message is sent through each output, and the monitor does not start if one fails
+
+	// Modes of sharing the traffic of an interface among AF_PACKET sockets
+	HashFanout        = "hash" // By flow, so that both directions of a connection are read on the same socket
+	LoadBalanceFanout = "lb"   // In turn
+	CPUFanout         = "cpu"  // By the CPU the packet was received on
+
+	// Kinds of sidecars
+	AnalyzerSidecar = "analyzer"
+	OutputSidecar   = "output"
+
+	// Analyzers
+	HTTPAnalyzer      = "http"
+	DNSAnalyzer       = "dns"
+	TLSAnalyzer       = "tls"
+	OSAnalyzer        = "os"
+	DiscoveryAnalyzer = "discovery"
+	VoIPAnalyzer      = "voip"
+	MailAnalyzer      = "mail"
+	SSHAnalyzer       = "ssh"
+	NTPAnalyzer       = "ntp"
+	ARPAnalyzer       = "arp"
+	MTUAnalyzer       = "mtu"
+	StallAnalyzer     = "stall"
+
+	// Metrics of reports rate-of-change rules watch
+	HitsMetric    = "hits"
+	BytesMetric   = "bytes"
+	PacketsMetric = "packets"
+	FlowsMetric   = "flows"
+)
+
+// CaptureConfig holds configuration for capturing packets
+type CaptureConfig struct {
+	SnapshotLen     int32         // Maximum size to read for each packet
+	PromiscuousMode bool          // Whether to ut the interface in promiscuous mode
+	CaptureTimeout  time.Duration // Period to listen for traffic before sending out captured traffic
+	Source          string        // Capture backend, among pcap, afpacket (Linux only) and file
+	Namespace       string        // Network namespace live interfaces are found and opened in, as a name in /var/run/netns, pid:<PID> for that of a process, or a path. Empty for that of gonetmon. Linux only.
+	Files           []string      // Paths of the pcap files replayed by the file source, one after another unless merged
+	MergeFiles      bool          // Whether the file source merges its files into a single stream ordered by timestamp
+	ReplaySpeed     float64       // Factor by which the file source speeds up the original pace of the capture, 1 honouring its timestamps. 0 replays it as fast as possible.
+	Backpressure    string        // What capture does when analysis falls behind, among block, drop-newest and drop-oldest
+	BatchSize       int           // Maximum number of packets of an interface sent to analysis at once
+	BatchTimeout    time.Duration // Maximum time a captured packet waits for its batch to fill before it is sent to analysis
+
+	// Sharing of the traffic of busy interfaces among several sockets, indexed by interface name. Afpacket source only.
+	Fanout map[string]FanoutConfig
+}
+
+// FanoutConfig holds how the traffic of an interface is shared among several AF_PACKET sockets, each read separately
+type FanoutConfig struct {
+	Sockets int    // Number of sockets in the fanout group
+	Mode    string // How packets are spread among sockets, among hash, lb and cpu
+	CPUs    []int  // CPUs the sockets are read on, in turn. If empty, reads are not pinned.
+}
+
+// FlowTableConfig bounds the flows tracked over a report window, so that a scan or a flood cannot exhaust memory.
+// Limits are shared among analysis workers.
+type FlowTableConfig struct {
+	MaxFlows    int           // Maximum number of flows tracked at once, past which the least recently seen are evicted. 0 leaves it unbounded.
+	MaxMemory   int64         // Maximum memory (bytes) estimated for tracked flows, past which the least recently seen are evicted. 0 leaves it unbounded.
+	IdleTimeout time.Duration // Time since their last packet after which flows are evicted. 0 keeps them until the end of the window.
+}
+
+// InventoryConfig holds the persistent inventory of the hosts seen on monitored network segments
+type InventoryConfig struct {
+	Enabled  bool     // Whether to record the hosts of the inventoried networks to the inventory file
+	File     string   // Path of the file the inventory is kept in, across runs
+	Networks []string // Networks whose hosts are inventoried, in CIDR notation. If empty, private and link-local networks.
+	Vendors  string   // Path of a Wireshark manuf or IEEE oui.txt file naming the vendors of hardware addresses
+	AlertNew bool     // Whether to alert of hosts never seen before
+}
+
+// CapacityConfig holds the links whose long-term bandwidth trends are kept, and when the projection of those trends
+// reaching the capacity of a link is alerted of, to plan capacity ahead of saturation
+type CapacityConfig struct {
+	Enabled bool               // Whether to keep the bandwidth trends of interfaces and alert of links forecast to reach their capacity
+	File    string             // Path of the file the trends are kept in, across runs
+	Links   map[string]float64 // Capacity of links in bits per second, by interface. Only interfaces with a capacity are forecast.
+	Horizon int                // Days ahead within which a link forecast to reach its capacity raises an alert
+	History int                // Days of trends kept, past which the oldest are forgotten
+	MinDays int                // Days of trends a link must have for its bandwidth to be forecast
+}
+
+// StormConfig holds the rates of broadcast and multicast frames on an interface past which a storm is alerted of
+type StormConfig struct {
+	Enabled   bool // Whether to let broadcast and multicast frames through filters, and alert of storms
+	Broadcast uint // Broadcast frames per second on an interface, over a report window, that raise an alert
+	Multicast uint // Multicast frames per second on an interface, over a report window, that raise an alert
+}
+
+// Filter returns the network filter widened to broadcast and multicast frames if storms are detected. An empty filter
+// already captures them.
+func (s *StormConfig) Filter(network string) string {
+	if !s.Enabled || network == "" {
+		return network
+	}
+
+	return "(" + network + ") or broadcast or multicast"
+}
+
+// IntegrityConfig holds how the integrity of captured packets is checked, and when the share of corrupt packets on an
+// interface, as a bad NIC or cable makes it, is alerted of. Truncated and malformed packets are always counted.
+type IntegrityConfig struct {
+	Checksums  bool    // Whether to verify the checksums of IPv4 headers and of TCP and UDP segments in Ethernet frames. Checksum offloading and GRO must be off on interfaces, as packets they receive are otherwise captured with partial checksums.
+	Enabled    bool    // Whether to alert of corruption
+	Threshold  float64 // Share of corrupt packets captured on an interface over a report window that raises an alert, between 0 and 1
+	MinPackets uint    // Packets an interface must have captured over the window for its corruption rate to be judged
+}
+
+// GroupConfig is a named group of networks, e.g. internal, dmz or internet
+type GroupConfig struct {
+	Name     string
+	Networks []string // Addresses and networks in CIDR notation of the group
+}
+
+// MatrixConfig holds the groups of networks the traffic is accounted between over each report window, e.g. to plan
+// capacity or estimate egress costs
+type MatrixConfig struct {
+	Groups []GroupConfig // Groups of networks. An address belongs to the group of the most specific network holding it. If empty, traffic is not accounted.
+	Others string        // Group of addresses in none of the groups
+}
+
+// UploadConfig holds when large uploads of internal hosts to external destinations, e.g. data exfiltration, are
+// alerted of
+type UploadConfig struct {
+	Enabled   bool          // Whether to alert of large uploads
+	Threshold uint64        // Bytes an internal host sends to a single external destination over the span that raise an alert
+	Span      time.Duration // Time frame over which the bytes sent to each destination are summed, of whole report windows
+	Internal  []string      // Internal hosts, as addresses or networks in CIDR notation. If empty, private and link-local networks.
+	Allowed   []string      // Destinations never alerted of, e.g. backup targets, as addresses or networks in CIDR notation
+}
+
+// CountryConfig holds when traffic of internal hosts with addresses of specific countries, e.g. sanctioned ones, is
+// alerted of, the countries of addresses being told by a GeoIP database
+type CountryConfig struct {
+	Enabled   bool     // Whether to alert of traffic with the countries
+	Database  string   // Path of the GeoIP database, a CSV file of ranges of addresses or networks and their country codes
+	Countries []string // ISO 3166 codes of the countries alerted of, e.g. KP
+	Threshold uint64   // Bytes exchanged between an internal host and an address of the countries over a report window that raise an alert
+	Internal  []string // Internal hosts, as addresses or networks in CIDR notation. If empty, private and link-local networks.
+	Allowed   []string // Addresses never alerted of, e.g. of CDNs, as addresses or networks in CIDR notation
+}
+
+// ChangeRule holds when a metric of reports changing fast is alerted of, e.g. hits doubling within a minute, however
+// far it is from absolute thresholds
+type ChangeRule struct {
+	Metric   string        // Metric of reports, among hits, bytes, packets and flows
+	Factor   float64       // Ratio of the metric to its value the lookback before that raises an alert. Below 1, the metric dropping, e.g. 0.5 for halving.
+	Lookback time.Duration // Time before a report whose value of the metric it is compared to, of whole report windows
+	Minimum  float64       // Value the metric must reach, before or after the change, for the change to be judged. Leaves out changes of tiny values.
+}
+
+// WatchConfig holds the critical hosts and services watched closely, each with its own counters, handshake latency and
+// alerts of going silent or unreachable, whatever the network filter
+type WatchConfig struct {
+	Targets []string      // Targets, as host, host:port or :port, hosts being addresses or hostnames
+	Silence time.Duration // Time without traffic of a target past which it is alerted of as silent
+}
+
+// SplitTarget returns the host and port of a watched target, given as host, host:port, [IPv6]:port or :port. The
+// host is empty for a port on any host, and the port 0 for any port of the host.
+func SplitTarget(target string) (string, uint16, error) {
+	if !strings.Contains(target, ":") || (!strings.HasPrefix(target, "[") && strings.Count(target, ":") > 1) {
+		return target, 0, nil
+	}
+
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid watched target %s : %s", target, err)
+	}
+	number, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || number == 0 {
+		return "", 0, fmt.Errorf("invalid port of watched target %s", target)
+	}
+
+	return host, uint16(number), nil
+}
+
+// Expression returns the network filter matching the traffic of the watched targets, empty if there are none.
+// Hostnames are resolved when it is compiled.
+func (w *WatchConfig) Expression() string {
+	var terms []string
+	for _, target := range w.Targets {
+		host, port, err := SplitTarget(target)
+		if err != nil {
+			continue
+		}
+		switch {
+		case host == "":
+			terms = append(terms, fmt.Sprintf("port %d", port))
+		case port == 0:
+			terms = append(terms, "host "+host)
+		default:
+			terms = append(terms, fmt.Sprintf("(host %s and port %d)", host, port))
+		}
+	}
+
+	return strings.Join(terms, " or ")
+}
+
+// Filter returns the network filter widened to the traffic of the watched targets, so that it is seen whatever the
+// filter. An empty filter already captures it.
+func (w *WatchConfig) Filter(network string) string {
+	expression := w.Expression()
+	if expression == "" || network == "" {
+		return network
+	}
+
+	return "(" + network + ") or " + expression
+}
+
+// ErrorRateConfig holds when spikes of the share of error responses of HTTP hosts are alerted of
+type ErrorRateConfig struct {
+	Enabled      bool    // Whether to alert of error rate spikes
+	Threshold    float64 // Share of 4xx and 5xx responses of a host over a report window that raises an alert, between 0 and 1
+	MinResponses uint    // Responses a host must have sent over the window for its error rate to be judged
+}
+
+// CallQualityConfig holds when VoIP calls whose RTP streams degrade are alerted of
+type CallQualityConfig struct {
+	Enabled    bool          // Whether to alert of degraded calls
+	Jitter     time.Duration // Interarrival jitter of a stream of a call over a report window that raises an alert
+	Loss       float64       // Share of the RTP packets of a call lost over a report window that raises an alert, between 0 and 1
+	MinPackets uint          // RTP packets a call must have received over the window for its quality to be judged
+}
+
+// MailConfig holds which mail traffic is alerted of, outbound SMTP spikes suggesting a host sends spam, and sessions
+// downgraded from STARTTLS
+type MailConfig struct {
+	Spikes     bool // Whether to alert of hosts relaying many SMTP messages to external servers
+	Threshold  uint // SMTP messages a host relays to external servers over a report window that raise an alert
+	Downgrades bool // Whether to send a notice of each mail session downgraded from STARTTLS
+}
+
+// SSHConfig holds which SSH sessions are alerted of, bursts of short sessions suggesting brute force, and sessions to
+// unexpected destinations
+type SSHConfig struct {
+	BruteForce bool          // Whether to alert of clients opening many short sessions to a server
+	Attempts   uint          // Short sessions of a client to a server over a report window that raise an alert
+	Short      time.Duration // Duration under which closed sessions are taken for failed logins
+	Servers    []string      // Expected SSH destinations, as addresses or networks in CIDR notation. If not empty, sessions to others raise an alert.
+}
+
+// NTPConfig holds which NTP traffic is alerted of, hosts syncing to unexpected servers, and servers sending far more
+// bytes to a host than it queried, as amplification attacks make them
+type NTPConfig struct {
+	Servers       []string // Expected NTP servers, as addresses or networks in CIDR notation. If not empty, hosts syncing to others raise an alert.
+	Amplification bool     // Whether to alert of NTP amplification
+	Ratio         float64  // Ratio of the bytes a server sends a host to those the host queried it with that raises an alert
+	MinBytes      uint64   // Bytes a server must have sent a host over a report window for their ratio to be judged
+}
+
+// TLSPolicyConfig holds the versions and cipher suites TLS handshakes must comply with, those violating it being
+// alerted of
+type TLSPolicyConfig struct {
+	Enabled    bool     // Whether to alert of handshakes violating the policy
+	MinVersion string   // Oldest version servers may negotiate, among 1.0, 1.1, 1.2 and 1.3. If empty, any is.
+	Ciphers    []string // Forbidden cipher suites, as parts of their IANA names, e.g. RC4 or 3DES
+}
+
+// DecryptionConfig holds how the TLS traffic of services the operator controls is decrypted in memory, with the secrets
+// their clients or servers log in the NSS key log format, for analyzers to read the HTTP it carries. Only AES-GCM
+// cipher suites of TLS 1.2 and 1.3 are decrypted.
+type DecryptionConfig struct {
+	Enabled bool          // Whether to decrypt TLS traffic. Off unless explicitly enabled, as analysis then reads the content of the traffic.
+	KeyLog  string        // Path of the key log file, e.g. that of SSLKEYLOGFILE, followed as it grows. Empty if secrets are only received on the socket.
+	Socket  string        // Path of a Unix socket key log lines are received on, e.g. from a sidecar. Empty for none.
+	Servers []string      // Services whose TLS traffic is decrypted, as addresses or networks in CIDR notation
+	Refresh time.Duration // Period at which the key log file is read for new secrets
+}
+
+// StallConfig holds when TCP connections are taken for stalled, their data in flight going unacknowledged or their
+// receiver keeping a zero window for long, and when receivers closing their window over and over are reported, as
+// overloaded receivers or broken middleboxes make them
+type StallConfig struct {
+	Timeout     time.Duration // Time without forward progress of data in flight, or of a zero window, past which a connection is stalled
+	ZeroWindows uint          // Times a receiver closes its window to zero past which its connection is reported
+}
+
+// ARPConfig holds how ARP packets are watched, to alert of an IP address claimed by several hardware addresses, as ARP
+// spoofing makes it, and of gateways whose hardware address changes
+type ARPConfig struct {
+	Enabled  bool          // Whether to let ARP packets through filters, and alert of conflicts
+	Window   time.Duration // Time frame within which an IP address claimed by another hardware address raises an alert
+	Gateways []string      // Addresses of gateways, whose hardware address changing at any time raises an alert
+}
+
+// Filter returns the network filter widened to ARP packets if they are watched. An empty filter already captures them.
+func (a *ARPConfig) Filter(network string) string {
+	if !a.Enabled || network == "" {
+		return network
+	}
+
+	return "(" + network + ") or arp"
+}
+
+// LingerConfig holds how connections are followed across report windows, to report those open for long, e.g. forgotten
+// tunnels, and those gone idle without being closed, e.g. stuck connections or keepalive leaks
+type LingerConfig struct {
+	Enabled    bool          // Whether to report long-lived and stale connections
+	LongLived  time.Duration // Age past which connections still open are reported as long-lived
+	Stale      time.Duration // Idle time past which TCP connections neither closed nor reset are reported as stale
+	Expiry     time.Duration // Idle time past which connections are forgotten, stale ones included
+	MaxTracked int           // Maximum number of connections followed at once, past which new ones are ignored. 0 for no limit.
+}
+
+// DockerConfig holds how traffic is attributed to the Docker containers owning its addresses and interfaces
+type DockerConfig struct {
+	Enabled bool          // Whether to label flow records and top talkers with the containers they belong to
+	Socket  string        // Path of the unix socket of the Docker Engine API
+	Refresh time.Duration // Period at which containers are listed again
+	Timeout time.Duration // Timeout of a request to the Docker Engine API
+}
+
+// ProcessConfig holds how traffic is attributed to the local processes owning its sockets, as told by procfs
+type ProcessConfig struct {
+	Enabled bool          // Whether to label flow records with local processes, and report the top processes by traffic
+	Refresh time.Duration // Period at which sockets and their processes are listed again. Shorter catches briefer connections.
+}
+
+// KubernetesConfig holds how traffic is attributed to the pods and services owning its addresses, watched through the
+// Kubernetes API, e.g. when gonetmon runs as a DaemonSet
+type KubernetesConfig struct {
+	Enabled   bool          // Whether to label flow records and top talkers with workloads, and alerts with the node
+	APIServer string        // URL of the API server. If empty, the in-cluster address of the kubernetes service.
+	TokenFile string        // Path of the bearer token authenticating to the API server, read again at each request
+	CAFile    string        // Certificate authorities to verify the API server against
+	Node      string        // Node whose pods are watched. If empty, that in the NODE_NAME variable, else all pods.
+	Resync    time.Duration // Period after which watches are renewed from a complete list
+	Timeout   time.Duration // Timeout of a list request
+}
+
+// NodeName returns the node whose pods are watched, from the configuration or the NODE_NAME variable usually set
+// through the downward API of DaemonSets. It is empty if neither sets it.
+func (k *KubernetesConfig) NodeName() string {
+	if k.Node != "" {
+		return k.Node
+	}
+
+	return os.Getenv("NODE_NAME")
+}
+
+// Filter holds different filters on different levels to apply and tag data
+type Filter struct {
+	Network     string // BPF filter to filter traffic at data layer
+	Application string // String to look for in Application Layer
+	Type        string // Monitor filter in case further development adds other traffic analysis
+}
+
+// MetricsConfig holds configuration for exporting metrics to a StatsD or Graphite endpoint
+type MetricsConfig struct {
+	Network string // Transport protocol to reach the endpoint, either "udp" or "tcp"
+	Address string // Address of the endpoint, in the host:port form
+	Prefix  string // Prefix prepended to all metric names
+}
+
+// OTLPConfig holds configuration for exporting metrics to an OpenTelemetry collector
+type OTLPConfig struct {
+	Endpoint    string            // URL of the collector's OTLP/HTTP metrics receiver
+	Headers     map[string]string // Additional headers sent with each export, e.g. for authentication
+	ServiceName string            // Value of the service.name resource attribute
+	Timeout     time.Duration     // Timeout of an export request
+}
+
+// KafkaConfig holds configuration for publishing reports, alerts and flow records to Kafka topics.
+// Leaving a topic empty disables publishing the corresponding records.
+type KafkaConfig struct {
+	Brokers     []string      // Addresses of the bootstrap brokers, in the host:port form
+	ReportTopic string        // Topic to publish reports to
+	AlertTopic  string        // Topic to publish alerts to
+	FlowTopic   string        // Topic to publish flow records to, one message per flow
+	RollupTopic string        // Topic to publish hourly and daily rollups to
+	BeatTopic   string        // Topic to publish heartbeats to
+	Timeout     time.Duration // Timeout of a write to the brokers
+}
+
+// TLSConfig holds the files and options needed to set up a TLS connection to a remote endpoint
+type TLSConfig struct {
+	Enabled            bool   // Whether to use TLS at all
+	CAFile             string // PEM encoded certificate authorities to verify the server against. If empty, use the system's.
+	CertFile           string // PEM encoded client certificate, for mutual authentication
+	KeyFile            string // PEM encoded private key of the client certificate
+	InsecureSkipVerify bool   // Do not verify the server's certificate chain and host name. Do not use in production.
+}
+
+// ServerTLSConfig holds the files needed to serve TLS, and to authenticate clients by certificate
+type ServerTLSConfig struct {
+	CertFile     string // PEM encoded certificate of the server. If empty, TLS is not served.
+	KeyFile      string // PEM encoded private key of the certificate
+	ClientCAFile string // PEM encoded certificate authorities clients must present a certificate signed by. If empty, clients are not asked for one.
+}
+
+// MQTTConfig holds configuration for publishing reports and alerts to an MQTT broker
+type MQTTConfig struct {
+	Broker      string        // URL of the broker, e.g. tcp://host:1883 or ssl://host:8883
+	ClientID    string        // Identifier of this client on the broker
+	Username    string        // Username, if the broker requires authentication
+	Password    string        // Password, if the broker requires authentication
+	TopicPrefix string        // Reports, alerts, rollups and heartbeats are published to <prefix>/reports, <prefix>/alerts, <prefix>/rollups and <prefix>/heartbeats
+	QoS         byte          // MQTT quality of service level : 0, 1 or 2
+	Retain      bool          // Whether the broker should retain the last message of each topic
+	TLS         TLSConfig     // TLS configuration of the connection to the broker
+	Timeout     time.Duration // Timeout of connection and publication
+}
+
+// NATSConfig holds configuration for publishing reports, alerts and flow records to a NATS server.
+// Leaving a subject empty disables publishing the corresponding records.
+type NATSConfig struct {
+	URL           string        // URL of the server, e.g. nats://host:4222
+	Token         string        // Authentication token, if the server requires one
+	ReportSubject string        // Subject to publish reports to
+	AlertSubject  string        // Subject to publish alerts to
+	FlowSubject   string        // Subject to publish flow records to, one message per flow
+	RollupSubject string        // Subject to publish hourly and daily rollups to
+	BeatSubject   string        // Subject to publish heartbeats to
+	TLS           TLSConfig     // TLS configuration of the connection to the server
+	Timeout       time.Duration // Timeout of connection and flushes
+}
+
+// ElasticsearchConfig holds configuration for indexing flow records and alerts into Elasticsearch or OpenSearch.
+// Index names may contain a {date} placeholder, replaced by the record's date formatted with DateLayout.
+type ElasticsearchConfig struct {
+	URL        string        // Base URL of the cluster, e.g. http://host:9200
+	Username   string        // Username for basic authentication, if required
+	Password   string        // Password for basic authentication, if required
+	FlowIndex  string        // Name of the index to write flow records to. If empty, flows are not indexed.
+	AlertIndex string        // Name of the index to write alerts to. If empty, alerts are not indexed.
+	DateLayout string        // Go time layout used to replace the {date} placeholder of index names
+	Retries    int           // Number of attempts of a bulk request before giving up
+	Backoff    time.Duration // Time to wait before the first retry, doubled at each subsequent attempt
+	TLS        TLSConfig     // TLS configuration of the connection to the cluster
+	Timeout    time.Duration // Timeout of a bulk request
+}
+
+// LokiConfig holds configuration for pushing report lines and alerts to Grafana Loki
+type LokiConfig struct {
+	URL      string            // URL of the push API, e.g. http://host:3100/loki/api/v1/push
+	TenantID string            // Tenant to push to, sent as X-Scope-OrgID. If empty, no tenant is specified.
+	Labels   map[string]string // Labels attached to all streams. A "type" label set to report or alert is added.
+	Retries  int               // Number of attempts of a push before giving up
+	Backoff  time.Duration     // Time to wait before the first retry, doubled at each subsequent attempt
+	TLS      TLSConfig         // TLS configuration of the connection to Loki
+	Timeout  time.Duration     // Timeout of a push request
+}
+
+// SplunkConfig holds configuration for sending reports, flow records and alerts to a Splunk HTTP Event Collector
+type SplunkConfig struct {
+	URL       string        // URL of the collector's event endpoint, e.g. https://host:8088/services/collector/event
+	Token     string        // HEC token
+	Index     string        // Index to store events in. If empty, the token's default index is used.
+	Source    string        // Source field of events. Their sourcetype is the source suffixed with :report, :flow or :alert.
+	BatchSize int           // Maximum number of events sent in a single request
+	Retries   int           // Number of attempts of a request before giving up
+	Backoff   time.Duration // Time to wait before the first retry, doubled at each subsequent attempt
+	TLS       TLSConfig     // TLS configuration of the connection to the collector
+	Timeout   time.Duration // Timeout of a request
+}
+
+// ClickHouseConfig holds the configuration of the clickhouse output, inserting flow records through the HTTP interface
+type ClickHouseConfig struct {
+	URL           string        // URL of the HTTP interface, e.g. http://host:8123
+	Database      string        // Database of the flow table
+	Table         string        // Name of the flow table
+	Username      string        // Username, if authentication is required
+	Password      string        // Password of the user
+	CreateTable   bool          // Whether to create the flow table on startup if it does not exist
+	BatchSize     int           // Number of flow records buffered before they are inserted
+	FlushInterval time.Duration // Maximum time flow records are buffered before they are inserted, checked on each report
+	Retries       int           // Number of attempts of a request before giving up
+	Backoff       time.Duration // Time to wait before the first retry, doubled at each subsequent attempt
+	TLS           TLSConfig     // TLS configuration of the connection to the server
+	Timeout       time.Duration // Timeout of a request
+}
+
+// SIEMConfig holds configuration for sending security events in CEF or LEEF format to a SIEM over syslog
+type SIEMConfig struct {
+	Format  string // Event format, either cef or leef
+	Network string // Transport protocol to reach the syslog server : udp, tcp, or empty for the local syslog daemon
+	Address string // Address of the syslog server, in the host:port form. Ignored if Network is empty.
+	Tag     string // Syslog tag of messages
+}
+
+// DesktopConfig holds the configuration of the desktop output
+type DesktopConfig struct {
+	Recoveries bool          // Whether to also notify when traffic recovers
+	Timeout    time.Duration // Time allowed to the notification command to return
+}
+
+// ServerConfig holds the configuration of the embedded HTTP server
+type ServerConfig struct {
+	Address        string        // Address to listen on, in the host:port form
+	AllowedOrigins []string      // Origins allowed to open cross origin streams, "*" allowing any. Same origin streams are always allowed.
+	ClientBufSize  uint          // Number of events queued for a streaming client before dropping new ones
+	WriteTimeout   time.Duration // Time allowed to write an event to a client
+	StaleAfter     time.Duration // Age after which the last packet of an interface or the last report is considered stale by the health endpoints
+}
+
+// ControlConfig holds the configuration of the HTTP control API
+type ControlConfig struct {
+	Enabled    bool   // Whether to serve the control API
+	Address    string // Address to listen on, in the host:port form
+	Token      string // Bearer token required from clients. If empty, requests are not authenticated.
+	AlertCache int    // Number of recent alerts kept for acknowledgement
+}
+
+// GRPCConfig holds the configuration of the gRPC API
+type GRPCConfig struct {
+	Enabled       bool   // Whether to serve the gRPC API
+	Address       string // Address to listen on, in the host:port form
+	Token         string // Bearer token required from clients in the authorization metadata. If empty, calls are not authenticated.
+	ClientBufSize uint   // Number of reports or alerts queued for a streaming client before dropping new ones
+}
+
+// AgentConfig holds the configuration of the agent output, forwarding reports and alerts to a central aggregator
+type AgentConfig struct {
+	URL     string        // URL of the ingestion endpoint of the aggregator, e.g. https://host:8090/ingest
+	Name    string        // Name of this agent in the aggregator. If empty, the host name is used.
+	Token   string        // Bearer token identifying this agent to the aggregator, if it requires one
+	Flows   bool          // Whether to also forward the flow records of each report
+	Retries int           // Number of attempts of a request before giving up
+	Backoff time.Duration // Time to wait before the first retry, doubled at each subsequent attempt
+	TLS     TLSConfig     // TLS configuration of the connection to the aggregator
+	Timeout time.Duration // Timeout of a request
+}
+
+// AggregatorConfig holds the configuration of the aggregator, merging the reports and alerts forwarded by agents
+type AggregatorConfig struct {
+	Address        string            // Address to listen on, in the host:port form
+	AlertSpan      time.Duration     // Time frame over which the hits of all agents are summed for global alerts
+	AlertThreshold uint              // Number of hits of all agents over the span above which a global alert is raised. 0 disables global alerts.
+	StaleAfter     time.Duration     // Time without events after which an agent is shown as stale
+	TopTalkers     int               // Number of IP addresses sending the most bytes across agents shown on the dashboard
+	TLS            ServerTLSConfig   // TLS served to agents and dashboard clients, and authentication of agents by certificate
+	Tokens         map[string]string // Bearer tokens of agents, indexed by agent name. If empty, agents are not asked for one.
+}
+
+// DebugConfig holds the configuration of the diagnostics server, exposing pprof profiles and pipeline counters
+type DebugConfig struct {
+	Enabled bool   // Whether to serve diagnostics. Profiles expose internals of the process, so keep the address private.
+	Address string // Address to listen on, in the host:port form
+}
+
+// SQLiteConfig holds the configuration of the sqlite output
+type SQLiteConfig struct {
+	Path            string        // Path of the database file, created if it does not exist
+	Flows           bool          // Whether to also record the flow records of each report
+	ReportRetention time.Duration // Age past which reports, and their flows, are pruned. 0 keeps them forever.
+	AlertRetention  time.Duration // Age past which alerts are pruned. 0 keeps them forever.
+	FlowRetention   time.Duration // Age past which flow records are pruned. 0 keeps them as long as their report.
+	PruneInterval   time.Duration // Period at which expired data is pruned
+}
+
+// FlightRecorderConfig holds the configuration of the flight recorder, keeping recent packets in memory for dumps
+type FlightRecorderConfig struct {
+	Enabled    bool          // Whether to record packets
+	Span       time.Duration // Time frame of packets kept in memory
+	MaxPackets uint          // Maximum number of packets kept in memory, whatever their age
+	Directory  string        // Directory pcap dumps are written to
+	OnAlert    bool          // Whether to dump recorded packets when an alert is raised
+	Evidence   bool          // Whether to dump the packets that made an alert's hits to a pcap file referenced by the alert
+	MaxDumps   int           // Number of dumps kept in the directory, past which the oldest are removed. 0 keeps them all.
+	Format     string        // Format of dumps, pcap or pcapng. Pcapng dumps describe the capture interfaces, and the rule of the alert they are evidence of.
+}
+
+// SidecarConfig holds the configuration of an external process extending gonetmon, exchanging JSON lines over its
+// standard input and output
+type SidecarConfig struct {
+	Name    string        // Name the sidecar is registered under, to be enabled in Analyzers or Outputs
+	Kind    string        // Either analyzer, receiving packets and answering events, or output, receiving reports and alerts
+	Command string        // Path of the executable
+	Args    []string      // Arguments of the executable
+	Timeout time.Duration // Maximum time to wait for an analyzer's answer, or for the process to exit when closed
+}
+
+// ExtensionsConfig holds third-party analyzers and outputs to load at start up
+type ExtensionsConfig struct {
+	Plugins  []string        // Paths of Go plugins to open, which register analyzers and outputs when loaded
+	Sidecars []SidecarConfig // External processes acting as analyzers or outputs
+}
+
+// LogConfig holds the level, format and destination of the application's logs
+type LogConfig struct {
+	Level       string         // Minimum level of logged messages, among debug, info, warning and error
+	Format      string         // Layout of log lines, either text or json. Journald receives messages and fields as journal fields.
+	Destination string         // Where logs are written once capture is set up, among stderr, file, syslog, journald and auto
+	File        string         // Path of the log file, for the file destination
+	Rotation    RotationConfig // Rotation of the log file
+}
+
+// RotationConfig holds when a file written continuously is rotated, and how many of its rotated files are kept
+type RotationConfig struct {
+	MaxSize    int64         // Size (bytes) past which the file is rotated. 0 disables rotation by size.
+	MaxAge     time.Duration // Age past which the file is rotated. 0 disables rotation by age.
+	MaxBackups int           // Number of rotated files kept, past which the oldest are removed. 0 keeps them all.
+	Compress   bool          // Whether rotated files are compressed with gzip
+}
+
+// SessionConfig holds the overrides of a monitoring session, an independent pipeline capturing, analysing and
+// alerting on its own traffic. Empty fields inherit the value of the process-wide parameters.
+type SessionConfig struct {
+	Name           string        // Name of the session, labelling its alerts, logs and queues
+	Filter         Filter        // Capture filters of the session
+	Interfaces     []string      // Interfaces the session captures on
+	Outputs        []string      // Output destinations of the reports and alerts of the session
+	Analyzers      []string      // Analyzers enabled in the session
+	AlertSpan      time.Duration // Time frame over which the hits of the session are counted
+	AlertThreshold uint          // Number of hits of the session over the span that triggers an alert
+}
+
+// Logger is the logger shared by all packages, writing to stderr until redirected by the application
+var Logger = logrus.New()
+
+// Parameters holds the application's parameters it runs on
+type Parameters struct {
+
+	// Monitoring sessions run side by side in the process. If empty, a single session runs on the parameters below.
+	Sessions []SessionConfig
+	Session  string // Name of the session these parameters are derived for, empty for the single default session
+
+	// Raw data parameters
+	PacketFilter  Filter
+	CaptureConfig CaptureConfig
+	Interfaces    []string // Array of interfaces to specifically listen on. If nil, listen on all devices.
+
+	FlightRecorder FlightRecorderConfig // Recording of recent packets, dumped on alerts or on request
+
+	// Display related parameters
+	DisplayRefresh time.Duration  // Period (seconds) to renew display print, thus also used for capture and reporting
+	Outputs        []string       // Output destinations, among console, statsd, graphite, otlp, kafka, mqtt, nats, elasticsearch, loki, splunk, siem, eve, zeek, history, desktop, server, sqlite, clickhouse and agent
+	OutputBufSize  uint           // Number of reports and alerts queued for an output before dropping new ones
+	ReportTemplate string         // Path to a text/template file laying out console reports. If empty, use the default layout.
+	Colour         bool           // Whether the console highlights alerts, recoveries and top host changes with ANSI colours
+	SparkWindows   uint           // Number of reports plotted by the console's per interface sparklines. 0 disables them.
+	ReportSections []string       // Sections of reports sent to outputs, e.g. interfaces, flows, http or tcp. If empty, all of them.
+	ReportSizes    map[string]int // Maximum number of entries of the lists of report sections, by section. Sections left out are not cut.
+	Heartbeat      time.Duration  // Period of the heartbeats sent to outputs supporting them, telling the monitor is alive. 0 disables them.
+	SelfTest       string         // Self-test of outputs at start, among off, warn and fail
+	Metrics        MetricsConfig  // Endpoint configuration for the statsd and graphite outputs
+	OTLP           OTLPConfig     // Collector configuration for the otlp output
+	Kafka          KafkaConfig    // Brokers and topics configuration for the kafka output
+	MQTT           MQTTConfig     // Broker configuration for the mqtt output
+	NATS           NATSConfig     // Server and subjects configuration for the nats output
+
+	Elasticsearch ElasticsearchConfig // Cluster and index configuration for the elasticsearch output
+	Loki          LokiConfig          // Push API configuration for the loki output
+	Splunk        SplunkConfig        // HTTP Event Collector configuration for the splunk output
+	SIEM          SIEMConfig          // Format and syslog configuration for the siem output
+	EVEFile       string              // Path of the file the eve output appends events to
+	ZeekFile      string              // Path of the conn.log file the zeek output appends flow records to
+	ZeekFormat    string              // Layout of the zeek output, either tsv or json
+	HistoryFile   string              // Path of the file the history output records reports and alerts to
+	FileRotation  RotationConfig      // Rotation of the eve, zeek and history files
+	Desktop       DesktopConfig       // Notification configuration for the desktop output
+	Server        ServerConfig        // Embedded HTTP server configuration for the server output
+	SQLite        SQLiteConfig        // Database configuration for the sqlite output
+	ClickHouse    ClickHouseConfig    // Server and table configuration for the clickhouse output
+	Agent         AgentConfig         // Aggregator configuration for the agent output
+	Rollups       []string            // Periods over which reports are summarised for outputs supporting rollups, among hourly and daily
+
+	Extensions ExtensionsConfig // Go plugins and sidecar processes providing additional analyzers and outputs
+	Control    ControlConfig    // HTTP API to query and control a running monitor
+	GRPC       GRPCConfig       // gRPC API exposing the configuration, and streaming reports and alerts
+	Aggregator AggregatorConfig // Central instance merging the reports and alerts of agents, run by the aggregate command
+	Debug      DebugConfig      // Diagnostics server exposing pprof profiles and pipeline counters
+	Log        LogConfig        // Application logs
+
+	// Time related parameters
+	TimeLayout string         // Layout of timestamps printed in the console, alerts and summaries, as defined by the time package
+	TimeZone   *time.Location // Time zone of timestamps in all outputs
+
+	// Analysis related parameters
+	Analyzers       []string          // Analyzers interpreting captured packets, among http, dns, tls, os, discovery, voip, mail, ssh, ntp, arp, mtu, stall and those registered by the application. Filters must let their traffic through.
+	AnalysisWorkers int               // Number of workers analysing packets in parallel, each with its own analyzers
+	FlowTable       FlowTableConfig   // Limits of the flow table
+	Inventory       InventoryConfig   // Persistent inventory of the hosts of monitored segments
+	Capacity        CapacityConfig    // Long-term bandwidth trends of interfaces, and forecasts of links reaching their capacity
+	Storms          StormConfig       // Detection of broadcast and multicast storms on interfaces
+	Integrity       IntegrityConfig   // Detection of corrupt packets on interfaces, by checksums, truncation and malformed headers
+	DSCP            bool              // Whether to break the traffic of interfaces down by DSCP class, to check QoS markings against policy
+	Matrix          MatrixConfig      // Accounting of the traffic between groups of networks
+	Uploads         UploadConfig      // Detection of large uploads to external destinations, e.g. data exfiltration
+	Countries       CountryConfig     // Detection of traffic with addresses of specific countries
+	Changes         []ChangeRule      // Detection of metrics of reports changing fast, each rule with its own lookback
+	Watch           WatchConfig       // Critical hosts and services watched closely, whatever the network filter
+	Lingering       LingerConfig      // Reports of long-lived and stale connections
+	ErrorRates      ErrorRateConfig   // Detection of spikes of HTTP error responses of hosts
+	CallQuality     CallQualityConfig // Detection of VoIP calls of degraded quality
+	Mail            MailConfig        // Detection of outbound SMTP spikes and STARTTLS downgrades
+	SSH             SSHConfig         // Detection of SSH brute force and sessions to unexpected destinations
+	NTP             NTPConfig         // Detection of hosts syncing to unexpected NTP servers and of NTP amplification
+	ARP             ARPConfig         // Detection of ARP spoofing and of gateways changing hardware address
+	TLSPolicy       TLSPolicyConfig   // Detection of TLS handshakes negotiating forbidden versions or cipher suites
+	Decryption      DecryptionConfig  // In-memory decryption of the TLS traffic of owned services, with key logs
+	Stall           StallConfig       // Detection of TCP connections stalled or repeatedly advertising a zero window
+	AlertSpan       time.Duration     // Time (seconds) frame to monitor (and retain) traffic behaviour
+	AlertThreshold  uint              // Number of request over time frame (hits/span) that will trigger an alert
+	WatchdogTick    time.Duration     // Period (milliseconds, preferably) over which to check for alerts
+	WatchdogBufSize uint              // Size of the channel used to receive hit notification. Make it arbitrarily high. TODO: There may be a better way to do this
+
+	// Attribution of traffic to the workloads owning its addresses
+	Docker     DockerConfig     // Docker containers
+	Kubernetes KubernetesConfig // Kubernetes pods and services
+	Processes  ProcessConfig    // Local processes, Linux only
+}
+
+// Default values for Parameter object
+const (
+	// Capture default
+	defNetworkFilter             = "tcp and port 80"
+	defApplicationFilter         = "HTTP"
+	defApplicationType           = DataHTTP
+	defSnapshotLen         int32 = 1024
+	defPromiscuousMode           = false
+	defCaptureTimeout            = defDisplayRefresh
+	defCaptureSource             = PcapSource
+	defCaptureNamespace          = ""
+	defCaptureBackpressure       = BlockPolicy
+	defCaptureBatchSize          = 64
+	defCaptureBatchTimeout       = 10 * time.Millisecond
+	defCaptureMergeFiles         = false
+	defCaptureReplaySpeed        = 1.0
+
+	// Flight recorder
+	defRecorderEnabled    = false
+	defRecorderSpan       = 30 * time.Second
+	defRecorderMaxPackets = 100000
+	defRecorderDirectory  = "./dumps"
+	defRecorderOnAlert    = true
+	defRecorderEvidence   = true
+	defRecorderMaxDumps   = 100
+	defRecorderFormat     = PcapFormat
+
+	// Display Parameters
+	defDisplayRefresh = 5 * time.Second
+	defOutput         = ConsoleOutput // Default output destination
+	defOutputBufSize  = 64
+	defSparkWindows   = 20
+	defHeartbeat      = 0
+	defSelfTest       = OffSelfTest
+
+	// Metrics export
+	defMetricsNetwork = "udp"
+	defMetricsAddress = "127.0.0.1:8125"
+	defMetricsPrefix  = "gonetmon"
+
+	// OpenTelemetry export
+	defOTLPEndpoint    = "http://127.0.0.1:4318/v1/metrics"
+	defOTLPServiceName = "gonetmon"
+	defOTLPTimeout     = 5 * time.Second
+
+	// Kafka export
+	defKafkaBroker      = "127.0.0.1:9092"
+	defKafkaReportTopic = "gonetmon-reports"
+	defKafkaAlertTopic  = "gonetmon-alerts"
+	defKafkaFlowTopic   = "gonetmon-flows"
+	defKafkaRollupTopic = "gonetmon-rollups"
+	defKafkaBeatTopic   = "gonetmon-heartbeats"
+	defKafkaTimeout     = 10 * time.Second
+
+	// MQTT export
+	defMQTTBroker      = "tcp://127.0.0.1:1883"
+	defMQTTClientID    = "gonetmon"
+	defMQTTTopicPrefix = "gonetmon"
+	defMQTTQoS         = 1
+	defMQTTTimeout     = 10 * time.Second
+
+	// NATS export
+	defNATSURL           = "nats://127.0.0.1:4222"
+	defNATSReportSubject = "gonetmon.reports"
+	defNATSAlertSubject  = "gonetmon.alerts"
+	defNATSFlowSubject   = "gonetmon.flows"
+	defNATSRollupSubject = "gonetmon.rollups"
+	defNATSBeatSubject   = "gonetmon.heartbeats"
+	defNATSTimeout       = 5 * time.Second
+
+	// Elasticsearch export
+	defElasticsearchURL        = "http://127.0.0.1:9200"
+	defElasticsearchFlowIndex  = "gonetmon-flows-{date}"
+	defElasticsearchAlertIndex = "gonetmon-alerts-{date}"
+	defElasticsearchDateLayout = "2006.01.02"
+	defElasticsearchRetries    = 3
+	defElasticsearchBackoff    = 500 * time.Millisecond
+	defElasticsearchTimeout    = 10 * time.Second
+
+	// Loki export
+	defLokiURL     = "http://127.0.0.1:3100/loki/api/v1/push"
+	defLokiJob     = "gonetmon"
+	defLokiRetries = 3
+	defLokiBackoff = 500 * time.Millisecond
+	defLokiTimeout = 10 * time.Second
+
+	// Splunk export
+	defSplunkURL       = "https://127.0.0.1:8088/services/collector/event"
+	defSplunkSource    = "gonetmon"
+	defSplunkBatchSize = 100
+	defSplunkRetries   = 3
+	defSplunkBackoff   = 500 * time.Millisecond
+	defSplunkTimeout   = 10 * time.Second
+
+	// ClickHouse export
+	defClickHouseURL           = "http://127.0.0.1:8123"
+	defClickHouseDatabase      = "default"
+	defClickHouseTable         = "gonetmon_flows"
+	defClickHouseCreateTable   = true
+	defClickHouseBatchSize     = 10000
+	defClickHouseFlushInterval = time.Minute
+	defClickHouseRetries       = 3
+	defClickHouseBackoff       = 500 * time.Millisecond
+	defClickHouseTimeout       = 30 * time.Second
+
+	// SIEM export
+	defSIEMFormat  = CEFFormat
+	defSIEMNetwork = "udp"
+	defSIEMAddress = "127.0.0.1:514"
+	defSIEMTag     = "gonetmon"
+
+	// Suricata EVE export
+	defEVEFile = "./eve.json"
+
+	// Zeek conn.log export
+	defZeekFile   = "./conn.log"
+	defZeekFormat = TSVFormat
+
+	// History
+	DefHistoryFile = "./gonetmon-history.jsonl"
+
+	// Rotation of output files
+	defFileRotationMaxSize    = 100 << 20
+	defFileRotationMaxAge     = 0
+	defFileRotationMaxBackups = 10
+	defFileRotationCompress   = true
+
+	// Desktop notifications
+	defDesktopRecoveries = true
+	defDesktopTimeout    = 5 * time.Second
+
+	// Control API
+	defControlEnabled    = false
+	defControlAddress    = "127.0.0.1:8081"
+	defControlAlertCache = 100
+
+	// gRPC API
+	defGRPCEnabled       = false
+	defGRPCAddress       = "127.0.0.1:8082"
+	defGRPCClientBufSize = 64
+
+	// Agent output
+	defAgentURL     = "http://127.0.0.1:8090/ingest"
+	defAgentFlows   = false
+	defAgentRetries = 3
+	defAgentBackoff = 500 * time.Millisecond
+	defAgentTimeout = 10 * time.Second
+
+	// Aggregator
+	defAggregatorAddress        = "127.0.0.1:8090"
+	defAggregatorAlertSpan      = time.Minute
+	defAggregatorAlertThreshold = 100
+	defAggregatorStaleAfter     = time.Minute
+	defAggregatorTopTalkers     = 10
+
+	// Diagnostics server
+	defDebugEnabled = false
+	defDebugAddress = "127.0.0.1:6060"
+
+	// Logs
+	defLogLevel       = "info"
+	defLogFormat      = TextFormat
+	defLogDestination = FileLog
+	DefLogFile        = "./log-gonetmon.log"
+	defLogMaxSize     = 100 << 20
+	defLogMaxAge      = 7 * 24 * time.Hour
+	defLogMaxBackups  = 5
+	defLogCompress    = true
+
+	// Embedded server
+	defServerAddress       = "127.0.0.1:8080"
+	defServerClientBufSize = 64
+	defServerWriteTimeout  = 10 * time.Second
+	defServerStaleAfter    = time.Minute
+
+	// SQLite persistence
+	DefSQLitePath            = "./gonetmon.db"
+	defSQLiteFlows           = false
+	defSQLiteReportRetention = 90 * 24 * time.Hour
+	defSQLiteAlertRetention  = 90 * 24 * time.Hour
+	defSQLiteFlowRetention   = 7 * 24 * time.Hour
+	defSQLitePruneInterval   = time.Hour
+
+	// Analysis defaults
+	defAnalyzer             = HTTPAnalyzer
+	defAnalysisWorkers      = 1
+	defFlowTableMaxFlows    = 100000
+	defFlowTableMaxMemory   = 64 << 20
+	defFlowTableIdleTimeout = 2 * time.Minute
+	defInventoryEnabled     = false
+	DefInventoryFile        = "./gonetmon-hosts.json"
+	defInventoryVendors     = "/usr/share/wireshark/manuf"
+	defInventoryAlertNew    = true
+	defCapacityEnabled      = false
+	DefCapacityFile         = "./gonetmon-trends.json"
+	defCapacityHorizon      = 30
+	defCapacityHistory      = 90
+	defCapacityMinDays      = 7
+	defStormsEnabled        = false
+	defStormsBroadcast      = 500
+	defStormsMulticast      = 2000
+	defUploadsEnabled       = false
+	defUploadsThreshold     = 500 << 20
+	defUploadsSpan          = 10 * time.Minute
+	defCountriesEnabled     = false
+	defCountriesDatabase    = ""
+	defCountriesThreshold   = 1
+	defWatchSilence         = time.Minute
+	defLingeringEnabled     = false
+	defLingeringLongLived   = time.Hour
+	defLingeringStale       = 10 * time.Minute
+	defLingeringExpiry      = 2 * time.Hour
+	defLingeringMaxTracked  = 100000
+	defErrorRatesEnabled    = false
+	defErrorRatesThreshold  = 0.2
+	defErrorRatesMinimum    = 20
+	defCallQualityEnabled   = false
+	defCallQualityJitter    = 30 * time.Millisecond
+	defCallQualityLoss      = 0.05
+	defCallQualityMinimum   = 100
+	defMailSpikes           = false
+	defMailThreshold        = 100
+	defMailDowngrades       = false
+	defSSHBruteForce        = false
+	defSSHAttempts          = 10
+	defSSHShort             = 10 * time.Second
+	defNTPAmplification     = false
+	defNTPRatio             = 10
+	defNTPMinBytes          = 100 << 10
+	defARPEnabled           = false
+	defARPWindow            = 5 * time.Minute
+	defTLSPolicyEnabled     = false
+	defTLSPolicyMinVersion  = "1.2"
+	defDecryptionEnabled    = false
+	defDecryptionRefresh    = time.Second
+	defStallTimeout         = 30 * time.Second
+	defStallZeroWindows     = 3
+	defIntegrityChecksums   = false
+	defIntegrityEnabled     = false
+	defIntegrityThreshold   = 0.01
+	defIntegrityMinPackets  = 1000
+	defDSCP                 = false
+	defMatrixOthers         = "internet"
+
+	// Workload attribution defaults
+	defDockerEnabled       = false
+	defDockerSocket        = "/var/run/docker.sock"
+	defDockerRefresh       = 10 * time.Second
+	defDockerTimeout       = 5 * time.Second
+	defKubernetesEnabled   = false
+	defKubernetesAPIServer = ""
+	defKubernetesTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	defKubernetesCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	defKubernetesNode      = ""
+	defKubernetesResync    = 5 * time.Minute
+	defKubernetesTimeout   = 30 * time.Second
+	defProcessesEnabled    = false
+	defProcessesRefresh    = 2 * time.Second
+
+	// Watchdog defaults
+	defAlertSpan        = 10 * time.Second
+	defAlertThreshold   = 4
+	defaultWatchdogTick = 500 * time.Millisecond
+	defaultBufSize      = 1000
+
+	// General
+	DefTimeLayout = "2006-01-02 15:04:05.000"
+)
+
+// LoadParams loads the application's parameters it should run on into an object and returns it
+func LoadParams() *Parameters {
+	// Todo : There should be a better way of doing this + argument validation
+
+	return &Parameters{
+		Sessions: nil,
+		Session:  "",
+		PacketFilter: Filter{
+			Network:     defNetworkFilter,
+			Application: defApplicationFilter,
+			Type:        defApplicationType,
+		},
+		CaptureConfig: CaptureConfig{
+			SnapshotLen:     defSnapshotLen,
+			PromiscuousMode: defPromiscuousMode,
+			CaptureTimeout:  defCaptureTimeout,
+			Source:          defCaptureSource,
+			Namespace:       defCaptureNamespace,
+			Files:           nil,
+			MergeFiles:      defCaptureMergeFiles,
+			ReplaySpeed:     defCaptureReplaySpeed,
+			Backpressure:    defCaptureBackpressure,
+			BatchSize:       defCaptureBatchSize,
+			BatchTimeout:    defCaptureBatchTimeout,
+			Fanout:          nil,
+		},
+		FlightRecorder: FlightRecorderConfig{
+			Enabled:    defRecorderEnabled,
+			Span:       defRecorderSpan,
+			MaxPackets: defRecorderMaxPackets,
+			Directory:  defRecorderDirectory,
+			OnAlert:    defRecorderOnAlert,
+			Evidence:   defRecorderEvidence,
+			MaxDumps:   defRecorderMaxDumps,
+			Format:     defRecorderFormat,
+		},
+		Interfaces:     nil,
+		DisplayRefresh: defDisplayRefresh,
+		Outputs:        []string{defOutput},
+		OutputBufSize:  defOutputBufSize,
+		ReportTemplate: "",
+		Colour:         os.Getenv("NO_COLOR") == "", // Honour the NO_COLOR convention
+		SparkWindows:   defSparkWindows,
+		ReportSections: nil,
+		ReportSizes:    nil,
+		Heartbeat:      defHeartbeat,
+		SelfTest:       defSelfTest,
+		Metrics: MetricsConfig{
+			Network: defMetricsNetwork,
+			Address: defMetricsAddress,
+			Prefix:  defMetricsPrefix,
+		},
+		OTLP: OTLPConfig{
+			Endpoint:    defOTLPEndpoint,
+			Headers:     nil,
+			ServiceName: defOTLPServiceName,
+			Timeout:     defOTLPTimeout,
+		},
+		Kafka: KafkaConfig{
+			Brokers:     []string{defKafkaBroker},
+			ReportTopic: defKafkaReportTopic,
+			AlertTopic:  defKafkaAlertTopic,
+			FlowTopic:   defKafkaFlowTopic,
+			RollupTopic: defKafkaRollupTopic,
+			BeatTopic:   defKafkaBeatTopic,
+			Timeout:     defKafkaTimeout,
+		},
+		MQTT: MQTTConfig{
+			Broker:      defMQTTBroker,
+			ClientID:    defMQTTClientID,
+			Username:    "",
+			Password:    "",
+			TopicPrefix: defMQTTTopicPrefix,
+			QoS:         defMQTTQoS,
+			Retain:      false,
+			TLS:         TLSConfig{},
+			Timeout:     defMQTTTimeout,
+		},
+		NATS: NATSConfig{
+			URL:           defNATSURL,
+			Token:         "",
+			ReportSubject: defNATSReportSubject,
+			AlertSubject:  defNATSAlertSubject,
+			FlowSubject:   defNATSFlowSubject,
+			RollupSubject: defNATSRollupSubject,
+			BeatSubject:   defNATSBeatSubject,
+			TLS:           TLSConfig{},
+			Timeout:       defNATSTimeout,
+		},
+		Elasticsearch: ElasticsearchConfig{
+			URL:        defElasticsearchURL,
+			Username:   "",
+			Password:   "",
+			FlowIndex:  defElasticsearchFlowIndex,
+			AlertIndex: defElasticsearchAlertIndex,
+			DateLayout: defElasticsearchDateLayout,
+			Retries:    defElasticsearchRetries,
+			Backoff:    defElasticsearchBackoff,
+			TLS:        TLSConfig{},
+			Timeout:    defElasticsearchTimeout,
+		},
+		Loki: LokiConfig{
+			URL:      defLokiURL,
+			TenantID: "",
+			Labels:   map[string]string{"job": defLokiJob},
+			Retries:  defLokiRetries,
+			Backoff:  defLokiBackoff,
+			TLS:      TLSConfig{},
+			Timeout:  defLokiTimeout,
+		},
+		Splunk: SplunkConfig{
+			URL:       defSplunkURL,
+			Token:     "",
+			Index:     "",
+			Source:    defSplunkSource,
+			BatchSize: defSplunkBatchSize,
+			Retries:   defSplunkRetries,
+			Backoff:   defSplunkBackoff,
+			TLS:       TLSConfig{},
+			Timeout:   defSplunkTimeout,
+		},
+		ClickHouse: ClickHouseConfig{
+			URL:           defClickHouseURL,
+			Database:      defClickHouseDatabase,
+			Table:         defClickHouseTable,
+			Username:      "",
+			Password:      "",
+			CreateTable:   defClickHouseCreateTable,
+			BatchSize:     defClickHouseBatchSize,
+			FlushInterval: defClickHouseFlushInterval,
+			Retries:       defClickHouseRetries,
+			Backoff:       defClickHouseBackoff,
+			TLS:           TLSConfig{},
+			Timeout:       defClickHouseTimeout,
+		},
+		Extensions: ExtensionsConfig{
+			Plugins:  nil,
+			Sidecars: nil,
+		},
+		Control: ControlConfig{
+			Enabled:    defControlEnabled,
+			Address:    defControlAddress,
+			Token:      "",
+			AlertCache: defControlAlertCache,
+		},
+		GRPC: GRPCConfig{
+			Enabled:       defGRPCEnabled,
+			Address:       defGRPCAddress,
+			Token:         "",
+			ClientBufSize: defGRPCClientBufSize,
+		},
+		Debug: DebugConfig{
+			Enabled: defDebugEnabled,
+			Address: defDebugAddress,
+		},
+		Log: LogConfig{
+			Level:       defLogLevel,
+			Format:      defLogFormat,
+			Destination: defLogDestination,
+			File:        DefLogFile,
+			Rotation: RotationConfig{
+				MaxSize:    defLogMaxSize,
+				MaxAge:     defLogMaxAge,
+				MaxBackups: defLogMaxBackups,
+				Compress:   defLogCompress,
+			},
+		},
+		SIEM: SIEMConfig{
+			Format:  defSIEMFormat,
+			Network: defSIEMNetwork,
+			Address: defSIEMAddress,
+			Tag:     defSIEMTag,
+		},
+		Desktop: DesktopConfig{
+			Recoveries: defDesktopRecoveries,
+			Timeout:    defDesktopTimeout,
+		},
+		Server: ServerConfig{
+			Address:        defServerAddress,
+			AllowedOrigins: nil,
+			ClientBufSize:  defServerClientBufSize,
+			WriteTimeout:   defServerWriteTimeout,
+			StaleAfter:     defServerStaleAfter,
+		},
+		SQLite: SQLiteConfig{
+			Path:            DefSQLitePath,
+			Flows:           defSQLiteFlows,
+			ReportRetention: defSQLiteReportRetention,
+			AlertRetention:  defSQLiteAlertRetention,
+			FlowRetention:   defSQLiteFlowRetention,
+			PruneInterval:   defSQLitePruneInterval,
+		},
+		Agent: AgentConfig{
+			URL:     defAgentURL,
+			Name:    "",
+			Token:   "",
+			Flows:   defAgentFlows,
+			Retries: defAgentRetries,
+			Backoff: defAgentBackoff,
+			TLS:     TLSConfig{},
+			Timeout: defAgentTimeout,
+		},
+		Aggregator: AggregatorConfig{
+			Address:        defAggregatorAddress,
+			AlertSpan:      defAggregatorAlertSpan,
+			AlertThreshold: defAggregatorAlertThreshold,
+			StaleAfter:     defAggregatorStaleAfter,
+			TopTalkers:     defAggregatorTopTalkers,
+			TLS:            ServerTLSConfig{},
+			Tokens:         nil,
+		},
+		FileRotation: RotationConfig{
+			MaxSize:    defFileRotationMaxSize,
+			MaxAge:     defFileRotationMaxAge,
+			MaxBackups: defFileRotationMaxBackups,
+			Compress:   defFileRotationCompress,
+		},
+		EVEFile:         defEVEFile,
+		ZeekFile:        defZeekFile,
+		ZeekFormat:      defZeekFormat,
+		HistoryFile:     DefHistoryFile,
+		Rollups:         []string{HourlyRollup, DailyRollup},
+		TimeLayout:      DefTimeLayout,
+		TimeZone:        time.Local,
+		Analyzers:       []string{defAnalyzer},
+		AnalysisWorkers: defAnalysisWorkers,
+		FlowTable: FlowTableConfig{
+			MaxFlows:    defFlowTableMaxFlows,
+			MaxMemory:   defFlowTableMaxMemory,
+			IdleTimeout: defFlowTableIdleTimeout,
+		},
+		Inventory: InventoryConfig{
+			Enabled:  defInventoryEnabled,
+			File:     DefInventoryFile,
+			Networks: nil,
+			Vendors:  defInventoryVendors,
+			AlertNew: defInventoryAlertNew,
+		},
+		Capacity: CapacityConfig{
+			Enabled: defCapacityEnabled,
+			File:    DefCapacityFile,
+			Links:   nil,
+			Horizon: defCapacityHorizon,
+			History: defCapacityHistory,
+			MinDays: defCapacityMinDays,
+		},
+		Storms: StormConfig{
+			Enabled:   defStormsEnabled,
+			Broadcast: defStormsBroadcast,
+			Multicast: defStormsMulticast,
+		},
+		Integrity: IntegrityConfig{
+			Checksums:  defIntegrityChecksums,
+			Enabled:    defIntegrityEnabled,
+			Threshold:  defIntegrityThreshold,
+			MinPackets: defIntegrityMinPackets,
+		},
+		DSCP: defDSCP,
+		Matrix: MatrixConfig{
+			Groups: nil,
+			Others: defMatrixOthers,
+		},
+		Uploads: UploadConfig{
+			Enabled:   defUploadsEnabled,
+			Threshold: defUploadsThreshold,
+			Span:      defUploadsSpan,
+			Internal:  nil,
+			Allowed:   nil,
+		},
+		Countries: CountryConfig{
+			Enabled:   defCountriesEnabled,
+			Database:  defCountriesDatabase,
+			Countries: nil,
+			Threshold: defCountriesThreshold,
+			Internal:  nil,
+			Allowed:   nil,
+		},
+		Changes: nil,
+		Watch: WatchConfig{
+			Targets: nil,
+			Silence: defWatchSilence,
+		},
+		Lingering: LingerConfig{
+			Enabled:    defLingeringEnabled,
+			LongLived:  defLingeringLongLived,
+			Stale:      defLingeringStale,
+			Expiry:     defLingeringExpiry,
+			MaxTracked: defLingeringMaxTracked,
+		},
+		ErrorRates: ErrorRateConfig{
+			Enabled:      defErrorRatesEnabled,
+			Threshold:    defErrorRatesThreshold,
+			MinResponses: defErrorRatesMinimum,
+		},
+		CallQuality: CallQualityConfig{
+			Enabled:    defCallQualityEnabled,
+			Jitter:     defCallQualityJitter,
+			Loss:       defCallQualityLoss,
+			MinPackets: defCallQualityMinimum,
+		},
+		Mail: MailConfig{
+			Spikes:     defMailSpikes,
+			Threshold:  defMailThreshold,
+			Downgrades: defMailDowngrades,
+		},
+		SSH: SSHConfig{
+			BruteForce: defSSHBruteForce,
+			Attempts:   defSSHAttempts,
+			Short:      defSSHShort,
+			Servers:    nil,
+		},
+		NTP: NTPConfig{
+			Servers:       nil,
+			Amplification: defNTPAmplification,
+			Ratio:         defNTPRatio,
+			MinBytes:      defNTPMinBytes,
+		},
+		ARP: ARPConfig{
+			Enabled:  defARPEnabled,
+			Window:   defARPWindow,
+			Gateways: nil,
+		},
+		TLSPolicy: TLSPolicyConfig{
+			Enabled:    defTLSPolicyEnabled,
+			MinVersion: defTLSPolicyMinVersion,
+			Ciphers:    []string{"RC4", "3DES", "NULL", "EXPORT"},
+		},
+		Decryption: DecryptionConfig{
+			Enabled: defDecryptionEnabled,
+			KeyLog:  "",
+			Socket:  "",
+			Servers: nil,
+			Refresh: defDecryptionRefresh,
+		},
+		Stall: StallConfig{
+			Timeout:     defStallTimeout,
+			ZeroWindows: defStallZeroWindows,
+		},
+		AlertSpan:       defAlertSpan,
+		AlertThreshold:  defAlertThreshold,
+		WatchdogTick:    defaultWatchdogTick,
+		WatchdogBufSize: defaultBufSize,
+		Docker: DockerConfig{
+			Enabled: defDockerEnabled,
+			Socket:  defDockerSocket,
+			Refresh: defDockerRefresh,
+			Timeout: defDockerTimeout,
+		},
+		Kubernetes: KubernetesConfig{
+			Enabled:   defKubernetesEnabled,
+			APIServer: defKubernetesAPIServer,
+			TokenFile: defKubernetesTokenFile,
+			CAFile:    defKubernetesCAFile,
+			Node:      defKubernetesNode,
+			Resync:    defKubernetesResync,
+			Timeout:   defKubernetesTimeout,
+		},
+		Processes: ProcessConfig{
+			Enabled: defProcessesEnabled,
+			Refresh: defProcessesRefresh,
+		},
+	}
+}
+
+// LoadTimeZone returns the time zone of the given name, e.g. "UTC", "Local" or "Europe/Paris"
+func LoadTimeZone(name string) (*time.Location, error) {
+	zone, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %s : %s", name, err)
+	}
+
+	return zone, nil
+}
+
+// ForSession returns a copy of the parameters with the overrides of the session applied
+func (p *Parameters) ForSession(session *SessionConfig) *Parameters {
+	derived := *p
+	derived.Sessions = nil
+	derived.Session = session.Name
+
+	// Dumps of sessions are kept apart, as each prunes its own
+	derived.FlightRecorder.Directory = filepath.Join(p.FlightRecorder.Directory, session.Name)
+
+	// So are inventories and bandwidth trends, as each saves its own, e.g. to gonetmon-hosts-<session>.json
+	extension := filepath.Ext(p.Inventory.File)
+	derived.Inventory.File = strings.TrimSuffix(p.Inventory.File, extension) + "-" + session.Name + extension
+	extension = filepath.Ext(p.Capacity.File)
+	derived.Capacity.File = strings.TrimSuffix(p.Capacity.File, extension) + "-" + session.Name + extension
+
+	if session.Filter.Network != "" {
+		derived.PacketFilter.Network = session.Filter.Network
+	}
+	if session.Filter.Application != "" {
+		derived.PacketFilter.Application = session.Filter.Application
+	}
+	if len(session.Interfaces) != 0 {
+		derived.Interfaces = session.Interfaces
+	}
+	if len(session.Outputs) != 0 {
+		derived.Outputs = session.Outputs
+	}
+	if len(session.Analyzers) != 0 {
+		derived.Analyzers = session.Analyzers
+	}
+	if session.AlertSpan != 0 {
+		derived.AlertSpan = session.AlertSpan
+	}
+	if session.AlertThreshold != 0 {
+		derived.AlertThreshold = session.AlertThreshold
+	}
+
+	return &derived
+}
+
+// CompressTime divides the periods of reports and the time frames of alerts by speed, so that they cover the same
+// stretch of a capture replayed speed times faster than its original pace. Periods are kept to at least a millisecond.
+func (p *Parameters) CompressTime(speed float64) {
+	compress := func(d time.Duration) time.Duration {
+		if d == 0 {
+			return 0
+		}
+		if c := time.Duration(float64(d) / speed); c > time.Millisecond {
+			return c
+		}
+		return time.Millisecond
+	}
+
+	p.DisplayRefresh = compress(p.DisplayRefresh)
+	p.AlertSpan = compress(p.AlertSpan)
+	p.WatchdogTick = compress(p.WatchdogTick)
+	p.Uploads.Span = compress(p.Uploads.Span)
+	p.Lingering.LongLived = compress(p.Lingering.LongLived)
+	p.Lingering.Stale = compress(p.Lingering.Stale)
+	p.Lingering.Expiry = compress(p.Lingering.Expiry)
+	p.Watch.Silence = compress(p.Watch.Silence)
+	for i := range p.Changes {
+		p.Changes[i].Lookback = compress(p.Changes[i].Lookback)
+	}
+	for i := range p.Sessions {
+		p.Sessions[i].AlertSpan = compress(p.Sessions[i].AlertSpan)
+	}
+}
+
+// Qualify prefixes name with the name of the session, if any, to tell apart the queues and logs of sessions
+func (p *Parameters) Qualify(name string) string {
+	if p.Session == "" {
+		return name
+	}
+
+	return p.Session + "." + name
+}
+
+// FormatTime returns the representation of t in the configured time zone and layout
+func (p *Parameters) FormatTime(t time.Time) string {
+	return t.In(p.TimeZone).Format(p.TimeLayout)
+}
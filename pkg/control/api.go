@@ -0,0 +1,372 @@
+// Package control serves an HTTP API to query and control a running monitor
+package control
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/output"
+	"github.com/bytemare/gonetmon/pkg/version"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var log = config.Logger
+
+// Maximum time to wait for pending requests when closing the API
+const shutdownTimeout = 5 * time.Second
+
+// filtersJSON is the JSON representation of capture filters. Fields left out of a request keep their value.
+type filtersJSON struct {
+	Network     *string `json:"network"`
+	Application *string `json:"application"`
+}
+
+// interfaceJSON is the JSON representation of the counters of a capture source
+type interfaceJSON struct {
+	Received uint64 `json:"received"`
+	Dropped  uint64 `json:"dropped"`
+}
+
+// alertState is an alert kept for acknowledgement, along with its recovery
+type alertState struct {
+	Alert          output.AlertJSON  `json:"alert"`
+	Recovery       *output.AlertJSON `json:"recovery,omitempty"`
+	Acknowledged   bool              `json:"acknowledged"`
+	AcknowledgedAt *time.Time        `json:"acknowledged_at,omitempty"`
+}
+
+// statusJSON is the JSON representation of the state of the monitor
+type statusJSON struct {
+	Version    version.Info             `json:"version"`
+	Started    time.Time                `json:"started"`
+	Uptime     string                   `json:"uptime"`
+	Paused     bool                     `json:"paused"`
+	Filters    filtersJSON              `json:"filters"`
+	Interfaces map[string]interfaceJSON `json:"interfaces"`
+	Alerting   bool                     `json:"alerting"` // Whether the last alert has not recovered yet
+	Alerts     []*alertState            `json:"alerts"`   // Recent alerts, oldest first
+	LastReport *time.Time               `json:"last_report,omitempty"`
+}
+
+// API serves the control API. It is a Sink, keeping the last report and recent alerts it receives.
+type API struct {
+	server     *http.Server
+	devices    *capture.Devices
+	recorder   *capture.FlightRecorder // Nil if disabled
+	token      string
+	started    time.Time
+	timeZone   *time.Location
+	mutex      sync.Mutex
+	report     *output.ReportJSON // Last report, nil until the first one
+	alerts     []*alertState      // Recent alerts, oldest first
+	alertCache int
+}
+
+// NewAPI starts serving the control API on the address configured in parameters, acting on devices and dumping
+// recorder, which may be nil
+func NewAPI(parameters *config.Parameters, devices *capture.Devices, recorder *capture.FlightRecorder) (*API, error) {
+	control := parameters.Control
+
+	if control.AlertCache <= 0 {
+		return nil, errors.New("the control API alert cache size must be positive")
+	}
+
+	listener, err := net.Listen("tcp", control.Address)
+	if err != nil {
+		return nil, fmt.Errorf("could not listen on %s : %s", control.Address, err)
+	}
+
+	a := &API{
+		server:     nil,
+		devices:    devices,
+		recorder:   recorder,
+		token:      control.Token,
+		started:    time.Now(),
+		timeZone:   parameters.TimeZone,
+		mutex:      sync.Mutex{},
+		report:     nil,
+		alerts:     nil,
+		alertCache: control.AlertCache,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", a.handle(http.MethodGet, a.serveStatus))
+	mux.HandleFunc("/report", a.handle(http.MethodGet, a.serveReport))
+	mux.HandleFunc("/filters", a.handle(http.MethodPost, a.serveFilters))
+	mux.HandleFunc("/alerts/", a.handle(http.MethodPost, a.serveAck))
+	mux.HandleFunc("/pause", a.handle(http.MethodPost, a.servePause))
+	mux.HandleFunc("/resume", a.handle(http.MethodPost, a.serveResume))
+	mux.HandleFunc("/dump", a.handle(http.MethodPost, a.serveDump))
+	a.server = &http.Server{Handler: mux}
+
+	go func() {
+		if err := a.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Error("Control API failed : ", err)
+		}
+	}()
+
+	log.Info("Serving control API on ", listener.Addr())
+
+	return a, nil
+}
+
+// writeJSON writes v as the JSON body of a response with the given status code
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Warn("Could not write control API response : ", err)
+	}
+}
+
+// writeError writes an error message as the JSON body of a response with the given status code
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
+
+// handle wraps handler, rejecting requests with another method or without the configured token
+func (a *API) handle(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.token != "" {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, http.StatusUnauthorized, "missing or invalid token")
+				return
+			}
+		}
+
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// alerting tells whether the last alert raised, notices aside, has not recovered yet. The caller holds the mutex.
+func (a *API) alerting() bool {
+	for i := len(a.alerts) - 1; i >= 0; i-- {
+		if !a.alerts[i].Alert.Notice {
+			return a.alerts[i].Recovery == nil
+		}
+	}
+
+	return false
+}
+
+// currentFilters returns the JSON representation of the capture filters
+func (a *API) currentFilters() filtersJSON {
+	filter := a.devices.Filter()
+	return filtersJSON{Network: &filter.Network, Application: &filter.Application}
+}
+
+// serveStatus answers the state of capture, the recent alerts and the time of the last report
+func (a *API) serveStatus(w http.ResponseWriter, r *http.Request) {
+	interfaces := make(map[string]interfaceJSON)
+	for name, stats := range a.devices.Stats() {
+		interfaces[name] = interfaceJSON{Received: stats.Received, Dropped: stats.Dropped}
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	status := statusJSON{
+		Version:    version.Get(),
+		Started:    a.started.In(a.timeZone),
+		Uptime:     time.Since(a.started).Round(time.Second).String(),
+		Paused:     a.devices.Paused(),
+		Filters:    a.currentFilters(),
+		Interfaces: interfaces,
+		Alerting:   a.alerting(),
+		Alerts:     append([]*alertState{}, a.alerts...),
+		LastReport: nil,
+	}
+	if a.report != nil {
+		timestamp := a.report.Timestamp
+		status.LastReport = &timestamp
+	}
+
+	writeJSON(w, http.StatusOK, &status)
+}
+
+// serveReport answers the last report
+func (a *API) serveReport(w http.ResponseWriter, r *http.Request) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.report == nil {
+		writeError(w, http.StatusNotFound, "no report built yet")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a.report)
+}
+
+// serveFilters replaces the capture filters set in the request, and answers the resulting filters
+func (a *API) serveFilters(w http.ResponseWriter, r *http.Request) {
+	var request filtersJSON
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("malformed filters : %s", err))
+		return
+	}
+
+	filter := a.devices.Filter()
+	if request.Network != nil {
+		filter.Network = *request.Network
+	}
+	if request.Application != nil {
+		filter.Application = *request.Application
+	}
+
+	if err := a.devices.SetFilter(filter); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a.currentFilters())
+}
+
+// serveAck acknowledges the alert whose identifier is in the /alerts/{id}/ack path, and answers its state
+func (a *API) serveAck(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/alerts/"), "/")
+	if len(path) != 2 || path[1] != "ack" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	id, err := strconv.ParseUint(path[0], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid alert id : %s", path[0]))
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for _, state := range a.alerts {
+		if state.Alert.ID != id {
+			continue
+		}
+
+		if !state.Acknowledged {
+			now := time.Now().In(a.timeZone)
+			state.Acknowledged = true
+			state.AcknowledgedAt = &now
+			log.Info("Alert ", id, " acknowledged.")
+		}
+
+		writeJSON(w, http.StatusOK, state)
+		return
+	}
+
+	writeError(w, http.StatusNotFound, fmt.Sprintf("unknown alert : %d", id))
+}
+
+// servePause pauses capture
+func (a *API) servePause(w http.ResponseWriter, r *http.Request) {
+	a.devices.Pause()
+	writeJSON(w, http.StatusOK, map[string]bool{"paused": true})
+}
+
+// serveResume resumes capture
+func (a *API) serveResume(w http.ResponseWriter, r *http.Request) {
+	a.devices.Resume()
+	writeJSON(w, http.StatusOK, map[string]bool{"paused": false})
+}
+
+// serveDump dumps the packets of the flight recorder to a file, in the format of the format query parameter if set, and
+// answers with its path
+func (a *API) serveDump(w http.ResponseWriter, r *http.Request) {
+	if a.recorder == nil {
+		writeError(w, http.StatusConflict, "the flight recorder is disabled")
+		return
+	}
+
+	const comment = "Dump requested through the control API"
+
+	var path string
+	var err error
+	switch format := r.URL.Query().Get("format"); format {
+	case "":
+		path, err = a.recorder.Dump("manual", comment, nil)
+	case config.PcapFormat, config.PcapNGFormat:
+		path, err = a.recorder.DumpAs(format, "manual", comment, nil)
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown dump format : %s", format))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("could not dump flight recorder : %s", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"path": path})
+}
+
+// Name returns the name of the control API as an output
+func (a *API) Name() string {
+	return "control"
+}
+
+// SendReport keeps the report as the last one
+func (a *API) SendReport(r *analysis.Report) error {
+	report := output.NewReportJSON(r)
+
+	a.mutex.Lock()
+	a.report = &report
+	a.mutex.Unlock()
+
+	return nil
+}
+
+// SendAlert keeps the alert for acknowledgement, evicting the oldest one if the cache is full, or attaches the recovery
+// to its alert
+func (a *API) SendAlert(m *alert.Message) error {
+	message := output.NewAlertJSON(m)
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if m.Recovery {
+		for _, state := range a.alerts {
+			if state.Alert.ID == m.ID {
+				state.Recovery = &message
+			}
+		}
+		return nil
+	}
+
+	if len(a.alerts) >= a.alertCache {
+		a.alerts = a.alerts[1:]
+	}
+	a.alerts = append(a.alerts, &alertState{
+		Alert:          message,
+		Recovery:       nil,
+		Acknowledged:   false,
+		AcknowledgedAt: nil,
+	})
+
+	return nil
+}
+
+// Close stops serving the control API, waiting for pending requests
+func (a *API) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	return a.server.Shutdown(ctx)
+}
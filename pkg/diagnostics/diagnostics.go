@@ -0,0 +1,355 @@
+// Package diagnostics serves runtime profiles and counters of the pipeline, to profile performance issues in production
+package diagnostics
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var log = config.Logger
+
+const (
+	// Period over which the throughput of stages is measured
+	rateWindow = 10 * time.Second
+
+	// Maximum time to wait for pending requests when closing the server
+	shutdownTimeout = 5 * time.Second
+
+	// Name the diagnostics are published under in /debug/vars
+	varName = "gonetmon"
+)
+
+// Counter counts the items processed by a stage of the pipeline, e.g. captured packets. It is safe for concurrent use.
+type Counter struct {
+	count uint64
+}
+
+// Add adds n to the counter
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.count, n)
+}
+
+// Inc adds 1 to the counter
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.count, 1)
+}
+
+// Value returns the count
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.count)
+}
+
+// Latency measures the time a stage of the pipeline takes to process items. It is safe for concurrent use.
+type Latency struct {
+	count uint64
+	total int64 // Cumulated latency, in nanoseconds
+}
+
+// Observe accounts an item processed in d
+func (l *Latency) Observe(d time.Duration) {
+	atomic.AddUint64(&l.count, 1)
+	atomic.AddInt64(&l.total, int64(d))
+}
+
+// Since accounts an item whose processing started at start
+func (l *Latency) Since(start time.Time) {
+	l.Observe(time.Since(start))
+}
+
+// values returns the number of items observed and their cumulated latency
+func (l *Latency) values() (uint64, time.Duration) {
+	return atomic.LoadUint64(&l.count), time.Duration(atomic.LoadInt64(&l.total))
+}
+
+// Counters, latencies and queues of the pipeline, indexed by name
+var (
+	mutex     sync.Mutex
+	counters  = make(map[string]*Counter)
+	latencies = make(map[string]*Latency)
+	queues    = make(map[string]func() (int, int))
+	rates     = make(map[string]float64) // Throughput of the counters over the last window, per second
+	started   = time.Now()
+)
+
+// NewCounter returns a new counter published under name. It panics if the name is already used, and is meant to be
+// called at start up, e.g. in package variable declarations.
+func NewCounter(name string) *Counter {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if _, ok := counters[name]; ok {
+		panic("diagnostics: NewCounter called twice for counter " + name)
+	}
+
+	c := &Counter{count: 0}
+	counters[name] = c
+
+	return c
+}
+
+// LookupCounter returns the counter published under name, creating it if needed. It is meant for counters named at
+// run time, e.g. after network interfaces.
+func LookupCounter(name string) *Counter {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	c, ok := counters[name]
+	if !ok {
+		c = &Counter{count: 0}
+		counters[name] = c
+	}
+
+	return c
+}
+
+// NewLatency returns a new latency measure published under name. It panics if the name is already used, and is meant
+// to be called at start up, e.g. in package variable declarations.
+func NewLatency(name string) *Latency {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if _, ok := latencies[name]; ok {
+		panic("diagnostics: NewLatency called twice for latency " + name)
+	}
+
+	l := &Latency{count: 0, total: 0}
+	latencies[name] = l
+
+	return l
+}
+
+// RegisterQueue publishes the depth of a queue under name, queue returning its length and capacity, e.g. those of a
+// channel between stages. A queue registered again under the same name replaces the previous one.
+func RegisterQueue(name string, queue func() (length, capacity int)) {
+	mutex.Lock()
+	queues[name] = queue
+	mutex.Unlock()
+}
+
+// LatencySample is the processing latency of a stage between two samples
+type LatencySample struct {
+	Count uint64        // Number of items processed
+	Mean  time.Duration // Mean time taken to process an item
+}
+
+// QueueSample is the occupancy of a queue when sampled
+type QueueSample struct {
+	Length   int
+	Capacity int
+}
+
+// Sample is the activity of the pipeline between two samples, telling whether gonetmon itself is a bottleneck
+type Sample struct {
+	Counts    map[string]uint64        // Items counted by each stage, e.g. processed or dropped packets
+	Latencies map[string]LatencySample // Processing latency of each stage
+	Queues    map[string]QueueSample   // Occupancy of the queues between stages
+}
+
+// latencyTotal is the number of items observed by a latency measure, and their cumulated latency
+type latencyTotal struct {
+	count uint64
+	total time.Duration
+}
+
+// Sampler computes the activity of the pipeline between its successive samples
+type Sampler struct {
+	counts    map[string]uint64       // Counts as of the previous sample
+	latencies map[string]latencyTotal // Latency totals as of the previous sample
+}
+
+// NewSampler returns a sampler whose first sample covers the activity since start up
+func NewSampler() *Sampler {
+	return &Sampler{
+		counts:    make(map[string]uint64),
+		latencies: make(map[string]latencyTotal),
+	}
+}
+
+// Sample returns the activity of the pipeline since the previous sample
+func (s *Sampler) Sample() *Sample {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	sample := &Sample{
+		Counts:    make(map[string]uint64, len(counters)),
+		Latencies: make(map[string]LatencySample, len(latencies)),
+		Queues:    make(map[string]QueueSample, len(queues)),
+	}
+
+	for name, c := range counters {
+		count := c.Value()
+		sample.Counts[name] = count - s.counts[name]
+		s.counts[name] = count
+	}
+
+	for name, l := range latencies {
+		count, total := l.values()
+		previous := s.latencies[name]
+
+		window := LatencySample{Count: count - previous.count, Mean: 0}
+		if window.Count != 0 {
+			window.Mean = (total - previous.total) / time.Duration(window.Count)
+		}
+		sample.Latencies[name] = window
+
+		s.latencies[name] = latencyTotal{count: count, total: total}
+	}
+
+	for name, queue := range queues {
+		length, capacity := queue()
+		sample.Queues[name] = QueueSample{Length: length, Capacity: capacity}
+	}
+
+	return sample
+}
+
+// counterJSON is the JSON representation of a counter
+type counterJSON struct {
+	Count       uint64  `json:"count"`
+	Rate        float64 `json:"rate"`         // Per second, over the last window
+	AverageRate float64 `json:"average_rate"` // Per second, since start
+}
+
+// queueJSON is the JSON representation of the depth of a queue
+type queueJSON struct {
+	Length   int `json:"length"`
+	Capacity int `json:"capacity"`
+}
+
+// snapshotJSON is the JSON representation of the diagnostics published in /debug/vars
+type snapshotJSON struct {
+	Uptime     string                 `json:"uptime"`
+	Goroutines int                    `json:"goroutines"`
+	Stages     map[string]counterJSON `json:"stages"`
+	Latencies  map[string]string      `json:"latencies"` // Mean processing latency of stages, since start
+	Queues     map[string]queueJSON   `json:"queues"`
+}
+
+// snapshot returns the current diagnostics
+func snapshot() interface{} {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	uptime := time.Since(started)
+	s := snapshotJSON{
+		Uptime:     uptime.Round(time.Second).String(),
+		Goroutines: runtime.NumGoroutine(),
+		Stages:     make(map[string]counterJSON, len(counters)),
+		Latencies:  make(map[string]string, len(latencies)),
+		Queues:     make(map[string]queueJSON, len(queues)),
+	}
+
+	for name, c := range counters {
+		count := c.Value()
+		s.Stages[name] = counterJSON{
+			Count:       count,
+			Rate:        rates[name],
+			AverageRate: float64(count) / uptime.Seconds(),
+		}
+	}
+
+	for name, l := range latencies {
+		var mean time.Duration
+		if count, total := l.values(); count != 0 {
+			mean = total / time.Duration(count)
+		}
+		s.Latencies[name] = mean.String()
+	}
+
+	for name, queue := range queues {
+		length, capacity := queue()
+		s.Queues[name] = queueJSON{Length: length, Capacity: capacity}
+	}
+
+	return s
+}
+
+// sampleRates measures the throughput of counters over each window, until ctx is cancelled
+func sampleRates(ctx context.Context) {
+	ticker := time.NewTicker(rateWindow)
+	defer ticker.Stop()
+
+	sampler := NewSampler()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		sample := sampler.Sample()
+
+		mutex.Lock()
+		for name, count := range sample.Counts {
+			rates[name] = float64(count) / rateWindow.Seconds()
+		}
+		mutex.Unlock()
+	}
+}
+
+// publish makes the diagnostics available in /debug/vars, once
+var publish sync.Once
+
+// Server serves the pprof profiles under /debug/pprof/, and the diagnostics of the pipeline along with the runtime
+// memory statistics under /debug/vars
+type Server struct {
+	server *http.Server
+	cancel context.CancelFunc
+}
+
+// NewServer starts serving diagnostics on the address configured in parameters
+func NewServer(parameters *config.Parameters) (*Server, error) {
+	listener, err := net.Listen("tcp", parameters.Debug.Address)
+	if err != nil {
+		return nil, fmt.Errorf("could not listen on %s : %s", parameters.Debug.Address, err)
+	}
+
+	publish.Do(func() {
+		expvar.Publish(varName, expvar.Func(snapshot))
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		server: &http.Server{Handler: mux},
+		cancel: cancel,
+	}
+
+	go sampleRates(ctx)
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Error("Diagnostics server failed : ", err)
+		}
+	}()
+
+	log.Info("Serving diagnostics on ", listener.Addr())
+
+	return s, nil
+}
+
+// Close stops serving diagnostics, waiting for pending requests
+func (s *Server) Close() error {
+	s.cancel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	return s.server.Shutdown(ctx)
+}
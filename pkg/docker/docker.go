@@ -0,0 +1,177 @@
+// Package docker maps the addresses and interfaces of Docker containers to their names, through the Docker Engine API
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var log = config.Logger
+
+// Version of the Docker Engine API requested, the oldest still supported by current engines
+const apiVersion = "v1.24"
+
+// containerJSON is the part of a container of the Docker Engine API's container list gonetmon uses
+type containerJSON struct {
+	ID              string   `json:"Id"`
+	Names           []string `json:"Names"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			IPAddress         string `json:"IPAddress"`
+			GlobalIPv6Address string `json:"GlobalIPv6Address"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// inspectJSON is the part of the Docker Engine API's inspection of a container gonetmon uses
+type inspectJSON struct {
+	State struct {
+		Pid int `json:"Pid"`
+	} `json:"State"`
+}
+
+// Directory holds the names of the running containers, by address and by host side interface of their veth pairs.
+// It is refreshed periodically by Run, and may be read concurrently.
+type Directory struct {
+	client  *http.Client
+	refresh time.Duration
+	mutex   sync.RWMutex
+	ips     map[string]string // Container names, by IP address
+	links   map[string]string // Container names, by host interface of their veth pairs
+	failing bool              // Whether the last refresh failed, to only log the first of consecutive failures
+}
+
+// NewDirectory returns an empty directory of the containers of the Docker Engine listening on the configured socket
+func NewDirectory(docker *config.DockerConfig) *Directory {
+	socket := docker.Socket
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		},
+	}
+
+	return &Directory{
+		client:  &http.Client{Transport: transport, Timeout: docker.Timeout},
+		refresh: docker.Refresh,
+		mutex:   sync.RWMutex{},
+		ips:     make(map[string]string),
+		links:   make(map[string]string),
+		failing: false,
+	}
+}
+
+// Run lists the running containers, and does again periodically until ctx is cancelled
+func (d *Directory) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.refresh)
+	defer ticker.Stop()
+
+	for {
+		d.update(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ByIP returns the name of the container the IP address belongs to, empty if none
+func (d *Directory) ByIP(ip string) string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return d.ips[ip]
+}
+
+// ByInterface returns the name of the container on the other end of the veth pair of the host interface, empty if none
+func (d *Directory) ByInterface(name string) string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return d.links[name]
+}
+
+// update replaces the directory with the running containers. If they cannot be listed, the directory is kept.
+func (d *Directory) update(ctx context.Context) {
+	var containers []containerJSON
+	if err := d.get(ctx, "/containers/json", &containers); err != nil {
+		if !d.failing {
+			log.Error("Could not list Docker containers, flows are attributed to those listed last : ", err)
+		}
+		d.failing = true
+		return
+	}
+	if d.failing {
+		log.Info("Listing Docker containers again.")
+	}
+	d.failing = false
+
+	ips := make(map[string]string)
+	links := make(map[string]string)
+	for _, c := range containers {
+		name := containerName(&c)
+		for _, network := range c.NetworkSettings.Networks {
+			if network.IPAddress != "" {
+				ips[network.IPAddress] = name
+			}
+			if network.GlobalIPv6Address != "" {
+				ips[network.GlobalIPv6Address] = name
+			}
+		}
+
+		// Containers sharing the network of the host, or of another container, have no veth pair of their own. Those with
+		// one are looked up in their network namespace, entered through their process.
+		var inspect inspectJSON
+		if err := d.get(ctx, "/containers/"+c.ID+"/json", &inspect); err != nil || inspect.State.Pid == 0 {
+			continue
+		}
+		for _, link := range hostLinks(inspect.State.Pid) {
+			links[link] = name
+		}
+	}
+
+	d.mutex.Lock()
+	d.ips, d.links = ips, links
+	d.mutex.Unlock()
+}
+
+// get decodes the JSON answer of the Docker Engine API to a GET request of path into v
+func (d *Directory) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, "http://docker/"+apiVersion+path, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("the Docker Engine API answered %s to %s", resp.Status, path)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// containerName returns the name of the container, without the leading slash of the API, or its short ID if unnamed
+func containerName(c *containerJSON) string {
+	if len(c.Names) > 0 {
+		return strings.TrimPrefix(c.Names[0], "/")
+	}
+	if len(c.ID) > 12 {
+		return c.ID[:12]
+	}
+
+	return c.ID
+}
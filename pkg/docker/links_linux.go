@@ -0,0 +1,71 @@
+package docker
+
+import (
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// hostLinks returns the host interfaces peered with the veth interfaces of the network namespace of the process.
+// Interfaces of the namespace whose peer cannot be found are left out.
+func hostLinks(pid int) []string {
+	var peers []int
+	if err := capture.InNamespace(fmt.Sprintf("pid:%d", pid), func() error {
+		var err error
+		peers, err = linkPeers()
+		return err
+	}); err != nil {
+		log.Debug("Could not list the interfaces of container process ", pid, " : ", err)
+		return nil
+	}
+
+	var links []string
+	for _, index := range peers {
+		if intf, err := net.InterfaceByIndex(index); err == nil {
+			links = append(links, intf.Name)
+		}
+	}
+
+	return links
+}
+
+// linkPeers returns the indexes of the peers of the interfaces of the current network namespace linked to another
+// interface, such as veth, as told by rtnetlink. Indexes are those of the namespace of the peers.
+func linkPeers() ([]int, error) {
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETLINK, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return nil, err
+	}
+
+	var peers []int
+	for i := range messages {
+		m := &messages[i]
+		if m.Header.Type != syscall.RTM_NEWLINK || len(m.Data) < syscall.SizeofIfInfomsg {
+			continue
+		}
+		info := (*syscall.IfInfomsg)(unsafe.Pointer(&m.Data[0]))
+
+		attributes, err := syscall.ParseNetlinkRouteAttr(m)
+		if err != nil {
+			continue
+		}
+		for _, a := range attributes {
+			if a.Attr.Type != syscall.IFLA_LINK || len(a.Value) < 4 {
+				continue
+			}
+			// Interfaces that are not linked to another have their own index as link
+			if peer := int(*(*int32)(unsafe.Pointer(&a.Value[0]))); peer != int(info.Index) {
+				peers = append(peers, peer)
+			}
+		}
+	}
+
+	return peers, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package docker
+
+// hostLinks finds no interface, as veth pairs only exist on Linux
+func hostLinks(pid int) []string {
+	return nil
+}
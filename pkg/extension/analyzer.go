@@ -0,0 +1,137 @@
+package extension
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"time"
+)
+
+// packetRequest is the JSON line sent to an analyzer sidecar for each packet with an application layer
+type packetRequest struct {
+	ID        uint64    `json:"id"`
+	Interface string    `json:"interface"`
+	LocalIP   string    `json:"local_ip"`
+	RemoteIP  string    `json:"remote_ip"`
+	Timestamp time.Time `json:"timestamp"`
+	Payload   []byte    `json:"payload"` // Application layer payload, base64 encoded
+}
+
+// eventAnswer is an event extracted by an analyzer sidecar
+type eventAnswer struct {
+	Type       string            `json:"type"`
+	Host       string            `json:"host"`
+	Hit        bool              `json:"hit"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// packetAnswer is the JSON line an analyzer sidecar answers a packetRequest with
+type packetAnswer struct {
+	ID     uint64        `json:"id"` // ID of the request
+	Events []eventAnswer `json:"events"`
+	Error  string        `json:"error,omitempty"` // Set if the packet could not be interpreted
+}
+
+// sidecarAnalyzer is an Analyzer handing packets over to a sidecar process
+type sidecarAnalyzer struct {
+	sidecar *sidecar
+	lastID  uint64
+}
+
+// newSidecarAnalyzer starts the sidecar process and returns an Analyzer to it
+func newSidecarAnalyzer(config *config.SidecarConfig) (*sidecarAnalyzer, error) {
+	s, err := startSidecar(config, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sidecarAnalyzer{
+		sidecar: s,
+		lastID:  0,
+	}, nil
+}
+
+// Name returns the name the sidecar is registered under
+func (a *sidecarAnalyzer) Name() string {
+	return a.sidecar.name
+}
+
+// Match tells whether the packet has a payload to hand over
+func (a *sidecarAnalyzer) Match(data *capture.PacketMsg) bool {
+	return len(data.Payload) > 0
+}
+
+// Process sends the packet to the sidecar and waits for its events, until the timeout.
+// Late answers to previous packets are discarded.
+func (a *sidecarAnalyzer) Process(data *capture.PacketMsg) ([]*analysis.Event, error) {
+	a.lastID++
+	request := packetRequest{
+		ID:        a.lastID,
+		Interface: data.Device,
+		LocalIP:   data.DeviceIP,
+		RemoteIP:  data.RemoteIP,
+		Timestamp: data.Timestamp,
+		Payload:   data.Payload,
+	}
+
+	if err := a.sidecar.send(&request); err != nil {
+		return nil, err
+	}
+
+	timeout := time.NewTimer(a.sidecar.timeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case line, ok := <-a.sidecar.lines:
+			if !ok {
+				return nil, fmt.Errorf("sidecar %s exited", a.sidecar.name)
+			}
+
+			var answer packetAnswer
+			if err := json.Unmarshal(line, &answer); err != nil {
+				log.WithField("sidecar", a.sidecar.name).Warn("Skipping malformed answer : ", err)
+				continue
+			}
+			if answer.ID != request.ID {
+				continue
+			}
+			if answer.Error != "" {
+				return nil, errors.New(answer.Error)
+			}
+
+			return a.events(data, answer.Events), nil
+
+		case <-timeout.C:
+			return nil, fmt.Errorf("sidecar %s did not answer within %s", a.sidecar.name, a.sidecar.timeout)
+		}
+	}
+}
+
+// events converts the events answered by the sidecar for a packet
+func (a *sidecarAnalyzer) events(data *capture.PacketMsg, answers []eventAnswer) []*analysis.Event {
+	events := make([]*analysis.Event, len(answers))
+	for i, e := range answers {
+		events[i] = &analysis.Event{
+			Analyzer:   a.sidecar.name,
+			Type:       e.Type,
+			Device:     data.Device,
+			RemoteIP:   data.RemoteIP,
+			Host:       e.Host,
+			Hit:        e.Hit,
+			Timestamp:  data.Timestamp,
+			Attributes: e.Attributes,
+			Length:     data.Length,
+		}
+	}
+
+	return events
+}
+
+// Close stops the sidecar process
+func (a *sidecarAnalyzer) Close() error {
+	return a.sidecar.close()
+}
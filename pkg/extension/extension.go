@@ -0,0 +1,102 @@
+// Package extension loads third-party analyzers and outputs, from Go plugins or from sidecar processes exchanging
+// JSON lines over their standard input and output
+package extension
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/output"
+	"plugin"
+)
+
+var log = config.Logger
+
+// Function a Go plugin may export to register its analyzers and outputs, if it does not do so in its init functions
+const registerSymbol = "Register"
+
+// Load opens the Go plugins and registers the sidecars configured in parameters, making their analyzers and outputs
+// available to be enabled. It must be called once, before setting up analyzers and outputs.
+func Load(parameters *config.Parameters) error {
+	for _, path := range parameters.Extensions.Plugins {
+		if err := openPlugin(path); err != nil {
+			return err
+		}
+	}
+
+	names := make(map[string]bool, len(parameters.Extensions.Sidecars))
+	for _, sidecar := range parameters.Extensions.Sidecars {
+		if names[sidecar.Name] {
+			return fmt.Errorf("duplicate sidecar name : %s", sidecar.Name)
+		}
+		names[sidecar.Name] = true
+
+		if err := registerSidecar(sidecar); err != nil {
+			return fmt.Errorf("could not register sidecar %s : %s", sidecar.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// openPlugin opens the Go plugin at path, which runs its init functions, and calls its Register function if it has one.
+// Plugins must be built with the same Go version and gonetmon packages as the application.
+func openPlugin(path string) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open plugin %s : %s", path, err)
+	}
+
+	symbol, err := p.Lookup(registerSymbol)
+	if err != nil {
+		// The plugin registered itself in its init functions
+		log.Info("Loaded plugin ", path)
+		return nil
+	}
+
+	register, ok := symbol.(func() error)
+	if !ok {
+		return fmt.Errorf("plugin %s : %s is a %T, not a func() error", path, registerSymbol, symbol)
+	}
+
+	if err := register(); err != nil {
+		return fmt.Errorf("plugin %s failed to register : %s", path, err)
+	}
+
+	log.Info("Loaded plugin ", path)
+
+	return nil
+}
+
+// registerSidecar registers the sidecar as an analyzer or an output, whose process is started when it is set up
+func registerSidecar(sidecar config.SidecarConfig) error {
+	if sidecar.Name == "" {
+		return errors.New("the sidecar name must not be empty")
+	}
+	if sidecar.Timeout <= 0 {
+		return errors.New("the sidecar timeout must be positive")
+	}
+
+	switch sidecar.Kind {
+	case config.AnalyzerSidecar:
+		for _, name := range analysis.RegisteredAnalyzers() {
+			if name == sidecar.Name {
+				return fmt.Errorf("an analyzer is already registered as %s", name)
+			}
+		}
+		analysis.RegisterAnalyzer(sidecar.Name, func(parameters *config.Parameters) (analysis.Analyzer, error) {
+			return newSidecarAnalyzer(&sidecar)
+		})
+
+	case config.OutputSidecar:
+		output.RegisterSink(sidecar.Name, func(parameters *config.Parameters) (output.Sink, error) {
+			return newSidecarSink(&sidecar)
+		})
+
+	default:
+		return fmt.Errorf("unknown sidecar kind : %s", sidecar.Kind)
+	}
+
+	return nil
+}
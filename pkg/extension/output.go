@@ -0,0 +1,44 @@
+package extension
+
+import (
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/output"
+)
+
+// sidecarSink is a Sink writing reports, alerts and rollups as JSON lines to a sidecar process, in the format of the
+// history output. Lines the process writes back are logged.
+type sidecarSink struct {
+	sidecar *sidecar
+}
+
+// newSidecarSink starts the sidecar process and returns a Sink to it
+func newSidecarSink(config *config.SidecarConfig) (*sidecarSink, error) {
+	s, err := startSidecar(config, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sidecarSink{sidecar: s}, nil
+}
+
+// SendReport writes the report to the sidecar
+func (s *sidecarSink) SendReport(r *analysis.Report) error {
+	return s.sidecar.send(output.NewReportEvent(r))
+}
+
+// SendAlert writes the alert to the sidecar
+func (s *sidecarSink) SendAlert(a *alert.Message) error {
+	return s.sidecar.send(output.NewAlertEvent(a))
+}
+
+// SendRollup writes the rollup to the sidecar
+func (s *sidecarSink) SendRollup(r *analysis.Rollup) error {
+	return s.sidecar.send(output.NewRollupEvent(r))
+}
+
+// Close stops the sidecar process
+func (s *sidecarSink) Close() error {
+	return s.sidecar.close()
+}
@@ -0,0 +1,143 @@
+package extension
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Maximum length of a line written by a sidecar
+const maxSidecarLine = 1024 * 1024
+
+// sidecar is a running external process, receiving JSON lines on its standard input and answering on its standard output.
+// It is expected to exit once its standard input is closed.
+type sidecar struct {
+	name    string
+	timeout time.Duration
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stderr  *io.PipeWriter // Logs what the process writes to its standard error
+	encoder *json.Encoder
+	mutex   sync.Mutex    // Serialises writes to the standard input
+	lines   chan []byte   // Lines written to the standard output, closed when it is. Nil if answers are not expected.
+	done    chan struct{} // Closed to stop reading the standard output
+	read    chan struct{} // Closed once the standard output is read entirely
+}
+
+// startSidecar starts the sidecar's process. If answers is false, lines written by the process are logged.
+func startSidecar(config *config.SidecarConfig, answers bool) (*sidecar, error) {
+	cmd := exec.Command(config.Command, config.Args...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stderr := log.WithField("sidecar", config.Name).WriterLevel(logrus.WarnLevel)
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		_ = stderr.Close()
+		return nil, fmt.Errorf("could not start %s : %s", config.Command, err)
+	}
+
+	s := &sidecar{
+		name:    config.Name,
+		timeout: config.Timeout,
+		cmd:     cmd,
+		stdin:   stdin,
+		stderr:  stderr,
+		encoder: json.NewEncoder(stdin),
+		mutex:   sync.Mutex{},
+		lines:   nil,
+		done:    make(chan struct{}),
+		read:    make(chan struct{}),
+	}
+
+	if answers {
+		s.lines = make(chan []byte, 1)
+	}
+
+	go s.readOutput(stdout)
+
+	log.WithFields(logrus.Fields{
+		"sidecar": config.Name,
+		"kind":    config.Kind,
+		"pid":     cmd.Process.Pid,
+	}).Info("Started sidecar.")
+
+	return s, nil
+}
+
+// readOutput hands the lines written by the process to lines, or logs them, until the standard output is closed
+func (s *sidecar) readOutput(stdout io.Reader) {
+	defer close(s.read)
+	if s.lines != nil {
+		defer close(s.lines)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSidecarLine)
+
+	for scanner.Scan() {
+		if s.lines == nil {
+			log.WithField("sidecar", s.name).Info(scanner.Text())
+			continue
+		}
+
+		line := append([]byte(nil), scanner.Bytes()...)
+		select {
+		case s.lines <- line:
+		case <-s.done:
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.WithField("sidecar", s.name).Error("Could not read sidecar output : ", err)
+	}
+}
+
+// send writes v as a JSON line to the standard input of the process
+func (s *sidecar) send(v interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.encoder.Encode(v); err != nil {
+		return fmt.Errorf("could not write to sidecar %s : %s", s.name, err)
+	}
+
+	return nil
+}
+
+// close closes the standard input of the process and waits for it to exit, killing it after the timeout
+func (s *sidecar) close() error {
+	close(s.done)
+	_ = s.stdin.Close()
+
+	select {
+	case <-s.read:
+	case <-time.After(s.timeout):
+		log.Warn("Sidecar ", s.name, " did not exit in time, killing it.")
+		_ = s.cmd.Process.Kill()
+		<-s.read
+	}
+
+	err := s.cmd.Wait()
+	_ = s.stderr.Close()
+
+	log.Info("Sidecar ", s.name, " stopped.")
+
+	return err
+}
@@ -0,0 +1,98 @@
+// Package geoip tells the countries of IP addresses, from a database of the ranges of addresses of countries
+package geoip
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Database holds the ranges of addresses of countries, and may be read concurrently
+type Database struct {
+	ranges []ipRange // Ranges sorted by their first address
+}
+
+// ipRange is a range of addresses of a country, IPv4 addresses being mapped to IPv6
+type ipRange struct {
+	first   net.IP
+	last    net.IP
+	country string
+}
+
+// Load reads a database of the ranges of addresses of countries from a CSV file, e.g. the free country database of
+// DB-IP, of lines of the first and last addresses of a range and of its ISO 3166 country code, e.g.
+// "1.0.0.0,1.0.0.255,AU", or of a network in CIDR notation and its country code, e.g. "1.0.0.0/24,AU". Headers,
+// comments and lines without a country are left out, and fields may be quoted.
+func Load(path string) (*Database, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	db := &Database{ranges: nil}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ",")
+		for i := range fields {
+			fields[i] = strings.Trim(strings.TrimSpace(fields[i]), `"`)
+		}
+
+		var r ipRange
+		switch {
+		case len(fields) >= 2 && strings.Contains(fields[0], "/"):
+			_, network, err := net.ParseCIDR(fields[0])
+			if err != nil {
+				continue
+			}
+			r.first, r.last = network.IP.To16(), make(net.IP, net.IPv6len)
+			mask := network.Mask
+			if len(mask) == net.IPv4len {
+				mask = append(net.CIDRMask(96, 128)[:12], mask...)
+			}
+			for i := range r.first {
+				r.last[i] = r.first[i] | ^mask[i]
+			}
+			r.country = fields[1]
+		case len(fields) >= 3:
+			r.first, r.last = net.ParseIP(fields[0]).To16(), net.ParseIP(fields[1]).To16()
+			r.country = fields[2]
+		}
+		if r.first == nil || r.last == nil || len(r.country) != 2 {
+			continue
+		}
+		r.country = strings.ToUpper(r.country)
+		db.ranges = append(db.ranges, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool { return bytes.Compare(db.ranges[i].first, db.ranges[j].first) < 0 })
+
+	return db, nil
+}
+
+// Country returns the ISO 3166 code of the country of the address, e.g. FR, or an empty string if unknown
+func (d *Database) Country(ip net.IP) string {
+	ip = ip.To16()
+	if ip == nil {
+		return ""
+	}
+
+	// The range holding the address is the last one starting at or before it, if it ends after it
+	i := sort.Search(len(d.ranges), func(i int) bool { return bytes.Compare(d.ranges[i].first, ip) > 0 }) - 1
+	if i < 0 || bytes.Compare(ip, d.ranges[i].last) > 0 {
+		return ""
+	}
+
+	return d.ranges[i].country
+}
+
+// Len returns the number of ranges of the database
+func (d *Database) Len() int {
+	return len(d.ranges)
+}
@@ -0,0 +1,82 @@
+// Package packettest builds packets of synthetic traffic, e.g. to benchmark capture and analysis without a capture
+// file or capture privileges
+package packettest
+
+import (
+	"fmt"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"net"
+	"time"
+)
+
+// Payloads of the HTTP exchanges of HTTPExchanges
+const (
+	httpRequest  = "GET /section%d/index.html HTTP/1.1\r\nHost: www.example.com\r\nUser-Agent: gonetmon-bench\r\n\r\n"
+	httpResponse = "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Length: 0\r\n\r\n"
+)
+
+// HTTPExchanges returns n Ethernet packets of HTTP exchanges between a client and a server, each request followed by
+// its response
+func HTTPExchanges(n int) ([]gopacket.Packet, error) {
+	client, server := net.IP{10, 0, 0, 2}, net.IP{10, 0, 0, 1}
+	clientMAC := net.HardwareAddr{0x02, 0, 0, 0, 0, 0x02}
+	serverMAC := net.HardwareAddr{0x02, 0, 0, 0, 0, 0x01}
+	start := time.Now()
+
+	packets := make([]gopacket.Packet, 0, n)
+	for i := 0; i < n; i++ {
+		exchange := i / 2
+		port := layers.TCPPort(32768 + exchange%4096)
+
+		eth := &layers.Ethernet{SrcMAC: clientMAC, DstMAC: serverMAC, EthernetType: layers.EthernetTypeIPv4}
+		ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: client, DstIP: server}
+		tcp := &layers.TCP{SrcPort: port, DstPort: 80, Seq: 1, Ack: 1, PSH: true, ACK: true, Window: 65535}
+		payload := fmt.Sprintf(httpRequest, exchange%8)
+		if i%2 == 1 {
+			eth.SrcMAC, eth.DstMAC = serverMAC, clientMAC
+			ip.SrcIP, ip.DstIP = server, client
+			tcp.SrcPort, tcp.DstPort = 80, port
+			payload = httpResponse
+		}
+		if err := tcp.SetNetworkLayerForChecksum(ip); err != nil {
+			return nil, err
+		}
+
+		buf := gopacket.NewSerializeBuffer()
+		options := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+		if err := gopacket.SerializeLayers(buf, options, eth, ip, tcp, gopacket.Payload(payload)); err != nil {
+			return nil, err
+		}
+
+		packet := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeEthernet, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+		packet.Metadata().CaptureInfo = gopacket.CaptureInfo{
+			Timestamp:     start.Add(time.Duration(i) * time.Millisecond),
+			CaptureLength: len(buf.Bytes()),
+			Length:        len(buf.Bytes()),
+		}
+		packets = append(packets, packet)
+	}
+
+	return packets, nil
+}
+
+// Cycle returns n packets, cycling through the given ones
+func Cycle(packets []gopacket.Packet, n int) []gopacket.Packet {
+	cycled := make([]gopacket.Packet, n)
+	for i := range cycled {
+		cycled[i] = packets[i%len(packets)]
+	}
+
+	return cycled
+}
+
+// Bytes returns the total length of the packets on the wire
+func Bytes(packets []gopacket.Packet) int {
+	var bytes int
+	for _, packet := range packets {
+		bytes += packet.Metadata().Length
+	}
+
+	return bytes
+}
@@ -0,0 +1,337 @@
+// Package inventory keeps a persistent record of the hosts seen on monitored network segments, with their hardware
+// addresses, vendors, names and protocols
+package inventory
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var log = config.Logger
+
+// Networks whose hosts are inventoried when none are configured : private, unique local and link-local ones
+var defaultNetworks = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16", "fc00::/7", "fe80::/10"}
+
+// Host is a host of the inventory
+type Host struct {
+	IP        string    `json:"ip"`
+	MAC       string    `json:"mac,omitempty"`      // Hardware address the host last sent from, if seen on an Ethernet segment
+	Vendor    string    `json:"vendor,omitempty"`   // Vendor the hardware address was assigned to
+	Hostname  string    `json:"hostname,omitempty"` // Name the host last gave itself, or else its address was given by a DNS answer
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Protocols []string  `json:"protocols,omitempty"` // Transport and application protocols of the host's traffic, sorted
+	Services  []string  `json:"services,omitempty"`  // Types of the services the host advertised through discovery protocols, sorted
+}
+
+// String describes the host by its addresses, vendor and name, e.g. 192.168.1.20 [3c:22:fb:01:02:03 Apple] (ipad.lan)
+func (h *Host) String() string {
+	description := h.IP
+	if h.MAC != "" {
+		description += " [" + strings.TrimSpace(h.MAC+" "+h.Vendor) + "]"
+	}
+	if h.Hostname != "" {
+		description += " (" + h.Hostname + ")"
+	}
+
+	return description
+}
+
+// Sighting is the activity of a host during a report window, as accounted by analysis
+type Sighting struct {
+	MAC       string          // Hardware address the host sent from, empty if unknown
+	FirstSeen time.Time       // Capture timestamp of the first packet of the host in the window
+	LastSeen  time.Time       // Capture timestamp of the last packet of the host in the window
+	Protocols map[string]bool // Transport and application protocols of the host's traffic in the window
+	Services  map[string]bool // Types of the services the host advertised through discovery protocols in the window
+}
+
+// fileJSON is the layout of the inventory file
+type fileJSON struct {
+	Hosts []Host `json:"hosts"`
+}
+
+// Inventory holds the hosts seen on the inventoried networks, loaded from and saved to its file. It may be read
+// concurrently with updates.
+type Inventory struct {
+	file     string
+	networks []*net.IPNet
+	vendors  map[string]string // Vendor names, by first three bytes of hardware addresses as aa:bb:cc
+	mutex    sync.RWMutex
+	hosts    map[string]*Host // Hosts, by IP address
+	dirty    bool             // Whether hosts changed since the inventory was last saved
+}
+
+// New returns the inventory kept in the configured file, which is created on first save if it does not exist
+func New(inventory *config.InventoryConfig) (*Inventory, error) {
+	networks, err := ParseNetworks(inventory.Networks)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts, err := Load(inventory.File)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	i := &Inventory{
+		file:     inventory.File,
+		networks: networks,
+		vendors:  nil,
+		mutex:    sync.RWMutex{},
+		hosts:    make(map[string]*Host, len(hosts)),
+		dirty:    false,
+	}
+	for n := range hosts {
+		i.hosts[hosts[n].IP] = &hosts[n]
+	}
+
+	// Hosts are inventoried without vendors if they cannot be named
+	if inventory.Vendors != "" {
+		if i.vendors, err = LoadVendors(inventory.Vendors); err != nil {
+			log.Warn("Could not load the vendors of hardware addresses, hosts are inventoried without them : ", err)
+		}
+	}
+
+	log.Info("Inventory of ", len(i.hosts), " hosts loaded from ", inventory.File)
+
+	return i, nil
+}
+
+// ParseNetworks parses networks in CIDR notation, returning the default ones if there are none
+func ParseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	if len(cidrs) == 0 {
+		cidrs = defaultNetworks
+	}
+
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid inventoried network : %s", err)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// Load returns the hosts of the inventory file, sorted by address
+func Load(file string) ([]Host, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var inventory fileJSON
+	if err := json.Unmarshal(content, &inventory); err != nil {
+		return nil, fmt.Errorf("could not decode inventory %s : %s", file, err)
+	}
+	sortHosts(inventory.Hosts)
+
+	return inventory.Hosts, nil
+}
+
+// Contains tells whether the IP address belongs to an inventoried network
+func (i *Inventory) Contains(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, network := range i.networks {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Update adds the hosts sighted during a report window to the inventory, and names those whose addresses were given
+// names, by discovery protocols or DNS answers. It returns the hosts never seen before, sorted by address.
+func (i *Inventory) Update(sightings map[string]*Sighting, names map[string]string) []Host {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	var added []Host
+	for ip, sighting := range sightings {
+		host, ok := i.hosts[ip]
+		if !ok {
+			host = &Host{
+				IP:        ip,
+				MAC:       "",
+				Vendor:    "",
+				Hostname:  "",
+				FirstSeen: sighting.FirstSeen,
+				LastSeen:  sighting.LastSeen,
+				Protocols: nil,
+				Services:  nil,
+			}
+			i.hosts[ip] = host
+		}
+
+		if sighting.MAC != "" && sighting.MAC != host.MAC {
+			host.MAC = sighting.MAC
+			host.Vendor = i.vendor(sighting.MAC)
+		}
+		if sighting.LastSeen.After(host.LastSeen) {
+			host.LastSeen = sighting.LastSeen
+		}
+		for protocol := range sighting.Protocols {
+			host.Protocols = addSorted(host.Protocols, protocol)
+		}
+		for service := range sighting.Services {
+			host.Services = addSorted(host.Services, service)
+		}
+
+		if !ok {
+			added = append(added, *host)
+		}
+		i.dirty = true
+	}
+
+	for ip, name := range names {
+		if host, ok := i.hosts[ip]; ok && host.Hostname != name {
+			host.Hostname = name
+			i.dirty = true
+		}
+	}
+
+	// New hosts are described with the name they may have been given in the same window
+	for n := range added {
+		added[n].Hostname = i.hosts[added[n].IP].Hostname
+	}
+	sortHosts(added)
+
+	return added
+}
+
+// Hosts returns the hosts of the inventory, sorted by address
+func (i *Inventory) Hosts() []Host {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	hosts := make([]Host, 0, len(i.hosts))
+	for _, host := range i.hosts {
+		hosts = append(hosts, *host)
+	}
+	sortHosts(hosts)
+
+	return hosts
+}
+
+// Save writes the inventory to its file if it changed since it was last saved. The file is replaced at once, so that
+// it is never left half written.
+func (i *Inventory) Save() error {
+	i.mutex.RLock()
+	dirty := i.dirty
+	i.mutex.RUnlock()
+	if !dirty {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(fileJSON{Hosts: i.Hosts()}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(i.file), 0755); err != nil {
+		return err
+	}
+	temporary := i.file + ".tmp"
+	if err := ioutil.WriteFile(temporary, content, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(temporary, i.file); err != nil {
+		return err
+	}
+
+	i.mutex.Lock()
+	i.dirty = false
+	i.mutex.Unlock()
+
+	return nil
+}
+
+// vendor returns the vendor the hardware address was assigned to, empty if unknown
+func (i *Inventory) vendor(mac string) string {
+	if len(mac) < 8 {
+		return ""
+	}
+
+	return i.vendors[mac[:8]]
+}
+
+// addSorted adds the element to the sorted set, unless it already holds it
+func addSorted(set []string, element string) []string {
+	n := sort.SearchStrings(set, element)
+	if n < len(set) && set[n] == element {
+		return set
+	}
+
+	set = append(set, "")
+	copy(set[n+1:], set[n:])
+	set[n] = element
+	return set
+}
+
+// sortHosts sorts hosts by address, IPv4 ones first
+func sortHosts(hosts []Host) {
+	sort.Slice(hosts, func(a, b int) bool {
+		ipA, ipB := net.ParseIP(hosts[a].IP), net.ParseIP(hosts[b].IP)
+		if (ipA.To4() == nil) != (ipB.To4() == nil) {
+			return ipA.To4() != nil
+		}
+		return string(ipA.To16()) < string(ipB.To16())
+	})
+}
+
+// LoadVendors reads the vendors of hardware address prefixes from a Wireshark manuf file, e.g.
+// "00:00:0C	Cisco	Cisco Systems, Inc", or an IEEE oui.txt file, e.g. "00-00-0C   (hex)		Cisco Systems, Inc".
+// Prefixes longer than three bytes are left out.
+func LoadVendors(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	vendors := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var prefix, vendor string
+		if parts := strings.SplitN(line, "(hex)", 2); len(parts) == 2 {
+			prefix, vendor = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		} else {
+			fields := strings.Split(line, "\t")
+			if len(fields) < 2 {
+				continue
+			}
+			prefix, vendor = fields[0], fields[len(fields)-1]
+		}
+
+		prefix = strings.ToLower(strings.Replace(prefix, "-", ":", -1))
+		if len(prefix) != 8 || vendor == "" {
+			continue
+		}
+		vendors[prefix] = strings.TrimSpace(vendor)
+	}
+
+	return vendors, scanner.Err()
+}
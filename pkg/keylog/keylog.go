@@ -0,0 +1,244 @@
+// Package keylog reads the secrets of TLS sessions from key logs in the NSS format, e.g. the SSLKEYLOGFILE of browsers,
+// curl or servers, so that the traffic of those sessions can be decrypted
+package keylog
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var log = config.Logger
+
+// Number of sessions whose secrets are kept, past which the oldest are forgotten
+const maxSessions = 100000
+
+// Length of the random of a ClientHello, which identifies sessions in key logs
+const randomLength = 32
+
+// Labels of the key log lines holding the secrets used to decrypt application data
+const (
+	clientRandomLabel  = "CLIENT_RANDOM"           // Master secret of a TLS 1.2 session
+	clientTrafficLabel = "CLIENT_TRAFFIC_SECRET_0" // First client application traffic secret of a TLS 1.3 session
+	serverTrafficLabel = "SERVER_TRAFFIC_SECRET_0" // First server application traffic secret of a TLS 1.3 session
+)
+
+// Secrets holds the secrets of a TLS session
+type Secrets struct {
+	Master []byte // Master secret of a TLS 1.2 session, nil for TLS 1.3
+	Client []byte // First client application traffic secret of a TLS 1.3 session
+	Server []byte // First server application traffic secret of a TLS 1.3 session
+}
+
+// Log holds the secrets of TLS sessions, by the random of their ClientHello. It follows a key log file as it grows,
+// and receives key log lines on a Unix socket, with Run, and may be read concurrently.
+type Log struct {
+	path    string        // Path of the key log file, empty if none
+	socket  string        // Path of the socket key log lines are received on, empty if none
+	refresh time.Duration // Period at which the file is read for new lines
+
+	mutex    sync.Mutex
+	sessions map[string]*Secrets // Secrets by ClientHello random
+	order    []string            // Randoms of sessions by arrival, to forget the oldest
+	offset   int64               // Bytes of the file read so far
+	partial  string              // Last line of the file, read before it was complete
+	failing  bool                // Whether the last read of the file failed, to only log the first of consecutive failures
+}
+
+// New returns an empty log of the secrets of the key log file and socket of decryption
+func New(decryption *config.DecryptionConfig) *Log {
+	return &Log{
+		path:     decryption.KeyLog,
+		socket:   decryption.Socket,
+		refresh:  decryption.Refresh,
+		mutex:    sync.Mutex{},
+		sessions: make(map[string]*Secrets),
+		order:    nil,
+		offset:   0,
+		partial:  "",
+		failing:  false,
+	}
+}
+
+// Run reads the key log file, and does again periodically for the lines appended to it, while receiving key log lines
+// on the socket, until ctx is cancelled
+func (l *Log) Run(ctx context.Context) error {
+	if l.socket != "" {
+		listener, err := listen(l.socket)
+		if err != nil {
+			return err
+		}
+		go l.serve(ctx, listener)
+	}
+
+	ticker := time.NewTicker(l.refresh)
+	defer ticker.Stop()
+
+	for {
+		if l.path != "" {
+			l.mutex.Lock()
+			l.readFile()
+			l.mutex.Unlock()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Lookup returns the secrets of the session whose ClientHello has the random. Secrets are often logged right before
+// the traffic they protect, so that the file is read again if the session is unknown.
+func (l *Log) Lookup(random []byte) (Secrets, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	secrets, ok := l.sessions[string(random)]
+	if !ok && l.path != "" {
+		l.readFile()
+		secrets, ok = l.sessions[string(random)]
+	}
+	if !ok {
+		return Secrets{}, false
+	}
+
+	return *secrets, true
+}
+
+// readFile adds the secrets of the lines appended to the key log file since it was last read. A file shorter than what
+// was read was replaced, and is read again from its start.
+func (l *Log) readFile() {
+	file, err := os.Open(l.path)
+	if err != nil {
+		if !l.failing {
+			log.Warn("Could not open the TLS key log : ", err)
+		}
+		l.failing = true
+		return
+	}
+	defer file.Close()
+
+	if info, err := file.Stat(); err == nil && info.Size() < l.offset {
+		l.offset, l.partial = 0, ""
+	}
+	if _, err := file.Seek(l.offset, io.SeekStart); err != nil {
+		log.Warn("Could not read the TLS key log : ", err)
+		return
+	}
+
+	data, err := ioutil.ReadAll(file)
+	l.offset += int64(len(data))
+	if err != nil && !l.failing {
+		log.Warn("Could not read the TLS key log : ", err)
+	}
+	l.failing = err != nil
+
+	lines := strings.Split(l.partial+string(data), "\n")
+	l.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		l.add(line)
+	}
+}
+
+// add keeps the secret of a key log line, e.g. CLIENT_RANDOM <random> <master secret> in hexadecimal. Comments, and
+// the labels of secrets not needed to decrypt application data, are left out.
+func (l *Log) add(line string) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 || strings.HasPrefix(fields[0], "#") {
+		return
+	}
+
+	random, err := hex.DecodeString(fields[1])
+	if err != nil || len(random) != randomLength {
+		return
+	}
+	secret, err := hex.DecodeString(fields[2])
+	if err != nil || len(secret) == 0 {
+		return
+	}
+
+	secrets, ok := l.sessions[string(random)]
+	if !ok {
+		if len(l.order) >= maxSessions {
+			delete(l.sessions, l.order[0])
+			l.order = l.order[1:]
+		}
+		secrets = &Secrets{Master: nil, Client: nil, Server: nil}
+		l.sessions[string(random)] = secrets
+		l.order = append(l.order, string(random))
+	}
+
+	switch fields[0] {
+	case clientRandomLabel:
+		secrets.Master = secret
+	case clientTrafficLabel:
+		secrets.Client = secret
+	case serverTrafficLabel:
+		secrets.Server = secret
+	}
+}
+
+// listen listens on the Unix socket, replacing a socket left over by a previous run
+func listen(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return net.Listen("unix", path)
+}
+
+// serve adds the secrets of the key log lines written by the clients of the socket, until ctx is cancelled
+func (l *Log) serve(ctx context.Context, listener net.Listener) {
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	log.Info("Receiving TLS key log lines on ", l.socket)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Error("Could not accept key log client : ", err)
+			}
+			return
+		}
+
+		go l.receive(ctx, conn)
+	}
+}
+
+// receive adds the secrets of the key log lines written by a client of the socket, until it disconnects or ctx is
+// cancelled
+func (l *Log) receive(ctx context.Context, conn net.Conn) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-done:
+		}
+	}()
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		l.mutex.Lock()
+		l.add(scanner.Text())
+		l.mutex.Unlock()
+	}
+}
@@ -0,0 +1,341 @@
+// Package kubernetes maps the addresses of Kubernetes pods and services to their names, watched through the Kubernetes API
+package kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var log = config.Logger
+
+// Time to wait before listing a resource again after a failure
+const retryDelay = 5 * time.Second
+
+// Types of watch events
+const (
+	addedEvent    = "ADDED"
+	modifiedEvent = "MODIFIED"
+	deletedEvent  = "DELETED"
+	errorEvent    = "ERROR"
+)
+
+// errExpired is returned by a watch whose resource version is too old, for the resource to be listed again
+var errExpired = errors.New("the watched resource version expired")
+
+// objectJSON is the part of a pod or a service of the Kubernetes API gonetmon uses
+type objectJSON struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace"`
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Spec struct {
+		HostNetwork bool     `json:"hostNetwork"`
+		ClusterIP   string   `json:"clusterIP"`
+		ClusterIPs  []string `json:"clusterIPs"`
+	} `json:"spec"`
+	Status struct {
+		PodIP  string `json:"podIP"`
+		PodIPs []struct {
+			IP string `json:"ip"`
+		} `json:"podIPs"`
+	} `json:"status"`
+}
+
+// listJSON is a list of pods or services of the Kubernetes API
+type listJSON struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []objectJSON `json:"items"`
+}
+
+// eventJSON is an event of a watch of the Kubernetes API
+type eventJSON struct {
+	Type   string     `json:"type"`
+	Object objectJSON `json:"object"`
+}
+
+// resource is a kind of objects watched, with the addresses of each of them
+type resource struct {
+	kind    string              // Kind of the objects, prefixed to their names, e.g. pod
+	path    string              // Path of the objects in the API
+	ips     map[string]string   // Names of the objects, by IP address
+	objects map[string][]string // IP addresses of the objects, by name
+	failing bool                // Whether the last list or watch failed, to only log the first of consecutive failures
+}
+
+// Directory holds the names of the pods of a node, or of the cluster, and of the services of the cluster, by address.
+// It is kept up to date by Run, and may be read concurrently.
+type Directory struct {
+	server    string
+	tokenFile string
+	client    *http.Client
+	timeout   time.Duration
+	resync    time.Duration
+	mutex     sync.RWMutex
+	resources []*resource
+}
+
+// NewDirectory returns an empty directory of the pods and services of the configured cluster
+func NewDirectory(kubernetes *config.KubernetesConfig) (*Directory, error) {
+	server := kubernetes.APIServer
+	if server == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, errors.New("no API server configured, and not running in a Kubernetes cluster")
+		}
+		server = "https://" + net.JoinHostPort(host, port)
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if kubernetes.CAFile != "" {
+		pem, err := ioutil.ReadFile(kubernetes.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the certificate authorities of the API server : %s", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", kubernetes.CAFile)
+		}
+	}
+
+	// Pods are those of the node gonetmon watches the traffic of, services are those of the whole cluster
+	pods := "/api/v1/pods"
+	if node := kubernetes.NodeName(); node != "" {
+		pods += "?fieldSelector=" + url.QueryEscape("spec.nodeName="+node)
+	}
+
+	// Watches last until resync, so requests have no overall timeout
+	return &Directory{
+		server:    strings.TrimSuffix(server, "/"),
+		tokenFile: kubernetes.TokenFile,
+		client:    &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig}},
+		timeout:   kubernetes.Timeout,
+		resync:    kubernetes.Resync,
+		mutex:     sync.RWMutex{},
+		resources: []*resource{newResource("pod", pods), newResource("service", "/api/v1/services")},
+	}, nil
+}
+
+// newResource returns an empty resource of the kind, listed and watched at path
+func newResource(kind, path string) *resource {
+	return &resource{
+		kind:    kind,
+		path:    path,
+		ips:     make(map[string]string),
+		objects: make(map[string][]string),
+		failing: false,
+	}
+}
+
+// Run watches pods and services until ctx is cancelled
+func (d *Directory) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, r := range d.resources {
+		wg.Add(1)
+		go func(r *resource) {
+			defer wg.Done()
+			d.follow(ctx, r)
+		}(r)
+	}
+	wg.Wait()
+}
+
+// ByIP returns the workload the IP address belongs to, as pod/<namespace>/<name> or service/<namespace>/<name>, or
+// empty if none
+func (d *Directory) ByIP(ip string) string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	for _, r := range d.resources {
+		if name, ok := r.ips[ip]; ok {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// follow lists the objects of the resource, then watches their changes, listing them again when the watch expires or
+// fails, until ctx is cancelled
+func (d *Directory) follow(ctx context.Context, r *resource) {
+	for ctx.Err() == nil {
+		version, err := d.list(ctx, r)
+		for err == nil && ctx.Err() == nil {
+			version, err = d.watch(ctx, r, version)
+		}
+
+		if err == errExpired || ctx.Err() != nil {
+			continue
+		}
+
+		if !r.failing {
+			log.Error("Could not watch Kubernetes ", r.kind, "s, flows are attributed to those known last : ", err)
+		}
+		r.failing = true
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// list replaces the objects of the resource with those listed, and returns the resource version to watch from
+func (d *Directory) list(ctx context.Context, r *resource) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	resp, err := d.get(ctx, r.path)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var list listJSON
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return "", err
+	}
+
+	if r.failing {
+		log.Info("Watching Kubernetes ", r.kind, "s again.")
+	}
+	r.failing = false
+
+	d.mutex.Lock()
+	r.ips = make(map[string]string)
+	r.objects = make(map[string][]string)
+	for i := range list.Items {
+		r.set(&list.Items[i])
+	}
+	d.mutex.Unlock()
+
+	return list.Metadata.ResourceVersion, nil
+}
+
+// watch applies the changes of the objects of the resource from version on, until the server ends the watch, and
+// returns the version to watch from next
+func (d *Directory) watch(ctx context.Context, r *resource, version string) (string, error) {
+	separator := "?"
+	if strings.Contains(r.path, "?") {
+		separator = "&"
+	}
+	path := fmt.Sprintf("%s%swatch=1&resourceVersion=%s&timeoutSeconds=%d", r.path, separator,
+		url.QueryEscape(version), int(d.resync.Seconds()))
+
+	resp, err := d.get(ctx, path)
+	if err != nil {
+		return version, err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event eventJSON
+		if err := decoder.Decode(&event); err == io.EOF {
+			// Renew the watch from a complete list, not to miss changes lost in between
+			return version, errExpired
+		} else if err != nil {
+			return version, err
+		}
+
+		d.mutex.Lock()
+		switch event.Type {
+		case addedEvent, modifiedEvent:
+			r.set(&event.Object)
+		case deletedEvent:
+			r.remove(&event.Object)
+		}
+		d.mutex.Unlock()
+
+		if event.Type == errorEvent {
+			return version, errExpired
+		}
+		if event.Object.Metadata.ResourceVersion != "" {
+			version = event.Object.Metadata.ResourceVersion
+		}
+	}
+}
+
+// get sends an authenticated GET request of path to the API server, and returns its response if successful
+func (d *Directory) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, d.server+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Service account tokens are rotated, so they are read again at each request
+	if d.tokenFile != "" {
+		token, err := ioutil.ReadFile(d.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the token of the API server : %s", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("the API server answered %s to %s", resp.Status, path)
+	}
+
+	return resp, nil
+}
+
+// set records the addresses of the object, replacing those it had. Pods sharing the network of their node are left
+// out, as their address is not theirs alone.
+func (r *resource) set(o *objectJSON) {
+	r.remove(o)
+	if o.Spec.HostNetwork {
+		return
+	}
+
+	name := r.kind + "/" + o.Metadata.Namespace + "/" + o.Metadata.Name
+
+	var ips []string
+	for _, ip := range append([]string{o.Status.PodIP, o.Spec.ClusterIP}, o.Spec.ClusterIPs...) {
+		// Headless services have no cluster IP
+		if ip != "" && ip != "None" {
+			ips = append(ips, ip)
+		}
+	}
+	for _, ip := range o.Status.PodIPs {
+		if ip.IP != "" {
+			ips = append(ips, ip.IP)
+		}
+	}
+
+	for _, ip := range ips {
+		r.ips[ip] = name
+	}
+	r.objects[name] = ips
+}
+
+// remove forgets the addresses of the object
+func (r *resource) remove(o *objectJSON) {
+	name := r.kind + "/" + o.Metadata.Namespace + "/" + o.Metadata.Name
+	for _, ip := range r.objects[name] {
+		if r.ips[ip] == name {
+			delete(r.ips, ip)
+		}
+	}
+	delete(r.objects, name)
+}
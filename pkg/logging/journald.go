@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Socket of journald's native protocol
+const journaldSocket = "/run/systemd/journal/socket"
+
+// journaldHook sends log entries to journald over its native protocol, with the priority of their level
+type journaldHook struct {
+	conn *net.UnixConn
+}
+
+// newJournaldHook connects to the socket of journald
+func newJournaldHook() (*journaldHook, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journaldSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	return &journaldHook{conn: conn}, nil
+}
+
+// Levels returns all levels, the level of the logger filtering entries beforehand
+func (h *journaldHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire sends the entry as a journal entry. Its fields are sent as journal fields, e.g. "remote IP" as REMOTE_IP, so
+// that they can be filtered on with journalctl.
+func (h *journaldHook) Fire(entry *logrus.Entry) error {
+	var datagram bytes.Buffer
+	writeJournalField(&datagram, "MESSAGE", entry.Message)
+	writeJournalField(&datagram, "PRIORITY", strconv.Itoa(syslogPriority(entry.Level)))
+	writeJournalField(&datagram, "SYSLOG_IDENTIFIER", identifier)
+
+	for key, value := range entry.Data {
+		name := journalFieldName(key)
+		if name == "" {
+			continue
+		}
+		writeJournalField(&datagram, name, fmt.Sprint(value))
+	}
+
+	_, err := h.conn.Write(datagram.Bytes())
+
+	return err
+}
+
+// journalFieldName returns the name of the journal field of a log field, in upper case with underscores in place of
+// other characters, or an empty string if it cannot be one. Fields of journald itself, prefixed with an underscore,
+// and those set by the hook are left out.
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+
+	switch {
+	case name == "", name[0] == '_', name[0] >= '0' && name[0] <= '9':
+		return ""
+	case name == "MESSAGE", name == "PRIORITY", name == "SYSLOG_IDENTIFIER":
+		return ""
+	}
+
+	return name
+}
+
+// underJournald tells whether the standard error of the process is connected to the journal, as systemd does for
+// services
+func underJournald() bool {
+	return os.Getenv("JOURNAL_STREAM") != ""
+}
+
+// writeJournalField writes a field in the native protocol of journald. Values spanning several lines are prefixed with
+// their length instead of following an equal sign.
+func writeJournalField(w *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		w.WriteString(name + "=" + value + "\n")
+		return
+	}
+
+	w.WriteString(name + "\n")
+	_ = binary.Write(w, binary.LittleEndian, uint64(len(value)))
+	w.WriteString(value + "\n")
+}
@@ -0,0 +1,141 @@
+// Package logging sets up the level, format and destination of the application's logs
+package logging
+
+import (
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+)
+
+// Identifier of the application in syslog and journald
+const identifier = "gonetmon"
+
+var log = config.Logger
+
+// Setup applies the level, format and destination of logs to logger
+func Setup(logger *logrus.Logger, logs config.LogConfig) error {
+	level, err := logrus.ParseLevel(logs.Level)
+	if err != nil {
+		return fmt.Errorf("invalid log level : %s", err)
+	}
+
+	var formatter logrus.Formatter
+	switch logs.Format {
+	case config.TextFormat:
+		formatter = &logrus.TextFormatter{
+			ForceColors:      false,
+			DisableColors:    false,
+			DisableTimestamp: false,
+			FullTimestamp:    true,
+			TimestampFormat:  "",
+		}
+	case config.JSONFormat:
+		formatter = &logrus.JSONFormatter{
+			TimestampFormat:  "",
+			DisableTimestamp: false,
+			PrettyPrint:      false,
+		}
+	default:
+		return fmt.Errorf("unknown log format : %s", logs.Format)
+	}
+
+	destination := logs.Destination
+	if destination == config.AutoLog {
+		destination = config.FileLog
+		if underJournald() {
+			destination = config.JournaldLog
+		}
+	}
+
+	switch destination {
+	case config.StderrLog:
+		logger.SetOutput(os.Stderr)
+
+	case config.FileLog:
+		file, err := OpenRotatingFile(logs.File, logs.Rotation)
+		if err != nil {
+			return fmt.Errorf("could not open log file : %s", err)
+		}
+		logger.SetOutput(file)
+
+	case config.SyslogLog:
+		hook, err := newSyslogHook()
+		if err != nil {
+			return fmt.Errorf("could not connect to syslog : %s", err)
+		}
+		logger.AddHook(hook)
+		logger.SetOutput(ioutil.Discard)
+
+	case config.JournaldLog:
+		hook, err := newJournaldHook()
+		if err != nil {
+			return fmt.Errorf("could not connect to journald : %s", err)
+		}
+		logger.AddHook(hook)
+		logger.SetOutput(ioutil.Discard)
+
+	default:
+		return fmt.Errorf("unknown log destination : %s", logs.Destination)
+	}
+
+	logger.SetLevel(level)
+	logger.SetFormatter(formatter)
+
+	return nil
+}
+
+// CheckConfig tells whether the level, format and destination of logs are valid, without opening the destination
+func CheckConfig(logs config.LogConfig) []string {
+	var problems []string
+
+	if _, err := logrus.ParseLevel(logs.Level); err != nil {
+		problems = append(problems, fmt.Sprintf("invalid log level : %s", err))
+	}
+
+	switch logs.Format {
+	case config.TextFormat, config.JSONFormat:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown log format : %s", logs.Format))
+	}
+
+	switch logs.Destination {
+	case config.StderrLog, config.SyslogLog, config.JournaldLog:
+	case config.FileLog, config.AutoLog:
+		if logs.File == "" {
+			problems = append(problems, "the log file must be set for the file destination")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown log destination : %s", logs.Destination))
+	}
+
+	problems = append(problems, CheckRotation("log file", logs.Rotation)...)
+
+	return problems
+}
+
+// CheckRotation tells whether the rotation of the named file is valid
+func CheckRotation(name string, rotation config.RotationConfig) []string {
+	if rotation.MaxSize < 0 || rotation.MaxAge < 0 || rotation.MaxBackups < 0 {
+		return []string{fmt.Sprintf("the rotation limits of the %s must not be negative", name)}
+	}
+
+	return nil
+}
+
+// syslogPriority returns the syslog severity of a log level
+func syslogPriority(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return 2 // Critical
+	case logrus.ErrorLevel:
+		return 3 // Error
+	case logrus.WarnLevel:
+		return 4 // Warning
+	case logrus.InfoLevel:
+		return 6 // Informational
+	default:
+		return 7 // Debug
+	}
+}
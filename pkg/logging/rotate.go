@@ -0,0 +1,323 @@
+package logging
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Layout of the timestamp suffixed to rotated files
+	rotationLayout = "20060102T150405.000"
+
+	// Suffix of compressed rotated files
+	gzipSuffix = ".gz"
+)
+
+// RotatingFile is a file appended to, which is renamed aside with a timestamp suffix and started anew once it exceeds
+// its maximum size or age. Rotated files are compressed and pruned in the background. It is safe for concurrent use.
+type RotatingFile struct {
+	mutex    sync.Mutex
+	path     string
+	rotation config.RotationConfig // Age is counted from when the file is opened
+	header   func(w io.Writer) error
+	file     *os.File
+	size     int64
+	opened   time.Time
+	cleaning sync.Mutex     // Serialises the compression and pruning of rotated files
+	cleanUps sync.WaitGroup // Pending compressions and prunings, waited for on Close
+}
+
+// OpenRotatingFile opens the file at path for appending, creating it if needed, to be rotated as configured
+func OpenRotatingFile(path string, rotation config.RotationConfig) (*RotatingFile, error) {
+	f := &RotatingFile{
+		mutex:    sync.Mutex{},
+		path:     path,
+		rotation: rotation,
+		header:   nil,
+		file:     nil,
+		size:     0,
+		opened:   time.Time{},
+		cleaning: sync.Mutex{},
+		cleanUps: sync.WaitGroup{},
+	}
+
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// SetHeader sets a header written at the start of each file started on rotation, e.g. to describe its fields
+func (f *RotatingFile) SetHeader(header func(w io.Writer) error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.header = header
+}
+
+// open opens the file at the path of f for appending
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	f.file, f.size, f.opened = file, info.Size(), time.Now()
+
+	return nil
+}
+
+// Write appends p to the file, rotating it first if writing p would exceed its maximum size, or if it is too old
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	maxSize, maxAge := f.rotation.MaxSize, f.rotation.MaxAge
+	if f.size > 0 && ((maxSize > 0 && f.size+int64(len(p)) > maxSize) || (maxAge > 0 && time.Since(f.opened) > maxAge)) {
+		if err := f.rotate(); err != nil && f.file == nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+
+	return n, err
+}
+
+// rotate renames the file aside and opens a new one in its place. If renaming fails, the file is reopened to keep
+// appending to it.
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	rotated := rotatedPath(f.path, time.Now())
+	renameErr := os.Rename(f.path, rotated)
+
+	if err := f.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		// Retry once the file grew by its maximum size again, rather than on every write
+		f.size = 0
+		return fmt.Errorf("could not rotate %s : %s", f.path, renameErr)
+	}
+
+	f.cleanUps.Add(1)
+	go f.cleanUp(rotated)
+
+	if f.header != nil {
+		if err := f.header(f.file); err != nil {
+			return fmt.Errorf("could not write header of %s : %s", f.path, err)
+		}
+		if info, err := f.file.Stat(); err == nil {
+			f.size = info.Size()
+		}
+	}
+
+	return nil
+}
+
+// cleanUp compresses the rotated file if configured to, and removes the oldest rotated files past the maximum number
+// of backups
+func (f *RotatingFile) cleanUp(rotated string) {
+	defer f.cleanUps.Done()
+
+	f.cleaning.Lock()
+	defer f.cleaning.Unlock()
+
+	if f.rotation.Compress {
+		if err := compressFile(rotated); err != nil {
+			log.Error("Could not compress ", rotated, " : ", err)
+		}
+	}
+
+	if f.rotation.MaxBackups <= 0 {
+		return
+	}
+
+	backups, err := Backups(f.path)
+	if err != nil {
+		log.Error("Could not list rotated files of ", f.path, " : ", err)
+		return
+	}
+
+	for len(backups) > f.rotation.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			log.Error("Could not remove rotated file ", backups[0], " : ", err)
+		}
+		backups = backups[1:]
+	}
+}
+
+// compressFile replaces the file at path with its gzip compressed copy, suffixed with .gz
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+gzipSuffix, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	writer := gzip.NewWriter(dst)
+	_, err = io.Copy(writer, src)
+	if err == nil {
+		err = writer.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path + gzipSuffix)
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// rotatedPath returns the path a file rotated at t is renamed to, which does not exist yet, compressed or not
+func rotatedPath(path string, t time.Time) string {
+	rotated := path + "." + t.Format(rotationLayout)
+	for i := 1; ; i++ {
+		_, err := os.Lstat(rotated)
+		_, gzErr := os.Lstat(rotated + gzipSuffix)
+		if os.IsNotExist(err) && os.IsNotExist(gzErr) {
+			return rotated
+		}
+		rotated = fmt.Sprintf("%s.%s-%d", path, t.Format(rotationLayout), i)
+	}
+}
+
+// Backups returns the paths of the rotated files of the file at path, compressed or not, from the oldest to the newest
+func Backups(path string) ([]string, error) {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	file, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	names, err := file.Readdirnames(-1)
+	_ = file.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	type backup struct {
+		path    string
+		rotated time.Time
+	}
+
+	var backups []backup
+	for _, name := range names {
+		if !strings.HasPrefix(name, base+".") {
+			continue
+		}
+
+		suffix := strings.TrimSuffix(strings.TrimPrefix(name, base+"."), gzipSuffix)
+		if len(suffix) < len(rotationLayout) {
+			continue
+		}
+
+		rotated, err := time.ParseInLocation(rotationLayout, suffix[:len(rotationLayout)], time.Local)
+		if err != nil {
+			continue
+		}
+
+		backups = append(backups, backup{path: filepath.Join(dir, name), rotated: rotated})
+	}
+
+	sort.SliceStable(backups, func(i, j int) bool {
+		if backups[i].rotated.Equal(backups[j].rotated) {
+			return backups[i].path < backups[j].path
+		}
+		return backups[i].rotated.Before(backups[j].rotated)
+	})
+
+	paths := make([]string, len(backups))
+	for i, b := range backups {
+		paths[i] = b.path
+	}
+
+	return paths, nil
+}
+
+// OpenBackup opens a rotated file for reading, decompressing it if needed
+func OpenBackup(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, gzipSuffix) {
+		return file, nil
+	}
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return &gzipFile{Reader: reader, file: file}, nil
+}
+
+// gzipFile is a compressed file read through a gzip reader
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+// Close closes the reader and the file
+func (g *gzipFile) Close() error {
+	err := g.Reader.Close()
+	if closeErr := g.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Close closes the file, once rotated files are compressed and pruned
+func (f *RotatingFile) Close() error {
+	// Clean ups may log, possibly to this very file
+	f.cleanUps.Wait()
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+
+	return err
+}
@@ -0,0 +1,49 @@
+package logging
+
+import (
+	"github.com/sirupsen/logrus"
+	"log/syslog"
+	"strings"
+)
+
+// syslogHook sends log entries to the local syslog daemon, with the severity of their level
+type syslogHook struct {
+	writer *syslog.Writer
+}
+
+// newSyslogHook connects to the local syslog daemon
+func newSyslogHook() (*syslogHook, error) {
+	writer, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	return &syslogHook{writer: writer}, nil
+}
+
+// Levels returns all levels, the level of the logger filtering entries beforehand
+func (h *syslogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire sends the entry, laid out by the logger's formatter
+func (h *syslogHook) Fire(entry *logrus.Entry) error {
+	line, err := entry.String()
+	if err != nil {
+		return err
+	}
+	line = strings.TrimSuffix(line, "\n")
+
+	switch entry.Level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return h.writer.Crit(line)
+	case logrus.ErrorLevel:
+		return h.writer.Err(line)
+	case logrus.WarnLevel:
+		return h.writer.Warning(line)
+	case logrus.InfoLevel:
+		return h.writer.Info(line)
+	default:
+		return h.writer.Debug(line)
+	}
+}
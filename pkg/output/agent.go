@@ -0,0 +1,96 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"net/http"
+	"os"
+	"time"
+)
+
+// agentSink is a Sink forwarding reports and alerts to a central aggregator, run by the aggregate command
+type agentSink struct {
+	url     string
+	name    string
+	headers map[string]string
+	flows   bool
+	retries int
+	backoff time.Duration
+	client  *http.Client
+}
+
+// newAgentSink returns a Sink forwarding to the aggregator configured in parameters
+func newAgentSink(parameters *config.Parameters) (*agentSink, error) {
+	config := &parameters.Agent
+
+	client, err := newHTTPClient(&config.TLS, config.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("could not set up TLS for the aggregator : %s", err)
+	}
+
+	name := config.Name
+	if name == "" {
+		if name, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("could not name the agent after the host : %s", err)
+		}
+	}
+
+	headers := make(map[string]string)
+	if config.Token != "" {
+		headers["Authorization"] = "Bearer " + config.Token
+		if !config.TLS.Enabled {
+			log.Warn("The agent token is sent to the aggregator in clear, enable TLS to protect it.")
+		}
+	}
+
+	log.Info("Forwarding to the aggregator at ", config.URL, " as ", name)
+
+	return &agentSink{
+		url:     config.URL,
+		name:    name,
+		headers: headers,
+		flows:   config.Flows,
+		retries: config.Retries,
+		backoff: config.Backoff,
+		client:  client,
+	}, nil
+}
+
+// forward sends the event to the aggregator
+func (a *agentSink) forward(event *AgentEventJSON) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return retry(a.retries, a.backoff, func() error {
+		_, err := httpPost(a.client, a.url, "application/json", a.headers, body)
+		return err
+	})
+}
+
+// SendReport forwards the report, and its flow records if configured to
+func (a *agentSink) SendReport(r *analysis.Report) error {
+	event := &AgentEventJSON{EventJSON: *NewReportEvent(r), Agent: a.name, Flows: nil}
+	if a.flows {
+		event.Flows = make([]FlowJSON, len(r.Flows))
+		for i, f := range r.Flows {
+			event.Flows[i] = NewFlowJSON(f)
+		}
+	}
+
+	return a.forward(event)
+}
+
+// SendAlert forwards the alert
+func (a *agentSink) SendAlert(m *alert.Message) error {
+	return a.forward(&AgentEventJSON{EventJSON: *NewAlertEvent(m), Agent: a.name, Flows: nil})
+}
+
+// Close has nothing to release, as the HTTP client does not hold persistent resources
+func (a *agentSink) Close() error {
+	return nil
+}
@@ -0,0 +1,196 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// Layout of DateTime64(3) values in JSONEachRow rows, which are written in UTC
+	clickhouseTimeLayout = "2006-01-02 15:04:05.000"
+
+	// Number of batches kept buffered while ClickHouse is unreachable, before the oldest rows are dropped
+	clickhouseMaxBatches = 10
+)
+
+// Statement creating the flow table, if requested. %s is the qualified table name.
+const clickhouseSchema = `CREATE TABLE IF NOT EXISTS %s (
+	interface  LowCardinality(String),
+	protocol   LowCardinality(String),
+	src_ip     String,
+	src_port   UInt16,
+	dst_ip     String,
+	dst_port   UInt16,
+	src_pkts   UInt64,
+	dst_pkts   UInt64,
+	src_bytes  UInt64,
+	dst_bytes  UInt64,
+	first_seen DateTime64(3, 'UTC'),
+	last_seen  DateTime64(3, 'UTC')
+) ENGINE = MergeTree
+PARTITION BY toYYYYMM(first_seen)
+ORDER BY (first_seen, src_ip, dst_ip)`
+
+// clickhouseFlow is a row of the flow table, in the JSONEachRow format
+type clickhouseFlow struct {
+	Interface string `json:"interface"`
+	Protocol  string `json:"protocol"`
+	SrcIP     string `json:"src_ip"`
+	SrcPort   uint16 `json:"src_port"`
+	DstIP     string `json:"dst_ip"`
+	DstPort   uint16 `json:"dst_port"`
+	SrcPkts   uint   `json:"src_pkts"`
+	DstPkts   uint   `json:"dst_pkts"`
+	SrcBytes  uint64 `json:"src_bytes"`
+	DstBytes  uint64 `json:"dst_bytes"`
+	FirstSeen string `json:"first_seen"`
+	LastSeen  string `json:"last_seen"`
+}
+
+// flowToClickHouse converts a flow record to a row of the flow table
+func flowToClickHouse(f *analysis.FlowRecord) *clickhouseFlow {
+	return &clickhouseFlow{
+		Interface: f.Device,
+		Protocol:  f.Protocol,
+		SrcIP:     f.SrcIP,
+		SrcPort:   f.SrcPort,
+		DstIP:     f.DstIP,
+		DstPort:   f.DstPort,
+		SrcPkts:   f.SrcPkts,
+		DstPkts:   f.DstPkts,
+		SrcBytes:  f.SrcBytes,
+		DstBytes:  f.DstBytes,
+		FirstSeen: f.FirstSeen.UTC().Format(clickhouseTimeLayout),
+		LastSeen:  f.LastSeen.UTC().Format(clickhouseTimeLayout),
+	}
+}
+
+// clickhouseSink is a Sink inserting flow records into a ClickHouse table through the HTTP interface, in batches.
+// Rows are buffered across reports until a batch is full or the flush interval has elapsed.
+type clickhouseSink struct {
+	url           string
+	table         string
+	headers       map[string]string
+	batchSize     int
+	flushInterval time.Duration
+	retries       int
+	backoff       time.Duration
+	client        *http.Client
+	rows          []*clickhouseFlow // Rows waiting to be inserted
+	lastFlush     time.Time
+}
+
+// newClickHouseSink returns a Sink inserting into the table configured in parameters, creating it if configured so
+func newClickHouseSink(parameters *config.Parameters) (*clickhouseSink, error) {
+	config := &parameters.ClickHouse
+
+	if config.BatchSize <= 0 {
+		return nil, fmt.Errorf("invalid ClickHouse batch size %d", config.BatchSize)
+	}
+
+	client, err := newHTTPClient(&config.TLS, config.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("could not set up TLS for ClickHouse : %s", err)
+	}
+
+	c := &clickhouseSink{
+		url:           config.URL,
+		table:         config.Database + "." + config.Table,
+		headers:       map[string]string{},
+		batchSize:     config.BatchSize,
+		flushInterval: config.FlushInterval,
+		retries:       config.Retries,
+		backoff:       config.Backoff,
+		client:        client,
+		rows:          make([]*clickhouseFlow, 0, config.BatchSize),
+		lastFlush:     time.Now(),
+	}
+
+	if config.Username != "" {
+		c.headers["X-ClickHouse-User"] = config.Username
+		c.headers["X-ClickHouse-Key"] = config.Password
+	}
+
+	if config.CreateTable {
+		if err := c.execute(fmt.Sprintf(clickhouseSchema, c.table), nil); err != nil {
+			return nil, fmt.Errorf("could not create ClickHouse table %s : %s", c.table, err)
+		}
+	}
+
+	log.Info("Inserting flow records into ClickHouse table ", c.table, " at ", config.URL)
+
+	return c, nil
+}
+
+// execute runs the query, with body as its data if it is an insertion
+func (c *clickhouseSink) execute(query string, body []byte) error {
+	target := c.url + "/?" + url.Values{"query": {query}}.Encode()
+
+	return retry(c.retries, c.backoff, func() error {
+		_, err := httpPost(c.client, target, "text/plain", c.headers, body)
+		return err
+	})
+}
+
+// flush inserts the buffered rows in batches of at most batchSize rows
+func (c *clickhouseSink) flush() error {
+	c.lastFlush = time.Now()
+
+	for len(c.rows) > 0 {
+		end := c.batchSize
+		if end > len(c.rows) {
+			end = len(c.rows)
+		}
+
+		var body bytes.Buffer
+		encoder := json.NewEncoder(&body)
+		for _, row := range c.rows[:end] {
+			if err := encoder.Encode(row); err != nil {
+				return err
+			}
+		}
+
+		if err := c.execute("INSERT INTO "+c.table+" FORMAT JSONEachRow", body.Bytes()); err != nil {
+			// Keep the rows for the next flush, unless too many accumulated
+			if len(c.rows) > clickhouseMaxBatches*c.batchSize {
+				log.Error("ClickHouse is unreachable, dropping ", end, " flow records.")
+				c.rows = c.rows[end:]
+			}
+			return err
+		}
+
+		c.rows = c.rows[end:]
+	}
+
+	return nil
+}
+
+// SendReport buffers the report's flow records, and inserts them if a batch is full or the flush interval elapsed
+func (c *clickhouseSink) SendReport(r *analysis.Report) error {
+	for _, flow := range r.Flows {
+		c.rows = append(c.rows, flowToClickHouse(flow))
+	}
+
+	if len(c.rows) >= c.batchSize || time.Since(c.lastFlush) >= c.flushInterval {
+		return c.flush()
+	}
+
+	return nil
+}
+
+// SendAlert does nothing, as only flow records are stored in ClickHouse
+func (c *clickhouseSink) SendAlert(a *alert.Message) error {
+	return nil
+}
+
+// Close inserts the remaining buffered rows
+func (c *clickhouseSink) Close() error {
+	return c.flush()
+}
@@ -0,0 +1,88 @@
+package output
+
+import (
+	"context"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Title of desktop notifications
+const desktopTitle = "gonetmon"
+
+// desktopSink is a Sink raising desktop notifications on alerts, through notify-send on Linux and osascript on macOS
+type desktopSink struct {
+	command    string
+	recoveries bool
+	timeout    time.Duration
+}
+
+// newDesktopSink returns a Sink raising notifications with the tool available on this platform
+func newDesktopSink(parameters *config.Parameters) (*desktopSink, error) {
+	command := "notify-send"
+	if runtime.GOOS == "darwin" {
+		command = "osascript"
+	}
+
+	if _, err := exec.LookPath(command); err != nil {
+		return nil, fmt.Errorf("desktop notifications require %s : %s", command, err)
+	}
+
+	return &desktopSink{
+		command:    command,
+		recoveries: parameters.Desktop.Recoveries,
+		timeout:    parameters.Desktop.Timeout,
+	}, nil
+}
+
+// appleScriptString returns s as an AppleScript string literal
+func appleScriptString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// notify raises a notification holding body, urgent ones being marked as critical where supported
+func (d *desktopSink) notify(body string, urgent bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+
+	var args []string
+	if d.command == "osascript" {
+		args = []string{"-e", "display notification " + appleScriptString(body) + " with title " + appleScriptString(desktopTitle)}
+	} else {
+		urgency := "normal"
+		if urgent {
+			urgency = "critical"
+		}
+		args = []string{"--urgency=" + urgency, "--app-name=" + desktopTitle, desktopTitle, body}
+	}
+
+	if output, err := exec.CommandContext(ctx, d.command, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed : %s (%s)", d.command, err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// SendReport does nothing, as only alerts are worth interrupting the user for
+func (d *desktopSink) SendReport(r *analysis.Report) error {
+	return nil
+}
+
+// SendAlert raises a notification for the alert. Recoveries are only notified if configured so.
+func (d *desktopSink) SendAlert(a *alert.Message) error {
+	if a.Recovery && !d.recoveries {
+		return nil
+	}
+
+	return d.notify(a.Body, !a.Recovery)
+}
+
+// Close has nothing to release for desktop notifications
+func (d *desktopSink) Close() error {
+	return nil
+}
@@ -0,0 +1,1142 @@
+package output
+
+import (
+	"context"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/diagnostics"
+	"github.com/sirupsen/logrus"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Throughput of outputs, published by the diagnostics server
+var (
+	outputMessages  = diagnostics.NewCounter("output.messages") // Reports, alerts and rollups handed to sinks
+	droppedMessages = diagnostics.NewCounter("output.dropped")  // Messages dropped as sinks were too far behind
+	sendLatency     = diagnostics.NewLatency("output.send")     // Time sinks take to send a message
+)
+
+const (
+	clearConsole  = "\x1Bc"
+	topTag        = "[gonetmon]"
+	sessionTag    = "[gonetmon:%s]"
+	topLine       = " Refresh : %d seconds - Alert %d hits / %d seconds. - updated : %s"
+	noReport      = "\t\t\t--- No report available : no traffic detected ---"
+	reportTop     = "Top host : %s\t - %d hits\t"
+	reportResp    = "%s" // OK(%d), Redirect(%d), Server Error(%d), Client Error(%d)"
+	reportSection = "\t> %s\t-\t %d hits\t"
+	reportReqs    = "%s" //" POST, GET, PUT, PATCH, and DELETE"
+	trendLine     = "\t%s\t hits %s %d\t bytes %s %s"
+	processTitle  = "Top processes :"
+	processLine   = "\t> %s[%d]\t-\t %s in %d flows"
+	systemsTitle  = "Remote systems :"
+	namesTitle    = "Named hosts :"
+	pathsTitle    = "Top paths :"
+	pathLine      = "\t> %s%s\t-\t %d requests"
+	agentsTitle   = "User agents :"
+	contentsTitle = "Content :"
+	streamsTitle  = "Streams :"
+	nameLine      = "\t> %s\t-\t %s %s"
+	lingerTitle   = "Long-lived connections :"
+	staleTitle    = "Stale connections :"
+	connLine      = "\t> %s %s -> %s\t-\t open %s, idle %s, %s"
+	latencyTitle  = "HTTP response times :"
+	latencyLine   = "\t> %s\t-\t %d responses, %.0f%% errors, p50 %s, p90 %s, p99 %s"
+	callsTitle    = "Calls :"
+	callLine      = "\t> %s -> %s\t-\t %s, %s, %d packets, %.1f%% lost, jitter %s"
+	mailTitle     = "Mail :"
+	domainsTitle  = "Mail domains :"
+	domainLine    = "\t> %s\t-\t %d sent, %d received"
+	cleartextLine = "\t> STARTTLS downgrade : %s"
+	sshTitle      = "SSH servers :"
+	sshLine       = "\t> %s %s\t-\t %d sessions from %d clients, %d short, longest %s%s"
+	ntpTitle      = "NTP servers :"
+	ntpLine       = "\t> %s stratum %d\t-\t %d queries from %d clients, %d commands, %s queried, %s answered%s"
+	arpTitle      = "ARP conflicts :"
+	arpLine       = "\t> %s"
+	policyTitle   = "TLS policy violations :"
+	policyLine    = "\t> %s"
+	mtuTitle      = "MTU trouble spots :"
+	mtuLine       = "\t> %s -> %s\t-\t %d incomplete, %d too big%s, %d reassembled, largest %s"
+	dscpTitle     = "DSCP classes :"
+	dscpLine      = "\t> %s\t-\t %s"
+	matrixTitle   = "Traffic between groups :"
+	matrixLine    = "\t> %s -> %s\t-\t %s in %d packets"
+	corruptTitle  = "Corrupt packets :"
+	corruptLine   = "\t> %s\t-\t %d checksum errors, %d truncated, %d malformed, %.2f%% of %d packets"
+	stallTitle    = "Stalled TCP connections :"
+	stallLine     = "\t> %s -> %s\t-\t %d stalls%s, longest %s, %d zero windows"
+	diffTitle     = "Since the last report : %s hits, %s, %s flows"
+	diffLine      = "\t> %s %s\t-\t %s -> %s"
+	watchTitle    = "Watched targets :"
+	watchLine     = "\t> %s\t-\t %d packets, %s in %d flows, %d connections, %d refused, %d unanswered, handshake %s, longest %s%s"
+
+
+	// ANSI Colours
+	red		= "\033[31;1;1m"
+	green 	= "\033[32m"
+	yellow	= "\033[33m"
+	blue	= "\033[34m"
+	stop 	= "\033[0m"
+
+//[gonetmon] Refresh : 5 seconds - Alert 4 hits / 10 seconds. - updated : 2019-08-11 22:05:48
+//Top host : www.meteofrance.com   - 4 hits
+//Top host : www.m
+)
+
+// buildRequestOutput returns a string representation of elements in given map
+func buildRequestOutput(methods map[string]uint) string {
+	var output string
+	for method, nb := range methods {
+		output += fmt.Sprintf("%s(%d) ", method, nb)
+	}
+	return output
+}
+
+// buildResponseOutput returns a string representation of elements in given map
+func buildResponseOutput(status map[int]uint) string {
+	var output string
+	for code, nb := range status {
+		output += fmt.Sprintf("%d(%d) ", code, nb)
+	}
+	return output
+}
+
+// Number of discovered hosts listed under a report
+const maxNeighbours = 10
+
+// Number of HTTP hosts whose response times are listed under a report, those with the most responses
+const maxResponders = 10
+
+// Number of VoIP calls listed under a report, those with the most lost packets
+const maxCalls = 10
+
+// Number of mail domains listed under a report, those with the most messages
+const maxMailDomains = 10
+
+// Number of SSH servers listed under a report, those with the most sessions
+const maxSSHServers = 10
+
+// Number of NTP servers listed under a report, those that answered the most bytes
+const maxNTPServers = 10
+
+// Number of paths listed under the MTU trouble spots of a report, those losing the most datagrams
+const maxMTUPaths = 10
+
+// Number of directions of TCP connections listed under the stalled ones of a report, those stalled the longest
+const maxStalledConnections = 10
+
+// console is a Sink printing reports and alerts to the terminal
+type console struct {
+	parameters *config.Parameters
+	template   *template.Template // User supplied report layout. If nil, the default layout is used.
+	alerts     []string           // Alerts and rollups raised since startup, reprinted under each report
+	topHost    string             // Top host of the previous report, to highlight changes
+	topHits    int                // Hits of the previous report's top host
+	trends     map[string]*trend  // Hits and bytes of the last reports, per interface
+}
+
+// trend holds the values of an interface over the last reports, oldest first
+type trend struct {
+	hits  []float64
+	bytes []float64
+}
+
+// push appends the values of a new report, discarding the oldest ones beyond size
+func (t *trend) push(stats analysis.DeviceStats, size int) {
+	t.hits = append(t.hits, float64(stats.Hits))
+	t.bytes = append(t.bytes, float64(stats.Bytes))
+	if len(t.hits) > size {
+		t.hits = t.hits[len(t.hits)-size:]
+		t.bytes = t.bytes[len(t.bytes)-size:]
+	}
+}
+
+// newConsole returns a Sink to the terminal, loading the report template if one is configured
+func newConsole(parameters *config.Parameters) (*console, error) {
+	c := &console{
+		parameters: parameters,
+		template:   nil,
+		alerts:     nil,
+		topHost:    "",
+		topHits:    0,
+		trends:     make(map[string]*trend),
+	}
+
+	if parameters.ReportTemplate != "" {
+		t, err := loadReportTemplate(parameters.ReportTemplate)
+		if err != nil {
+			return nil, err
+		}
+		c.template = t
+	}
+
+	return c, nil
+}
+
+// SendReport clears the terminal and prints the report followed by all alerts raised so far
+func (c *console) SendReport(r *analysis.Report) error {
+	if c.template != nil {
+		output, err := executeReportTemplate(c.template, r, c.alerts, c.parameters)
+		if err != nil {
+			return err
+		}
+
+		fmt.Print(clearConsole)
+		fmt.Print(output)
+		return nil
+	}
+
+	c.display(r)
+	return nil
+}
+
+// paint wraps s in the given ANSI colour, unless colours are disabled
+func (c *console) paint(colour, s string) string {
+	if !c.parameters.Colour {
+		return s
+	}
+	return colour + s + stop
+}
+
+// topHostDelta returns a highlighted indication of how the top host changed since the previous report
+func (c *console) topHostDelta(r *analysis.Report) string {
+	defer func() {
+		c.topHost, c.topHits = "", 0
+		if r.TopHost != nil {
+			c.topHost, c.topHits = r.TopHost.Host, r.TopHost.Hits
+		}
+	}()
+
+	switch {
+	case r.TopHost == nil:
+		return ""
+	case r.TopHost.Host != c.topHost:
+		return c.paint(yellow, "new top host")
+	case r.TopHost.Hits > c.topHits:
+		return c.paint(red, fmt.Sprintf("+%d", r.TopHost.Hits-c.topHits))
+	case r.TopHost.Hits < c.topHits:
+		return c.paint(green, fmt.Sprintf("%d", r.TopHost.Hits-c.topHits))
+	}
+
+	return ""
+}
+
+// trendLines updates the interfaces' trends with the report, and returns a sparkline of hits and bytes for each of them.
+// Interfaces absent from the report had no traffic during the window.
+func (c *console) trendLines(r *analysis.Report) []string {
+	size := int(c.parameters.SparkWindows)
+	if size == 0 {
+		return nil
+	}
+
+	for name := range r.Devices {
+		if _, ok := c.trends[name]; !ok {
+			c.trends[name] = &trend{}
+		}
+	}
+
+	names := make([]string, 0, len(c.trends))
+	for name := range c.trends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := make([]string, len(names))
+	for i, name := range names {
+		stats := r.Devices[name]
+		c.trends[name].push(stats, size)
+		lines[i] = fmt.Sprintf(trendLine, name, c.paint(blue, sparkline(c.trends[name].hits)), stats.Hits,
+			c.paint(blue, sparkline(c.trends[name].bytes)), HumanBytes(stats.Bytes))
+	}
+
+	return lines
+}
+
+// SendAlert prints the alert and retains it for future reports. Alerts are shown in red and recoveries in green.
+func (c *console) SendAlert(a *alert.Message) error {
+	body := c.paint(red, a.Body)
+	if a.Recovery {
+		body = c.paint(green, a.Body)
+	}
+	c.alerts = append(c.alerts, body)
+
+	fmt.Println(body)
+	return nil
+}
+
+// describeRollup returns a one line summary of the rollup, with timestamps in the given layout
+func describeRollup(r *analysis.Rollup, layout string) string {
+	output := fmt.Sprintf("%s summary from %s to %s : %d hits, %s, peak %s/s, %d alerts", r.Period,
+		r.Start.Format(layout), r.End.Format(layout), r.Hits, HumanBytes(r.Bytes), HumanBytes(uint64(r.PeakRate)), r.Alerts)
+
+	if talkers := r.TopTalkers(); len(talkers) > 0 {
+		output += " - top talkers :"
+		for _, t := range talkers {
+			output += " " + t.IP
+			if t.Name != "" {
+				output += "[" + t.Name + "]"
+			}
+			if t.Container != "" {
+				output += "[" + t.Container + "]"
+			}
+			if t.Workload != "" {
+				output += "[" + t.Workload + "]"
+			}
+			output += "(" + HumanBytes(t.Bytes) + ")"
+		}
+	}
+
+	return output
+}
+
+// describeBreakdown returns the counts of a breakdown, e.g. of remote hosts per operating system, the most common
+// first, e.g. " Linux(3)"
+func describeBreakdown(breakdown map[string]int) string {
+	kinds := make([]string, 0, len(breakdown))
+	for kind := range breakdown {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if breakdown[kinds[i]] != breakdown[kinds[j]] {
+			return breakdown[kinds[i]] > breakdown[kinds[j]]
+		}
+		return kinds[i] < kinds[j]
+	})
+
+	var output string
+	for _, kind := range kinds {
+		output += fmt.Sprintf(" %s(%d)", kind, breakdown[kind])
+	}
+
+	return output
+}
+
+// describeContents returns the HTTP responses of each category of content, the one with the most bytes first, e.g.
+// " video(12, 48.2 MB) json(310, 1.1 MB)"
+func describeContents(contents map[string]analysis.MediaStats) string {
+	categories := make([]string, 0, len(contents))
+	for category := range contents {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		ci, cj := contents[categories[i]], contents[categories[j]]
+		if ci.Bytes != cj.Bytes {
+			return ci.Bytes > cj.Bytes
+		}
+		if ci.Responses != cj.Responses {
+			return ci.Responses > cj.Responses
+		}
+		return categories[i] < categories[j]
+	})
+
+	var output string
+	for _, category := range categories {
+		output += fmt.Sprintf(" %s(%d, %s)", category, contents[category].Responses, HumanBytes(contents[category].Bytes))
+	}
+
+	return output
+}
+
+// describeStreams returns the streams and messages of each protocol carried over HTTP, sorted by protocol, e.g.
+// " grpc(12 streams, 340 messages)"
+func describeStreams(streams map[string]analysis.StreamStats) string {
+	protocols := make([]string, 0, len(streams))
+	for protocol := range streams {
+		protocols = append(protocols, protocol)
+	}
+	sort.Strings(protocols)
+
+	var output string
+	for _, protocol := range protocols {
+		output += fmt.Sprintf(" %s(%d streams, %d messages)", protocol, streams[protocol].Streams, streams[protocol].Messages)
+	}
+
+	return output
+}
+
+// describeResponses returns a line for each of the HTTP hosts with the most responses, up to maxResponders, with their
+// error rate and response time percentiles
+func describeResponses(responses map[string]analysis.HTTPStats) string {
+	hosts := make([]string, 0, len(responses))
+	for host := range responses {
+		hosts = append(hosts, host)
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		if responses[hosts[i]].Responses != responses[hosts[j]].Responses {
+			return responses[hosts[i]].Responses > responses[hosts[j]].Responses
+		}
+		return hosts[i] < hosts[j]
+	})
+	if len(hosts) > maxResponders {
+		hosts = hosts[:maxResponders]
+	}
+
+	var output string
+	for _, host := range hosts {
+		s := responses[host]
+		output += fmt.Sprintf(latencyLine, host, s.Responses, 100*s.ErrorRate(), s.P50.Round(time.Microsecond),
+			s.P90.Round(time.Microsecond), s.P99.Round(time.Microsecond)) + "\n"
+	}
+	if len(responses) > maxResponders {
+		output += fmt.Sprintf("\t> and %d more\n", len(responses)-maxResponders)
+	}
+
+	return output
+}
+
+// describeCalls returns a line for each of the VoIP calls with the most lost packets, up to maxCalls, with their state,
+// codecs, packet loss and jitter
+func describeCalls(calls map[string]analysis.CallStats) string {
+	ids := make([]string, 0, len(calls))
+	for id := range calls {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if calls[ids[i]].Lost != calls[ids[j]].Lost {
+			return calls[ids[i]].Lost > calls[ids[j]].Lost
+		}
+		return ids[i] < ids[j]
+	})
+	if len(ids) > maxCalls {
+		ids = ids[:maxCalls]
+	}
+
+	var output string
+	for _, id := range ids {
+		c := calls[id]
+		state := "ringing"
+		if c.Ended {
+			state = "ended"
+		} else if c.Answered || c.Received > 0 {
+			state = "active"
+		}
+		codecs := strings.Join(c.Codecs, "/")
+		if codecs == "" {
+			codecs = "no media"
+		}
+		output += fmt.Sprintf(callLine, c.From, c.To, state, codecs, c.Received, 100*c.Loss(),
+			c.Jitter.Round(time.Microsecond)) + "\n"
+	}
+	if len(calls) > maxCalls {
+		output += fmt.Sprintf("\t> and %d more\n", len(calls)-maxCalls)
+	}
+
+	return output
+}
+
+// describeMail returns the messages, upgrades and downgrades of each mail protocol, sorted by protocol, e.g.
+// " smtp(12 messages, 3 starttls, 1 downgraded)"
+func describeMail(mail map[string]analysis.MailStats) string {
+	protocols := make([]string, 0, len(mail))
+	for protocol := range mail {
+		protocols = append(protocols, protocol)
+	}
+	sort.Strings(protocols)
+
+	var output string
+	for _, protocol := range protocols {
+		s := mail[protocol]
+		output += fmt.Sprintf(" %s(%d messages, %d starttls, %d downgraded)", protocol, s.Messages, s.Upgrades, s.Downgrades)
+	}
+
+	return output
+}
+
+// describeMailDomains returns a line for each of the domains with the most SMTP messages, up to maxMailDomains
+func describeMailDomains(domains map[string]analysis.MailDomainStats) string {
+	names := make([]string, 0, len(domains))
+	for name := range domains {
+		names = append(names, name)
+	}
+	total := func(name string) int { return domains[name].Sent + domains[name].Received }
+	sort.Slice(names, func(i, j int) bool {
+		if total(names[i]) != total(names[j]) {
+			return total(names[i]) > total(names[j])
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > maxMailDomains {
+		names = names[:maxMailDomains]
+	}
+
+	var output string
+	for _, name := range names {
+		output += fmt.Sprintf(domainLine, name, domains[name].Sent, domains[name].Received) + "\n"
+	}
+	if len(domains) > maxMailDomains {
+		output += fmt.Sprintf("\t> and %d more\n", len(domains)-maxMailDomains)
+	}
+
+	return output
+}
+
+// describeSSH returns a line for each of the SSH servers with the most sessions, up to maxSSHServers, with their
+// software, sessions, short sessions and longest session, flagging unexpected destinations
+func describeSSH(servers map[string]analysis.SSHStats) string {
+	sessions := func(s analysis.SSHStats) (total, short int) {
+		for _, nb := range s.Sessions {
+			total += nb
+		}
+		for _, nb := range s.Short {
+			short += nb
+		}
+		return total, short
+	}
+
+	endpoints := make([]string, 0, len(servers))
+	for server := range servers {
+		endpoints = append(endpoints, server)
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		ti, _ := sessions(servers[endpoints[i]])
+		tj, _ := sessions(servers[endpoints[j]])
+		if ti != tj {
+			return ti > tj
+		}
+		return endpoints[i] < endpoints[j]
+	})
+	if len(endpoints) > maxSSHServers {
+		endpoints = endpoints[:maxSSHServers]
+	}
+
+	var output string
+	for _, server := range endpoints {
+		s := servers[server]
+		total, short := sessions(s)
+		unexpected := ""
+		if !s.Expected {
+			unexpected = ", unexpected"
+		}
+		output += fmt.Sprintf(sshLine, server, s.Software, total, len(s.Sessions), short, s.Longest.Round(time.Second),
+			unexpected) + "\n"
+	}
+	if len(servers) > maxSSHServers {
+		output += fmt.Sprintf("\t> and %d more\n", len(servers)-maxSSHServers)
+	}
+
+	return output
+}
+
+// describeNTP returns a line for each of the NTP servers that answered the most bytes, up to maxNTPServers, with their
+// stratum, queries and bytes exchanged, flagging unexpected servers
+func describeNTP(servers map[string]analysis.NTPStats) string {
+	sum := func(bytes map[string]uint64) (total uint64) {
+		for _, b := range bytes {
+			total += b
+		}
+		return total
+	}
+
+	addresses := make([]string, 0, len(servers))
+	for server := range servers {
+		addresses = append(addresses, server)
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		ai, aj := sum(servers[addresses[i]].Answered), sum(servers[addresses[j]].Answered)
+		if ai != aj {
+			return ai > aj
+		}
+		return addresses[i] < addresses[j]
+	})
+	if len(addresses) > maxNTPServers {
+		addresses = addresses[:maxNTPServers]
+	}
+
+	var output string
+	for _, server := range addresses {
+		s := servers[server]
+		queries := 0
+		for _, nb := range s.Clients {
+			queries += nb
+		}
+		unexpected := ""
+		if !s.Expected {
+			unexpected = ", unexpected"
+		}
+		output += fmt.Sprintf(ntpLine, server, s.Stratum, queries, len(s.Clients), s.Commands,
+			HumanBytes(sum(s.Queried)), HumanBytes(sum(s.Answered)), unexpected) + "\n"
+	}
+	if len(servers) > maxNTPServers {
+		output += fmt.Sprintf("\t> and %d more\n", len(servers)-maxNTPServers)
+	}
+
+	return output
+}
+
+// describeMTU returns a line for each of the paths losing datagrams to fragmentation or told they were too big, up to
+// maxMTUPaths, with the smallest MTU routers told
+func describeMTU(paths []analysis.MTUStats) string {
+	var output string
+	troubled := 0
+	for _, p := range paths {
+		if !p.Troubled() {
+			break
+		}
+		troubled++
+		if troubled > maxMTUPaths {
+			continue
+		}
+		mtu := ""
+		if p.MTU != 0 {
+			mtu = fmt.Sprintf(" (MTU %d)", p.MTU)
+		}
+		output += fmt.Sprintf(mtuLine, p.Source, p.Destination, p.Incomplete, p.TooBig, mtu, p.Reassembled,
+			HumanBytes(uint64(p.Largest))) + "\n"
+	}
+	if troubled > maxMTUPaths {
+		output += fmt.Sprintf("\t> and %d more\n", troubled-maxMTUPaths)
+	}
+
+	return output
+}
+
+// describeWatched returns a line for each watched target, telling those silent or unreachable
+func describeWatched(watched []analysis.WatchStats) string {
+	if len(watched) == 0 {
+		return ""
+	}
+
+	output := watchTitle + "\n"
+	for _, w := range watched {
+		var state string
+		if w.Silent > 0 {
+			state += fmt.Sprintf(", silent for %s", w.Silent)
+		}
+		if w.Unreachable {
+			state += ", unreachable"
+		}
+		output += fmt.Sprintf(watchLine, w.Target, w.Packets, HumanBytes(w.Bytes), w.Flows, w.Connections, w.Refused,
+			w.Unanswered, w.Handshake, w.MaxHandshake, state) + "\n"
+	}
+
+	return output
+}
+
+// describeDiff returns the changes of totals since the previous report, followed by a line for each new top talker,
+// top talker gone and host sending the most bytes more, or nothing for the first report
+func describeDiff(diff *analysis.ReportDiff) string {
+	if diff == nil {
+		return ""
+	}
+
+	signed := func(n int64, bytes bool) string {
+		sign, abs := "+", n
+		if n < 0 {
+			sign, abs = "-", -n
+		}
+		if bytes {
+			return sign + HumanBytes(uint64(abs))
+		}
+		return sign + strconv.FormatInt(abs, 10)
+	}
+	output := fmt.Sprintf(diffTitle, signed(int64(diff.Hits), false), signed(diff.Bytes, true),
+		signed(int64(diff.Flows), false)) + "\n"
+
+	for _, change := range []struct {
+		kind  string
+		hosts []analysis.HostDelta
+	}{{"new top talker", diff.New}, {"gone", diff.Gone}, {"rising", diff.Rising}} {
+		for _, h := range change.hosts {
+			host := h.IP
+			if h.Name != "" {
+				host = fmt.Sprintf("%s (%s)", h.Name, h.IP)
+			}
+			output += fmt.Sprintf(diffLine, change.kind, host, HumanBytes(h.Before), HumanBytes(h.After)) + "\n"
+		}
+	}
+
+	return output
+}
+
+// describeDSCP returns the DSCP classes title, followed by a line for each interface breaking its traffic down by DSCP
+// class, the most bytes first, or nothing if traffic is not broken down
+func describeDSCP(devices map[string]analysis.DeviceStats) string {
+	names := make([]string, 0, len(devices))
+	for name, stats := range devices {
+		if len(stats.DSCP) > 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+
+	output := dscpTitle + "\n"
+	for _, name := range names {
+		classes := devices[name].DSCP
+		total := uint64(0)
+		order := make([]string, 0, len(classes))
+		for class, s := range classes {
+			total += s.Bytes
+			order = append(order, class)
+		}
+		sort.Slice(order, func(i, j int) bool {
+			if classes[order[i]].Bytes != classes[order[j]].Bytes {
+				return classes[order[i]].Bytes > classes[order[j]].Bytes
+			}
+			return order[i] < order[j]
+		})
+
+		parts := make([]string, len(order))
+		for i, class := range order {
+			parts[i] = fmt.Sprintf("%s %s (%.0f%%)", class, HumanBytes(classes[class].Bytes),
+				100*float64(classes[class].Bytes)/float64(total))
+		}
+		output += fmt.Sprintf(dscpLine, name, strings.Join(parts, ", ")) + "\n"
+	}
+
+	return output
+}
+
+// describeCorruption returns the corrupt packets title, followed by a line for each interface that captured corrupt
+// packets with their share of its packets, or nothing if none did
+func describeCorruption(devices map[string]analysis.DeviceStats) string {
+	names := make([]string, 0, len(devices))
+	for name, stats := range devices {
+		if stats.Corrupt() > 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+
+	output := corruptTitle + "\n"
+	for _, name := range names {
+		s := devices[name]
+		rate := 0.0
+		if s.Packets > 0 {
+			rate = 100 * float64(s.Corrupt()) / float64(s.Packets)
+		}
+		output += fmt.Sprintf(corruptLine, name, s.Checksum, s.Truncated, s.Malformed, rate, s.Packets) + "\n"
+	}
+
+	return output
+}
+
+// describeStalls returns a line for each of the directions of TCP connections stalled the longest, up to
+// maxStalledConnections, with the reason of their last stall and the times their receiver closed its window
+func describeStalls(stalled []analysis.StallStats) string {
+	var output string
+	for i, s := range stalled {
+		if i == maxStalledConnections {
+			output += fmt.Sprintf("\t> and %d more\n", len(stalled)-maxStalledConnections)
+			break
+		}
+		reason := ""
+		if s.Reason != "" {
+			reason = " (" + strings.Replace(s.Reason, "_", " ", -1) + ")"
+		}
+		output += fmt.Sprintf(stallLine, s.Sender, s.Receiver, s.Stalls, reason, s.Longest.Round(time.Second),
+			s.ZeroWindows) + "\n"
+	}
+
+	return output
+}
+
+// describeConnections returns a line for each connection, with its endpoints and the processes owning them if known,
+// e.g. "	> tcp 10.0.0.2:51234[ssh[812]] -> 203.0.113.9:22	-	 open 3h2m0s, idle 4s, 12.3 MB"
+func describeConnections(connections []analysis.Connection) string {
+	endpoint := func(ip string, port uint16, process string) string {
+		e := net.JoinHostPort(ip, strconv.Itoa(int(port)))
+		if process != "" {
+			e += "[" + process + "]"
+		}
+		return e
+	}
+
+	var output string
+	for _, c := range connections {
+		output += fmt.Sprintf(connLine, c.Protocol, endpoint(c.SrcIP, c.SrcPort, c.SrcProcess),
+			endpoint(c.DstIP, c.DstPort, c.DstProcess), c.Age.Round(time.Second), c.Idle.Round(time.Second),
+			HumanBytes(c.Bytes)) + "\n"
+	}
+
+	return output
+}
+
+// describeNeighbours returns a line for each of the discovered hosts, sorted by address, with its name and services,
+// up to maxNeighbours
+func describeNeighbours(discovery map[string]analysis.Neighbour) string {
+	ips := make([]string, 0, len(discovery))
+	for ip := range discovery {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	if len(ips) > maxNeighbours {
+		ips = ips[:maxNeighbours]
+	}
+
+	var output string
+	for _, ip := range ips {
+		n := discovery[ip]
+		name := n.Name
+		if name == "" {
+			name = "-"
+		}
+		output += fmt.Sprintf(nameLine, ip, name, strings.Join(n.Services, ", ")) + "\n"
+	}
+	if len(discovery) > maxNeighbours {
+		output += fmt.Sprintf("\t> and %d more\n", len(discovery)-maxNeighbours)
+	}
+
+	return output
+}
+
+// SendRollup prints the rollup and retains it for future reports, like alerts
+func (c *console) SendRollup(r *analysis.Rollup) error {
+	body := describeRollup(r, c.parameters.TimeLayout)
+	c.alerts = append(c.alerts, body)
+
+	fmt.Println(body)
+	return nil
+}
+
+// Close has nothing to release for the console
+func (c *console) Close() error {
+	return nil
+}
+
+// ReportLines returns the plain text representation of a report, one line per element
+func ReportLines(r *analysis.Report) []string {
+	if r.TopHost == nil {
+		return []string{noReport}
+	}
+
+	lines := []string{fmt.Sprintf(reportTop+reportResp, r.TopHost.Host, r.TopHost.Hits, buildResponseOutput(r.TopHost.Responses.Status))}
+	for _, section := range r.Sections {
+		lines = append(lines, fmt.Sprintf(reportSection+reportReqs, section.Section, section.Hits, buildRequestOutput(section.Requests.Methods)))
+	}
+
+	return lines
+}
+
+// display clears the terminal and prints the report in the default layout, followed by alerts
+func (c *console) display(r *analysis.Report) {
+	p := c.parameters
+	var output string
+
+	tag := topTag
+	if p.Session != "" {
+		tag = fmt.Sprintf(sessionTag, p.Session)
+	}
+	output += c.paint(green, tag) + c.paint(blue, fmt.Sprintf(topLine, int(p.DisplayRefresh.Seconds()), p.AlertThreshold, int(p.AlertSpan.Seconds()), p.FormatTime(time.Now()))) + "\n"
+
+	for _, line := range c.trendLines(r) {
+		output += line + "\n"
+	}
+
+	lines := ReportLines(r)
+	if delta := c.topHostDelta(r); delta != "" {
+		lines[0] += "(" + delta + ")"
+	}
+	output += strings.Join(lines, "\n") + "\n"
+	output += describeDiff(r.Diff)
+	output += describeWatched(r.Watched)
+	output += describeDSCP(r.Devices)
+	output += describeCorruption(r.Devices)
+
+	if len(r.Matrix) > 0 {
+		output += matrixTitle + "\n"
+		for _, t := range r.Matrix {
+			output += fmt.Sprintf(matrixLine, t.From, t.To, HumanBytes(t.Bytes), t.Packets) + "\n"
+		}
+	}
+
+	if len(r.Processes) > 0 {
+		output += processTitle + "\n"
+		for _, p := range r.Processes {
+			output += fmt.Sprintf(processLine, p.Name, p.PID, HumanBytes(p.Bytes), p.Flows) + "\n"
+		}
+	}
+
+	if len(r.Systems) > 0 {
+		output += systemsTitle + describeBreakdown(r.SystemBreakdown()) + "\n"
+	}
+
+	if len(r.Paths) > 0 {
+		output += pathsTitle + "\n"
+		for _, p := range r.Paths {
+			output += fmt.Sprintf(pathLine, p.Host, p.Path, p.Requests) + "\n"
+		}
+	}
+	if len(r.Agents) > 0 {
+		output += agentsTitle + describeBreakdown(r.Agents) + "\n"
+	}
+	if len(r.Contents) > 0 {
+		output += contentsTitle + describeContents(r.Contents) + "\n"
+	}
+	if len(r.Streams) > 0 {
+		output += streamsTitle + describeStreams(r.Streams) + "\n"
+	}
+
+	if len(r.Discovery) > 0 {
+		output += namesTitle + "\n" + describeNeighbours(r.Discovery)
+	}
+
+	if len(r.Responses) > 0 {
+		output += latencyTitle + "\n" + describeResponses(r.Responses)
+	}
+
+	if len(r.Calls) > 0 {
+		output += callsTitle + "\n" + describeCalls(r.Calls)
+	}
+
+	if len(r.Mail) > 0 {
+		output += mailTitle + describeMail(r.Mail) + "\n"
+		for _, d := range r.Cleartext {
+			output += fmt.Sprintf(cleartextLine, d) + "\n"
+		}
+	}
+	if len(r.Domains) > 0 {
+		output += domainsTitle + "\n" + describeMailDomains(r.Domains)
+	}
+
+	if len(r.SSH) > 0 {
+		output += sshTitle + "\n" + describeSSH(r.SSH)
+	}
+	if len(r.NTP) > 0 {
+		output += ntpTitle + "\n" + describeNTP(r.NTP)
+	}
+	if len(r.Spoofing) > 0 {
+		output += arpTitle + "\n"
+		for _, c := range r.Spoofing {
+			output += fmt.Sprintf(arpLine, c) + "\n"
+		}
+	}
+	if len(r.Policy) > 0 {
+		output += policyTitle + "\n"
+		for _, v := range r.Policy {
+			output += fmt.Sprintf(policyLine, v) + "\n"
+		}
+	}
+	if len(r.MTU) > 0 && r.MTU[0].Troubled() {
+		output += mtuTitle + "\n" + describeMTU(r.MTU)
+	}
+	if len(r.Stalled) > 0 {
+		output += stallTitle + "\n" + describeStalls(r.Stalled)
+	}
+
+	if len(r.LongLived) > 0 {
+		output += lingerTitle + "\n" + describeConnections(r.LongLived)
+	}
+	if len(r.Stale) > 0 {
+		output += staleTitle + "\n" + describeConnections(r.Stale)
+	}
+
+	for _, alert := range c.alerts {
+		output += alert + "\n"
+	}
+
+	fmt.Print(clearConsole)
+	fmt.Print(output)
+}
+
+// outputMsg is either a report, an alert, a rollup or a heartbeat, queued for a sink
+type outputMsg struct {
+	report    *analysis.Report
+	alert     *alert.Message
+	rollup    *analysis.Rollup
+	heartbeat *Heartbeat
+}
+
+// sinkWorker feeds a single sink from its own queue, so that a slow output does not hold back the others
+type sinkWorker struct {
+	name  string
+	sink  Sink
+	queue chan outputMsg
+}
+
+// run sends queued messages to the sink until the queue is closed, then closes the sink
+func (w *sinkWorker) run(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for msg := range w.queue {
+		outputMessages.Inc()
+		sent := time.Now()
+
+		switch {
+		case msg.report != nil:
+			if err := w.sink.SendReport(msg.report); err != nil {
+				log.WithFields(logrus.Fields{
+					"output": w.name,
+					"error":  err,
+				}).Error("Could not output report.")
+			}
+		case msg.alert != nil:
+			if err := w.sink.SendAlert(msg.alert); err != nil {
+				log.WithFields(logrus.Fields{
+					"output": w.name,
+					"error":  err,
+				}).Error("Could not output alert.")
+			}
+		case msg.rollup != nil:
+			if err := w.sink.(RollupSink).SendRollup(msg.rollup); err != nil {
+				log.WithFields(logrus.Fields{
+					"output": w.name,
+					"error":  err,
+				}).Error("Could not output rollup.")
+			}
+		case msg.heartbeat != nil:
+			if err := w.sink.(HeartbeatSink).SendHeartbeat(msg.heartbeat); err != nil {
+				log.WithFields(logrus.Fields{
+					"output": w.name,
+					"error":  err,
+				}).Error("Could not output heartbeat.")
+			}
+		}
+
+		sendLatency.Since(sent)
+	}
+
+	if err := w.sink.Close(); err != nil {
+		log.WithFields(logrus.Fields{
+			"output": w.name,
+			"error":  err,
+		}).Error("Could not close output.")
+	}
+}
+
+// enqueue queues the message for the sink, dropping it if the sink is too far behind
+func (w *sinkWorker) enqueue(msg outputMsg) {
+	select {
+	case w.queue <- msg:
+	default:
+		droppedMessages.Inc()
+		log.WithFields(logrus.Fields{
+			"output": w.name,
+		}).Warn("Output queue is full, dropping message.")
+	}
+}
+
+// sinkName returns the name of the i-th sink, which is the configured output it was set up for, if any
+func sinkName(parameters *config.Parameters, i int, sink Sink) string {
+	if i < len(parameters.Outputs) {
+		return parameters.Outputs[i]
+	}
+	if named, ok := sink.(NamedSink); ok {
+		return named.Name()
+	}
+
+	return fmt.Sprintf("%T", sink)
+}
+
+// Display loops on receiving channels and dispatches alerts and reports to all sinks.
+// Rollups are dispatched to the sinks implementing RollupSink once their period is over, and heartbeats, if enabled, to
+// those implementing HeartbeatSink at each period, whatever the reports and alerts.
+// Once ctx is cancelled, sinks are flushed and closed before returning.
+func Display(ctx context.Context, parameters *config.Parameters, sinks []Sink, rollups *analysis.RollupAggregator, reportChan <-chan *analysis.Report, alertChan <-chan alert.Message) error {
+	workersWG := sync.WaitGroup{}
+	workers := make([]*sinkWorker, len(sinks))
+	for i, sink := range sinks {
+		workers[i] = &sinkWorker{
+			name:  sinkName(parameters, i, sink),
+			sink:  sink,
+			queue: make(chan outputMsg, parameters.OutputBufSize),
+		}
+
+		queue := workers[i].queue
+		diagnostics.RegisterQueue(parameters.Qualify("output."+workers[i].name), func() (int, int) {
+			return len(queue), cap(queue)
+		})
+
+		// Display empty monitoring console
+		if workers[i].name == config.ConsoleOutput {
+			workers[i].enqueue(outputMsg{report: &analysis.Report{
+				TopHost:   nil,
+				Sections:  nil,
+				Timestamp: time.Now(),
+			}})
+		}
+
+		workersWG.Add(1)
+		go workers[i].run(&workersWG)
+	}
+
+	// Heartbeats tell the monitor is alive, so they are sent at wall clock pace, even when replaying captures
+	var heartbeats <-chan time.Time
+	if parameters.Heartbeat > 0 {
+		ticker := time.NewTicker(parameters.Heartbeat)
+		defer ticker.Stop()
+		heartbeats = ticker.C
+	}
+	host, _ := os.Hostname()
+	started := time.Now()
+	var beats, reports uint64
+	var lastReport time.Time
+
+displayLoop:
+	for {
+		select {
+
+		case <-ctx.Done():
+			break displayLoop
+
+		case alert := <-alertChan:
+			rollups.AddAlert(&alert)
+			for _, w := range workers {
+				w.enqueue(outputMsg{alert: &alert})
+			}
+
+		case t := <-heartbeats:
+			beats++
+			heartbeat := &Heartbeat{
+				Sequence:   beats,
+				Host:       host,
+				Session:    parameters.Session,
+				Uptime:     t.Sub(started),
+				Reports:    reports,
+				LastReport: lastReport,
+				Timestamp:  t,
+			}
+			for _, w := range workers {
+				if _, ok := w.sink.(HeartbeatSink); ok {
+					w.enqueue(outputMsg{heartbeat: heartbeat})
+				}
+			}
+
+		case report := <-reportChan:
+			reports++
+			lastReport = time.Now()
+
+			// Rollups are accounted from whole reports, whatever the sections outputs receive
+			selected := report
+			if len(parameters.ReportSections) > 0 || len(parameters.ReportSizes) > 0 {
+				selected = report.Select(parameters.ReportSections, parameters.ReportSizes)
+			}
+			for _, w := range workers {
+				w.enqueue(outputMsg{report: selected})
+			}
+
+			for _, rollup := range rollups.AddReport(report) {
+				for _, w := range workers {
+					if _, ok := w.sink.(RollupSink); ok {
+						w.enqueue(outputMsg{rollup: rollup})
+					}
+				}
+			}
+		}
+	}
+
+	// Let workers flush their queues and close their sinks
+	for _, w := range workers {
+		close(w.queue)
+	}
+	workersWG.Wait()
+
+	log.Info("Display terminating.")
+
+	return nil
+}
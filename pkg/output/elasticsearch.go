@@ -0,0 +1,188 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// Placeholder in index names replaced by the date of the record
+	indexDatePlaceholder = "{date}"
+
+	// Content type of the bulk API
+	ndjsonContentType = "application/x-ndjson"
+)
+
+// bulkAction is the action line preceding each document in a bulk request
+type bulkAction struct {
+	Index struct {
+		Index string `json:"_index"`
+	} `json:"index"`
+}
+
+// bulkResponse holds the parts of a bulk API response needed to detect failed documents
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// elasticsearchSink is a Sink bulk-indexing flow records and alerts into Elasticsearch or OpenSearch
+type elasticsearchSink struct {
+	bulkURL    string
+	headers    map[string]string
+	flowIndex  string
+	alertIndex string
+	dateLayout string
+	retries    int
+	backoff    time.Duration
+	client     *http.Client
+}
+
+// newElasticsearchSink returns a Sink indexing into the cluster configured in parameters
+func newElasticsearchSink(parameters *config.Parameters) (*elasticsearchSink, error) {
+	config := &parameters.Elasticsearch
+
+	client, err := newHTTPClient(&config.TLS, config.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("could not set up TLS for Elasticsearch : %s", err)
+	}
+
+	headers := make(map[string]string)
+	if config.Username != "" {
+		req := http.Request{Header: http.Header{}}
+		req.SetBasicAuth(config.Username, config.Password)
+		headers["Authorization"] = req.Header.Get("Authorization")
+	}
+
+	log.Info("Indexing into Elasticsearch cluster ", config.URL)
+
+	return &elasticsearchSink{
+		bulkURL:    strings.TrimSuffix(config.URL, "/") + "/_bulk",
+		headers:    headers,
+		flowIndex:  config.FlowIndex,
+		alertIndex: config.AlertIndex,
+		dateLayout: config.DateLayout,
+		retries:    config.Retries,
+		backoff:    config.Backoff,
+		client:     client,
+	}, nil
+}
+
+// indexName returns the name of the index for a record at time t
+func (e *elasticsearchSink) indexName(pattern string, t time.Time) string {
+	return strings.Replace(pattern, indexDatePlaceholder, t.Format(e.dateLayout), -1)
+}
+
+// appendDocument adds an index action and the JSON encoding of v to the bulk request body
+func appendDocument(body *bytes.Buffer, index string, v interface{}) error {
+	document, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var action bulkAction
+	action.Index.Index = index
+	header, err := json.Marshal(action)
+	if err != nil {
+		return err
+	}
+
+	body.Write(header)
+	body.WriteByte('\n')
+	body.Write(document)
+	body.WriteByte('\n')
+
+	return nil
+}
+
+// bulk sends the request body to the bulk API, retrying with backoff if the cluster is unavailable
+func (e *elasticsearchSink) bulk(body *bytes.Buffer) error {
+	if body.Len() == 0 {
+		return nil
+	}
+
+	return retry(e.retries, e.backoff, func() error {
+		respBody, err := httpPost(e.client, e.bulkURL, ndjsonContentType, e.headers, body.Bytes())
+		if err != nil {
+			return err
+		}
+
+		var resp bulkResponse
+		if err := json.Unmarshal(respBody, &resp); err != nil {
+			return fmt.Errorf("could not decode bulk response : %s", err)
+		}
+
+		if !resp.Errors {
+			return nil
+		}
+
+		// Report how many documents were rejected, along with the first reason
+		failed := 0
+		var reason string
+		for _, item := range resp.Items {
+			for _, result := range item {
+				if result.Status > 299 {
+					if failed == 0 {
+						reason = result.Error.Type + " : " + result.Error.Reason
+					}
+					failed++
+				}
+			}
+		}
+
+		// Documents that were accepted would be duplicated by a retry, so this is not retried
+		return &httpStatusError{
+			url:    e.bulkURL,
+			code:   http.StatusBadRequest,
+			status: fmt.Sprintf("%d of %d documents rejected, first error %s", failed, len(resp.Items), reason),
+		}
+	})
+}
+
+// SendReport indexes the report's flow records
+func (e *elasticsearchSink) SendReport(r *analysis.Report) error {
+	if e.flowIndex == "" {
+		return nil
+	}
+
+	var body bytes.Buffer
+	for _, flow := range r.Flows {
+		if err := appendDocument(&body, e.indexName(e.flowIndex, flow.LastSeen), NewFlowJSON(flow)); err != nil {
+			return err
+		}
+	}
+
+	return e.bulk(&body)
+}
+
+// SendAlert indexes the alert
+func (e *elasticsearchSink) SendAlert(a *alert.Message) error {
+	if e.alertIndex == "" {
+		return nil
+	}
+
+	var body bytes.Buffer
+	if err := appendDocument(&body, e.indexName(e.alertIndex, a.Timestamp), NewAlertJSON(a)); err != nil {
+		return err
+	}
+
+	return e.bulk(&body)
+}
+
+// Close has nothing to release, as the HTTP client does not hold persistent resources
+func (e *elasticsearchSink) Close() error {
+	return nil
+}
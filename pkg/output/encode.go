@@ -0,0 +1,843 @@
+package output
+
+import (
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"strconv"
+	"time"
+)
+
+// Types of events
+const (
+	reportEvent = "report"
+	alertEvent  = "alert"
+	rollupEvent = "rollup"
+)
+
+// The following types are the JSON representations of reports, alerts, flows and rollups, as sent to structured outputs
+
+// SectionJSON is the JSON representation of a section of the top host
+type SectionJSON struct {
+	Section string          `json:"section"`
+	Hits    int             `json:"hits"`
+	Methods map[string]uint `json:"methods"`
+}
+
+// HostJSON is the JSON representation of the top host of a report
+type HostJSON struct {
+	Host      string          `json:"host"`
+	IPs       []string        `json:"ips"`
+	Hits      int             `json:"hits"`
+	Responses map[string]uint `json:"responses"` // Status codes mapped to the number of times they were encountered
+}
+
+// InterfaceJSON is the JSON representation of the traffic analysed on a network interface
+type InterfaceJSON struct {
+	Hits      int    `json:"hits"`
+	Bytes     uint64 `json:"bytes"`
+	Container string `json:"container,omitempty"` // Docker container on the other end of the interface's veth pair
+	Broadcast uint64 `json:"broadcast,omitempty"` // Broadcast frames captured on the interface, if storms are detected
+	Multicast uint64 `json:"multicast,omitempty"` // Multicast frames captured on the interface, if storms are detected
+	Packets   uint64 `json:"packets"`             // Packets captured on the interface, those filters dropped included
+	Checksum  uint64 `json:"checksum,omitempty"`  // Packets failing their checksums, if checksums are verified
+	Truncated uint64 `json:"truncated,omitempty"` // Packets shorter than their headers tell
+	Malformed uint64 `json:"malformed,omitempty"` // Packets whose headers cannot be decoded
+
+	// Packets and bytes by DSCP class, if traffic is broken down by QoS marking
+	DSCP map[string]ClassJSON `json:"dscp,omitempty"`
+}
+
+// ClassJSON is the JSON representation of the traffic of a DSCP class on an interface
+type ClassJSON struct {
+	Packets uint64 `json:"packets"`
+	Bytes   uint64 `json:"bytes"`
+}
+
+// ProcessJSON is the JSON representation of the traffic of a local process
+type ProcessJSON struct {
+	PID   int    `json:"pid"`
+	Name  string `json:"name"`
+	Bytes uint64 `json:"bytes"`
+	Flows int    `json:"flows"`
+}
+
+// SystemsJSON is the JSON representation of the operating systems guessed for remote hosts
+type SystemsJSON struct {
+	Hosts     map[string]string `json:"hosts"`     // Guessed operating system, by IP address
+	Breakdown map[string]int    `json:"breakdown"` // Number of hosts, by guessed operating system
+}
+
+// NeighbourJSON is the JSON representation of a host named or advertised by discovery protocols
+type NeighbourJSON struct {
+	Name     string   `json:"name,omitempty"`
+	Services []string `json:"services,omitempty"`
+}
+
+// PathJSON is the JSON representation of the requests made for the full path of an HTTP host
+type PathJSON struct {
+	Host     string `json:"host"`
+	Path     string `json:"path"`
+	Requests int    `json:"requests"`
+}
+
+// MediaJSON is the JSON representation of the HTTP responses of a category of content
+type MediaJSON struct {
+	Responses int    `json:"responses"`
+	Bytes     uint64 `json:"bytes"` // Sum of the lengths of the bodies, as told by Content-Length headers
+}
+
+// StreamJSON is the JSON representation of the streams of a protocol carried over HTTP, and their messages
+type StreamJSON struct {
+	Streams  int `json:"streams"`
+	Messages int `json:"messages"`
+}
+
+// HTTPJSON is the JSON representation of the responses of an HTTP host paired with their requests, with response
+// times in milliseconds
+type HTTPJSON struct {
+	Responses    uint    `json:"responses"`
+	ClientErrors uint    `json:"client_errors"`
+	ServerErrors uint    `json:"server_errors"`
+	ErrorRate    float64 `json:"error_rate"` // Share of 4xx and 5xx responses, between 0 and 1
+	P50          float64 `json:"p50"`
+	P90          float64 `json:"p90"`
+	P99          float64 `json:"p99"`
+}
+
+// CallJSON is the JSON representation of a VoIP call, with its jitter in milliseconds
+type CallJSON struct {
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	Codecs   []string `json:"codecs,omitempty"`
+	Answered bool     `json:"answered"`
+	Ended    bool     `json:"ended"`
+	Received uint64   `json:"received"`
+	Lost     uint64   `json:"lost"`
+	Loss     float64  `json:"loss"` // Share of RTP packets lost, between 0 and 1
+	Jitter   float64  `json:"jitter"`
+}
+
+// MailJSON is the JSON representation of the messages and sessions of a mail protocol
+type MailJSON struct {
+	Messages   int `json:"messages"`
+	Upgrades   int `json:"starttls"`
+	Downgrades int `json:"downgrades"`
+}
+
+// MailDomainJSON is the JSON representation of the SMTP messages sent from and to a domain
+type MailDomainJSON struct {
+	Sent     int `json:"sent"`
+	Received int `json:"received"`
+}
+
+// DowngradeJSON is the JSON representation of a mail session downgraded from STARTTLS
+type DowngradeJSON struct {
+	Protocol string    `json:"protocol"`
+	Client   string    `json:"client"`
+	Server   string    `json:"server"`
+	Reason   string    `json:"reason"` // stripped, refused or cleartext
+	Seen     time.Time `json:"seen"`
+}
+
+// SSHJSON is the JSON representation of the SSH sessions of a server, with the duration of the longest in seconds
+type SSHJSON struct {
+	Software string         `json:"software"`
+	Expected bool           `json:"expected"`
+	Sessions map[string]int `json:"sessions"`        // Sessions started, by client address
+	Short    map[string]int `json:"short,omitempty"` // Sessions closed shortly after their start, by client address
+	Clients  map[string]int `json:"clients"`         // Banners of clients, by software
+	Longest  float64        `json:"longest"`
+}
+
+// NTPJSON is the JSON representation of the NTP queries and responses a server exchanged
+type NTPJSON struct {
+	Expected bool              `json:"expected"`
+	Stratum  int               `json:"stratum,omitempty"`
+	Clients  map[string]int    `json:"clients,omitempty"` // Time queries, by client address
+	Commands int               `json:"commands"`          // Control and private queries
+	Queried  map[string]uint64 `json:"queried"`           // Bytes of the queries, by client address
+	Answered map[string]uint64 `json:"answered"`          // Bytes of the responses, by client address
+}
+
+// ConflictJSON is the JSON representation of an IP address claimed by another hardware address
+type ConflictJSON struct {
+	IP             string    `json:"ip"`
+	MAC            string    `json:"mac"`
+	Vendor         string    `json:"vendor,omitempty"`
+	Previous       string    `json:"previous"`
+	PreviousVendor string    `json:"previous_vendor,omitempty"`
+	Gateway        bool      `json:"gateway"`
+	Seen           time.Time `json:"seen"`
+}
+
+// ViolationJSON is the JSON representation of a TLS handshake violating the policy
+type ViolationJSON struct {
+	Client  string    `json:"client"`
+	Server  string    `json:"server"`
+	Version string    `json:"version"`
+	Cipher  string    `json:"cipher"`
+	Reason  string    `json:"reason"` // version, cipher or both comma separated
+	Seen    time.Time `json:"seen"`
+}
+
+// MTUJSON is the JSON representation of the fragmented datagrams sent over a path, and of those too big for it
+type MTUJSON struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Reassembled int    `json:"reassembled"`
+	Incomplete  int    `json:"incomplete"`
+	TooBig      int    `json:"too_big"`
+	MTU         int    `json:"mtu,omitempty"`     // Smallest MTU of a next hop routers told
+	Largest     int    `json:"largest,omitempty"` // Length of the largest datagram reassembled, in bytes
+}
+
+// StallJSON is the JSON representation of the stalls of a direction of a TCP connection, and of the zero windows of
+// its receiver
+type StallJSON struct {
+	Sender      string  `json:"sender"`
+	Receiver    string  `json:"receiver"`
+	Stalls      int     `json:"stalls"`
+	Reason      string  `json:"reason,omitempty"` // Why the data last stalled, unacknowledged or zero_window
+	Longest     float64 `json:"longest"`          // Longest time without progress, in seconds
+	ZeroWindows int     `json:"zero_windows"`
+}
+
+// GroupTrafficJSON is the JSON representation of the traffic sent from a group of networks to another
+type GroupTrafficJSON struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Packets uint64 `json:"packets"`
+	Bytes   uint64 `json:"bytes"`
+}
+
+// DiffJSON is the JSON representation of what changed in a report since the previous one
+type DiffJSON struct {
+	Hits   int             `json:"hits"`
+	Bytes  int64           `json:"bytes"`
+	Flows  int             `json:"flows"`
+	New    []HostDeltaJSON `json:"new_top_talkers,omitempty"`
+	Gone   []HostDeltaJSON `json:"gone_top_talkers,omitempty"`
+	Rising []HostDeltaJSON `json:"rising,omitempty"`
+}
+
+// HostDeltaJSON is the JSON representation of the bytes a host sent during a report window and the previous one
+type HostDeltaJSON struct {
+	IP     string `json:"ip"`
+	Name   string `json:"name,omitempty"`
+	Before uint64 `json:"bytes_before"`
+	After  uint64 `json:"bytes_after"`
+}
+
+// WatchJSON is the JSON representation of the traffic of a watched target over a report window
+type WatchJSON struct {
+	Target       string  `json:"target"`
+	Packets      uint    `json:"packets"`
+	Bytes        uint64  `json:"bytes"`
+	Flows        int     `json:"flows"`
+	Connections  int     `json:"connections"`
+	Established  int     `json:"established"`
+	Refused      int     `json:"refused"`
+	Unanswered   int     `json:"unanswered"`
+	Handshake    float64 `json:"handshake"`     // Mean time to answer connections, in seconds
+	MaxHandshake float64 `json:"max_handshake"` // Longest time to answer a connection, in seconds
+	Silent       float64 `json:"silent"`        // Time since traffic of the target was last seen, in seconds
+	Unreachable  bool    `json:"unreachable"`
+}
+
+// newHostDeltasJSON returns the JSON representation of the bytes sent by hosts
+func newHostDeltasJSON(hosts []analysis.HostDelta) []HostDeltaJSON {
+	var deltas []HostDeltaJSON
+	for _, h := range hosts {
+		deltas = append(deltas, HostDeltaJSON{IP: h.IP, Name: h.Name, Before: h.Before, After: h.After})
+	}
+
+	return deltas
+}
+
+// PipelineJSON is the JSON representation of the activity of the pipeline during a report's window
+type PipelineJSON struct {
+	Counts    map[string]uint64    `json:"counts"`    // Items counted by each stage, e.g. processed or dropped packets
+	Latencies map[string]float64   `json:"latencies"` // Mean processing latency of each stage, in milliseconds
+	Queues    map[string]QueueJSON `json:"queues"`    // Occupancy of the queues between stages, when the report was built
+}
+
+// QueueJSON is the JSON representation of the occupancy of a queue
+type QueueJSON struct {
+	Length   int `json:"length"`
+	Capacity int `json:"capacity"`
+}
+
+// ReportJSON is the JSON representation of a report. Flows are only counted, as they are exported as separate records.
+type ReportJSON struct {
+	Timestamp  time.Time                `json:"timestamp"`
+	Hits       int                      `json:"hits"`
+	Bytes      uint64                   `json:"bytes"`
+	Interfaces map[string]InterfaceJSON `json:"interfaces,omitempty"` // Breakdown of hits and bytes per network interface
+	TopHost    *HostJSON                `json:"top_host,omitempty"`
+	Sections   []SectionJSON            `json:"sections,omitempty"`
+	Flows      int                      `json:"flows"`
+	Events     map[string]int           `json:"events,omitempty"` // Number of events per analyzer
+	Pipeline   *PipelineJSON            `json:"pipeline,omitempty"`
+	Processes  []ProcessJSON            `json:"processes,omitempty"` // Local processes with the most traffic
+	Systems    *SystemsJSON             `json:"systems,omitempty"`   // Guessed operating systems of remote hosts
+	Discovery  map[string]NeighbourJSON `json:"discovery,omitempty"` // Hosts named or advertised by discovery protocols, by IP address
+	HTTP       map[string]HTTPJSON      `json:"http,omitempty"`      // Response times and errors of HTTP hosts, by Host header
+	Paths      []PathJSON               `json:"paths,omitempty"`     // Most requested HTTP paths
+	Agents     map[string]int           `json:"agents,omitempty"`    // Number of HTTP requests, by family of User-Agent
+	Contents   map[string]MediaJSON     `json:"contents,omitempty"`  // HTTP responses, by category of content, e.g. json or video
+	Streams    map[string]StreamJSON    `json:"streams,omitempty"`   // gRPC calls and WebSocket connections, and their messages, by protocol
+	Calls      map[string]CallJSON      `json:"calls,omitempty"`     // VoIP calls, by Call-ID
+
+	Mail      map[string]MailJSON       `json:"mail,omitempty"`          // Mail messages and sessions, by protocol
+	Domains   map[string]MailDomainJSON `json:"mail_domains,omitempty"`  // SMTP messages sent from and to domains
+	Cleartext []DowngradeJSON           `json:"downgrades,omitempty"`    // Mail sessions downgraded from STARTTLS
+	Outbound  map[string]int            `json:"outbound_smtp,omitempty"` // SMTP messages relayed to external servers, by client address
+	SSH       map[string]SSHJSON        `json:"ssh,omitempty"`           // SSH sessions, by server endpoint
+	NTP       map[string]NTPJSON        `json:"ntp,omitempty"`           // NTP queries and responses, by server address
+	Spoofing  []ConflictJSON            `json:"arp_conflicts,omitempty"` // IP addresses claimed by another hardware address
+	Policy    []ViolationJSON           `json:"tls_policy,omitempty"`    // TLS handshakes violating the policy
+	MTU       []MTUJSON                 `json:"mtu,omitempty"`           // Fragmented datagrams and datagrams too big, by path
+	Stalled   []StallJSON               `json:"tcp_stalls,omitempty"`    // TCP connections stalled or closing their window
+	Matrix    []GroupTrafficJSON        `json:"group_matrix,omitempty"`  // Traffic between groups of networks
+	Diff      *DiffJSON                 `json:"diff,omitempty"`          // What changed since the previous report
+	Watched   []WatchJSON               `json:"watched,omitempty"`       // Traffic of the watched targets
+
+	// Connections open for the long-lived age, the oldest first, and TCP connections idle for the stale time but not
+	// closed, the longest idle first
+	LongLived []ConnectionJSON `json:"long_lived,omitempty"`
+	Stale     []ConnectionJSON `json:"stale,omitempty"`
+}
+
+// AlertJSON is the JSON representation of an alert or a recovery
+type AlertJSON struct {
+	ID        uint64    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Recovery  bool      `json:"recovery"`
+	Message   string    `json:"message"`
+	Evidence  string    `json:"evidence,omitempty"` // Path of the pcap file holding the packets that made the alert's hits
+	Notice    bool      `json:"notice,omitempty"`   // Whether the alert is a one-off notice, e.g. of a new host
+	Critical  bool      `json:"critical,omitempty"` // Whether the alert is critical, e.g. of a spoofed gateway
+}
+
+// FlowJSON is the JSON representation of a flow record
+type FlowJSON struct {
+	Interface string    `json:"interface"`
+	Protocol  string    `json:"protocol"`
+	SrcIP     string    `json:"src_ip"`
+	SrcPort   uint16    `json:"src_port"`
+	DstIP     string    `json:"dst_ip"`
+	DstPort   uint16    `json:"dst_port"`
+	SrcPkts   uint      `json:"src_packets"`
+	DstPkts   uint      `json:"dst_packets"`
+	SrcBytes  uint64    `json:"src_bytes"`
+	DstBytes  uint64    `json:"dst_bytes"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+
+	// Docker containers owning the addresses of the originator and the responder
+	SrcContainer string `json:"src_container,omitempty"`
+	DstContainer string `json:"dst_container,omitempty"`
+
+	// Kubernetes pods or services owning the addresses of the originator and the responder
+	SrcWorkload string `json:"src_workload,omitempty"`
+	DstWorkload string `json:"dst_workload,omitempty"`
+
+	// Local processes owning the sockets of the originator and the responder, as <name>[<pid>]
+	SrcProcess string `json:"src_process,omitempty"`
+	DstProcess string `json:"dst_process,omitempty"`
+
+	// Friendly names discovery protocols gave the originator and the responder
+	SrcName string `json:"src_name,omitempty"`
+	DstName string `json:"dst_name,omitempty"`
+}
+
+// ConnectionJSON is the JSON representation of a connection followed across report windows
+type ConnectionJSON struct {
+	Interface string    `json:"interface"`
+	Protocol  string    `json:"protocol"`
+	SrcIP     string    `json:"src_ip"`
+	SrcPort   uint16    `json:"src_port"`
+	DstIP     string    `json:"dst_ip"`
+	DstPort   uint16    `json:"dst_port"`
+	Bytes     uint64    `json:"bytes"` // Bytes sent in both directions since the first packet
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Age       float64   `json:"age"`  // Seconds since the first packet, at the time of the report
+	Idle      float64   `json:"idle"` // Seconds since the last packet, at the time of the report
+
+	// Local processes owning the sockets of the originator and the responder, as <name>[<pid>]
+	SrcProcess string `json:"src_process,omitempty"`
+	DstProcess string `json:"dst_process,omitempty"`
+}
+
+// TalkerJSON is the JSON representation of an IP address with the number of bytes it sent
+type TalkerJSON struct {
+	IP        string `json:"ip"`
+	Bytes     uint64 `json:"bytes"`
+	Container string `json:"container,omitempty"` // Docker container owning the address
+	Workload  string `json:"workload,omitempty"`  // Kubernetes pod or service owning the address
+	Name      string `json:"name,omitempty"`      // Friendly name a discovery protocol gave the address
+}
+
+// RollupJSON is the JSON representation of a rollup
+type RollupJSON struct {
+	Period     string       `json:"period"`
+	Start      time.Time    `json:"start"`
+	End        time.Time    `json:"end"`
+	Reports    int          `json:"reports"`
+	Hits       int          `json:"hits"`
+	Bytes      uint64       `json:"bytes"`
+	PeakRate   float64      `json:"peak_bytes_per_second"`
+	Alerts     int          `json:"alerts"`
+	TopTalkers []TalkerJSON `json:"top_talkers"`
+}
+
+// NewReportJSON returns the JSON representation of a report
+func NewReportJSON(r *analysis.Report) ReportJSON {
+	report := ReportJSON{
+		Timestamp:  r.Timestamp,
+		Hits:       r.Hits,
+		Bytes:      r.Bytes,
+		Interfaces: nil,
+		TopHost:    nil,
+		Sections:   nil,
+		Flows:      len(r.Flows),
+		Events:     r.Events,
+		Pipeline:   nil,
+		Processes:  nil,
+		Systems:    nil,
+		Discovery:  nil,
+		HTTP:       nil,
+		Paths:      nil,
+		Agents:     nil,
+		Contents:   nil,
+		Streams:    nil,
+		Calls:      nil,
+		Mail:       nil,
+		Domains:    nil,
+		Cleartext:  nil,
+		Outbound:   nil,
+		SSH:        nil,
+		NTP:        nil,
+		Spoofing:   nil,
+		Policy:     nil,
+		MTU:        nil,
+		Stalled:    nil,
+		Matrix:     nil,
+		Diff:       nil,
+		Watched:    nil,
+
+		LongLived: newConnectionsJSON(r.LongLived),
+		Stale:     newConnectionsJSON(r.Stale),
+	}
+
+	if r.Pipeline != nil {
+		report.Pipeline = &PipelineJSON{
+			Counts:    r.Pipeline.Counts,
+			Latencies: make(map[string]float64, len(r.Pipeline.Latencies)),
+			Queues:    make(map[string]QueueJSON, len(r.Pipeline.Queues)),
+		}
+		for name, latency := range r.Pipeline.Latencies {
+			report.Pipeline.Latencies[name] = milliseconds(latency.Mean)
+		}
+		for name, queue := range r.Pipeline.Queues {
+			report.Pipeline.Queues[name] = QueueJSON{Length: queue.Length, Capacity: queue.Capacity}
+		}
+	}
+
+	if len(r.Systems) > 0 {
+		report.Systems = &SystemsJSON{Hosts: r.Systems, Breakdown: r.SystemBreakdown()}
+	}
+
+	if len(r.Discovery) > 0 {
+		report.Discovery = make(map[string]NeighbourJSON, len(r.Discovery))
+		for ip, n := range r.Discovery {
+			report.Discovery[ip] = NeighbourJSON{Name: n.Name, Services: n.Services}
+		}
+	}
+
+	if len(r.Responses) > 0 {
+		report.HTTP = make(map[string]HTTPJSON, len(r.Responses))
+		for host, stats := range r.Responses {
+			report.HTTP[host] = HTTPJSON{
+				Responses:    stats.Responses,
+				ClientErrors: stats.ClientErrors,
+				ServerErrors: stats.ServerErrors,
+				ErrorRate:    stats.ErrorRate(),
+				P50:          milliseconds(stats.P50),
+				P90:          milliseconds(stats.P90),
+				P99:          milliseconds(stats.P99),
+			}
+		}
+	}
+
+	for _, p := range r.Paths {
+		report.Paths = append(report.Paths, PathJSON{Host: p.Host, Path: p.Path, Requests: p.Requests})
+	}
+	if len(r.Agents) > 0 {
+		report.Agents = r.Agents
+	}
+	if len(r.Contents) > 0 {
+		report.Contents = make(map[string]MediaJSON, len(r.Contents))
+		for category, stats := range r.Contents {
+			report.Contents[category] = MediaJSON{Responses: stats.Responses, Bytes: stats.Bytes}
+		}
+	}
+	if len(r.Streams) > 0 {
+		report.Streams = make(map[string]StreamJSON, len(r.Streams))
+		for protocol, stats := range r.Streams {
+			report.Streams[protocol] = StreamJSON{Streams: stats.Streams, Messages: stats.Messages}
+		}
+	}
+	if len(r.Calls) > 0 {
+		report.Calls = make(map[string]CallJSON, len(r.Calls))
+		for id, c := range r.Calls {
+			report.Calls[id] = CallJSON{
+				From:     c.From,
+				To:       c.To,
+				Codecs:   c.Codecs,
+				Answered: c.Answered,
+				Ended:    c.Ended,
+				Received: c.Received,
+				Lost:     c.Lost,
+				Loss:     c.Loss(),
+				Jitter:   milliseconds(c.Jitter),
+			}
+		}
+	}
+	if len(r.Mail) > 0 {
+		report.Mail = make(map[string]MailJSON, len(r.Mail))
+		for protocol, stats := range r.Mail {
+			report.Mail[protocol] = MailJSON{Messages: stats.Messages, Upgrades: stats.Upgrades, Downgrades: stats.Downgrades}
+		}
+	}
+	if len(r.Domains) > 0 {
+		report.Domains = make(map[string]MailDomainJSON, len(r.Domains))
+		for domain, stats := range r.Domains {
+			report.Domains[domain] = MailDomainJSON{Sent: stats.Sent, Received: stats.Received}
+		}
+	}
+	for _, d := range r.Cleartext {
+		report.Cleartext = append(report.Cleartext, DowngradeJSON{
+			Protocol: d.Protocol,
+			Client:   d.Client,
+			Server:   d.Server,
+			Reason:   d.Reason,
+			Seen:     d.Seen,
+		})
+	}
+	if len(r.Outbound) > 0 {
+		report.Outbound = r.Outbound
+	}
+	if len(r.SSH) > 0 {
+		report.SSH = make(map[string]SSHJSON, len(r.SSH))
+		for server, s := range r.SSH {
+			report.SSH[server] = SSHJSON{
+				Software: s.Software,
+				Expected: s.Expected,
+				Sessions: s.Sessions,
+				Short:    s.Short,
+				Clients:  s.Clients,
+				Longest:  s.Longest.Seconds(),
+			}
+		}
+	}
+	if len(r.NTP) > 0 {
+		report.NTP = make(map[string]NTPJSON, len(r.NTP))
+		for server, s := range r.NTP {
+			report.NTP[server] = NTPJSON{
+				Expected: s.Expected,
+				Stratum:  s.Stratum,
+				Clients:  s.Clients,
+				Commands: s.Commands,
+				Queried:  s.Queried,
+				Answered: s.Answered,
+			}
+		}
+	}
+	for _, c := range r.Spoofing {
+		report.Spoofing = append(report.Spoofing, ConflictJSON{
+			IP:             c.IP,
+			MAC:            c.MAC,
+			Vendor:         c.Vendor,
+			Previous:       c.Previous,
+			PreviousVendor: c.PreviousVendor,
+			Gateway:        c.Gateway,
+			Seen:           c.Seen,
+		})
+	}
+	for _, v := range r.Policy {
+		report.Policy = append(report.Policy, ViolationJSON{
+			Client:  v.Client,
+			Server:  v.Server,
+			Version: v.Version,
+			Cipher:  v.Cipher,
+			Reason:  v.Reason,
+			Seen:    v.Seen,
+		})
+	}
+	for _, s := range r.MTU {
+		report.MTU = append(report.MTU, MTUJSON{
+			Source:      s.Source,
+			Destination: s.Destination,
+			Reassembled: s.Reassembled,
+			Incomplete:  s.Incomplete,
+			TooBig:      s.TooBig,
+			MTU:         s.MTU,
+			Largest:     s.Largest,
+		})
+	}
+	for _, t := range r.Matrix {
+		report.Matrix = append(report.Matrix, GroupTrafficJSON{From: t.From, To: t.To, Packets: t.Packets, Bytes: t.Bytes})
+	}
+	if r.Diff != nil {
+		report.Diff = &DiffJSON{
+			Hits:   r.Diff.Hits,
+			Bytes:  r.Diff.Bytes,
+			Flows:  r.Diff.Flows,
+			New:    newHostDeltasJSON(r.Diff.New),
+			Gone:   newHostDeltasJSON(r.Diff.Gone),
+			Rising: newHostDeltasJSON(r.Diff.Rising),
+		}
+	}
+	for _, w := range r.Watched {
+		report.Watched = append(report.Watched, WatchJSON{
+			Target:       w.Target,
+			Packets:      w.Packets,
+			Bytes:        w.Bytes,
+			Flows:        w.Flows,
+			Connections:  w.Connections,
+			Established:  w.Established,
+			Refused:      w.Refused,
+			Unanswered:   w.Unanswered,
+			Handshake:    w.Handshake.Seconds(),
+			MaxHandshake: w.MaxHandshake.Seconds(),
+			Silent:       w.Silent.Seconds(),
+			Unreachable:  w.Unreachable,
+		})
+	}
+	for _, s := range r.Stalled {
+		report.Stalled = append(report.Stalled, StallJSON{
+			Sender:      s.Sender,
+			Receiver:    s.Receiver,
+			Stalls:      s.Stalls,
+			Reason:      s.Reason,
+			Longest:     s.Longest.Seconds(),
+			ZeroWindows: s.ZeroWindows,
+		})
+	}
+
+	if len(r.Devices) > 0 {
+		report.Interfaces = make(map[string]InterfaceJSON, len(r.Devices))
+		for name, stats := range r.Devices {
+			var classes map[string]ClassJSON
+			if len(stats.DSCP) > 0 {
+				classes = make(map[string]ClassJSON, len(stats.DSCP))
+				for class, s := range stats.DSCP {
+					classes[class] = ClassJSON{Packets: s.Packets, Bytes: s.Bytes}
+				}
+			}
+			report.Interfaces[name] = InterfaceJSON{
+				Hits:      stats.Hits,
+				Bytes:     stats.Bytes,
+				Container: stats.Container,
+				Broadcast: stats.Broadcast,
+				Multicast: stats.Multicast,
+				Packets:   stats.Packets,
+				Checksum:  stats.Checksum,
+				Truncated: stats.Truncated,
+				Malformed: stats.Malformed,
+				DSCP:      classes,
+			}
+		}
+	}
+
+	if r.TopHost != nil {
+		responses := make(map[string]uint, len(r.TopHost.Responses.Status))
+		for status, nb := range r.TopHost.Responses.Status {
+			responses[strconv.Itoa(status)] = nb
+		}
+
+		report.TopHost = &HostJSON{
+			Host:      r.TopHost.Host,
+			IPs:       r.TopHost.IPs,
+			Hits:      r.TopHost.Hits,
+			Responses: responses,
+		}
+	}
+
+	for _, p := range r.Processes {
+		report.Processes = append(report.Processes, ProcessJSON{PID: p.PID, Name: p.Name, Bytes: p.Bytes, Flows: p.Flows})
+	}
+
+	for _, section := range r.Sections {
+		report.Sections = append(report.Sections, SectionJSON{
+			Section: section.Section,
+			Hits:    section.Hits,
+			Methods: section.Requests.Methods,
+		})
+	}
+
+	return report
+}
+
+// newConnectionsJSON returns the JSON representation of connections, nil if there are none
+func newConnectionsJSON(connections []analysis.Connection) []ConnectionJSON {
+	if len(connections) == 0 {
+		return nil
+	}
+
+	list := make([]ConnectionJSON, 0, len(connections))
+	for _, c := range connections {
+		list = append(list, ConnectionJSON{
+			Interface:  c.Device,
+			Protocol:   c.Protocol,
+			SrcIP:      c.SrcIP,
+			SrcPort:    c.SrcPort,
+			DstIP:      c.DstIP,
+			DstPort:    c.DstPort,
+			Bytes:      c.Bytes,
+			FirstSeen:  c.FirstSeen,
+			LastSeen:   c.LastSeen,
+			Age:        c.Age.Seconds(),
+			Idle:       c.Idle.Seconds(),
+			SrcProcess: c.SrcProcess,
+			DstProcess: c.DstProcess,
+		})
+	}
+
+	return list
+}
+
+// milliseconds returns d in milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// NewAlertJSON returns the JSON representation of an alert
+func NewAlertJSON(a *alert.Message) AlertJSON {
+	return AlertJSON{
+		ID:        a.ID,
+		Timestamp: a.Timestamp,
+		Recovery:  a.Recovery,
+		Message:   a.Body,
+		Evidence:  a.Evidence,
+		Notice:    a.Notice,
+		Critical:  a.Critical,
+	}
+}
+
+// NewFlowJSON returns the JSON representation of a flow record
+func NewFlowJSON(f *analysis.FlowRecord) FlowJSON {
+	return FlowJSON{
+		Interface: f.Device,
+		Protocol:  f.Protocol,
+		SrcIP:     f.SrcIP,
+		SrcPort:   f.SrcPort,
+		DstIP:     f.DstIP,
+		DstPort:   f.DstPort,
+		SrcPkts:   f.SrcPkts,
+		DstPkts:   f.DstPkts,
+		SrcBytes:  f.SrcBytes,
+		DstBytes:  f.DstBytes,
+		FirstSeen: f.FirstSeen,
+		LastSeen:  f.LastSeen,
+
+		SrcContainer: f.SrcContainer,
+		DstContainer: f.DstContainer,
+
+		SrcWorkload: f.SrcWorkload,
+		DstWorkload: f.DstWorkload,
+
+		SrcProcess: f.SrcProcess,
+		DstProcess: f.DstProcess,
+
+		SrcName: f.SrcName,
+		DstName: f.DstName,
+	}
+}
+
+// NewRollupJSON returns the JSON representation of a rollup
+func NewRollupJSON(r *analysis.Rollup) RollupJSON {
+	talkers := r.TopTalkers()
+	topTalkers := make([]TalkerJSON, len(talkers))
+	for i, t := range talkers {
+		topTalkers[i] = TalkerJSON{IP: t.IP, Bytes: t.Bytes, Container: t.Container, Workload: t.Workload, Name: t.Name}
+	}
+
+	return RollupJSON{
+		Period:     r.Period,
+		Start:      r.Start,
+		End:        r.End,
+		Reports:    r.Reports,
+		Hits:       r.Hits,
+		Bytes:      r.Bytes,
+		PeakRate:   r.PeakRate,
+		Alerts:     r.Alerts,
+		TopTalkers: topTalkers,
+	}
+}
+
+// HeartbeatJSON is the JSON representation of a heartbeat
+type HeartbeatJSON struct {
+	Sequence   uint64     `json:"sequence"`
+	Host       string     `json:"host,omitempty"`
+	Session    string     `json:"session,omitempty"`
+	Uptime     float64    `json:"uptime"` // Time since start, in seconds
+	Reports    uint64     `json:"reports"`
+	LastReport *time.Time `json:"last_report,omitempty"`
+	Timestamp  time.Time  `json:"timestamp"`
+}
+
+// NewHeartbeatJSON returns the JSON representation of a heartbeat
+func NewHeartbeatJSON(h *Heartbeat) HeartbeatJSON {
+	heartbeat := HeartbeatJSON{
+		Sequence:   h.Sequence,
+		Host:       h.Host,
+		Session:    h.Session,
+		Uptime:     h.Uptime.Seconds(),
+		Reports:    h.Reports,
+		LastReport: nil,
+		Timestamp:  h.Timestamp,
+	}
+	if !h.LastReport.IsZero() {
+		lastReport := h.LastReport
+		heartbeat.LastReport = &lastReport
+	}
+
+	return heartbeat
+}
+
+// EventJSON wraps either a report, an alert or a rollup, for outputs mixing them in a single stream
+type EventJSON struct {
+	Type   string      `json:"type"`
+	Report *ReportJSON `json:"report,omitempty"`
+	Alert  *AlertJSON  `json:"alert,omitempty"`
+	Rollup *RollupJSON `json:"rollup,omitempty"`
+}
+
+// NewReportEvent returns a report event
+func NewReportEvent(r *analysis.Report) *EventJSON {
+	report := NewReportJSON(r)
+	return &EventJSON{Type: reportEvent, Report: &report}
+}
+
+// NewAlertEvent returns an alert event
+func NewAlertEvent(a *alert.Message) *EventJSON {
+	alert := NewAlertJSON(a)
+	return &EventJSON{Type: alertEvent, Alert: &alert}
+}
+
+// NewRollupEvent returns a rollup event
+func NewRollupEvent(r *analysis.Rollup) *EventJSON {
+	rollup := NewRollupJSON(r)
+	return &EventJSON{Type: rollupEvent, Rollup: &rollup}
+}
+
+// AgentEventJSON is an event forwarded by an agent to the aggregator, along with the flow records of reports if the
+// agent forwards them
+type AgentEventJSON struct {
+	EventJSON
+	Agent string     `json:"agent"`
+	Flows []FlowJSON `json:"flows,omitempty"`
+}
@@ -0,0 +1,168 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/logging"
+	"hash/fnv"
+	"strings"
+	"time"
+)
+
+// Timestamp layout used by Suricata in EVE events
+const eveTimeLayout = "2006-01-02T15:04:05.000000-0700"
+
+// eveFlow holds the flow specific part of an EVE flow event
+type eveFlow struct {
+	PktsToServer  uint   `json:"pkts_toserver"`
+	PktsToClient  uint   `json:"pkts_toclient"`
+	BytesToServer uint64 `json:"bytes_toserver"`
+	BytesToClient uint64 `json:"bytes_toclient"`
+	Start         string `json:"start"`
+	End           string `json:"end"`
+	Age           int64  `json:"age"`
+	State         string `json:"state"`
+	Reason        string `json:"reason"`
+	Alerted       bool   `json:"alerted"`
+}
+
+// eveAlert holds the alert specific part of an EVE alert event
+type eveAlert struct {
+	Action      string `json:"action"`
+	GID         int    `json:"gid"`
+	SignatureID int    `json:"signature_id"`
+	Rev         int    `json:"rev"`
+	Signature   string `json:"signature"`
+	Category    string `json:"category"`
+	Severity    int    `json:"severity"`
+}
+
+// eveEvent is a single line of a Suricata EVE JSON log
+type eveEvent struct {
+	Timestamp string    `json:"timestamp"`
+	FlowID    int64     `json:"flow_id,omitempty"`
+	InIface   string    `json:"in_iface,omitempty"`
+	EventType string    `json:"event_type"`
+	SrcIP     string    `json:"src_ip,omitempty"`
+	SrcPort   uint16    `json:"src_port,omitempty"`
+	DestIP    string    `json:"dest_ip,omitempty"`
+	DestPort  uint16    `json:"dest_port,omitempty"`
+	Proto     string    `json:"proto,omitempty"`
+	Flow      *eveFlow  `json:"flow,omitempty"`
+	Alert     *eveAlert `json:"alert,omitempty"`
+}
+
+// flowID returns a positive identifier for the flow, stable across reports for as long as the flow lives
+func flowID(f *analysis.FlowRecord) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(f.Key()))
+	_, _ = h.Write([]byte(f.FirstSeen.String()))
+	return int64(h.Sum64() >> 1)
+}
+
+// flowToEVE converts a flow record into an EVE flow event.
+// Flows are exported at the end of each report window, hence the timeout reason.
+func flowToEVE(f *analysis.FlowRecord) *eveEvent {
+	state := "new"
+	if f.SrcPkts > 0 && f.DstPkts > 0 {
+		state = "established"
+	}
+
+	return &eveEvent{
+		Timestamp: f.LastSeen.Format(eveTimeLayout),
+		FlowID:    flowID(f),
+		InIface:   f.Device,
+		EventType: "flow",
+		SrcIP:     f.SrcIP,
+		SrcPort:   f.SrcPort,
+		DestIP:    f.DstIP,
+		DestPort:  f.DstPort,
+		Proto:     strings.ToUpper(f.Protocol),
+		Flow: &eveFlow{
+			PktsToServer:  f.SrcPkts,
+			PktsToClient:  f.DstPkts,
+			BytesToServer: f.SrcBytes,
+			BytesToClient: f.DstBytes,
+			Start:         f.FirstSeen.Format(eveTimeLayout),
+			End:           f.LastSeen.Format(eveTimeLayout),
+			Age:           int64(f.Duration() / time.Second),
+			State:         state,
+			Reason:        "timeout",
+			Alerted:       false,
+		},
+	}
+}
+
+// alertToEVE converts an alert into an EVE alert event
+func alertToEVE(a *alert.Message) *eveEvent {
+	event := alertToSecurityEvent(a)
+
+	// Suricata's severities go from 1, the highest, to 3
+	severity := 2
+	if a.Critical && !a.Recovery {
+		severity = 1
+	}
+
+	return &eveEvent{
+		Timestamp: a.Timestamp.Format(eveTimeLayout),
+		EventType: "alert",
+		Alert: &eveAlert{
+			Action:      "allowed",
+			GID:         1,
+			SignatureID: event.signatureID,
+			Rev:         1,
+			Signature:   "GONETMON " + event.name,
+			Category:    "Potentially Bad Traffic",
+			Severity:    severity,
+		},
+	}
+}
+
+// eveSink is a Sink appending flow and alert events to a file, in Suricata's EVE JSON format
+type eveSink struct {
+	file    *logging.RotatingFile
+	encoder *json.Encoder
+}
+
+// newEVESink opens the EVE file configured in parameters and returns a Sink to it
+func newEVESink(parameters *config.Parameters) (*eveSink, error) {
+	file, err := openOutputFile(parameters.EVEFile, parameters.FileRotation)
+	if err != nil {
+		return nil, fmt.Errorf("could not open EVE file : %s", err)
+	}
+
+	log.Info("Writing EVE events to ", parameters.EVEFile)
+
+	return &eveSink{
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}, nil
+}
+
+// SendReport writes a flow event for each of the report's flows
+func (e *eveSink) SendReport(r *analysis.Report) error {
+	for _, flow := range r.Flows {
+		if err := e.encoder.Encode(flowToEVE(flow)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SendAlert writes an alert event. Recoveries have no EVE counterpart and are not written.
+func (e *eveSink) SendAlert(a *alert.Message) error {
+	if a.Recovery {
+		return nil
+	}
+
+	return e.encoder.Encode(alertToEVE(a))
+}
+
+// Close closes the EVE file
+func (e *eveSink) Close() error {
+	return e.file.Close()
+}
@@ -0,0 +1,106 @@
+package output
+
+import (
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"time"
+)
+
+// Pipeline gives access to the state of capture and analysis, for sinks reporting on the health of the monitor
+type Pipeline struct {
+	Devices    *capture.Devices
+	PacketChan chan []capture.PacketMsg
+	ReportChan chan *analysis.Report
+	AlertChan  chan alert.Message
+}
+
+// PipelineSink is implemented by sinks reporting on the state of capture and analysis
+type PipelineSink interface {
+	SetPipeline(p *Pipeline)
+}
+
+// AttachPipeline hands the pipeline to the sinks reporting on it
+func AttachPipeline(sinks []Sink, p *Pipeline) {
+	for _, sink := range sinks {
+		if s, ok := sink.(PipelineSink); ok {
+			s.SetPipeline(p)
+		}
+	}
+}
+
+// interfaceHealthJSON is the JSON representation of the liveness of a capture source
+type interfaceHealthJSON struct {
+	Open       bool       `json:"open"`   // Whether packets are read from the source
+	Recent     bool       `json:"recent"` // Whether a packet was read before it was stale
+	LastPacket *time.Time `json:"last_packet,omitempty"`
+	Dropped    uint64     `json:"dropped"` // Packets dropped as analysis fell behind
+}
+
+// backlogJSON is the JSON representation of the occupation of a channel between stages of the pipeline
+type backlogJSON struct {
+	Length   int `json:"length"`
+	Capacity int `json:"capacity"`
+}
+
+// healthJSON is the JSON representation of the health of the monitor
+type healthJSON struct {
+	Status     string                         `json:"status"` // Either ok or unavailable
+	Interfaces map[string]interfaceHealthJSON `json:"interfaces"`
+	Backlog    map[string]backlogJSON         `json:"backlog"`
+	LastReport *time.Time                     `json:"last_report,omitempty"`
+}
+
+// Status of the health endpoints
+const (
+	healthOK          = "ok"
+	healthUnavailable = "unavailable"
+)
+
+// newHealth returns the health of the pipeline, with the given last report time, zero if none yet.
+// The status is ok if all capture sources are open, and if ready is true, if the last report is not stale either.
+// A nil pipeline is unavailable.
+func newHealth(p *Pipeline, lastReport time.Time, staleAfter time.Duration, ready bool) *healthJSON {
+	health := &healthJSON{
+		Status:     healthUnavailable,
+		Interfaces: make(map[string]interfaceHealthJSON),
+		Backlog:    make(map[string]backlogJSON),
+		LastReport: nil,
+	}
+
+	if !lastReport.IsZero() {
+		health.LastReport = &lastReport
+	}
+
+	if p == nil {
+		return health
+	}
+
+	now := time.Now()
+	open := true
+	for _, dev := range p.Devices.Health() {
+		h := interfaceHealthJSON{
+			Open:       dev.Capturing,
+			Recent:     !dev.LastPacket.IsZero() && now.Sub(dev.LastPacket) < staleAfter,
+			LastPacket: nil,
+			Dropped:    dev.Dropped,
+		}
+		if !dev.LastPacket.IsZero() {
+			last := dev.LastPacket
+			h.LastPacket = &last
+		}
+
+		health.Interfaces[dev.Name] = h
+		open = open && dev.Capturing
+	}
+
+	health.Backlog["packet_batches"] = backlogJSON{Length: len(p.PacketChan), Capacity: cap(p.PacketChan)}
+	health.Backlog["reports"] = backlogJSON{Length: len(p.ReportChan), Capacity: cap(p.ReportChan)}
+	health.Backlog["alerts"] = backlogJSON{Length: len(p.AlertChan), Capacity: cap(p.AlertChan)}
+
+	if open && (!ready || (!lastReport.IsZero() && now.Sub(lastReport) < staleAfter)) {
+		health.Status = healthOK
+	}
+
+	return health
+}
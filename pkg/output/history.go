@@ -0,0 +1,126 @@
+package output
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/logging"
+	"io"
+	"os"
+	"time"
+)
+
+// History holds reports and alerts read back from the history file
+type History struct {
+	reports []ReportJSON
+	alerts  []AlertJSON
+}
+
+// historySink is a Sink recording reports, alerts and rollups to a file, one JSON event per line, for later summaries
+type historySink struct {
+	file    *logging.RotatingFile
+	encoder *json.Encoder
+}
+
+// newHistorySink opens the history file configured in parameters and returns a Sink to it
+func newHistorySink(parameters *config.Parameters) (*historySink, error) {
+	file, err := openOutputFile(parameters.HistoryFile, parameters.FileRotation)
+	if err != nil {
+		return nil, fmt.Errorf("could not open history file : %s", err)
+	}
+
+	log.Info("Recording history to ", parameters.HistoryFile)
+
+	return &historySink{
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}, nil
+}
+
+// SendReport records the report
+func (h *historySink) SendReport(r *analysis.Report) error {
+	return h.encoder.Encode(NewReportEvent(r))
+}
+
+// SendAlert records the alert
+func (h *historySink) SendAlert(a *alert.Message) error {
+	return h.encoder.Encode(NewAlertEvent(a))
+}
+
+// SendRollup records the rollup
+func (h *historySink) SendRollup(r *analysis.Rollup) error {
+	return h.encoder.Encode(NewRollupEvent(r))
+}
+
+// Close closes the history file
+func (h *historySink) Close() error {
+	return h.file.Close()
+}
+
+// ReadHistory reads the reports and alerts recorded in the history file at path since the given time, along with its
+// rotated files modified since then. Malformed lines are skipped.
+func ReadHistory(path string, since time.Time) (*History, error) {
+	backups, err := logging.Backups(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not list rotated history files : %s", err)
+	}
+
+	history := &History{}
+	for _, backup := range backups {
+		if info, err := os.Stat(backup); err == nil && info.ModTime().Before(since) {
+			continue
+		}
+
+		file, err := logging.OpenBackup(backup)
+		if err != nil {
+			return nil, fmt.Errorf("could not open rotated history file : %s", err)
+		}
+		err = readHistory(file, backup, since, history)
+		_ = file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open history file : %s", err)
+	}
+	defer file.Close()
+
+	if err := readHistory(file, path, since, history); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// readHistory adds the reports and alerts recorded since the given time in the named history file to history
+func readHistory(r io.Reader, name string, since time.Time, history *History) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		var record EventJSON
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			log.Warn("Skipping malformed line ", line, " of ", name, " : ", err)
+			continue
+		}
+
+		switch {
+		case record.Type == reportEvent && record.Report != nil && !record.Report.Timestamp.Before(since):
+			history.reports = append(history.reports, *record.Report)
+		case record.Type == alertEvent && record.Alert != nil && !record.Alert.Timestamp.Before(since):
+			history.alerts = append(history.alerts, *record.Alert)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("could not read history file %s : %s", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/segmentio/kafka-go"
+	"time"
+)
+
+// kafkaSink is a Sink publishing reports, alerts, flow records, rollups and heartbeats as JSON messages to Kafka topics
+type kafkaSink struct {
+	writer      *kafka.Writer
+	reportTopic string
+	alertTopic  string
+	flowTopic   string
+	rollupTopic string
+	beatTopic   string
+	timeout     time.Duration
+}
+
+// newKafkaSink returns a Sink publishing to the brokers and topics configured in parameters
+func newKafkaSink(parameters *config.Parameters) *kafkaSink {
+	log.Info("Publishing to Kafka brokers ", parameters.Kafka.Brokers)
+
+	return &kafkaSink{
+		// The topic is set on each message, so a single writer serves all topics
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(parameters.Kafka.Brokers...),
+			Balancer:     &kafka.LeastBytes{},
+			WriteTimeout: parameters.Kafka.Timeout,
+		},
+		reportTopic: parameters.Kafka.ReportTopic,
+		alertTopic:  parameters.Kafka.AlertTopic,
+		flowTopic:   parameters.Kafka.FlowTopic,
+		rollupTopic: parameters.Kafka.RollupTopic,
+		beatTopic:   parameters.Kafka.BeatTopic,
+		timeout:     parameters.Kafka.Timeout,
+	}
+}
+
+// newMessage returns a message holding the JSON encoding of v, to be published on topic
+func newMessage(topic string, v interface{}, t time.Time) (kafka.Message, error) {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+
+	return kafka.Message{
+		Topic: topic,
+		Value: value,
+		Time:  t,
+	}, nil
+}
+
+// publish writes messages to the brokers
+func (k *kafkaSink) publish(messages ...kafka.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), k.timeout)
+	defer cancel()
+
+	return k.writer.WriteMessages(ctx, messages...)
+}
+
+// SendReport publishes the report to the report topic, and each of its flows to the flow topic
+func (k *kafkaSink) SendReport(r *analysis.Report) error {
+	var messages []kafka.Message
+
+	if k.reportTopic != "" {
+		m, err := newMessage(k.reportTopic, NewReportJSON(r), r.Timestamp)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, m)
+	}
+
+	if k.flowTopic != "" {
+		for _, flow := range r.Flows {
+			m, err := newMessage(k.flowTopic, NewFlowJSON(flow), flow.LastSeen)
+			if err != nil {
+				return err
+			}
+			messages = append(messages, m)
+		}
+	}
+
+	return k.publish(messages...)
+}
+
+// SendAlert publishes the alert to the alert topic
+func (k *kafkaSink) SendAlert(a *alert.Message) error {
+	if k.alertTopic == "" {
+		return nil
+	}
+
+	m, err := newMessage(k.alertTopic, NewAlertJSON(a), a.Timestamp)
+	if err != nil {
+		return err
+	}
+
+	return k.publish(m)
+}
+
+// SendRollup publishes the rollup to the rollup topic
+func (k *kafkaSink) SendRollup(r *analysis.Rollup) error {
+	if k.rollupTopic == "" {
+		return nil
+	}
+
+	m, err := newMessage(k.rollupTopic, NewRollupJSON(r), r.End)
+	if err != nil {
+		return err
+	}
+
+	return k.publish(m)
+}
+
+// SendHeartbeat publishes the heartbeat to the heartbeat topic
+func (k *kafkaSink) SendHeartbeat(h *Heartbeat) error {
+	if k.beatTopic == "" {
+		return nil
+	}
+
+	m, err := newMessage(k.beatTopic, NewHeartbeatJSON(h), h.Timestamp)
+	if err != nil {
+		return err
+	}
+
+	return k.publish(m)
+}
+
+// Close flushes pending messages and closes connections to the brokers
+func (k *kafkaSink) Close() error {
+	return k.writer.Close()
+}
@@ -0,0 +1,101 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// lokiStream is a set of log lines sharing the same labels, as expected by Loki's push API
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"` // Pairs of nanosecond timestamps and log lines
+}
+
+type lokiPush struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+// lokiSink is a Sink pushing report lines and alerts to Grafana Loki
+type lokiSink struct {
+	url     string
+	headers map[string]string
+	labels  map[string]string
+	retries int
+	backoff time.Duration
+	client  *http.Client
+}
+
+// newLokiSink returns a Sink pushing to the Loki instance configured in parameters
+func newLokiSink(parameters *config.Parameters) (*lokiSink, error) {
+	config := &parameters.Loki
+
+	client, err := newHTTPClient(&config.TLS, config.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("could not set up TLS for Loki : %s", err)
+	}
+
+	headers := make(map[string]string)
+	if config.TenantID != "" {
+		headers["X-Scope-OrgID"] = config.TenantID
+	}
+
+	log.Info("Pushing to Loki at ", config.URL)
+
+	return &lokiSink{
+		url:     config.URL,
+		headers: headers,
+		labels:  config.Labels,
+		retries: config.Retries,
+		backoff: config.Backoff,
+		client:  client,
+	}, nil
+}
+
+// push sends lines to Loki in a single stream labelled with the configured labels and the given type.
+// Each line is shifted by a nanosecond to preserve their order.
+func (l *lokiSink) push(recordType string, t time.Time, lines []string) error {
+	labels := make(map[string]string, len(l.labels)+1)
+	for name, value := range l.labels {
+		labels[name] = value
+	}
+	labels["type"] = recordType
+
+	stream := lokiStream{
+		Stream: labels,
+		Values: make([][2]string, len(lines)),
+	}
+	for i, line := range lines {
+		stream.Values[i] = [2]string{strconv.FormatInt(t.UnixNano()+int64(i), 10), line}
+	}
+
+	body, err := json.Marshal(lokiPush{Streams: []lokiStream{stream}})
+	if err != nil {
+		return err
+	}
+
+	return retry(l.retries, l.backoff, func() error {
+		_, err := httpPost(l.client, l.url, "application/json", l.headers, body)
+		return err
+	})
+}
+
+// SendReport pushes the report's text lines
+func (l *lokiSink) SendReport(r *analysis.Report) error {
+	return l.push("report", r.Timestamp, ReportLines(r))
+}
+
+// SendAlert pushes the alert's message
+func (l *lokiSink) SendAlert(a *alert.Message) error {
+	return l.push("alert", a.Timestamp, []string{a.Body})
+}
+
+// Close has nothing to release, as the HTTP client does not hold persistent resources
+func (l *lokiSink) Close() error {
+	return nil
+}
@@ -0,0 +1,169 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"net"
+	"strings"
+	"time"
+)
+
+// Largest number of bytes written at once, for StatsD datagrams to fit in the usual MTU of 1500 bytes, without being
+// fragmented or dropped
+const maxMetricsWrite = 1432
+
+// metricsSink is a Sink exporting hit counts, byte rates, alert state and liveness to a StatsD or Graphite endpoint
+type metricsSink struct {
+	protocol string // Either config.StatsdOutput or config.GraphiteOutput
+	prefix   string
+	window   time.Duration // Duration covered by a report, used to compute rates
+	conn     net.Conn
+}
+
+// newMetricsSink connects to the endpoint configured in parameters and returns a Sink to it.
+// protocol is either config.StatsdOutput or config.GraphiteOutput.
+func newMetricsSink(parameters *config.Parameters, protocol string) (*metricsSink, error) {
+	conn, err := net.Dial(parameters.Metrics.Network, parameters.Metrics.Address)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %s endpoint %s : %s", protocol, parameters.Metrics.Address, err)
+	}
+
+	log.Info("Exporting metrics to ", protocol, " endpoint ", parameters.Metrics.Address)
+
+	return &metricsSink{
+		protocol: protocol,
+		prefix:   parameters.Metrics.Prefix,
+		window:   parameters.DisplayRefresh,
+		conn:     conn,
+	}, nil
+}
+
+// writeMetric appends a single metric line to buf, formatted according to the sink's protocol.
+// statsdType is the StatsD metric type ("c" for counters, "g" for gauges), and is ignored by Graphite.
+func (m *metricsSink) writeMetric(buf *bytes.Buffer, name string, value float64, statsdType string, t time.Time) {
+	if m.prefix != "" {
+		name = m.prefix + "." + name
+	}
+
+	switch m.protocol {
+	case config.StatsdOutput:
+		fmt.Fprintf(buf, "%s:%g|%s\n", name, value, statsdType)
+	case config.GraphiteOutput:
+		fmt.Fprintf(buf, "%s %g %d\n", name, value, t.Unix())
+	}
+}
+
+// metricLabel returns the name of an interface or of a DSCP class as a component of metric names, lower case without
+// the dots and spaces that separate components, e.g. eth0_100 for eth0.100 or dscp5 for DSCP 5
+func metricLabel(name string) string {
+	return strings.ToLower(strings.NewReplacer(".", "_", " ", "").Replace(name))
+}
+
+// send writes the buffered metrics to the endpoint, in writes of whole lines of at most maxMetricsWrite bytes. A line
+// longer than that is written alone.
+func (m *metricsSink) send(buf *bytes.Buffer) error {
+	data := buf.Bytes()
+	for len(data) > 0 {
+		n := len(data)
+		if n > maxMetricsWrite {
+			n = bytes.LastIndexByte(data[:maxMetricsWrite], '\n') + 1
+			if n == 0 {
+				if n = bytes.IndexByte(data, '\n') + 1; n == 0 {
+					n = len(data)
+				}
+			}
+		}
+
+		if _, err := m.conn.Write(data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+
+	return nil
+}
+
+// SendReport exports the number of hits, bytes and the byte rate of the report's window, the traffic of DSCP classes
+// by interface, the traffic of watched targets, and the activity of the pipeline
+func (m *metricsSink) SendReport(r *analysis.Report) error {
+	var buf bytes.Buffer
+
+	m.writeMetric(&buf, "hits", float64(r.Hits), "c", r.Timestamp)
+	m.writeMetric(&buf, "bytes", float64(r.Bytes), "c", r.Timestamp)
+	m.writeMetric(&buf, "bytes_per_second", float64(r.Bytes)/m.window.Seconds(), "g", r.Timestamp)
+
+	if r.TopHost != nil {
+		m.writeMetric(&buf, "top_host_hits", float64(r.TopHost.Hits), "g", r.Timestamp)
+	}
+
+	for name, stats := range r.Devices {
+		for class, s := range stats.DSCP {
+			prefix := "dscp." + metricLabel(name) + "." + metricLabel(class)
+			m.writeMetric(&buf, prefix+".packets", float64(s.Packets), "c", r.Timestamp)
+			m.writeMetric(&buf, prefix+".bytes", float64(s.Bytes), "c", r.Timestamp)
+		}
+	}
+
+	for _, w := range r.Watched {
+		// Colons separate the value of StatsD metrics, and brackets enclose IPv6 addresses of targets
+		prefix := "watch." + metricLabel(strings.NewReplacer(":", "_", "[", "", "]", "").Replace(w.Target))
+		m.writeMetric(&buf, prefix+".packets", float64(w.Packets), "c", r.Timestamp)
+		m.writeMetric(&buf, prefix+".bytes", float64(w.Bytes), "c", r.Timestamp)
+		m.writeMetric(&buf, prefix+".connections", float64(w.Connections), "c", r.Timestamp)
+		m.writeMetric(&buf, prefix+".failed", float64(w.Refused+w.Unanswered), "c", r.Timestamp)
+		m.writeMetric(&buf, prefix+".handshake_ms", milliseconds(w.Handshake), "g", r.Timestamp)
+		m.writeMetric(&buf, prefix+".silent_seconds", w.Silent.Seconds(), "g", r.Timestamp)
+	}
+
+	if r.Pipeline != nil {
+		for name, count := range r.Pipeline.Counts {
+			m.writeMetric(&buf, "pipeline."+name, float64(count), "c", r.Timestamp)
+		}
+		for name, latency := range r.Pipeline.Latencies {
+			m.writeMetric(&buf, "pipeline."+name+".latency_ms", milliseconds(latency.Mean), "g", r.Timestamp)
+		}
+		for name, queue := range r.Pipeline.Queues {
+			m.writeMetric(&buf, "pipeline.queue."+name, float64(queue.Length), "g", r.Timestamp)
+		}
+	}
+
+	return m.send(&buf)
+}
+
+// SendAlert exports the alert state transition, 1 when raised and 0 when recovered. Notices are only counted.
+func (m *metricsSink) SendAlert(a *alert.Message) error {
+	var buf bytes.Buffer
+
+	if a.Notice {
+		m.writeMetric(&buf, "notices", 1, "c", a.Timestamp)
+		return m.send(&buf)
+	}
+
+	state := 1.0
+	if a.Recovery {
+		state = 0
+	} else {
+		m.writeMetric(&buf, "alerts", 1, "c", a.Timestamp)
+	}
+	m.writeMetric(&buf, "alert", state, "g", a.Timestamp)
+
+	return m.send(&buf)
+}
+
+// SendHeartbeat exports the liveness of the monitor, always 1, and its uptime
+func (m *metricsSink) SendHeartbeat(h *Heartbeat) error {
+	var buf bytes.Buffer
+
+	m.writeMetric(&buf, "up", 1, "g", h.Timestamp)
+	m.writeMetric(&buf, "uptime_seconds", h.Uptime.Seconds(), "g", h.Timestamp)
+
+	return m.send(&buf)
+}
+
+// Close closes the connection to the endpoint
+func (m *metricsSink) Close() error {
+	return m.conn.Close()
+}
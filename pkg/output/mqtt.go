@@ -0,0 +1,128 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/config"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"time"
+)
+
+// mqttSink is a Sink publishing reports and alerts as JSON messages to an MQTT broker
+type mqttSink struct {
+	client      mqtt.Client
+	reportTopic string
+	alertTopic  string
+	rollupTopic string
+	beatTopic   string
+	qos         byte
+	retain      bool
+	timeout     time.Duration
+}
+
+// newMQTTSink connects to the broker configured in parameters and returns a Sink to it
+func newMQTTSink(parameters *config.Parameters) (*mqttSink, error) {
+	config := &parameters.MQTT
+
+	if config.QoS > 2 {
+		return nil, fmt.Errorf("invalid MQTT QoS level %d, must be 0, 1 or 2", config.QoS)
+	}
+
+	tlsConfig, err := NewTLSConfig(&config.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("could not set up TLS for MQTT : %s", err)
+	}
+
+	options := mqtt.NewClientOptions().
+		AddBroker(config.Broker).
+		SetClientID(config.ClientID).
+		SetUsername(config.Username).
+		SetPassword(config.Password).
+		SetAutoReconnect(true).
+		SetConnectTimeout(config.Timeout).
+		SetWriteTimeout(config.Timeout)
+
+	if tlsConfig != nil {
+		options.SetTLSConfig(tlsConfig)
+	}
+
+	client := mqtt.NewClient(options)
+	token := client.Connect()
+	if !token.WaitTimeout(config.Timeout) {
+		return nil, fmt.Errorf("timed out connecting to MQTT broker %s", config.Broker)
+	}
+	if err := token.Error(); err != nil {
+		return nil, fmt.Errorf("could not connect to MQTT broker %s : %s", config.Broker, err)
+	}
+
+	log.Info("Publishing to MQTT broker ", config.Broker)
+
+	return &mqttSink{
+		client:      client,
+		reportTopic: config.TopicPrefix + "/reports",
+		alertTopic:  config.TopicPrefix + "/alerts",
+		rollupTopic: config.TopicPrefix + "/rollups",
+		beatTopic:   config.TopicPrefix + "/heartbeats",
+		qos:         config.QoS,
+		retain:      config.Retain,
+		timeout:     config.Timeout,
+	}, nil
+}
+
+// publish sends payload to topic and waits for the broker's acknowledgement according to QoS
+func (m *mqttSink) publish(topic string, payload []byte) error {
+	token := m.client.Publish(topic, m.qos, m.retain, payload)
+	if !token.WaitTimeout(m.timeout) {
+		return fmt.Errorf("timed out publishing to MQTT topic %s", topic)
+	}
+
+	return token.Error()
+}
+
+// SendReport publishes the report to the reports topic
+func (m *mqttSink) SendReport(r *analysis.Report) error {
+	payload, err := json.Marshal(NewReportJSON(r))
+	if err != nil {
+		return err
+	}
+
+	return m.publish(m.reportTopic, payload)
+}
+
+// SendAlert publishes the alert to the alerts topic
+func (m *mqttSink) SendAlert(a *alert.Message) error {
+	payload, err := json.Marshal(NewAlertJSON(a))
+	if err != nil {
+		return err
+	}
+
+	return m.publish(m.alertTopic, payload)
+}
+
+// SendRollup publishes the rollup to the rollups topic
+func (m *mqttSink) SendRollup(r *analysis.Rollup) error {
+	payload, err := json.Marshal(NewRollupJSON(r))
+	if err != nil {
+		return err
+	}
+
+	return m.publish(m.rollupTopic, payload)
+}
+
+// SendHeartbeat publishes the heartbeat to the heartbeats topic
+func (m *mqttSink) SendHeartbeat(h *Heartbeat) error {
+	payload, err := json.Marshal(NewHeartbeatJSON(h))
+	if err != nil {
+		return err
+	}
+
+	return m.publish(m.beatTopic, payload)
+}
+
+// Close disconnects from the broker, leaving some time for pending messages to be sent
+func (m *mqttSink) Close() error {
+	m.client.Disconnect(uint(m.timeout / time.Millisecond))
+	return nil
+}
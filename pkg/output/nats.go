@@ -0,0 +1,144 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/nats-io/nats.go"
+	"time"
+)
+
+// natsSink is a Sink publishing reports, alerts and flow records as JSON messages to a NATS server
+type natsSink struct {
+	conn          *nats.Conn
+	reportSubject string
+	alertSubject  string
+	flowSubject   string
+	rollupSubject string
+	beatSubject   string
+	timeout       time.Duration
+}
+
+// newNATSSink connects to the server configured in parameters and returns a Sink to it
+func newNATSSink(parameters *config.Parameters) (*natsSink, error) {
+	config := &parameters.NATS
+
+	options := []nats.Option{
+		nats.Name("gonetmon"),
+		nats.Timeout(config.Timeout),
+	}
+
+	if config.Token != "" {
+		options = append(options, nats.Token(config.Token))
+	}
+
+	tlsConfig, err := NewTLSConfig(&config.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("could not set up TLS for NATS : %s", err)
+	}
+	if tlsConfig != nil {
+		options = append(options, nats.Secure(tlsConfig))
+	}
+
+	conn, err := nats.Connect(config.URL, options...)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to NATS server %s : %s", config.URL, err)
+	}
+
+	log.Info("Publishing to NATS server ", conn.ConnectedUrl())
+
+	return &natsSink{
+		conn:          conn,
+		reportSubject: config.ReportSubject,
+		alertSubject:  config.AlertSubject,
+		flowSubject:   config.FlowSubject,
+		rollupSubject: config.RollupSubject,
+		beatSubject:   config.BeatSubject,
+		timeout:       config.Timeout,
+	}, nil
+}
+
+// SendReport publishes the report to the report subject, and each of its flows to the flow subject
+func (n *natsSink) SendReport(r *analysis.Report) error {
+	if n.reportSubject != "" {
+		payload, err := json.Marshal(NewReportJSON(r))
+		if err != nil {
+			return err
+		}
+		if err := n.conn.Publish(n.reportSubject, payload); err != nil {
+			return err
+		}
+	}
+
+	if n.flowSubject != "" {
+		for _, flow := range r.Flows {
+			payload, err := json.Marshal(NewFlowJSON(flow))
+			if err != nil {
+				return err
+			}
+			if err := n.conn.Publish(n.flowSubject, payload); err != nil {
+				return err
+			}
+		}
+	}
+
+	return n.conn.FlushTimeout(n.timeout)
+}
+
+// SendAlert publishes the alert to the alert subject
+func (n *natsSink) SendAlert(a *alert.Message) error {
+	if n.alertSubject == "" {
+		return nil
+	}
+
+	payload, err := json.Marshal(NewAlertJSON(a))
+	if err != nil {
+		return err
+	}
+	if err := n.conn.Publish(n.alertSubject, payload); err != nil {
+		return err
+	}
+
+	return n.conn.FlushTimeout(n.timeout)
+}
+
+// SendRollup publishes the rollup to the rollup subject
+func (n *natsSink) SendRollup(r *analysis.Rollup) error {
+	if n.rollupSubject == "" {
+		return nil
+	}
+
+	payload, err := json.Marshal(NewRollupJSON(r))
+	if err != nil {
+		return err
+	}
+	if err := n.conn.Publish(n.rollupSubject, payload); err != nil {
+		return err
+	}
+
+	return n.conn.FlushTimeout(n.timeout)
+}
+
+// SendHeartbeat publishes the heartbeat to the heartbeat subject
+func (n *natsSink) SendHeartbeat(h *Heartbeat) error {
+	if n.beatSubject == "" {
+		return nil
+	}
+
+	payload, err := json.Marshal(NewHeartbeatJSON(h))
+	if err != nil {
+		return err
+	}
+	if err := n.conn.Publish(n.beatSubject, payload); err != nil {
+		return err
+	}
+
+	return n.conn.FlushTimeout(n.timeout)
+}
+
+// Close publishes pending messages and closes the connection
+func (n *natsSink) Close() error {
+	return n.conn.Drain()
+}
@@ -0,0 +1,216 @@
+package output
+
+import (
+	"encoding/json"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// OTLP aggregation temporality of sums, as defined in the OpenTelemetry metrics protocol
+const otlpTemporalityDelta = 1
+
+// The following types mirror the JSON encoding of an OTLP ExportMetricsServiceRequest.
+// 64 bits integers are encoded as strings, as mandated by the protobuf JSON mapping.
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpDataPoint struct {
+	StartTimeUnixNano string   `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string   `json:"timeUnixNano"`
+	AsInt             string   `json:"asInt,omitempty"`
+	AsDouble          *float64 `json:"asDouble,omitempty"`
+}
+
+type otlpSum struct {
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpMetric struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Unit        string     `json:"unit,omitempty"`
+	Sum         *otlpSum   `json:"sum,omitempty"`
+	Gauge       *otlpGauge `json:"gauge,omitempty"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+// otlpSink is a Sink exporting metrics to an OpenTelemetry collector over OTLP/HTTP, using the JSON encoding
+type otlpSink struct {
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+	window      time.Duration // Duration covered by a report, used to compute rates and sum start times
+	client      *http.Client
+}
+
+// newOTLPSink returns a Sink exporting to the collector configured in parameters
+func newOTLPSink(parameters *config.Parameters) *otlpSink {
+	log.Info("Exporting metrics to OpenTelemetry collector ", parameters.OTLP.Endpoint)
+
+	return &otlpSink{
+		endpoint:    parameters.OTLP.Endpoint,
+		headers:     parameters.OTLP.Headers,
+		serviceName: parameters.OTLP.ServiceName,
+		window:      parameters.DisplayRefresh,
+		client:      &http.Client{Timeout: parameters.OTLP.Timeout},
+	}
+}
+
+// unixNano returns the OTLP JSON representation of t
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// deltaSum returns a monotonic sum metric holding value, accumulated between start and end
+func deltaSum(name string, unit string, value uint64, start time.Time, end time.Time) otlpMetric {
+	return otlpMetric{
+		Name: name,
+		Unit: unit,
+		Sum: &otlpSum{
+			AggregationTemporality: otlpTemporalityDelta,
+			IsMonotonic:            true,
+			DataPoints: []otlpDataPoint{{
+				StartTimeUnixNano: unixNano(start),
+				TimeUnixNano:      unixNano(end),
+				AsInt:             strconv.FormatUint(value, 10),
+			}},
+		},
+	}
+}
+
+// gauge returns a gauge metric holding value at time t
+func gauge(name string, unit string, value float64, t time.Time) otlpMetric {
+	return otlpMetric{
+		Name: name,
+		Unit: unit,
+		Gauge: &otlpGauge{
+			DataPoints: []otlpDataPoint{{
+				TimeUnixNano: unixNano(t),
+				AsDouble:     &value,
+			}},
+		},
+	}
+}
+
+// export wraps metrics in a request and sends it to the collector
+func (o *otlpSink) export(metrics []otlpMetric) error {
+	request := otlpRequest{
+		ResourceMetrics: []otlpResourceMetrics{{
+			Resource: otlpResource{
+				Attributes: []otlpAttribute{{
+					Key:   "service.name",
+					Value: otlpValue{StringValue: o.serviceName},
+				}},
+			},
+			ScopeMetrics: []otlpScopeMetrics{{
+				Scope:   otlpScope{Name: "gonetmon"},
+				Metrics: metrics,
+			}},
+		}},
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	_, err = httpPost(o.client, o.endpoint, "application/json", o.headers, body)
+	return err
+}
+
+// SendReport exports the number of hits, bytes and the byte rate of the report's window, the traffic of DSCP classes
+// by interface, and the activity of the pipeline
+func (o *otlpSink) SendReport(r *analysis.Report) error {
+	start := r.Timestamp.Add(-o.window)
+
+	metrics := []otlpMetric{
+		deltaSum("gonetmon.hits", "{hit}", uint64(r.Hits), start, r.Timestamp),
+		deltaSum("gonetmon.bytes", "By", r.Bytes, start, r.Timestamp),
+		gauge("gonetmon.bytes_per_second", "By/s", float64(r.Bytes)/o.window.Seconds(), r.Timestamp),
+	}
+
+	for name, stats := range r.Devices {
+		for class, s := range stats.DSCP {
+			prefix := "gonetmon.dscp." + metricLabel(name) + "." + metricLabel(class)
+			metrics = append(metrics, deltaSum(prefix+".packets", "{packet}", s.Packets, start, r.Timestamp))
+			metrics = append(metrics, deltaSum(prefix+".bytes", "By", s.Bytes, start, r.Timestamp))
+		}
+	}
+
+	if r.Pipeline != nil {
+		for name, count := range r.Pipeline.Counts {
+			metrics = append(metrics, deltaSum("gonetmon.pipeline."+name, "{item}", count, start, r.Timestamp))
+		}
+		for name, latency := range r.Pipeline.Latencies {
+			metrics = append(metrics, gauge("gonetmon.pipeline."+name+".latency", "ms", milliseconds(latency.Mean), r.Timestamp))
+		}
+		for name, queue := range r.Pipeline.Queues {
+			metrics = append(metrics, gauge("gonetmon.pipeline.queue."+name, "{item}", float64(queue.Length), r.Timestamp))
+		}
+	}
+
+	return o.export(metrics)
+}
+
+// SendAlert exports the alert state, 1 when raised and 0 when recovered
+func (o *otlpSink) SendAlert(a *alert.Message) error {
+	state := 1.0
+	if a.Recovery {
+		state = 0
+	}
+
+	return o.export([]otlpMetric{
+		gauge("gonetmon.alert", "1", state, a.Timestamp),
+	})
+}
+
+// SendHeartbeat exports the liveness of the monitor, always 1, and its uptime
+func (o *otlpSink) SendHeartbeat(h *Heartbeat) error {
+	return o.export([]otlpMetric{
+		gauge("gonetmon.up", "1", 1, h.Timestamp),
+		gauge("gonetmon.uptime", "s", h.Uptime.Seconds(), h.Timestamp),
+	})
+}
+
+// Close has nothing to release, as the HTTP client does not hold persistent resources
+func (o *otlpSink) Close() error {
+	return nil
+}
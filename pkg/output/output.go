@@ -0,0 +1,294 @@
+// Package output sends reports, alerts and rollups to the console and to external systems
+package output
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/logging"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var log = config.Logger
+
+// Sink is an output destination that reports and alerts are sent to
+type Sink interface {
+	// SendReport outputs a report built at the end of a monitoring window
+	SendReport(r *analysis.Report) error
+
+	// SendAlert outputs an alert or a recovery message raised by the watchdog
+	SendAlert(a *alert.Message) error
+
+	// Close releases any resources held by the sink
+	Close() error
+}
+
+// RollupSink is implemented by sinks that can output rollups. Other sinks do not receive them.
+type RollupSink interface {
+	SendRollup(r *analysis.Rollup) error
+}
+
+// HeartbeatSink is implemented by sinks that can output heartbeats. Other sinks do not receive them.
+type HeartbeatSink interface {
+	SendHeartbeat(h *Heartbeat) error
+}
+
+// Heartbeat is a periodic sign of life of the monitor, sent whatever the traffic, so that external systems tell the
+// monitor being gone from a quiet network
+type Heartbeat struct {
+	Sequence   uint64        // Number of the heartbeat since start, from 1
+	Host       string        // Name of the host the monitor runs on
+	Session    string        // Name of the monitoring session, empty for the default one
+	Uptime     time.Duration // Time since the outputs were started
+	Reports    uint64        // Reports received since start
+	LastReport time.Time     // Time the last report was received at, zero until the first one
+	Timestamp  time.Time
+}
+
+// NamedSink is implemented by sinks set up apart from the configured outputs, e.g. APIs, to name them in logs
+type NamedSink interface {
+	Name() string
+}
+
+// NewSinks returns a sink for each output set in parameters. If one of them fails, those already set up are closed.
+func NewSinks(parameters *config.Parameters) ([]Sink, error) {
+	if len(parameters.Outputs) == 0 {
+		return nil, errors.New("no output configured")
+	}
+
+	sinks := make([]Sink, 0, len(parameters.Outputs))
+	for _, output := range parameters.Outputs {
+		sink, err := NewSink(parameters, output)
+		if err != nil {
+			for _, s := range sinks {
+				_ = s.Close()
+			}
+			return nil, fmt.Errorf("could not set up %s output : %s", output, err)
+		}
+		sinks = append(sinks, sink)
+	}
+
+	return sinks, nil
+}
+
+// NewSink returns the sink corresponding to the output type
+func NewSink(parameters *config.Parameters, output string) (Sink, error) {
+	switch output {
+	case config.ConsoleOutput:
+		return newConsole(parameters)
+	case config.StatsdOutput, config.GraphiteOutput:
+		return newMetricsSink(parameters, output)
+	case config.OTLPOutput:
+		return newOTLPSink(parameters), nil
+	case config.KafkaOutput:
+		return newKafkaSink(parameters), nil
+	case config.MQTTOutput:
+		return newMQTTSink(parameters)
+	case config.NATSOutput:
+		return newNATSSink(parameters)
+	case config.ElasticsearchOutput:
+		return newElasticsearchSink(parameters)
+	case config.LokiOutput:
+		return newLokiSink(parameters)
+	case config.SplunkOutput:
+		return newSplunkSink(parameters)
+	case config.SIEMOutput:
+		return newSIEMSink(parameters)
+	case config.EVEOutput:
+		return newEVESink(parameters)
+	case config.ZeekOutput:
+		return newZeekSink(parameters)
+	case config.HistoryOutput:
+		return newHistorySink(parameters)
+	case config.DesktopOutput:
+		return newDesktopSink(parameters)
+	case config.ServerOutput:
+		return newServerSink(parameters)
+	case config.SQLiteOutput:
+		return newSQLiteSink(parameters)
+	case config.ClickHouseOutput:
+		return newClickHouseSink(parameters)
+	case config.AgentOutput:
+		return newAgentSink(parameters)
+	}
+
+	registryMutex.Lock()
+	factory, ok := registry[output]
+	registryMutex.Unlock()
+	if ok {
+		return factory(parameters)
+	}
+
+	return nil, fmt.Errorf("unknown output type : %s", output)
+}
+
+// Outputs handled by NewSink
+var builtinOutputs = []string{
+	config.ConsoleOutput,
+	config.StatsdOutput,
+	config.GraphiteOutput,
+	config.OTLPOutput,
+	config.KafkaOutput,
+	config.MQTTOutput,
+	config.NATSOutput,
+	config.ElasticsearchOutput,
+	config.LokiOutput,
+	config.SplunkOutput,
+	config.SIEMOutput,
+	config.EVEOutput,
+	config.ZeekOutput,
+	config.HistoryOutput,
+	config.DesktopOutput,
+	config.ServerOutput,
+	config.SQLiteOutput,
+	config.ClickHouseOutput,
+	config.AgentOutput,
+}
+
+// RegisteredOutputs returns the sorted names of the outputs available to be enabled, built-in or registered
+func RegisteredOutputs() []string {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	names := append(make([]string, 0, len(builtinOutputs)+len(registry)), builtinOutputs...)
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// SinkFactory returns a new sink configured from parameters
+type SinkFactory func(parameters *config.Parameters) (Sink, error)
+
+// Outputs registered in addition to the built-in ones, indexed by name
+var (
+	registryMutex sync.Mutex
+	registry      = make(map[string]SinkFactory)
+)
+
+// RegisterSink makes an output available under name, to be enabled in parameters. Built-in outputs take precedence.
+// It panics if the name is already registered, and is meant to be called at start up, e.g. from init functions.
+func RegisterSink(name string, factory SinkFactory) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if factory == nil {
+		panic("output: RegisterSink factory is nil")
+	}
+	if _, ok := registry[name]; ok {
+		panic("output: RegisterSink called twice for output " + name)
+	}
+
+	registry[name] = factory
+}
+
+// httpStatusError is returned when a remote HTTP endpoint answers with a non-success status code
+type httpStatusError struct {
+	url    string
+	code   int
+	status string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("%s answered with status %s", e.url, e.status)
+}
+
+// temporary tells whether the request may succeed if sent again, i.e. the endpoint is throttling or failing
+func (e *httpStatusError) temporary() bool {
+	return e.code == http.StatusTooManyRequests || e.code >= 500
+}
+
+// openOutputFile opens a file for appending records to, creating it if necessary, to be rotated as configured
+func openOutputFile(path string, rotation config.RotationConfig) (*logging.RotatingFile, error) {
+	return logging.OpenRotatingFile(path, rotation)
+}
+
+// newHTTPClient returns an HTTP client using the given TLS configuration and timeout
+func newHTTPClient(tlsConfig *config.TLSConfig, timeout time.Duration) (*http.Client, error) {
+	config, err := NewTLSConfig(tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: config,
+		},
+		Timeout: timeout,
+	}, nil
+}
+
+// httpPost sends body to url with the given content type and headers, and returns the response body.
+// An error is returned if the request failed or the remote end did not answer with a success status code.
+func httpPost(client *http.Client, url string, contentType string, headers map[string]string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Always read the body so the connection can be reused
+	respBody, err := ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &httpStatusError{
+			url:    url,
+			code:   resp.StatusCode,
+			status: resp.Status,
+		}
+	}
+
+	return respBody, err
+}
+
+// retry calls f until it succeeds or attempts are exhausted, doubling the wait between attempts starting at backoff.
+// HTTP errors that are not temporary are returned immediately.
+func retry(attempts int, backoff time.Duration, f func() error) error {
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		err = f()
+		if err == nil {
+			return nil
+		}
+
+		if statusErr, ok := err.(*httpStatusError); ok && !statusErr.temporary() {
+			return err
+		}
+
+		if attempt >= attempts {
+			break
+		}
+
+		log.WithFields(logrus.Fields{
+			"attempt": attempt,
+			"error":   err,
+		}).Warn("Output failed, retrying in ", backoff)
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	return fmt.Errorf("giving up after %d attempts : %s", attempts, err)
+}
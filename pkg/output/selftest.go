@@ -0,0 +1,51 @@
+package output
+
+import (
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"strings"
+	"time"
+)
+
+// Format of the body of self-test messages
+const selfTestFormat = "gonetmon self-test of the %s output, sent at %s. No action is needed."
+
+// SelfTest sends a test notice through each sink but the console, to tell those that cannot reach their destination
+// at start rather than when alerts are dropped. It returns an error naming the sinks that failed, nil if none did.
+func SelfTest(parameters *config.Parameters, sinks []Sink) error {
+	var failures []string
+	for i, sink := range sinks {
+		name := sinkName(parameters, i, sink)
+		if name == config.ConsoleOutput {
+			continue
+		}
+
+		now := time.Now()
+		body := fmt.Sprintf(selfTestFormat, name, parameters.FormatTime(now))
+		if parameters.Session != "" {
+			body = fmt.Sprintf("[%s] %s", parameters.Session, body)
+		}
+		err := sink.SendAlert(&alert.Message{
+			ID:        0,
+			Recovery:  false,
+			Body:      body,
+			Timestamp: now,
+			Evidence:  "",
+			Notice:    true,
+			Critical:  false,
+		})
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s : %s", name, err))
+			continue
+		}
+
+		log.Info("Output ", name, " passed its self-test.")
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("outputs failed their self-test : %s", strings.Join(failures, ", "))
+	}
+
+	return nil
+}
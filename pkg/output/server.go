@@ -0,0 +1,304 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/gorilla/websocket"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Period at which comments are sent on idle Server-Sent Events streams, so that proxies keep them open
+const sseKeepAlive = 15 * time.Second
+
+// serverEvent is an event queued for a streaming client
+type serverEvent struct {
+	kind    string // Either report, alert or rollup
+	payload []byte // JSON encoding of the event
+}
+
+// serverSink is a Sink serving reports, alerts and rollups to clients of the embedded HTTP server, as they are produced
+type serverSink struct {
+	server         *http.Server
+	upgrader       websocket.Upgrader
+	mutex          sync.Mutex
+	clients        map[chan serverEvent]struct{} // Event queues of the connected streaming clients
+	clientBufSize  uint
+	writeTimeout   time.Duration
+	allowedOrigins map[string]bool
+	staleAfter     time.Duration
+	pipeline       *Pipeline // State of capture and analysis reported by the health endpoints, nil until attached
+	lastReport     time.Time // Time the last report was received at, zero until the first one
+}
+
+// newServerSink starts the embedded server on the address configured in parameters and returns a Sink to its clients
+func newServerSink(parameters *config.Parameters) (*serverSink, error) {
+	config := parameters.Server
+
+	listener, err := net.Listen("tcp", config.Address)
+	if err != nil {
+		return nil, fmt.Errorf("could not listen on %s : %s", config.Address, err)
+	}
+
+	s := &serverSink{
+		clients:        make(map[chan serverEvent]struct{}),
+		clientBufSize:  config.ClientBufSize,
+		writeTimeout:   config.WriteTimeout,
+		allowedOrigins: make(map[string]bool, len(config.AllowedOrigins)),
+		staleAfter:     config.StaleAfter,
+		pipeline:       nil,
+		lastReport:     time.Time{},
+	}
+	for _, origin := range config.AllowedOrigins {
+		s.allowedOrigins[origin] = true
+	}
+	s.upgrader = websocket.Upgrader{
+		HandshakeTimeout: config.WriteTimeout,
+		ReadBufferSize:   1024,
+		WriteBufferSize:  1024,
+		CheckOrigin:      s.checkOrigin,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", s.serveWebSocket)
+	mux.HandleFunc("/events", s.serveEvents)
+	mux.HandleFunc("/healthz", s.serveHealth(false))
+	mux.HandleFunc("/readyz", s.serveHealth(true))
+	s.server = &http.Server{Handler: mux}
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Error("Embedded server failed : ", err)
+		}
+	}()
+
+	log.Info("Serving live events on ", listener.Addr())
+
+	return s, nil
+}
+
+// checkOrigin accepts same origin requests, and cross origin requests from allowed origins
+func (s *serverSink) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || s.allowedOrigins["*"] || s.allowedOrigins[origin] {
+		return true
+	}
+
+	return origin == "http://"+r.Host || origin == "https://"+r.Host
+}
+
+// subscribe registers a new client and returns the queue its events are sent to
+func (s *serverSink) subscribe() chan serverEvent {
+	events := make(chan serverEvent, s.clientBufSize)
+
+	s.mutex.Lock()
+	s.clients[events] = struct{}{}
+	s.mutex.Unlock()
+
+	return events
+}
+
+// unsubscribe removes the client and closes its queue, if that was not already done on Close
+func (s *serverSink) unsubscribe(events chan serverEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.clients[events]; ok {
+		delete(s.clients, events)
+		close(events)
+	}
+}
+
+// broadcast queues the event for all clients, dropping it for those too far behind
+func (s *serverSink) broadcast(event *EventJSON) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for events := range s.clients {
+		select {
+		case events <- serverEvent{kind: event.Type, payload: payload}:
+		default:
+			log.Warn("Streaming client queue is full, dropping event.")
+		}
+	}
+
+	return nil
+}
+
+// serveWebSocket streams events to a WebSocket client, one JSON text message per event
+func (s *serverSink) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader already replied with an error status
+		log.Warn("Could not upgrade connection to WebSocket : ", err)
+		return
+	}
+	defer conn.Close()
+
+	events := s.subscribe()
+	defer s.unsubscribe(events)
+
+	// Clients are not expected to send anything, but reading processes control frames and detects disconnections
+	disconnected := make(chan struct{})
+	go func() {
+		defer close(disconnected)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				closing := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+				_ = conn.WriteControl(websocket.CloseMessage, closing, time.Now().Add(s.writeTimeout))
+				return
+			}
+
+			_ = conn.SetWriteDeadline(time.Now().Add(s.writeTimeout))
+			if err := conn.WriteMessage(websocket.TextMessage, event.payload); err != nil {
+				return
+			}
+
+		case <-disconnected:
+			return
+		}
+	}
+}
+
+// serveEvents streams events as Server-Sent Events, named after their type.
+// The type query parameter restricts the stream to a comma separated list of event types, e.g. /events?type=report
+func (s *serverSink) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	var types map[string]bool
+	if query := r.URL.Query().Get("type"); query != "" {
+		types = make(map[string]bool)
+		for _, kind := range strings.Split(query, ",") {
+			types[strings.TrimSpace(kind)] = true
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	events := s.subscribe()
+	defer s.unsubscribe(events)
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if types != nil && !types[event.kind] {
+				continue
+			}
+
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.kind, event.payload); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// serveHealth returns a handler answering the health of the monitor, with a 503 status code if it is unavailable.
+// The liveness handler only checks capture sources are open, while the readiness one also checks the last report is
+// not stale.
+func (s *serverSink) serveHealth(ready bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.Lock()
+		health := newHealth(s.pipeline, s.lastReport, s.staleAfter, ready)
+		s.mutex.Unlock()
+
+		code := http.StatusOK
+		if health.Status != healthOK {
+			code = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(code)
+		if err := json.NewEncoder(w).Encode(health); err != nil {
+			log.Warn("Could not write health response : ", err)
+		}
+	}
+}
+
+// SetPipeline makes the state of capture and analysis available to the health endpoints
+func (s *serverSink) SetPipeline(p *Pipeline) {
+	s.mutex.Lock()
+	s.pipeline = p
+	s.mutex.Unlock()
+}
+
+// SendReport streams the report to clients
+func (s *serverSink) SendReport(r *analysis.Report) error {
+	s.mutex.Lock()
+	s.lastReport = time.Now()
+	s.mutex.Unlock()
+
+	return s.broadcast(NewReportEvent(r))
+}
+
+// SendAlert streams the alert to clients
+func (s *serverSink) SendAlert(a *alert.Message) error {
+	return s.broadcast(NewAlertEvent(a))
+}
+
+// SendRollup streams the rollup to clients
+func (s *serverSink) SendRollup(r *analysis.Rollup) error {
+	return s.broadcast(NewRollupEvent(r))
+}
+
+// Close stops the server and ends all streams
+func (s *serverSink) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.writeTimeout)
+	defer cancel()
+	err := s.server.Shutdown(ctx)
+
+	// Streaming connections are not tracked by Shutdown, so end them explicitly
+	s.mutex.Lock()
+	for events := range s.clients {
+		delete(s.clients, events)
+		close(events)
+	}
+	s.mutex.Unlock()
+
+	return err
+}
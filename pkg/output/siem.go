@@ -0,0 +1,181 @@
+package output
+
+import (
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"log/syslog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	siemVendor        = "gonetmon"
+	siemProduct       = "gonetmon"
+	siemDeviceVersion = "alpha-1"
+
+	// Signature IDs of security events
+	sigHighTraffic      = 100
+	sigTrafficRecovered = 101
+
+	// Severity above which events are logged as warnings, and that of critical alerts, on CEF's 0-10 scale
+	siemWarningSeverity  = 7
+	siemCriticalSeverity = 10
+)
+
+// securityEvent is a format-agnostic security relevant event, to be formatted for a SIEM
+type securityEvent struct {
+	signatureID int
+	name        string
+	severity    int // From 0 (lowest) to 10 (highest), as defined by CEF
+	timestamp   time.Time
+	fields      map[string]string // Additional key/value information, using CEF extension names
+}
+
+// alertToSecurityEvent converts an alert or recovery message to a security event
+func alertToSecurityEvent(a *alert.Message) *securityEvent {
+	event := &securityEvent{
+		signatureID: sigHighTraffic,
+		name:        "High traffic",
+		severity:    siemWarningSeverity,
+		timestamp:   a.Timestamp,
+		fields:      map[string]string{"msg": a.Body},
+	}
+
+	if a.Recovery {
+		event.signatureID = sigTrafficRecovered
+		event.name = "Traffic recovered"
+		event.severity = 3
+	} else if a.Critical {
+		event.severity = siemCriticalSeverity
+	}
+
+	return event
+}
+
+// sortedKeys returns the keys of fields in a deterministic order
+func sortedKeys(fields map[string]string) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// cefHeaderEscaper escapes characters with a special meaning in CEF headers
+var cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`)
+
+// cefValueEscaper escapes characters with a special meaning in CEF extension values
+var cefValueEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+
+// formatCEF returns the ArcSight Common Event Format representation of the event
+func formatCEF(e *securityEvent) string {
+	header := []string{
+		"CEF:0",
+		cefHeaderEscaper.Replace(siemVendor),
+		cefHeaderEscaper.Replace(siemProduct),
+		cefHeaderEscaper.Replace(siemDeviceVersion),
+		strconv.Itoa(e.signatureID),
+		cefHeaderEscaper.Replace(e.name),
+		strconv.Itoa(e.severity),
+	}
+
+	extensions := []string{"rt=" + strconv.FormatInt(e.timestamp.UnixNano()/int64(time.Millisecond), 10)}
+	for _, key := range sortedKeys(e.fields) {
+		extensions = append(extensions, key+"="+cefValueEscaper.Replace(e.fields[key]))
+	}
+
+	return strings.Join(header, "|") + "|" + strings.Join(extensions, " ")
+}
+
+// leefValueEscaper removes the attribute delimiter and line breaks from LEEF attribute values
+var leefValueEscaper = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+
+// formatLEEF returns the IBM QRadar Log Event Extended Format (1.0) representation of the event
+func formatLEEF(e *securityEvent) string {
+	header := []string{
+		"LEEF:1.0",
+		siemVendor,
+		siemProduct,
+		siemDeviceVersion,
+		strconv.Itoa(e.signatureID),
+	}
+
+	attributes := []string{
+		"devTime=" + strconv.FormatInt(e.timestamp.UnixNano()/int64(time.Millisecond), 10),
+		"devTimeFormat=milliseconds",
+		"cat=" + leefValueEscaper.Replace(e.name),
+		"sev=" + strconv.Itoa(e.severity),
+	}
+	for _, key := range sortedKeys(e.fields) {
+		attributes = append(attributes, key+"="+leefValueEscaper.Replace(e.fields[key]))
+	}
+
+	return strings.Join(header, "|") + "|" + strings.Join(attributes, "\t")
+}
+
+// siemSink is a Sink sending security events in CEF or LEEF format over syslog
+type siemSink struct {
+	format func(*securityEvent) string
+	writer *syslog.Writer
+}
+
+// newSIEMSink connects to the syslog server configured in parameters and returns a Sink to it
+func newSIEMSink(parameters *config.Parameters) (*siemSink, error) {
+	siem := &parameters.SIEM
+
+	var format func(*securityEvent) string
+	switch siem.Format {
+	case config.CEFFormat:
+		format = formatCEF
+	case config.LEEFFormat:
+		format = formatLEEF
+	default:
+		return nil, fmt.Errorf("unknown SIEM format : %s", siem.Format)
+	}
+
+	writer, err := syslog.Dial(siem.Network, siem.Address, syslog.LOG_NOTICE|syslog.LOG_DAEMON, siem.Tag)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to syslog server : %s", err)
+	}
+
+	log.Info("Sending ", siem.Format, " events to syslog ", siem.Network, " ", siem.Address)
+
+	return &siemSink{
+		format: format,
+		writer: writer,
+	}, nil
+}
+
+// send writes the formatted event to syslog, with a priority matching its severity
+func (s *siemSink) send(e *securityEvent) error {
+	message := s.format(e)
+
+	if e.severity >= siemCriticalSeverity {
+		return s.writer.Crit(message)
+	}
+	if e.severity >= siemWarningSeverity {
+		return s.writer.Warning(message)
+	}
+
+	return s.writer.Notice(message)
+}
+
+// SendReport does nothing, as reports do not hold security events
+func (s *siemSink) SendReport(r *analysis.Report) error {
+	return nil
+}
+
+// SendAlert sends the alert as a security event
+func (s *siemSink) SendAlert(a *alert.Message) error {
+	return s.send(alertToSecurityEvent(a))
+}
+
+// Close closes the connection to the syslog server
+func (s *siemSink) Close() error {
+	return s.writer.Close()
+}
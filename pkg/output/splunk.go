@@ -0,0 +1,155 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"net/http"
+	"os"
+	"time"
+)
+
+// splunkEvent is the envelope of an event sent to the HTTP Event Collector
+type splunkEvent struct {
+	Time       float64         `json:"time"` // Seconds since epoch, with sub-second precision
+	Host       string          `json:"host,omitempty"`
+	Source     string          `json:"source,omitempty"`
+	SourceType string          `json:"sourcetype,omitempty"`
+	Index      string          `json:"index,omitempty"`
+	Event      json.RawMessage `json:"event"`
+}
+
+// splunkSink is a Sink sending reports, flow records and alerts to a Splunk HTTP Event Collector, in batches
+type splunkSink struct {
+	url       string
+	headers   map[string]string
+	host      string
+	source    string
+	index     string
+	batchSize int
+	retries   int
+	backoff   time.Duration
+	client    *http.Client
+}
+
+// newSplunkSink returns a Sink sending to the collector configured in parameters
+func newSplunkSink(parameters *config.Parameters) (*splunkSink, error) {
+	config := &parameters.Splunk
+
+	if config.Token == "" {
+		return nil, errors.New("a token is required for the splunk output")
+	}
+
+	if config.BatchSize <= 0 {
+		return nil, fmt.Errorf("invalid Splunk batch size %d", config.BatchSize)
+	}
+
+	client, err := newHTTPClient(&config.TLS, config.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("could not set up TLS for Splunk : %s", err)
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		log.Error("Could not get hostname, Splunk events will use the collector's default : ", err)
+	}
+
+	log.Info("Sending to Splunk HTTP Event Collector ", config.URL)
+
+	return &splunkSink{
+		url:       config.URL,
+		headers:   map[string]string{"Authorization": "Splunk " + config.Token},
+		host:      host,
+		source:    config.Source,
+		index:     config.Index,
+		batchSize: config.BatchSize,
+		retries:   config.Retries,
+		backoff:   config.Backoff,
+		client:    client,
+	}, nil
+}
+
+// newEvent wraps the JSON encoding of v in an event of the given kind
+func (s *splunkSink) newEvent(kind string, v interface{}, t time.Time) (*splunkEvent, error) {
+	event, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return &splunkEvent{
+		Time:       float64(t.UnixNano()) / float64(time.Second),
+		Host:       s.host,
+		Source:     s.source,
+		SourceType: s.source + ":" + kind,
+		Index:      s.index,
+		Event:      event,
+	}, nil
+}
+
+// send posts events to the collector, in as many requests of at most batchSize events as needed
+func (s *splunkSink) send(events []*splunkEvent) error {
+	for start := 0; start < len(events); start += s.batchSize {
+		end := start + s.batchSize
+		if end > len(events) {
+			end = len(events)
+		}
+
+		// The collector accepts concatenated JSON objects in a single request
+		var body bytes.Buffer
+		encoder := json.NewEncoder(&body)
+		for _, event := range events[start:end] {
+			if err := encoder.Encode(event); err != nil {
+				return err
+			}
+		}
+
+		if err := retry(s.retries, s.backoff, func() error {
+			_, err := httpPost(s.client, s.url, "application/json", s.headers, body.Bytes())
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SendReport sends the report and its flow records
+func (s *splunkSink) SendReport(r *analysis.Report) error {
+	events := make([]*splunkEvent, 0, len(r.Flows)+1)
+
+	event, err := s.newEvent("report", NewReportJSON(r), r.Timestamp)
+	if err != nil {
+		return err
+	}
+	events = append(events, event)
+
+	for _, flow := range r.Flows {
+		event, err := s.newEvent("flow", NewFlowJSON(flow), flow.LastSeen)
+		if err != nil {
+			return err
+		}
+		events = append(events, event)
+	}
+
+	return s.send(events)
+}
+
+// SendAlert sends the alert
+func (s *splunkSink) SendAlert(a *alert.Message) error {
+	event, err := s.newEvent("alert", NewAlertJSON(a), a.Timestamp)
+	if err != nil {
+		return err
+	}
+
+	return s.send([]*splunkEvent{event})
+}
+
+// Close has nothing to release, as the HTTP client does not hold persistent resources
+func (s *splunkSink) Close() error {
+	return nil
+}
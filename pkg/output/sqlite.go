@@ -0,0 +1,316 @@
+package output
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/config"
+	_ "github.com/mattn/go-sqlite3" // Registers the sqlite3 driver
+	"github.com/sirupsen/logrus"
+	"os"
+	"sync"
+	"time"
+)
+
+// Schema of the database. Timestamps are stored in nanoseconds since epoch, and reports also keep their JSON representation.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS reports (
+	id        INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp INTEGER NOT NULL,
+	hits      INTEGER NOT NULL,
+	bytes     INTEGER NOT NULL,
+	top_host  TEXT,
+	data      TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS reports_timestamp ON reports (timestamp);
+
+CREATE TABLE IF NOT EXISTS alerts (
+	id        INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp INTEGER NOT NULL,
+	recovery  INTEGER NOT NULL,
+	message   TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS alerts_timestamp ON alerts (timestamp);
+
+CREATE TABLE IF NOT EXISTS flows (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	report_id  INTEGER NOT NULL REFERENCES reports (id) ON DELETE CASCADE,
+	interface  TEXT NOT NULL,
+	protocol   TEXT NOT NULL,
+	src_ip     TEXT NOT NULL,
+	src_port   INTEGER NOT NULL,
+	dst_ip     TEXT NOT NULL,
+	dst_port   INTEGER NOT NULL,
+	src_pkts   INTEGER NOT NULL,
+	dst_pkts   INTEGER NOT NULL,
+	src_bytes  INTEGER NOT NULL,
+	dst_bytes  INTEGER NOT NULL,
+	first_seen INTEGER NOT NULL,
+	last_seen  INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS flows_last_seen ON flows (last_seen);
+`
+
+// sqliteSink is a Sink recording reports, alerts and optionally flow records in an SQLite database, to keep them across restarts
+type sqliteSink struct {
+	db     *sql.DB
+	config config.SQLiteConfig
+	stop   chan struct{}  // Closed to stop pruning
+	pruner sync.WaitGroup // Waits for the pruning goroutine to return
+}
+
+// openDatabase opens the SQLite database at path, creating it and its schema if needed
+func openDatabase(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", path+"?_foreign_keys=on")
+	if err != nil {
+		return nil, fmt.Errorf("could not open database : %s", err)
+	}
+
+	// SQLite does not support concurrent writers
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("could not create database schema : %s", err)
+	}
+
+	return db, nil
+}
+
+// openExistingDatabase opens the SQLite database at path for reading, failing if it does not exist
+func openExistingDatabase(path string) (*sql.DB, error) {
+	// Do not create an empty database on a wrong path
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("could not open database : %s", err)
+	}
+
+	return openDatabase(path)
+}
+
+// newSQLiteSink opens the database configured in parameters and returns a Sink to it
+func newSQLiteSink(parameters *config.Parameters) (*sqliteSink, error) {
+	if parameters.SQLite.PruneInterval <= 0 {
+		return nil, errors.New("the database prune interval must be positive")
+	}
+
+	db, err := openDatabase(parameters.SQLite.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("Recording to database ", parameters.SQLite.Path)
+
+	s := &sqliteSink{
+		db:     db,
+		config: parameters.SQLite,
+		stop:   make(chan struct{}),
+		pruner: sync.WaitGroup{},
+	}
+
+	s.pruner.Add(1)
+	go s.prune()
+
+	return s, nil
+}
+
+// deleteBefore deletes the rows of table whose column is older than retention, if retention is set, and returns their number
+func (s *sqliteSink) deleteBefore(table, column string, retention time.Duration, now time.Time) (int64, error) {
+	if retention <= 0 {
+		return 0, nil
+	}
+
+	result, err := s.db.Exec("DELETE FROM "+table+" WHERE "+column+" < ?", now.Add(-retention).UnixNano())
+	if err != nil {
+		return 0, fmt.Errorf("could not prune %s : %s", table, err)
+	}
+
+	return result.RowsAffected()
+}
+
+// pruneExpired deletes data older than the configured retentions
+func (s *sqliteSink) pruneExpired(now time.Time) {
+	pruned := logrus.Fields{}
+
+	for _, target := range []struct {
+		table, column string
+		retention     time.Duration
+	}{
+		{"flows", "last_seen", s.config.FlowRetention},
+		{"reports", "timestamp", s.config.ReportRetention},
+		{"alerts", "timestamp", s.config.AlertRetention},
+	} {
+		nb, err := s.deleteBefore(target.table, target.column, target.retention, now)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		pruned[target.table] = nb
+	}
+
+	log.WithFields(pruned).Info("Pruned expired data from database.")
+}
+
+// prune regularly deletes expired data until the sink is closed, starting right away
+func (s *sqliteSink) prune() {
+	defer s.pruner.Done()
+
+	s.pruneExpired(time.Now())
+
+	ticker := time.NewTicker(s.config.PruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.pruneExpired(now)
+		}
+	}
+}
+
+// SendReport records the report, along with its flows if configured so, in a single transaction
+func (s *sqliteSink) SendReport(r *analysis.Report) error {
+	report := NewReportJSON(r)
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	var topHost interface{}
+	if report.TopHost != nil {
+		topHost = report.TopHost.Host
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("INSERT INTO reports (timestamp, hits, bytes, top_host, data) VALUES (?, ?, ?, ?, ?)",
+		r.Timestamp.UnixNano(), r.Hits, int64(r.Bytes), topHost, string(data))
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if s.config.Flows && len(r.Flows) > 0 {
+		reportID, err := result.LastInsertId()
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+
+		if err := insertFlows(tx, reportID, r.Flows); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// insertFlows records the flows of the report identified by reportID
+func insertFlows(tx *sql.Tx, reportID int64, flows []*analysis.FlowRecord) error {
+	stmt, err := tx.Prepare(`INSERT INTO flows (report_id, interface, protocol, src_ip, src_port, dst_ip, dst_port,
+		src_pkts, dst_pkts, src_bytes, dst_bytes, first_seen, last_seen) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, f := range flows {
+		if _, err := stmt.Exec(reportID, f.Device, f.Protocol, f.SrcIP, f.SrcPort, f.DstIP, f.DstPort,
+			f.SrcPkts, f.DstPkts, int64(f.SrcBytes), int64(f.DstBytes), f.FirstSeen.UnixNano(), f.LastSeen.UnixNano()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SendAlert records the alert
+func (s *sqliteSink) SendAlert(a *alert.Message) error {
+	_, err := s.db.Exec("INSERT INTO alerts (timestamp, recovery, message) VALUES (?, ?, ?)",
+		a.Timestamp.UnixNano(), a.Recovery, a.Body)
+	return err
+}
+
+// Close stops pruning and closes the database
+func (s *sqliteSink) Close() error {
+	close(s.stop)
+	s.pruner.Wait()
+
+	return s.db.Close()
+}
+
+// readReports returns the reports recorded in the database between from and to, in chronological order
+func readReports(db *sql.DB, from, to time.Time) ([]ReportJSON, error) {
+	rows, err := db.Query("SELECT data FROM reports WHERE timestamp >= ? AND timestamp <= ? ORDER BY timestamp", from.UnixNano(), to.UnixNano())
+	if err != nil {
+		return nil, fmt.Errorf("could not read reports : %s", err)
+	}
+	defer rows.Close()
+
+	var reports []ReportJSON
+	for rows.Next() {
+		var data string
+		var report ReportJSON
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("could not read reports : %s", err)
+		}
+		if err := json.Unmarshal([]byte(data), &report); err != nil {
+			log.Warn("Skipping malformed report in database : ", err)
+			continue
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, rows.Err()
+}
+
+// QueryDatabase returns the reports recorded in the database at path between from and to, in chronological order
+func QueryDatabase(path string, from, to time.Time) ([]ReportJSON, error) {
+	db, err := openExistingDatabase(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return readReports(db, from, to)
+}
+
+// ReadDatabase reads the reports and alerts recorded in the database at path since the given time
+func ReadDatabase(path string, since time.Time) (*History, error) {
+	db, err := openExistingDatabase(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	reports, err := readReports(db, since, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	history := &History{reports: reports}
+
+	rows, err := db.Query("SELECT timestamp, recovery, message FROM alerts WHERE timestamp >= ? ORDER BY timestamp", since.UnixNano())
+	if err != nil {
+		return nil, fmt.Errorf("could not read alerts : %s", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var timestamp int64
+		var alert AlertJSON
+		if err := rows.Scan(&timestamp, &alert.Recovery, &alert.Message); err != nil {
+			return nil, fmt.Errorf("could not read alerts : %s", err)
+		}
+		alert.Timestamp = time.Unix(0, timestamp)
+		history.alerts = append(history.alerts, alert)
+	}
+
+	return history, rows.Err()
+}
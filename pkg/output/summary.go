@@ -0,0 +1,262 @@
+package output
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// Summary formats
+	HTMLFormat     = "html"
+	MarkdownFormat = "markdown"
+
+	// Size of the SVG charts in HTML summaries
+	chartWidth  = 800
+	chartHeight = 160
+
+	// Number of hosts listed in summaries
+	summaryTopHosts = 10
+)
+
+// Characters of increasing height used to draw sparklines
+var sparkTicks = []rune("▁▂▃▄▅▆▇█")
+
+// hostSummary aggregates the reports in which a host was the top host
+type hostSummary struct {
+	Host    string
+	Hits    int // Sum of the host's hits over the reports it topped
+	Reports int // Number of reports the host topped
+}
+
+// summary holds the aggregated statistics of a period of history, as rendered in summary documents
+type summary struct {
+	Since     time.Time
+	Until     time.Time
+	Generated time.Time
+	Reports   int
+	Hits      int
+	Bytes     uint64
+	PeakHits  int       // Highest number of hits in a single report
+	PeakTime  time.Time // Time of the report with the highest number of hits
+	TopHosts  []hostSummary
+	Alerts    []AlertJSON
+	HitsChart string // Points of the SVG polyline of hits over time
+	BytesLine string // Points of the SVG polyline of bytes over time
+	HitsSpark string // Sparkline of hits over time
+}
+
+// sparkline returns a line of unicode blocks whose heights are proportional to values
+func sparkline(values []float64) string {
+	var max float64
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+
+	line := make([]rune, len(values))
+	for i, v := range values {
+		tick := 0
+		if max > 0 {
+			tick = int(v / max * float64(len(sparkTicks)-1))
+		}
+		line[i] = sparkTicks[tick]
+	}
+
+	return string(line)
+}
+
+// chartPoints returns the points of an SVG polyline plotting values over the chart's width
+func chartPoints(values []float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	var max float64
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	if max == 0 {
+		max = 1
+	}
+
+	step := float64(chartWidth)
+	if len(values) > 1 {
+		step = float64(chartWidth) / float64(len(values)-1)
+	}
+
+	points := make([]string, len(values))
+	for i, v := range values {
+		x := float64(i) * step
+		y := float64(chartHeight) - v/max*float64(chartHeight)
+		points[i] = strconv.FormatFloat(x, 'f', 1, 64) + "," + strconv.FormatFloat(y, 'f', 1, 64)
+	}
+
+	return strings.Join(points, " ")
+}
+
+// summarise aggregates history into a summary of the period starting at since
+func summarise(h *History, since time.Time) *summary {
+	s := &summary{
+		Since:     since,
+		Until:     since,
+		Generated: time.Now(),
+		Reports:   len(h.reports),
+		Alerts:    h.alerts,
+	}
+
+	hosts := make(map[string]*hostSummary)
+	hits := make([]float64, len(h.reports))
+	bytes := make([]float64, len(h.reports))
+
+	for i, r := range h.reports {
+		s.Hits += r.Hits
+		s.Bytes += r.Bytes
+		hits[i] = float64(r.Hits)
+		bytes[i] = float64(r.Bytes)
+
+		if r.Hits > s.PeakHits {
+			s.PeakHits = r.Hits
+			s.PeakTime = r.Timestamp
+		}
+		if r.Timestamp.After(s.Until) {
+			s.Until = r.Timestamp
+		}
+
+		if r.TopHost != nil {
+			host, ok := hosts[r.TopHost.Host]
+			if !ok {
+				host = &hostSummary{Host: r.TopHost.Host}
+				hosts[r.TopHost.Host] = host
+			}
+			host.Hits += r.TopHost.Hits
+			host.Reports++
+		}
+	}
+
+	for _, host := range hosts {
+		s.TopHosts = append(s.TopHosts, *host)
+	}
+	sort.Slice(s.TopHosts, func(i, j int) bool { return s.TopHosts[i].Hits > s.TopHosts[j].Hits })
+	if len(s.TopHosts) > summaryTopHosts {
+		s.TopHosts = s.TopHosts[:summaryTopHosts]
+	}
+
+	s.HitsChart = chartPoints(hits)
+	s.BytesLine = chartPoints(bytes)
+	s.HitsSpark = sparkline(hits)
+
+	return s
+}
+
+// summaryFuncs returns the helper functions available to summary templates, printing timestamps in the given zone and layout
+func summaryFuncs(zone *time.Location, layout string) map[string]interface{} {
+	return map[string]interface{}{
+		"bytes": HumanBytes,
+		"time": func(t time.Time) string {
+			return t.In(zone).Format(layout)
+		},
+	}
+}
+
+const htmlSummaryTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>gonetmon summary</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; text-align: left; }
+svg { border: 1px solid #ccc; margin-bottom: 2em; }
+.alert { color: #b00; }
+.recovery { color: #080; }
+</style>
+</head>
+<body>
+<h1>gonetmon summary</h1>
+<p>From {{time .Since}} to {{time .Until}} - generated {{time .Generated}}</p>
+<table>
+<tr><th>Reports</th><td>{{.Reports}}</td></tr>
+<tr><th>Hits</th><td>{{.Hits}}</td></tr>
+<tr><th>Traffic</th><td>{{bytes .Bytes}}</td></tr>
+<tr><th>Peak</th><td>{{.PeakHits}} hits at {{time .PeakTime}}</td></tr>
+<tr><th>Alerts</th><td>{{len .Alerts}}</td></tr>
+</table>
+<h2>Hits</h2>
+<svg width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}"><polyline fill="none" stroke="#1f77b4" stroke-width="2" points="{{.HitsChart}}"/></svg>
+<h2>Traffic</h2>
+<svg width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}"><polyline fill="none" stroke="#ff7f0e" stroke-width="2" points="{{.BytesLine}}"/></svg>
+<h2>Top hosts</h2>
+<table>
+<tr><th>Host</th><th>Hits</th><th>Reports topped</th></tr>
+{{range .TopHosts}}<tr><td>{{.Host}}</td><td>{{.Hits}}</td><td>{{.Reports}}</td></tr>
+{{end}}</table>
+<h2>Alerts</h2>
+<table>
+<tr><th>Time</th><th>Message</th></tr>
+{{range .Alerts}}<tr class="{{if .Recovery}}recovery{{else}}alert{{end}}"><td>{{time .Timestamp}}</td><td>{{.Message}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`
+
+const markdownSummaryTemplate = `# gonetmon summary
+
+From {{time .Since}} to {{time .Until}} - generated {{time .Generated}}
+
+| Reports | Hits | Traffic | Peak | Alerts |
+|---|---|---|---|---|
+| {{.Reports}} | {{.Hits}} | {{bytes .Bytes}} | {{.PeakHits}} hits at {{time .PeakTime}} | {{len .Alerts}} |
+
+## Hits
+
+` + "```" + `
+{{.HitsSpark}}
+` + "```" + `
+
+## Top hosts
+
+| Host | Hits | Reports topped |
+|---|---|---|
+{{range .TopHosts}}| {{.Host}} | {{.Hits}} | {{.Reports}} |
+{{end}}
+## Alerts
+
+| Time | Type | Message |
+|---|---|---|
+{{range .Alerts}}| {{time .Timestamp}} | {{if .Recovery}}recovery{{else}}alert{{end}} | {{.Message}} |
+{{end}}`
+
+// summaryDocument adds the chart dimensions to a summary, for templates
+type summaryDocument struct {
+	*summary
+	Width  int
+	Height int
+}
+
+// RenderSummary writes the summary of the history since the given time to w, in the given format,
+// with timestamps in the given zone and layout
+func RenderSummary(w io.Writer, h *History, since time.Time, format string, zone *time.Location, layout string) error {
+	document := summaryDocument{summary: summarise(h, since), Width: chartWidth, Height: chartHeight}
+	funcs := summaryFuncs(zone, layout)
+
+	switch format {
+	case HTMLFormat:
+		t := htmltemplate.Must(htmltemplate.New(HTMLFormat).Funcs(funcs).Parse(htmlSummaryTemplate))
+		return t.Execute(w, document)
+	case MarkdownFormat:
+		t := template.Must(template.New(MarkdownFormat).Funcs(funcs).Parse(markdownSummaryTemplate))
+		return t.Execute(w, document)
+	}
+
+	return fmt.Errorf("unknown summary format : %s", format)
+}
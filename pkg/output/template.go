@@ -0,0 +1,81 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateContext is the data a report template is executed with. It embeds the report's fields
+// (Timestamp, Hits, Bytes, TopHost, Sections and Flows, the number of flows), and adds the flow records themselves,
+// the alerts raised so far and the monitoring parameters.
+type templateContext struct {
+	ReportJSON
+	FlowRecords    []FlowJSON    // Connections seen during the window
+	Alerts         []string      // Alerts raised since startup
+	Refresh        time.Duration // Report period
+	AlertSpan      time.Duration // Time frame over which hits are counted for alerts
+	AlertThreshold uint          // Number of hits over AlertSpan that triggers an alert
+}
+
+// HumanBytes returns a human readable representation of a number of bytes
+func HumanBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// templateFuncs are the helper functions available to report templates
+var templateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"bytes": HumanBytes,
+	"time": func(t time.Time, layout string) string {
+		return t.Format(layout)
+	},
+}
+
+// loadReportTemplate parses the report template file at path
+func loadReportTemplate(path string) (*template.Template, error) {
+	t, err := template.New(filepath.Base(path)).Funcs(templateFuncs).ParseFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not load report template : %s", err)
+	}
+
+	return t, nil
+}
+
+// executeReportTemplate renders the report, along with alerts raised so far, with the template
+func executeReportTemplate(t *template.Template, r *analysis.Report, alerts []string, p *config.Parameters) (string, error) {
+	context := templateContext{
+		ReportJSON:     NewReportJSON(r),
+		FlowRecords:    make([]FlowJSON, len(r.Flows)),
+		Alerts:         alerts,
+		Refresh:        p.DisplayRefresh,
+		AlertSpan:      p.AlertSpan,
+		AlertThreshold: p.AlertThreshold,
+	}
+	for i, flow := range r.Flows {
+		context.FlowRecords[i] = NewFlowJSON(flow)
+	}
+
+	var output bytes.Buffer
+	if err := t.Execute(&output, context); err != nil {
+		return "", fmt.Errorf("could not execute report template : %s", err)
+	}
+
+	return output.String(), nil
+}
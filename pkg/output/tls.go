@@ -0,0 +1,92 @@
+package output
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"io/ioutil"
+)
+
+// NewTLSConfig builds a tls.Config from the files and options in config, or returns nil if TLS is not enabled
+func NewTLSConfig(config *config.TLSConfig) (*tls.Config, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+
+	// Custom certificate authorities
+	if config.CAFile != "" {
+		pem, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA file : %s", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificate found in CA file %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	// Client certificate
+	if config.CertFile != "" || config.KeyFile != "" {
+		if config.CertFile == "" || config.KeyFile == "" {
+			return nil, errors.New("both a certificate and a key file are needed for client authentication")
+		}
+
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate : %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// NewServerTLSConfig builds a tls.Config serving the certificate in config, and requiring clients to present a
+// certificate signed by its client certificate authorities if set. It returns nil if no certificate is set.
+func NewServerTLSConfig(config *config.ServerTLSConfig) (*tls.Config, error) {
+	if config.CertFile == "" && config.KeyFile == "" {
+		if config.ClientCAFile != "" {
+			return nil, errors.New("authenticating clients by certificate requires serving TLS")
+		}
+		return nil, nil
+	}
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, errors.New("both a certificate and a key file are needed to serve TLS")
+	}
+
+	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load server certificate : %s", err)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	// Mutual authentication
+	if config.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read client CA file : %s", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificate found in client CA file %s", config.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,240 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/logging"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Values of unset fields and timestamp layout of Zeek TSV logs
+	zeekUnset      = "-"
+	zeekTimeLayout = "2006-01-02-15-04-05"
+
+	// Alphabet used to build connection uids
+	zeekUIDAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+// Field names and types of conn.log, in order
+var (
+	zeekConnFields = []string{"ts", "uid", "id.orig_h", "id.orig_p", "id.resp_h", "id.resp_p", "proto", "service",
+		"duration", "orig_bytes", "resp_bytes", "conn_state", "local_orig", "local_resp", "missed_bytes", "history",
+		"orig_pkts", "orig_ip_bytes", "resp_pkts", "resp_ip_bytes", "tunnel_parents"}
+	zeekConnTypes = []string{"time", "string", "addr", "port", "addr", "port", "enum", "string",
+		"interval", "count", "count", "string", "bool", "bool", "count", "string",
+		"count", "count", "count", "count", "set[string]"}
+)
+
+// zeekConn is the JSON representation of a conn.log entry. Fields Zeek would leave unset are omitted.
+type zeekConn struct {
+	TS          float64 `json:"ts"`
+	UID         string  `json:"uid"`
+	OrigH       string  `json:"id.orig_h"`
+	OrigP       uint16  `json:"id.orig_p"`
+	RespH       string  `json:"id.resp_h"`
+	RespP       uint16  `json:"id.resp_p"`
+	Proto       string  `json:"proto"`
+	Duration    float64 `json:"duration"`
+	OrigBytes   uint64  `json:"orig_bytes"`
+	RespBytes   uint64  `json:"resp_bytes"`
+	ConnState   string  `json:"conn_state"`
+	MissedBytes uint64  `json:"missed_bytes"`
+	OrigPkts    uint    `json:"orig_pkts"`
+	OrigIPBytes uint64  `json:"orig_ip_bytes"`
+	RespPkts    uint    `json:"resp_pkts"`
+	RespIPBytes uint64  `json:"resp_ip_bytes"`
+}
+
+// zeekUID returns a Zeek-like connection uid derived from the flow's identifier
+func zeekUID(f *analysis.FlowRecord) string {
+	id := uint64(flowID(f))
+
+	uid := []byte{'C'}
+	for id > 0 {
+		uid = append(uid, zeekUIDAlphabet[id%uint64(len(zeekUIDAlphabet))])
+		id /= uint64(len(zeekUIDAlphabet))
+	}
+
+	return string(uid)
+}
+
+// zeekConnState returns the Zeek connection state summarising what was seen of the flow
+func zeekConnState(f *analysis.FlowRecord) string {
+	if f.Protocol != "tcp" {
+		switch {
+		case f.DstPkts == 0:
+			return "S0"
+		case f.SrcPkts == 0:
+			return "SHR"
+		default:
+			return "SF"
+		}
+	}
+
+	switch {
+	// The connection was picked up mid-stream
+	case !f.SrcFlags.Has(analysis.FlagSYN):
+		return "OTH"
+	case f.DstPkts == 0:
+		return "S0"
+	case f.DstFlags.Has(analysis.FlagRST) && !f.DstFlags.Has(analysis.FlagSYN):
+		return "REJ"
+	case f.SrcFlags.Has(analysis.FlagRST):
+		return "RSTO"
+	case f.DstFlags.Has(analysis.FlagRST):
+		return "RSTR"
+	case f.SrcFlags.Has(analysis.FlagFIN) && f.DstFlags.Has(analysis.FlagFIN):
+		return "SF"
+	case f.SrcFlags.Has(analysis.FlagFIN):
+		return "S2"
+	case f.DstFlags.Has(analysis.FlagFIN):
+		return "S3"
+	default:
+		return "S1"
+	}
+}
+
+// zeekTime returns the Zeek representation of a timestamp, in seconds since epoch
+func zeekTime(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// flowToZeek converts a flow record to a conn.log entry.
+// IP bytes are approximated by the captured frame lengths, which include the link layer header.
+func flowToZeek(f *analysis.FlowRecord) *zeekConn {
+	return &zeekConn{
+		TS:          zeekTime(f.FirstSeen),
+		UID:         zeekUID(f),
+		OrigH:       f.SrcIP,
+		OrigP:       f.SrcPort,
+		RespH:       f.DstIP,
+		RespP:       f.DstPort,
+		Proto:       f.Protocol,
+		Duration:    f.Duration().Seconds(),
+		OrigBytes:   f.SrcData,
+		RespBytes:   f.DstData,
+		ConnState:   zeekConnState(f),
+		MissedBytes: 0,
+		OrigPkts:    f.SrcPkts,
+		OrigIPBytes: f.SrcBytes,
+		RespPkts:    f.DstPkts,
+		RespIPBytes: f.DstBytes,
+	}
+}
+
+// tsv returns the tab separated conn.log line of the entry
+func (c *zeekConn) tsv() string {
+	return strings.Join([]string{
+		strconv.FormatFloat(c.TS, 'f', 6, 64),
+		c.UID,
+		c.OrigH,
+		strconv.Itoa(int(c.OrigP)),
+		c.RespH,
+		strconv.Itoa(int(c.RespP)),
+		c.Proto,
+		zeekUnset, // service
+		strconv.FormatFloat(c.Duration, 'f', 6, 64),
+		strconv.FormatUint(c.OrigBytes, 10),
+		strconv.FormatUint(c.RespBytes, 10),
+		c.ConnState,
+		zeekUnset, // local_orig
+		zeekUnset, // local_resp
+		strconv.FormatUint(c.MissedBytes, 10),
+		zeekUnset, // history
+		strconv.FormatUint(uint64(c.OrigPkts), 10),
+		strconv.FormatUint(c.OrigIPBytes, 10),
+		strconv.FormatUint(uint64(c.RespPkts), 10),
+		strconv.FormatUint(c.RespIPBytes, 10),
+		zeekUnset, // tunnel_parents
+	}, "\t")
+}
+
+// zeekSink is a Sink appending flow records to a file laid out like Zeek's conn.log
+type zeekSink struct {
+	format string
+	file   *logging.RotatingFile
+}
+
+// writeZeekHeader writes the TSV header describing the log's fields
+func writeZeekHeader(w io.Writer, t time.Time) error {
+	_, err := fmt.Fprintf(w, "#separator \\x09\n#set_separator\t,\n#empty_field\t(empty)\n#unset_field\t%s\n#path\tconn\n#open\t%s\n#fields\t%s\n#types\t%s\n",
+		zeekUnset, t.Format(zeekTimeLayout), strings.Join(zeekConnFields, "\t"), strings.Join(zeekConnTypes, "\t"))
+	return err
+}
+
+// newZeekSink opens the conn.log file configured in parameters and returns a Sink to it
+func newZeekSink(parameters *config.Parameters) (*zeekSink, error) {
+	if parameters.ZeekFormat != config.TSVFormat && parameters.ZeekFormat != config.JSONFormat {
+		return nil, fmt.Errorf("unknown Zeek log format : %s", parameters.ZeekFormat)
+	}
+
+	file, err := openOutputFile(parameters.ZeekFile, parameters.FileRotation)
+	if err != nil {
+		return nil, fmt.Errorf("could not open Zeek log file : %s", err)
+	}
+
+	if parameters.ZeekFormat == config.TSVFormat {
+		if err := writeZeekHeader(file, time.Now()); err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("could not write Zeek log header : %s", err)
+		}
+
+		// Each rotated log is described by its own header
+		file.SetHeader(func(w io.Writer) error {
+			return writeZeekHeader(w, time.Now())
+		})
+	}
+
+	log.Info("Writing Zeek conn.log entries to ", parameters.ZeekFile)
+
+	return &zeekSink{
+		format: parameters.ZeekFormat,
+		file:   file,
+	}, nil
+}
+
+// SendReport writes a conn.log entry for each of the report's flows
+func (z *zeekSink) SendReport(r *analysis.Report) error {
+	for _, flow := range r.Flows {
+		conn := flowToZeek(flow)
+
+		var line []byte
+		if z.format == config.JSONFormat {
+			var err error
+			if line, err = json.Marshal(conn); err != nil {
+				return err
+			}
+		} else {
+			line = []byte(conn.tsv())
+		}
+
+		if _, err := z.file.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SendAlert does nothing, as conn.log only holds connections
+func (z *zeekSink) SendAlert(a *alert.Message) error {
+	return nil
+}
+
+// Close terminates the log and closes the file
+func (z *zeekSink) Close() error {
+	if z.format == config.TSVFormat {
+		if _, err := fmt.Fprintf(z.file, "#close\t%s\n", time.Now().Format(zeekTimeLayout)); err != nil {
+			log.Error("Could not close Zeek log : ", err)
+		}
+	}
+
+	return z.file.Close()
+}
@@ -0,0 +1,133 @@
+// Package process maps the sockets of the host to the local processes owning them, so that traffic is attributed to
+// the processes sending and receiving it
+package process
+
+import (
+	"context"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var log = config.Logger
+
+// Addresses sockets listening on all local addresses are bound to
+var wildcards = []string{"0.0.0.0", "::"}
+
+// Process is a local process, by PID and command name
+type Process struct {
+	PID  int
+	Name string
+}
+
+// String returns the process as <name>[<pid>]
+func (p Process) String() string {
+	return fmt.Sprintf("%s[%d]", p.Name, p.PID)
+}
+
+// Directory holds the processes owning the sockets of the host, by local and remote addresses. It is refreshed
+// periodically by Run, and may be read concurrently. Sockets of the last two listings are kept, for connections
+// closed in between to still be attributed.
+type Directory struct {
+	refresh  time.Duration
+	mutex    sync.RWMutex
+	current  map[string]Process // Processes by socket, as listed last
+	previous map[string]Process // Processes by socket, as listed before
+	local    map[string]bool    // Addresses of the host, which sockets listening on all addresses are bound to
+	failing  bool               // Whether the last listing failed, to only log the first of consecutive failures
+}
+
+// NewDirectory returns an empty directory of the processes owning the sockets of the host
+func NewDirectory(processes *config.ProcessConfig) *Directory {
+	return &Directory{
+		refresh:  processes.Refresh,
+		mutex:    sync.RWMutex{},
+		current:  make(map[string]Process),
+		previous: make(map[string]Process),
+		local:    make(map[string]bool),
+		failing:  false,
+	}
+}
+
+// Run lists the sockets of the host and their processes, and does again periodically until ctx is cancelled
+func (d *Directory) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.refresh)
+	defer ticker.Stop()
+
+	for {
+		d.update()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Lookup returns the local process owning the socket of the protocol, tcp or udp, bound to the local address and
+// connected to the remote one, if any. Sockets listening on all addresses own those of the host.
+func (d *Directory) Lookup(protocol, localIP string, localPort uint16, remoteIP string, remotePort uint16) (Process, bool) {
+	keys := []string{
+		socketKey(protocol, localIP, localPort, remoteIP, remotePort),
+		socketKey(protocol, localIP, localPort, "", 0),
+	}
+
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if d.local[localIP] {
+		for _, wildcard := range wildcards {
+			keys = append(keys, socketKey(protocol, wildcard, localPort, "", 0))
+		}
+	}
+
+	for _, sockets := range []map[string]Process{d.current, d.previous} {
+		for _, key := range keys {
+			if p, ok := sockets[key]; ok {
+				return p, true
+			}
+		}
+	}
+
+	return Process{}, false
+}
+
+// update lists the sockets of the host and their processes. If they cannot be listed, the directory is kept.
+func (d *Directory) update() {
+	sockets, err := listSockets()
+	if err != nil {
+		if !d.failing {
+			log.Error("Could not list the sockets of local processes : ", err)
+		}
+		d.failing = true
+		return
+	}
+	d.failing = false
+
+	local := make(map[string]bool)
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				local[ipNet.IP.String()] = true
+			}
+		}
+	}
+
+	d.mutex.Lock()
+	d.previous, d.current, d.local = d.current, sockets, local
+	d.mutex.Unlock()
+}
+
+// socketKey identifies a socket by its protocol and addresses. Sockets not connected have an empty remote address.
+func socketKey(protocol, localIP string, localPort uint16, remoteIP string, remotePort uint16) string {
+	key := protocol + "/" + net.JoinHostPort(localIP, strconv.Itoa(int(localPort)))
+	if remoteIP != "" {
+		key += "-" + net.JoinHostPort(remoteIP, strconv.Itoa(int(remotePort)))
+	}
+
+	return key
+}
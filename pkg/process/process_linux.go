@@ -0,0 +1,173 @@
+package process
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// Socket tables of procfs, by transport protocol
+var socketTables = map[string][]string{
+	"tcp": {"/proc/net/tcp", "/proc/net/tcp6"},
+	"udp": {"/proc/net/udp", "/proc/net/udp6"},
+}
+
+// Prefix and suffix of the targets of file descriptors that are sockets, around their inode
+const (
+	socketPrefix = "socket:["
+	socketSuffix = "]"
+)
+
+// nativeEndian is the byte order addresses are printed in by procfs, that of the host
+var nativeEndian binary.ByteOrder = binary.LittleEndian
+
+func init() {
+	one := uint16(1)
+	if *(*byte)(unsafe.Pointer(&one)) == 0 {
+		nativeEndian = binary.BigEndian
+	}
+}
+
+// listSockets returns the processes owning the TCP and UDP sockets of the host, by socket. Sockets of processes whose
+// file descriptors cannot be read, e.g. without privileges, are left out.
+func listSockets() (map[string]Process, error) {
+	inodes := make(map[string][]string) // Keys of sockets, by inode
+	for protocol, tables := range socketTables {
+		for _, table := range tables {
+			if err := readSocketTable(protocol, table, inodes); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+	}
+
+	dirs, err := filepath.Glob("/proc/[0-9]*")
+	if err != nil {
+		return nil, err
+	}
+
+	sockets := make(map[string]Process)
+	for _, dir := range dirs {
+		pid, err := strconv.Atoi(filepath.Base(dir))
+		if err != nil {
+			continue
+		}
+
+		fds, err := readDirNames(filepath.Join(dir, "fd"))
+		if err != nil {
+			continue
+		}
+
+		var p *Process
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(dir, "fd", fd))
+			if err != nil || !strings.HasPrefix(target, socketPrefix) {
+				continue
+			}
+			keys, ok := inodes[strings.TrimSuffix(strings.TrimPrefix(target, socketPrefix), socketSuffix)]
+			if !ok {
+				continue
+			}
+
+			if p == nil {
+				p = &Process{PID: pid, Name: processName(dir)}
+			}
+			for _, key := range keys {
+				sockets[key] = *p
+			}
+		}
+	}
+
+	return sockets, nil
+}
+
+// readSocketTable adds the keys of the sockets of the procfs table, by inode, to inodes
+func readSocketTable(protocol, path string, inodes map[string][]string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // Header
+	for scanner.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[9] == "0" {
+			continue
+		}
+
+		localIP, localPort, err := parseSocketAddress(fields[1])
+		if err != nil {
+			continue
+		}
+		remoteIP, remotePort, err := parseSocketAddress(fields[2])
+		if err != nil {
+			continue
+		}
+
+		// Sockets are looked up by both addresses if connected, else by their local address
+		keys := []string{socketKey(protocol, localIP, localPort, "", 0)}
+		if remotePort != 0 {
+			keys = append(keys, socketKey(protocol, localIP, localPort, remoteIP, remotePort))
+		}
+		inodes[fields[9]] = append(inodes[fields[9]], keys...)
+	}
+
+	return scanner.Err()
+}
+
+// parseSocketAddress parses an address of a procfs socket table, as hexadecimal words of the IP address in the byte
+// order of the host, a colon and the hexadecimal port
+func parseSocketAddress(s string) (string, uint16, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return "", 0, fmt.Errorf("malformed socket address %q", s)
+	}
+
+	words, err := hex.DecodeString(parts[0])
+	if err != nil || (len(words) != net.IPv4len && len(words) != net.IPv6len) {
+		return "", 0, fmt.Errorf("malformed socket address %q", s)
+	}
+	ip := make(net.IP, len(words))
+	for i := 0; i < len(words); i += 4 {
+		nativeEndian.PutUint32(ip[i:], binary.BigEndian.Uint32(words[i:]))
+	}
+
+	port, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return "", 0, errors.New("malformed socket port")
+	}
+
+	return ip.String(), uint16(port), nil
+}
+
+// readDirNames returns the names of the entries of the directory
+func readDirNames(path string) ([]string, error) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	return dir.Readdirnames(-1)
+}
+
+// processName returns the command name of the process whose procfs directory is dir, empty if it cannot be read
+func processName(dir string) string {
+	comm, err := ioutil.ReadFile(filepath.Join(dir, "comm"))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(comm))
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package process
+
+import (
+	"errors"
+)
+
+// listSockets fails, as sockets are only listed through the procfs of Linux
+func listSockets() (map[string]Process, error) {
+	return nil, errors.New("attributing traffic to processes is only supported on linux")
+}
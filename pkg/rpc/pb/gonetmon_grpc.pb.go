@@ -0,0 +1,276 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.21.12
+// source: gonetmon.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// MonitorClient is the client API for Monitor service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MonitorClient interface {
+	// GetConfig returns the configuration the monitor runs with
+	GetConfig(ctx context.Context, in *GetConfigRequest, opts ...grpc.CallOption) (*Config, error)
+	// UpdateFilters replaces the capture filters set in the request, and returns the resulting filters
+	UpdateFilters(ctx context.Context, in *UpdateFiltersRequest, opts ...grpc.CallOption) (*Filters, error)
+	// StreamReports streams reports as they are built, until the client cancels
+	StreamReports(ctx context.Context, in *StreamReportsRequest, opts ...grpc.CallOption) (Monitor_StreamReportsClient, error)
+	// SubscribeAlerts streams alerts and recoveries as they are raised, until the client cancels
+	SubscribeAlerts(ctx context.Context, in *SubscribeAlertsRequest, opts ...grpc.CallOption) (Monitor_SubscribeAlertsClient, error)
+}
+
+type monitorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMonitorClient(cc grpc.ClientConnInterface) MonitorClient {
+	return &monitorClient{cc}
+}
+
+func (c *monitorClient) GetConfig(ctx context.Context, in *GetConfigRequest, opts ...grpc.CallOption) (*Config, error) {
+	out := new(Config)
+	err := c.cc.Invoke(ctx, "/gonetmon.v1.Monitor/GetConfig", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *monitorClient) UpdateFilters(ctx context.Context, in *UpdateFiltersRequest, opts ...grpc.CallOption) (*Filters, error) {
+	out := new(Filters)
+	err := c.cc.Invoke(ctx, "/gonetmon.v1.Monitor/UpdateFilters", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *monitorClient) StreamReports(ctx context.Context, in *StreamReportsRequest, opts ...grpc.CallOption) (Monitor_StreamReportsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Monitor_ServiceDesc.Streams[0], "/gonetmon.v1.Monitor/StreamReports", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &monitorStreamReportsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Monitor_StreamReportsClient interface {
+	Recv() (*Report, error)
+	grpc.ClientStream
+}
+
+type monitorStreamReportsClient struct {
+	grpc.ClientStream
+}
+
+func (x *monitorStreamReportsClient) Recv() (*Report, error) {
+	m := new(Report)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *monitorClient) SubscribeAlerts(ctx context.Context, in *SubscribeAlertsRequest, opts ...grpc.CallOption) (Monitor_SubscribeAlertsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Monitor_ServiceDesc.Streams[1], "/gonetmon.v1.Monitor/SubscribeAlerts", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &monitorSubscribeAlertsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Monitor_SubscribeAlertsClient interface {
+	Recv() (*Alert, error)
+	grpc.ClientStream
+}
+
+type monitorSubscribeAlertsClient struct {
+	grpc.ClientStream
+}
+
+func (x *monitorSubscribeAlertsClient) Recv() (*Alert, error) {
+	m := new(Alert)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// MonitorServer is the server API for Monitor service.
+// All implementations must embed UnimplementedMonitorServer
+// for forward compatibility
+type MonitorServer interface {
+	// GetConfig returns the configuration the monitor runs with
+	GetConfig(context.Context, *GetConfigRequest) (*Config, error)
+	// UpdateFilters replaces the capture filters set in the request, and returns the resulting filters
+	UpdateFilters(context.Context, *UpdateFiltersRequest) (*Filters, error)
+	// StreamReports streams reports as they are built, until the client cancels
+	StreamReports(*StreamReportsRequest, Monitor_StreamReportsServer) error
+	// SubscribeAlerts streams alerts and recoveries as they are raised, until the client cancels
+	SubscribeAlerts(*SubscribeAlertsRequest, Monitor_SubscribeAlertsServer) error
+	mustEmbedUnimplementedMonitorServer()
+}
+
+// UnimplementedMonitorServer must be embedded to have forward compatible implementations.
+type UnimplementedMonitorServer struct {
+}
+
+func (UnimplementedMonitorServer) GetConfig(context.Context, *GetConfigRequest) (*Config, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetConfig not implemented")
+}
+func (UnimplementedMonitorServer) UpdateFilters(context.Context, *UpdateFiltersRequest) (*Filters, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateFilters not implemented")
+}
+func (UnimplementedMonitorServer) StreamReports(*StreamReportsRequest, Monitor_StreamReportsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamReports not implemented")
+}
+func (UnimplementedMonitorServer) SubscribeAlerts(*SubscribeAlertsRequest, Monitor_SubscribeAlertsServer) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeAlerts not implemented")
+}
+func (UnimplementedMonitorServer) mustEmbedUnimplementedMonitorServer() {}
+
+// UnsafeMonitorServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MonitorServer will
+// result in compilation errors.
+type UnsafeMonitorServer interface {
+	mustEmbedUnimplementedMonitorServer()
+}
+
+func RegisterMonitorServer(s grpc.ServiceRegistrar, srv MonitorServer) {
+	s.RegisterService(&Monitor_ServiceDesc, srv)
+}
+
+func _Monitor_GetConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MonitorServer).GetConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gonetmon.v1.Monitor/GetConfig",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MonitorServer).GetConfig(ctx, req.(*GetConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Monitor_UpdateFilters_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateFiltersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MonitorServer).UpdateFilters(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gonetmon.v1.Monitor/UpdateFilters",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MonitorServer).UpdateFilters(ctx, req.(*UpdateFiltersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Monitor_StreamReports_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamReportsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MonitorServer).StreamReports(m, &monitorStreamReportsServer{stream})
+}
+
+type Monitor_StreamReportsServer interface {
+	Send(*Report) error
+	grpc.ServerStream
+}
+
+type monitorStreamReportsServer struct {
+	grpc.ServerStream
+}
+
+func (x *monitorStreamReportsServer) Send(m *Report) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Monitor_SubscribeAlerts_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeAlertsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MonitorServer).SubscribeAlerts(m, &monitorSubscribeAlertsServer{stream})
+}
+
+type Monitor_SubscribeAlertsServer interface {
+	Send(*Alert) error
+	grpc.ServerStream
+}
+
+type monitorSubscribeAlertsServer struct {
+	grpc.ServerStream
+}
+
+func (x *monitorSubscribeAlertsServer) Send(m *Alert) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Monitor_ServiceDesc is the grpc.ServiceDesc for Monitor service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Monitor_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gonetmon.v1.Monitor",
+	HandlerType: (*MonitorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetConfig",
+			Handler:    _Monitor_GetConfig_Handler,
+		},
+		{
+			MethodName: "UpdateFilters",
+			Handler:    _Monitor_UpdateFilters_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamReports",
+			Handler:       _Monitor_StreamReports_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "SubscribeAlerts",
+			Handler:       _Monitor_SubscribeAlerts_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "gonetmon.proto",
+}
@@ -0,0 +1,352 @@
+// Package rpc serves a gRPC API exposing the configuration of a running monitor, and streaming its reports and alerts
+package rpc
+
+//go:generate protoc -I pb --go_out=pb --go_opt=paths=source_relative --go-grpc_out=pb --go-grpc_opt=paths=source_relative pb/gonetmon.proto
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/alert"
+	"github.com/bytemare/gonetmon/pkg/analysis"
+	"github.com/bytemare/gonetmon/pkg/capture"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"github.com/bytemare/gonetmon/pkg/output"
+	"github.com/bytemare/gonetmon/pkg/rpc/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+var log = config.Logger
+
+// Maximum time to wait for pending calls when closing the server
+const shutdownTimeout = 5 * time.Second
+
+// Server serves the gRPC API. It is a Sink, streaming the reports and alerts it receives to subscribed clients.
+type Server struct {
+	pb.UnimplementedMonitorServer
+
+	server        *grpc.Server
+	parameters    *config.Parameters
+	devices       *capture.Devices
+	token         string
+	clientBufSize uint
+	mutex         sync.Mutex
+	reports       map[chan *pb.Report]struct{} // Report queues of the streaming clients
+	alerts        map[chan *pb.Alert]struct{}  // Alert queues of the subscribed clients
+}
+
+// NewServer starts serving the gRPC API on the address configured in parameters, acting on devices
+func NewServer(parameters *config.Parameters, devices *capture.Devices) (*Server, error) {
+	config := parameters.GRPC
+
+	if config.ClientBufSize == 0 {
+		return nil, errors.New("the gRPC client buffer size must be positive")
+	}
+
+	listener, err := net.Listen("tcp", config.Address)
+	if err != nil {
+		return nil, fmt.Errorf("could not listen on %s : %s", config.Address, err)
+	}
+
+	s := &Server{
+		server:        nil,
+		parameters:    parameters,
+		devices:       devices,
+		token:         config.Token,
+		clientBufSize: config.ClientBufSize,
+		mutex:         sync.Mutex{},
+		reports:       make(map[chan *pb.Report]struct{}),
+		alerts:        make(map[chan *pb.Alert]struct{}),
+	}
+
+	s.server = grpc.NewServer(
+		grpc.UnaryInterceptor(s.authenticateUnary),
+		grpc.StreamInterceptor(s.authenticateStream),
+	)
+	pb.RegisterMonitorServer(s.server, s)
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil {
+			log.Error("gRPC server failed : ", err)
+		}
+	}()
+
+	log.Info("Serving gRPC API on ", listener.Addr())
+
+	return s, nil
+}
+
+// authenticate checks the bearer token in the authorization metadata of the call, if a token is configured
+func (s *Server) authenticate(ctx context.Context) error {
+	if s.token == "" {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		token := strings.TrimPrefix(value, "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1 {
+			return nil
+		}
+	}
+
+	return status.Error(codes.Unauthenticated, "missing or invalid token")
+}
+
+// authenticateUnary rejects unary calls without the configured token
+func (s *Server) authenticateUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.authenticate(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authenticateStream rejects streaming calls without the configured token
+func (s *Server) authenticateStream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.authenticate(stream.Context()); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// filters returns the message of the capture filters
+func (s *Server) filters() *pb.Filters {
+	filter := s.devices.Filter()
+	return &pb.Filters{Network: filter.Network, Application: filter.Application}
+}
+
+// GetConfig returns the configuration the monitor runs with
+func (s *Server) GetConfig(ctx context.Context, req *pb.GetConfigRequest) (*pb.Config, error) {
+	return &pb.Config{
+		Filters:        s.filters(),
+		CaptureSource:  s.parameters.CaptureConfig.Source,
+		Interfaces:     s.parameters.Interfaces,
+		Analyzers:      s.parameters.Analyzers,
+		Outputs:        s.parameters.Outputs,
+		ReportInterval: durationpb.New(s.parameters.DisplayRefresh),
+		AlertSpan:      durationpb.New(s.parameters.AlertSpan),
+		AlertThreshold: uint32(s.parameters.AlertThreshold),
+		TimeZone:       s.parameters.TimeZone.String(),
+	}, nil
+}
+
+// UpdateFilters replaces the capture filters set in the request, and returns the resulting filters
+func (s *Server) UpdateFilters(ctx context.Context, req *pb.UpdateFiltersRequest) (*pb.Filters, error) {
+	filter := s.devices.Filter()
+	if req.Network != nil {
+		filter.Network = req.GetNetwork()
+	}
+	if req.Application != nil {
+		filter.Application = req.GetApplication()
+	}
+
+	if err := s.devices.SetFilter(filter); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return s.filters(), nil
+}
+
+// StreamReports streams reports as they are received, until the client cancels or the server is closed
+func (s *Server) StreamReports(req *pb.StreamReportsRequest, stream pb.Monitor_StreamReportsServer) error {
+	reports := make(chan *pb.Report, s.clientBufSize)
+
+	s.mutex.Lock()
+	s.reports[reports] = struct{}{}
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		if _, ok := s.reports[reports]; ok {
+			delete(s.reports, reports)
+			close(reports)
+		}
+		s.mutex.Unlock()
+	}()
+
+	for {
+		select {
+		case report, ok := <-reports:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(report); err != nil {
+				return err
+			}
+
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// SubscribeAlerts streams alerts and recoveries as they are received, until the client cancels or the server is closed
+func (s *Server) SubscribeAlerts(req *pb.SubscribeAlertsRequest, stream pb.Monitor_SubscribeAlertsServer) error {
+	alerts := make(chan *pb.Alert, s.clientBufSize)
+
+	s.mutex.Lock()
+	s.alerts[alerts] = struct{}{}
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		if _, ok := s.alerts[alerts]; ok {
+			delete(s.alerts, alerts)
+			close(alerts)
+		}
+		s.mutex.Unlock()
+	}()
+
+	for {
+		select {
+		case a, ok := <-alerts:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(a); err != nil {
+				return err
+			}
+
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// newReport returns the message of a report
+func newReport(r *analysis.Report) *pb.Report {
+	report := output.NewReportJSON(r)
+
+	message := &pb.Report{
+		Timestamp:  timestamppb.New(report.Timestamp),
+		Hits:       int64(report.Hits),
+		Bytes:      report.Bytes,
+		Interfaces: make(map[string]*pb.InterfaceStats, len(report.Interfaces)),
+		TopHost:    nil,
+		Sections:   make([]*pb.Section, 0, len(report.Sections)),
+		Flows:      int64(report.Flows),
+		Events:     make(map[string]int64, len(report.Events)),
+	}
+
+	for name, stats := range report.Interfaces {
+		message.Interfaces[name] = &pb.InterfaceStats{Hits: int64(stats.Hits), Bytes: stats.Bytes}
+	}
+
+	if report.TopHost != nil {
+		responses := make(map[string]uint64, len(report.TopHost.Responses))
+		for code, nb := range report.TopHost.Responses {
+			responses[code] = uint64(nb)
+		}
+
+		message.TopHost = &pb.Host{
+			Host:      report.TopHost.Host,
+			Ips:       report.TopHost.IPs,
+			Hits:      int64(report.TopHost.Hits),
+			Responses: responses,
+		}
+	}
+
+	for _, section := range report.Sections {
+		methods := make(map[string]uint64, len(section.Methods))
+		for method, nb := range section.Methods {
+			methods[method] = uint64(nb)
+		}
+
+		message.Sections = append(message.Sections, &pb.Section{
+			Section: section.Section,
+			Hits:    int64(section.Hits),
+			Methods: methods,
+		})
+	}
+
+	for analyzer, nb := range report.Events {
+		message.Events[analyzer] = int64(nb)
+	}
+
+	return message
+}
+
+// Name returns the name of the gRPC API as an output
+func (s *Server) Name() string {
+	return "grpc"
+}
+
+// SendReport queues the report for all streaming clients, dropping it for those too far behind
+func (s *Server) SendReport(r *analysis.Report) error {
+	report := newReport(r)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for reports := range s.reports {
+		select {
+		case reports <- report:
+		default:
+			log.Warn("gRPC report stream queue is full, dropping report.")
+		}
+	}
+
+	return nil
+}
+
+// SendAlert queues the alert for all subscribed clients, dropping it for those too far behind
+func (s *Server) SendAlert(a *alert.Message) error {
+	message := &pb.Alert{
+		Id:        a.ID,
+		Timestamp: timestamppb.New(a.Timestamp),
+		Recovery:  a.Recovery,
+		Message:   a.Body,
+		Evidence:  a.Evidence,
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for alerts := range s.alerts {
+		select {
+		case alerts <- message:
+		default:
+			log.Warn("gRPC alert subscription queue is full, dropping alert.")
+		}
+	}
+
+	return nil
+}
+
+// Close ends the streams of all clients and stops the server, waiting for pending calls until a timeout
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	for reports := range s.reports {
+		delete(s.reports, reports)
+		close(reports)
+	}
+	for alerts := range s.alerts {
+		delete(s.alerts, alerts)
+		close(alerts)
+	}
+	s.mutex.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(shutdownTimeout):
+		s.server.Stop()
+	}
+
+	return nil
+}
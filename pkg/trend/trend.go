@@ -0,0 +1,208 @@
+// Package trend keeps the long-term bandwidth trends of links, as the peak rate of each day persisted to a file across
+// runs, and forecasts when links will reach their capacity
+package trend
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bytemare/gonetmon/pkg/config"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var log = config.Logger
+
+// Layout of the dates of days in the trends file
+const dateLayout = "2006-01-02"
+
+// Days of trends a link must have for the weekly seasonality of its bandwidth to be projected
+const seasonalDays = 14
+
+// Day holds the peak bandwidth of a link over a day
+type Day struct {
+	Date string  `json:"date"` // Date of the day, as 2006-01-02 in the time zone of reports
+	Peak float64 `json:"peak"` // Highest rate of a report window of the day, in bits per second
+}
+
+// fileJSON is the layout of the trends file
+type fileJSON struct {
+	Links map[string][]Day `json:"links"`
+}
+
+// Trends holds the daily peak bandwidth of links, by interface, loaded from and saved to its file. It is to be used
+// from a single goroutine.
+type Trends struct {
+	file    string
+	history int              // Days kept, past which the oldest are forgotten
+	minDays int              // Days a link must have to be forecast
+	links   map[string][]Day // Days of each link, oldest first
+	dirty   bool             // Whether days changed since the trends were last saved
+}
+
+// New returns the trends kept in the configured file, which is created on first save if it does not exist
+func New(capacity *config.CapacityConfig) (*Trends, error) {
+	t := &Trends{
+		file:    capacity.File,
+		history: capacity.History,
+		minDays: capacity.MinDays,
+		links:   make(map[string][]Day),
+		dirty:   false,
+	}
+
+	content, err := ioutil.ReadFile(capacity.File)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		var trends fileJSON
+		if err := json.Unmarshal(content, &trends); err != nil {
+			return nil, fmt.Errorf("could not decode trends %s : %s", capacity.File, err)
+		}
+		for link, days := range trends.Links {
+			t.links[link] = days
+		}
+	}
+
+	log.Info("Bandwidth trends of ", len(t.links), " links loaded from ", capacity.File)
+
+	return t, nil
+}
+
+// Add accounts the rates of links over a report window ending at at, in bits per second by interface, in the peaks of
+// their days
+func (t *Trends) Add(rates map[string]float64, at time.Time) {
+	date := at.Format(dateLayout)
+	for link, rate := range rates {
+		days := t.links[link]
+		if len(days) == 0 || days[len(days)-1].Date != date {
+			days = append(days, Day{Date: date, Peak: 0})
+			if len(days) > t.history {
+				days = days[len(days)-t.history:]
+			}
+		}
+		if last := &days[len(days)-1]; rate > last.Peak {
+			last.Peak = rate
+			t.dirty = true
+		}
+		t.links[link] = days
+	}
+}
+
+// Forecast returns the days from at until each link is projected to reach its capacity, in bits per second by
+// interface, for the links projected to within the horizon. Links are projected once they have the minimum days of
+// trends, along the line fitting the peaks of their past days, with their weekly seasonality once they have two weeks
+// of them. The day of at is day 0.
+func (t *Trends) Forecast(capacities map[string]float64, horizon int, at time.Time) map[string]int {
+	forecasts := make(map[string]int)
+	for link, capacity := range capacities {
+		// The day of at is not over, and its peak may be yet to come
+		days := t.links[link]
+		if len(days) > 0 && days[len(days)-1].Date == at.Format(dateLayout) {
+			days = days[:len(days)-1]
+		}
+		if len(days) < t.minDays || len(days) < 2 {
+			continue
+		}
+
+		if day, ok := project(days, capacity, horizon, at); ok {
+			forecasts[link] = day
+		}
+	}
+
+	return forecasts
+}
+
+// project returns the first day from at, up to the horizon, on which the projection of the peaks of days reaches the
+// capacity
+func project(days []Day, capacity float64, horizon int, at time.Time) (int, bool) {
+	origin, err := time.ParseInLocation(dateLayout, days[0].Date, at.Location())
+	if err != nil {
+		return 0, false
+	}
+	index := func(date time.Time) float64 {
+		return math.Round(date.Sub(origin).Hours() / 24)
+	}
+
+	// Least squares fit of the peaks against the days since the first one
+	xs, ys := make([]float64, 0, len(days)), make([]float64, 0, len(days))
+	var sumX, sumY float64
+	for _, day := range days {
+		date, err := time.ParseInLocation(dateLayout, day.Date, at.Location())
+		if err != nil {
+			continue
+		}
+		xs, ys = append(xs, index(date)), append(ys, day.Peak)
+		sumX, sumY = sumX+xs[len(xs)-1], sumY+day.Peak
+	}
+	if len(xs) < 2 {
+		return 0, false
+	}
+	n := float64(len(xs))
+	meanX, meanY := sumX/n, sumY/n
+	var covariance, variance float64
+	for i := range xs {
+		covariance += (xs[i] - meanX) * (ys[i] - meanY)
+		variance += (xs[i] - meanX) * (xs[i] - meanX)
+	}
+	slope := 0.0
+	if variance > 0 {
+		slope = covariance / variance
+	}
+	intercept := meanY - slope*meanX
+
+	// Weekly seasonality, as the mean deviation of the peaks of each weekday from the line
+	var season [7]float64
+	if len(days) >= seasonalDays {
+		var counts [7]float64
+		for i := range xs {
+			weekday := origin.AddDate(0, 0, int(xs[i])).Weekday()
+			season[weekday] += ys[i] - (intercept + slope*xs[i])
+			counts[weekday]++
+		}
+		for weekday := range season {
+			if counts[weekday] > 0 {
+				season[weekday] /= counts[weekday]
+			}
+		}
+	}
+
+	today := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, at.Location())
+	for day := 0; day <= horizon; day++ {
+		date := today.AddDate(0, 0, day)
+		if intercept+slope*index(date)+season[date.Weekday()] >= capacity {
+			return day, true
+		}
+	}
+
+	return 0, false
+}
+
+// Save writes the trends to their file if they changed since they were last saved. The file is replaced at once, so
+// that it is never left half written.
+func (t *Trends) Save() error {
+	if !t.dirty {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(fileJSON{Links: t.links}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.file), 0755); err != nil {
+		return err
+	}
+	temporary := t.file + ".tmp"
+	if err := ioutil.WriteFile(temporary, content, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(temporary, t.file); err != nil {
+		return err
+	}
+	t.dirty = false
+
+	return nil
+}
@@ -0,0 +1,44 @@
+// Package version holds the version of the build, and the commit and date it was built from. They are set at link
+// time, e.g. :
+//
+//	go build -ldflags "-X github.com/bytemare/gonetmon/pkg/version.Version=v1.2.0 \
+//		-X github.com/bytemare/gonetmon/pkg/version.Commit=$(git rev-parse --short HEAD) \
+//		-X github.com/bytemare/gonetmon/pkg/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/gonetmon
+package version
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Build metadata, left to their defaults when not set at link time
+var (
+	Version = "dev"     // Version of the build, e.g. a release tag
+	Commit  = "unknown" // Commit the build was made from
+	Date    = "unknown" // Date of the build, preferably in RFC 3339
+)
+
+// Info is the build metadata of the running binary, along with the Go toolchain and platform it was built for
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// Get returns the build metadata of the running binary
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+}
+
+// String returns the build metadata on a single line
+func (i Info) String() string {
+	return fmt.Sprintf("gonetmon %s (commit %s, built %s, %s %s)", i.Version, i.Commit, i.Date, i.GoVersion, i.Platform)
+}